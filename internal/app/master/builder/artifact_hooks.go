@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Artifact hook environment variables
+const (
+	ArtifactHookEnvArtifacts = "DSLIM_ARTIFACTS_DIR"
+	ArtifactHookEnvFiles     = "DSLIM_FILES_DIR"
+	ArtifactHookEnvImage     = "DSLIM_TARGET_IMAGE"
+	ArtifactHookEnvMinified  = "DSLIM_MINIFIED_IMAGE"
+)
+
+// RunArtifactHooks runs the user scripts against the artifact directory (in the hook order)
+// and returns the minified image file changes each script made.
+// The scripts run in the artifact directory and get the minified image files directory as their argument.
+// A failed script fails the build.
+func (b *ImageBuilder) RunArtifactHooks(artifactLocation string, targetImage string, hooks []string) ([]*report.ArtifactHookRun, error) {
+	dataDir := filepath.Join(artifactLocation, "files")
+	var runs []*report.ArtifactHookRun
+	for _, hook := range hooks {
+		before, err := hookFileState(dataDir)
+		if err != nil {
+			return runs, err
+		}
+
+		cmd := exec.Command(hook, dataDir)
+		cmd.Dir = artifactLocation
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("%s=%s", ArtifactHookEnvArtifacts, artifactLocation),
+			fmt.Sprintf("%s=%s", ArtifactHookEnvFiles, dataDir),
+			fmt.Sprintf("%s=%s", ArtifactHookEnvImage, targetImage),
+			fmt.Sprintf("%s=%s", ArtifactHookEnvMinified, b.RepoName))
+
+		output, err := cmd.CombinedOutput()
+		log.Debugf("RunArtifactHooks: %v output:\n%s", hook, output)
+		if err != nil {
+			return runs, fmt.Errorf("artifact hook failed (%s): %v\n%s", hook, err, strings.TrimSpace(string(output)))
+		}
+
+		after, err := hookFileState(dataDir)
+		if err != nil {
+			return runs, err
+		}
+
+		run := &report.ArtifactHookRun{Script: hook}
+		for filePath, state := range after {
+			if prevState, found := before[filePath]; !found {
+				run.Added = append(run.Added, filePath)
+			} else if prevState != state {
+				run.Modified = append(run.Modified, filePath)
+			}
+		}
+
+		for filePath := range before {
+			if _, found := after[filePath]; !found {
+				run.Removed = append(run.Removed, filePath)
+			}
+		}
+
+		sort.Strings(run.Added)
+		sort.Strings(run.Modified)
+		sort.Strings(run.Removed)
+		runs = append(runs, run)
+	}
+
+	//the scripts can create (or remove) all minified image files
+	b.HasData = fsutil.IsDir(dataDir)
+	return runs, nil
+}
+
+// hookFileState returns the minified image file states (the type, the mode, the digest and the link target)
+func hookFileState(dataDir string) (map[string]string, error) {
+	state := map[string]string{}
+	if !fsutil.IsDir(dataDir) {
+		return state, nil
+	}
+
+	files, err := contextFiles(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		state[file.Path] = strings.Join([]string{file.Type, file.Mode, file.Digest, file.Link}, "|")
+	}
+
+	return state, nil
+}
@@ -0,0 +1,442 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+)
+
+//NOTES:
+//* with a base image the minified image is built 'FROM' the base image instead of 'FROM scratch'
+//  and the artifact files are copied on top of the base image filesystem
+//* the artifact files the base image already has (the same path, contents and permissions) are not copied,
+//  so the base image updates (e.g., the patched OS packages) are not shadowed by the copied files
+//* the other artifact files with the base image paths replace the base image files (they are reported),
+//  and the minified image executables need the source image libc, so the base image libc (glibc or musl)
+//  and distro ('/etc/os-release') are compared with the source image libc and distro
+
+// the os-release file locations (the first file the image has is used)
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// baseFile is a regular file or a symlink in the base image filesystem
+type baseFile struct {
+	//mode is the file mode string (like 'ls -l' shows it)
+	mode   string
+	size   int64
+	digest string
+	link   string
+	//data is the file data (only for the os-release files)
+	data []byte
+}
+
+// RemoveBaseFiles removes the artifact files that are the same in the base image
+// and returns the base image check with the number of the removed files, their total size
+// and the base image files the other artifact files replace
+func (b *ImageBuilder) RemoveBaseFiles(artifactLocation string) (*report.BaseImageCheck, error) {
+	if !b.HasData || b.BaseImage == "" {
+		return nil, nil
+	}
+
+	baseFiles, err := b.baseImageFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := filepath.Join(artifactLocation, "files")
+	result := &report.BaseImageCheck{
+		Image:  b.BaseImage,
+		Distro: osReleaseName(baseOSRelease(baseFiles)),
+	}
+
+	var basePaths []string
+	for filePath := range baseFiles {
+		basePaths = append(basePaths, filePath)
+	}
+	result.Libc = libcName(basePaths)
+
+	//the minified image files are checked before the same files are removed
+	sourcePaths, err := dataFilePaths(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	result.SourceLibc = libcName(sourcePaths)
+
+	sourceOSRelease, err := b.sourceOSRelease(dataDir)
+	if err != nil {
+		log.Debugf("RemoveBaseFiles: no source image os-release => %v", err)
+	}
+	result.SourceDistro = osReleaseName(sourceOSRelease)
+
+	result.Mismatch = (result.Libc != "" && result.SourceLibc != "" && result.Libc != result.SourceLibc) ||
+		(result.Distro != "" && result.SourceDistro != "" &&
+			osReleaseField(baseOSRelease(baseFiles), "ID") != osReleaseField(sourceOSRelease, "ID"))
+
+	result.RemovedFiles, result.RemovedSize, result.OverriddenFiles, err = removeSameFiles(dataDir, baseFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("RemoveBaseFiles: removed %v files (%v bytes) the base image has - %v",
+		result.RemovedFiles, result.RemovedSize, b.BaseImage)
+	return result, nil
+}
+
+// sourceOSRelease returns the source image os-release file data
+// (from the minified image files or from the source image if the minified image doesn't have it)
+func (b *ImageBuilder) sourceOSRelease(dataDir string) ([]byte, error) {
+	for _, imagePath := range osReleasePaths {
+		if fullPath, err := fsutil.ResolveRootPath(dataDir, imagePath, false); err == nil {
+			if data, err := ioutil.ReadFile(filepath.Join(dataDir, filepath.FromSlash(fullPath))); err == nil {
+				return data, nil
+			}
+		}
+	}
+
+	source, err := b.newSourceFiles(b.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer source.close()
+
+	configRoot, err := ioutil.TempDir("", "docker-slim-source-files")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(configRoot)
+
+	files := &loaderConfig{
+		source:  source,
+		root:    configRoot,
+		fetched: map[string]bool{},
+	}
+
+	for _, imagePath := range osReleasePaths {
+		if fullPath, found := files.resolve(imagePath); found {
+			return ioutil.ReadFile(fullPath)
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// baseOSRelease returns the base image os-release file data
+func baseOSRelease(baseFiles map[string]*baseFile) []byte {
+	for _, imagePath := range osReleasePaths {
+		for hops := 0; hops <= fsutil.MaxLinkHops; hops++ {
+			file, found := baseFiles[imagePath]
+			if !found {
+				break
+			}
+
+			if file.link == "" {
+				return file.data
+			}
+
+			if path.IsAbs(file.link) {
+				imagePath = path.Clean(file.link)
+			} else {
+				imagePath = path.Join(path.Dir(imagePath), file.link)
+			}
+		}
+	}
+
+	return nil
+}
+
+// osReleaseField returns the os-release field value (e.g., 'ID' or 'VERSION_ID')
+func osReleaseField(data []byte, name string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if value := strings.TrimPrefix(strings.TrimSpace(line), name+"="); value != strings.TrimSpace(line) {
+			return strings.Trim(value, `"'`)
+		}
+	}
+
+	return ""
+}
+
+// osReleaseName returns the distro name and version (e.g., 'debian 12' or 'alpine 3.19.1')
+func osReleaseName(data []byte) string {
+	return strings.TrimSpace(osReleaseField(data, "ID") + " " + osReleaseField(data, "VERSION_ID"))
+}
+
+// libcName returns the libc the files have ('glibc' or 'musl'; the loader file names are used)
+func libcName(filePaths []string) string {
+	var libc string
+	for _, filePath := range filePaths {
+		name := path.Base(filePath)
+		switch {
+		case strings.HasPrefix(name, "ld-musl-"):
+			return "musl"
+		case strings.HasPrefix(name, "ld-linux") || name == "libc.so.6":
+			libc = "glibc"
+		}
+	}
+
+	return libc
+}
+
+// dataFilePaths returns the image paths of the data directory files
+func dataFilePaths(dataDir string) ([]string, error) {
+	var filePaths []string
+	err := filepath.Walk(dataDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			filePaths = append(filePaths, "/"+strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(fullPath, dataDir)), "/"))
+		}
+
+		return nil
+	})
+
+	return filePaths, err
+}
+
+// maxUnusedBaseRatio is the max part of the base image file data the minified image can leave unused
+// for the base image to be reused as is by the 'reuse-base' layer strategy
+const maxUnusedBaseRatio = 0.1
+
+// ReuseBaseImage builds the minified image from the target image base image (its layers are reused as is)
+// if the base image is already minimal (the minified image needs almost all of its file data)
+// and returns the base image check results. If the base image is reused, the artifact files
+// the base image already has are removed (like with RemoveBaseFiles).
+func (b *ImageBuilder) ReuseBaseImage(artifactLocation, baseImage string) (*report.BaseReuse, error) {
+	if !b.HasData || baseImage == "" {
+		return nil, nil
+	}
+
+	b.BaseImage = baseImage
+	baseFiles, err := b.baseImageFiles()
+	if err != nil {
+		b.BaseImage = ""
+		return nil, err
+	}
+
+	dataDir := filepath.Join(artifactLocation, "files")
+	result := &report.BaseReuse{Image: baseImage}
+	for filePath, base := range baseFiles {
+		if base.link != "" {
+			continue
+		}
+
+		result.Size += base.size
+		if _, err := os.Lstat(filepath.Join(dataDir, filepath.FromSlash(filePath))); os.IsNotExist(err) {
+			result.UnusedSize += base.size
+		}
+	}
+
+	if float64(result.UnusedSize) > float64(result.Size)*maxUnusedBaseRatio {
+		log.Debugf("ReuseBaseImage: base image is not minimal (%v of %v bytes are not used) - %v",
+			result.UnusedSize, result.Size, baseImage)
+		b.BaseImage = ""
+		return result, nil
+	}
+
+	count, size, _, err := removeSameFiles(dataDir, baseFiles)
+	if err != nil {
+		b.BaseImage = ""
+		return nil, err
+	}
+
+	result.Reused = true
+	log.Debugf("ReuseBaseImage: removed %v files (%v bytes) the base image has - %v", count, size, baseImage)
+	return result, nil
+}
+
+// removeSameFiles removes the data directory files that have the same path, contents and permissions
+// as the base files and returns the number of the removed files, their total size
+// and the base file paths the other data directory files replace
+func removeSameFiles(dataDir string, baseFiles map[string]*baseFile) (int, int64, []string, error) {
+	var removedFiles []string
+	var removedSize int64
+	var overridden []string
+	err := filepath.Walk(dataDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, dataDir), "/")
+		base, found := baseFiles[filePath]
+		if !found {
+			return nil
+		}
+
+		if base.mode != info.Mode().String() {
+			overridden = append(overridden, filePath)
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(fullPath)
+			if err != nil || target != base.link {
+				overridden = append(overridden, filePath)
+				return nil
+			}
+		} else {
+			if info.Size() != base.size {
+				overridden = append(overridden, filePath)
+				return nil
+			}
+
+			digest, err := fileDigest(fullPath)
+			if err != nil {
+				return err
+			}
+
+			if digest != base.digest {
+				overridden = append(overridden, filePath)
+				return nil
+			}
+		}
+
+		removedFiles = append(removedFiles, fullPath)
+		if info.Mode().IsRegular() {
+			removedSize += info.Size()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	for _, fullPath := range removedFiles {
+		if err := os.Remove(fullPath); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	return len(removedFiles), removedSize, overridden, nil
+}
+
+// baseImageFiles collects the regular files and the symlinks from the base image filesystem
+// (the filesystem is downloaded from a created, but not started, base image container)
+func (b *ImageBuilder) baseImageFiles() (map[string]*baseFile, error) {
+	container, err := b.APIClient.CreateContainer(dockerclient.CreateContainerOptions{
+		Config: &dockerclient.Config{
+			Config: docker.Config{
+				Image: b.BaseImage,
+				//the container is never started (the base images don't always have a command)
+				Entrypoint: []string{"/docker-slim-base"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("base image container error (%s): %v", b.BaseImage, err)
+	}
+
+	defer func() {
+		if err := b.APIClient.RemoveContainer(docker.RemoveContainerOptions{
+			ID:    container.ID,
+			Force: true,
+		}); err != nil {
+			log.Debugf("baseImageFiles: error removing the base image container (%v) => %v", container.ID, err)
+		}
+	}()
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(b.APIClient.DownloadFromContainer(container.ID, docker.DownloadFromContainerOptions{
+			OutputStream: writer,
+			Path:         "/.",
+		}))
+	}()
+
+	files, err := readBaseFiles(reader)
+	//drain the stream, so the download goroutine can finish
+	io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func readBaseFiles(in io.Reader) (map[string]*baseFile, error) {
+	files := map[string]*baseFile{}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		info := hdr.FileInfo()
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			hash := sha256.New()
+			var data bytes.Buffer
+			var out io.Writer = hash
+			if isOSReleasePath(name) {
+				out = io.MultiWriter(hash, &data)
+			}
+
+			if _, err := io.Copy(out, tr); err != nil {
+				return nil, err
+			}
+
+			files[name] = &baseFile{
+				mode:   info.Mode().String(),
+				size:   hdr.Size,
+				digest: hex.EncodeToString(hash.Sum(nil)),
+				data:   data.Bytes(),
+			}
+		case tar.TypeSymlink:
+			files[name] = &baseFile{
+				mode: info.Mode().String(),
+				link: hdr.Linkname,
+			}
+		}
+	}
+}
+
+func isOSReleasePath(name string) bool {
+	for _, imagePath := range osReleasePaths {
+		if name == imagePath {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fileDigest(fullPath string) (string, error) {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,153 @@
+package builder
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// SaveBuildContextManifest saves the build context manifest (the generated Dockerfile and the data directory files)
+func (b *ImageBuilder) SaveBuildContextManifest() error {
+	contextDir := b.BuildOptions.ContextDir
+	dockerfileName := b.BuildOptions.Dockerfile
+	if dockerfileName == "" {
+		dockerfileName = "Dockerfile"
+	}
+
+	dockerfileDigest, err := fileDigest(filepath.Join(contextDir, dockerfileName))
+	if err != nil {
+		return err
+	}
+
+	manifest := report.BuildContextManifest{
+		Dockerfile:       dockerfileName,
+		DockerfileDigest: "sha256:" + dockerfileDigest,
+		BaseImage:        b.BaseImage,
+		Reproducible:     b.Reproducible,
+	}
+
+	for _, dirName := range b.contextDirNames() {
+		dir := &report.BuildContextDir{Name: dirName}
+		if dirName == appDataDirName {
+			dir.Owner = b.AppDataOwner
+		}
+
+		dir.Files, err = contextFiles(filepath.Join(contextDir, dir.Name))
+		if err != nil {
+			return err
+		}
+
+		manifest.Directories = append(manifest.Directories, dir)
+	}
+
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(contextDir, report.DefaultBuildContextFileName), data, 0644)
+}
+
+// contextDirNames returns the artifact data directories the generated Dockerfile copies
+func (b *ImageBuilder) contextDirNames() []string {
+	var names []string
+	if b.HasData {
+		names = append(names, "files")
+	}
+
+	names = append(names, b.LayerDirs...)
+	if b.AppDataOwner != "" {
+		names = append(names, appDataDirName)
+	}
+
+	return names
+}
+
+// writeBuildContext writes the build context tar with the generated Dockerfile and the data directories
+// (the other artifacts are not sent to the Docker daemon; the artifact files are still saved first,
+// because the artifact passes and the build context manifest need them, so only the build context copy is avoided)
+func (b *ImageBuilder) writeBuildContext(out io.Writer) error {
+	contextDir := b.BuildOptions.ContextDir
+	dockerfileName := b.BuildOptions.Dockerfile
+	if dockerfileName == "" {
+		dockerfileName = "Dockerfile"
+	}
+
+	entries := map[string]*layerEntry{}
+	for _, name := range append([]string{dockerfileName}, b.contextDirNames()...) {
+		fullPath := filepath.Join(contextDir, name)
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			return err
+		}
+
+		entries[name] = &layerEntry{fullPath: fullPath, info: info}
+		if !info.IsDir() {
+			continue
+		}
+
+		dirEntries := map[string]*layerEntry{}
+		if err := collectLayerEntries(dirEntries, fullPath, 0, 0); err != nil {
+			return err
+		}
+
+		for entryName, entry := range dirEntries {
+			entries[name+"/"+entryName] = entry
+		}
+	}
+
+	//the file timestamps are kept (the Docker builder uses them for the COPY instruction cache)
+	return writeLayer(out, entries, time.Time{}, b.newBuildProgress(entries))
+}
+
+func contextFiles(dir string) ([]*report.BuildContextFile, error) {
+	files := []*report.BuildContextFile{}
+	err := filepath.Walk(dir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, dir), "/")
+		if filePath == "/" {
+			return nil
+		}
+
+		file := &report.BuildContextFile{
+			Path: filePath,
+			Mode: info.Mode().String(),
+		}
+
+		switch {
+		case info.IsDir():
+			file.Type = report.ContextFileDir
+		case info.Mode().IsRegular():
+			file.Type = report.ContextFileRegular
+			file.Size = info.Size()
+			digest, err := fileDigest(fullPath)
+			if err != nil {
+				return err
+			}
+
+			file.Digest = "sha256:" + digest
+		case info.Mode()&os.ModeSymlink != 0:
+			file.Type = report.ContextFileSymlink
+			file.Link, err = os.Readlink(fullPath)
+			if err != nil {
+				return err
+			}
+		default:
+			file.Type = report.ContextFileOther
+		}
+
+		files = append(files, file)
+		return nil
+	})
+
+	return files, err
+}
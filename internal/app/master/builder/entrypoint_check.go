@@ -0,0 +1,191 @@
+package builder
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+)
+
+//NOTES:
+//* the entrypoint check runs after the artifact passes (the split layers, the base image files, etc),
+//  so the files are looked up in all artifact data directories and the symlinks are resolved
+//  in the minified image files (not on the host)
+//* the files not in the artifacts can be in the base image (--slim-base, --shared-layer or 'reuse-base'),
+//  so they are not reported for the images built from a base image
+
+// defaultExecPath is the PATH value the container runtimes use if the image doesn't have one
+const defaultExecPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// CheckEntrypoint checks the effective ENTRYPOINT (or CMD) executable of the minified image:
+// it has to be in the minified image files, it has to be executable and its script interpreter
+// (the shebang line) or its dynamic loader (the ELF interpreter) has to be in the minified image files too.
+// It returns the problems with the missing file candidates, so the build fails instead of producing
+// an image that fails to start with 'no such file or directory'.
+func (b *ImageBuilder) CheckEntrypoint() []error {
+	command := b.Entrypoint
+	if len(command) == 0 {
+		command = b.Cmd
+	}
+
+	if len(command) == 0 || command[0] == "" {
+		return nil
+	}
+
+	exePath, errs := b.checkExecutable(command[0], "entrypoint")
+	if exePath == "" {
+		return errs
+	}
+
+	fullPath, _, _ := b.resolveDataFile(exePath)
+	interpreter, args, err := fileInterpreter(fullPath)
+	if err != nil {
+		return append(errs, fmt.Errorf("entrypoint can't be read: %s (%v)", exePath, err))
+	}
+
+	if interpreter == "" {
+		return errs
+	}
+
+	interpPath, interpErrs := b.checkExecutable(interpreter, fmt.Sprintf("entrypoint interpreter (%s)", exePath))
+	errs = append(errs, interpErrs...)
+	//'#!/usr/bin/env python3' runs the first argument from PATH
+	if interpPath != "" && path.Base(interpPath) == "env" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		_, envErrs := b.checkExecutable(args[0], fmt.Sprintf("entrypoint interpreter (%s)", exePath))
+		errs = append(errs, envErrs...)
+	}
+
+	return errs
+}
+
+// checkExecutable looks up the command in the minified image files (like the container runtime does)
+// and returns its image path (empty if it's missing or if it's not executable)
+func (b *ImageBuilder) checkExecutable(command, name string) (string, []error) {
+	candidates := b.commandCandidates(command)
+	for _, candidate := range candidates {
+		fullPath, info, found := b.resolveDataFile(candidate)
+		if !found {
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			return "", []error{fmt.Errorf("%s is not a file: %s", name, candidate)}
+		}
+
+		if info.Mode().Perm()&0111 == 0 {
+			return "", []error{fmt.Errorf("%s is not executable: %s (mode: %s)", name, candidate, info.Mode())}
+		}
+
+		//the ELF interpreter can't be a script (the kernel loads it directly)
+		if file, err := elf.Open(fullPath); err == nil {
+			interpreter := elfInterpreter(file)
+			file.Close()
+			if interpreter != "" {
+				if _, _, found := b.resolveDataFile(interpreter); !found && b.BaseImage == "" {
+					return "", []error{fmt.Errorf("%s dynamic loader is not in the minified image files: %s (executable: %s)",
+						name, interpreter, candidate)}
+				}
+			}
+		}
+
+		return candidate, nil
+	}
+
+	//the images built from a base image can get the file from the base image
+	if b.BaseImage != "" {
+		return "", nil
+	}
+
+	return "", []error{fmt.Errorf("%s is not in the minified image files: %s (missing: %s)",
+		name, command, strings.Join(candidates, ", "))}
+}
+
+// commandCandidates returns the image paths for the command: the absolute path,
+// the path relative to the working directory or the PATH directory paths
+func (b *ImageBuilder) commandCandidates(command string) []string {
+	return execCandidates(command, b.WorkingDir, b.Env)
+}
+
+// execCandidates returns the image paths for the command in the image with the working directory and the env vars
+func execCandidates(command, workDir string, env []string) []string {
+	if path.IsAbs(command) {
+		return []string{path.Clean(command)}
+	}
+
+	if strings.Contains(command, "/") {
+		if workDir == "" {
+			workDir = "/"
+		}
+
+		return []string{path.Join(workDir, command)}
+	}
+
+	execPath := defaultExecPath
+	for _, envInfo := range imageEnv(env) {
+		if strings.HasPrefix(envInfo, "PATH=") {
+			execPath = strings.TrimPrefix(envInfo, "PATH=")
+		}
+	}
+
+	var candidates []string
+	for _, dir := range splitPathList(execPath) {
+		if path.IsAbs(dir) {
+			candidates = append(candidates, path.Join(dir, command))
+		}
+	}
+
+	return candidates
+}
+
+// resolveDataFile returns the host path and the file info for the minified image file
+// (the symlinks are resolved in the minified image files from all artifact data directories)
+func (b *ImageBuilder) resolveDataFile(imagePath string) (string, os.FileInfo, bool) {
+	resolved, err := fsutil.ResolveLayeredRootPath(b.dataDirs(), imagePath)
+	if err != nil {
+		return "", nil, false
+	}
+
+	return b.dataFilePath(resolved)
+}
+
+// fileInterpreter returns the script interpreter and its arguments from the shebang line
+func fileInterpreter(fullPath string) (string, []string, error) {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	line, _ := bufio.NewReader(file).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil, nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", nil, nil
+	}
+
+	return fields[0], fields[1:], nil
+}
+
+func elfInterpreter(file *elf.File) string {
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return ""
+		}
+
+		return strings.TrimRight(string(data), "\x00")
+	}
+
+	return ""
+}
@@ -0,0 +1,141 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// File hardening change types
+const (
+	FileChangeMode  = "mode"
+	FileChangeOwner = "owner"
+)
+
+// the minified image data directory for the application files
+// (they are copied with the image user as the owner)
+const appDataDirName = "files-app"
+
+func isRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
+
+func isUnderDir(filePath, dir string) bool {
+	return dir != "" && dir != "/" && (filePath == dir || strings.HasPrefix(filePath, strings.TrimSuffix(dir, "/")+"/"))
+}
+
+// HardenFiles removes the group and world writable bits from the minified image files
+// (except the sticky directories like '/tmp'), strips the setuid and setgid bits
+// from the files the container didn't execute and makes the image user (if it's not root)
+// the owner of the application files (the files in the working directory and the files the container wrote).
+// It returns all changes.
+func (b *ImageBuilder) HardenFiles(artifactLocation string) ([]*report.FileChange, error) {
+	if !b.HasData {
+		return nil, nil
+	}
+
+	dataDir := filepath.Join(artifactLocation, "files")
+	executed := map[string]bool{}
+	written := map[string]bool{}
+	reportData, err := ioutil.ReadFile(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var creport report.ContainerReport
+	if err := json.Unmarshal(reportData, &creport); err != nil {
+		return nil, err
+	}
+
+	for _, props := range creport.Image.Files {
+		if props == nil {
+			continue
+		}
+
+		executed[props.FilePath] = props.Flags["X"]
+		written[props.FilePath] = props.Flags["W"]
+	}
+
+	var changes []*report.FileChange
+	var appFiles []string
+	err = filepath.Walk(dataDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, dataDir), "/")
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		mode := info.Mode()
+		newMode := mode
+		if mode&os.ModeSticky == 0 {
+			newMode &^= 0022
+		}
+
+		if !info.IsDir() && !executed[filePath] {
+			newMode &^= os.ModeSetuid | os.ModeSetgid
+		}
+
+		if newMode != mode {
+			if err := os.Chmod(fullPath, newMode); err != nil {
+				log.Warnf("HardenFiles: chmod(%v) error - %v", filePath, err)
+				return nil
+			}
+
+			changes = append(changes, &report.FileChange{
+				FilePath: filePath,
+				Change:   FileChangeMode,
+				Before:   mode.String(),
+				After:    newMode.String(),
+			})
+		}
+
+		if !info.IsDir() && (isUnderDir(filePath, b.WorkingDir) || written[filePath]) {
+			appFiles = append(appFiles, filePath)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return changes, err
+	}
+
+	if isRootUser(b.User) || len(appFiles) == 0 {
+		return changes, nil
+	}
+
+	//the application files are moved to a separate data directory,
+	//so they can be copied to the image with a different owner
+	appDataDir := filepath.Join(artifactLocation, appDataDirName)
+	for _, filePath := range appFiles {
+		dst := filepath.Join(appDataDir, filePath)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return changes, err
+		}
+
+		if err := os.Rename(filepath.Join(dataDir, filePath), dst); err != nil {
+			return changes, err
+		}
+
+		changes = append(changes, &report.FileChange{
+			FilePath: filePath,
+			Change:   FileChangeOwner,
+			Before:   "root",
+			After:    b.User,
+		})
+	}
+
+	b.AppDataOwner = b.User
+	log.Debugf("HardenFiles: %v changes (%v application files)", len(changes), len(appFiles))
+	return changes, nil
+}
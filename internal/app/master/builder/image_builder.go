@@ -3,10 +3,13 @@ package builder
 import (
 	"bytes"
 	"errors"
+	"io"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
 	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
 
@@ -22,7 +25,7 @@ var (
 type BasicImageBuilder struct {
 	ShowBuildLogs bool
 	BuildOptions  docker.BuildImageOptions
-	APIClient     *docker.Client
+	APIClient     dockerclient.API
 	BuildLog      bytes.Buffer
 }
 
@@ -39,11 +42,54 @@ type ImageBuilder struct {
 	Volumes      map[string]struct{}
 	OnBuild      []string
 	User         string
+	Labels       map[string]string
 	HasData      bool
+	//AppDataOwner is the owner of the application files (in the separate data directory)
+	AppDataOwner string
+	//Reproducible builds the image archive directly (instead of using the Dockerfile),
+	//so the same artifacts always produce the same image
+	Reproducible bool
+	Architecture string
+	//the source image platform properties (the OS version and the CPU variant, e.g., 'v7' or 'v8')
+	OS        string
+	OSVersion string
+	Variant   string
+	//SourceCreated is the creation time of the source image
+	//(the pinned image creation time if SOURCE_DATE_EPOCH is not set)
+	SourceCreated time.Time
+	//LayerDirs are the separate layer data directories in the layer order (see SplitLayers)
+	LayerDirs []string
+	//BaseImage is the base image for the minified image (it's built 'FROM scratch' if it's not set)
+	BaseImage  string
+	StopSignal string
+	Shell      []string
+	//SharedLayer is the shared layer the minified image is built on (see UseSharedLayer)
+	SharedLayer     *SharedLayerManifest
+	SharedLayerPath string
+	//OCILayoutPath is the OCI image layout directory the minified image is assembled in
+	//(without the Docker daemon, see buildOCILayout) and LayerAccess has its layer format and annotations
+	OCILayoutPath string
+	LayerAccess   *config.RegistryAccess
+	//LayoutImage is the image info for the assembled OCI layout image (the daemon doesn't have the image)
+	LayoutImage          *dockerclient.Image
+	LayoutManifestDigest string
+	//Author and Comment are the image config metadata and Created is the custom image creation time
+	//(the build time is used if it's not set, see updateImageMetadata)
+	Author  string
+	Comment string
+	Created time.Time
+	//Progress reports the minified image files written to the image build
+	//(the file and byte counts with the totals)
+	Progress func(files, totalFiles, bytes, totalBytes int64)
 }
 
+// OCILabelPrefix is the prefix of the OCI image labels (the pre-defined OCI annotation keys)
+const OCILabelPrefix = "org.opencontainers.image."
+
+const ociBaseLabelPrefix = OCILabelPrefix + "base."
+
 // NewImageBuilder creates a new BasicImageBuilder instances
-func NewBasicImageBuilder(client *docker.Client,
+func NewBasicImageBuilder(client dockerclient.API,
 	imageRepoNameTag string,
 	dockerfileName string,
 	buildContext string,
@@ -83,9 +129,9 @@ func (b *BasicImageBuilder) Remove() error {
 }
 
 // NewImageBuilder creates a new ImageBuilder instances
-func NewImageBuilder(client *docker.Client,
+func NewImageBuilder(client dockerclient.API,
 	imageRepoNameTag string,
-	imageInfo *docker.Image,
+	imageInfo *dockerclient.Image,
 	artifactLocation string,
 	showBuildLogs bool,
 	overrideSelectors map[string]bool,
@@ -113,8 +159,31 @@ func NewImageBuilder(client *docker.Client,
 		Volumes:      imageInfo.Config.Volumes,
 		OnBuild:      imageInfo.Config.OnBuild,
 		User:         imageInfo.Config.User,
+		Author:       DefaultImageAuthor(),
 	}
 
+	//the source image properties for the reproducible image archive
+	builder.Architecture = imageInfo.Architecture
+	builder.SourceCreated = imageInfo.Created
+	builder.OS = imageInfo.OS
+	builder.OSVersion = imageInfo.OSVersion
+	builder.Variant = imageInfo.Variant
+
+	//the OCI image labels (the source, revision, licenses, etc) are the image provenance metadata
+	//(the base image labels are not kept, because the minified image is not built from the same base image)
+	for k, v := range imageInfo.Config.Labels {
+		if strings.HasPrefix(k, OCILabelPrefix) && !strings.HasPrefix(k, ociBaseLabelPrefix) {
+			if builder.Labels == nil {
+				builder.Labels = map[string]string{}
+			}
+
+			builder.Labels[k] = v
+		}
+	}
+
+	builder.StopSignal = imageInfo.Config.StopSignal
+	builder.Shell = imageInfo.Config.Shell
+
 	if overrides != nil && len(overrideSelectors) > 0 {
 		log.Debugf("NewImageBuilder: Using container runtime overrides => %+v", overrideSelectors)
 		for k := range overrideSelectors {
@@ -154,6 +223,16 @@ func NewImageBuilder(client *docker.Client,
 		}
 	}
 
+	//the minified image runs as the user the application ran as during monitoring
+	if overrides != nil && overrides.User != "" {
+		builder.User = overrides.User
+	}
+
+	//the source image ONBUILD triggers usually need the build tools the minified image doesn't have
+	if instructions == nil || !instructions.KeepOnBuild {
+		builder.OnBuild = nil
+	}
+
 	//instructions have higher value precedence over the runtime overrides
 	if instructions != nil {
 		log.Debugf("NewImageBuilder: Using new image instructions => %+v", instructions)
@@ -162,6 +241,10 @@ func NewImageBuilder(client *docker.Client,
 			builder.WorkingDir = instructions.Workdir
 		}
 
+		if instructions.User != "" {
+			builder.User = instructions.User
+		}
+
 		if len(instructions.Env) > 0 {
 			builder.Env = append(builder.Env, instructions.Env...)
 		}
@@ -181,6 +264,35 @@ func NewImageBuilder(client *docker.Client,
 		if len(instructions.Cmd) > 0 {
 			builder.Cmd = instructions.Cmd
 		}
+
+		if instructions.StopSignal != "" {
+			builder.StopSignal = instructions.StopSignal
+		}
+
+		if len(instructions.Shell) > 0 {
+			builder.Shell = instructions.Shell
+		}
+
+		if len(instructions.OnBuild) > 0 {
+			builder.OnBuild = instructions.OnBuild
+		}
+
+		if len(instructions.Labels) > 0 {
+			if builder.Labels == nil {
+				builder.Labels = map[string]string{}
+			}
+
+			for k, v := range instructions.Labels {
+				builder.Labels[k] = v
+			}
+		}
+
+		if instructions.Author != "" {
+			builder.Author = instructions.Author
+		}
+
+		builder.Comment = instructions.Comment
+		builder.Created = instructions.Created
 	}
 
 	builder.BuildOptions.OutputStream = &builder.BuildLog
@@ -193,22 +305,65 @@ func NewImageBuilder(client *docker.Client,
 
 // Build creates a new container image
 func (b *ImageBuilder) Build() error {
+	//the Dockerfile is still generated in the reproducible and OCI layout modes (as a reference)
 	if err := b.GenerateDockerfile(); err != nil {
 		return err
 	}
 
-	return b.APIClient.BuildImage(b.BuildOptions)
+	if err := b.SaveBuildContextManifest(); err != nil {
+		return err
+	}
+
+	if b.OCILayoutPath != "" {
+		return b.buildOCILayout()
+	}
+
+	if b.Reproducible {
+		return b.buildReproducible()
+	}
+
+	//the build context is streamed from the artifact directory
+	//(only the Dockerfile and the data directories it copies)
+	//and the stream is recreated if the build is retried
+	err := dockerclient.Retry(b.APIClient, "BuildImage", func() error {
+		b.BuildLog.Reset()
+		contextReader, contextWriter := io.Pipe()
+		go func() {
+			contextWriter.CloseWithError(b.writeBuildContext(contextWriter))
+		}()
+
+		buildOptions := b.BuildOptions
+		buildOptions.ContextDir = ""
+		buildOptions.InputStream = contextReader
+		err := b.APIClient.BuildImage(buildOptions)
+		contextReader.Close()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return b.updateImageMetadata()
 }
 
 // GenerateDockerfile creates a Dockerfile file
 func (b *ImageBuilder) GenerateDockerfile() error {
 	return dockerfile.GenerateFromInfo(b.BuildOptions.ContextDir,
+		b.BaseImage,
+		b.Author,
 		b.Volumes,
 		b.WorkingDir,
 		b.Env,
 		b.User,
+		b.Labels,
 		b.ExposedPorts,
 		b.Entrypoint,
 		b.Cmd,
-		b.HasData)
+		b.StopSignal,
+		b.Shell,
+		b.OnBuild,
+		b.HasData,
+		b.LayerDirs,
+		b.AppDataOwner)
 }
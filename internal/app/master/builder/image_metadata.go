@@ -0,0 +1,130 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the Docker builder sets the image author (the MAINTAINER instruction), but it doesn't set the image comment
+//  and it always uses the build time as the image creation time, so the built image gets the custom comment
+//  and creation time in an updated image config (the image is exported and loaded again with the same layers)
+//* the Docker builder sets the daemon platform for the images built from scratch (the build API doesn't
+//  select the platform in the API version docker-slim uses), so the minified images of the images
+//  for the other platforms (e.g., the arm64 images minified on an amd64 host) get the source image platform
+//  in the updated image config too (the images built from a base image have the base image platform)
+//* the reproducible and the OCI layout images have the metadata in the image config they create
+
+// DefaultImageAuthor returns the default minified image author (the docker-slim version)
+func DefaultImageAuthor() string {
+	return fmt.Sprintf("docker-slim %s", v.Tag())
+}
+
+// updateImageMetadata sets the custom comment, creation time and the source image platform in the built image config
+func (b *ImageBuilder) updateImageMetadata() error {
+	setPlatform, err := b.platformMismatch()
+	if err != nil {
+		return err
+	}
+
+	if b.Comment == "" && b.Created.IsZero() && !setPlatform {
+		return nil
+	}
+
+	imageID, err := registry.UpdateImageConfig(b.APIClient, b.RepoName, func(imageConfig map[string]json.RawMessage) error {
+		if b.Comment != "" {
+			data, err := json.Marshal(b.Comment)
+			if err != nil {
+				return err
+			}
+
+			imageConfig["comment"] = data
+		}
+
+		if !b.Created.IsZero() {
+			data, err := json.Marshal(b.Created.UTC())
+			if err != nil {
+				return err
+			}
+
+			imageConfig["created"] = data
+		}
+
+		if setPlatform {
+			for key, value := range map[string]string{
+				"architecture": b.Architecture,
+				"os":           b.OS,
+				"variant":      b.Variant,
+				"os.version":   b.OSVersion,
+			} {
+				if value == "" {
+					delete(imageConfig, key)
+					continue
+				}
+
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+
+				imageConfig[key] = data
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("image metadata update failed: %v", err)
+	}
+
+	fmt.Fprintf(&b.BuildLog, "Updated image %s metadata (ID: %s, comment: '%s', created: %s, platform: %s)\n",
+		b.RepoName, imageID, b.Comment, b.Created.UTC().Format(time.RFC3339),
+		platformName(b.OS, b.Architecture, b.Variant))
+	return nil
+}
+
+// platformMismatch returns true if the image built from scratch doesn't have the source image platform
+// (the platform of the images built from a base image is not changed)
+func (b *ImageBuilder) platformMismatch() (bool, error) {
+	if b.Architecture == "" || b.OS == "" {
+		return false, nil
+	}
+
+	imageInfo, err := b.APIClient.InspectImage(b.RepoName)
+	if err != nil {
+		return false, err
+	}
+
+	//the daemons can set the variant and the OS version the source image doesn't have (e.g., 'v8' for arm64)
+	if imageInfo.Architecture == b.Architecture &&
+		imageInfo.OS == b.OS &&
+		(b.Variant == "" || imageInfo.Variant == b.Variant) &&
+		(b.OSVersion == "" || imageInfo.OSVersion == b.OSVersion) {
+		return false, nil
+	}
+
+	if b.BaseImage != "" {
+		log.Warnf("the minified image has the base image platform (%s), not the source image platform (%s) - use a base image for the source image platform",
+			platformName(imageInfo.OS, imageInfo.Architecture, imageInfo.Variant),
+			platformName(b.OS, b.Architecture, b.Variant))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// platformName returns the platform in the 'os/arch[/variant]' format
+func platformName(os, arch, variant string) string {
+	name := os + "/" + arch
+	if variant != "" {
+		name += "/" + variant
+	}
+
+	return name
+}
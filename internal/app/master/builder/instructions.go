@@ -0,0 +1,103 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+// valid exposed port protocols (like in Docker)
+var exposedPortProtocols = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"sctp": true,
+}
+
+// ValidateInstructions checks the minified image instructions against the kept artifact files
+// (the new working directory has to be a minified image directory, the new exposed ports have to be valid
+// and the volumes can't be the kept files), so the invalid values fail the build
+// instead of producing an image that fails at runtime
+func (b *ImageBuilder) ValidateInstructions(instructions *config.ImageNewInstructions) []error {
+	var errs []error
+	if instructions != nil && instructions.Workdir != "" {
+		workdir := instructions.Workdir
+		switch info, found := b.dataFileInfo(workdir); {
+		case !path.IsAbs(workdir):
+			errs = append(errs, fmt.Errorf("new workdir is not an absolute path: %s", workdir))
+		case found && !info.IsDir() && info.Mode()&os.ModeSymlink == 0:
+			errs = append(errs, fmt.Errorf("new workdir is a file in the minified image: %s", workdir))
+		case !found && b.BaseImage == "" && b.HasData:
+			//the images built from a base image can get the directory from the base image
+			//(and the images without the data files get it from the WORKDIR instruction)
+			errs = append(errs, fmt.Errorf("new workdir is not in the minified image files: %s", workdir))
+		}
+	}
+
+	if instructions != nil {
+		for port := range instructions.ExposedPorts {
+			if number, err := strconv.Atoi(port.Port()); err != nil || number < 1 || number > 65535 {
+				errs = append(errs, fmt.Errorf("new exposed port is out of range (1-65535): %s", port))
+			}
+
+			if !exposedPortProtocols[port.Proto()] {
+				errs = append(errs, fmt.Errorf("new exposed port has an unknown protocol (tcp, udp or sctp): %s", port))
+			}
+		}
+	}
+
+	for volume := range b.Volumes {
+		if !path.IsAbs(volume) {
+			errs = append(errs, fmt.Errorf("volume is not an absolute path: %s", volume))
+			continue
+		}
+
+		if info, found := b.dataFileInfo(volume); found && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+			errs = append(errs, fmt.Errorf("volume is a file in the minified image: %s", volume))
+		}
+	}
+
+	return errs
+}
+
+// dataFileInfo returns the file info for the minified image file from the artifact data directories
+// (the symlinks are not followed, because their targets are in the minified image, not on the host)
+func (b *ImageBuilder) dataFileInfo(filePath string) (os.FileInfo, bool) {
+	_, info, found := b.dataFilePath(filePath)
+	return info, found
+}
+
+// dataFilePath returns the host path and the file info for the minified image file
+// from the artifact data directories (the symlinks are not followed)
+func (b *ImageBuilder) dataFilePath(filePath string) (string, os.FileInfo, bool) {
+	dirs := b.dataDirs()
+
+	//the upper layer files override the lower layer files
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		fullPath := filepath.Join(dirs[idx], filepath.FromSlash(path.Clean(filePath)))
+		if info, err := os.Lstat(fullPath); err == nil {
+			return fullPath, info, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// dataDirs returns the host paths of the artifact data directories (from the lowest layer to the upper one)
+func (b *ImageBuilder) dataDirs() []string {
+	names := []string{"files"}
+	names = append(names, b.LayerDirs...)
+	if b.AppDataOwner != "" {
+		names = append(names, appDataDirName)
+	}
+
+	var dirs []string
+	for _, name := range names {
+		dirs = append(dirs, filepath.Join(b.BuildOptions.ContextDir, name))
+	}
+
+	return dirs
+}
@@ -0,0 +1,246 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the 'split' layer strategy moves the minified image files to the separate layer data directories
+//  ('files.<layer>'), so each layer is copied to the image with its own COPY instruction
+//  (or written as a separate layer tar in the reproducible mode)
+//* the layers are ordered from the least to the most frequently changed files (OS, runtime, app),
+//  so the unchanged lower layers are shared by the rebuilt images (and stored only once in the registries)
+
+// Minified image layer names
+const (
+	LayerBase    = "base"
+	LayerRuntime = "runtime"
+	LayerApp     = "app"
+)
+
+const layerDirPrefix = "files."
+
+var layerNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// defaultRuntimePatterns identify the language runtime files
+// (a pattern matches a file if it matches the file path or one of its parent directories)
+var defaultRuntimePatterns = []string{
+	//Python
+	"/usr/lib/python*",
+	"/usr/local/lib/python*",
+	"/usr/lib/*/libpython*",
+	"/usr/local/lib/libpython*",
+	"/usr/bin/python*",
+	"/usr/local/bin/python*",
+	//Node.js
+	"/usr/bin/node",
+	"/usr/local/bin/node",
+	"/usr/lib/node_modules",
+	"/usr/local/lib/node_modules",
+	"/usr/local/include/node",
+	//Java
+	"/usr/lib/jvm",
+	"/opt/java",
+	"/opt/openjdk*",
+	"/usr/local/openjdk*",
+	//Ruby
+	"/usr/lib/ruby",
+	"/usr/local/lib/ruby",
+	"/usr/lib/*/libruby*",
+	"/usr/local/lib/libruby*",
+	"/usr/bin/ruby*",
+	"/usr/local/bin/ruby",
+	"/usr/local/bundle",
+	//Go
+	"/usr/local/go",
+	"/usr/lib/go*",
+	//PHP
+	"/usr/lib/php*",
+	"/usr/local/lib/php",
+	"/usr/bin/php*",
+	"/usr/local/bin/php",
+	//.NET
+	"/usr/share/dotnet",
+	"/usr/lib/dotnet",
+}
+
+// IsValidLayerName returns true if the layer name can be used for the layer data directory
+func IsValidLayerName(name string) bool {
+	return layerNameRegexp.MatchString(name)
+}
+
+// IsValidLayerPattern returns true if the layer rule pattern is an absolute path pattern
+func IsValidLayerPattern(pattern string) bool {
+	if !strings.HasPrefix(pattern, "/") {
+		return false
+	}
+
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// matchLayerPattern returns true if the pattern matches the file path or one of its parent directories
+func matchLayerPattern(pattern, filePath string) bool {
+	for p := filePath; p != "/" && p != "."; p = path.Dir(p) {
+		if matched, _ := path.Match(pattern, p); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// layerFor returns the layer for the minified image file
+// (the custom rules are matched first, then the application files and then the runtime files)
+func (b *ImageBuilder) layerFor(filePath string, rules []config.LayerRule) string {
+	for _, rule := range rules {
+		if matchLayerPattern(rule.Pattern, filePath) {
+			return rule.Layer
+		}
+	}
+
+	if isUnderDir(filePath, b.WorkingDir) {
+		return LayerApp
+	}
+
+	for _, pattern := range defaultRuntimePatterns {
+		if matchLayerPattern(pattern, filePath) {
+			return LayerRuntime
+		}
+	}
+
+	return LayerBase
+}
+
+// layerOrder returns the layers above the base layer: the runtime layer,
+// the custom layers (in the rule order) and the application layer
+func layerOrder(rules []config.LayerRule) []string {
+	layers := []string{LayerRuntime}
+	known := map[string]bool{LayerBase: true, LayerRuntime: true, LayerApp: true}
+	for _, rule := range rules {
+		if !known[rule.Layer] {
+			known[rule.Layer] = true
+			layers = append(layers, rule.Layer)
+		}
+	}
+
+	return append(layers, LayerApp)
+}
+
+// SplitLayers moves the minified image files to the separate layer data directories
+// based on the layer rules (the files that don't match any rule stay in the base OS layer)
+// and returns the image layers. The application files owned by the image user
+// (see HardenFiles) are always copied in the last layer.
+func (b *ImageBuilder) SplitLayers(artifactLocation string, strategy *config.LayerStrategy) ([]*report.ImageLayer, error) {
+	if !b.HasData || strategy == nil ||
+		(strategy.Mode != config.LayerStrategySplit && strategy.Mode != config.LayerStrategyReuseBase) {
+		return nil, nil
+	}
+
+	dataDir := filepath.Join(artifactLocation, "files")
+	layerFiles := map[string][]string{}
+	layerInfo := map[string]*report.ImageLayer{
+		LayerBase: {Name: LayerBase},
+	}
+
+	err := filepath.Walk(dataDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, dataDir), "/")
+		layer := b.layerFor(filePath, strategy.Rules)
+		if layerInfo[layer] == nil {
+			layerInfo[layer] = &report.ImageLayer{Name: layer}
+		}
+
+		layerInfo[layer].Files++
+		if info.Mode().IsRegular() {
+			layerInfo[layer].Size += info.Size()
+		}
+
+		if layer != LayerBase {
+			layerFiles[layer] = append(layerFiles[layer], filePath)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	layers := []*report.ImageLayer{layerInfo[LayerBase]}
+	for _, layer := range layerOrder(strategy.Rules) {
+		if len(layerFiles[layer]) == 0 {
+			continue
+		}
+
+		dirName := layerDirPrefix + layer
+		layerDir := filepath.Join(artifactLocation, dirName)
+		for _, filePath := range layerFiles[layer] {
+			if err := moveLayerFile(dataDir, layerDir, filePath); err != nil {
+				return nil, err
+			}
+		}
+
+		b.LayerDirs = append(b.LayerDirs, dirName)
+		layers = append(layers, layerInfo[layer])
+	}
+
+	log.Debugf("SplitLayers: %v image layers (%v)", len(layers), b.LayerDirs)
+	return layers, nil
+}
+
+// moveLayerFile moves the file to the layer data directory
+// (the created parent directories have the same modes as the original directories,
+// because the directories in the upper layers replace the lower layer directories)
+func moveLayerFile(dataDir, layerDir, filePath string) error {
+	parts := strings.Split(strings.Trim(path.Dir(filePath), "/"), "/")
+	srcDir := dataDir
+	dstDir := layerDir
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		srcDir = filepath.Join(srcDir, part)
+		dstDir = filepath.Join(dstDir, part)
+		if _, err := os.Lstat(dstDir); err == nil {
+			continue
+		}
+
+		info, err := os.Stat(srcDir)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Mkdir(dstDir, 0755); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(dstDir, info.Mode()&(os.ModePerm|os.ModeSticky|os.ModeSetgid|os.ModeSetuid)); err != nil {
+			return fmt.Errorf("layer directory mode error (%s): %v", filePath, err)
+		}
+	}
+
+	return os.Rename(filepath.Join(dataDir, filepath.FromSlash(filePath)), filepath.Join(dstDir, path.Base(filePath)))
+}
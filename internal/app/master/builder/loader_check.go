@@ -0,0 +1,761 @@
+package builder
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the loader check parses the ELF files (the interpreter, the needed libraries and the library search paths),
+//  so it works for the images built for the other architectures (the host 'ldd' is not used)
+//* the paths are resolved in the minified image filesystem (the symlinks are resolved like in a chroot),
+//  so the merged '/usr' images ('/lib' => 'usr/lib') are supported
+//* the libraries are searched like the dynamic loaders search them: RPATH, LD_LIBRARY_PATH, RUNPATH,
+//  the loader configuration ('/etc/ld.so.conf' or '/etc/ld-musl-<arch>.path') and the default directories
+//  (the libraries loaded with dlopen() are not checked)
+//* the loader configuration files are read from the source image: the loader reads only its cache
+//  at runtime, so the minified image usually doesn't have them
+
+// the default library directories (the multiarch directories are added for the ELF machine)
+var (
+	glibcLibDirs   = []string{"/lib", "/usr/lib"}
+	glibcLib64Dirs = []string{"/lib64", "/usr/lib64"}
+	muslLibDirs    = []string{"/lib", "/usr/local/lib", "/usr/lib"}
+)
+
+// multiarchTriplets are the Debian multiarch directory names for the ELF machines
+var multiarchTriplets = map[elf.Machine][]string{
+	elf.EM_X86_64:  {"x86_64-linux-gnu"},
+	elf.EM_386:     {"i386-linux-gnu"},
+	elf.EM_AARCH64: {"aarch64-linux-gnu"},
+	elf.EM_ARM:     {"arm-linux-gnueabihf", "arm-linux-gnueabi"},
+	elf.EM_PPC64:   {"powerpc64le-linux-gnu"},
+	elf.EM_S390:    {"s390x-linux-gnu"},
+	elf.EM_MIPS:    {"mips64el-linux-gnuabi64", "mipsel-linux-gnu"},
+	elf.EM_RISCV:   {"riscv64-linux-gnu"},
+}
+
+// elfObject is a kept ELF file with its dynamic loader information
+type elfObject struct {
+	class       elf.Class
+	machine     elf.Machine
+	interpreter string
+	needed      []string
+	rpath       []string
+	runpath     []string
+}
+
+// loaderCheck resolves the executable dependencies in the minified image files
+type loaderCheck struct {
+	root        string
+	libraryPath []string
+	objects     map[string]*elfObject
+	//config has the source image loader configuration files (nil if they are in the root directory)
+	config         *loaderConfig
+	configDirCache map[string][]string
+}
+
+// loaderConfig downloads the loader configuration files from the source image when they are read
+type loaderConfig struct {
+	source  *sourceFiles
+	root    string
+	fetched map[string]bool
+}
+
+// CheckLoaders checks that the kept ELF executables have their dynamic loader (the ELF interpreter)
+// and all shared libraries they need (the whole dependency closure) in the minified image files
+// and returns the executables with the missing files. With doInclude the missing files
+// are copied from the source image (the files the source image doesn't have are still reported).
+// It checks the artifact files before they are split into layers.
+func (b *ImageBuilder) CheckLoaders(artifactLocation string, doInclude bool) ([]*report.LoaderIssue, error) {
+	if !b.HasData {
+		return nil, nil
+	}
+
+	root := filepath.Join(artifactLocation, "files")
+	var libraryPath []string
+	for _, envInfo := range imageEnv(b.Env) {
+		if strings.HasPrefix(envInfo, "LD_LIBRARY_PATH=") {
+			libraryPath = splitPathList(strings.TrimPrefix(envInfo, "LD_LIBRARY_PATH="))
+		}
+	}
+
+	included := map[string][]string{}
+	var source *sourceFiles
+	defer func() {
+		if source != nil {
+			source.close()
+		}
+	}()
+
+	//without the source image the loader configuration is read from the minified image files
+	var config *loaderConfig
+	if configRoot, err := ioutil.TempDir("", "docker-slim-loader-config"); err == nil {
+		defer os.RemoveAll(configRoot)
+		if source, err = b.newSourceFiles(b.ID); err == nil {
+			config = &loaderConfig{
+				source:  source,
+				root:    configRoot,
+				fetched: map[string]bool{},
+			}
+		} else {
+			log.Debugf("CheckLoaders: the loader configuration is not read from the source image => %v", err)
+		}
+	}
+
+	for {
+		check := &loaderCheck{
+			root:           root,
+			libraryPath:    libraryPath,
+			objects:        map[string]*elfObject{},
+			config:         config,
+			configDirCache: map[string][]string{},
+		}
+
+		issues, err := check.run()
+		if err != nil {
+			return nil, err
+		}
+
+		if !doInclude || len(issues) == 0 {
+			return loaderIssues(issues, included), nil
+		}
+
+		if source == nil {
+			if source, err = b.newSourceFiles(b.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		//the included files can need more files, so the executables are checked again
+		//until the source image has no more missing files
+		var includedCount int
+		for _, issue := range issues {
+			var missing []string
+			if issue.Interpreter != "" {
+				missing = append(missing, issue.Interpreter)
+			}
+
+			for _, name := range issue.Libraries {
+				missing = append(missing, check.candidatePaths(issue.FilePath, name)...)
+			}
+
+			for _, imagePath := range missing {
+				added, err := source.include(root, imagePath)
+				if err != nil {
+					log.Debugf("CheckLoaders: %v - %v not included => %v", issue.FilePath, imagePath, err)
+					continue
+				}
+
+				if len(added) > 0 {
+					included[issue.FilePath] = append(included[issue.FilePath], added...)
+					includedCount += len(added)
+					if issue.Interpreter != imagePath {
+						//the first library candidate the source image has is the library the loader finds
+						break
+					}
+				}
+			}
+		}
+
+		if includedCount == 0 {
+			return loaderIssues(issues, included), nil
+		}
+	}
+}
+
+// loaderIssues merges the remaining issues with the included files
+func loaderIssues(issues []*report.LoaderIssue, included map[string][]string) []*report.LoaderIssue {
+	byPath := map[string]*report.LoaderIssue{}
+	for _, issue := range issues {
+		byPath[issue.FilePath] = issue
+	}
+
+	for filePath, files := range included {
+		issue, found := byPath[filePath]
+		if !found {
+			issue = &report.LoaderIssue{FilePath: filePath}
+			byPath[filePath] = issue
+		}
+
+		issue.Included = files
+	}
+
+	var paths []string
+	for filePath := range byPath {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	var out []*report.LoaderIssue
+	for _, filePath := range paths {
+		out = append(out, byPath[filePath])
+	}
+
+	return out
+}
+
+// run checks all dynamically linked executables in the minified image files
+func (c *loaderCheck) run() ([]*report.LoaderIssue, error) {
+	var executables []string
+	err := filepath.Walk(c.root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || info.Size() < 4 {
+			return nil
+		}
+
+		imagePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, c.root), "/")
+		if obj := c.object(imagePath, fullPath); obj != nil && obj.interpreter != "" {
+			executables = append(executables, imagePath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*report.LoaderIssue
+	for _, exePath := range executables {
+		if issue := c.checkExecutable(exePath); issue != nil {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues, nil
+}
+
+// checkExecutable returns the missing interpreter and libraries for the executable (nil if it has all files)
+func (c *loaderCheck) checkExecutable(exePath string) *report.LoaderIssue {
+	exe := c.objects[exePath]
+	issue := &report.LoaderIssue{FilePath: exePath}
+	if _, found := c.resolve(exe.interpreter); !found {
+		issue.Interpreter = exe.interpreter
+	}
+
+	_, issue.Libraries = c.closure(exePath)
+	if issue.Interpreter == "" && len(issue.Libraries) == 0 {
+		return nil
+	}
+
+	return issue
+}
+
+// closure returns the image paths of the shared libraries the ELF object loads (the whole dependency closure;
+// the paths are the paths the loader finds the libraries by, not the resolved symlink targets)
+// and the names of the missing libraries
+func (c *loaderCheck) closure(exePath string) ([]string, []string) {
+	exe := c.objects[exePath]
+	var libPaths []string
+	found := map[string]bool{}
+	missing := map[string]bool{}
+	visited := map[string]bool{exePath: true}
+	queue := []string{exePath}
+	for len(queue) > 0 {
+		objPath := queue[0]
+		queue = queue[1:]
+		obj := c.objects[objPath]
+		for _, name := range obj.needed {
+			libPath, resolved, ok := c.findLibrary(exe, objPath, obj, name)
+			if !ok {
+				missing[name] = true
+				continue
+			}
+
+			if !found[libPath] {
+				found[libPath] = true
+				libPaths = append(libPaths, libPath)
+			}
+
+			if !visited[resolved] {
+				visited[resolved] = true
+				queue = append(queue, resolved)
+			}
+		}
+	}
+
+	var names []string
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return libPaths, names
+}
+
+// findLibrary returns the image path of the library the object needs and its resolved image path
+// (the libraries for a different ELF class or machine are skipped like the loaders skip them)
+func (c *loaderCheck) findLibrary(exe *elfObject, objPath string, obj *elfObject, name string) (string, string, bool) {
+	if strings.Contains(name, "/") {
+		resolved, found := c.loadObject(name, obj)
+		return name, resolved, found
+	}
+
+	for _, dir := range c.searchDirs(exe, objPath, obj) {
+		libPath := path.Join(dir, name)
+		if resolved, found := c.loadObject(libPath, obj); found {
+			return libPath, resolved, true
+		}
+	}
+
+	return "", "", false
+}
+
+// candidatePaths returns the image paths the library can have (in the search order)
+func (c *loaderCheck) candidatePaths(exePath, name string) []string {
+	exe := c.objects[exePath]
+	if strings.Contains(name, "/") {
+		return []string{name}
+	}
+
+	var paths []string
+	for _, dir := range c.searchDirs(exe, exePath, exe) {
+		paths = append(paths, path.Join(dir, name))
+	}
+
+	return paths
+}
+
+// searchDirs returns the library search directories for the object (in the loader search order)
+func (c *loaderCheck) searchDirs(exe *elfObject, objPath string, obj *elfObject) []string {
+	var dirs []string
+	origin := path.Dir(objPath)
+	if len(obj.runpath) == 0 {
+		dirs = append(dirs, expandOrigin(obj.rpath, origin)...)
+		if obj != exe && len(exe.runpath) == 0 {
+			dirs = append(dirs, exe.rpath...)
+		}
+	}
+
+	dirs = append(dirs, c.libraryPath...)
+	dirs = append(dirs, expandOrigin(obj.runpath, origin)...)
+
+	isMusl := strings.HasPrefix(path.Base(exe.interpreter), "ld-musl-")
+	dirs = append(dirs, c.configDirs(exe, isMusl)...)
+	if isMusl {
+		return append(dirs, muslLibDirs...)
+	}
+
+	for _, triplet := range multiarchTriplets[exe.machine] {
+		dirs = append(dirs, "/lib/"+triplet, "/usr/lib/"+triplet)
+	}
+
+	if exe.class == elf.ELFCLASS64 {
+		dirs = append(dirs, glibcLib64Dirs...)
+	}
+
+	return append(dirs, glibcLibDirs...)
+}
+
+// configDirs returns the library directories from the loader configuration
+func (c *loaderCheck) configDirs(exe *elfObject, isMusl bool) []string {
+	if dirs, found := c.configDirCache[exe.interpreter]; found {
+		return dirs
+	}
+
+	var dirs []string
+	if isMusl {
+		//'/lib/ld-musl-x86_64.so.1' => '/etc/ld-musl-x86_64.path'
+		name := strings.TrimSuffix(path.Base(exe.interpreter), ".so.1") + ".path"
+		if data, err := c.readConfigFile(path.Join("/etc", name)); err == nil {
+			dirs = splitPathList(strings.Replace(string(data), "\n", ":", -1))
+		}
+	} else {
+		dirs = c.ldSoConfDirs("/etc/ld.so.conf", map[string]bool{})
+	}
+
+	c.configDirCache[exe.interpreter] = dirs
+	return dirs
+}
+
+// ldSoConfDirs parses the glibc loader configuration file (with the 'include' directives)
+func (c *loaderCheck) ldSoConfDirs(confPath string, seen map[string]bool) []string {
+	if seen[confPath] {
+		return nil
+	}
+	seen[confPath] = true
+
+	data, err := c.readConfigFile(confPath)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] != "include" {
+			dirs = append(dirs, fields...)
+			continue
+		}
+
+		for _, pattern := range fields[1:] {
+			if !path.IsAbs(pattern) {
+				pattern = path.Join(path.Dir(confPath), pattern)
+			}
+
+			dirPath, found := c.resolveConfig(path.Dir(pattern))
+			if !found {
+				continue
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(dirPath, path.Base(pattern)))
+			sort.Strings(matches)
+			for _, match := range matches {
+				dirs = append(dirs, c.ldSoConfDirs(path.Join(path.Dir(pattern), filepath.Base(match)), seen)...)
+			}
+		}
+	}
+
+	return dirs
+}
+
+// loadObject returns the resolved image path of the compatible ELF object
+func (c *loaderCheck) loadObject(imagePath string, parent *elfObject) (string, bool) {
+	fullPath, found := c.resolve(imagePath)
+	if !found {
+		return "", false
+	}
+
+	resolved := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, c.root), "/")
+	obj := c.object(resolved, fullPath)
+	if obj == nil || obj.class != parent.class || obj.machine != parent.machine {
+		return "", false
+	}
+
+	return resolved, true
+}
+
+// object parses the ELF file (nil if it's not a dynamically linked ELF file)
+func (c *loaderCheck) object(imagePath, fullPath string) *elfObject {
+	if obj, found := c.objects[imagePath]; found {
+		return obj
+	}
+
+	c.objects[imagePath] = nil
+	file, err := elf.Open(fullPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+		return nil
+	}
+
+	obj := &elfObject{
+		class:   file.Class,
+		machine: file.Machine,
+	}
+
+	obj.interpreter = elfInterpreter(file)
+	obj.needed, _ = file.DynString(elf.DT_NEEDED)
+	if values, err := file.DynString(elf.DT_RPATH); err == nil {
+		for _, value := range values {
+			obj.rpath = append(obj.rpath, splitPathList(value)...)
+		}
+	}
+
+	if values, err := file.DynString(elf.DT_RUNPATH); err == nil {
+		for _, value := range values {
+			obj.runpath = append(obj.runpath, splitPathList(value)...)
+		}
+	}
+
+	c.objects[imagePath] = obj
+	return obj
+}
+
+func (c *loaderCheck) readConfigFile(imagePath string) ([]byte, error) {
+	fullPath, found := c.resolveConfig(imagePath)
+	if !found {
+		return nil, os.ErrNotExist
+	}
+
+	return ioutil.ReadFile(fullPath)
+}
+
+// resolveConfig returns the host path for the loader configuration file or directory
+func (c *loaderCheck) resolveConfig(imagePath string) (string, bool) {
+	if c.config == nil {
+		return c.resolve(imagePath)
+	}
+
+	return c.config.resolve(imagePath)
+}
+
+// resolve returns the host path for the source image file or directory
+// (the files and their symlink targets are downloaded when they are resolved the first time)
+func (l *loaderConfig) resolve(imagePath string) (string, bool) {
+	for hops := 0; hops <= fsutil.MaxLinkHops; hops++ {
+		resolved, err := fsutil.ResolveRootPath(l.root, imagePath, false)
+		if err != nil {
+			return "", false
+		}
+
+		fullPath := filepath.Join(l.root, filepath.FromSlash(resolved))
+		if _, err := os.Lstat(fullPath); err == nil {
+			return fullPath, true
+		}
+
+		if l.fetched[resolved] {
+			return "", false
+		}
+		l.fetched[resolved] = true
+
+		if err := l.source.extract(resolved, l.root); err != nil {
+			log.Debugf("loaderConfig: %v not downloaded => %v", resolved, err)
+			return "", false
+		}
+	}
+
+	return "", false
+}
+
+// resolve returns the host path for the image path (the symlinks are resolved in the minified image files)
+func (c *loaderCheck) resolve(imagePath string) (string, bool) {
+	resolved, err := fsutil.ResolveRootPath(c.root, imagePath, false)
+	if err != nil {
+		return "", false
+	}
+
+	fullPath := filepath.Join(c.root, filepath.FromSlash(resolved))
+	if _, err := os.Lstat(fullPath); err != nil {
+		return "", false
+	}
+
+	return fullPath, true
+}
+
+func expandOrigin(dirs []string, origin string) []string {
+	var out []string
+	for _, dir := range dirs {
+		dir = strings.Replace(dir, "${ORIGIN}", origin, -1)
+		dir = strings.Replace(dir, "$ORIGIN", origin, -1)
+		out = append(out, dir)
+	}
+
+	return out
+}
+
+func splitPathList(value string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(value, ":") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// sourceFiles copies the files from a created, but not started, source image container
+type sourceFiles struct {
+	client      dockerclient.API
+	containerID string
+}
+
+func (b *ImageBuilder) newSourceFiles(imageID string) (*sourceFiles, error) {
+	container, err := b.APIClient.CreateContainer(dockerclient.CreateContainerOptions{
+		Config: &dockerclient.Config{
+			Config: docker.Config{
+				Image: imageID,
+				//the container is never started (the images don't always have a command)
+				Entrypoint: []string{"/docker-slim-files"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("source image container error (%s): %v", imageID, err)
+	}
+
+	return &sourceFiles{
+		client:      b.APIClient,
+		containerID: container.ID,
+	}, nil
+}
+
+func (s *sourceFiles) close() {
+	if err := s.client.RemoveContainer(docker.RemoveContainerOptions{
+		ID:    s.containerID,
+		Force: true,
+	}); err != nil {
+		log.Debugf("sourceFiles: error removing the source image container (%v) => %v", s.containerID, err)
+	}
+}
+
+// include copies the file (and its symlink targets) from the source image to the root directory
+// and returns the image paths of the copied files
+func (s *sourceFiles) include(root, imagePath string) ([]string, error) {
+	var added []string
+	for hops := 0; hops <= fsutil.MaxLinkHops; hops++ {
+		resolved, err := fsutil.ResolveRootPath(root, imagePath, true)
+		if err != nil {
+			return added, err
+		}
+
+		fullPath := filepath.Join(root, filepath.FromSlash(resolved))
+		info, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			if err := s.download(resolved, fullPath); err != nil {
+				return added, err
+			}
+
+			added = append(added, resolved)
+			info, err = os.Lstat(fullPath)
+		}
+
+		if err != nil {
+			return added, err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return added, nil
+		}
+
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return added, err
+		}
+
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(resolved), target)
+		}
+
+		imagePath = target
+	}
+
+	return added, fmt.Errorf("too many symlinks: %s", imagePath)
+}
+
+// download copies the regular file or the symlink from the source image container
+func (s *sourceFiles) download(imagePath, fullPath string) error {
+	//the archive is streamed (the libraries can be large)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(s.client.DownloadFromContainer(s.containerID, docker.DownloadFromContainerOptions{
+			OutputStream: writer,
+			Path:         imagePath,
+		}))
+	}()
+
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err == nil {
+		err = extractSourceFile(tr, hdr, imagePath, fullPath)
+	}
+
+	//drain the stream, so the download goroutine can finish
+	io.Copy(ioutil.Discard, reader)
+	return err
+}
+
+// extract copies the file or the directory (with its files) from the source image container
+// to the same image path in the root directory
+func (s *sourceFiles) extract(imagePath, root string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(s.client.DownloadFromContainer(s.containerID, docker.DownloadFromContainerOptions{
+			OutputStream: writer,
+			Path:         imagePath,
+		}))
+	}()
+
+	err := extractSourceTree(reader, path.Dir(imagePath), root)
+	io.Copy(ioutil.Discard, reader)
+	return err
+}
+
+// extractSourceTree extracts the container archive entries (relative to the parent directory)
+// in the root directory (the entry parent directories are resolved in the root directory)
+func extractSourceTree(in io.Reader, parentPath, root string) error {
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		imagePath := path.Join(parentPath, path.Clean("/"+hdr.Name))
+		dirPath, err := fsutil.ResolveRootPath(root, path.Dir(imagePath), true)
+		if err != nil {
+			return err
+		}
+
+		fullDirPath := filepath.Join(root, filepath.FromSlash(dirPath))
+		if err := os.MkdirAll(fullDirPath, 0755); err != nil {
+			return err
+		}
+
+		fullPath := filepath.Join(fullDirPath, path.Base(imagePath))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(fullPath, 0755)
+		case tar.TypeSymlink, tar.TypeReg, tar.TypeRegA:
+			os.RemoveAll(fullPath)
+			err = extractSourceFile(tr, hdr, imagePath, fullPath)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractSourceFile(in io.Reader, hdr *tar.Header, imagePath, fullPath string) error {
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		return os.Symlink(hdr.Linkname, fullPath)
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, in)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return os.Chmod(fullPath, hdr.FileInfo().Mode())
+	default:
+		return fmt.Errorf("not a file or a symlink: %s", imagePath)
+	}
+}
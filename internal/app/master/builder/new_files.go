@@ -0,0 +1,99 @@
+package builder
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// AddNewFiles copies the host files and directories to the minified image files directory
+// (the files don't need to exist in the target image and they replace the target image files if they do).
+// The new files are keyed by their image paths and AddNewFiles returns the image paths of the added files.
+func (b *ImageBuilder) AddNewFiles(artifactLocation string, newFiles map[string]string) ([]string, error) {
+	dataDir := filepath.Join(artifactLocation, "files")
+
+	var imagePaths []string
+	for imagePath := range newFiles {
+		imagePaths = append(imagePaths, imagePath)
+	}
+
+	sort.Strings(imagePaths)
+
+	var added []string
+	for _, imagePath := range imagePaths {
+		localPath := newFiles[imagePath]
+		log.Debugf("AddNewFiles: %v => %v", localPath, imagePath)
+
+		err := filepath.Walk(localPath, func(fullPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath := filepath.ToSlash(strings.TrimPrefix(fullPath, localPath))
+			filePath := path.Join(imagePath, relPath)
+
+			//the paths are resolved in the minified image files (the image symlinks like '/var/run => /run'
+			//point to the minified image files, not to the host files)
+			if info.IsDir() {
+				resolved, err := fsutil.ResolveRootPath(dataDir, filePath, true)
+				if err != nil {
+					return err
+				}
+
+				dstPath := filepath.Join(dataDir, filepath.FromSlash(resolved))
+				if fsutil.IsDir(dstPath) {
+					return nil
+				}
+
+				//the new directory replaces the target image file
+				os.Remove(dstPath)
+				return os.Mkdir(dstPath, info.Mode().Perm())
+			}
+
+			parent, err := fsutil.ResolveRootPath(dataDir, path.Dir(filePath), true)
+			if err != nil {
+				return err
+			}
+
+			parentPath := filepath.Join(dataDir, filepath.FromSlash(parent))
+			if err := os.MkdirAll(parentPath, 0755); err != nil {
+				return err
+			}
+
+			//the new files replace the target image files (and the symlinks to them)
+			dstPath := filepath.Join(parentPath, path.Base(filePath))
+			if _, err := os.Lstat(dstPath); err == nil {
+				if err := os.RemoveAll(dstPath); err != nil {
+					return err
+				}
+			}
+
+			if err := fsutil.CopyFile(false, fullPath, dstPath, false); err != nil {
+				return err
+			}
+
+			//the file modes are kept (e.g., for the new executables), but not the host file owners
+			if info.Mode().IsRegular() {
+				if err := os.Chmod(dstPath, info.Mode().Perm()); err != nil {
+					return err
+				}
+			}
+
+			added = append(added, filePath)
+			return nil
+		})
+
+		if err != nil {
+			return added, err
+		}
+	}
+
+	b.HasData = fsutil.IsDir(dataDir)
+	return added, nil
+}
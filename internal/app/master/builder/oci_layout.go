@@ -0,0 +1,102 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the OCI layout mode assembles the minified image without the Docker daemon: the layer tars
+//  are streamed directly from the artifact data directories into the layer compression, so the minified
+//  image files are not sent to the daemon in a build context (and the image is not loaded into the daemon)
+//* the layers are compressed like the pushed image layers (gzip by default, zstd or eStargz)
+//  and the manifest gets the OCI image labels and the new manifest annotations
+//* the file timestamps are kept (like in the Docker builder) unless the image is reproducible
+
+// buildOCILayout assembles the minified image in the OCI image layout directory
+func (b *ImageBuilder) buildOCILayout() error {
+	created := time.Now().UTC().Truncate(time.Second)
+	if !b.Created.IsZero() {
+		created = b.Created.Truncate(time.Second).UTC()
+	}
+
+	var modTime time.Time
+	if b.Reproducible {
+		var err error
+		if created, err = b.ReproducibleTime(); err != nil {
+			return err
+		}
+
+		modTime = created
+	}
+
+	image, err := b.assembleImage(created, modTime, "--oci-layout")
+	if err != nil {
+		return err
+	}
+	defer image.close()
+
+	b.setLayerProgress(image.layers)
+
+	var blobs []registry.LayerBlob
+	var diffIDs []string
+	converted := map[string]*registry.LayerBlob{}
+	convertedIDs := map[string]string{}
+	for _, layer := range image.layers {
+		//the layers with the same files are compressed once
+		blob, found := converted[layer.id]
+		if !found {
+			layerData := layer.reader()
+			blob, convertedIDs[layer.id], err = registry.AddLayoutLayer(b.OCILayoutPath, layerData, b.LayerAccess)
+			layerData.Close()
+			if err != nil {
+				return fmt.Errorf("layer %s compression failed: %v", layer.name, err)
+			}
+
+			converted[layer.id] = blob
+		}
+
+		blobs = append(blobs, *blob)
+		diffIDs = append(diffIDs, convertedIDs[layer.id])
+	}
+
+	//the eStargz layers have more tar entries (the TOC and the landmark),
+	//so the image config gets the diff IDs of the compressed layers
+	configData, err := b.imageConfigData(image.created, diffIDs, image.history)
+	if err != nil {
+		return err
+	}
+
+	manifestDigest, err := registry.WriteLayout(b.OCILayoutPath, b.RepoName, configData, blobs, b.LayerAccess.Annotations)
+	if err != nil {
+		return err
+	}
+
+	b.LayoutImage = &dockerclient.Image{
+		Image: docker.Image{
+			ID:           fmt.Sprintf("sha256:%x", sha256.Sum256(configData)),
+			Created:      image.created,
+			Architecture: b.Architecture,
+			Size:         image.size,
+			VirtualSize:  image.size,
+		},
+		Config: &dockerclient.Config{
+			Config: docker.Config{
+				User:         b.User,
+				ExposedPorts: b.ExposedPorts,
+			},
+		},
+	}
+
+	b.LayoutManifestDigest = manifestDigest
+	fmt.Fprintf(&b.BuildLog, "Saved image %s in the OCI image layout %s (manifest: %s, layers: %v, created: %s)\n",
+		b.RepoName, b.OCILayoutPath, manifestDigest, strings.Join(diffIDs, ","), image.created.Format(time.RFC3339))
+	return nil
+}
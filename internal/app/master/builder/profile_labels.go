@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+// Security profile label names
+const (
+	LabelSeccompProfileName    = "io.docker-slim.seccomp.profile.name"
+	LabelSeccompProfileDigest  = "io.docker-slim.seccomp.profile.digest"
+	LabelSeccompProfileURL     = "io.docker-slim.seccomp.profile.url"
+	LabelSeccompProfile        = "io.docker-slim.seccomp.profile"
+	LabelAppArmorProfileName   = "io.docker-slim.apparmor.profile.name"
+	LabelAppArmorProfileDigest = "io.docker-slim.apparmor.profile.digest"
+	LabelAppArmorProfileURL    = "io.docker-slim.apparmor.profile.url"
+)
+
+func profileDigest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func profileURL(baseURL, name string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + name
+}
+
+// AddProfileLabels adds the labels referencing the generated security profiles
+// (the profile names and digests, the profile URLs if there's a base URL
+// and the compacted seccomp profile in the 'full' mode)
+func (b *ImageBuilder) AddProfileLabels(artifactLocation string,
+	seccompProfileName string,
+	appArmorProfileName string,
+	embedProfiles *config.EmbedProfiles) error {
+	if embedProfiles == nil || embedProfiles.Mode == config.EmbedProfilesNone {
+		return nil
+	}
+
+	seccompData, err := ioutil.ReadFile(filepath.Join(artifactLocation, seccompProfileName))
+	if err != nil {
+		return err
+	}
+
+	appArmorData, err := ioutil.ReadFile(filepath.Join(artifactLocation, appArmorProfileName))
+	if err != nil {
+		return err
+	}
+
+	if b.Labels == nil {
+		b.Labels = map[string]string{}
+	}
+
+	b.Labels[LabelSeccompProfileName] = seccompProfileName
+	b.Labels[LabelSeccompProfileDigest] = profileDigest(seccompData)
+	b.Labels[LabelAppArmorProfileName] = appArmorProfileName
+	b.Labels[LabelAppArmorProfileDigest] = profileDigest(appArmorData)
+
+	if embedProfiles.URL != "" {
+		b.Labels[LabelSeccompProfileURL] = profileURL(embedProfiles.URL, seccompProfileName)
+		b.Labels[LabelAppArmorProfileURL] = profileURL(embedProfiles.URL, appArmorProfileName)
+	}
+
+	if embedProfiles.Mode == config.EmbedProfilesFull {
+		//the compacted profile can be used with 'docker run --security-opt seccomp=...' as is
+		var seccompProfile bytes.Buffer
+		if err := json.Compact(&seccompProfile, seccompData); err != nil {
+			return err
+		}
+
+		b.Labels[LabelSeccompProfile] = seccompProfile.String()
+	}
+
+	return nil
+}
@@ -0,0 +1,773 @@
+package builder
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the reproducible mode creates the image archive (the 'docker save' format) and loads it
+//  instead of building the image from the generated Dockerfile, because the Docker builder
+//  uses the current time for the image creation time and for the directories it creates
+//* the layer tar has the entries in the path order, with the same timestamp and without the host user names,
+//  and the image config has a pinned creation time, so the same artifacts produce the same image ID
+//* the layer tars are not saved: the layer digests and sizes are calculated first (the layer files are read,
+//  but nothing is written) and then the layer tars are streamed from the artifact data directories
+//  into the image archive (or into the OCI layout blobs), so the minified image files are not stored twice
+//* the hard links to the same file (the same device and inode) are written as the tar link entries
+//  to the first link in the path order, so the file data is written once
+
+// SourceDateEpochEnv is the standard environment variable for the reproducible build timestamp
+// (https://reproducible-builds.org/specs/source-date-epoch/)
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+const (
+	defaultImageOS   = "linux"
+	defaultImageArch = "amd64"
+)
+
+type imageArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type imageConfig struct {
+	Created      time.Time      `json:"created"`
+	Author       string         `json:"author,omitempty"`
+	Comment      string         `json:"comment,omitempty"`
+	Architecture string         `json:"architecture"`
+	Variant      string         `json:"variant,omitempty"`
+	OS           string         `json:"os"`
+	OSVersion    string         `json:"os.version,omitempty"`
+	Config       imageRunConfig `json:"config"`
+	RootFS       imageRootFS    `json:"rootfs"`
+	History      []imageHistory `json:"history"`
+}
+
+type imageRunConfig struct {
+	User         string                   `json:"User,omitempty"`
+	ExposedPorts map[docker.Port]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string                 `json:"Env,omitempty"`
+	Entrypoint   []string                 `json:"Entrypoint,omitempty"`
+	Cmd          []string                 `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{}      `json:"Volumes,omitempty"`
+	WorkingDir   string                   `json:"WorkingDir,omitempty"`
+	Labels       map[string]string        `json:"Labels,omitempty"`
+	StopSignal   string                   `json:"StopSignal,omitempty"`
+	Shell        []string                 `json:"Shell,omitempty"`
+	OnBuild      []string                 `json:"OnBuild,omitempty"`
+}
+
+type imageRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type imageHistory struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+}
+
+// imageLayer is a reproducible image layer (the files from one of the artifact data directories)
+// or the shared layer (the layer tar file)
+type imageLayer struct {
+	name    string
+	entries map[string]*layerEntry
+	modTime time.Time
+	id      string
+	size    int64
+	file    *os.File
+	//progress counts the written layer files (it's shared by the image layers)
+	progress *buildProgress
+}
+
+// layerEntry is a minified image file (from the artifact data directories) with its image owner
+type layerEntry struct {
+	fullPath string
+	info     os.FileInfo
+	uid      int
+	gid      int
+	//source is the original image tar header for the files extracted from an image
+	//(the extracted files don't have the original modes)
+	source *tar.Header
+}
+
+// ReproducibleTime returns the pinned image creation time: the custom image creation time,
+// the SOURCE_DATE_EPOCH value (if it's set) or the source image creation time
+func (b *ImageBuilder) ReproducibleTime() (time.Time, error) {
+	if !b.Created.IsZero() {
+		return b.Created.Truncate(time.Second).UTC(), nil
+	}
+
+	if epoch := os.Getenv(SourceDateEpochEnv); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil || seconds < 0 {
+			return time.Time{}, fmt.Errorf("invalid %s value - '%s'", SourceDateEpochEnv, epoch)
+		}
+
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return b.SourceCreated.Truncate(time.Second).UTC(), nil
+}
+
+func (b *ImageBuilder) buildReproducible() error {
+	created, err := b.ReproducibleTime()
+	if err != nil {
+		return err
+	}
+
+	repoTag := b.RepoName
+	if idx := strings.LastIndex(repoTag, ":"); idx == -1 || strings.Contains(repoTag[idx:], "/") {
+		repoTag = repoTag + ":latest"
+	}
+
+	image, err := b.assembleImage(created, created, "--reproducible")
+	if err != nil {
+		return err
+	}
+	defer image.close()
+
+	b.setLayerProgress(image.layers)
+
+	configData, err := b.imageConfigData(image.created, image.diffIDs, image.history)
+	if err != nil {
+		return err
+	}
+
+	configID := fmt.Sprintf("%x", sha256.Sum256(configData))
+	var layerPaths []string
+	for _, layer := range image.layers {
+		layerPaths = append(layerPaths, layer.id+"/layer.tar")
+	}
+
+	manifestData, err := json.Marshal([]imageArchiveManifest{
+		{
+			Config:   configID + ".json",
+			RepoTags: []string{repoTag},
+			Layers:   layerPaths,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	archiveReader, archiveWriter := io.Pipe()
+	go func() {
+		archiveWriter.CloseWithError(writeImageArchive(archiveWriter,
+			created, manifestData, configID, configData, image.layers))
+	}()
+
+	if err := b.APIClient.LoadImage(docker.LoadImageOptions{InputStream: archiveReader}); err != nil {
+		archiveReader.Close()
+		return err
+	}
+
+	//the load errors are reported in the response stream, so the loaded image is checked
+	//(the tag can still point to an older image, so both the image ID and the creation time have to match)
+	imageInfo, err := b.APIClient.InspectImage(repoTag)
+	if err != nil {
+		return err
+	}
+
+	if imageInfo.ID != "sha256:"+configID || !imageInfo.Created.Equal(created) {
+		return fmt.Errorf("reproducible image was not loaded (image ID: %s, expected: sha256:%s, created: %s, expected: %s)",
+			imageInfo.ID, configID, imageInfo.Created.Format(time.RFC3339), created.Format(time.RFC3339))
+	}
+
+	fmt.Fprintf(&b.BuildLog, "Loaded reproducible image %s (ID: sha256:%s, layers: %v, created: %s)\n",
+		repoTag, configID, image.diffIDs, created.Format(time.RFC3339))
+	return nil
+}
+
+// assembledImage is the minified image assembled without the Docker builder
+// (the layer tar files and the image config parts)
+type assembledImage struct {
+	created time.Time
+	layers  []*imageLayer
+	diffIDs []string
+	history []imageHistory
+	size    int64
+}
+
+// close closes the shared layer file
+func (i *assembledImage) close() {
+	for _, layer := range i.layers {
+		if layer.file != nil {
+			layer.file.Close()
+		}
+	}
+}
+
+// assembleImage calculates the layer digests and sizes for the minified image
+// and collects the image config parts. The layer entries get the modTime timestamp
+// (the zero modTime keeps the file timestamps) and the createdBy option is recorded in the image history.
+func (b *ImageBuilder) assembleImage(created, modTime time.Time, createdBy string) (*assembledImage, error) {
+	layers, err := b.imageLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	image := &assembledImage{created: created}
+	for _, layer := range layers {
+		layer.modTime = modTime
+		image.layers = append(image.layers, layer)
+
+		layerHash := sha256.New()
+		layerOut := &countWriter{w: layerHash}
+		if err := writeLayer(layerOut, layer.entries, modTime, nil); err != nil {
+			return nil, err
+		}
+
+		layer.id = fmt.Sprintf("%x", layerHash.Sum(nil))
+		layer.size = layerOut.n
+		image.size += layer.size
+		image.diffIDs = append(image.diffIDs, "sha256:"+layer.id)
+		image.history = append(image.history, imageHistory{
+			Created:   created,
+			CreatedBy: fmt.Sprintf("docker-slim build %s (%s): %s", createdBy, v.Current(), layer.name),
+		})
+	}
+
+	//the shared layer tar is used as is (it's the bottom layer in all images built with it)
+	if b.SharedLayer != nil {
+		sharedLayer, err := b.sharedImageLayer()
+		if err != nil {
+			image.close()
+			return nil, err
+		}
+
+		image.layers = append([]*imageLayer{sharedLayer}, image.layers...)
+		image.size += b.SharedLayer.Size
+		image.diffIDs = append([]string{b.SharedLayer.DiffID}, image.diffIDs...)
+		image.history = append([]imageHistory{
+			{
+				Created:   b.SharedLayer.Created,
+				CreatedBy: sharedLayerCreatedBy,
+			},
+		}, image.history...)
+	}
+
+	return image, nil
+}
+
+// imageConfigData creates the image config for the assembled minified image
+func (b *ImageBuilder) imageConfigData(created time.Time, diffIDs []string, history []imageHistory) ([]byte, error) {
+	labels := map[string]string{"docker-slim.version": v.Current()}
+	for name, value := range b.Labels {
+		labels[name] = value
+	}
+
+	arch := b.Architecture
+	if arch == "" {
+		arch = defaultImageArch
+	}
+
+	imageOS := b.OS
+	if imageOS == "" {
+		imageOS = defaultImageOS
+	}
+
+	return json.Marshal(&imageConfig{
+		Created:      created,
+		Author:       b.Author,
+		Comment:      b.Comment,
+		Architecture: arch,
+		Variant:      b.Variant,
+		OS:           imageOS,
+		OSVersion:    b.OSVersion,
+		Config: imageRunConfig{
+			User:         b.User,
+			ExposedPorts: b.ExposedPorts,
+			Env:          imageEnv(b.Env),
+			Entrypoint:   b.Entrypoint,
+			Cmd:          b.Cmd,
+			Volumes:      b.Volumes,
+			WorkingDir:   b.WorkingDir,
+			Labels:       labels,
+			StopSignal:   b.StopSignal,
+			Shell:        b.Shell,
+			OnBuild:      b.OnBuild,
+		},
+		RootFS: imageRootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+		History: history,
+	})
+}
+
+// imageLayers collects the minified image files from the data directories for each image layer
+// (with the single layer strategy the application files override the other files with the same image path)
+func (b *ImageBuilder) imageLayers() ([]*imageLayer, error) {
+	dataDir := filepath.Join(b.BuildOptions.ContextDir, "files")
+	dataDirs := []string{dataDir}
+	base := &imageLayer{name: "files", entries: map[string]*layerEntry{}}
+	if b.HasData {
+		if err := collectLayerEntries(base.entries, dataDir, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	layers := []*imageLayer{base}
+	for _, dirName := range b.LayerDirs {
+		layer := &imageLayer{name: dirName, entries: map[string]*layerEntry{}}
+		layerDir := filepath.Join(b.BuildOptions.ContextDir, dirName)
+		if err := collectLayerEntries(layer.entries, layerDir, 0, 0); err != nil {
+			return nil, err
+		}
+
+		dataDirs = append(dataDirs, layerDir)
+		layers = append(layers, layer)
+	}
+
+	if b.AppDataOwner != "" {
+		uid, gid, err := lookupOwner(dataDirs, b.AppDataOwner)
+		if err != nil {
+			return nil, err
+		}
+
+		appLayer := base
+		if len(b.LayerDirs) > 0 {
+			appLayer = &imageLayer{name: appDataDirName, entries: map[string]*layerEntry{}}
+			layers = append(layers, appLayer)
+		}
+
+		appDataDir := filepath.Join(b.BuildOptions.ContextDir, appDataDirName)
+		if err := collectLayerEntries(appLayer.entries, appDataDir, uid, gid); err != nil {
+			return nil, err
+		}
+	}
+
+	return layers, nil
+}
+
+func collectLayerEntries(entries map[string]*layerEntry, dir string, uid, gid int) error {
+	return filepath.Walk(dir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(fullPath, dir), "/")
+		if name == "" {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSocket != 0 {
+			log.Debugf("collectLayerEntries: skipping socket - %v", fullPath)
+			return nil
+		}
+
+		entries[name] = &layerEntry{
+			fullPath: fullPath,
+			info:     info,
+			uid:      uid,
+			gid:      gid,
+		}
+
+		return nil
+	})
+}
+
+func writeLayer(out io.Writer, entries map[string]*layerEntry, modTime time.Time, progress *buildProgress) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	//the hard links to the same file are written as the links to its first entry (in the path order)
+	type fileID struct {
+		dev uint64
+		ino uint64
+	}
+	linkNames := map[fileID]string{}
+
+	tw := tar.NewWriter(out)
+	for _, name := range names {
+		entry := entries[name]
+
+		var link string
+		if entry.info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(entry.fullPath)
+			if err != nil {
+				return err
+			}
+
+			link = target
+		}
+
+		var hardLink string
+		if entry.info.Mode().IsRegular() {
+			if stat, ok := fsutil.FileSysStat(entry.info); ok && stat.Nlink > 1 {
+				id := fileID{dev: stat.Dev, ino: stat.Ino}
+				if linkName, found := linkNames[id]; found {
+					hardLink = linkName
+				} else {
+					linkNames[id] = name
+				}
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(entry.info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = name
+		if entry.info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if hardLink != "" {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = hardLink
+			hdr.Size = 0
+		}
+
+		hdr.Uid = entry.uid
+		hdr.Gid = entry.gid
+		hdr.Uname = ""
+		hdr.Gname = ""
+		if entry.source != nil {
+			hdr.Mode = entry.source.Mode
+			hdr.ModTime = entry.source.ModTime
+		}
+
+		if !modTime.IsZero() {
+			hdr.ModTime = modTime
+		}
+
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Format = tar.FormatPAX
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if err := copyFileData(tw, entry.fullPath); err != nil {
+				return err
+			}
+		}
+
+		progress.add(entry)
+	}
+
+	return tw.Close()
+}
+
+func copyFileData(out io.Writer, fullPath string) error {
+	in, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func writeImageArchive(out io.Writer,
+	modTime time.Time,
+	manifestData []byte,
+	configID string,
+	configData []byte,
+	layers []*imageLayer) error {
+	tw := tar.NewWriter(out)
+	writeData := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeData("manifest.json", manifestData); err != nil {
+		return err
+	}
+
+	if err := writeData(configID+".json", configData); err != nil {
+		return err
+	}
+
+	written := map[string]bool{}
+	for _, layer := range layers {
+		//the layers with the same files are stored once
+		if written[layer.id] {
+			continue
+		}
+
+		written[layer.id] = true
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     layer.id + "/",
+			Mode:     0755,
+			ModTime:  modTime,
+			Typeflag: tar.TypeDir,
+		}); err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     layer.id + "/layer.tar",
+			Mode:     0644,
+			Size:     layer.size,
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+
+		if err := layer.writeTo(tw); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// writeTo writes the layer tar (the layer tar is created from the layer entries again,
+// so the files changed after the layer digest was calculated fail the build)
+func (l *imageLayer) writeTo(out io.Writer) error {
+	if l.file != nil {
+		if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		_, err := io.Copy(out, l.file)
+		return err
+	}
+
+	layerOut := &countWriter{w: out}
+	err := writeLayer(layerOut, l.entries, l.modTime, l.progress)
+	if (err != nil || layerOut.n != l.size) && l.filesChanged() {
+		return fmt.Errorf("layer %s files changed during the build", l.name)
+	}
+
+	if err == nil && layerOut.n != l.size {
+		return fmt.Errorf("layer %s size mismatch (size: %v, expected: %v)", l.name, layerOut.n, l.size)
+	}
+
+	return err
+}
+
+// filesChanged returns true if the layer files changed after the layer entries were collected
+func (l *imageLayer) filesChanged() bool {
+	for _, entry := range l.entries {
+		info, err := os.Lstat(entry.fullPath)
+		if err != nil ||
+			info.Mode() != entry.info.Mode() ||
+			info.Size() != entry.info.Size() ||
+			!info.ModTime().Equal(entry.info.ModTime()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reader returns the layer tar stream
+func (l *imageLayer) reader() io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(l.writeTo(writer))
+	}()
+
+	return reader
+}
+
+// buildProgress counts the minified image files written to the image build
+// (the build context or the layer tars) and reports the counts with the builder Progress function
+type buildProgress struct {
+	update     func(files, totalFiles, bytes, totalBytes int64)
+	files      int64
+	totalFiles int64
+	bytes      int64
+	totalBytes int64
+}
+
+// newBuildProgress creates the build progress for the entries (nil if the builder doesn't report the progress)
+func (b *ImageBuilder) newBuildProgress(entries ...map[string]*layerEntry) *buildProgress {
+	if b.Progress == nil {
+		return nil
+	}
+
+	progress := &buildProgress{update: b.Progress}
+	for _, layerEntries := range entries {
+		for _, entry := range layerEntries {
+			progress.totalFiles++
+			if entry.info.Mode().IsRegular() {
+				progress.totalBytes += entry.info.Size()
+			}
+		}
+	}
+
+	return progress
+}
+
+// setLayerProgress sets the build progress for the image layers
+// (the layers with the same files are written once and the shared layer tar is not counted)
+func (b *ImageBuilder) setLayerProgress(layers []*imageLayer) {
+	var entries []map[string]*layerEntry
+	var written []*imageLayer
+	seen := map[string]bool{}
+	for _, layer := range layers {
+		if layer.file != nil || seen[layer.id] {
+			continue
+		}
+
+		seen[layer.id] = true
+		entries = append(entries, layer.entries)
+		written = append(written, layer)
+	}
+
+	progress := b.newBuildProgress(entries...)
+	for _, layer := range written {
+		layer.progress = progress
+	}
+}
+
+func (p *buildProgress) add(entry *layerEntry) {
+	if p == nil {
+		return
+	}
+
+	p.files++
+	if entry.info.Mode().IsRegular() {
+		p.bytes += entry.info.Size()
+	}
+
+	p.update(p.files, p.totalFiles, p.bytes, p.totalBytes)
+}
+
+// countWriter counts the written bytes
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// imageEnv removes the invalid and the duplicate environment variables
+// (the later values override the earlier ones, like the ENV instructions)
+func imageEnv(env []string) []string {
+	var names []string
+	values := map[string]string{}
+	for _, envInfo := range env {
+		parts := strings.SplitN(envInfo, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+
+		if _, ok := values[parts[0]]; !ok {
+			names = append(names, parts[0])
+		}
+
+		values[parts[0]] = parts[1]
+	}
+
+	var out []string
+	for _, name := range names {
+		out = append(out, name+"="+values[name])
+	}
+
+	return out
+}
+
+// lookupOwner resolves the image user (and group) to the numeric IDs using the minified image
+// passwd and group files (the same way 'COPY --chown' resolves them)
+func lookupOwner(dataDirs []string, owner string) (int, int, error) {
+	parts := strings.SplitN(owner, ":", 2)
+	uid, gid, err := lookupID(findDataFile(dataDirs, "etc/passwd"), parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 2 {
+		gid, _, err = lookupID(findDataFile(dataDirs, "etc/group"), parts[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// findDataFile returns the minified image file path in the data directory that has it
+// (the split layers can move the file to one of the layer data directories)
+func findDataFile(dataDirs []string, name string) string {
+	for _, dir := range dataDirs {
+		if fullPath := filepath.Join(dir, name); fsutil.Exists(fullPath) {
+			return fullPath
+		}
+	}
+
+	return filepath.Join(dataDirs[0], name)
+}
+
+// lookupID returns the ID and the primary group ID (the passwd files only) for the name or the numeric ID
+// (a numeric user ID without a passwd record uses the same ID for the group)
+func lookupID(dbPath, name string) (int, int, error) {
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+
+	isPasswd := filepath.Base(dbPath) == "passwd"
+	for _, line := range strings.Split(string(data), "\n") {
+		//name:password:ID:GID:... (passwd) or name:password:ID:members (group)
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 3 || (fields[0] != name && fields[2] != name) {
+			continue
+		}
+
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+
+		groupID := id
+		if isPasswd && len(fields) > 3 {
+			if primary, err := strconv.Atoi(fields[3]); err == nil {
+				groupID = primary
+			}
+		}
+
+		return id, groupID, nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, id, nil
+	}
+
+	return 0, 0, fmt.Errorf("unknown user or group in the minified image - '%s'", name)
+}
@@ -0,0 +1,466 @@
+package builder
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the shared layer has the files (the same path, contents and permissions) kept in several minified images
+//  (e.g., libc and the CA certificates in the images built from the same base image)
+//* the shared layer tar is created once (with the sorted entries and the fixed timestamps),
+//  so all minified images built with it have the same bottom layer (the registries store it only once)
+//* the shared layer is loaded as an image ('docker-slim-shared-layer:<diff ID prefix>') and the minified images
+//  are built 'FROM' it (the reproducible images have its layer tar as the first layer)
+
+// Shared layer store files
+const (
+	SharedLayerManifestFileName = "shared-layer.json"
+	sharedLayerTarName          = "layer.tar"
+	sharedLayerDataDir          = "files"
+)
+
+// SharedLayerImageRepo is the repository name for the loaded shared layer images
+const SharedLayerImageRepo = "docker-slim-shared-layer"
+
+const sharedLayerCreatedBy = "docker-slim shared-layer"
+
+// SharedLayerManifest describes the shared layer in the shared layer store directory
+type SharedLayerManifest struct {
+	DiffID  string                     `json:"diff_id"`
+	Created time.Time                  `json:"created"`
+	Size    int64                      `json:"size"`
+	Images  int                        `json:"images"`
+	Files   []*report.BuildContextFile `json:"files"`
+}
+
+// ImageName returns the name of the shared layer image
+func (m *SharedLayerManifest) ImageName() string {
+	return fmt.Sprintf("%s:%s", SharedLayerImageRepo, strings.TrimPrefix(m.DiffID, "sha256:")[:12])
+}
+
+// sharedCandidate is a file version from the artifact directories
+type sharedCandidate struct {
+	file      *report.BuildContextFile
+	fullPath  string
+	locations map[string]bool
+}
+
+func (c *sharedCandidate) key() string {
+	return strings.Join([]string{c.file.Path, c.file.Type, c.file.Mode, c.file.Digest, c.file.Link}, "|")
+}
+
+// CreateSharedLayer creates the shared layer store with the files (and the symlinks)
+// kept in at least 'minImages' minified images (their artifact directories have the build context manifests).
+// If several file versions have the same path, the version kept in more images is used.
+func CreateSharedLayer(artifactLocations []string, outputLocation string, minImages int) (*SharedLayerManifest, error) {
+	candidates := map[string]*sharedCandidate{}
+	dirModes := map[string]string{}
+	for _, location := range artifactLocations {
+		data, err := ioutil.ReadFile(filepath.Join(location, report.DefaultBuildContextFileName))
+		if err != nil {
+			return nil, fmt.Errorf("no build context manifest in %s (build the minified image first): %v", location, err)
+		}
+
+		var manifest report.BuildContextManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid build context manifest in %s: %v", location, err)
+		}
+
+		//the artifacts built from a base image (or a shared layer) don't have all minified image files
+		if manifest.BaseImage != "" {
+			return nil, fmt.Errorf("minified image in %s is built from a base image (%s)", location, manifest.BaseImage)
+		}
+
+		for _, dir := range manifest.Directories {
+			//the application files are owned by the image user
+			if dir.Owner != "" {
+				continue
+			}
+
+			for _, file := range dir.Files {
+				switch file.Type {
+				case report.ContextFileDir:
+					if _, found := dirModes[file.Path]; !found {
+						dirModes[file.Path] = file.Mode
+					}
+				case report.ContextFileRegular, report.ContextFileSymlink:
+					candidate := &sharedCandidate{
+						file:      file,
+						fullPath:  filepath.Join(location, dir.Name, filepath.FromSlash(file.Path)),
+						locations: map[string]bool{},
+					}
+
+					if found, ok := candidates[candidate.key()]; ok {
+						candidate = found
+					} else {
+						candidates[candidate.key()] = candidate
+					}
+
+					candidate.locations[location] = true
+				}
+			}
+		}
+	}
+
+	selected := map[string]*sharedCandidate{}
+	for _, candidate := range candidates {
+		if len(candidate.locations) < minImages {
+			continue
+		}
+
+		current := selected[candidate.file.Path]
+		if current == nil ||
+			len(candidate.locations) > len(current.locations) ||
+			(len(candidate.locations) == len(current.locations) && candidate.key() < current.key()) {
+			selected[candidate.file.Path] = candidate
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no files are kept in at least %d minified images", minImages)
+	}
+
+	dataDir := filepath.Join(outputLocation, sharedLayerDataDir)
+	if err := os.RemoveAll(dataDir); err != nil {
+		return nil, err
+	}
+
+	manifest := &SharedLayerManifest{
+		Images: len(artifactLocations),
+	}
+
+	var paths []string
+	for filePath := range selected {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	for _, filePath := range paths {
+		candidate := selected[filePath]
+		if err := copySharedFile(dataDir, candidate, dirModes); err != nil {
+			return nil, err
+		}
+
+		manifest.Files = append(manifest.Files, candidate.file)
+	}
+
+	created, err := sharedLayerTime()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*layerEntry{}
+	if err := collectLayerEntries(entries, dataDir, 0, 0); err != nil {
+		return nil, err
+	}
+
+	layerFile, err := os.Create(filepath.Join(outputLocation, sharedLayerTarName))
+	if err != nil {
+		return nil, err
+	}
+	defer layerFile.Close()
+
+	layerHash := sha256.New()
+	layerOut := bufio.NewWriter(io.MultiWriter(layerFile, layerHash))
+	if err := writeLayer(layerOut, entries, created, nil); err != nil {
+		return nil, err
+	}
+
+	if err := layerOut.Flush(); err != nil {
+		return nil, err
+	}
+
+	layerInfo, err := layerFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.DiffID = fmt.Sprintf("sha256:%x", layerHash.Sum(nil))
+	manifest.Created = created
+	manifest.Size = layerInfo.Size()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(outputLocation, SharedLayerManifestFileName), data, 0644); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// sharedLayerTime returns the timestamp for the shared layer files: the SOURCE_DATE_EPOCH value
+// (if it's set) or the Unix epoch (the shared layer doesn't have a source image)
+func sharedLayerTime() (time.Time, error) {
+	b := &ImageBuilder{SourceCreated: time.Unix(0, 0)}
+	return b.ReproducibleTime()
+}
+
+// copySharedFile copies the file to the shared layer data directory
+// (the created parent directories have the modes from the build context manifests)
+func copySharedFile(dataDir string, candidate *sharedCandidate, dirModes map[string]string) error {
+	dirPath := "/"
+	for _, part := range strings.Split(strings.Trim(path.Dir(candidate.file.Path), "/"), "/") {
+		if part == "" {
+			continue
+		}
+
+		dirPath = path.Join(dirPath, part)
+		fullPath := filepath.Join(dataDir, filepath.FromSlash(dirPath))
+		if fsutil.Exists(fullPath) {
+			continue
+		}
+
+		if err := os.MkdirAll(fullPath, 0755); err != nil {
+			return err
+		}
+
+		if mode, ok := parseModeString(dirModes[dirPath]); ok {
+			if err := os.Chmod(fullPath, mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	dst := filepath.Join(dataDir, filepath.FromSlash(candidate.file.Path))
+	if candidate.file.Type == report.ContextFileSymlink {
+		return os.Symlink(candidate.file.Link, dst)
+	}
+
+	if err := fsutil.CopyRegularFile(false, candidate.fullPath, dst, false); err != nil {
+		return err
+	}
+
+	digest, err := fileDigest(dst)
+	if err != nil {
+		return err
+	}
+
+	if "sha256:"+digest != candidate.file.Digest {
+		return fmt.Errorf("shared layer file changed after the build: %s", candidate.fullPath)
+	}
+
+	if mode, ok := parseModeString(candidate.file.Mode); ok {
+		return os.Chmod(dst, mode)
+	}
+
+	return nil
+}
+
+// parseModeString parses the permission bits (and the special bits) in the file mode string
+// (the os.FileMode string format, e.g., '-rwxr-xr-x' or 'dtrwxrwxrwx')
+func parseModeString(value string) (os.FileMode, bool) {
+	if len(value) < 9 {
+		return 0, false
+	}
+
+	var mode os.FileMode
+	for _, flag := range value[:len(value)-9] {
+		switch flag {
+		case 'u':
+			mode |= os.ModeSetuid
+		case 'g':
+			mode |= os.ModeSetgid
+		case 't':
+			mode |= os.ModeSticky
+		}
+	}
+
+	perm := value[len(value)-9:]
+	for idx, bit := range perm {
+		if bit != '-' {
+			mode |= 1 << uint(8-idx)
+		}
+	}
+
+	return mode, true
+}
+
+// LoadSharedLayer loads the shared layer manifest from the shared layer store
+func LoadSharedLayer(location string) (*SharedLayerManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(location, SharedLayerManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest SharedLayerManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid shared layer manifest in %s: %v", location, err)
+	}
+
+	if !strings.HasPrefix(manifest.DiffID, "sha256:") || len(manifest.DiffID) != len("sha256:")+64 {
+		return nil, fmt.Errorf("invalid shared layer diff ID in %s: %s", location, manifest.DiffID)
+	}
+
+	return &manifest, nil
+}
+
+// UseSharedLayer makes the shared layer the bottom layer of the minified image:
+// it loads the shared layer image (if it's not loaded yet), builds the minified image 'FROM' it
+// and removes the artifact files the shared layer has. It returns the number of the removed files, their total size
+// and the shared layer files the minified image didn't keep (the image gets them from the shared layer).
+func (b *ImageBuilder) UseSharedLayer(location string) (int, int64, []string, error) {
+	manifest, err := LoadSharedLayer(location)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	b.SharedLayer = manifest
+	b.SharedLayerPath = filepath.Join(location, sharedLayerTarName)
+	b.BaseImage = manifest.ImageName()
+
+	//the OCI layout images get the shared layer tar directly (the daemon doesn't need the shared layer image)
+	if b.OCILayoutPath == "" {
+		if _, err := b.APIClient.InspectImage(b.BaseImage); err == docker.ErrNoSuchImage {
+			if err := b.loadSharedLayerImage(); err != nil {
+				return 0, 0, nil, err
+			}
+		} else if err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	dataDir := filepath.Join(b.BuildOptions.ContextDir, "files")
+	var extraFiles []string
+	for _, file := range manifest.Files {
+		if file.Type == report.ContextFileDir {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(dataDir, filepath.FromSlash(file.Path))); os.IsNotExist(err) {
+			extraFiles = append(extraFiles, file.Path)
+		}
+	}
+
+	if !b.HasData {
+		return 0, 0, extraFiles, nil
+	}
+
+	sharedFiles := map[string]*baseFile{}
+	for _, file := range manifest.Files {
+		sharedFiles[file.Path] = &baseFile{
+			mode:   file.Mode,
+			size:   file.Size,
+			digest: strings.TrimPrefix(file.Digest, "sha256:"),
+			link:   file.Link,
+		}
+	}
+
+	count, size, _, err := removeSameFiles(dataDir, sharedFiles)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	log.Debugf("UseSharedLayer: removed %v files (%v bytes) the shared layer has - %v", count, size, b.BaseImage)
+	return count, size, extraFiles, nil
+}
+
+// sharedImageLayer opens the shared layer tar for the image archive
+func (b *ImageBuilder) sharedImageLayer() (*imageLayer, error) {
+	layerFile, err := os.Open(b.SharedLayerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	layerInfo, err := layerFile.Stat()
+	if err != nil {
+		layerFile.Close()
+		return nil, err
+	}
+
+	return &imageLayer{
+		name: SharedLayerImageRepo,
+		id:   strings.TrimPrefix(b.SharedLayer.DiffID, "sha256:"),
+		size: layerInfo.Size(),
+		file: layerFile,
+	}, nil
+}
+
+// loadSharedLayerImage loads the image with the shared layer (and an empty runtime config)
+func (b *ImageBuilder) loadSharedLayerImage() error {
+	layer, err := b.sharedImageLayer()
+	if err != nil {
+		return err
+	}
+	defer layer.file.Close()
+
+	arch := b.Architecture
+	if arch == "" {
+		arch = defaultImageArch
+	}
+
+	imageOS := b.OS
+	if imageOS == "" {
+		imageOS = defaultImageOS
+	}
+
+	created := b.SharedLayer.Created
+	configData, err := json.Marshal(&imageConfig{
+		Created:      created,
+		Architecture: arch,
+		Variant:      b.Variant,
+		OS:           imageOS,
+		OSVersion:    b.OSVersion,
+		RootFS: imageRootFS{
+			Type:    "layers",
+			DiffIDs: []string{b.SharedLayer.DiffID},
+		},
+		History: []imageHistory{
+			{
+				Created:   created,
+				CreatedBy: sharedLayerCreatedBy,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	configID := fmt.Sprintf("%x", sha256.Sum256(configData))
+	manifestData, err := json.Marshal([]imageArchiveManifest{
+		{
+			Config:   configID + ".json",
+			RepoTags: []string{b.BaseImage},
+			Layers:   []string{layer.id + "/layer.tar"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	archiveReader, archiveWriter := io.Pipe()
+	go func() {
+		archiveWriter.CloseWithError(writeImageArchive(archiveWriter,
+			created, manifestData, configID, configData, []*imageLayer{layer}))
+	}()
+
+	if err := b.APIClient.LoadImage(docker.LoadImageOptions{InputStream: archiveReader}); err != nil {
+		archiveReader.Close()
+		return err
+	}
+
+	if _, err := b.APIClient.InspectImage(b.BaseImage); err != nil {
+		return fmt.Errorf("shared layer image was not loaded (%s): %v", b.BaseImage, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package builder
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the static file selection is used when the image can't run (there's no Docker daemon),
+//  so it keeps only the files it can find without the sensor: the ENTRYPOINT and CMD executables,
+//  their script interpreters, dynamic loaders and shared libraries, the files in their arguments,
+//  the included paths and the basic system files (the interpreted application dependencies,
+//  like the Python or Node.js modules, need the include options)
+//* the files are selected in the image filesystem extracted to a directory (the symlinks are resolved
+//  like in a chroot and the symlinks to the selected files are selected too)
+
+// the basic system files the applications usually need (the missing files are skipped)
+var staticSystemFiles = []string{
+	"/etc/passwd",
+	"/etc/group",
+	"/etc/nsswitch.conf",
+	"/etc/ld.so.cache",
+	"/etc/ld.so.conf",
+	"/etc/ld.so.conf.d",
+	"/etc/localtime",
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/ssl/cert.pem",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+}
+
+// the directories the applications usually need (their files are not selected)
+var staticSystemDirs = []string{
+	"/tmp",
+}
+
+// the shells the shell form commands run with ('<shell> -c <command>')
+var staticShells = map[string]bool{
+	"sh":   true,
+	"ash":  true,
+	"bash": true,
+	"dash": true,
+}
+
+type staticFiles struct {
+	root        string
+	workDir     string
+	env         []string
+	check       *loaderCheck
+	files       map[string]bool
+	executables map[string]bool
+}
+
+// StaticFiles returns the image paths of the minified image files selected with the static analysis
+// of the image filesystem in the root directory (without running the image)
+func StaticFiles(root string,
+	imageConfig *docker.Config,
+	includePaths map[string]bool,
+	includeBins map[string]bool,
+	includeExes map[string]bool,
+	doIncludeShell bool) []string {
+	s := &staticFiles{
+		root:        root,
+		files:       map[string]bool{},
+		executables: map[string]bool{},
+	}
+
+	var command []string
+	if imageConfig != nil {
+		s.workDir = imageConfig.WorkingDir
+		s.env = imageConfig.Env
+		command = append(append(command, imageConfig.Entrypoint...), imageConfig.Cmd...)
+	}
+
+	var libraryPath []string
+	for _, envInfo := range imageEnv(s.env) {
+		if strings.HasPrefix(envInfo, "LD_LIBRARY_PATH=") {
+			libraryPath = splitPathList(strings.TrimPrefix(envInfo, "LD_LIBRARY_PATH="))
+		}
+	}
+
+	s.check = &loaderCheck{
+		root:        root,
+		libraryPath: libraryPath,
+		objects:     map[string]*elfObject{},
+	}
+
+	for _, filePath := range staticSystemFiles {
+		s.keepTree(filePath)
+	}
+
+	for _, dirPath := range staticSystemDirs {
+		s.keep(dirPath)
+	}
+
+	if s.workDir != "" {
+		s.keep(s.workDir)
+	}
+
+	if len(command) > 0 && command[0] != "" {
+		s.keepExecutable(command[0])
+		s.keepArgs(command)
+	}
+
+	for filePath := range includePaths {
+		s.keepTree(filePath)
+	}
+
+	for filePath := range includeBins {
+		if resolved, fullPath, found := s.keep(filePath); found {
+			s.keepLibraries(resolved, fullPath)
+		}
+	}
+
+	for name := range includeExes {
+		s.keepExecutable(name)
+	}
+
+	if doIncludeShell {
+		s.keepExecutable("/bin/sh")
+	}
+
+	var files []string
+	for filePath := range s.files {
+		files = append(files, filePath)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// keep selects the file and the symlinks to it and returns its resolved image path and its host path
+func (s *staticFiles) keep(imagePath string) (string, string, bool) {
+	resolved, links, err := fsutil.RootPathLinks(s.root, imagePath)
+	if err != nil {
+		return "", "", false
+	}
+
+	fullPath := filepath.Join(s.root, filepath.FromSlash(resolved))
+	if _, err := os.Lstat(fullPath); err != nil || resolved == "/" {
+		return "", "", false
+	}
+
+	for _, linkPath := range links {
+		s.files[linkPath] = true
+	}
+
+	s.files[resolved] = true
+	return resolved, fullPath, true
+}
+
+// keepTree selects the file or the directory with all its files
+func (s *staticFiles) keepTree(imagePath string) {
+	resolved, fullPath, found := s.keep(imagePath)
+	if !found {
+		return
+	}
+
+	err := filepath.Walk(fullPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		fileImagePath := path.Join(resolved, filepath.ToSlash(strings.TrimPrefix(filePath, fullPath)))
+		s.files[fileImagePath] = true
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			s.keep(fileImagePath)
+		case info.Mode().IsRegular():
+			s.keepLibraries(fileImagePath, filePath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Debugf("StaticFiles: error selecting %v => %v", imagePath, err)
+	}
+}
+
+// keepExecutable selects the executable (looked up like the container runtime does)
+// with its script interpreter or its dynamic loader and shared libraries
+func (s *staticFiles) keepExecutable(command string) {
+	for _, candidate := range execCandidates(command, s.workDir, s.env) {
+		resolved, fullPath, found := s.keep(candidate)
+		if !found {
+			continue
+		}
+
+		if s.executables[resolved] {
+			return
+		}
+		s.executables[resolved] = true
+
+		interpreter, args, err := fileInterpreter(fullPath)
+		if err != nil {
+			return
+		}
+
+		if interpreter == "" {
+			s.keepLibraries(resolved, fullPath)
+			return
+		}
+
+		s.keepExecutable(interpreter)
+		//'#!/usr/bin/env python3' runs the first argument from PATH
+		if path.Base(interpreter) == "env" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			s.keepExecutable(args[0])
+		}
+
+		return
+	}
+}
+
+// keepLibraries selects the dynamic loader and the shared libraries for the ELF file
+func (s *staticFiles) keepLibraries(imagePath, fullPath string) {
+	obj := s.check.object(imagePath, fullPath)
+	if obj == nil {
+		return
+	}
+
+	if obj.interpreter != "" {
+		s.keep(obj.interpreter)
+	}
+
+	libPaths, missing := s.check.closure(imagePath)
+	for _, libPath := range libPaths {
+		s.keep(libPath)
+	}
+
+	if len(missing) > 0 {
+		log.Debugf("StaticFiles: %v - missing libraries => %v", imagePath, missing)
+	}
+}
+
+// keepArgs selects the files in the command arguments
+// (and the commands in the shell form commands: '/bin/sh -c "exec nginx -g ..."')
+func (s *staticFiles) keepArgs(command []string) {
+	isShell := staticShells[path.Base(command[0])]
+	for idx, arg := range command[1:] {
+		if isShell && command[idx] == "-c" {
+			for _, segment := range strings.FieldsFunc(arg, isShellSeparator) {
+				fields := strings.Fields(segment)
+				for len(fields) > 0 && (fields[0] == "exec" || strings.Contains(fields[0], "=")) {
+					fields = fields[1:]
+				}
+
+				if len(fields) > 0 {
+					s.keepExecutable(fields[0])
+				}
+			}
+		}
+
+		for _, field := range strings.FieldsFunc(arg, isArgSeparator) {
+			filePath := field
+			if !path.IsAbs(filePath) {
+				if s.workDir == "" || strings.HasPrefix(filePath, "-") {
+					continue
+				}
+
+				filePath = path.Join(s.workDir, filePath)
+			}
+
+			if _, fullPath, found := s.keep(filePath); found {
+				if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+					s.keepExecutable(filePath)
+				}
+			}
+		}
+	}
+}
+
+func isShellSeparator(r rune) bool {
+	return r == ';' || r == '&' || r == '|' || r == '\n'
+}
+
+func isArgSeparator(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '=' || r == ';' || r == '&' || r == '|' || r == '"' || r == '\''
+}
+
+// WriteStaticLayer writes the layer tar with the selected image files (and their parent directories)
+// from the root directory (the file owners and modes are from the original image tar headers)
+func WriteStaticLayer(out io.Writer, root string, files []string, headers map[string]*tar.Header) error {
+	entries := map[string]*layerEntry{}
+	for _, filePath := range files {
+		for entryPath := filePath; entryPath != "/" && entryPath != "."; entryPath = path.Dir(entryPath) {
+			name := strings.TrimPrefix(entryPath, "/")
+			if _, found := entries[name]; found {
+				break
+			}
+
+			fullPath := filepath.Join(root, filepath.FromSlash(entryPath))
+			info, err := os.Lstat(fullPath)
+			if err != nil {
+				return err
+			}
+
+			entry := &layerEntry{fullPath: fullPath, info: info}
+			if hdr, found := headers[entryPath]; found {
+				entry.uid = hdr.Uid
+				entry.gid = hdr.Gid
+				entry.source = hdr
+			}
+
+			entries[name] = entry
+		}
+	}
+
+	return writeLayer(out, entries, time.Time{}, nil)
+}
@@ -0,0 +1,109 @@
+package builder
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the debug sections are removed with the host 'strip' tool ('strip --strip-debug'),
+//  so the symbol tables the applications and the debuggers use for the stack traces are kept
+//* the binaries without the debug sections are not changed (their digests stay the same,
+//  so they still match the base image and the shared layer files)
+//* the host 'strip' tool might not support the binaries for the other architectures
+//  (they are reported and left as is)
+
+// StripToolName is the name of the tool that removes the debug sections from the ELF binaries
+const StripToolName = "strip"
+
+// StripBinaries removes the debug sections from the ELF executables and shared objects
+// in the minified image files (except the files matching the exclude patterns)
+// and returns the stripped binaries.
+func (b *ImageBuilder) StripBinaries(artifactLocation string, excludePatterns []string) ([]*report.StrippedBinary, error) {
+	if !b.HasData {
+		return nil, nil
+	}
+
+	stripPath, err := exec.LookPath(StripToolName)
+	if err != nil {
+		return nil, fmt.Errorf("binary stripping needs the '%s' tool (binutils): %v", StripToolName, err)
+	}
+
+	dataDir := filepath.Join(artifactLocation, "files")
+	var stripped []*report.StrippedBinary
+	err = filepath.Walk(dataDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		filePath := "/" + strings.TrimPrefix(strings.TrimPrefix(fullPath, dataDir), "/")
+		for _, pattern := range excludePatterns {
+			if matchLayerPattern(pattern, filePath) {
+				return nil
+			}
+		}
+
+		if !hasDebugSections(fullPath) {
+			return nil
+		}
+
+		output, err := exec.Command(stripPath, "--strip-debug", "-p", fullPath).CombinedOutput()
+		if err != nil {
+			log.Warnf("StripBinaries: strip(%v) error - %v (%s)", filePath, err, strings.TrimSpace(string(output)))
+			return nil
+		}
+
+		//the setuid and setgid bits are not always preserved
+		if err := os.Chmod(fullPath, info.Mode()); err != nil {
+			return err
+		}
+
+		newInfo, err := os.Stat(fullPath)
+		if err != nil {
+			return err
+		}
+
+		stripped = append(stripped, &report.StrippedBinary{
+			FilePath: filePath,
+			Before:   info.Size(),
+			After:    newInfo.Size(),
+		})
+
+		return nil
+	})
+
+	return stripped, err
+}
+
+// hasDebugSections returns true if the file is an ELF executable or shared object with the debug sections
+func hasDebugSections(fullPath string) bool {
+	file, err := elf.Open(fullPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+		return false
+	}
+
+	for _, section := range file.Sections {
+		if strings.HasPrefix(section.Name, ".debug") || strings.HasPrefix(section.Name, ".zdebug") {
+			return true
+		}
+	}
+
+	return false
+}
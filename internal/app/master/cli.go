@@ -2,18 +2,33 @@ package app
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/builder"
 	"github.com/docker-slim/docker-slim/internal/app/master/commands"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockercontext"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/progress"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/system"
 	"github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/docker/go-units"
 )
 
 // DockerSlim app CLI constants
@@ -29,6 +44,9 @@ const (
 	CmdInfo    = "info"
 	CmdBuild   = "build"
 	CmdProfile = "profile"
+	CmdMerge   = "merge-profiles"
+	CmdShared  = "shared-layer"
+	CmdBatch   = "batch"
 )
 
 // DockerSlim app flag names
@@ -40,13 +58,31 @@ const (
 	FlagLogLevel            = "log-level"
 	FlagLog                 = "log"
 	FlagLogFormat           = "log-format"
+	FlagNoColor             = "no-color"
+	FlagPlain               = "plain"
 	FlagUseTLS              = "tls"
 	FlagVerifyTLS           = "tls-verify"
 	FlagTLSCertPath         = "tls-cert-path"
+	FlagTLSCACert           = "tls-ca-cert"
+	FlagTLSCert             = "tls-cert"
+	FlagTLSKey              = "tls-key"
+	FlagTLSServerName       = "tls-server-name"
 	FlagHost                = "host"
+	FlagUseContext          = "use-context"
+	FlagSSHIdentity         = "ssh-identity"
+	FlagDockerRetries       = "docker-retries"
+	FlagDockerRetryBackoff  = "docker-retry-backoff"
+	FlagRegistryMirror      = "registry-mirror"
+	FlagInsecureRegistry    = "insecure-registry"
 	FlagStatePath           = "state-path"
+	FlagStateDirNaming      = "state-dir-naming"
+	FlagTmpPath             = "tmp-path"
+	FlagHTTPProxy           = "http-proxy"
+	FlagHTTPSProxy          = "https-proxy"
+	FlagNoProxy             = "no-proxy"
 	FlagRemoveFileArtifacts = "remove-file-artifacts"
 	FlagCopyMetaArtifacts   = "copy-meta-artifacts"
+	FlagArchiveState        = "archive-state"
 	FlagHTTPProbe           = "http-probe"
 	FlagHTTPProbeCmd        = "http-probe-cmd"
 	FlagHTTPProbeCmdFile    = "http-probe-cmd-file"
@@ -54,18 +90,32 @@ const (
 	FlagHTTPProbeRetryWait  = "http-probe-retry-wait"
 	FlagHTTPProbePorts      = "http-probe-ports"
 	FlagHTTPProbeFull       = "http-probe-full"
-	FlagShowContainerLogs   = "show-clogs"
-	FlagShowBuildLogs       = "show-blogs"
+	FlagShowContainerLogs   = "show-container-logs"
+	FlagShowBuildLogs       = "show-build-logs"
 	FlagEntrypoint          = "entrypoint"
 	FlagCmd                 = "cmd"
+	FlagEntrypointForm      = "entrypoint-form"
+	FlagCmdForm             = "cmd-form"
 	FlagWorkdir             = "workdir"
 	FlagEnv                 = "env"
+	FlagUser                = "user"
 	FlagExpose              = "expose"
+	FlagPublish             = "publish"
 	FlagNewEntrypoint       = "new-entrypoint"
 	FlagNewCmd              = "new-cmd"
 	FlagNewExpose           = "new-expose"
 	FlagNewWorkdir          = "new-workdir"
 	FlagNewEnv              = "new-env"
+	FlagNewUser             = "new-user"
+	FlagNewStopSignal       = "new-stop-signal"
+	FlagNewShell            = "new-shell"
+	FlagNewOnBuild          = "new-onbuild"
+	FlagNewAuthor           = "new-author"
+	FlagNewComment          = "new-comment"
+	FlagNewCreated          = "new-created"
+	FlagKeepOnBuild         = "keep-onbuild"
+	FlagLabel               = "label"
+	FlagAnnotation          = "annotation"
 	FlagImageOverrides      = "image-overrides"
 	FlagExludeMounts        = "exclude-mounts"
 	FlagExcludePath         = "exclude-path"
@@ -74,15 +124,99 @@ const (
 	FlagIncludeBin          = "include-bin"
 	FlagIncludeExe          = "include-exe"
 	FlagIncludeShell        = "include-shell"
+	FlagIncludeZoneinfo     = "include-zoneinfo"
+	FlagIncludeLocale       = "include-locale"
+	FlagDetectSecrets       = "detect-secrets"
+	FlagExcludeSecrets      = "exclude-secrets"
 	FlagMount               = "mount"
+	FlagVolumesFrom         = "volumes-from"
 	FlagContinueAfter       = "continue-after"
 	FlagNetwork             = "network"
+	FlagIsolatedNetwork     = "isolated-network"
+	FlagIP                  = "ip"
+	FlagIP6                 = "ip6"
+	FlagNetworkAlias        = "network-alias"
+	FlagTargetContainer     = "target-container"
 	FlagLink                = "link"
 	FlagHostname            = "hostname"
+	FlagDomainname          = "domainname"
+	FlagIpc                 = "ipc"
+	FlagPid                 = "pid"
+	FlagCapAdd              = "cap-add"
+	FlagCapDrop             = "cap-drop"
+	FlagDevice              = "device"
+	FlagGPUs                = "gpus"
+	FlagMemory              = "memory"
+	FlagMemorySwap          = "memory-swap"
+	FlagCPUShares           = "cpu-shares"
+	FlagCPUs                = "cpus"
+	FlagPidsLimit           = "pids-limit"
+	FlagShmSize             = "shm-size"
+	FlagUlimit              = "ulimit"
+	FlagTmpfs               = "tmpfs"
+	FlagSysctl              = "sysctl"
+	FlagReadOnly            = "read-only"
+	FlagInteractive         = "interactive"
+	FlagStopSignal          = "stop-signal"
+	FlagStopTimeout         = "stop-timeout"
+	FlagStartRetries        = "start-retries"
+	FlagPrivileged          = "privileged"
+	FlagSecurityOpt         = "security-opt"
+	FlagSecretFile          = "secret-file"
+	FlagSecretEnv           = "secret-env"
 	FlagEtcHostsMap         = "etc-hosts-map"
 	FlagContainerDNS        = "container-dns"
 	FlagContainerDNSSearch  = "container-dns-search"
+	FlagContainerDNSOpt     = "container-dns-opt"
+	FlagContainerLabel      = "container-label"
 	FlagBuildFromDockerfile = "from-dockerfile"
+	FlagYes                 = "yes"
+	FlagDryRun              = "dry-run"
+	FlagExecTimeout         = "exec-timeout"
+	FlagSensorMountLocation = "sensor-mount-location"
+	FlagSensorMountOptions  = "sensor-mount-options"
+	FlagArtifactsTransfer   = "artifacts-transfer"
+	FlagSensorPath          = "sensor-path"
+	FlagSeccompBaseline     = "seccomp-baseline"
+	FlagSeccompMerge        = "seccomp-merge"
+	FlagSeccompArch         = "seccomp-arch"
+	FlagSeccompDefault      = "seccomp-default-action"
+	FlagSeccompErrno        = "seccomp-errno"
+	FlagSeccompAction       = "seccomp-action"
+	FlagTestProfiles        = "test-profiles"
+	FlagHardenFiles         = "harden-files"
+	FlagStripBinaries       = "strip-binaries"
+	FlagStripExclude        = "strip-exclude"
+	FlagArtifactHook        = "artifact-hook"
+	FlagIncludeNew          = "include-new"
+	FlagLoaderCheck         = "loader-check"
+	FlagCheckEntrypoint     = "check-entrypoint"
+	FlagReproducible        = "reproducible"
+	FlagLayerStrategy       = "layer-strategy"
+	FlagLayerRule           = "layer-rule"
+	FlagSlimBase            = "slim-base"
+	FlagSharedLayer         = "shared-layer"
+	FlagOCILayout           = "oci-layout"
+	FlagMinImages           = "min-images"
+	FlagGenPolicy           = "gen-policy"
+	FlagEmbedProfiles       = "embed-profiles"
+	FlagEmbedProfilesURL    = "embed-profiles-url"
+	FlagUseCache            = "use-cache"
+	FlagResume              = "resume"
+	FlagOutputDir           = "output-dir"
+	FlagProfileName         = "profile-name"
+	FlagAppArmorNetwork     = "apparmor-network"
+	FlagAppArmorCaps        = "apparmor-capabilities"
+	FlagAppArmorOwnerFiles  = "apparmor-owner-files"
+	FlagAppArmorComplain    = "apparmor-complain"
+	FlagPull                = "pull"
+	FlagPush                = "push"
+	FlagRegistryDirect      = "registry-direct"
+	FlagLayerCompression    = "layer-compression"
+	FlagEStargz             = "estargz"
+	FlagParallel            = "parallel"
+	FlagTargetFile          = "target-file"
+	FlagBuildFlags          = "build-flags"
 )
 
 var app *cli.App
@@ -92,6 +226,7 @@ func init() {
 	app.Version = version.Current()
 	app.Name = AppName
 	app.Usage = AppUsage
+	app.EnableBashCompletion = true
 	app.CommandNotFound = func(ctx *cli.Context, command string) {
 		fmt.Printf("unknown command - %v \n\n", command)
 		cli.ShowAppHelp(ctx)
@@ -129,6 +264,16 @@ func init() {
 			Value: "text",
 			Usage: "set the format used by logs ('text' (default), or 'json')",
 		},
+		cli.BoolFlag{
+			Name:   FlagNoColor,
+			Usage:  "disable colors in the progress output",
+			EnvVar: "DSLIM_NO_COLOR",
+		},
+		cli.BoolFlag{
+			Name:   FlagPlain,
+			Usage:  "show plain periodic status lines instead of progress spinners (default when the output is not a terminal)",
+			EnvVar: "DSLIM_PLAIN",
+		},
 		cli.BoolTFlag{
 			Name:  FlagUseTLS,
 			Usage: "use TLS",
@@ -142,19 +287,114 @@ func init() {
 			Value: "",
 			Usage: "path to TLS cert files",
 		},
+		cli.StringFlag{
+			Name:  FlagTLSCACert,
+			Value: "",
+			Usage: "CA certificate file to verify the Docker daemon certificate (default: ca.pem in the TLS cert path)",
+		},
+		cli.StringFlag{
+			Name:  FlagTLSCert,
+			Value: "",
+			Usage: "TLS client certificate file (default: cert.pem in the TLS cert path)",
+		},
+		cli.StringFlag{
+			Name:  FlagTLSKey,
+			Value: "",
+			Usage: "TLS client key file (default: key.pem in the TLS cert path)",
+		},
+		cli.StringFlag{
+			Name:  FlagTLSServerName,
+			Value: "",
+			Usage: "server name to verify the Docker daemon certificate (when it's different from the host name in the Docker host address)",
+		},
 		cli.StringFlag{
 			Name:  FlagHost,
 			Value: "",
 			Usage: "Docker host address",
 		},
 		cli.StringFlag{
-			Name:  FlagStatePath,
+			Name:   FlagUseContext,
+			Value:  "",
+			Usage:  "Docker CLI context to use for the Docker connection settings (see docker context ls)",
+			EnvVar: "DOCKER_CONTEXT",
+		},
+		cli.StringFlag{
+			Name:   FlagSSHIdentity,
+			Value:  "",
+			Usage:  "ssh private key file for the 'ssh://' Docker hosts (default: the ssh agent and the ssh client configuration)",
+			EnvVar: "DSLIM_SSH_IDENTITY",
+		},
+		cli.IntFlag{
+			Name:   FlagDockerRetries,
+			Value:  dockerclient.DefaultRetries,
+			Usage:  "number of retries for the Docker API calls that fail with transient errors (connection errors, timeouts and daemon server errors; 0 disables the retries)",
+			EnvVar: "DSLIM_DOCKER_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   FlagDockerRetryBackoff,
+			Value:  dockerclient.DefaultRetryBackoff,
+			Usage:  "delay before the first Docker API call retry (doubled for each retry)",
+			EnvVar: "DSLIM_DOCKER_RETRY_BACKOFF",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagRegistryMirror,
+			Value:  &cli.StringSlice{},
+			Usage:  "registry mirror to pull the Docker Hub images from (e.g., 'http://mirror.local:5000', the mirrors are tried in order before Docker Hub)",
+			EnvVar: "DSLIM_REGISTRY_MIRROR",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagInsecureRegistry,
+			Value:  &cli.StringSlice{},
+			Usage:  "registry that uses plain HTTP or an untrusted certificate (it must be an insecure registry in the Docker daemon configuration too)",
+			EnvVar: "DSLIM_INSECURE_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   FlagStatePath,
+			Value:  "",
+			Usage:  "DockerSlim state base path",
+			EnvVar: "DSLIM_STATE_PATH",
+		},
+		cli.StringFlag{
+			Name:   FlagStateDirNaming,
+			Value:  config.StateDirNameByID,
+			Usage:  "set the image state directory naming mode ('id' (default), 'tag', 'timestamp', 'tag-timestamp')",
+			EnvVar: "DSLIM_STATE_DIR_NAMING",
+		},
+		cli.StringFlag{
+			Name:   FlagTmpPath,
+			Value:  "",
+			Usage:  "DockerSlim temporary file path (build contexts, intermediate archives and other temporary files)",
+			EnvVar: "DSLIM_TMP_PATH",
+		},
+		cli.StringFlag{
+			Name:  FlagHTTPProxy,
+			Value: "",
+			Usage: "proxy for the http connections docker-slim makes itself (overrides HTTP_PROXY)",
+		},
+		cli.StringFlag{
+			Name:  FlagHTTPSProxy,
+			Value: "",
+			Usage: "proxy for the https connections docker-slim makes itself, e.g., the version check (overrides HTTPS_PROXY)",
+		},
+		cli.StringFlag{
+			Name:  FlagNoProxy,
 			Value: "",
-			Usage: "DockerSlim state base path",
+			Usage: "comma separated hosts, domains and networks to connect to without a proxy ('*' disables the proxies, overrides NO_PROXY)",
 		},
 	}
 
 	app.Before = func(ctx *cli.Context) error {
+		for _, name := range globalPathFlags {
+			if value := ctx.GlobalString(name); value != "" {
+				expanded, err := expandPath(value)
+				if err != nil {
+					log.Fatalf("bad %s %q (%v)", name, value, err)
+				}
+
+				ctx.GlobalSet(name, expanded)
+			}
+		}
+
 		if ctx.GlobalBool(FlagDebug) {
 			log.SetLevel(log.DebugLevel)
 		} else {
@@ -202,6 +442,38 @@ func init() {
 			log.Fatalf("unknown log-format %q", logFormat)
 		}
 
+		progress.Configure(ctx.GlobalBool(FlagPlain), ctx.GlobalBool(FlagNoColor))
+
+		stateDirNaming := ctx.GlobalString(FlagStateDirNaming)
+		switch stateDirNaming {
+		case config.StateDirNameByID,
+			config.StateDirNameByTag,
+			config.StateDirNameByTimestamp,
+			config.StateDirNameByTagTimestamp:
+		default:
+			log.Fatalf("unknown state-dir-naming %q", stateDirNaming)
+		}
+
+		if retries := ctx.GlobalInt(FlagDockerRetries); retries < 0 {
+			log.Fatalf("bad docker-retries %v (it can't be negative)", retries)
+		}
+
+		if backoff := ctx.GlobalDuration(FlagDockerRetryBackoff); backoff <= 0 {
+			log.Fatalf("bad docker-retry-backoff %v (it must be positive)", backoff)
+		}
+
+		if tmpPath := ctx.GlobalString(FlagTmpPath); tmpPath != "" {
+			if err := setTmpPath(tmpPath); err != nil {
+				log.Fatalf("bad tmp-path %q (%v)", tmpPath, err)
+			}
+		}
+
+		if err := setProxyEnv(ctx); err != nil {
+			log.Fatalf("bad proxy settings (%v)", err)
+		}
+
+		showDeprecatedFlags(os.Args[1:])
+
 		log.Debugf("sysinfo => %#v", system.GetSystemInfo())
 
 		return nil
@@ -219,6 +491,12 @@ func init() {
 		EnvVar: "DSLIM_CP_META_ARTIFACTS",
 	}
 
+	doArchiveStateFlag := cli.StringFlag{
+		Name:   FlagArchiveState,
+		Usage:  "save the per-run state directory (artifacts, reports, profiles) in a .tar.gz file at the selected location when command is done",
+		EnvVar: "DSLIM_ARCHIVE_STATE",
+	}
+
 	//true by default
 	doHTTPProbeFlag := cli.BoolTFlag{
 		Name:   FlagHTTPProbe,
@@ -247,10 +525,10 @@ func init() {
 		EnvVar: "DSLIM_HTTP_PROBE_RETRY_COUNT",
 	}
 
-	doHTTPProbeRetryWaitFlag := cli.IntFlag{
+	doHTTPProbeRetryWaitFlag := cli.StringFlag{
 		Name:   FlagHTTPProbeRetryWait,
-		Value:  8,
-		Usage:  "Number of seconds to wait before retrying HTTP probe (doubles when target is not ready)",
+		Value:  "8",
+		Usage:  "Time to wait before retrying HTTP probe as a number of seconds or a duration like '5s' (doubles when target is not ready)",
 		EnvVar: "DSLIM_HTTP_PROBE_RETRY_WAIT",
 	}
 
@@ -268,13 +546,13 @@ func init() {
 	}
 
 	doShowContainerLogsFlag := cli.BoolFlag{
-		Name:   FlagShowContainerLogs,
+		Name:   flagName(FlagShowContainerLogs),
 		Usage:  "Show container logs",
 		EnvVar: "DSLIM_SHOW_CLOGS",
 	}
 
 	doShowBuildLogsFlag := cli.BoolFlag{
-		Name:   FlagShowBuildLogs,
+		Name:   flagName(FlagShowBuildLogs),
 		Usage:  "Show build logs",
 		EnvVar: "DSLIM_SHOW_BLOGS",
 	}
@@ -314,6 +592,75 @@ func init() {
 		EnvVar: "DSLIM_NEW_ENV",
 	}
 
+	doUseNewUserFlag := cli.StringFlag{
+		Name:   FlagNewUser,
+		Value:  "",
+		Usage:  "New USER instruction for the minified image",
+		EnvVar: "DSLIM_NEW_USER",
+	}
+
+	doUseNewStopSignalFlag := cli.StringFlag{
+		Name:   FlagNewStopSignal,
+		Value:  "",
+		Usage:  "New STOPSIGNAL instruction for the minified image",
+		EnvVar: "DSLIM_NEW_STOP_SIGNAL",
+	}
+
+	doUseNewShellFlag := cli.StringFlag{
+		Name:   FlagNewShell,
+		Value:  "",
+		Usage:  "New SHELL instruction for the minified image",
+		EnvVar: "DSLIM_NEW_SHELL",
+	}
+
+	doUseNewOnBuildFlag := cli.StringSliceFlag{
+		Name:   FlagNewOnBuild,
+		Value:  &cli.StringSlice{},
+		Usage:  "New ONBUILD instructions for the minified image (e.g., 'COPY config.json /app/')",
+		EnvVar: "DSLIM_NEW_ONBUILD",
+	}
+
+	doUseNewAuthorFlag := cli.StringFlag{
+		Name:   FlagNewAuthor,
+		Value:  "",
+		Usage:  "New author for the minified image (the default author is 'docker-slim <version>')",
+		EnvVar: "DSLIM_NEW_AUTHOR",
+	}
+
+	doUseNewCommentFlag := cli.StringFlag{
+		Name:   FlagNewComment,
+		Value:  "",
+		Usage:  "New comment for the minified image",
+		EnvVar: "DSLIM_NEW_COMMENT",
+	}
+
+	doUseNewCreatedFlag := cli.StringFlag{
+		Name:   FlagNewCreated,
+		Value:  "",
+		Usage:  "New creation time for the minified image (an RFC 3339 timestamp or a number of seconds since the Unix epoch, e.g., '2021-06-01T12:00:00Z' or '1622548800')",
+		EnvVar: "DSLIM_NEW_CREATED",
+	}
+
+	doKeepOnBuildFlag := cli.BoolFlag{
+		Name:   FlagKeepOnBuild,
+		Usage:  "Keep the ONBUILD instructions from the source image in the minified image",
+		EnvVar: "DSLIM_KEEP_ONBUILD",
+	}
+
+	doUseLabelFlag := cli.StringSliceFlag{
+		Name:   FlagLabel,
+		Value:  &cli.StringSlice{},
+		Usage:  "New LABEL instructions for the minified image ('key=value')",
+		EnvVar: "DSLIM_NEW_LABEL",
+	}
+
+	doUseAnnotationFlag := cli.StringSliceFlag{
+		Name:   FlagAnnotation,
+		Value:  &cli.StringSlice{},
+		Usage:  "New OCI manifest annotations for the pushed minified image and the OCI layout image ('key=value', the image is pushed directly to the registry)",
+		EnvVar: "DSLIM_NEW_ANNOTATION",
+	}
+
 	doUseEntrypointFlag := cli.StringFlag{
 		Name:   FlagEntrypoint,
 		Value:  "",
@@ -328,6 +675,20 @@ func init() {
 		EnvVar: "DSLIM_TARGET_CMD",
 	}
 
+	doEntrypointFormFlag := cli.StringFlag{
+		Name:   FlagEntrypointForm,
+		Value:  config.CommandFormExec,
+		Usage:  "ENTRYPOINT form for the entrypoint flag values: exec (a JSON array or space separated arguments) or shell (a command string run with '/bin/sh -c' or the new shell)",
+		EnvVar: "DSLIM_ENTRYPOINT_FORM",
+	}
+
+	doCmdFormFlag := cli.StringFlag{
+		Name:   FlagCmdForm,
+		Value:  config.CommandFormExec,
+		Usage:  "CMD form for the cmd flag values: exec (a JSON array or space separated arguments) or shell (a command string run with '/bin/sh -c' or the new shell)",
+		EnvVar: "DSLIM_CMD_FORM",
+	}
+
 	doUseWorkdirFlag := cli.StringFlag{
 		Name:   FlagWorkdir,
 		Value:  "",
@@ -342,6 +703,13 @@ func init() {
 		EnvVar: "DSLIM_TARGET_ENV",
 	}
 
+	doUseUserFlag := cli.StringFlag{
+		Name:   FlagUser,
+		Value:  "",
+		Usage:  "Override USER analyzing image ('user', 'uid', 'user:group' or 'uid:gid')",
+		EnvVar: "DSLIM_TARGET_USER",
+	}
+
 	doUseLinkFlag := cli.StringSliceFlag{
 		Name:   FlagLink,
 		Value:  &cli.StringSlice{},
@@ -352,7 +720,7 @@ func init() {
 	doUseEtcHostsMapFlag := cli.StringSliceFlag{
 		Name:   FlagEtcHostsMap,
 		Value:  &cli.StringSlice{},
-		Usage:  "Add a host to IP mapping to /etc/hosts analyzing image",
+		Usage:  "Add a host to IP mapping to /etc/hosts analyzing image ('<host>:<ip>', the IP can be an IPv6 address, e.g., 'db:fd00::10')",
 		EnvVar: "DSLIM_TARGET_ETC_HOSTS_MAP",
 	}
 
@@ -370,6 +738,20 @@ func init() {
 		EnvVar: "DSLIM_TARGET_DNS_SEARCH",
 	}
 
+	doUseContainerDNSOptFlag := cli.StringSliceFlag{
+		Name:   FlagContainerDNSOpt,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a dns resolver option analyzing image (same as 'docker run --dns-opt', e.g., 'ndots:2')",
+		EnvVar: "DSLIM_TARGET_DNS_OPT",
+	}
+
+	doUseContainerLabelFlag := cli.StringSliceFlag{
+		Name:   FlagContainerLabel,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a label to the temporary containers docker-slim creates (not to the minified image) [zero or more]",
+		EnvVar: "DSLIM_CONTAINER_LABEL",
+	}
+
 	doUseHostnameFlag := cli.StringFlag{
 		Name:   FlagHostname,
 		Value:  "",
@@ -377,6 +759,178 @@ func init() {
 		EnvVar: "DSLIM_TARGET_HOSTNAME",
 	}
 
+	doUseDomainnameFlag := cli.StringFlag{
+		Name:   FlagDomainname,
+		Value:  "",
+		Usage:  "Override default container domain name analyzing image",
+		EnvVar: "DSLIM_TARGET_DOMAINNAME",
+	}
+
+	doIpcFlag := cli.StringFlag{
+		Name:   FlagIpc,
+		Value:  "",
+		Usage:  "IPC namespace mode for the container analyzing image ('none', 'private', 'shareable', 'host' or 'container:<name|id>')",
+		EnvVar: "DSLIM_TARGET_IPC",
+	}
+
+	doPidFlag := cli.StringFlag{
+		Name:   FlagPid,
+		Value:  "",
+		Usage:  "PID namespace mode for the container analyzing image ('host' or 'container:<name|id>')",
+		EnvVar: "DSLIM_TARGET_PID",
+	}
+
+	doCapAddFlag := cli.StringSliceFlag{
+		Name:   FlagCapAdd,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a Linux capability to the container analyzing image [zero or more]",
+		EnvVar: "DSLIM_TARGET_CAP_ADD",
+	}
+
+	doCapDropFlag := cli.StringSliceFlag{
+		Name:   FlagCapDrop,
+		Value:  &cli.StringSlice{},
+		Usage:  "Drop a Linux capability from the container analyzing image (the sensor capabilities are kept) [zero or more]",
+		EnvVar: "DSLIM_TARGET_CAP_DROP",
+	}
+
+	doDeviceFlag := cli.StringSliceFlag{
+		Name:   FlagDevice,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a host device to the container analyzing image ('host path[:container path][:permissions]') [zero or more]",
+		EnvVar: "DSLIM_TARGET_DEVICE",
+	}
+
+	doGPUsFlag := cli.StringFlag{
+		Name:   FlagGPUs,
+		Value:  "",
+		Usage:  "GPU devices to add to the container analyzing image ('all', a number or 'device=<ids>')",
+		EnvVar: "DSLIM_TARGET_GPUS",
+	}
+
+	doMemoryFlag := cli.StringFlag{
+		Name:   FlagMemory,
+		Value:  "",
+		Usage:  "Memory limit for the container analyzing image (e.g., 512m or 2g)",
+		EnvVar: "DSLIM_TARGET_MEMORY",
+	}
+
+	doMemorySwapFlag := cli.StringFlag{
+		Name:   FlagMemorySwap,
+		Value:  "",
+		Usage:  "Memory plus swap limit for the container analyzing image (-1 for unlimited swap)",
+		EnvVar: "DSLIM_TARGET_MEMORY_SWAP",
+	}
+
+	doCPUSharesFlag := cli.IntFlag{
+		Name:   FlagCPUShares,
+		Value:  0,
+		Usage:  "CPU shares (relative weight) for the container analyzing image",
+		EnvVar: "DSLIM_TARGET_CPU_SHARES",
+	}
+
+	doCPUsFlag := cli.StringFlag{
+		Name:   FlagCPUs,
+		Value:  "",
+		Usage:  "Number of CPUs for the container analyzing image (e.g., 1.5)",
+		EnvVar: "DSLIM_TARGET_CPUS",
+	}
+
+	doPidsLimitFlag := cli.IntFlag{
+		Name:   FlagPidsLimit,
+		Value:  0,
+		Usage:  "Process (pids) limit for the container analyzing image",
+		EnvVar: "DSLIM_TARGET_PIDS_LIMIT",
+	}
+
+	doShmSizeFlag := cli.StringFlag{
+		Name:   FlagShmSize,
+		Value:  "",
+		Usage:  "Size of /dev/shm for the container analyzing image (e.g., 256m or 1g)",
+		EnvVar: "DSLIM_TARGET_SHM_SIZE",
+	}
+
+	doTmpfsFlag := cli.StringSliceFlag{
+		Name:   FlagTmpfs,
+		Value:  &cli.StringSlice{},
+		Usage:  "Mount a tmpfs directory in the container analyzing image ('<path>[:<options>]', e.g., '/run:rw,size=64m,mode=1777') [zero or more]",
+		EnvVar: "DSLIM_TARGET_TMPFS",
+	}
+
+	doSysctlFlag := cli.StringSliceFlag{
+		Name:   FlagSysctl,
+		Value:  &cli.StringSlice{},
+		Usage:  "Set a namespaced kernel parameter in the container analyzing image ('<name>=<value>', e.g., 'net.core.somaxconn=1024') [zero or more]",
+		EnvVar: "DSLIM_TARGET_SYSCTL",
+	}
+
+	doPrivilegedFlag := cli.BoolFlag{
+		Name:   FlagPrivileged,
+		Usage:  "Run the container analyzing image in the privileged mode even with the capability overrides (NOT SAFE)",
+		EnvVar: "DSLIM_TARGET_PRIVILEGED",
+	}
+
+	doSecurityOptFlag := cli.StringSliceFlag{
+		Name:   FlagSecurityOpt,
+		Value:  &cli.StringSlice{},
+		Usage:  "Pass a security option to the container analyzing image (same as 'docker run --security-opt') [zero or more]",
+		EnvVar: "DSLIM_TARGET_SECURITY_OPT",
+	}
+
+	doReadOnlyFlag := cli.BoolFlag{
+		Name:   FlagReadOnly,
+		Usage:  "Run the container analyzing image with a read-only root filesystem (with writable tmpfs mounts for /tmp, /var/tmp and /run)",
+		EnvVar: "DSLIM_TARGET_READ_ONLY",
+	}
+
+	doInteractiveFlag := cli.BoolFlag{
+		Name:   FlagInteractive,
+		Usage:  "Attach the terminal to the container analyzing image (same as 'docker run -it'); detach with ctrl-p ctrl-q when you are done (requires the 'enter' continue-after mode)",
+		EnvVar: "DSLIM_TARGET_INTERACTIVE",
+	}
+
+	doStopSignalFlag := cli.StringFlag{
+		Name:   FlagStopSignal,
+		Value:  "",
+		Usage:  "Signal to stop the application in the container analyzing image when the monitoring is done (default: the image STOPSIGNAL or SIGTERM)",
+		EnvVar: "DSLIM_TARGET_STOP_SIGNAL",
+	}
+
+	doStopTimeoutFlag := cli.IntFlag{
+		Name:   FlagStopTimeout,
+		Value:  0,
+		Usage:  "Seconds to wait for the application to exit after the stop signal before it's killed (the shutdown activity is monitored too)",
+		EnvVar: "DSLIM_TARGET_STOP_TIMEOUT",
+	}
+
+	doStartRetriesFlag := cli.IntFlag{
+		Name:   FlagStartRetries,
+		Value:  2,
+		Usage:  "Number of times to retry the container analyzing image startup when it fails with the transient errors (the host ports or the container names are taken or the network is not ready)",
+		EnvVar: "DSLIM_TARGET_START_RETRIES",
+	}
+
+	doSecretFileFlag := cli.StringSliceFlag{
+		Name:   FlagSecretFile,
+		Value:  &cli.StringSlice{},
+		Usage:  "Mount a secret file (read-only) in the container analyzing image; it's never saved in the minified image ('<host path>:<container path>') [zero or more]",
+		EnvVar: "DSLIM_TARGET_SECRET_FILE",
+	}
+
+	doSecretEnvFlag := cli.StringSliceFlag{
+		Name:   FlagSecretEnv,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a secret env var to the container analyzing image; it's never added to the minified image ('<name>=<value>' or '<name>' to use the value from the docker-slim environment) [zero or more]",
+		EnvVar: "DSLIM_TARGET_SECRET_ENV",
+	}
+
+	doUlimitFlag := cli.StringSliceFlag{
+		Name:   FlagUlimit,
+		Value:  &cli.StringSlice{},
+		Usage:  "Ulimit for the container analyzing image ('<name>=<soft limit>[:<hard limit>]', e.g., 'nofile=65536') [zero or more]",
+		EnvVar: "DSLIM_TARGET_ULIMIT",
+	}
+
 	doUseNetworkFlag := cli.StringFlag{
 		Name:   FlagNetwork,
 		Value:  "",
@@ -384,6 +938,33 @@ func init() {
 		EnvVar: "DSLIM_TARGET_NET",
 	}
 
+	doIsolatedNetworkFlag := cli.BoolFlag{
+		Name:   FlagIsolatedNetwork,
+		Usage:  "Run the target container on a new bridge network (removed when the container inspection is done)",
+		EnvVar: "DSLIM_ISOLATED_NET",
+	}
+
+	doIPFlag := cli.StringFlag{
+		Name:   FlagIP,
+		Value:  "",
+		Usage:  "Static IPv4 address for the container analyzing image in the --network network (user-defined networks only)",
+		EnvVar: "DSLIM_TARGET_IP",
+	}
+
+	doIP6Flag := cli.StringFlag{
+		Name:   FlagIP6,
+		Value:  "",
+		Usage:  "Static IPv6 address for the container analyzing image in the --network network (user-defined networks only)",
+		EnvVar: "DSLIM_TARGET_IP6",
+	}
+
+	doNetworkAliasFlag := cli.StringSliceFlag{
+		Name:   FlagNetworkAlias,
+		Value:  &cli.StringSlice{},
+		Usage:  "Network-scoped alias for the container analyzing image in the --network network (user-defined networks only) [zero or more]",
+		EnvVar: "DSLIM_TARGET_NETWORK_ALIAS",
+	}
+
 	doUseExposeFlag := cli.StringSliceFlag{
 		Name:   FlagExpose,
 		Value:  &cli.StringSlice{},
@@ -391,6 +972,13 @@ func init() {
 		EnvVar: "DSLIM_TARGET_EXPOSE",
 	}
 
+	doPublishFlag := cli.StringSliceFlag{
+		Name:   FlagPublish,
+		Value:  &cli.StringSlice{},
+		Usage:  "Publish a container port on a specific host port analyzing image ('[<host ip>:]<host port>:<container port>[/<protocol>]') [zero or more]",
+		EnvVar: "DSLIM_TARGET_PUBLISH",
+	}
+
 	//true by default
 	doExcludeMountsFlag := cli.BoolTFlag{
 		Name:   FlagExludeMounts,
@@ -408,7 +996,7 @@ func init() {
 	doIncludePathFlag := cli.StringSliceFlag{
 		Name:   FlagIncludePath,
 		Value:  &cli.StringSlice{},
-		Usage:  "Include path from image",
+		Usage:  "Include path from image (use '<fat image path>:<slim image path>' to remap it)",
 		EnvVar: "DSLIM_INCLUDE_PATH",
 	}
 
@@ -439,96 +1027,387 @@ func init() {
 		EnvVar: "DSLIM_INCLUDE_SHELL",
 	}
 
+	doIncludeZoneinfoFlag := cli.BoolFlag{
+		Name:   FlagIncludeZoneinfo,
+		Usage:  "Include the timezone database (tzdata) and the local timezone configuration",
+		EnvVar: "DSLIM_INCLUDE_ZONEINFO",
+	}
+
+	doIncludeLocaleFlag := cli.StringFlag{
+		Name:   FlagIncludeLocale,
+		Value:  "",
+		Usage:  "Include the locale data for the comma separated list of locales (e.g., 'en_US.UTF-8,de_DE.UTF-8') for the image libc (glibc or musl)",
+		EnvVar: "DSLIM_INCLUDE_LOCALE",
+	}
+
+	doDetectSecretsFlag := cli.BoolFlag{
+		Name:   FlagDetectSecrets,
+		Usage:  "Scan the container filesystem for the likely secrets (e.g., AWS keys, private keys, npm tokens, .env files) and report them",
+		EnvVar: "DSLIM_DETECT_SECRETS",
+	}
+
+	doExcludeSecretsFlag := cli.BoolFlag{
+		Name:   FlagExcludeSecrets,
+		Usage:  "Exclude the detected secret files from the minified image (enables the secret detection)",
+		EnvVar: "DSLIM_EXCLUDE_SECRETS",
+	}
+
 	doUseMountFlag := cli.StringSliceFlag{
 		Name:   FlagMount,
 		Value:  &cli.StringSlice{},
-		Usage:  "Mount volume analyzing image",
+		Usage:  "Mount volume analyzing image ('<host path or volume name>:<container path>[:<options>]') [zero or more]",
 		EnvVar: "DSLIM_MOUNT",
 	}
 
+	doVolumesFromFlag := cli.StringSliceFlag{
+		Name:   FlagVolumesFrom,
+		Value:  &cli.StringSlice{},
+		Usage:  "Mount the volumes from another container analyzing image ('<container>[:ro|rw]') [zero or more]",
+		EnvVar: "DSLIM_VOLUMES_FROM",
+	}
+
 	doConfinueAfterFlag := cli.StringFlag{
 		Name:   FlagContinueAfter,
 		Value:  "probe",
-		Usage:  "Select continue mode: enter | signal | probe | timeout or numberInSeconds",
+		Usage:  "Select continue mode: enter | signal | probe | timeout | healthcheck[:numberOfHealthyChecks] or numberInSeconds",
 		EnvVar: "DSLIM_CONTINUE_AFTER",
 	}
 
-	//enable 'show-progress' by default only on Mac OS X
-	var doShowProgressFlag cli.Flag
-	switch runtime.GOOS {
-	case "darwin":
-		doShowProgressFlag = cli.BoolTFlag{
-			Name:   "show-progress",
-			Usage:  "show progress when the release package is downloaded (default: true)",
-			EnvVar: "DSLIM_UPDATE_SHOW_PROGRESS",
-		}
-	default:
-		doShowProgressFlag = cli.BoolFlag{
-			Name:   "show-progress",
-			Usage:  "show progress when the release package is downloaded (default: false)",
-			EnvVar: "DSLIM_UPDATE_SHOW_PROGRESS",
-		}
+	doSensorMountLocationFlag := cli.StringFlag{
+		Name:   FlagSensorMountLocation,
+		Value:  "",
+		Usage:  "Directory in the target container where the sensor and the artifacts volume are mounted (default: /opt/dockerslim)",
+		EnvVar: "DSLIM_SENSOR_MOUNT_LOCATION",
 	}
 
-	app.Commands = []cli.Command{
-		{
-			Name:    CmdVersion,
-			Aliases: []string{"v"},
-			Usage:   "Shows docker-slim and docker version information",
-			Action: func(ctx *cli.Context) error {
-				clientConfig := getDockerClientConfig(ctx)
-				commands.OnVersion(clientConfig)
-				return nil
-			},
-		},
-		{
-			Name:    CmdUpdate,
-			Aliases: []string{"u"},
-			Usage:   "Update docker-slim",
-			Flags: []cli.Flag{
-				doShowProgressFlag,
-			},
-			Action: func(ctx *cli.Context) error {
-				doDebug := ctx.GlobalBool(FlagDebug)
-				statePath := ctx.GlobalString(FlagStatePath)
-				doShowProgress := ctx.Bool("show-progress")
+	doSensorMountOptionsFlag := cli.StringFlag{
+		Name:   FlagSensorMountOptions,
+		Value:  "",
+		Usage:  "Extra bind mount options for the sensor and the artifacts volume (e.g., 'z' or 'Z' on SELinux hosts)",
+		EnvVar: "DSLIM_SENSOR_MOUNT_OPTIONS",
+	}
 
-				commands.OnUpdate(doDebug, statePath, doShowProgress)
-				return nil
-			},
-		},
-		{
-			Name:    CmdInfo,
-			Aliases: []string{"i"},
-			Usage:   "Collects fat image information and reverse engineers its Dockerfile",
-			Action: func(ctx *cli.Context) error {
-				if len(ctx.Args()) < 1 {
-					fmt.Printf("[info] missing image ID/name...\n\n")
-					cli.ShowCommandHelp(ctx, CmdInfo)
-					return nil
-				}
+	doArtifactsTransferFlag := cli.StringFlag{
+		Name:   FlagArtifactsTransfer,
+		Value:  config.ArtifactsTransferAuto,
+		Usage:  "Select how the sensor and the artifacts get in and out of the target container: auto | mount | copy",
+		EnvVar: "DSLIM_ARTIFACTS_TRANSFER",
+	}
 
-				doCheckVersion := ctx.GlobalBool(FlagCheckVersion)
+	doSensorPathFlag := cli.StringFlag{
+		Name:   FlagSensorPath,
+		Value:  "",
+		Usage:  "Sensor binary location on the Docker host (default: next to the docker-slim binary)",
+		EnvVar: "DSLIM_SENSOR_PATH",
+	}
 
-				statePath := ctx.GlobalString(FlagStatePath)
+	doSeccompBaselineFlag := cli.StringFlag{
+		Name:   FlagSeccompBaseline,
+		Value:  "",
+		Usage:  "Merge the generated seccomp profile with a baseline profile: docker-default | <seccomp profile file>",
+		EnvVar: "DSLIM_SECCOMP_BASELINE",
+	}
 
-				imageRef := ctx.Args().First()
-				clientConfig := getDockerClientConfig(ctx)
+	doSeccompMergeFlag := cli.StringFlag{
+		Name:   FlagSeccompMerge,
+		Value:  config.SeccompMergeUnion,
+		Usage:  "Select how the generated seccomp profile is merged with the baseline profile: union | intersection",
+		EnvVar: "DSLIM_SECCOMP_MERGE",
+	}
 
-				commands.OnInfo(
+	doSeccompArchFlag := cli.StringSliceFlag{
+		Name:   FlagSeccompArch,
+		Value:  &cli.StringSlice{},
+		Usage:  "Generate the seccomp profile for the target architecture (can be repeated): 386 | amd64 | armhf | arm64",
+		EnvVar: "DSLIM_SECCOMP_ARCH",
+	}
+
+	doSeccompDefaultFlag := cli.StringFlag{
+		Name:   FlagSeccompDefault,
+		Value:  config.SeccompActionErrno,
+		Usage:  "Select the action for the syscalls the generated seccomp profile doesn't allow: errno | kill | log (log only, for the profile rollouts) | trap",
+		EnvVar: "DSLIM_SECCOMP_DEFAULT_ACTION",
+	}
+
+	doSeccompErrnoFlag := cli.StringFlag{
+		Name:   FlagSeccompErrno,
+		Value:  "",
+		Usage:  "Select the error the denied syscalls return with the errno action: eperm | enosys | <errno number> (default: the runtime default, eperm)",
+		EnvVar: "DSLIM_SECCOMP_ERRNO",
+	}
+
+	doSeccompActionFlag := cli.StringSliceFlag{
+		Name:   FlagSeccompAction,
+		Value:  &cli.StringSlice{},
+		Usage:  "Override the action for a syscall in the generated seccomp profile (can be repeated): <syscall>=allow|errno|kill|log|trap",
+		EnvVar: "DSLIM_SECCOMP_ACTION",
+	}
+
+	doAppArmorNetworkFlag := cli.StringFlag{
+		Name:   FlagAppArmorNetwork,
+		Value:  config.AppArmorNetworkAll,
+		Usage:  "Select the network rules in the generated AppArmor profile: all | observed (based on the observed socket syscalls) | none",
+		EnvVar: "DSLIM_APPARMOR_NETWORK",
+	}
+
+	doAppArmorCapsFlag := cli.BoolFlag{
+		Name:   FlagAppArmorCaps,
+		Usage:  "Add the capability rules for the observed syscalls to the generated AppArmor profile",
+		EnvVar: "DSLIM_APPARMOR_CAPABILITIES",
+	}
+
+	doAppArmorOwnerFilesFlag := cli.BoolFlag{
+		Name:   FlagAppArmorOwnerFiles,
+		Usage:  "Allow the file writes in the generated AppArmor profile only for the files owned by the container user",
+		EnvVar: "DSLIM_APPARMOR_OWNER_FILES",
+	}
+
+	doAppArmorComplainFlag := cli.BoolFlag{
+		Name:   FlagAppArmorComplain,
+		Usage:  "Also generate the complain mode variant of the AppArmor profile (it logs the violations without blocking them)",
+		EnvVar: "DSLIM_APPARMOR_COMPLAIN",
+	}
+
+	doHardenFilesFlag := cli.BoolFlag{
+		Name:   FlagHardenFiles,
+		Usage:  "Harden the minified image files: remove the group/world writable bits, strip the unused setuid/setgid bits and make the non-root image user the owner of the application files",
+		EnvVar: "DSLIM_HARDEN_FILES",
+	}
+
+	doStripBinariesFlag := cli.BoolFlag{
+		Name:   FlagStripBinaries,
+		Usage:  "Remove the debug sections from the ELF executables and shared objects in the minified image (needs the 'strip' tool on the host)",
+		EnvVar: "DSLIM_STRIP_BINARIES",
+	}
+
+	doStripExcludeFlag := cli.StringSliceFlag{
+		Name:   FlagStripExclude,
+		Value:  &cli.StringSlice{},
+		Usage:  "Don't strip the binaries matching the path pattern (e.g., '/usr/lib/debug' or '/app/bin/*')",
+		EnvVar: "DSLIM_STRIP_EXCLUDE",
+	}
+
+	doArtifactHookFlag := cli.StringSliceFlag{
+		Name:   FlagArtifactHook,
+		Value:  &cli.StringSlice{},
+		Usage:  "Run the script against the artifacts before the minified image is built (it gets the minified image files directory as its argument)",
+		EnvVar: "DSLIM_ARTIFACT_HOOK",
+	}
+
+	doIncludeNewFlag := cli.StringSliceFlag{
+		Name:   FlagIncludeNew,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a host file or directory to the minified image even if it doesn't exist in the target image ('<host path>:<image path>')",
+		EnvVar: "DSLIM_INCLUDE_NEW",
+	}
+
+	doLoaderCheckFlag := cli.StringFlag{
+		Name:   FlagLoaderCheck,
+		Value:  config.LoaderCheckWarn,
+		Usage:  "Check that the minified image executables have their dynamic loader and shared libraries: off | warn | fail (don't build the image) | include (copy the missing files from the target image)",
+		EnvVar: "DSLIM_LOADER_CHECK",
+	}
+
+	//true by default
+	doCheckEntrypointFlag := cli.BoolTFlag{
+		Name:   FlagCheckEntrypoint,
+		Usage:  "Check that the minified image entrypoint (or cmd) executable and its interpreter are in the minified image files before it's built",
+		EnvVar: "DSLIM_CHECK_ENTRYPOINT",
+	}
+
+	doReproducibleFlag := cli.BoolFlag{
+		Name:   FlagReproducible,
+		Usage:  "Build a reproducible minified image (sorted layer entries, normalized file timestamps and the image creation time pinned to SOURCE_DATE_EPOCH or the source image creation time)",
+		EnvVar: "DSLIM_REPRODUCIBLE",
+	}
+
+	doLayerStrategyFlag := cli.StringFlag{
+		Name:   FlagLayerStrategy,
+		Value:  config.LayerStrategySingle,
+		Usage:  "Select the minified image layer strategy: single (one layer with all files) | split (separate OS, language runtime and application layers) | reuse-base (split layers on top of the original base image layers if the base image is already minimal)",
+		EnvVar: "DSLIM_LAYER_STRATEGY",
+	}
+
+	doLayerRuleFlag := cli.StringSliceFlag{
+		Name:   FlagLayerRule,
+		Value:  &cli.StringSlice{},
+		Usage:  "Put the files matching the path pattern into a separate layer ('<layer>:<path pattern>', implies the split layer strategy)",
+		EnvVar: "DSLIM_LAYER_RULE",
+	}
+
+	doSlimBaseFlag := cli.StringFlag{
+		Name:   FlagSlimBase,
+		Value:  "",
+		Usage:  "Build the minified image from a base image instead of scratch (e.g., gcr.io/distroless/static or alpine; the files the base image already has are not copied)",
+		EnvVar: "DSLIM_SLIM_BASE",
+	}
+
+	doSharedLayerFlag := cli.StringFlag{
+		Name:   FlagSharedLayer,
+		Value:  "",
+		Usage:  "Build the minified image on the shared layer created with the 'shared-layer' command (the files the shared layer has are not copied)",
+		EnvVar: "DSLIM_SHARED_LAYER",
+	}
+
+	doOCILayoutFlag := cli.StringFlag{
+		Name:   FlagOCILayout,
+		Value:  "",
+		Usage:  "Assemble the minified image in the OCI image layout directory without the Docker build API (the image is not loaded into Docker)",
+		EnvVar: "DSLIM_OCI_LAYOUT",
+	}
+
+	doGenPolicyFlag := cli.BoolFlag{
+		Name:   FlagGenPolicy,
+		Usage:  "Generate a Rego policy and a Gatekeeper constraint template for the minified image properties",
+		EnvVar: "DSLIM_GEN_POLICY",
+	}
+
+	doEmbedProfilesFlag := cli.StringFlag{
+		Name:   FlagEmbedProfiles,
+		Value:  config.EmbedProfilesNone,
+		Usage:  "Reference the generated security profiles in the minified image labels: none | digest (the profile names and digests) | full (the seccomp profile too)",
+		EnvVar: "DSLIM_EMBED_PROFILES",
+	}
+
+	doEmbedProfilesURLFlag := cli.StringFlag{
+		Name:   FlagEmbedProfilesURL,
+		Value:  "",
+		Usage:  "Base URL for the security profile retrieval labels (where you publish the generated profiles)",
+		EnvVar: "DSLIM_EMBED_PROFILES_URL",
+	}
+
+	doUseCacheFlag := cli.BoolFlag{
+		Name:   FlagUseCache,
+		Usage:  "Reuse the cached container monitoring results if the target image and the monitoring options didn't change (the container is not started)",
+		EnvVar: "DSLIM_USE_CACHE",
+	}
+
+	doResumeFlag := cli.BoolFlag{
+		Name:   FlagResume,
+		Usage:  "Resume the failed or interrupted build from its last completed phase (the container is not started again if the target image and the monitoring options didn't change)",
+		EnvVar: "DSLIM_RESUME",
+	}
+
+	doTestProfilesFlag := cli.BoolFlag{
+		Name:   FlagTestProfiles,
+		Usage:  "Run the minified image with the generated seccomp and AppArmor profiles and report the denials",
+		EnvVar: "DSLIM_TEST_PROFILES",
+	}
+
+	doDryRunFlag := cli.BoolFlag{
+		Name:   FlagDryRun,
+		Usage:  "Inspect the target image and show the instrumented container creation request without running it",
+		EnvVar: "DSLIM_DRY_RUN",
+	}
+
+	doExecTimeoutFlag := cli.StringFlag{
+		Name:   FlagExecTimeout,
+		Value:  "",
+		Usage:  "Maximum command execution time as a number of seconds or a duration like '30m' (the containers are removed and the command exits when it's reached)",
+		EnvVar: "DSLIM_EXEC_TIMEOUT",
+	}
+
+	doPullFlag := cli.BoolFlag{
+		Name:   FlagPull,
+		Usage:  "Pull the target image if it's not available locally",
+		EnvVar: "DSLIM_PULL",
+	}
+
+	doAutoConfirmFlag := cli.BoolFlag{
+		Name:   FlagYes,
+		Usage:  "Don't ask for confirmation when the configuration might produce a broken image",
+		EnvVar: "DSLIM_YES",
+	}
+
+	//enable 'show-progress' by default only on Mac OS X
+	var doShowProgressFlag cli.Flag
+	switch runtime.GOOS {
+	case "darwin":
+		doShowProgressFlag = cli.BoolTFlag{
+			Name:   "show-progress",
+			Usage:  "show progress when the release package is downloaded (default: true)",
+			EnvVar: "DSLIM_UPDATE_SHOW_PROGRESS",
+		}
+	default:
+		doShowProgressFlag = cli.BoolFlag{
+			Name:   "show-progress",
+			Usage:  "show progress when the release package is downloaded (default: false)",
+			EnvVar: "DSLIM_UPDATE_SHOW_PROGRESS",
+		}
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:    CmdVersion,
+			Aliases: []string{"v"},
+			Usage:   "Shows docker-slim and docker version information",
+			Action: func(ctx *cli.Context) error {
+				clientConfig := getDockerClientConfig(ctx)
+				commands.OnVersion(clientConfig)
+				return nil
+			},
+		},
+		{
+			Name:    CmdUpdate,
+			Aliases: []string{"u"},
+			Usage:   "Update docker-slim",
+			Flags: []cli.Flag{
+				doShowProgressFlag,
+			},
+			Action: func(ctx *cli.Context) error {
+				doDebug := ctx.GlobalBool(FlagDebug)
+				statePath := ctx.GlobalString(FlagStatePath)
+				doShowProgress := ctx.Bool("show-progress")
+
+				commands.OnUpdate(doDebug, statePath, doShowProgress)
+				return nil
+			},
+		},
+		{
+			Name:         CmdInfo,
+			Aliases:      []string{"i"},
+			Usage:        "Collects fat image information and reverse engineers its Dockerfile",
+			BashComplete: completeImageCommand,
+			Flags: []cli.Flag{
+				doPullFlag,
+				cli.BoolFlag{
+					Name:   FlagRegistryDirect,
+					Usage:  "Fetch the target image directly from its registry without a Docker daemon (with --pull the image layers are downloaded too)",
+					EnvVar: "DSLIM_REGISTRY_DIRECT",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[info] missing image ID/name...\n\n")
+					cli.ShowCommandHelp(ctx, CmdInfo)
+					return nil
+				}
+
+				doCheckVersion := ctx.GlobalBool(FlagCheckVersion)
+
+				statePath := ctx.GlobalString(FlagStatePath)
+
+				imageRef := ctx.Args().First()
+				clientConfig := getDockerClientConfig(ctx)
+				registryAccess := getRegistryAccess(ctx)
+
+				commands.OnInfo(
 					doCheckVersion,
 					ctx.GlobalString(FlagCommandReport),
 					ctx.GlobalBool(FlagDebug),
 					statePath,
+					ctx.GlobalString(FlagStateDirNaming),
 					clientConfig,
+					registryAccess,
 					imageRef)
 				return nil
 			},
 		},
 		{
-			Name:    CmdBuild,
-			Aliases: []string{"b"},
-			Usage:   "Collects fat image information and builds a slim image from it",
+			Name:         CmdBuild,
+			Aliases:      []string{"b"},
+			Usage:        "Collects fat image information and builds a slim image from it",
+			BashComplete: completeImageCommand,
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:   FlagBuildFromDockerfile,
@@ -546,6 +1425,7 @@ func init() {
 				doShowContainerLogsFlag,
 				doShowBuildLogsFlag,
 				doCopyMetaArtifactsFlag,
+				doArchiveStateFlag,
 				doRemoveFileArtifactsFlag,
 				cli.StringFlag{
 					Name:   "tag",
@@ -561,20 +1441,65 @@ func init() {
 				},
 				doUseEntrypointFlag,
 				doUseCmdFlag,
+				doEntrypointFormFlag,
+				doCmdFormFlag,
 				doUseWorkdirFlag,
 				doUseEnvFlag,
+				doUseUserFlag,
 				doUseLinkFlag,
 				doUseEtcHostsMapFlag,
 				doUseContainerDNSFlag,
 				doUseContainerDNSSearchFlag,
+				doUseContainerDNSOptFlag,
+				doUseContainerLabelFlag,
 				doUseNetworkFlag,
+				doIsolatedNetworkFlag,
+				doIPFlag,
+				doIP6Flag,
+				doNetworkAliasFlag,
 				doUseHostnameFlag,
+				doUseDomainnameFlag,
+				doIpcFlag,
+				doPidFlag,
+				doCapAddFlag,
+				doCapDropFlag,
+				doDeviceFlag,
+				doGPUsFlag,
+				doMemoryFlag,
+				doMemorySwapFlag,
+				doCPUSharesFlag,
+				doCPUsFlag,
+				doPidsLimitFlag,
+				doShmSizeFlag,
+				doUlimitFlag,
+				doTmpfsFlag,
+				doSysctlFlag,
+				doReadOnlyFlag,
+				doInteractiveFlag,
+				doStopSignalFlag,
+				doStopTimeoutFlag,
+				doStartRetriesFlag,
+				doPrivilegedFlag,
+				doSecurityOptFlag,
+				doSecretFileFlag,
+				doSecretEnvFlag,
 				doUseExposeFlag,
+				doPublishFlag,
 				doUseNewEntrypointFlag,
 				doUseNewCmdFlag,
 				doUseNewExposeFlag,
 				doUseNewWorkdirFlag,
 				doUseNewEnvFlag,
+				doUseNewUserFlag,
+				doUseNewStopSignalFlag,
+				doUseNewShellFlag,
+				doUseNewOnBuildFlag,
+				doUseNewAuthorFlag,
+				doUseNewCommentFlag,
+				doUseNewCreatedFlag,
+				doKeepOnBuildFlag,
+				doUseLabelFlag,
+				doUseAnnotationFlag,
 				doExcludeMountsFlag,
 				doExcludePathFlag,
 				doIncludePathFlag,
@@ -582,22 +1507,96 @@ func init() {
 				doIncludeBinFlag,
 				doIncludeExeFlag,
 				doIncludeShellFlag,
+				doIncludeZoneinfoFlag,
+				doIncludeLocaleFlag,
+				doDetectSecretsFlag,
+				doExcludeSecretsFlag,
 				doUseMountFlag,
+				doVolumesFromFlag,
 				doConfinueAfterFlag,
+				doSensorMountLocationFlag,
+				doSensorMountOptionsFlag,
+				doArtifactsTransferFlag,
+				doSensorPathFlag,
+				doSeccompBaselineFlag,
+				doSeccompMergeFlag,
+				doSeccompArchFlag,
+				doSeccompDefaultFlag,
+				doSeccompErrnoFlag,
+				doSeccompActionFlag,
+				doAppArmorNetworkFlag,
+				doAppArmorCapsFlag,
+				doAppArmorOwnerFilesFlag,
+				doAppArmorComplainFlag,
+				doTestProfilesFlag,
+				doGenPolicyFlag,
+				doHardenFilesFlag,
+				doStripBinariesFlag,
+				doStripExcludeFlag,
+				doArtifactHookFlag,
+				doIncludeNewFlag,
+				doLoaderCheckFlag,
+				doCheckEntrypointFlag,
+				doReproducibleFlag,
+				doLayerStrategyFlag,
+				doLayerRuleFlag,
+				doSlimBaseFlag,
+				doSharedLayerFlag,
+				doOCILayoutFlag,
+				doEmbedProfilesFlag,
+				doEmbedProfilesURLFlag,
+				doUseCacheFlag,
+				doResumeFlag,
+				doDryRunFlag,
+				doExecTimeoutFlag,
+				doPullFlag,
+				cli.StringFlag{
+					Name:   FlagTargetContainer,
+					Value:  "",
+					Usage:  "Monitor the already running container (name or ID) and minify its image instead of starting a new container",
+					EnvVar: "DSLIM_TARGET_CONTAINER",
+				},
+				cli.BoolFlag{
+					Name:   FlagPush,
+					Usage:  "Push the minified image to its registry (use --tag to select the registry and the repository)",
+					EnvVar: "DSLIM_PUSH",
+				},
+				cli.StringFlag{
+					Name:   FlagLayerCompression,
+					Value:  registry.LayerCompressionGzip,
+					Usage:  "Layer compression for the pushed minified image and the OCI layout image: gzip | zstd (the zstd layers are pushed directly to the registry)",
+					EnvVar: "DSLIM_LAYER_COMPRESSION",
+				},
+				cli.BoolFlag{
+					Name:   FlagEStargz,
+					Usage:  "Push the minified image with the eStargz layers (lazy pulling) directly to the registry (or use them in the OCI layout image)",
+					EnvVar: "DSLIM_ESTARGZ",
+				},
+				cli.BoolFlag{
+					Name:   FlagRegistryDirect,
+					Usage:  "Fetch the target image directly from its registry and build the minified OCI layout image without a Docker daemon (the image is not running, so the files are selected statically)",
+					EnvVar: "DSLIM_REGISTRY_DIRECT",
+				},
+				doAutoConfirmFlag,
 			},
 			Action: func(ctx *cli.Context) error {
-				if len(ctx.Args()) < 1 {
+				targetContainer := ctx.String(FlagTargetContainer)
+				if len(ctx.Args()) < 1 && targetContainer == "" {
 					fmt.Printf("[build] missing image ID/name...\n\n")
 					cli.ShowCommandHelp(ctx, CmdBuild)
 					return nil
 				}
 
+				var paramErrs paramErrors
+				expandPathFlags(ctx, &paramErrs, commandPathFlags...)
+
 				doCheckVersion := ctx.GlobalBool(FlagCheckVersion)
 
 				statePath := ctx.GlobalString(FlagStatePath)
 
 				imageRef := ctx.Args().First()
 				clientConfig := getDockerClientConfig(ctx)
+				registryAccess := getRegistryAccess(ctx)
 
 				doRmFileArtifacts := ctx.Bool(FlagRemoveFileArtifacts)
 				doCopyMetaArtifacts := ctx.String(FlagCopyMetaArtifacts)
@@ -606,15 +1605,21 @@ func init() {
 
 				doHTTPProbe := ctx.Bool(FlagHTTPProbe)
 
-				httpProbeCmds, err := getHTTPProbes(ctx)
+				httpProbeCmds, err := parseHTTPProbes(ctx.StringSlice(FlagHTTPProbeCmd))
 				if err != nil {
-					fmt.Printf("[build] invalid HTTP probes: %v\n", err)
-					return err
+					paramErrs.add(FlagHTTPProbeCmd, err, paramHintHTTPProbeCmd)
+				}
+
+				moreHTTPProbeCmds, err := parseHTTPProbesFile(ctx.String(FlagHTTPProbeCmdFile))
+				if err != nil {
+					paramErrs.add(FlagHTTPProbeCmdFile, err, paramHintHTTPProbeFile)
+				} else {
+					httpProbeCmds = append(httpProbeCmds, moreHTTPProbeCmds...)
 				}
 
 				if doHTTPProbe {
 					//add default probe cmd if the "http-probe" flag is set
-					fmt.Println("docker-slim[build]: info=http.probe message='using default probe'")
+					status.New("build").Info(status.IDProbeDefault, "http.probe", "message='using default probe'")
 					httpProbeCmds = append(httpProbeCmds,
 						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/"})
 				}
@@ -624,11 +1629,13 @@ func init() {
 				}
 
 				httpProbeRetryCount := ctx.Int(FlagHTTPProbeRetryCount)
-				httpProbeRetryWait := ctx.Int(FlagHTTPProbeRetryWait)
+				httpProbeRetryWait, err := parseWaitTime(ctx.String(FlagHTTPProbeRetryWait))
+				if err != nil {
+					paramErrs.add(FlagHTTPProbeRetryWait, err, paramHintWaitTime)
+				}
 				httpProbePorts, err := parseHTTPProbesPorts(ctx.String(FlagHTTPProbePorts))
 				if err != nil {
-					fmt.Printf("[build] invalid HTTP Probe target ports: %v\n", err)
-					return err
+					paramErrs.add(FlagHTTPProbePorts, err, paramHintHTTPProbePorts)
 				}
 
 				doHTTPProbeFull := ctx.Bool(FlagHTTPProbeFull)
@@ -638,68 +1645,255 @@ func init() {
 				doTag := ctx.String("tag")
 
 				doImageOverrides := ctx.String(FlagImageOverrides)
+				if err := validateImageTag(doTag); err != nil {
+					paramErrs.add("tag", err, paramHintImageTag)
+				}
+
 				overrides, err := getContainerOverrides(ctx)
 				if err != nil {
-					fmt.Printf("[build] invalid container overrides: %v\n", err)
-					return err
+					paramErrs.add("container overrides", err, paramHintExec+" / "+paramHintExpose)
+				}
+
+				etcHostsMaps, err := parseEtcHostsMaps(ctx.StringSlice(FlagEtcHostsMap))
+				if err != nil {
+					paramErrs.add(FlagEtcHostsMap, err, paramHintEtcHostsMap)
 				}
 
 				instructions, err := getImageInstructions(ctx)
 				if err != nil {
-					fmt.Printf("[build] invalid image instructions: %v\n", err)
-					return err
+					paramErrs.add("new image instructions", err, paramHintExec+" / "+paramHintExpose+" / "+paramHintLabel+" / "+paramHintCreated)
 				}
 
 				volumeMounts, err := parseVolumeMounts(ctx.StringSlice(FlagMount))
 				if err != nil {
-					fmt.Printf("[build] invalid volume mounts: %v\n", err)
-					return err
+					paramErrs.add(FlagMount, err, paramHintMount)
 				}
 
 				excludePaths := parsePaths(ctx.StringSlice(FlagExcludePath))
 
-				includePaths := parsePaths(ctx.StringSlice(FlagIncludePath))
-				moreIncludePaths, err := parsePathsFile(ctx.String(FlagIncludePathFile))
+				includePaths, includePathMaps, err := getIncludePaths(ctx)
 				if err != nil {
-					fmt.Printf("[build] could not read include path file (ignoring): %v\n", err)
-				} else {
-					for k, v := range moreIncludePaths {
-						includePaths[k] = v
-					}
+					paramErrs.add(FlagIncludePath, err, paramHintIncludePath)
 				}
 
 				includeBins := parsePaths(ctx.StringSlice(FlagIncludeBin))
 				includeExes := parsePaths(ctx.StringSlice(FlagIncludeExe))
 				doIncludeShell := ctx.Bool(FlagIncludeShell)
+				doIncludeZoneinfo := ctx.Bool(FlagIncludeZoneinfo)
+				includeLocales, err := parseLocales(ctx.String(FlagIncludeLocale))
+				if err != nil {
+					paramErrs.add(FlagIncludeLocale, err, paramHintIncludeLocale)
+				}
+				doExcludeSecrets := ctx.Bool(FlagExcludeSecrets)
+				doDetectSecrets := ctx.Bool(FlagDetectSecrets) || doExcludeSecrets
 
 				doExcludeMounts := ctx.BoolT(FlagExludeMounts)
 				if doExcludeMounts {
-					for mpath := range volumeMounts {
-						excludePaths[mpath] = true
+					for _, volumeMount := range volumeMounts {
+						excludePaths[volumeMount.Destination] = true
 					}
 				}
 
 				confinueAfter, err := getContinueAfter(ctx)
 				if err != nil {
-					fmt.Printf("[build] invalid continue-after mode: %v\n", err)
-					return err
+					paramErrs.add(FlagContinueAfter, err, paramHintContinueAfter)
+				}
+
+				sensorMount, err := getSensorMount(ctx)
+				if err != nil {
+					paramErrs.add(FlagSensorMountLocation, err, paramHintSensorMount)
+				}
+
+				seccompBaseline, err := getSeccompBaseline(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompBaseline, err, paramHintSeccompBaseline)
+				}
+
+				seccompOptions, err := getSeccompOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompDefault, err, paramHintSeccompOptions)
+				}
+
+				appArmorOptions, err := getAppArmorOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagAppArmorNetwork, err, paramHintAppArmorNetwork)
+				}
+
+				embedProfiles, err := getEmbedProfiles(ctx)
+				if err != nil {
+					paramErrs.add(FlagEmbedProfiles, err, paramHintEmbedProfiles)
+				}
+
+				layerStrategy, err := getLayerStrategy(ctx)
+				if err != nil {
+					paramErrs.add(FlagLayerRule, err, paramHintLayerRule)
+				}
+
+				stripExclude, err := getStripExclude(ctx)
+				if err != nil {
+					paramErrs.add(FlagStripBinaries, err, paramHintStripBinaries)
+				}
+
+				artifactHooks, err := getArtifactHooks(ctx)
+				if err != nil {
+					paramErrs.add(FlagArtifactHook, err, paramHintArtifactHook)
+				}
+
+				includeNew, err := getIncludeNew(ctx)
+				if err != nil {
+					paramErrs.add(FlagIncludeNew, err, paramHintIncludeNew)
+				}
+
+				loaderCheck := ctx.String(FlagLoaderCheck)
+				switch loaderCheck {
+				case config.LoaderCheckOff, config.LoaderCheckWarn, config.LoaderCheckFail, config.LoaderCheckInclude:
+				default:
+					paramErrs.addf(FlagLoaderCheck, paramHintLoaderCheck, "unsupported loader check mode: %s", loaderCheck)
+				}
+
+				var ociLayout string
+				if location := strings.TrimSpace(ctx.String(FlagOCILayout)); location != "" {
+					ociLayout, err = filepath.Abs(location)
+					if err != nil {
+						paramErrs.add(FlagOCILayout, err, paramHintOCILayout)
+					} else if info, err := os.Stat(ociLayout); err == nil && !info.IsDir() {
+						paramErrs.addf(FlagOCILayout, paramHintOCILayout, "not a directory: %s", location)
+					}
+
+					if ctx.Bool(FlagTestProfiles) {
+						paramErrs.addf(FlagOCILayout, paramHintOCILayout,
+							"the security profiles are tested with the minified image in Docker")
+					}
+				}
+
+				slimBase := strings.TrimSpace(ctx.String(FlagSlimBase))
+				if slimBase != "" && ctx.Bool(FlagReproducible) {
+					paramErrs.addf(FlagSlimBase, paramHintSlimBase,
+						"the reproducible minified image is always built from scratch")
+				}
+
+				if slimBase != "" && ociLayout != "" {
+					paramErrs.addf(FlagSlimBase, paramHintSlimBase,
+						"the OCI layout minified image is always built from scratch")
+				}
+
+				var sharedLayer string
+				if location := strings.TrimSpace(ctx.String(FlagSharedLayer)); location != "" {
+					sharedLayer, err = filepath.Abs(location)
+					if err != nil {
+						paramErrs.add(FlagSharedLayer, err, paramHintSharedLayer)
+					} else if _, err := os.Stat(filepath.Join(sharedLayer, builder.SharedLayerManifestFileName)); err != nil {
+						paramErrs.addf(FlagSharedLayer, paramHintSharedLayer, "no shared layer in %s", location)
+					}
+
+					if slimBase != "" {
+						paramErrs.addf(FlagSharedLayer, paramHintSharedLayer, "the minified image can't have a base image and a shared layer")
+					}
+				}
+
+				if layerStrategy != nil && layerStrategy.Mode == config.LayerStrategyReuseBase &&
+					(slimBase != "" || sharedLayer != "" || ociLayout != "" || ctx.Bool(FlagReproducible)) {
+					paramErrs.addf(FlagLayerStrategy, paramHintReuseBase,
+						"the reused base image layers can't be combined with the other minified image bases and the images built from scratch")
+				}
+
+				//the direct registry build always creates an OCI layout image
+				if err := setLayerFormat(ctx, registryAccess, ociLayout != "" || registryAccess.Direct); err != nil {
+					paramErrs.add(FlagLayerCompression, err, paramHintLayerFormat)
+				}
+
+				if err := setAnnotations(ctx, registryAccess, ociLayout != "" || registryAccess.Direct); err != nil {
+					paramErrs.add(FlagAnnotation, err, paramHintAnnotation)
+				}
+
+				if registryAccess.Direct &&
+					(buildFromDockerfile != "" ||
+						targetContainer != "" ||
+						slimBase != "" ||
+						sharedLayer != "" ||
+						len(includePathMaps) > 0 ||
+						ctx.Bool(FlagTestProfiles) ||
+						ctx.Bool(FlagUseCache)) {
+					paramErrs.addf(FlagRegistryDirect, paramHintRegistryDirect,
+						"the direct registry build doesn't run the target image in a container")
+				}
+
+				var execTimeout time.Duration
+				if value := ctx.String(FlagExecTimeout); value != "" {
+					execTimeout, err = parseWaitTime(value)
+					if err != nil {
+						paramErrs.add(FlagExecTimeout, err, paramHintWaitTime)
+					}
 				}
 
-				for ipath := range includePaths {
-					if excludePaths[ipath] {
-						fmt.Printf("[build] include and exclude path conflict: %v\n", err)
-						return nil
+				paramErrs.addConflicts(doHTTPProbe,
+					confinueAfter,
+					httpProbePorts,
+					overrides,
+					ctx.Bool(FlagIsolatedNetwork),
+					includePaths,
+					excludePaths)
+
+				if targetContainer != "" {
+					if imageRef != "" || buildFromDockerfile != "" {
+						paramErrs.addf(FlagTargetContainer, paramHintTargetContainer,
+							"the image of the running target container is minified, but a target image is set too")
+					}
+
+					if ctx.Bool(FlagIsolatedNetwork) {
+						paramErrs.addf(FlagTargetContainer, paramHintTargetContainer,
+							"the running target container can't be moved to an isolated network")
 					}
+
+					if overrides != nil && overrides.Interactive {
+						paramErrs.addf(FlagTargetContainer, paramHintTargetContainer,
+							"the running target container doesn't have a TTY for the interactive session")
+					}
+
+					if ctx.Bool(FlagUseCache) {
+						paramErrs.addf(FlagTargetContainer, paramHintTargetContainer,
+							"the running target container monitoring results can't be cached")
+					}
+				}
+
+				paramErrs.failOnErrors("build")
+
+				if !ctx.Bool(FlagYes) &&
+					!confirmRiskyConfig("build", doHTTPProbe, confinueAfter, excludePaths, overrides.ClearEntrypoint || instructions.ClearEntrypoint) {
+					status.New("build").State(status.IDExited, "exited", "message='not confirmed'")
+					return nil
+				}
+
+				if registryAccess.Direct {
+					commands.OnRegistryDirectBuild(
+						doCheckVersion,
+						ctx.GlobalString(FlagCommandReport),
+						ctx.GlobalBool(FlagDebug),
+						statePath,
+						ctx.GlobalString(FlagStateDirNaming),
+						registryAccess,
+						imageRef,
+						doTag,
+						includePaths,
+						includeBins,
+						includeExes,
+						doIncludeShell,
+						ociLayout)
+					return nil
 				}
 
 				commands.OnBuild(
 					doCheckVersion,
 					ctx.GlobalString(FlagCommandReport),
 					ctx.GlobalBool(FlagDebug),
+					ctx.Bool(FlagDryRun),
 					statePath,
+					ctx.GlobalString(FlagStateDirNaming),
 					clientConfig,
+					registryAccess,
 					buildFromDockerfile,
 					imageRef,
+					targetContainer,
 					doTag,
 					doHTTPProbe,
 					httpProbeCmds,
@@ -709,30 +1903,60 @@ func init() {
 					doHTTPProbeFull,
 					doRmFileArtifacts,
 					doCopyMetaArtifacts,
+					ctx.String(FlagArchiveState),
 					doShowContainerLogs,
 					doShowBuildLogs,
 					parseImageOverrides(doImageOverrides),
 					overrides,
 					instructions,
 					ctx.StringSlice(FlagLink),
-					ctx.StringSlice(FlagEtcHostsMap),
+					etcHostsMaps,
 					ctx.StringSlice(FlagContainerDNS),
 					ctx.StringSlice(FlagContainerDNSSearch),
+					ctx.Bool(FlagIsolatedNetwork),
 					volumeMounts,
 					excludePaths,
 					includePaths,
+					includePathMaps,
 					includeBins,
 					includeExes,
 					doIncludeShell,
-					confinueAfter)
+					doIncludeZoneinfo,
+					includeLocales,
+					doDetectSecrets,
+					doExcludeSecrets,
+					sensorMount,
+					seccompBaseline,
+					seccompOptions,
+					appArmorOptions,
+					ctx.Bool(FlagTestProfiles),
+					ctx.Bool(FlagGenPolicy),
+					ctx.Bool(FlagHardenFiles),
+					ctx.Bool(FlagStripBinaries),
+					stripExclude,
+					artifactHooks,
+					includeNew,
+					loaderCheck,
+					ctx.BoolT(FlagCheckEntrypoint),
+					ctx.Bool(FlagReproducible),
+					layerStrategy,
+					slimBase,
+					sharedLayer,
+					ociLayout,
+					embedProfiles,
+					ctx.Bool(FlagUseCache),
+					ctx.Bool(FlagResume),
+					confinueAfter,
+					execTimeout)
 
 				return nil
 			},
 		},
 		{
-			Name:    CmdProfile,
-			Aliases: []string{"p"},
-			Usage:   "Collects fat image information and generates a fat container report",
+			Name:         CmdProfile,
+			Aliases:      []string{"p"},
+			Usage:        "Collects fat image information and generates a fat container report",
+			BashComplete: completeImageCommand,
 			Flags: []cli.Flag{
 				doHTTPProbeFlag,
 				doHTTPProbeCmdFlag,
@@ -743,17 +1967,53 @@ func init() {
 				doHTTPProbeFullFlag,
 				doShowContainerLogsFlag,
 				doCopyMetaArtifactsFlag,
+				doArchiveStateFlag,
 				doUseEntrypointFlag,
 				doUseCmdFlag,
+				doEntrypointFormFlag,
+				doCmdFormFlag,
 				doUseWorkdirFlag,
 				doUseEnvFlag,
+				doUseUserFlag,
 				doUseLinkFlag,
 				doUseEtcHostsMapFlag,
 				doUseContainerDNSFlag,
 				doUseContainerDNSSearchFlag,
+				doUseContainerDNSOptFlag,
+				doUseContainerLabelFlag,
 				doUseNetworkFlag,
+				doIsolatedNetworkFlag,
+				doIPFlag,
+				doIP6Flag,
+				doNetworkAliasFlag,
 				doUseHostnameFlag,
+				doUseDomainnameFlag,
+				doIpcFlag,
+				doPidFlag,
+				doCapAddFlag,
+				doCapDropFlag,
+				doDeviceFlag,
+				doGPUsFlag,
+				doMemoryFlag,
+				doMemorySwapFlag,
+				doCPUSharesFlag,
+				doCPUsFlag,
+				doPidsLimitFlag,
+				doShmSizeFlag,
+				doUlimitFlag,
+				doTmpfsFlag,
+				doSysctlFlag,
+				doReadOnlyFlag,
+				doInteractiveFlag,
+				doStopSignalFlag,
+				doStopTimeoutFlag,
+				doStartRetriesFlag,
+				doPrivilegedFlag,
+				doSecurityOptFlag,
+				doSecretFileFlag,
+				doSecretEnvFlag,
 				doUseExposeFlag,
+				doPublishFlag,
 				doExcludeMountsFlag,
 				doExcludePathFlag,
 				doIncludePathFlag,
@@ -761,8 +2021,29 @@ func init() {
 				doIncludeBinFlag,
 				doIncludeExeFlag,
 				doIncludeShellFlag,
+				doIncludeZoneinfoFlag,
+				doIncludeLocaleFlag,
 				doUseMountFlag,
+				doVolumesFromFlag,
 				doConfinueAfterFlag,
+				doSensorMountLocationFlag,
+				doSensorMountOptionsFlag,
+				doArtifactsTransferFlag,
+				doSensorPathFlag,
+				doSeccompBaselineFlag,
+				doSeccompMergeFlag,
+				doSeccompArchFlag,
+				doSeccompDefaultFlag,
+				doSeccompErrnoFlag,
+				doSeccompActionFlag,
+				doAppArmorNetworkFlag,
+				doAppArmorCapsFlag,
+				doAppArmorOwnerFilesFlag,
+				doAppArmorComplainFlag,
+				doDryRunFlag,
+				doExecTimeoutFlag,
+				doPullFlag,
+				doAutoConfirmFlag,
 			},
 			Action: func(ctx *cli.Context) error {
 				if len(ctx.Args()) < 1 {
@@ -771,26 +2052,36 @@ func init() {
 					return nil
 				}
 
+				var paramErrs paramErrors
+				expandPathFlags(ctx, &paramErrs, commandPathFlags...)
+
 				doCheckVersion := ctx.GlobalBool(FlagCheckVersion)
 
 				statePath := ctx.GlobalString(FlagStatePath)
 
 				imageRef := ctx.Args().First()
 				clientConfig := getDockerClientConfig(ctx)
+				registryAccess := getRegistryAccess(ctx)
 
 				doCopyMetaArtifacts := ctx.String(FlagCopyMetaArtifacts)
 
 				doHTTPProbe := ctx.Bool(FlagHTTPProbe)
 
-				httpProbeCmds, err := getHTTPProbes(ctx)
+				httpProbeCmds, err := parseHTTPProbes(ctx.StringSlice(FlagHTTPProbeCmd))
 				if err != nil {
-					fmt.Printf("[profile] invalid HTTP probes: %v\n", err)
-					return err
+					paramErrs.add(FlagHTTPProbeCmd, err, paramHintHTTPProbeCmd)
+				}
+
+				moreHTTPProbeCmds, err := parseHTTPProbesFile(ctx.String(FlagHTTPProbeCmdFile))
+				if err != nil {
+					paramErrs.add(FlagHTTPProbeCmdFile, err, paramHintHTTPProbeFile)
+				} else {
+					httpProbeCmds = append(httpProbeCmds, moreHTTPProbeCmds...)
 				}
 
 				if doHTTPProbe {
 					//add default probe cmd if the "http-probe" flag is explicitly set
-					fmt.Println("docker-slim[profile]: info=http.probe message='using default probe'")
+					status.New("profile").Info(status.IDProbeDefault, "http.probe", "message='using default probe'")
 					httpProbeCmds = append(httpProbeCmds,
 						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/"})
 				}
@@ -800,11 +2091,13 @@ func init() {
 				}
 
 				httpProbeRetryCount := ctx.Int(FlagHTTPProbeRetryCount)
-				httpProbeRetryWait := ctx.Int(FlagHTTPProbeRetryWait)
+				httpProbeRetryWait, err := parseWaitTime(ctx.String(FlagHTTPProbeRetryWait))
+				if err != nil {
+					paramErrs.add(FlagHTTPProbeRetryWait, err, paramHintWaitTime)
+				}
 				httpProbePorts, err := parseHTTPProbesPorts(ctx.String(FlagHTTPProbePorts))
 				if err != nil {
-					fmt.Printf("[profile] invalid HTTP Probe target ports: %v\n", err)
-					return err
+					paramErrs.add(FlagHTTPProbePorts, err, paramHintHTTPProbePorts)
 				}
 
 				doHTTPProbeFull := ctx.Bool(FlagHTTPProbeFull)
@@ -812,58 +2105,100 @@ func init() {
 				doShowContainerLogs := ctx.Bool(FlagShowContainerLogs)
 				overrides, err := getContainerOverrides(ctx)
 				if err != nil {
-					fmt.Printf("[profile] invalid container overrides: %v", err)
-					return err
+					paramErrs.add("container overrides", err, paramHintExec+" / "+paramHintExpose)
+				}
+
+				etcHostsMaps, err := parseEtcHostsMaps(ctx.StringSlice(FlagEtcHostsMap))
+				if err != nil {
+					paramErrs.add(FlagEtcHostsMap, err, paramHintEtcHostsMap)
 				}
 
 				volumeMounts, err := parseVolumeMounts(ctx.StringSlice(FlagMount))
 				if err != nil {
-					fmt.Printf("[profile] invalid volume mounts: %v\n", err)
-					return err
+					paramErrs.add(FlagMount, err, paramHintMount)
 				}
 
 				excludePaths := parsePaths(ctx.StringSlice(FlagExcludePath))
 
-				includePaths := parsePaths(ctx.StringSlice(FlagIncludePath))
-				moreIncludePaths, err := parsePathsFile(ctx.String(FlagIncludePathFile))
+				includePaths, includePathMaps, err := getIncludePaths(ctx)
 				if err != nil {
-					fmt.Printf("[profile] could not read include path file (ignoring): %v\n", err)
-				} else {
-					for k, v := range moreIncludePaths {
-						includePaths[k] = v
-					}
+					paramErrs.add(FlagIncludePath, err, paramHintIncludePath)
 				}
 
 				includeBins := parsePaths(ctx.StringSlice(FlagIncludeBin))
 				includeExes := parsePaths(ctx.StringSlice(FlagIncludeExe))
 				doIncludeShell := ctx.Bool(FlagIncludeShell)
+				doIncludeZoneinfo := ctx.Bool(FlagIncludeZoneinfo)
+				includeLocales, err := parseLocales(ctx.String(FlagIncludeLocale))
+				if err != nil {
+					paramErrs.add(FlagIncludeLocale, err, paramHintIncludeLocale)
+				}
 
 				doExcludeMounts := ctx.BoolT(FlagExludeMounts)
 				if doExcludeMounts {
-					for mpath := range volumeMounts {
-						excludePaths[mpath] = true
+					for _, volumeMount := range volumeMounts {
+						excludePaths[volumeMount.Destination] = true
 					}
 				}
 
 				confinueAfter, err := getContinueAfter(ctx)
 				if err != nil {
-					fmt.Printf("[profile] invalid continue-after mode: %v\n", err)
-					return err
+					paramErrs.add(FlagContinueAfter, err, paramHintContinueAfter)
 				}
 
-				for ipath := range includePaths {
-					if excludePaths[ipath] {
-						fmt.Printf("[profile] include and exclude path conflict: %v\n", err)
-						return nil
-					}
+				sensorMount, err := getSensorMount(ctx)
+				if err != nil {
+					paramErrs.add(FlagSensorMountLocation, err, paramHintSensorMount)
 				}
 
-				commands.OnProfile(
-					doCheckVersion,
-					ctx.GlobalString(FlagCommandReport),
-					ctx.GlobalBool(FlagDebug),
-					statePath,
+				seccompBaseline, err := getSeccompBaseline(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompBaseline, err, paramHintSeccompBaseline)
+				}
+
+				seccompOptions, err := getSeccompOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompDefault, err, paramHintSeccompOptions)
+				}
+
+				appArmorOptions, err := getAppArmorOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagAppArmorNetwork, err, paramHintAppArmorNetwork)
+				}
+
+				var execTimeout time.Duration
+				if value := ctx.String(FlagExecTimeout); value != "" {
+					execTimeout, err = parseWaitTime(value)
+					if err != nil {
+						paramErrs.add(FlagExecTimeout, err, paramHintWaitTime)
+					}
+				}
+
+				paramErrs.addConflicts(doHTTPProbe,
+					confinueAfter,
+					httpProbePorts,
+					overrides,
+					ctx.Bool(FlagIsolatedNetwork),
+					includePaths,
+					excludePaths)
+
+				paramErrs.failOnErrors("profile")
+
+				if !ctx.Bool(FlagYes) &&
+					!confirmRiskyConfig("profile", doHTTPProbe, confinueAfter, excludePaths, overrides.ClearEntrypoint) {
+					status.New("profile").State(status.IDExited, "exited", "message='not confirmed'")
+					return nil
+				}
+
+				commands.OnProfile(
+					doCheckVersion,
+					ctx.GlobalString(FlagCommandReport),
+					ctx.GlobalBool(FlagDebug),
+					ctx.Bool(FlagDryRun),
+					statePath,
+					ctx.GlobalString(FlagStateDirNaming),
 					clientConfig,
+					registryAccess,
 					imageRef,
 					doHTTPProbe,
 					httpProbeCmds,
@@ -872,19 +2207,270 @@ func init() {
 					httpProbePorts,
 					doHTTPProbeFull,
 					doCopyMetaArtifacts,
+					ctx.String(FlagArchiveState),
 					doShowContainerLogs,
 					overrides,
 					ctx.StringSlice(FlagLink),
-					ctx.StringSlice(FlagEtcHostsMap),
+					etcHostsMaps,
 					ctx.StringSlice(FlagContainerDNS),
 					ctx.StringSlice(FlagContainerDNSSearch),
+					ctx.Bool(FlagIsolatedNetwork),
 					volumeMounts,
 					excludePaths,
 					includePaths,
+					includePathMaps,
 					includeBins,
 					includeExes,
 					doIncludeShell,
-					confinueAfter)
+					doIncludeZoneinfo,
+					includeLocales,
+					sensorMount,
+					seccompBaseline,
+					seccompOptions,
+					appArmorOptions,
+					confinueAfter,
+					execTimeout)
+
+				return nil
+			},
+		},
+		{
+			Name:      CmdMerge,
+			Aliases:   []string{"m"},
+			Usage:     "Creates the pod-level security profiles covering the containers profiled with the 'build' or 'profile' commands",
+			ArgsUsage: "<container artifact directory> [<container artifact directory>...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagOutputDir,
+					Value:  "merged-profiles",
+					Usage:  "Directory for the merged security profiles",
+					EnvVar: "DSLIM_MERGE_OUTPUT_DIR",
+				},
+				cli.StringFlag{
+					Name:   FlagProfileName,
+					Value:  "pod",
+					Usage:  "Base name for the merged security profiles",
+					EnvVar: "DSLIM_MERGE_PROFILE_NAME",
+				},
+				doSeccompBaselineFlag,
+				doSeccompMergeFlag,
+				doSeccompArchFlag,
+				doSeccompDefaultFlag,
+				doSeccompErrnoFlag,
+				doSeccompActionFlag,
+				doAppArmorNetworkFlag,
+				doAppArmorCapsFlag,
+				doAppArmorOwnerFilesFlag,
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[%s] missing container artifact directories...\n\n", CmdMerge)
+					cli.ShowCommandHelp(ctx, CmdMerge)
+					return nil
+				}
+
+				var paramErrs paramErrors
+
+				outputDir, err := filepath.Abs(ctx.String(FlagOutputDir))
+				if err != nil {
+					paramErrs.add(FlagOutputDir, err, paramHintMergeArtifacts)
+				}
+
+				var artifactLocations []string
+				for _, location := range ctx.Args() {
+					fullPath, err := filepath.Abs(location)
+					if err != nil {
+						paramErrs.add("artifact directory", err, paramHintMergeArtifacts)
+						continue
+					}
+
+					if _, err := os.Stat(filepath.Join(fullPath, report.DefaultContainerReportFileName)); err != nil {
+						paramErrs.addf("artifact directory", paramHintMergeArtifacts, "no container report in %s", location)
+						continue
+					}
+
+					if fullPath == outputDir {
+						paramErrs.addf(FlagOutputDir, paramHintMergeArtifacts, "the output directory is a container artifact directory: %s", location)
+						continue
+					}
+
+					artifactLocations = append(artifactLocations, fullPath)
+				}
+
+				seccompBaseline, err := getSeccompBaseline(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompBaseline, err, paramHintSeccompBaseline)
+				}
+
+				seccompOptions, err := getSeccompOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagSeccompDefault, err, paramHintSeccompOptions)
+				}
+
+				appArmorOptions, err := getAppArmorOptions(ctx)
+				if err != nil {
+					paramErrs.add(FlagAppArmorNetwork, err, paramHintAppArmorNetwork)
+				}
+
+				paramErrs.failOnErrors(CmdMerge)
+
+				commands.OnMergeProfiles(
+					ctx.GlobalString(FlagCommandReport),
+					artifactLocations,
+					outputDir,
+					ctx.String(FlagProfileName),
+					seccompBaseline,
+					seccompOptions,
+					appArmorOptions)
+
+				return nil
+			},
+		},
+		{
+			Name:      CmdShared,
+			Usage:     "Creates the shared layer with the files kept in several images minified with the 'build' command",
+			ArgsUsage: "<container artifact directory> [<container artifact directory>...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagOutputDir,
+					Value:  "shared-layer",
+					Usage:  "Directory for the shared layer (use it with the --shared-layer build flag)",
+					EnvVar: "DSLIM_SHARED_OUTPUT_DIR",
+				},
+				cli.IntFlag{
+					Name:   FlagMinImages,
+					Value:  0,
+					Usage:  "Minimum number of the minified images that have to keep the same file to put it in the shared layer (default: all images; with fewer images each image gets the files only some images kept)",
+					EnvVar: "DSLIM_SHARED_MIN_IMAGES",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[%s] missing container artifact directories...\n\n", CmdShared)
+					cli.ShowCommandHelp(ctx, CmdShared)
+					return nil
+				}
+
+				var paramErrs paramErrors
+
+				outputDir, err := filepath.Abs(ctx.String(FlagOutputDir))
+				if err != nil {
+					paramErrs.add(FlagOutputDir, err, paramHintSharedArtifacts)
+				}
+
+				var artifactLocations []string
+				for _, location := range ctx.Args() {
+					fullPath, err := filepath.Abs(location)
+					if err != nil {
+						paramErrs.add("artifact directory", err, paramHintSharedArtifacts)
+						continue
+					}
+
+					if _, err := os.Stat(filepath.Join(fullPath, report.DefaultBuildContextFileName)); err != nil {
+						paramErrs.addf("artifact directory", paramHintSharedArtifacts, "no build context manifest in %s", location)
+						continue
+					}
+
+					if fullPath == outputDir {
+						paramErrs.addf(FlagOutputDir, paramHintSharedArtifacts, "the output directory is a container artifact directory: %s", location)
+						continue
+					}
+
+					artifactLocations = append(artifactLocations, fullPath)
+				}
+
+				//by default the shared layer has only the files all images kept
+				//(the other images would get the files they don't need)
+				minImages := ctx.Int(FlagMinImages)
+				if minImages == 0 {
+					minImages = len(ctx.Args())
+				}
+
+				if minImages < 1 || minImages > len(ctx.Args()) {
+					paramErrs.addf(FlagMinImages, paramHintSharedArtifacts,
+						"the minimum number of images has to be between 1 and the number of the artifact directories (%d)", len(ctx.Args()))
+				}
+
+				paramErrs.failOnErrors(CmdShared)
+
+				commands.OnSharedLayer(
+					ctx.GlobalString(FlagCommandReport),
+					artifactLocations,
+					outputDir,
+					minImages)
+
+				return nil
+			},
+		},
+		{
+			Name:      CmdBatch,
+			Usage:     "Minifies multiple target images in parallel (each target is minified with a 'build' command process)",
+			ArgsUsage: "[<target image>...]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:   FlagParallel,
+					Value:  2,
+					Usage:  "Maximum number of the concurrent target builds",
+					EnvVar: "DSLIM_BATCH_PARALLEL",
+				},
+				cli.StringFlag{
+					Name:   FlagTargetFile,
+					Value:  "",
+					Usage:  "File with the targets (one '[<build flags>] <target image>' line per target)",
+					EnvVar: "DSLIM_BATCH_TARGET_FILE",
+				},
+				cli.StringFlag{
+					Name:   FlagBuildFlags,
+					Value:  "",
+					Usage:  "'build' command flags for all targets (e.g., '--http-probe=false --continue-after 30 --yes')",
+					EnvVar: "DSLIM_BATCH_BUILD_FLAGS",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				var paramErrs paramErrors
+				expandPathFlags(ctx, &paramErrs, FlagTargetFile)
+
+				var targets []config.BatchTarget
+				for _, image := range ctx.Args() {
+					targets = append(targets, config.BatchTarget{Image: image})
+				}
+
+				moreTargets, err := parseBatchTargetFile(ctx.String(FlagTargetFile))
+				if err != nil {
+					paramErrs.add(FlagTargetFile, err, paramHintBatch)
+				}
+				targets = append(targets, moreTargets...)
+
+				if len(targets) == 0 && err == nil {
+					fmt.Printf("[%s] missing target images...\n\n", CmdBatch)
+					cli.ShowCommandHelp(ctx, CmdBatch)
+					return nil
+				}
+
+				buildFlags, err := parseBatchBuildFlags(ctx.String(FlagBuildFlags))
+				if err != nil {
+					paramErrs.add(FlagBuildFlags, err, paramHintBatch)
+				}
+
+				parallel := ctx.Int(FlagParallel)
+				if parallel < 1 {
+					paramErrs.addf(FlagParallel, paramHintBatch, "the number of the concurrent builds has to be positive (%d)", parallel)
+				}
+
+				executable, err := os.Executable()
+				if err != nil {
+					paramErrs.add(CmdBatch, err, paramHintBatch)
+				}
+
+				paramErrs.failOnErrors(CmdBatch)
+
+				commands.OnBatch(
+					ctx.GlobalString(FlagCommandReport),
+					executable,
+					batchGlobalArgs(ctx),
+					buildFlags,
+					targets,
+					parallel)
 
 				return nil
 			},
@@ -902,63 +2488,280 @@ func getContinueAfter(ctx *cli.Context) (*config.ContinueAfter, error) {
 	case "enter":
 		info.Mode = "enter"
 	case "signal":
+		if continueSignal == nil {
+			return nil, fmt.Errorf("the 'signal' continue-after mode is not supported on %s", runtime.GOOS)
+		}
+
 		info.Mode = "signal"
 		info.ContinueChan = appContinueChan
 	case "probe":
 		info.Mode = "probe"
 	case "timeout":
 		info.Mode = "timeout"
-		info.Timeout = 60
+		info.Timeout = 60 * time.Second
+	case "healthcheck":
+		info.Mode = "healthcheck"
+		info.HealthyChecks = 1
+		info.Timeout = defaultHealthcheckTimeout
 	default:
-		if waitTime, err := strconv.Atoi(doConfinueAfter); err == nil && waitTime > 0 {
-			info.Mode = "timeout"
-			info.Timeout = time.Duration(waitTime)
+		if strings.HasPrefix(doConfinueAfter, "healthcheck:") {
+			healthyChecks, err := strconv.Atoi(strings.TrimPrefix(doConfinueAfter, "healthcheck:"))
+			if err != nil || healthyChecks < 1 {
+				return nil, fmt.Errorf("invalid number of healthy checks: %s", doConfinueAfter)
+			}
+
+			info.Mode = "healthcheck"
+			info.HealthyChecks = healthyChecks
+			info.Timeout = defaultHealthcheckTimeout
+			break
 		}
+
+		waitTime, err := parseWaitTime(doConfinueAfter)
+		if err == nil && waitTime <= 0 {
+			err = fmt.Errorf("timeout must be positive")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unknown continue-after mode: %s (%v)", doConfinueAfter, err)
+		}
+
+		info.Mode = "timeout"
+		info.Timeout = waitTime
 	}
 
 	return info, nil
 }
 
+// the max time the 'healthcheck' continue-after mode waits for the healthy checks
+// (the containers that stay in the 'starting' health status don't block the command)
+const defaultHealthcheckTimeout = 5 * time.Minute
+
+// the max time (seconds) the target app gets to exit after the stop signal
+const maxStopTimeout = 90
+
+// the max number of the container start retries
+const maxStartRetries = 10
+
 func getContainerOverrides(ctx *cli.Context) (*config.ContainerOverrides, error) {
 	doUseEntrypoint := ctx.String(FlagEntrypoint)
 	doUseCmd := ctx.String(FlagCmd)
 	doUseExpose := ctx.StringSlice(FlagExpose)
 
 	overrides := &config.ContainerOverrides{
-		Workdir:  ctx.String(FlagWorkdir),
-		Env:      ctx.StringSlice(FlagEnv),
-		Network:  ctx.String(FlagNetwork),
-		Hostname: ctx.String(FlagHostname),
+		Workdir:        ctx.String(FlagWorkdir),
+		Env:            ctx.StringSlice(FlagEnv),
+		Network:        ctx.String(FlagNetwork),
+		DNSOptions:     ctx.StringSlice(FlagContainerDNSOpt),
+		NetworkAliases: ctx.StringSlice(FlagNetworkAlias),
+		Hostname:       ctx.String(FlagHostname),
+		Domainname:     ctx.String(FlagDomainname),
+		IpcMode:        ctx.String(FlagIpc),
+		PidMode:        ctx.String(FlagPid),
+		User:           ctx.String(FlagUser),
+		ReadOnlyRootfs: ctx.Bool(FlagReadOnly),
+		Interactive:    ctx.Bool(FlagInteractive),
+		StopSignal:     ctx.String(FlagStopSignal),
+		StopTimeout:    ctx.Int(FlagStopTimeout),
+		StartRetries:   ctx.Int(FlagStartRetries),
+		Privileged:     ctx.Bool(FlagPrivileged),
 	}
 
 	var err error
 	if len(doUseExpose) > 0 {
 		overrides.ExposedPorts, err = parseDockerExposeOpt(doUseExpose)
 		if err != nil {
-			fmt.Printf("invalid expose options..\n\n")
-			return nil, err
+			return nil, fmt.Errorf("invalid expose options: %v", err)
 		}
 	}
 
-	overrides.Entrypoint, err = parseExec(doUseEntrypoint)
+	overrides.PortBindings, err = parsePublishOpt(ctx.StringSlice(FlagPublish))
 	if err != nil {
-		fmt.Printf("invalid entrypoint option..\n\n")
-		return nil, err
+		return nil, fmt.Errorf("invalid publish options: %v", err)
+	}
+
+	//the target container runs the source image, so its commands use the default shell
+	overrides.Entrypoint, err = parseCommand(doUseEntrypoint, ctx.String(FlagEntrypointForm), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entrypoint option: %v", err)
 	}
 
 	overrides.ClearEntrypoint = isOneSpace(doUseEntrypoint)
 
-	overrides.Cmd, err = parseExec(doUseCmd)
+	overrides.Cmd, err = parseCommand(doUseCmd, ctx.String(FlagCmdForm), nil)
 	if err != nil {
-		fmt.Printf("invalid cmd option..\n\n")
-		return nil, err
+		return nil, fmt.Errorf("invalid cmd option: %v", err)
 	}
 
 	overrides.ClearCmd = isOneSpace(doUseCmd)
 
+	if overrides.CapAdd, err = parseCapabilities(ctx.StringSlice(FlagCapAdd)); err != nil {
+		return nil, fmt.Errorf("invalid cap-add option: %v", err)
+	}
+
+	if overrides.CapDrop, err = parseCapabilities(ctx.StringSlice(FlagCapDrop)); err != nil {
+		return nil, fmt.Errorf("invalid cap-drop option: %v", err)
+	}
+
+	if overrides.Tmpfs, err = parseTmpfs(ctx.StringSlice(FlagTmpfs)); err != nil {
+		return nil, fmt.Errorf("invalid tmpfs option: %v", err)
+	}
+
+	if overrides.Sysctls, err = parseSysctls(ctx.StringSlice(FlagSysctl)); err != nil {
+		return nil, fmt.Errorf("invalid sysctl option: %v", err)
+	}
+
+	if overrides.VolumesFrom, err = parseVolumesFrom(ctx.StringSlice(FlagVolumesFrom)); err != nil {
+		return nil, fmt.Errorf("invalid volumes-from option: %v", err)
+	}
+
+	if overrides.Labels, err = parseLabels(ctx.StringSlice(FlagContainerLabel)); err != nil {
+		return nil, fmt.Errorf("invalid container-label option: %v", err)
+	}
+
+	if overrides.StopSignal != "" {
+		if _, ok := system.SignalNumber(overrides.StopSignal); !ok {
+			return nil, fmt.Errorf("invalid stop-signal option: unknown signal (%s)", overrides.StopSignal)
+		}
+	}
+
+	//the 'done' event from the sensor is expected in two minutes, so the app needs to exit before that
+	if overrides.StopTimeout < 0 || overrides.StopTimeout > maxStopTimeout {
+		return nil, fmt.Errorf("invalid stop-timeout option: %v (use 0 to %v seconds)", overrides.StopTimeout, maxStopTimeout)
+	}
+
+	if overrides.StartRetries < 0 || overrides.StartRetries > maxStartRetries {
+		return nil, fmt.Errorf("invalid start-retries option: %v (use 0 to %v retries)", overrides.StartRetries, maxStartRetries)
+	}
+
+	if overrides.NetworkIPv4, err = parseIPAddress(ctx.String(FlagIP), false); err != nil {
+		return nil, fmt.Errorf("invalid ip option: %v", err)
+	}
+
+	if overrides.NetworkIPv6, err = parseIPAddress(ctx.String(FlagIP6), true); err != nil {
+		return nil, fmt.Errorf("invalid ip6 option: %v", err)
+	}
+
+	if overrides.Hostname != "" && !isValidHostname(overrides.Hostname) {
+		return nil, fmt.Errorf("invalid hostname option: %v", overrides.Hostname)
+	}
+
+	if overrides.Domainname != "" && !isValidHostname(overrides.Domainname) {
+		return nil, fmt.Errorf("invalid domainname option: %v", overrides.Domainname)
+	}
+
+	if !isValidNamespaceMode(overrides.IpcMode, "none", "private", "shareable", "host") {
+		return nil, fmt.Errorf("invalid ipc option: %v", overrides.IpcMode)
+	}
+
+	if !isValidNamespaceMode(overrides.PidMode, "host") {
+		return nil, fmt.Errorf("invalid pid option: %v", overrides.PidMode)
+	}
+
+	for _, opt := range ctx.StringSlice(FlagSecurityOpt) {
+		if opt = strings.TrimSpace(opt); opt == "" {
+			return nil, fmt.Errorf("invalid security-opt option: empty value")
+		}
+
+		overrides.SecurityOpts = append(overrides.SecurityOpts, opt)
+	}
+
+	if overrides.SecretFiles, err = parseSecretFiles(ctx.StringSlice(FlagSecretFile)); err != nil {
+		return nil, fmt.Errorf("invalid secret-file option: %v", err)
+	}
+
+	if overrides.SecretEnv, err = parseSecretEnv(ctx.StringSlice(FlagSecretEnv)); err != nil {
+		return nil, fmt.Errorf("invalid secret-env option: %v", err)
+	}
+
+	if overrides.Devices, err = parseDevices(ctx.StringSlice(FlagDevice)); err != nil {
+		return nil, fmt.Errorf("invalid device option: %v", err)
+	}
+
+	if value := ctx.String(FlagGPUs); value != "" {
+		gpus, err := parseGPUs(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gpus option: %v", err)
+		}
+
+		overrides.DeviceRequests = append(overrides.DeviceRequests, *gpus)
+	}
+
+	if err := parseResourceLimits(ctx, overrides); err != nil {
+		return nil, err
+	}
+
 	return overrides, nil
 }
 
+// parseCapabilities validates the capability names and returns them in the Docker format
+func parseCapabilities(names []string) ([]string, error) {
+	var caps []string
+	for _, name := range names {
+		capName, ok := capabilities.Normalize(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown capability - %v", name)
+		}
+
+		caps = append(caps, capName)
+	}
+
+	return caps, nil
+}
+
+// parseResourceLimits parses the container resource limit options
+func parseResourceLimits(ctx *cli.Context, overrides *config.ContainerOverrides) error {
+	var err error
+	if value := ctx.String(FlagMemory); value != "" {
+		if overrides.Memory, err = units.RAMInBytes(value); err != nil || overrides.Memory <= 0 {
+			return fmt.Errorf("invalid memory limit: %v", value)
+		}
+	}
+
+	if value := ctx.String(FlagMemorySwap); value != "" {
+		//the Docker daemon rejects the memory+swap limit without the memory limit
+		//(when the container is created, after the image inspection and the sensor setup)
+		if overrides.Memory == 0 {
+			return fmt.Errorf("the memory+swap limit (%v) requires the memory limit (--%s)", value, FlagMemory)
+		}
+
+		if value == "-1" {
+			overrides.MemorySwap = -1
+		} else if overrides.MemorySwap, err = units.RAMInBytes(value); err != nil || overrides.MemorySwap <= 0 {
+			return fmt.Errorf("invalid memory+swap limit: %v", value)
+		}
+
+		if overrides.MemorySwap > 0 && overrides.MemorySwap < overrides.Memory {
+			return fmt.Errorf("the memory+swap limit (%v) is smaller than the memory limit", value)
+		}
+	}
+
+	if overrides.CPUShares = int64(ctx.Int(FlagCPUShares)); overrides.CPUShares < 0 {
+		return fmt.Errorf("invalid cpu shares: %v", overrides.CPUShares)
+	}
+
+	if value := ctx.String(FlagCPUs); value != "" {
+		if overrides.CPUs, err = strconv.ParseFloat(value, 64); err != nil || overrides.CPUs <= 0 {
+			return fmt.Errorf("invalid number of cpus: %v", value)
+		}
+	}
+
+	if overrides.PidsLimit = int64(ctx.Int(FlagPidsLimit)); overrides.PidsLimit < 0 {
+		return fmt.Errorf("invalid pids limit: %v", overrides.PidsLimit)
+	}
+
+	if value := ctx.String(FlagShmSize); value != "" {
+		if overrides.ShmSize, err = units.RAMInBytes(value); err != nil || overrides.ShmSize <= 0 {
+			return fmt.Errorf("invalid shm size: %v", value)
+		}
+	}
+
+	if overrides.Ulimits, err = parseUlimits(ctx.StringSlice(FlagUlimit)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func getImageInstructions(ctx *cli.Context) (*config.ImageNewInstructions, error) {
 	entrypoint := ctx.String(FlagNewEntrypoint)
 	cmd := ctx.String(FlagNewCmd)
@@ -967,65 +2770,634 @@ func getImageInstructions(ctx *cli.Context) (*config.ImageNewInstructions, error
 	instructions := &config.ImageNewInstructions{
 		Workdir: ctx.String(FlagNewWorkdir),
 		Env:     ctx.StringSlice(FlagNewEnv),
+		User:    ctx.String(FlagNewUser),
 	}
 
+	instructions.StopSignal = strings.TrimSpace(ctx.String(FlagNewStopSignal))
+	instructions.KeepOnBuild = ctx.Bool(FlagKeepOnBuild)
+
 	//TODO(future): also load instructions from a file
 
 	var err error
 	if len(expose) > 0 {
 		instructions.ExposedPorts, err = parseDockerExposeOpt(expose)
 		if err != nil {
-			log.Errorf("getImageInstructions(): invalid expose options => %v", err)
-			return nil, err
+			return nil, fmt.Errorf("invalid new expose options: %v", err)
 		}
 	}
 
-	instructions.Entrypoint, err = parseExec(entrypoint)
+	instructions.Labels, err = parseLabels(ctx.StringSlice(FlagLabel))
 	if err != nil {
-		log.Errorf("getImageInstructions(): invalid entrypoint option => %v", err)
-		return nil, err
+		return nil, fmt.Errorf("invalid label option: %v", err)
+	}
+
+	instructions.Shell, err = parseExec(ctx.String(FlagNewShell))
+	if err != nil {
+		return nil, fmt.Errorf("invalid new shell option: %v", err)
+	}
+
+	instructions.Entrypoint, err = parseCommand(entrypoint, ctx.String(FlagEntrypointForm), instructions.Shell)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new entrypoint option: %v", err)
 	}
 
 	//one space is a hacky way to indicate that you want to remove this instruction from the image
 	instructions.ClearEntrypoint = isOneSpace(entrypoint)
 
-	instructions.Cmd, err = parseExec(cmd)
+	instructions.Cmd, err = parseCommand(cmd, ctx.String(FlagCmdForm), instructions.Shell)
 	if err != nil {
-		log.Errorf("getImageInstructions(): invalid cmd option => %v", err)
-		return nil, err
+		return nil, fmt.Errorf("invalid new cmd option: %v", err)
 	}
 
 	//same hack to indicate you want to remove this instruction
 	instructions.ClearCmd = isOneSpace(cmd)
 
+	if instructions.StopSignal != "" {
+		if _, ok := system.SignalNumber(instructions.StopSignal); !ok {
+			return nil, fmt.Errorf("invalid new stop-signal option: unknown signal (%s)", instructions.StopSignal)
+		}
+	}
+
+	instructions.OnBuild, err = parseOnBuild(ctx.StringSlice(FlagNewOnBuild))
+	if err != nil {
+		return nil, fmt.Errorf("invalid new onbuild option: %v", err)
+	}
+
+	//the author is a MAINTAINER instruction value, so it has to be one line
+	instructions.Author = strings.TrimSpace(ctx.String(FlagNewAuthor))
+	if strings.ContainsAny(instructions.Author, "\r\n") {
+		return nil, fmt.Errorf("invalid new author option: multiline value")
+	}
+
+	instructions.Comment = ctx.String(FlagNewComment)
+	instructions.Created, err = parseCreated(ctx.String(FlagNewCreated))
+	if err != nil {
+		return nil, fmt.Errorf("invalid new created option: %v", err)
+	}
+
 	return instructions, nil
 }
 
-func getHTTPProbes(ctx *cli.Context) ([]config.HTTPProbeCmd, error) {
-	httpProbeCmds, err := parseHTTPProbes(ctx.StringSlice(FlagHTTPProbeCmd))
+// Path flags ('~' and the environment variables in their values are expanded)
+var (
+	globalPathFlags = []string{
+		FlagCommandReport,
+		FlagLog,
+		FlagTLSCertPath,
+		FlagTLSCACert,
+		FlagTLSCert,
+		FlagTLSKey,
+		FlagSSHIdentity,
+		FlagStatePath,
+		FlagTmpPath,
+	}
+
+	commandPathFlags = []string{
+		FlagCopyMetaArtifacts,
+		FlagArchiveState,
+		FlagHTTPProbeCmdFile,
+		FlagIncludePathFile,
+		FlagSensorPath,
+	}
+)
+
+// expandPathFlags expands the values of the selected command path flags
+func expandPathFlags(ctx *cli.Context, paramErrs *paramErrors, names ...string) {
+	for _, name := range names {
+		value := ctx.String(name)
+		if value == "" {
+			continue
+		}
+
+		expanded, err := expandPath(value)
+		if err != nil {
+			paramErrs.add(name, err, paramHintPathExpand)
+			continue
+		}
+
+		ctx.Set(name, expanded)
+	}
+}
+
+// setTmpPath makes the selected directory the location for all temporary files
+func setTmpPath(tmpPath string) error {
+	fullPath, err := filepath.Abs(tmpPath)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := os.MkdirAll(fullPath, 0777); err != nil {
+		return err
+	}
+
+	//the temporary files are created with os.TempDir() (ioutil.TempDir(""), ioutil.TempFile("")),
+	//which uses TMPDIR on unix (and TMP, then TEMP on windows); all of them are set,
+	//so the child processes (the batch builds, strip and the artifact hooks) use the same location
+	for _, name := range []string{"TMPDIR", "TMP", "TEMP"} {
+		if err := os.Setenv(name, fullPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setProxyEnv makes the proxy flags override the proxy environment variables
+// (the connections docker-slim makes itself use them: the version check, the update downloads
+// and the tcp connections to the Docker daemon; the image pulls and pushes use the Docker daemon proxy settings)
+func setProxyEnv(ctx *cli.Context) error {
+	proxyFlags := []struct {
+		flag   string
+		envVar string
+	}{
+		{FlagHTTPProxy, "HTTP_PROXY"},
+		{FlagHTTPSProxy, "HTTPS_PROXY"},
+	}
+
+	for _, pf := range proxyFlags {
+		value := ctx.GlobalString(pf.flag)
+		if value == "" {
+			continue
+		}
+
+		if err := validateProxyURL(value); err != nil {
+			return fmt.Errorf("%s: %v", pf.flag, err)
+		}
+
+		if err := os.Setenv(pf.envVar, value); err != nil {
+			return err
+		}
+	}
+
+	if value := ctx.GlobalString(FlagNoProxy); value != "" {
+		if err := os.Setenv("NO_PROXY", value); err != nil {
+			return err
+		}
 	}
 
-	moreHTTPProbeCmds, err := parseHTTPProbesFile(ctx.String(FlagHTTPProbeCmdFile))
+	return nil
+}
+
+func validateProxyURL(value string) error {
+	proxyURL, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy URL %q (use 'http://', 'https://' or 'socks5://')", value)
+	}
+
+	if proxyURL.Host == "" {
+		return fmt.Errorf("no proxy host in %q", value)
+	}
+
+	return nil
+}
+
+var sensorMountOptions = map[string]bool{
+	"z":          true,
+	"Z":          true,
+	"cached":     true,
+	"delegated":  true,
+	"consistent": true,
+	"shared":     true,
+	"rshared":    true,
+	"slave":      true,
+	"rslave":     true,
+	"private":    true,
+	"rprivate":   true,
+	"nocopy":     true,
+}
+
+func getSeccompBaseline(ctx *cli.Context) (*config.SeccompBaseline, error) {
+	profile := ctx.String(FlagSeccompBaseline)
+	if profile == "" {
+		return nil, nil
+	}
+
+	baseline := &config.SeccompBaseline{
+		Profile: profile,
+		Mode:    ctx.String(FlagSeccompMerge),
+	}
+
+	switch baseline.Mode {
+	case "":
+		baseline.Mode = config.SeccompMergeUnion
+	case config.SeccompMergeUnion, config.SeccompMergeIntersection:
+	default:
+		return nil, fmt.Errorf("unsupported seccomp profile merge mode (%s): %s", FlagSeccompMerge, baseline.Mode)
+	}
+
+	if baseline.Profile != config.SeccompBaselineDockerDefault {
+		fullPath, err := filepath.Abs(baseline.Profile)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(fullPath); err != nil {
+			return nil, fmt.Errorf("baseline seccomp profile not found: %s", baseline.Profile)
+		}
+
+		baseline.Profile = fullPath
+	}
+
+	return baseline, nil
+}
+
+// the Linux ENOSYS value (the syscall package has the host values, which are different on Macs)
+const errnoENOSYS = 38
+
+func getSeccompOptions(ctx *cli.Context) (*config.SeccompOptions, error) {
+	options := &config.SeccompOptions{
+		DefaultAction: ctx.String(FlagSeccompDefault),
+	}
+
+	for _, arch := range ctx.StringSlice(FlagSeccompArch) {
+		if !seccomp.IsKnownArch(arch) {
+			return nil, fmt.Errorf("unsupported seccomp profile architecture (%s): %s", FlagSeccompArch, arch)
+		}
+
+		options.Arches = append(options.Arches, arch)
+	}
+
+	switch options.DefaultAction {
+	case "":
+		options.DefaultAction = config.SeccompActionErrno
+	case config.SeccompActionErrno, config.SeccompActionKill, config.SeccompActionLog, config.SeccompActionTrap:
+	default:
+		return nil, fmt.Errorf("unsupported seccomp profile default action (%s): %s", FlagSeccompDefault, options.DefaultAction)
+	}
+
+	switch errno := ctx.String(FlagSeccompErrno); errno {
+	case "", "eperm":
+	case "enosys":
+		options.ErrnoRet = errnoENOSYS
+	default:
+		value, err := strconv.ParseUint(errno, 10, 16)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("invalid seccomp profile errno value (%s): %s", FlagSeccompErrno, errno)
+		}
+
+		options.ErrnoRet = uint(value)
+	}
+
+	for _, value := range ctx.StringSlice(FlagSeccompAction) {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !seccomp.IsKnownAction(parts[1]) {
+			return nil, fmt.Errorf("invalid seccomp profile syscall action (%s): %s", FlagSeccompAction, value)
+		}
+
+		if options.Actions == nil {
+			options.Actions = map[string]string{}
+		}
+
+		options.Actions[parts[0]] = parts[1]
+	}
+
+	return options, nil
+}
+
+func getAppArmorOptions(ctx *cli.Context) (*config.AppArmorOptions, error) {
+	options := &config.AppArmorOptions{
+		Network:      ctx.String(FlagAppArmorNetwork),
+		Capabilities: ctx.Bool(FlagAppArmorCaps),
+		OwnerFiles:   ctx.Bool(FlagAppArmorOwnerFiles),
+		Complain:     ctx.Bool(FlagAppArmorComplain),
+	}
+
+	switch options.Network {
+	case "":
+		options.Network = config.AppArmorNetworkAll
+	case config.AppArmorNetworkAll, config.AppArmorNetworkObserved, config.AppArmorNetworkNone:
+	default:
+		return nil, fmt.Errorf("unsupported AppArmor network rule mode: %s", options.Network)
+	}
+
+	return options, nil
+}
+
+func getEmbedProfiles(ctx *cli.Context) (*config.EmbedProfiles, error) {
+	embedProfiles := &config.EmbedProfiles{
+		Mode: ctx.String(FlagEmbedProfiles),
+		URL:  ctx.String(FlagEmbedProfilesURL),
+	}
+
+	switch embedProfiles.Mode {
+	case "", config.EmbedProfilesNone:
+		return nil, nil
+	case config.EmbedProfilesDigest, config.EmbedProfilesFull:
+	default:
+		return nil, fmt.Errorf("unsupported security profile embedding mode: %s", embedProfiles.Mode)
+	}
+
+	if embedProfiles.URL != "" &&
+		!strings.HasPrefix(embedProfiles.URL, "http://") &&
+		!strings.HasPrefix(embedProfiles.URL, "https://") {
+		return nil, fmt.Errorf("invalid profile base URL: %s", embedProfiles.URL)
+	}
+
+	return embedProfiles, nil
+}
+
+func getLayerStrategy(ctx *cli.Context) (*config.LayerStrategy, error) {
+	layerStrategy := &config.LayerStrategy{
+		Mode: ctx.String(FlagLayerStrategy),
+	}
+
+	rules, err := parseLayerRules(ctx.StringSlice(FlagLayerRule))
 	if err != nil {
 		return nil, err
 	}
 
-	if moreHTTPProbeCmds != nil {
-		httpProbeCmds = append(httpProbeCmds, moreHTTPProbeCmds...)
+	switch layerStrategy.Mode {
+	case "", config.LayerStrategySingle:
+		if len(rules) == 0 {
+			return nil, nil
+		}
+
+		//the custom layer rules need the split layers
+		layerStrategy.Mode = config.LayerStrategySplit
+	case config.LayerStrategySplit, config.LayerStrategyReuseBase:
+	default:
+		return nil, fmt.Errorf("unsupported layer strategy: %s", layerStrategy.Mode)
 	}
 
-	return httpProbeCmds, nil
+	layerStrategy.Rules = rules
+	return layerStrategy, nil
+}
+
+func getStripExclude(ctx *cli.Context) ([]string, error) {
+	patterns := ctx.StringSlice(FlagStripExclude)
+	if !ctx.Bool(FlagStripBinaries) {
+		if len(patterns) > 0 {
+			return nil, fmt.Errorf("the strip exclude patterns need the binary stripping")
+		}
+
+		return nil, nil
+	}
+
+	//the binaries are stripped after the long container analysis, so the missing tool is reported first
+	if _, err := exec.LookPath(builder.StripToolName); err != nil {
+		return nil, fmt.Errorf("'%s' is not installed: %v", builder.StripToolName, err)
+	}
+
+	for _, pattern := range patterns {
+		if !builder.IsValidLayerPattern(pattern) {
+			return nil, fmt.Errorf("invalid strip exclude pattern: %s", pattern)
+		}
+	}
+
+	return patterns, nil
+}
+
+// getArtifactHooks returns the absolute artifact hook paths (the hooks run in the artifact directory)
+func getArtifactHooks(ctx *cli.Context) ([]string, error) {
+	var hooks []string
+	for _, hook := range ctx.StringSlice(FlagArtifactHook) {
+		fullPath, err := filepath.Abs(hook)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("artifact hook not found: %s", hook)
+		}
+
+		if !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+			return nil, fmt.Errorf("artifact hook is not an executable file: %s", hook)
+		}
+
+		hooks = append(hooks, fullPath)
+	}
+
+	return hooks, nil
+}
+
+// getIncludeNew returns the new minified image files (the absolute host paths keyed by the image paths)
+func getIncludeNew(ctx *cli.Context) (map[string]string, error) {
+	newFiles := map[string]string{}
+	for _, value := range ctx.StringSlice(FlagIncludeNew) {
+		//the image paths are absolute Linux paths (the host paths can have the Windows drive letters)
+		idx := strings.LastIndex(value, ":")
+		if idx <= 0 || idx == len(value)-1 {
+			return nil, fmt.Errorf("malformed new file: %s", value)
+		}
+
+		localPath, imagePath := value[:idx], value[idx+1:]
+		if !strings.HasPrefix(imagePath, "/") {
+			return nil, fmt.Errorf("new file image path is not absolute: %s", value)
+		}
+
+		imagePath = path.Clean(imagePath)
+		if imagePath == "/" {
+			return nil, fmt.Errorf("new file image path is the image root: %s", value)
+		}
+
+		fullPath, err := filepath.Abs(localPath)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Lstat(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("new file not found: %s", localPath)
+		}
+
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil, fmt.Errorf("new file is not a regular file or a directory: %s", localPath)
+		}
+
+		if _, found := newFiles[imagePath]; found {
+			return nil, fmt.Errorf("duplicate new file image path: %s", imagePath)
+		}
+
+		newFiles[imagePath] = fullPath
+	}
+
+	return newFiles, nil
+}
+
+func getSensorMount(ctx *cli.Context) (*config.SensorMount, error) {
+	sensorMount := &config.SensorMount{
+		Location:   ctx.String(FlagSensorMountLocation),
+		Options:    ctx.String(FlagSensorMountOptions),
+		SensorPath: ctx.String(FlagSensorPath),
+		Transfer:   ctx.String(FlagArtifactsTransfer),
+	}
+
+	//the mount location is a path in the (Linux) target container
+	if sensorMount.Location != "" {
+		if !path.IsAbs(sensorMount.Location) || path.Clean(sensorMount.Location) == "/" {
+			return nil, fmt.Errorf("invalid sensor mount location (must be an absolute non-root path): %s", sensorMount.Location)
+		}
+
+		sensorMount.Location = path.Clean(sensorMount.Location)
+	}
+
+	switch sensorMount.Transfer {
+	case "":
+		sensorMount.Transfer = config.ArtifactsTransferAuto
+	case config.ArtifactsTransferAuto, config.ArtifactsTransferMount, config.ArtifactsTransferCopy:
+	default:
+		return nil, fmt.Errorf("unsupported artifacts transfer mode (%s): %s", FlagArtifactsTransfer, sensorMount.Transfer)
+	}
+
+	if sensorMount.Options != "" {
+		for _, option := range strings.Split(sensorMount.Options, ",") {
+			if !sensorMountOptions[option] {
+				return nil, fmt.Errorf("unsupported sensor mount option: %s", option)
+			}
+		}
+	}
+
+	if sensorMount.SensorPath != "" {
+		fullPath, err := filepath.Abs(sensorMount.SensorPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(fullPath); err != nil {
+			return nil, fmt.Errorf("sensor binary not found: %s", sensorMount.SensorPath)
+		}
+
+		sensorMount.SensorPath = fullPath
+	}
+
+	return sensorMount, nil
+}
+
+func getIncludePaths(ctx *cli.Context) (map[string]bool, map[string]string, error) {
+	includePaths, includePathMaps, err := parseIncludePaths(ctx.StringSlice(FlagIncludePath))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moreIncludePaths, err := parsePathsFile(ctx.String(FlagIncludePathFile))
+	if err != nil {
+		fmt.Printf("could not read include path file (ignoring): %v\n", err)
+		return includePaths, includePathMaps, nil
+	}
+
+	var moreValues []string
+	for k := range moreIncludePaths {
+		moreValues = append(moreValues, k)
+	}
+
+	morePaths, morePathMaps, err := parseIncludePaths(moreValues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range morePaths {
+		includePaths[k] = v
+	}
+
+	for k, v := range morePathMaps {
+		includePathMaps[k] = v
+	}
+
+	return includePaths, includePathMaps, nil
+}
+
+func getRegistryAccess(ctx *cli.Context) *config.RegistryAccess {
+	return &config.RegistryAccess{
+		Mirrors:            ctx.GlobalStringSlice(FlagRegistryMirror),
+		InsecureRegistries: ctx.GlobalStringSlice(FlagInsecureRegistry),
+		Pull:               ctx.Bool(FlagPull),
+		Push:               ctx.Bool(FlagPush),
+		Direct:             ctx.Bool(FlagRegistryDirect),
+	}
+}
+
+// setLayerFormat sets the layer format for the pushed minified image and the OCI layout image
+// (the zstd and eStargz layers are pushed by docker-slim, so they need --push or --oci-layout)
+func setLayerFormat(ctx *cli.Context, access *config.RegistryAccess, withLayout bool) error {
+	access.LayerCompression = ctx.String(FlagLayerCompression)
+	access.EStargz = ctx.Bool(FlagEStargz)
+
+	switch access.LayerCompression {
+	case "", registry.LayerCompressionGzip:
+	case registry.LayerCompressionZstd:
+		if access.EStargz {
+			return fmt.Errorf("the eStargz layers are gzip layers (zstd layer compression is selected)")
+		}
+	default:
+		return fmt.Errorf("unsupported layer compression: %s", access.LayerCompression)
+	}
+
+	if registry.IsConvertedPush(access) && !access.Push && !withLayout {
+		return fmt.Errorf("the zstd and eStargz layers are created only for the pushed images and the OCI layout images")
+	}
+
+	return nil
+}
+
+// setAnnotations sets the manifest annotations for the pushed minified image and the OCI layout image
+// (the Docker daemon doesn't add them, so the annotated images are pushed by docker-slim)
+func setAnnotations(ctx *cli.Context, access *config.RegistryAccess, withLayout bool) error {
+	annotations, err := parseLabels(ctx.StringSlice(FlagAnnotation))
+	if err != nil {
+		return fmt.Errorf("invalid annotation option: %v", err)
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	if !access.Push && !withLayout {
+		return fmt.Errorf("the manifest annotations are added only to the pushed images and the OCI layout images")
+	}
+
+	access.Annotations = annotations
+	return nil
+}
+
+// batchGlobalArgs returns the global flags for the 'batch' command target processes
+// (the command report and the version check flags are set by the 'batch' command)
+func batchGlobalArgs(ctx *cli.Context) []string {
+	var args []string
+	for _, flag := range ctx.App.Flags {
+		name := strings.Split(flag.GetName(), ",")[0]
+		if name == FlagCommandReport || name == FlagCheckVersion || !ctx.GlobalIsSet(name) {
+			continue
+		}
+
+		switch flag.(type) {
+		case cli.StringSliceFlag:
+			for _, value := range ctx.GlobalStringSlice(name) {
+				args = append(args, fmt.Sprintf("--%s=%s", name, value))
+			}
+		case cli.BoolFlag:
+			args = append(args, fmt.Sprintf("--%s=%v", name, ctx.GlobalBool(name)))
+		case cli.BoolTFlag:
+			args = append(args, fmt.Sprintf("--%s=%v", name, ctx.GlobalBoolT(name)))
+		default:
+			args = append(args, fmt.Sprintf("--%s=%v", name, ctx.GlobalGeneric(name)))
+		}
+	}
+
+	return args
 }
 
 func getDockerClientConfig(ctx *cli.Context) *config.DockerClient {
 	config := &config.DockerClient{
-		UseTLS:      ctx.GlobalBool(FlagUseTLS),
-		VerifyTLS:   ctx.GlobalBool(FlagVerifyTLS),
-		TLSCertPath: ctx.GlobalString(FlagTLSCertPath),
-		Host:        ctx.GlobalString(FlagHost),
-		Env:         map[string]string{},
+		UseTLS:          ctx.GlobalBool(FlagUseTLS),
+		VerifyTLS:       ctx.GlobalBool(FlagVerifyTLS),
+		TLSCertPath:     ctx.GlobalString(FlagTLSCertPath),
+		TLSCACert:       ctx.GlobalString(FlagTLSCACert),
+		TLSCert:         ctx.GlobalString(FlagTLSCert),
+		TLSKey:          ctx.GlobalString(FlagTLSKey),
+		TLSServerName:   ctx.GlobalString(FlagTLSServerName),
+		SSHIdentityFile: ctx.GlobalString(FlagSSHIdentity),
+		Host:            ctx.GlobalString(FlagHost),
+		APIVersion:      os.Getenv("DOCKER_API_VERSION"),
+		Env:             map[string]string{},
+		Retries:         ctx.GlobalInt(FlagDockerRetries),
+		RetryBackoff:    ctx.GlobalDuration(FlagDockerRetryBackoff),
 	}
 
 	getEnv := func(name string) {
@@ -1038,6 +3410,44 @@ func getDockerClientConfig(ctx *cli.Context) *config.DockerClient {
 	getEnv("DOCKER_TLS_VERIFY")
 	getEnv("DOCKER_CERT_PATH")
 
+	contextName := ctx.GlobalString(FlagUseContext)
+	if contextName == "" && config.Host == "" && config.Env["DOCKER_HOST"] == "" {
+		//the current Docker CLI context is used like the Docker CLI uses it
+		//(the Docker host address settings take precedence over it)
+		currentContext, err := dockercontext.Current()
+		if err != nil {
+			log.Debugf("getDockerClientConfig: error reading the current Docker CLI context => %v", err)
+		}
+
+		contextName = currentContext
+	}
+
+	if contextName != "" {
+		if config.Host != "" && contextName != dockercontext.DefaultName {
+			log.Fatalf("conflicting options: either specify --%s or --%s, not both", FlagHost, FlagUseContext)
+		}
+
+		dcontext, err := dockercontext.Load(contextName)
+		if err != nil {
+			log.Fatalf("bad %s %q (%v)", FlagUseContext, contextName, err)
+		}
+
+		if dcontext != nil {
+			//the context settings take precedence over the Docker environment variables
+			config.Context = dcontext.Name
+			config.Host = dcontext.Host
+			config.HostSource = dockerclient.HostSourceContext
+			config.Env = map[string]string{}
+			if dcontext.HasTLS() {
+				config.UseTLS = true
+				config.VerifyTLS = !dcontext.SkipTLSVerify
+				config.TLSCertPath = dcontext.TLSPath
+			} else {
+				config.UseTLS = false
+			}
+		}
+	}
+
 	return config
 }
 
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* each target is minified by a separate 'build' command process (the build pipeline has its own
+//  signal handlers, timers and state, so the targets are isolated from each other and one failed
+//  target doesn't stop the other builds)
+//* the target processes get the batch command global flags and they don't have a terminal,
+//  so the risky configurations need '--yes' in the build flags
+
+// batchReportFileName is the 'build' command report file name for the target processes
+const batchReportFileName = "build.report.json"
+
+// OnBatch implements the 'batch' docker-slim command
+// (it runs the 'build' command for the targets with at most 'parallel' concurrent builds)
+func OnBatch(
+	cmdReportLocation string,
+	executable string,
+	globalArgs []string,
+	buildFlags []string,
+	targets []config.BatchTarget,
+	parallel int) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "batch"})
+	printer := status.New("batch")
+
+	cmdReport := report.NewBatchCommand(cmdReportLocation)
+	cmdReport.State = report.CmdStateStarted
+	cmdReport.Parallel = parallel
+
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "targets=%v parallel=%v", len(targets), parallel)
+
+	reportDir, err := ioutil.TempDir("", "docker-slim-batch")
+	if err != nil {
+		printer.Info(status.IDBatchTargetError, "batch.error", "message='%v'", err)
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = err.Error()
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(-1)
+	}
+	defer os.RemoveAll(reportDir)
+
+	output := &prefixWriter{out: os.Stdout}
+	cmdReport.Targets = make([]*report.BatchTarget, len(targets))
+
+	workers := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for idx, target := range targets {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(idx int, target config.BatchTarget) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			prefix := fmt.Sprintf("[%d:%s] ", idx+1, target.Image)
+			reportLocation := filepath.Join(reportDir, fmt.Sprintf("%d.%s", idx+1, batchReportFileName))
+
+			var args []string
+			args = append(args, globalArgs...)
+			args = append(args, "--report", reportLocation, "--check-version=false", "build")
+			args = append(args, buildFlags...)
+			args = append(args, target.BuildFlags...)
+			args = append(args, target.Image)
+
+			logger.Debugf("target %d: %s %s", idx+1, executable, strings.Join(args, " "))
+			cmdReport.Targets[idx] = runBatchTarget(executable, args, target.Image, reportLocation, prefix, output)
+		}(idx, target)
+	}
+
+	wg.Wait()
+
+	printer.State(status.IDCompleted, "completed", "")
+	cmdReport.State = report.CmdStateCompleted
+
+	for idx, result := range cmdReport.Targets {
+		if result.Error != "" {
+			cmdReport.Failed++
+			printer.Info(status.IDBatchTargetError, "results", "target=%d image=%v exit.code=%v duration=%v message='%v'",
+				idx+1, result.Image, result.ExitCode, result.Duration, result.Error)
+			continue
+		}
+
+		printer.Info(status.IDResultsBatchTarget, "results", "target=%d image=%v minified.image=%v minified.by=%.2fX duration=%v",
+			idx+1, result.Image, result.Report.MinifiedImage, result.Report.MinifiedBy, result.Duration)
+	}
+
+	if cmdReport.Failed > 0 {
+		//the deferred calls don't run on exit
+		os.RemoveAll(reportDir)
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = fmt.Sprintf("%d of %d targets failed", cmdReport.Failed, len(targets))
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	printer.State(status.IDDone, "done", "")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+}
+
+// runBatchTarget runs the 'build' command process for the target
+// (its output lines are prefixed and its build report is included in the target result)
+func runBatchTarget(executable string, args []string, image, reportLocation, prefix string, output *prefixWriter) *report.BatchTarget {
+	result := &report.BatchTarget{
+		Image: image,
+		Args:  args,
+	}
+
+	cmd := exec.Command(executable, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		return result
+	}
+	cmd.Stderr = cmd.Stdout
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		return result
+	}
+
+	output.copyLines(prefix, stdout)
+	err = cmd.Wait()
+	result.Duration = time.Since(started).Round(time.Second).String()
+
+	if reportData, readErr := ioutil.ReadFile(reportLocation); readErr == nil {
+		var buildReport report.BuildCommand
+		if jsonErr := json.Unmarshal(reportData, &buildReport); jsonErr == nil {
+			result.Report = &buildReport
+		}
+	}
+
+	switch {
+	case err != nil:
+		result.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		result.Error = err.Error()
+	case result.Report == nil:
+		result.Error = "no build command report"
+	case result.Report.State != report.CmdStateDone:
+		//the build command exits with 0 in some error states (e.g., when the minified image is not found)
+		result.Error = fmt.Sprintf("build command state - %s", result.Report.State)
+		if result.Report.Error != "" {
+			result.Error = fmt.Sprintf("%s (%s)", result.Error, result.Report.Error)
+		}
+	}
+
+	return result
+}
+
+// prefixWriter writes the output lines of the concurrent target processes
+// (the lines are not interleaved)
+type prefixWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *prefixWriter) copyLines(prefix string, in io.Reader) {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+
+			w.mu.Lock()
+			io.WriteString(w.out, prefix+line)
+			w.mu.Unlock()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
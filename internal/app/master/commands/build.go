@@ -13,9 +13,17 @@ import (
 	"github.com/docker-slim/docker-slim/internal/app/master/builder"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/http"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/progress"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/gvisor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/policy"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
@@ -31,19 +39,24 @@ func OnBuild(
 	doCheckVersion bool,
 	cmdReportLocation string,
 	doDebug bool,
+	doDryRun bool,
 	statePath string,
+	stateDirNaming string,
 	clientConfig *config.DockerClient,
+	registryAccess *config.RegistryAccess,
 	buildFromDockerfile string,
 	imageRef string,
+	targetContainer string,
 	customImageTag string,
 	doHTTPProbe bool,
 	httpProbeCmds []config.HTTPProbeCmd,
 	httpProbeRetryCount int,
-	httpProbeRetryWait int,
+	httpProbeRetryWait time.Duration,
 	httpProbePorts []uint16,
 	doHTTPProbeFull bool,
 	doRmFileArtifacts bool,
 	copyMetaArtifactsLocation string,
+	archiveStateLocation string,
 	doShowContainerLogs bool,
 	doShowBuildLogs bool,
 	imageOverrideSelectors map[string]bool,
@@ -53,14 +66,43 @@ func OnBuild(
 	etcHostsMaps []string,
 	dnsServers []string,
 	dnsSearchDomains []string,
+	doIsolatedNetwork bool,
 	volumeMounts map[string]config.VolumeMount,
 	excludePaths map[string]bool,
 	includePaths map[string]bool,
+	includePathMaps map[string]string,
 	includeBins map[string]bool,
 	includeExes map[string]bool,
 	doIncludeShell bool,
-	continueAfter *config.ContinueAfter) {
+	doIncludeZoneinfo bool,
+	includeLocales []string,
+	doDetectSecrets bool,
+	doExcludeSecrets bool,
+	sensorMount *config.SensorMount,
+	seccompBaseline *config.SeccompBaseline,
+	seccompOptions *config.SeccompOptions,
+	appArmorOptions *config.AppArmorOptions,
+	doTestProfiles bool,
+	doGenPolicy bool,
+	doHardenFiles bool,
+	doStripBinaries bool,
+	stripExclude []string,
+	artifactHooks []string,
+	includeNew map[string]string,
+	loaderCheck string,
+	doCheckEntrypoint bool,
+	doReproducible bool,
+	layerStrategy *config.LayerStrategy,
+	slimBase string,
+	sharedLayer string,
+	ociLayout string,
+	embedProfiles *config.EmbedProfiles,
+	doUseCache bool,
+	doResume bool,
+	continueAfter *config.ContinueAfter,
+	execTimeout time.Duration) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "build"})
+	printer := status.New("build")
 
 	viChan := version.CheckAsync(doCheckVersion)
 
@@ -68,37 +110,152 @@ func OnBuild(
 	cmdReport.State = report.CmdStateStarted
 	cmdReport.ImageReference = imageRef
 
-	client := dockerclient.New(clientConfig)
+	dockerClient := dockerclient.New(clientConfig)
+	err := dockerclient.CheckConnection(dockerClient, clientConfig)
+	if err == nil {
+		dockerClient, err = dockerclient.NegotiateAPIVersion(dockerClient, clientConfig)
+	}
+
+	if err != nil {
+		printer.Info(status.IDDockerConnectError, "docker.connect.error", "message='%v'", err)
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	//the transient Docker API errors (e.g., from the flaky CI daemons) are retried
+	//and the containers and networks docker-slim creates are tracked (they are removed if the command is interrupted)
+	resources := dockerclient.NewResourceTracker(dockerclient.WithRetries(dockerclient.NewAPIClient(dockerClient, clientConfig.APIVersion), clientConfig.Retries, clientConfig.RetryBackoff))
+	var client dockerclient.API = resources
 
-	fmt.Println("docker-slim[build]: state=started")
+	printDockerEndpoint(printer, clientConfig)
+
+	//the sensor and the minified image builder work only with the Linux containers
+	if dockerclient.IsWindowsDaemon(client) {
+		printer.Info(status.IDDockerWindowsContainers, "docker.windows.containers",
+			"message='the build command needs a Docker daemon with Linux containers (switch Docker Desktop to Linux containers), use the info command to inspect Windows container images'")
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	requireAPIFeatures(printer, clientConfig, overrides)
+	warnRootlessPodman(printer, client, clientConfig)
+
+	effConfig := &effectiveConfig{
+		Command:             "build",
+		Target:              imageRef,
+		TargetContainer:     targetContainer,
+		BuildFromDockerfile: buildFromDockerfile,
+		CustomImageTag:      customImageTag,
+		Debug:               doDebug,
+		DryRun:              doDryRun,
+		StatePath:           statePath,
+		StateDirNaming:      stateDirNaming,
+		DockerClient:        clientConfig,
+		HTTPProbe:           doHTTPProbe,
+		HTTPProbeRetryCount: httpProbeRetryCount,
+		HTTPProbeRetryWait:  httpProbeRetryWait.String(),
+		HTTPProbePorts:      httpProbePorts,
+		HTTPProbeFull:       doHTTPProbeFull,
+		RemoveFileArtifacts: doRmFileArtifacts,
+		CopyMetaArtifacts:   copyMetaArtifactsLocation,
+		ArchiveState:        archiveStateLocation,
+		ShowContainerLogs:   doShowContainerLogs,
+		ShowBuildLogs:       doShowBuildLogs,
+		ImageOverrides:      imageOverrideSelectors,
+		Links:               links,
+		EtcHostsMaps:        etcHostsMaps,
+		DNSServers:          dnsServers,
+		DNSSearchDomains:    dnsSearchDomains,
+		IsolatedNetwork:     doIsolatedNetwork,
+		VolumeMounts:        volumeMounts,
+		ExcludePaths:        excludePaths,
+		IncludePaths:        includePaths,
+		IncludePathMaps:     includePathMaps,
+		IncludeBins:         includeBins,
+		IncludeExes:         includeExes,
+		IncludeShell:        doIncludeShell,
+		IncludeZoneinfo:     doIncludeZoneinfo,
+		IncludeLocales:      includeLocales,
+		DetectSecrets:       doDetectSecrets,
+		ExcludeSecrets:      doExcludeSecrets,
+		SensorMount:         sensorMount,
+		SeccompBaseline:     seccompBaseline,
+		SeccompOptions:      seccompOptions,
+		AppArmorOptions:     appArmorOptions,
+		TestProfiles:        doTestProfiles,
+		GenPolicy:           doGenPolicy,
+		HardenFiles:         doHardenFiles,
+		StripBinaries:       doStripBinaries,
+		StripExclude:        stripExclude,
+		ArtifactHooks:       artifactHooks,
+		IncludeNew:          includeNew,
+		LoaderCheck:         loaderCheck,
+		CheckEntrypoint:     doCheckEntrypoint,
+		Reproducible:        doReproducible,
+		LayerStrategy:       layerStrategy,
+		SlimBase:            slimBase,
+		SharedLayer:         sharedLayer,
+		OCILayout:           ociLayout,
+		EmbedProfiles:       embedProfiles,
+		UseCache:            doUseCache,
+		Resume:              doResume,
+	}
+	effConfig.setContainerOverrides(overrides)
+	effConfig.setImageInstructions(instructions)
+	effConfig.setHTTPProbeCmds(httpProbeCmds)
+	effConfig.setContinueAfter(continueAfter)
+	if execTimeout > 0 {
+		effConfig.ExecTimeout = execTimeout.String()
+	}
+
+	execTimer := newExecTimeout(execTimeout, func() {
+		printer.Info(status.IDExecTimeout, "exec.timeout", "timeout=%v message='command execution timeout, stopping'", execTimeout)
+		resources.RemoveAll()
+		cmdReport.State = report.CmdStateTimeout
+		cmdReport.Error = "execution timeout"
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(ExecTimeoutExitCode)
+	})
+	execTimer.handleInterrupts(func(sig os.Signal) {
+		printer.Info(status.IDInterrupted, "interrupted", "signal=%v message='command interrupted, removing the temporary containers, networks and images'", sig)
+		resources.RemoveAll()
+		cmdReport.State = report.CmdStateInterrupted
+		cmdReport.Error = fmt.Sprintf("interrupted (%v)", sig)
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(InterruptExitCode)
+	})
+	defer execTimer.stop()
+
+	printer.State(status.IDStarted, "started", "")
 	if buildFromDockerfile == "" {
-		fmt.Printf("docker-slim[build]: info=params target=%v continue.mode=%v\n", imageRef, continueAfter.Mode)
+		printer.Info(status.IDParams, "params", "target=%v continue.mode=%v", imageRef, continueAfter.Mode)
 	} else {
-		fmt.Printf("docker-slim[build]: info=params context=%v/file=%v continue.mode=%v\n", imageRef, buildFromDockerfile, continueAfter.Mode)
+		printer.Info(status.IDParams, "params", "context=%v/file=%v continue.mode=%v", imageRef, buildFromDockerfile, continueAfter.Mode)
+	}
+
+	cmdReport.SecurityWarnings = container.SecurityWarnings(overrides)
+	for _, warning := range cmdReport.SecurityWarnings {
+		printer.Info(status.IDContainerSecurityWarning, "container.security.warning", "message='WARNING: %s'", warning)
 	}
 
 	if buildFromDockerfile != "" {
-		fmt.Println("docker-slim[build]: state=building message='building basic image'")
+		printer.State(status.IDBasicImageBuilding, "building", "message='building basic image'")
 		//create a fat image name based on the user provided custom tag if it's available
 		var fatImageRepoNameTag string
 		if customImageTag != "" {
-			citParts := strings.Split(customImageTag, ":")
-			switch len(citParts) {
-			case 1:
-				fatImageRepoNameTag = fmt.Sprintf("%s.fat", customImageTag)
-			case 2:
-				fatImageRepoNameTag = fmt.Sprintf("%s.fat:%s", citParts[0], citParts[1])
-			default:
-				fmt.Printf("docker-slim[build]: info=param.error status=malformed.custom.image.tag value=%s\n", customImageTag)
-				fmt.Printf("docker-slim[build]: state=exited version=%s\n", v.Current())
-				os.Exit(-1)
+			//the custom tag format is validated with the other command parameters
+			fatImageRepoNameTag = fmt.Sprintf("%s.fat", customImageTag)
+			if idx := strings.LastIndex(customImageTag, ":"); idx > strings.LastIndex(customImageTag, "/") {
+				fatImageRepoNameTag = fmt.Sprintf("%s.fat%s", customImageTag[:idx], customImageTag[idx:])
 			}
 		} else {
 			fatImageRepoNameTag = fmt.Sprintf("docker-slim-tmp-fat-image.%v.%v",
 				os.Getpid(), time.Now().UTC().Format("20060102150405"))
 		}
 
-		fmt.Printf("docker-slim[build]: info=basic.image.name value=%s\n", fatImageRepoNameTag)
+		printer.Info(status.IDBasicImageName, "basic.image.name", "value=%s", fatImageRepoNameTag)
 
 		fatBuilder, err := builder.NewBasicImageBuilder(client,
 			fatImageRepoNameTag,
@@ -107,19 +264,25 @@ func OnBuild(
 			doShowBuildLogs)
 		errutil.FailOn(err)
 
+		pi := progress.Start(printer.Prefix(), "basic.image.build")
 		err = fatBuilder.Build()
+		pi.Stop()
 
 		if doShowBuildLogs {
-			fmt.Println("docker-slim[build]: build logs (basic image) ====================")
+			fmt.Println(printer.Prefix(), "build logs (basic image) ====================")
 			fmt.Println(fatBuilder.BuildLog.String())
-			fmt.Println("docker-slim[build]: end of build logs (basic image) =============")
+			fmt.Println(printer.Prefix(), "end of build logs (basic image) =============")
 		}
 
 		errutil.FailOn(err)
 
-		fmt.Println("docker-slim[build]: state=basic.image.build.completed")
+		printer.State(status.IDBasicImageBuilt, "basic.image.build.completed", "")
 
 		imageRef = fatImageRepoNameTag
+		if customImageTag == "" {
+			//the temporary fat image is removed if the command is interrupted
+			resources.TrackImage(fatImageRepoNameTag)
+		}
 		//todo: remove the temporary fat image (should have a flag for it in case users want the fat image too)
 	}
 
@@ -134,30 +297,57 @@ func OnBuild(
 	}
 
 	if !confirmNetwork(logger, client, overrides.Network) {
-		fmt.Printf("docker-slim[build]: info=param.error status=unknown.network value=%s\n", overrides.Network)
-		fmt.Printf("docker-slim[build]: state=exited version=%s\n", v.Current())
+		printer.Info(status.IDParamError, "param.error", "status=unknown.network value=%s", overrides.Network)
+		printer.Info(status.IDParamHint, "param.hint", "message='use one of the existing Docker networks (see docker network ls) or --network host|bridge|none'")
+		printer.Exited()
 		os.Exit(-111)
 	}
 
+	if targetContainer != "" {
+		targetInfo, err := client.InspectContainer(targetContainer)
+		if err != nil {
+			printer.Info(status.IDTargetContainerError, "target.container.error", "status=not.found target.container=%v message='%v'", targetContainer, err)
+			printer.Exited()
+			os.Exit(-1)
+		}
+
+		if !targetInfo.State.Running {
+			printer.Info(status.IDTargetContainerError, "target.container.error", "status=not.running target.container=%v message='start the target container first'", targetContainer)
+			printer.Exited()
+			os.Exit(-1)
+		}
+
+		//minify the image of the running container
+		imageRef = targetInfo.Image
+		cmdReport.ImageReference = imageRef
+		printer.Info(status.IDTargetContainer, "target.container", "name=%v id=%v image=%v",
+			strings.TrimPrefix(targetInfo.Name, "/"), targetInfo.ID, imageRef)
+	}
+
 	imageInspector, err := image.NewInspector(client, imageRef)
 	errutil.FailOn(err)
 
-	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[build]: target image not found -", imageRef)
-		fmt.Println("docker-slim[build]: state=exited")
+	if imageInspector.NoImage() &&
+		!pullTargetImage(printer, client, imageRef, registryAccess, doDebug) {
+		printer.Info(status.IDImageNotFound, "image.error", "status=not.found target=%v message='target image not found'", imageRef)
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[build]: state=image.inspection.start")
+	printer.State(status.IDImageInspectionStart, "image.inspection.start", "")
 
 	logger.Info("inspecting 'fat' image metadata...")
 	err = imageInspector.Inspect()
 	errutil.FailOn(err)
 
-	localVolumePath, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageInspector.ImageInfo.ID)
+	localVolumePath, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageStateKey(stateDirNaming, imageInspector))
 	imageInspector.ArtifactLocation = artifactLocation
 
-	fmt.Printf("docker-slim[build]: info=image id=%v size.bytes=%v size.human=%v\n",
+	if err := effConfig.save(artifactLocation); err != nil {
+		logger.Infof("could not save the effective configuration - %v", err)
+	}
+
+	printer.Info(status.IDImageInfo, "image", "id=%v size.bytes=%v size.human=%v",
 		imageInspector.ImageInfo.ID,
 		imageInspector.ImageInfo.VirtualSize,
 		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
@@ -168,7 +358,7 @@ func OnBuild(
 
 	if imageInspector.DockerfileInfo != nil {
 		if imageInspector.DockerfileInfo.ExeUser != "" {
-			fmt.Printf("docker-slim[build]: info=image.users exe='%v' all='%v'\n",
+			printer.Info(status.IDImageUsers, "image.users", "exe='%v' all='%v'",
 				imageInspector.DockerfileInfo.ExeUser,
 				strings.Join(imageInspector.DockerfileInfo.AllUsers, ","))
 		}
@@ -177,125 +367,365 @@ func OnBuild(
 			cmdReport.ImageStack = imageInspector.DockerfileInfo.ImageStack
 
 			for idx, layerInfo := range imageInspector.DockerfileInfo.ImageStack {
-				fmt.Printf("docker-slim[build]: info=image.stack index=%v name='%v' id='%v'\n",
+				printer.Info(status.IDImageStack, "image.stack", "index=%v name='%v' id='%v'",
 					idx, layerInfo.FullName, layerInfo.ID)
 			}
 		}
 
 		if len(imageInspector.DockerfileInfo.ExposedPorts) > 0 {
-			fmt.Printf("docker-slim[build]: info=image.exposed_ports list='%v'\n",
+			printer.Info(status.IDImageExposedPorts, "image.exposed_ports", "list='%v'",
 				strings.Join(imageInspector.DockerfileInfo.ExposedPorts, ","))
 		}
 	}
 
-	fmt.Println("docker-slim[build]: state=image.inspection.done")
-	fmt.Println("docker-slim[build]: state=container.inspection.start")
+	printer.State(status.IDImageInspectionDone, "image.inspection.done", "")
+	printer.State(status.IDContainerInspectionStart, "container.inspection.start", "")
 
 	containerInspector, err := container.NewInspector(client,
 		statePath,
 		imageInspector,
 		localVolumePath,
+		targetContainer,
 		overrides,
 		links,
 		etcHostsMaps,
 		dnsServers,
 		dnsSearchDomains,
+		doIsolatedNetwork,
 		doShowContainerLogs,
 		volumeMounts,
 		excludePaths,
 		includePaths,
+		includePathMaps,
 		includeBins,
 		includeExes,
 		doIncludeShell,
+		doIncludeZoneinfo,
+		includeLocales,
+		doDetectSecrets,
+		doExcludeSecrets,
+		sensorMount,
+		seccompBaseline,
+		seccompOptions,
+		appArmorOptions,
 		doDebug,
 		true,
-		"docker-slim[build]:")
+		printer)
 	errutil.FailOn(err)
 
-	logger.Info("starting instrumented 'fat' container...")
-	err = containerInspector.RunContainer()
-	errutil.FailOn(err)
+	containerInspector.CrashHandler = func(err *container.ContainerExitError) {
+		cmdReport.State = report.CmdStateCrashed
+		cmdReport.Error = err.Error()
+		cmdReport.ContainerExit = &report.ContainerExit{
+			ContainerID: err.ContainerID,
+			ExitCode:    err.ExitCode,
+			OOMKilled:   err.OOMKilled,
+			Restarted:   err.Restarted,
+			Stdout:      err.Stdout,
+			Stderr:      err.Stderr,
+		}
+		cmdReport.Save()
+	}
+
+	if doDryRun {
+		if targetContainer != "" {
+			printer.Info(status.IDDryRun, "dry.run", "message='the sensor is not started in the running target container in the dry-run mode'")
+			printer.Exited()
+			cmdReport.State = report.CmdStateExited
+			cmdReport.Save()
+			return
+		}
 
-	fmt.Printf("docker-slim[build]: info=container name=%v id=%v target.port.list=[%v] target.port.info=[%v] message='YOU CAN USE THESE PORTS TO INTERACT WITH THE CONTAINER'\n",
-		containerInspector.ContainerName,
-		containerInspector.ContainerID,
-		containerInspector.ContainerPortList,
-		containerInspector.ContainerPortsInfo)
+		err = containerInspector.ShowContainerPlan()
+		errutil.FailOn(err)
 
-	logger.Info("watching container monitor...")
+		printer.Info(status.IDDryRun, "dry.run", "message='the instrumented container is not created in the dry-run mode'")
+		printer.Exited()
+		cmdReport.State = report.CmdStateExited
+		cmdReport.Save()
+		return
+	}
 
 	if "probe" == continueAfter.Mode {
 		doHTTPProbe = true
 	}
 
-	if doHTTPProbe {
-		probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds,
-			httpProbeRetryCount, httpProbeRetryWait, httpProbePorts, doHTTPProbeFull,
-			true, "docker-slim[build]:")
-		errutil.FailOn(err)
-		if len(probe.Ports) == 0 {
-			fmt.Println("docker-slim[build]: state=http.probe.error error='no exposed ports' message='expose your service port with --expose or disable HTTP probing with --http-probe=false if your containerized application doesnt expose any network services")
-			logger.Info("shutting down 'fat' container...")
-			containerInspector.FinishMonitoring()
-			_ = containerInspector.ShutdownContainer()
+	monitorKey, err := (&monitorCacheKey{
+		ImageID:          imageInspector.ImageInfo.ID,
+		TargetContainer:  targetContainer,
+		Overrides:        overrides,
+		Links:            links,
+		EtcHostsMaps:     etcHostsMaps,
+		DNSServers:       dnsServers,
+		DNSSearchDomains: dnsSearchDomains,
+		IsolatedNetwork:  doIsolatedNetwork,
+		VolumeMounts:     volumeMounts,
+		ExcludePaths:     excludePaths,
+		IncludePaths:     includePaths,
+		IncludePathMaps:  includePathMaps,
+		IncludeBins:      includeBins,
+		IncludeExes:      includeExes,
+		IncludeShell:     doIncludeShell,
+		IncludeZoneinfo:  doIncludeZoneinfo,
+		IncludeLocales:   includeLocales,
+		DetectSecrets:    doDetectSecrets,
+		ExcludeSecrets:   doExcludeSecrets,
+		SeccompBaseline:  seccompBaseline,
+		SeccompOptions:   seccompOptions,
+		AppArmorOptions:  appArmorOptions,
+		HTTPProbe:        doHTTPProbe,
+		HTTPProbeCmds:    httpProbeCmds,
+		HTTPProbePorts:   httpProbePorts,
+		HTTPProbeFull:    doHTTPProbeFull,
+		ContinueAfter:    continueAfter.Mode,
+		ContinueTimeout:  continueAfter.Timeout,
+		HealthyChecks:    continueAfter.HealthyChecks,
+	}).hash()
+	errutil.FailOn(err)
 
-			fmt.Println("docker-slim[build]: state=exited")
-			return
+	buildKey, err := effConfig.hash()
+	errutil.FailOn(err)
+
+	checkpoint := &buildCheckpoint{
+		ImageID:    imageInspector.ImageInfo.ID,
+		MonitorKey: monitorKey,
+		BuildKey:   buildKey,
+	}
+
+	var resumed *buildCheckpoint
+	if doResume {
+		var reason string
+		if resumed, reason = checkpoint.resumeFrom(localVolumePath); resumed == nil {
+			printer.Info(status.IDResume, "resume", "status=not.resumed message='%v'", reason)
 		}
+	}
 
-		probe.Start()
-		continueAfter.ContinueChan = probe.DoneChan()
+	//the artifacts are restored from the checkpoint or from the monitor cache
+	//(the container is not started if they are restored)
+	var restored bool
+	if resumed != nil {
+		restored, err = restoreMonitorCache(resumed.ArtifactsPath, artifactLocation)
+		errutil.FailOn(err)
+
+		checkpoint.ArtifactsPath = resumed.ArtifactsPath
+		cmdReport.ResumedFrom = resumed.Phase
+		printer.Info(status.IDResume, "resume", "status=resumed phase=%v updated='%v' message='using the checkpointed container monitoring results (the container is not started)'",
+			resumed.Phase, resumed.Updated.Format(time.RFC3339))
+	} else if err := checkpoint.save(localVolumePath, buildPhaseInspected); err != nil {
+		logger.Infof("could not save the build checkpoint - %v", err)
 	}
 
-	switch continueAfter.Mode {
-	case "enter":
-		fmt.Println("docker-slim[build]: info=prompt message='USER INPUT REQUIRED, PRESS <ENTER> WHEN YOU ARE DONE USING THE CONTAINER'")
-		creader := bufio.NewReader(os.Stdin)
-		_, _, _ = creader.ReadLine()
-	case "signal":
-		fmt.Println("docker-slim[build]: info=prompt message='send SIGUSR1 when you are done using the container'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[build]: info=event message='got SIGUSR1'")
-	case "timeout":
-		fmt.Printf("docker-slim[build]: info=prompt message='waiting for the target container (%v seconds)'\n", int(continueAfter.Timeout))
-		<-time.After(time.Second * continueAfter.Timeout)
-		fmt.Printf("docker-slim[build]: info=event message='done waiting for the target container'")
-	case "probe":
-		fmt.Println("docker-slim[build]: info=prompt message='waiting for the HTTP probe to finish'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[build]: info=event message='HTTP probe is done'")
-	default:
-		errutil.Fail("unknown continue-after mode")
+	var cachePath string
+	if doUseCache && !restored {
+		cachePath = monitorCachePath(localVolumePath, monitorKey)
+		cmdReport.MonitorCache = &report.MonitorCache{Key: monitorKey}
+		restored, err = restoreMonitorCache(cachePath, artifactLocation)
+		if err != nil {
+			//the broken cache record is removed, so the next build runs the container
+			os.Remove(cachePath)
+			printer.Info(status.IDMonitorCache, "monitor.cache", "status=error key=%v message='%v'", monitorKey, err)
+			errutil.FailOn(err)
+		}
+
+		cmdReport.MonitorCache.Hit = restored
+		if restored {
+			checkpoint.ArtifactsPath = cachePath
+			printer.Info(status.IDMonitorCache, "monitor.cache", "status=hit key=%v message='using the cached container monitoring results (the container is not started)'", monitorKey)
+		} else {
+			printer.Info(status.IDMonitorCache, "monitor.cache", "status=miss key=%v", monitorKey)
+		}
 	}
 
-	fmt.Println("docker-slim[build]: state=container.inspection.finishing")
+	if !restored {
+		if targetContainer != "" {
+			logger.Info("attaching to the running target container...")
+			err = containerInspector.AttachContainer()
+		} else {
+			logger.Info("starting instrumented 'fat' container...")
+			err = containerInspector.RunContainer()
+		}
+		errutil.FailOn(err)
+
+		execTimer.setCleanup(func() {
+			_ = containerInspector.TerminateContainer()
+		})
+
+		printer.Info(status.IDContainerInfo, "container", "name=%v id=%v target.port.list=[%v] target.port.info=[%v] message='YOU CAN USE THESE PORTS TO INTERACT WITH THE CONTAINER'",
+			containerInspector.ContainerName,
+			containerInspector.ContainerID,
+			containerInspector.ContainerPortList,
+			containerInspector.ContainerPortsInfo)
+
+		logger.Info("watching container monitor...")
+
+		if "healthcheck" == continueAfter.Mode {
+			printer.Info(status.IDPromptHealthcheck, "prompt", "message='waiting for the target container HEALTHCHECK to report healthy'")
+			pi := progress.Start(printer.Prefix(), "container.health")
+			err := containerInspector.WaitForHealthChecks(1, healthcheckTimeout(continueAfter, execTimeout))
+			pi.Stop()
+			if err != nil {
+				printer.State(status.IDHealthcheckError, "container.health.error", "error='%v' message='add a HEALTHCHECK instruction to your image or use a different continue-after mode'", err)
+				logger.Info("shutting down 'fat' container...")
+				execTimer.setCleanup(func() {
+					_ = containerInspector.ShutdownContainer()
+				})
+				containerInspector.FinishMonitoring()
+				_ = containerInspector.ShutdownContainer()
+				execTimer.setCleanup(nil)
+
+				printer.Exited()
+				return
+			}
 
-	containerInspector.FinishMonitoring()
+			printer.Info(status.IDHealthcheckDone, "event", "message='target container is healthy'")
+		}
 
-	logger.Info("shutting down 'fat' container...")
-	err = containerInspector.ShutdownContainer()
-	errutil.WarnOn(err)
+		if doHTTPProbe {
+			probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds,
+				httpProbeRetryCount, httpProbeRetryWait, httpProbePorts, doHTTPProbeFull,
+				true, printer)
+			errutil.FailOn(err)
+			if len(probe.Ports) == 0 {
+				printer.State(status.IDProbeError, "http.probe.error", "error='no exposed ports' message='expose your service port with --expose or disable HTTP probing with --http-probe=false if your containerized application doesnt expose any network services'")
+				logger.Info("shutting down 'fat' container...")
+				execTimer.setCleanup(func() {
+					_ = containerInspector.ShutdownContainer()
+				})
+				containerInspector.FinishMonitoring()
+				_ = containerInspector.ShutdownContainer()
+				execTimer.setCleanup(nil)
+
+				printer.Exited()
+				return
+			}
 
-	fmt.Println("docker-slim[build]: state=container.inspection.artifact.processing")
+			probe.Start()
+			continueAfter.ContinueChan = probe.DoneChan()
+		}
 
-	if !containerInspector.HasCollectedData() {
-		imageInspector.ShowFatImageDockerInstructions()
-		fmt.Printf("docker-slim[build]: info=results status='no data collected (no minified image generated). (version: %v)'\n",
-			v.Current())
-		fmt.Println("docker-slim[build]: state=exited")
-		return
+		switch continueAfter.Mode {
+		case "enter":
+			if overrides.Interactive {
+				printer.Info(status.IDPromptInteractive, "prompt", "message='ATTACHING TO THE TARGET CONTAINER, PRESS <CTRL-P> <CTRL-Q> WHEN YOU ARE DONE USING IT'")
+				if err := containerInspector.AttachTerminal(); err != nil {
+					printer.Info(status.IDPromptInteractive, "prompt", "error='%v' message='interactive session failed, falling back to the <ENTER> prompt'", err)
+				} else {
+					printer.Info(status.IDInteractiveDone, "event", "message='detached from the target container'")
+					break
+				}
+			}
+
+			printer.Info(status.IDPromptEnter, "prompt", "message='USER INPUT REQUIRED, PRESS <ENTER> WHEN YOU ARE DONE USING THE CONTAINER'")
+			creader := bufio.NewReader(os.Stdin)
+			_, _, _ = creader.ReadLine()
+		case "signal":
+			printer.Info(status.IDPromptSignal, "prompt", "message='send SIGUSR1 when you are done using the container'")
+			pi := progress.Start(printer.Prefix(), "container.monitoring")
+			<-continueAfter.ContinueChan
+			pi.Stop()
+			printer.Info(status.IDSignalReceived, "event", "message='got SIGUSR1'")
+		case "timeout":
+			printer.Info(status.IDPromptTimeout, "prompt", "message='waiting for the target container (%v)'", continueAfter.Timeout)
+			pi := progress.Start(printer.Prefix(), "container.monitoring")
+			<-time.After(continueAfter.Timeout)
+			pi.Stop()
+			printer.Info(status.IDTimeoutDone, "event", "message='done waiting for the target container'")
+		case "probe":
+			printer.Info(status.IDPromptProbe, "prompt", "message='waiting for the HTTP probe to finish'")
+			<-continueAfter.ContinueChan
+			printer.Info(status.IDProbeDoneReceived, "event", "message='HTTP probe is done'")
+		case "healthcheck":
+			if doHTTPProbe {
+				printer.Info(status.IDPromptProbe, "prompt", "message='waiting for the HTTP probe to finish'")
+				<-continueAfter.ContinueChan
+				printer.Info(status.IDProbeDoneReceived, "event", "message='HTTP probe is done'")
+			}
+
+			if continueAfter.HealthyChecks > 1 {
+				printer.Info(status.IDPromptHealthcheck, "prompt", "message='waiting for %v healthy checks'", continueAfter.HealthyChecks)
+				pi := progress.Start(printer.Prefix(), "container.monitoring")
+				err := containerInspector.WaitForHealthChecks(continueAfter.HealthyChecks, healthcheckTimeout(continueAfter, execTimeout))
+				pi.Stop()
+				if err != nil {
+					//the collected data is still good, so the inspection continues
+					printer.Info(status.IDHealthcheckError, "container.health.error", "error='%v'", err)
+				} else {
+					printer.Info(status.IDHealthcheckDone, "event", "message='done waiting for the healthy checks'")
+				}
+			}
+		default:
+			errutil.Fail("unknown continue-after mode")
+		}
+
+		printer.State(status.IDContainerInspectionFinishing, "container.inspection.finishing", "")
+
+		execTimer.setCleanup(func() {
+			_ = containerInspector.ShutdownContainer()
+		})
+
+		pi := progress.Start(printer.Prefix(), "container.inspection.finishing")
+		containerInspector.ArtifactsProgress = pi.Update
+		containerInspector.FinishMonitoring()
+		containerInspector.ArtifactsProgress = nil
+		pi.Stop()
+
+		logger.Info("shutting down 'fat' container...")
+		err = containerInspector.ShutdownContainer()
+		errutil.WarnOn(err)
+		execTimer.setCleanup(nil)
+
+		printer.State(status.IDContainerArtifactProcessing, "container.inspection.artifact.processing", "")
+
+		if !containerInspector.HasCollectedData() {
+			imageInspector.ShowFatImageDockerInstructions()
+			printer.Info(status.IDResultsNoData, "results", "status='no data collected (no minified image generated). (version: %v)'",
+				v.Current())
+			printer.Exited()
+			return
+		}
+
+		if err := checkpoint.save(localVolumePath, buildPhaseMonitored); err != nil {
+			logger.Infof("could not save the build checkpoint - %v", err)
+		}
+
+		logger.Info("processing instrumented 'fat' container info...")
+		pi = progress.Start(printer.Prefix(), "container.artifact.processing")
+		err = containerInspector.ProcessCollectedData()
+		pi.Stop()
+		errutil.FailOn(err)
+
+		if cachePath != "" {
+			if err := saveMonitorCache(artifactLocation, cachePath); err != nil {
+				logger.Infof("could not save the container monitoring results to the cache - %v", err)
+			} else {
+				checkpoint.ArtifactsPath = cachePath
+			}
+		}
+
+		//the artifact snapshot is a full copy of the collected files,
+		//so it's saved only for the builds that can be resumed (the monitor cache records are reused)
+		if checkpoint.ArtifactsPath == "" && doResume {
+			snapshotPath := checkpointSnapshotPath(localVolumePath)
+			if err := saveMonitorCache(artifactLocation, snapshotPath); err != nil {
+				logger.Infof("could not save the build checkpoint artifacts - %v", err)
+			} else {
+				checkpoint.ArtifactsPath = snapshotPath
+			}
+		}
 	}
 
-	logger.Info("processing instrumented 'fat' container info...")
-	err = containerInspector.ProcessCollectedData()
-	errutil.FailOn(err)
+	if checkpoint.ArtifactsPath != "" && (resumed == nil || resumed.Phase != buildPhaseBuilt) {
+		if err := checkpoint.save(localVolumePath, buildPhaseArtifactsProcessed); err != nil {
+			logger.Infof("could not save the build checkpoint - %v", err)
+		}
+	}
 
 	if customImageTag == "" {
 		customImageTag = imageInspector.SlimImageRepo
 	}
 
-	fmt.Println("docker-slim[build]: state=container.inspection.done")
-	fmt.Println("docker-slim[build]: state=building message='building minified image'")
+	printer.State(status.IDContainerInspectionDone, "container.inspection.done", "")
+	printer.State(status.IDMinifiedImageBuilding, "building", "message='building minified image'")
 
 	builder, err := builder.NewImageBuilder(client,
 		customImageTag,
@@ -307,38 +737,245 @@ func OnBuild(
 		instructions)
 	errutil.FailOn(err)
 
+	if ociLayout != "" {
+		builder.OCILayoutPath = ociLayout
+		builder.LayerAccess = registryAccess
+	}
+
+	err = builder.AddProfileLabels(artifactLocation,
+		imageInspector.SeccompProfileName,
+		imageInspector.AppArmorProfileName,
+		embedProfiles)
+	errutil.FailOn(err)
+
+	//the new files are added before the artifact hooks run (so the hooks can change them too)
+	if len(includeNew) > 0 {
+		logger.Info("adding the new files to the minified image...")
+		cmdReport.NewFiles, err = builder.AddNewFiles(artifactLocation, includeNew)
+		errutil.FailOn(err)
+	}
+
+	if len(artifactHooks) > 0 {
+		logger.Info("running the artifact hooks...")
+		cmdReport.ArtifactHooks, err = builder.RunArtifactHooks(artifactLocation, imageRef, artifactHooks)
+		errutil.FailOn(err)
+	}
+
+	//the binaries are stripped first, so the base image and the shared layer files
+	//are compared with the files the minified image would have
+	if doStripBinaries {
+		logger.Info("stripping the debug sections from the minified image binaries...")
+		cmdReport.StrippedBinaries, err = builder.StripBinaries(artifactLocation, stripExclude)
+		errutil.FailOn(err)
+	}
+
+	//the loader files are checked before the base image files are removed
+	//(the base image files are not in the artifacts after that)
+	if loaderCheck != "" && loaderCheck != config.LoaderCheckOff {
+		logger.Info("checking the dynamic loader files for the minified image executables...")
+		cmdReport.LoaderIssues, err = builder.CheckLoaders(artifactLocation, loaderCheck == config.LoaderCheckInclude)
+		errutil.FailOn(err)
+
+		var failed bool
+		for _, issue := range cmdReport.LoaderIssues {
+			if len(issue.Included) > 0 {
+				printer.Info(status.IDImageLoaderIssue, "loader.check", "status=included file='%v' included='%v'",
+					issue.FilePath, strings.Join(issue.Included, ","))
+			}
+
+			if issue.Interpreter != "" || len(issue.Libraries) > 0 {
+				failed = true
+				printer.Info(status.IDImageLoaderIssue, "loader.check", "status=missing file='%v' interpreter='%v' libraries='%v'",
+					issue.FilePath, issue.Interpreter, strings.Join(issue.Libraries, ","))
+			}
+		}
+
+		if failed && loaderCheck == config.LoaderCheckFail {
+			printer.Info(status.IDParamHint, "param.hint", "message='include the missing files (--include-path or --loader-check include) or use --loader-check warn'")
+			printer.Exited()
+			os.Exit(-111)
+		}
+	}
+
+	if slimBase != "" {
+		builder.BaseImage = slimBase
+		cmdReport.MinifiedImageBase = slimBase
+
+		baseInspector, err := image.NewInspector(client, slimBase)
+		errutil.FailOn(err)
+
+		if baseInspector.NoImage() {
+			printer.Info(status.IDImagePull, "image.pull", "status=pulling target=%v", slimBase)
+			output := ioutil.Discard
+			if doDebug {
+				output = os.Stdout
+			}
+
+			err = registry.Pull(client, slimBase, registryAccess, output)
+			errutil.FailOn(err)
+		}
+
+		logger.Infof("removing the minified image files the base image (%v) already has...", slimBase)
+		cmdReport.BaseImageCheck, err = builder.RemoveBaseFiles(artifactLocation)
+		errutil.FailOn(err)
+
+		if check := cmdReport.BaseImageCheck; check != nil {
+			logger.Infof("base image files (not copied): %v (%v)", check.RemovedFiles, humanize.Bytes(uint64(check.RemovedSize)))
+
+			if check.Mismatch {
+				printer.Info(status.IDImageBaseIssue, "base.image",
+					"status=mismatch image=%v libc=%v distro='%v' source.libc=%v source.distro='%v' message='the minified image files may not run on the base image'",
+					slimBase, check.Libc, check.Distro, check.SourceLibc, check.SourceDistro)
+			}
+
+			if len(check.OverriddenFiles) > 0 {
+				printer.Info(status.IDImageBaseIssue, "base.image", "status=overridden.files image=%v count=%v files='%v'",
+					slimBase, len(check.OverriddenFiles), strings.Join(check.OverriddenFiles, ","))
+			}
+		}
+	}
+
+	if layerStrategy != nil && layerStrategy.Mode == config.LayerStrategyReuseBase {
+		if baseImage := targetBaseImage(imageInspector.DockerfileInfo); baseImage != "" {
+			logger.Infof("checking the target image base image (%v)...", baseImage)
+			cmdReport.BaseReuse, err = builder.ReuseBaseImage(artifactLocation, baseImage)
+			errutil.FailOn(err)
+
+			if cmdReport.BaseReuse != nil && cmdReport.BaseReuse.Reused {
+				cmdReport.MinifiedImageBase = baseImage
+			}
+		} else {
+			logger.Info("WARNING - target image has no local base image (using the split layers)")
+		}
+	}
+
+	if sharedLayer != "" {
+		logger.Infof("using the shared layer (%v)...", sharedLayer)
+		removedFiles, removedSize, extraFiles, err := builder.UseSharedLayer(sharedLayer)
+		errutil.FailOn(err)
+
+		cmdReport.MinifiedImageBase = builder.BaseImage
+		cmdReport.SharedLayer = builder.SharedLayer.DiffID
+		cmdReport.SharedLayerExtraFiles = extraFiles
+		logger.Infof("shared layer files (not copied): %v (%v)", removedFiles, humanize.Bytes(uint64(removedSize)))
+		if len(extraFiles) > 0 {
+			printer.Info(status.IDResultsSharedLayer, "results", "shared.layer.extra.files=%v message='the minified image gets the shared layer files it did not keep (see shared_layer_extra_files in the command report)'", len(extraFiles))
+		}
+	}
+
+	if doHardenFiles {
+		logger.Info("hardening the minified image files...")
+		cmdReport.FileHardening, err = builder.HardenFiles(artifactLocation)
+		errutil.FailOn(err)
+	}
+
 	if !builder.HasData {
 		logger.Info("WARNING - no data artifacts")
 	}
 
-	err = builder.Build()
+	if layerStrategy != nil {
+		logger.Info("splitting the minified image layers...")
+		cmdReport.ImageLayers, err = builder.SplitLayers(artifactLocation, layerStrategy)
+		errutil.FailOn(err)
 
-	if doShowBuildLogs {
-		fmt.Println("docker-slim[build]: build logs ====================")
-		fmt.Println(builder.BuildLog.String())
-		fmt.Println("docker-slim[build]: end of build logs =============")
+		for _, layer := range cmdReport.ImageLayers {
+			logger.Infof("minified image layer: %s (files: %v, size: %v)",
+				layer.Name, layer.Files, humanize.Bytes(uint64(layer.Size)))
+		}
 	}
 
-	errutil.FailOn(err)
+	if doReproducible {
+		builder.Reproducible = true
+		created, err := builder.ReproducibleTime()
+		errutil.FailOn(err)
+		logger.Infof("building reproducible minified image (created: %v)", created.Format(time.RFC3339))
+	}
+
+	if errs := builder.ValidateInstructions(instructions); len(errs) > 0 {
+		for _, err := range errs {
+			printer.Info(status.IDParamError, "param.error", "status=invalid.instruction message='%v'", err)
+		}
+
+		printer.Info(status.IDParamHint, "param.hint", "message='use a minified image directory for --new-workdir, valid ports for --new-expose and the volume paths that are not the minified image files'")
+		printer.Exited()
+		os.Exit(-111)
+	}
+
+	if doCheckEntrypoint {
+		if errs := builder.CheckEntrypoint(); len(errs) > 0 {
+			for _, err := range errs {
+				printer.Info(status.IDParamError, "param.error", "status=invalid.entrypoint message='%v'", err)
+			}
+
+			printer.Info(status.IDParamHint, "param.hint", "message='include the missing files (--include-path, --include-bin or --include-exe), use --new-entrypoint or disable the check with --check-entrypoint=false'")
+			printer.Exited()
+			os.Exit(-111)
+		}
+	}
+
+	if resumed != nil && resumedImageBuilt(client, resumed, buildKey, builder.RepoName, ociLayout) {
+		//the Dockerfile and the build context manifest are still generated (they are in the artifacts)
+		err = builder.GenerateDockerfile()
+		if err == nil {
+			err = builder.SaveBuildContextManifest()
+		}
+		errutil.FailOn(err)
+
+		printer.Info(status.IDResume, "resume", "status=resumed phase=%v image=%v id=%v message='the minified image is not built again'",
+			resumed.Phase, builder.RepoName, resumed.MinifiedImageID)
+	} else {
+		pi := progress.Start(printer.Prefix(), "minified.image.build")
+		builder.Progress = pi.Update
+		err = builder.Build()
+		pi.Stop()
+
+		if doShowBuildLogs {
+			fmt.Println(printer.Prefix(), "build logs ====================")
+			fmt.Println(builder.BuildLog.String())
+			fmt.Println(printer.Prefix(), "end of build logs =============")
+		}
 
-	fmt.Println("docker-slim[build]: state=completed")
+		errutil.FailOn(err)
+	}
+
+	printer.State(status.IDCompleted, "completed", "")
 	cmdReport.State = report.CmdStateCompleted
 
 	/////////////////////////////
-	newImageInspector, err := image.NewInspector(client, builder.RepoName)
-	errutil.FailOn(err)
+	//the OCI layout image is not in the Docker daemon (the builder has its image info)
+	newImageInfo := builder.LayoutImage
+	if newImageInfo != nil {
+		cmdReport.OCILayout = ociLayout
+		cmdReport.OCIManifestDigest = builder.LayoutManifestDigest
+		printer.Info(status.IDResultsOCILayout, "results", "oci.layout='%v' manifest.digest=%v",
+			cmdReport.OCILayout, cmdReport.OCIManifestDigest)
+	} else {
+		var newImageInspector *image.Inspector
+		newImageInspector, err = image.NewInspector(client, builder.RepoName)
+		errutil.FailOn(err)
 
-	if newImageInspector.NoImage() {
-		fmt.Printf("docker-slim[build]: info=results message='minified image not found - %s'\n", builder.RepoName)
-		fmt.Println("docker-slim[build]: state=exited")
-		return
+		if newImageInspector.NoImage() {
+			printer.Info(status.IDMinifiedImageNotFound, "results", "message='minified image not found - %s'", builder.RepoName)
+			printer.Exited()
+			return
+		}
+
+		err = newImageInspector.Inspect()
+		errutil.WarnOn(err)
+		newImageInfo = newImageInspector.ImageInfo
+	}
+
+	checkpoint.MinifiedImage = builder.RepoName
+	if builder.LayoutImage == nil && newImageInfo != nil {
+		checkpoint.MinifiedImageID = newImageInfo.ID
 	}
 
-	err = newImageInspector.Inspect()
-	errutil.WarnOn(err)
+	if err := checkpoint.save(localVolumePath, buildPhaseBuilt); err != nil {
+		logger.Infof("could not save the build checkpoint - %v", err)
+	}
 
 	if err == nil {
-		cmdReport.MinifiedBy = float64(imageInspector.ImageInfo.VirtualSize) / float64(newImageInspector.ImageInfo.VirtualSize)
+		cmdReport.MinifiedBy = float64(imageInspector.ImageInfo.VirtualSize) / float64(newImageInfo.VirtualSize)
 
 		cmdReport.SourceImage = report.ImageMetadata{
 			AllNames:      imageInspector.ImageRecordInfo.RepoTags,
@@ -362,15 +999,55 @@ func OnBuild(
 			}
 		}
 
-		cmdReport.MinifiedImageSize = newImageInspector.ImageInfo.VirtualSize
-		cmdReport.MinifiedImageSizeHuman = humanize.Bytes(uint64(newImageInspector.ImageInfo.VirtualSize))
+		cmdReport.MinifiedImageSize = newImageInfo.VirtualSize
+		cmdReport.MinifiedImageSizeHuman = humanize.Bytes(uint64(newImageInfo.VirtualSize))
 
-		fmt.Printf("docker-slim[build]: info=results status='MINIFIED BY %.2fX [%v (%v) => %v (%v)]'\n",
+		printer.Info(status.IDResultsMinified, "results", "status='MINIFIED BY %.2fX [%v (%v) => %v (%v)]'",
 			cmdReport.MinifiedBy,
 			cmdReport.SourceImage.Size,
 			cmdReport.SourceImage.SizeHuman,
 			cmdReport.MinifiedImageSize,
 			cmdReport.MinifiedImageSizeHuman)
+
+		props := &policy.ImageProperties{
+			ImageName: builder.RepoName,
+			User:      newImageInfo.Config.User,
+			Size:      newImageInfo.VirtualSize,
+		}
+
+		for k := range newImageInfo.Config.ExposedPorts {
+			props.ExposedPorts = append(props.ExposedPorts, string(k))
+		}
+
+		err = policy.GenPodSpec(imageInspector.ArtifactLocation, imageInspector.PodSpecName, props,
+			imageInspector.SeccompProfileName, imageInspector.AppArmorProfileName)
+		if err == nil {
+			cmdReport.PodSpecName = imageInspector.PodSpecName
+		} else {
+			logger.Infof("could not generate the Kubernetes pod spec - %v", err)
+		}
+
+		runCommand, err := policy.GenDockerRun(imageInspector.ArtifactLocation,
+			imageInspector.DockerRunName, imageInspector.ComposeName, props,
+			imageInspector.SeccompProfileName, imageInspector.AppArmorProfileName)
+		if err == nil {
+			cmdReport.DockerRunName = imageInspector.DockerRunName
+			cmdReport.ComposeName = imageInspector.ComposeName
+			cmdReport.DockerRunCommand = runCommand
+		} else {
+			logger.Infof("could not generate the docker run command - %v", err)
+		}
+
+		if doGenPolicy {
+			err = policy.GenPolicies(imageInspector.ArtifactLocation,
+				imageInspector.RegoPolicyName, imageInspector.ConstraintTemplate, props)
+			if err == nil {
+				cmdReport.RegoPolicyName = imageInspector.RegoPolicyName
+				cmdReport.ConstraintTemplateName = imageInspector.ConstraintTemplate
+			} else {
+				logger.Infof("could not generate the image policies - %v", err)
+			}
+		}
 	} else {
 		cmdReport.State = report.CmdStateError
 		cmdReport.Error = err.Error()
@@ -380,20 +1057,69 @@ func OnBuild(
 	cmdReport.MinifiedImageHasData = builder.HasData
 	cmdReport.ArtifactLocation = imageInspector.ArtifactLocation
 	cmdReport.ContainerReportName = report.DefaultContainerReportFileName
+	cmdReport.BuildContextName = report.DefaultBuildContextFileName
 	cmdReport.SeccompProfileName = imageInspector.SeccompProfileName
 	cmdReport.AppArmorProfileName = imageInspector.AppArmorProfileName
+	if appArmorOptions != nil && appArmorOptions.Complain {
+		cmdReport.AppArmorComplainName = apparmor.ComplainProfileName(imageInspector.AppArmorProfileName)
+	}
 
-	fmt.Printf("docker-slim[build]: info=results  image.name=%v image.size='%v' data=%v\n",
+	printer.Info(status.IDResultsImage, "results", "image.name=%v image.size='%v' data=%v",
 		cmdReport.MinifiedImage,
 		cmdReport.MinifiedImageSizeHuman,
 		cmdReport.MinifiedImageHasData)
 
-	fmt.Printf("docker-slim[build]: info=results  artifacts.location='%v'\n", cmdReport.ArtifactLocation)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.report=%v\n", cmdReport.ContainerReportName)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.dockerfile.original=Dockerfile.fat\n")
-	fmt.Printf("docker-slim[build]: info=results  artifacts.dockerfile.new=Dockerfile\n")
-	fmt.Printf("docker-slim[build]: info=results  artifacts.seccomp=%v\n", cmdReport.SeccompProfileName)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.apparmor=%v\n", cmdReport.AppArmorProfileName)
+	if doTestProfiles {
+		cmdReport.ProfilesCheck = runProfilesCheck(logger, printer, execTimer, containerInspector,
+			builder.RepoName, doHTTPProbe, httpProbeCmds, httpProbeRetryCount, httpProbeRetryWait,
+			httpProbePorts, doHTTPProbeFull)
+	}
+
+	if registryAccess.Push {
+		pushOutput := ioutil.Discard
+		if doDebug {
+			pushOutput = os.Stdout
+		}
+
+		var err error
+		if ociLayout != "" {
+			err = registry.PushLayout(ociLayout, builder.RepoName, registryAccess, pushOutput)
+		} else {
+			err = registry.Push(client, builder.RepoName, registryAccess, pushOutput)
+		}
+
+		if err == nil {
+			printer.Info(status.IDResultsImagePush, "results", "image.pushed=%v layers=%v",
+				builder.RepoName, registry.LayerFormat(registryAccess))
+		} else {
+			printer.Info(status.IDImagePushError, "image.push", "status=error image=%v message='%v'", builder.RepoName, err)
+		}
+	}
+
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.location='%v'", cmdReport.ArtifactLocation)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.report=%v", cmdReport.ContainerReportName)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.dockerfile.original=Dockerfile.fat")
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.dockerfile.new=Dockerfile")
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.build.context=%v", cmdReport.BuildContextName)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.seccomp=%v", cmdReport.SeccompProfileName)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.apparmor=%v", cmdReport.AppArmorProfileName)
+	if cmdReport.AppArmorComplainName != "" {
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.apparmor.complain=%v", cmdReport.AppArmorComplainName)
+	}
+
+	if cmdReport.PodSpecName != "" {
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.k8s.pod=%v", cmdReport.PodSpecName)
+	}
+
+	if cmdReport.DockerRunName != "" {
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.docker.run=%v", cmdReport.DockerRunName)
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.compose=%v", cmdReport.ComposeName)
+	}
+
+	if cmdReport.RegoPolicyName != "" {
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.policy.rego=%v", cmdReport.RegoPolicyName)
+		printer.Info(status.IDResultsArtifacts, "results", "artifacts.policy.constraint.template=%v", cmdReport.ConstraintTemplateName)
+	}
 
 	if cmdReport.ArtifactLocation != "" {
 		creportPath := filepath.Join(cmdReport.ArtifactLocation, cmdReport.ContainerReportName)
@@ -405,6 +1131,44 @@ func OnBuild(
 					Release: creport.System.Release,
 					OS:      creport.System.OS,
 				}
+
+				if fan := creport.Monitors.Fan; fan != nil {
+					cmdReport.FileMonitor = &report.FileMonitorStats{
+						Events:            fan.EventCount,
+						QueueOverflows:    fan.QueueOverflows,
+						MergedEvents:      fan.MergedEvents,
+						BackpressureWaits: fan.BackpressureWaits,
+						EventsLost:        fan.QueueOverflows > 0,
+					}
+
+					if fan.QueueOverflows > 0 {
+						printer.Info(status.IDResultsFileMonitor, "results", "file.monitor.events.lost=true queue.overflows=%v message='the container file activity was too high, some files it used can be missing in the minified image (use --include-path for them)'",
+							fan.QueueOverflows)
+					}
+				}
+
+				cmdReport.Secrets = creport.Secrets
+				for _, secret := range creport.Secrets {
+					printer.Info(status.IDResultsSecret, "results", "secret.type=%v file='%v' line=%v minified=%v excluded=%v",
+						secret.Type, secret.FilePath, secret.Line, secret.Minified, secret.Excluded)
+				}
+
+				if calls := capabilities.ObservedCalls(&creport); len(calls) > 0 {
+					cmdReport.Capabilities = capabilities.Recommend(calls, builder.User)
+					printer.Info(status.IDResultsCapabilities, "results", "capabilities.add=[%v] docker.run.args='%v'",
+						strings.Join(cmdReport.Capabilities.Add, ","),
+						cmdReport.Capabilities.DockerRunArgs)
+
+					cmdReport.GVisor = gvisor.Check(calls)
+					printer.Info(status.IDResultsGVisor, "results", "gvisor.compatibility=%v unsupported=[%v] partial=[%v]",
+						cmdReport.GVisor.Verdict,
+						strings.Join(cmdReport.GVisor.Unsupported, ","),
+						strings.Join(cmdReport.GVisor.Partial, ","))
+					for _, call := range cmdReport.GVisor.Syscalls {
+						printer.Info(status.IDResultsGVisorCall, "results", "gvisor.syscall=%v support=%v message='%v'",
+							call.Name, call.Support, call.Note)
+					}
+				}
 			} else {
 				logger.Infof("could not read container report - json parsing error - %v", err)
 			}
@@ -414,17 +1178,74 @@ func OnBuild(
 
 	}
 
+	if cmdReport.BaseReuse != nil {
+		printer.Info(status.IDResultsBaseReuse, "results", "base.image='%v' reused=%v size=%v unused=%v",
+			cmdReport.BaseReuse.Image, cmdReport.BaseReuse.Reused,
+			humanize.Bytes(uint64(cmdReport.BaseReuse.Size)),
+			humanize.Bytes(uint64(cmdReport.BaseReuse.UnusedSize)))
+	}
+
+	for _, run := range cmdReport.ArtifactHooks {
+		printer.Info(status.IDResultsArtifactHook, "results", "artifact.hook='%v' added=%v removed=%v modified=%v",
+			run.Script, len(run.Added), len(run.Removed), len(run.Modified))
+	}
+
+	if len(cmdReport.StrippedBinaries) > 0 {
+		var before, after int64
+		for _, binary := range cmdReport.StrippedBinaries {
+			before += binary.Before
+			after += binary.After
+		}
+
+		printer.Info(status.IDResultsStripped, "results", "binaries.stripped=%v size.before=%v size.after=%v",
+			len(cmdReport.StrippedBinaries), humanize.Bytes(uint64(before)), humanize.Bytes(uint64(after)))
+	}
+
+	for _, change := range cmdReport.FileHardening {
+		printer.Info(status.IDResultsFileChange, "results", "file.change=%v file='%v' before=%v after=%v",
+			change.Change, change.FilePath, change.Before, change.After)
+	}
+
+	if cmdReport.DockerRunCommand != "" {
+		printer.Info(status.IDResultsRunCommand, "results", "docker.run='%v'", cmdReport.DockerRunCommand)
+	}
+
 	/////////////////////////////
 	if copyMetaArtifactsLocation != "" {
 		toCopy := []string{
 			report.DefaultContainerReportFileName,
+			EffectiveConfigFileName,
+			"Dockerfile",
+			cmdReport.BuildContextName,
 			imageInspector.SeccompProfileName,
 			imageInspector.AppArmorProfileName,
 		}
+		if appArmorOptions != nil && appArmorOptions.Complain {
+			toCopy = append(toCopy, apparmor.ComplainProfileName(imageInspector.AppArmorProfileName))
+		}
+		if cmdReport.PodSpecName != "" {
+			toCopy = append(toCopy, cmdReport.PodSpecName)
+		}
+		if cmdReport.DockerRunName != "" {
+			toCopy = append(toCopy, cmdReport.DockerRunName, cmdReport.ComposeName)
+		}
+		if cmdReport.RegoPolicyName != "" {
+			toCopy = append(toCopy, cmdReport.RegoPolicyName, cmdReport.ConstraintTemplateName)
+		}
+
 		if !copyMetaArtifacts(logger,
 			toCopy,
 			imageInspector.ArtifactLocation, copyMetaArtifactsLocation) {
-			fmt.Println("docker-slim[build]: info=artifacts message='could not copy meta artifacts'")
+			printer.Info(status.IDMetaArtifactsError, "artifacts", "message='could not copy meta artifacts'")
+		}
+	}
+
+	if archiveStateLocation != "" {
+		logger.Infof("archiving state directory: %v => %v", localVolumePath, archiveStateLocation)
+		if err := fsutil.ArchiveDir(localVolumePath, archiveStateLocation); err == nil {
+			printer.Info(status.IDResultsStateArchive, "results", "state.archive='%v'", archiveStateLocation)
+		} else {
+			printer.Info(status.IDStateArchiveError, "state.archive", "status=error message='%v'", err)
 		}
 	}
 
@@ -432,9 +1253,13 @@ func OnBuild(
 		logger.Info("removing temporary artifacts...")
 		err = fsutil.Remove(artifactLocation) //TODO: remove only the "files" subdirectory
 		errutil.WarnOn(err)
+
+		if err := os.Remove(checkpointSnapshotPath(localVolumePath)); err != nil && !os.IsNotExist(err) {
+			logger.Infof("could not remove the build checkpoint artifacts - %v", err)
+		}
 	}
 
-	fmt.Println("docker-slim[build]: state=done")
+	printer.State(status.IDDone, "done", "")
 
 	vinfo := <-viChan
 	version.PrintCheckVersion(vinfo)
@@ -442,3 +1267,46 @@ func OnBuild(
 	cmdReport.State = report.CmdStateDone
 	cmdReport.Save()
 }
+
+// resumedImageBuilt returns true if the minified image from the resumed build checkpoint
+// doesn't need to be built again (the build options didn't change and the image is still there)
+func resumedImageBuilt(client dockerclient.API, resumed *buildCheckpoint, buildKey, imageName, ociLayout string) bool {
+	//the OCI layout builder has to assemble the image to get its image info
+	if resumed.Phase != buildPhaseBuilt ||
+		resumed.BuildKey != buildKey ||
+		resumed.MinifiedImage != imageName ||
+		resumed.MinifiedImageID == "" ||
+		ociLayout != "" {
+		return false
+	}
+
+	imageInfo, err := client.InspectImage(imageName)
+	if err != nil {
+		return false
+	}
+
+	return imageInfo.ID == resumed.MinifiedImageID
+}
+
+// targetBaseImage returns the local base image of the target image
+// (the closest image with a tag in the image stack)
+func targetBaseImage(info *dockerfile.Info) string {
+	if info == nil {
+		return ""
+	}
+
+	for idx := len(info.ImageStack) - 1; idx >= 0; idx-- {
+		imageInfo := info.ImageStack[idx]
+		if imageInfo.IsTopImage || imageInfo.ID == "" {
+			continue
+		}
+
+		if imageInfo.FullName != "" {
+			return imageInfo.FullName
+		}
+
+		return imageInfo.ID
+	}
+
+	return ""
+}
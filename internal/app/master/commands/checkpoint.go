@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+)
+
+//NOTES:
+//* the build checkpoint is saved in the image state directory after each completed build phase
+//  (the artifact directory is recreated by each build, so the checkpoint has its own artifact snapshot)
+//* the artifact snapshot is saved only for the builds with the resume option (or it's the monitor cache record),
+//  so the other builds don't keep a second copy of the collected files
+//* the artifact snapshot is taken after the container artifacts are processed (the excluded secret files
+//  are removed by then), so a build can't resume from the 'monitored' phase
+//* a build resumes only if the target image and the monitoring options didn't change,
+//  the minified image is not built again only if the other options didn't change too
+
+// Build phases
+const (
+	buildPhaseInspected          = "inspected"
+	buildPhaseMonitored          = "monitored"
+	buildPhaseArtifactsProcessed = "artifacts-processed"
+	buildPhaseBuilt              = "built"
+)
+
+const (
+	checkpointDirName      = "checkpoint"
+	checkpointFileName     = "checkpoint.json"
+	checkpointSnapshotName = "artifacts.tar"
+)
+
+// buildCheckpoint is the last completed build phase state
+type buildCheckpoint struct {
+	Version         string    `json:"version"`
+	ImageID         string    `json:"image_id"`
+	MonitorKey      string    `json:"monitor_key"`
+	BuildKey        string    `json:"build_key"`
+	Phase           string    `json:"phase"`
+	ArtifactsPath   string    `json:"artifacts_path,omitempty"`
+	MinifiedImage   string    `json:"minified_image,omitempty"`
+	MinifiedImageID string    `json:"minified_image_id,omitempty"`
+	Updated         time.Time `json:"updated"`
+}
+
+func checkpointDir(localVolumePath string) string {
+	return filepath.Join(localVolumePath, checkpointDirName)
+}
+
+// checkpointSnapshotPath returns the default location of the checkpoint artifact snapshot
+// (the monitor cache record is used instead if there's one)
+func checkpointSnapshotPath(localVolumePath string) string {
+	return filepath.Join(checkpointDir(localVolumePath), checkpointSnapshotName)
+}
+
+// loadBuildCheckpoint returns the saved build checkpoint (or nil if there's none)
+func loadBuildCheckpoint(localVolumePath string) (*buildCheckpoint, error) {
+	data, err := ioutil.ReadFile(filepath.Join(checkpointDir(localVolumePath), checkpointFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var checkpoint buildCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid build checkpoint: %v", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// save saves the completed build phase
+func (c *buildCheckpoint) save(localVolumePath, phase string) error {
+	c.Version = v.Current()
+	c.Phase = phase
+	c.Updated = time.Now().UTC()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := checkpointDir(localVolumePath)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	//the checkpoint file is replaced, so an interrupted build doesn't leave a broken checkpoint
+	tmpPath := filepath.Join(dir, "."+checkpointFileName)
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(dir, checkpointFileName))
+}
+
+// resumeFrom returns the saved checkpoint the build can resume from
+// (or the reason it can't resume)
+func (c *buildCheckpoint) resumeFrom(localVolumePath string) (*buildCheckpoint, string) {
+	saved, err := loadBuildCheckpoint(localVolumePath)
+	switch {
+	case err != nil:
+		return nil, err.Error()
+	case saved == nil:
+		return nil, "no build checkpoint"
+	case saved.Version != v.Current():
+		return nil, fmt.Sprintf("the build checkpoint is from a different docker-slim version (%v)", saved.Version)
+	case saved.ImageID != c.ImageID:
+		return nil, "the target image changed"
+	case saved.MonitorKey != c.MonitorKey:
+		return nil, "the monitoring options changed"
+	}
+
+	switch saved.Phase {
+	case buildPhaseArtifactsProcessed, buildPhaseBuilt:
+	case buildPhaseInspected, buildPhaseMonitored:
+		return nil, fmt.Sprintf("the last completed phase (%v) doesn't have the processed artifacts", saved.Phase)
+	default:
+		return nil, fmt.Sprintf("unknown build phase (%v)", saved.Phase)
+	}
+
+	if saved.ArtifactsPath == "" || !fsutil.IsRegularFile(saved.ArtifactsPath) {
+		return nil, "the build checkpoint artifact snapshot is missing"
+	}
+
+	return saved, ""
+}
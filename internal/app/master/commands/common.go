@@ -1,14 +1,53 @@
 package commands
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/cloudimmunity/go-dockerclientx"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
 )
 
+var stateKeyReplacer = strings.NewReplacer("/", "_", ":", "_", "@", "_")
+
+// imageStateKey returns the name of the image state directory for the selected naming mode
+func imageStateKey(naming string, imageInspector *image.Inspector) string {
+	imageID := imageInspector.ImageInfo.ID
+	//images IDs in Docker 1.9+ are prefixed with a hash type...
+	if parts := strings.Split(imageID, ":"); len(parts) > 1 {
+		imageID = parts[1]
+	}
+
+	tagName := imageID
+	if len(imageInspector.ImageRecordInfo.RepoTags) > 0 &&
+		imageInspector.ImageRecordInfo.RepoTags[0] != "<none>:<none>" {
+		tagName = stateKeyReplacer.Replace(imageInspector.ImageRecordInfo.RepoTags[0])
+	}
+
+	runID := fmt.Sprintf("%v.%v", time.Now().UTC().Format("20060102150405"), os.Getpid())
+
+	switch naming {
+	case config.StateDirNameByTag:
+		return tagName
+	case config.StateDirNameByTimestamp:
+		return fmt.Sprintf("%s.%s", imageID, runID)
+	case config.StateDirNameByTagTimestamp:
+		return fmt.Sprintf("%s.%s", tagName, runID)
+	default:
+		return imageID
+	}
+}
+
 func copyMetaArtifacts(logger *log.Entry, names []string, artifactLocation, targetLocation string) bool {
 	if targetLocation != "" {
 		if !fsutil.Exists(artifactLocation) {
@@ -40,7 +79,7 @@ func copyMetaArtifacts(logger *log.Entry, names []string, artifactLocation, targ
 	return false
 }
 
-func confirmNetwork(logger *log.Entry, client *docker.Client, network string) bool {
+func confirmNetwork(logger *log.Entry, client dockerclient.API, network string) bool {
 	if network == "" {
 		return true
 	}
@@ -57,3 +96,76 @@ func confirmNetwork(logger *log.Entry, client *docker.Client, network string) bo
 
 	return false
 }
+
+// printDockerEndpoint reports the Docker host address docker-slim connected to
+// and where the address came from (the flag, the context, the env vars or the socket discovery)
+func printDockerEndpoint(printer *status.Printer, clientConfig *config.DockerClient) {
+	host, source := dockerclient.Endpoint(clientConfig)
+	printer.Info(status.IDDockerEndpoint, "docker.endpoint", "host=%v source=%v api.version=%v",
+		host, source, clientConfig.APIVersion)
+}
+
+// warnRootlessPodman warns (before the target container is created) that the sensor
+// can't monitor the file activity with the rootless Podman socket (it needs fanotify)
+func warnRootlessPodman(printer *status.Printer, client dockerclient.API, clientConfig *config.DockerClient) {
+	host, _ := dockerclient.Endpoint(clientConfig)
+	if !dockerclient.IsRootlessPodmanHost(host) || !dockerclient.IsPodman(client) {
+		return
+	}
+
+	printer.Info(status.IDDockerRootlessPodman, "docker.rootless.podman",
+		"host=%v message='the sensor can not monitor the file activity in the rootless Podman containers (use the rootful Podman socket: --host unix://%s)'",
+		host, dockerclient.PodmanRootfulSocket)
+}
+
+// healthcheckTimeout returns the max wait time for the healthy checks
+// (the 'healthcheck' continue-after mode timeout or the command execution timeout if it's shorter)
+func healthcheckTimeout(continueAfter *config.ContinueAfter, execTimeout time.Duration) time.Duration {
+	timeout := continueAfter.Timeout
+	if execTimeout > 0 && (timeout <= 0 || execTimeout < timeout) {
+		timeout = execTimeout
+	}
+
+	return timeout
+}
+
+// requireAPIFeatures stops the command if the negotiated Docker API version
+// doesn't support the container options the command needs
+func requireAPIFeatures(printer *status.Printer, clientConfig *config.DockerClient, overrides *config.ContainerOverrides) {
+	if overrides == nil || len(overrides.DeviceRequests) == 0 {
+		return
+	}
+
+	if err := dockerclient.RequireAPIVersion(clientConfig, dockerclient.DeviceRequestsAPIVersion, "--gpus"); err != nil {
+		printer.Info(status.IDDockerAPIVersionError, "docker.api.version", "message='%v'", err)
+		printer.Exited()
+		os.Exit(-1)
+	}
+}
+
+// pullTargetImage pulls the target image if the pulls are enabled
+// (it returns true if the image is available after the pull)
+func pullTargetImage(printer *status.Printer,
+	client dockerclient.API,
+	imageRef string,
+	registryAccess *config.RegistryAccess,
+	doDebug bool) bool {
+	if !registryAccess.Pull || registry.IsImageID(imageRef) {
+		return false
+	}
+
+	printer.Info(status.IDImagePull, "image.pull", "status=pulling target=%v", imageRef)
+
+	output := ioutil.Discard
+	if doDebug {
+		output = os.Stdout
+	}
+
+	if err := registry.Pull(client, imageRef, registryAccess, output); err != nil {
+		printer.Info(status.IDImagePullError, "image.pull", "status=error target=%v message='%v'", imageRef, err)
+		return false
+	}
+
+	printer.Info(status.IDImagePull, "image.pull", "status=pulled target=%v", imageRef)
+	return true
+}
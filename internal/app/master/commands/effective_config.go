@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+)
+
+// EffectiveConfigFileName is the name of the file with the resolved command options
+const EffectiveConfigFileName = "effective-config.json"
+
+const redactedValue = "<redacted>"
+
+// the env var name parts for the values that are likely secrets (the names are compared in upper case)
+var secretEnvNameParts = []string{
+	"PASSWORD",
+	"PASSWD",
+	"SECRET",
+	"TOKEN",
+	"KEY",
+	"CREDENTIAL",
+	"AUTH",
+	"PRIVATE",
+	"SESSION",
+	"COOKIE",
+	"DSN",
+}
+
+type effectiveConfig struct {
+	Command             string                        `json:"command"`
+	Version             string                        `json:"version"`
+	Target              string                        `json:"target"`
+	TargetContainer     string                        `json:"target_container,omitempty"`
+	BuildFromDockerfile string                        `json:"build_from_dockerfile,omitempty"`
+	CustomImageTag      string                        `json:"custom_image_tag,omitempty"`
+	Debug               bool                          `json:"debug"`
+	DryRun              bool                          `json:"dry_run"`
+	StatePath           string                        `json:"state_path"`
+	StateDirNaming      string                        `json:"state_dir_naming"`
+	DockerClient        *config.DockerClient          `json:"docker_client"`
+	HTTPProbe           bool                          `json:"http_probe"`
+	HTTPProbeCmds       []config.HTTPProbeCmd         `json:"http_probe_cmds,omitempty"`
+	HTTPProbeRetryCount int                           `json:"http_probe_retry_count"`
+	HTTPProbeRetryWait  string                        `json:"http_probe_retry_wait"`
+	HTTPProbePorts      []uint16                      `json:"http_probe_ports,omitempty"`
+	HTTPProbeFull       bool                          `json:"http_probe_full"`
+	RemoveFileArtifacts bool                          `json:"remove_file_artifacts"`
+	CopyMetaArtifacts   string                        `json:"copy_meta_artifacts,omitempty"`
+	ArchiveState        string                        `json:"archive_state,omitempty"`
+	ShowContainerLogs   bool                          `json:"show_container_logs"`
+	ShowBuildLogs       bool                          `json:"show_build_logs"`
+	ImageOverrides      map[string]bool               `json:"image_overrides,omitempty"`
+	ContainerOverrides  *config.ContainerOverrides    `json:"container_overrides,omitempty"`
+	ImageInstructions   *config.ImageNewInstructions  `json:"image_instructions,omitempty"`
+	Links               []string                      `json:"links,omitempty"`
+	EtcHostsMaps        []string                      `json:"etc_hosts_maps,omitempty"`
+	DNSServers          []string                      `json:"dns_servers,omitempty"`
+	DNSSearchDomains    []string                      `json:"dns_search_domains,omitempty"`
+	IsolatedNetwork     bool                          `json:"isolated_network"`
+	VolumeMounts        map[string]config.VolumeMount `json:"volume_mounts,omitempty"`
+	ExcludePaths        map[string]bool               `json:"exclude_paths,omitempty"`
+	IncludePaths        map[string]bool               `json:"include_paths,omitempty"`
+	IncludePathMaps     map[string]string             `json:"include_path_maps,omitempty"`
+	IncludeBins         map[string]bool               `json:"include_bins,omitempty"`
+	IncludeExes         map[string]bool               `json:"include_exes,omitempty"`
+	IncludeShell        bool                          `json:"include_shell"`
+	IncludeZoneinfo     bool                          `json:"include_zoneinfo,omitempty"`
+	IncludeLocales      []string                      `json:"include_locales,omitempty"`
+	DetectSecrets       bool                          `json:"detect_secrets,omitempty"`
+	ExcludeSecrets      bool                          `json:"exclude_secrets,omitempty"`
+	SensorMount         *config.SensorMount           `json:"sensor_mount,omitempty"`
+	SeccompBaseline     *config.SeccompBaseline       `json:"seccomp_baseline,omitempty"`
+	SeccompOptions      *config.SeccompOptions        `json:"seccomp_options,omitempty"`
+	AppArmorOptions     *config.AppArmorOptions       `json:"apparmor_options,omitempty"`
+	TestProfiles        bool                          `json:"test_profiles,omitempty"`
+	GenPolicy           bool                          `json:"gen_policy,omitempty"`
+	HardenFiles         bool                          `json:"harden_files,omitempty"`
+	StripBinaries       bool                          `json:"strip_binaries,omitempty"`
+	StripExclude        []string                      `json:"strip_exclude,omitempty"`
+	ArtifactHooks       []string                      `json:"artifact_hooks,omitempty"`
+	IncludeNew          map[string]string             `json:"include_new,omitempty"`
+	LoaderCheck         string                        `json:"loader_check,omitempty"`
+	CheckEntrypoint     bool                          `json:"check_entrypoint,omitempty"`
+	Reproducible        bool                          `json:"reproducible,omitempty"`
+	LayerStrategy       *config.LayerStrategy         `json:"layer_strategy,omitempty"`
+	SlimBase            string                        `json:"slim_base,omitempty"`
+	SharedLayer         string                        `json:"shared_layer,omitempty"`
+	OCILayout           string                        `json:"oci_layout,omitempty"`
+	EmbedProfiles       *config.EmbedProfiles         `json:"embed_profiles,omitempty"`
+	UseCache            bool                          `json:"use_cache,omitempty"`
+	Resume              bool                          `json:"resume,omitempty"`
+	ContinueAfter       string                        `json:"continue_after"`
+	ContinueTimeout     string                        `json:"continue_timeout,omitempty"`
+	ExecTimeout         string                        `json:"exec_timeout,omitempty"`
+}
+
+func (c *effectiveConfig) setContinueAfter(continueAfter *config.ContinueAfter) {
+	if continueAfter == nil {
+		return
+	}
+
+	c.ContinueAfter = continueAfter.Mode
+	if continueAfter.Mode == "timeout" || continueAfter.Mode == "healthcheck" {
+		c.ContinueTimeout = continueAfter.Timeout.String()
+	}
+}
+
+// setContainerOverrides saves the container overrides without the secret env var values
+// (the secrets are only for the monitored container) and without the env var values that look like secrets
+func (c *effectiveConfig) setContainerOverrides(overrides *config.ContainerOverrides) {
+	if overrides == nil {
+		c.ContainerOverrides = nil
+		return
+	}
+
+	saved := *overrides
+	saved.SecretEnv = nil
+	for _, envInfo := range overrides.SecretEnv {
+		saved.SecretEnv = append(saved.SecretEnv, redactEnv(envInfo))
+	}
+
+	saved.Env = maskSecretEnv(overrides.Env)
+	c.ContainerOverrides = &saved
+}
+
+// setImageInstructions saves the new image instructions without the env var values that look like secrets
+func (c *effectiveConfig) setImageInstructions(instructions *config.ImageNewInstructions) {
+	if instructions == nil {
+		c.ImageInstructions = nil
+		return
+	}
+
+	saved := *instructions
+	saved.Env = maskSecretEnv(instructions.Env)
+	c.ImageInstructions = &saved
+}
+
+// maskSecretEnv returns the env vars with the redacted values for the names that look like secrets
+// and for the values with the URL credentials (e.g., 'postgres://user:password@db/app')
+func maskSecretEnv(env []string) []string {
+	if env == nil {
+		return nil
+	}
+
+	masked := make([]string, 0, len(env))
+	for _, envInfo := range env {
+		if isSecretEnv(envInfo) {
+			envInfo = redactEnv(envInfo)
+		}
+
+		masked = append(masked, envInfo)
+	}
+
+	return masked
+}
+
+func isSecretEnv(envInfo string) bool {
+	idx := strings.Index(envInfo, "=")
+	if idx < 0 {
+		return false
+	}
+
+	name := strings.ToUpper(envInfo[:idx])
+	for _, part := range secretEnvNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+
+	if value := envInfo[idx+1:]; strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// redactEnv replaces the env var value ('name=value' or 'name' for the host env vars)
+func redactEnv(envInfo string) string {
+	if idx := strings.Index(envInfo, "="); idx >= 0 {
+		return envInfo[:idx+1] + redactedValue
+	}
+
+	return envInfo
+}
+
+func (c *effectiveConfig) setHTTPProbeCmds(cmds []config.HTTPProbeCmd) {
+	c.HTTPProbeCmds = nil
+	for _, cmd := range cmds {
+		if cmd.Password != "" {
+			cmd.Password = redactedValue
+		}
+
+		c.HTTPProbeCmds = append(c.HTTPProbeCmds, cmd)
+	}
+}
+
+// hash returns the effective configuration hash (without the resume option)
+func (c effectiveConfig) hash() (string, error) {
+	c.Version = v.Current()
+	c.Resume = false
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *effectiveConfig) save(artifactLocation string) error {
+	c.Version = v.Current()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(artifactLocation, 0777); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(artifactLocation, EffectiveConfigFileName), data, 0644)
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ExecTimeoutExitCode is the exit code used when a command runs longer than its execution timeout
+const ExecTimeoutExitCode = -125
+
+// InterruptExitCode is the exit code used when a command is interrupted with SIGINT or SIGTERM
+// (the shells report it as 130, like for the other interrupted commands)
+const InterruptExitCode = -126
+
+// execTimeout bounds the command execution time and handles the command interrupts
+// (both run the cleanup function for the current command phase before the command exits)
+type execTimeout struct {
+	mu          sync.Mutex
+	timer       *time.Timer
+	sigChan     chan os.Signal
+	cleanup     func()
+	onTimeout   func()
+	onInterrupt func(sig os.Signal)
+}
+
+// newExecTimeout starts the execution timer (the timer is not started if the timeout is not set)
+func newExecTimeout(timeout time.Duration, onTimeout func()) *execTimeout {
+	t := &execTimeout{
+		onTimeout: onTimeout,
+	}
+
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, t.expire)
+	}
+
+	return t
+}
+
+func (t *execTimeout) expire() {
+	//holding the lock until the app exits keeps the command from changing the cleanup handler
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cleanup != nil {
+		log.Debug("execTimeout: running cleanup...")
+		t.cleanup()
+	}
+
+	t.onTimeout()
+}
+
+// handleInterrupts runs the cleanup and the interrupt handler when the command gets SIGINT or SIGTERM
+// (the second signal exits right away, so a stuck cleanup can still be interrupted)
+func (t *execTimeout) handleInterrupts(onInterrupt func(sig os.Signal)) {
+	t.onInterrupt = onInterrupt
+	t.sigChan = make(chan os.Signal, 2)
+	signal.Notify(t.sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func(sigChan chan os.Signal) {
+		sig, ok := <-sigChan
+		if !ok {
+			return
+		}
+
+		go func() {
+			if _, ok := <-sigChan; ok {
+				log.Debug("execTimeout: second interrupt signal, exiting...")
+				os.Exit(InterruptExitCode)
+			}
+		}()
+
+		t.interrupt(sig)
+	}(t.sigChan)
+}
+
+func (t *execTimeout) interrupt(sig os.Signal) {
+	//holding the lock until the app exits keeps the command from changing the cleanup handler
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	log.Infof("execTimeout: interrupted (%v), cleaning up...", sig)
+	if t.cleanup != nil {
+		t.cleanup()
+	}
+
+	t.onInterrupt(sig)
+}
+
+// setCleanup selects the function that tears down the resources for the current command phase
+func (t *execTimeout) setCleanup(cleanup func()) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.cleanup = cleanup
+	t.mu.Unlock()
+}
+
+// stop disables the execution timer and the interrupt handling
+func (t *execTimeout) stop() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+
+	if t.sigChan != nil {
+		signal.Stop(t.sigChan)
+		close(t.sigChan)
+		t.sigChan = nil
+	}
+
+	t.cleanup = nil
+	t.mu.Unlock()
+}
@@ -1,11 +1,15 @@
 package commands
 
 import (
-	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
@@ -15,15 +19,21 @@ import (
 	"github.com/dustin/go-humanize"
 )
 
+// ociLayoutDirName is the image state subdirectory for the images fetched directly from the registries
+const ociLayoutDirName = "oci"
+
 // OnInfo implements the 'info' docker-slim command
 func OnInfo(
 	doCheckVersion bool,
 	cmdReportLocation string,
 	doDebug bool,
 	statePath string,
+	stateDirNaming string,
 	clientConfig *config.DockerClient,
+	registryAccess *config.RegistryAccess,
 	imageRef string) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "info"})
+	printer := status.New("info")
 
 	viChan := version.CheckAsync(doCheckVersion)
 
@@ -31,10 +41,40 @@ func OnInfo(
 	cmdReport.State = report.CmdStateStarted
 	cmdReport.OriginalImage = imageRef
 
-	fmt.Println("docker-slim[info]: state=started")
-	fmt.Printf("docker-slim[info]: info=params target=%v\n", imageRef)
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "target=%v", imageRef)
+
+	if registryAccess.Direct {
+		onRegistryDirectInfo(logger, printer, statePath, stateDirNaming, registryAccess, imageRef)
+
+		printer.State(status.IDCompleted, "completed", "")
+		cmdReport.State = report.CmdStateCompleted
+		printer.State(status.IDDone, "done", "")
+
+		vinfo := <-viChan
+		version.PrintCheckVersion(vinfo)
+
+		cmdReport.State = report.CmdStateDone
+		cmdReport.Save()
+		return
+	}
+
+	dockerClient := dockerclient.New(clientConfig)
+	err := dockerclient.CheckConnection(dockerClient, clientConfig)
+	if err == nil {
+		dockerClient, err = dockerclient.NegotiateAPIVersion(dockerClient, clientConfig)
+	}
+
+	if err != nil {
+		printer.Info(status.IDDockerConnectError, "docker.connect.error", "message='%v'", err)
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	//the transient Docker API errors (e.g., from the flaky CI daemons) are retried
+	client := dockerclient.WithRetries(dockerclient.NewAPIClient(dockerClient, clientConfig.APIVersion), clientConfig.Retries, clientConfig.RetryBackoff)
 
-	client := dockerclient.New(clientConfig)
+	printDockerEndpoint(printer, clientConfig)
 
 	if doDebug {
 		version.Print(client, false)
@@ -43,9 +83,10 @@ func OnInfo(
 	imageInspector, err := image.NewInspector(client, imageRef)
 	errutil.FailOn(err)
 
-	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[info]: target image not found -", imageRef)
-		fmt.Println("docker-slim[info]: state=exited")
+	if imageInspector.NoImage() &&
+		!pullTargetImage(printer, client, imageRef, registryAccess, doDebug) {
+		printer.Info(status.IDImageNotFound, "image.error", "status=not.found target=%v message='target image not found'", imageRef)
+		printer.Exited()
 		return
 	}
 
@@ -53,10 +94,10 @@ func OnInfo(
 	err = imageInspector.Inspect()
 	errutil.FailOn(err)
 
-	_, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageInspector.ImageInfo.ID)
+	_, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageStateKey(stateDirNaming, imageInspector))
 	imageInspector.ArtifactLocation = artifactLocation
 
-	fmt.Printf("docker-slim[info]: info=image id=%v size.bytes=%v size.human=%v\n",
+	printer.Info(status.IDImageInfo, "image", "id=%v size.bytes=%v size.human=%v",
 		imageInspector.ImageInfo.ID,
 		imageInspector.ImageInfo.VirtualSize,
 		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
@@ -65,10 +106,10 @@ func OnInfo(
 	err = imageInspector.ProcessCollectedData()
 	errutil.FailOn(err)
 
-	fmt.Println("docker-slim[info]: state=completed")
+	printer.State(status.IDCompleted, "completed", "")
 	cmdReport.State = report.CmdStateCompleted
 
-	fmt.Println("docker-slim[info]: state=done")
+	printer.State(status.IDDone, "done", "")
 
 	vinfo := <-viChan
 	version.PrintCheckVersion(vinfo)
@@ -76,3 +117,78 @@ func OnInfo(
 	cmdReport.State = report.CmdStateDone
 	cmdReport.Save()
 }
+
+// onRegistryDirectInfo inspects the target image fetched directly from its registry
+// (the image is saved in the OCI image layout format in the image state directory)
+func onRegistryDirectInfo(logger *log.Entry,
+	printer *status.Printer,
+	statePath string,
+	stateDirNaming string,
+	registryAccess *config.RegistryAccess,
+	imageRef string) {
+	remoteImage, _, artifactLocation, _ := saveRemoteImage(logger, printer, statePath, stateDirNaming,
+		registryAccess, imageRef, registryAccess.Pull, false)
+
+	logger.Info("processing 'fat' image info...")
+	dockerfileInfo, err := dockerfile.ReverseDockerfile(remoteImage.History())
+	errutil.FailOn(err)
+
+	err = dockerfile.SaveDockerfileData(filepath.Join(artifactLocation, image.FatDockerfileName), dockerfileInfo.Lines)
+	errutil.FailOn(err)
+}
+
+// saveRemoteImage fetches the target image directly from its registry and saves it in the OCI image layout
+// in the image state directory (the layers are downloaded only if withLayers is true).
+// It returns the image, the image state directory, the artifact location and the OCI image layout location.
+func saveRemoteImage(logger *log.Entry,
+	printer *status.Printer,
+	statePath string,
+	stateDirNaming string,
+	registryAccess *config.RegistryAccess,
+	imageRef string,
+	withLayers bool,
+	requireLinux bool) (*registry.RemoteImage, string, string, string) {
+	client := registry.NewRemoteClient(registryAccess)
+
+	logger.Info("fetching 'fat' image metadata from the registry...")
+	remoteImage, err := client.FetchImage(imageRef)
+	if err != nil {
+		printer.Info(status.IDImageNotFound, "image.error", "status=not.found target=%v message='%v'", imageRef, err)
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	//the static file selection works only with the Linux images
+	//(the Windows images have the PE executables and the foreign base layers)
+	if requireLinux && remoteImage.Config.OS == "windows" {
+		printer.Info(status.IDDockerWindowsContainers, "docker.windows.containers",
+			"target=%v message='the Windows container images can't be minified, use the info command to inspect them'", imageRef)
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	stateKey := remoteImage.ID()
+	if stateDirNaming == config.StateDirNameByTag || stateDirNaming == config.StateDirNameByTagTimestamp {
+		stateKey = stateKeyReplacer.Replace(imageRef)
+	}
+
+	localVolumePath, artifactLocation, _ := fsutil.PrepareImageStateDirs(statePath, stateKey)
+
+	layoutPath := filepath.Join(localVolumePath, ociLayoutDirName)
+	if withLayers {
+		printer.Info(status.IDImagePull, "image.pull", "status=pulling target=%v", imageRef)
+	}
+
+	err = client.SaveLayout(remoteImage, layoutPath, withLayers)
+	errutil.FailOn(err)
+
+	printer.Info(status.IDImageInfo, "image", "id=%v size.bytes=%v size.human=%v os=%v arch=%v oci.layout='%v'",
+		remoteImage.ID(),
+		remoteImage.Size(),
+		humanize.Bytes(uint64(remoteImage.Size())),
+		remoteImage.Config.OS,
+		remoteImage.Config.Architecture,
+		layoutPath)
+
+	return remoteImage, localVolumePath, artifactLocation, layoutPath
+}
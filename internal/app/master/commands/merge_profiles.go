@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the generated profile file name patterns (the same patterns the image inspector uses)
+const (
+	mergedSeccompProfileNamePat  = "%s-seccomp.json"
+	mergedAppArmorProfileNamePat = "%s-apparmor-profile"
+	seccompProfileSuffix         = "-seccomp.json"
+	appArmorProfileSuffix        = "-apparmor-profile"
+)
+
+func loadContainerReport(artifactLocation string) (*report.ContainerReport, error) {
+	reportData, err := ioutil.ReadFile(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var creport report.ContainerReport
+	if err := json.Unmarshal(reportData, &creport); err != nil {
+		return nil, fmt.Errorf("invalid container report in %s: %v", artifactLocation, err)
+	}
+
+	return &creport, nil
+}
+
+// containerProfiles finds the security profiles generated for the container in its artifact directory
+func containerProfiles(artifactLocation string) report.ContainerProfiles {
+	profiles := report.ContainerProfiles{ArtifactLocation: artifactLocation}
+	names, err := ioutil.ReadDir(artifactLocation)
+	if err != nil {
+		return profiles
+	}
+
+	for _, info := range names {
+		switch {
+		case strings.HasSuffix(info.Name(), seccompProfileSuffix):
+			profiles.SeccompProfileName = info.Name()
+		case strings.HasSuffix(info.Name(), appArmorProfileSuffix):
+			profiles.AppArmorProfileName = info.Name()
+		}
+	}
+
+	return profiles
+}
+
+// OnMergeProfiles implements the 'merge-profiles' docker-slim command
+// (it creates the pod-level seccomp and AppArmor profiles covering all containers
+// using the data collected by the 'build' or 'profile' commands)
+func OnMergeProfiles(
+	cmdReportLocation string,
+	artifactLocations []string,
+	outputLocation string,
+	profileName string,
+	seccompBaseline *config.SeccompBaseline,
+	seccompOptions *config.SeccompOptions,
+	appArmorOptions *config.AppArmorOptions) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "merge-profiles"})
+	printer := status.New("merge-profiles")
+
+	cmdReport := report.NewMergeProfilesCommand(cmdReportLocation)
+	cmdReport.State = report.CmdStateStarted
+
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "artifacts=[%v] output='%v' name=%v",
+		strings.Join(artifactLocations, ","), outputLocation, profileName)
+
+	fail := func(err error) {
+		printer.Info(status.IDProfilesMergeError, "profiles.merge.error", "message='%v'", err)
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = err.Error()
+		cmdReport.Save()
+		printer.Exited()
+	}
+
+	var creports []*report.ContainerReport
+	for _, location := range artifactLocations {
+		creport, err := loadContainerReport(location)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		creports = append(creports, creport)
+		cmdReport.Containers = append(cmdReport.Containers, containerProfiles(location))
+	}
+
+	merged, err := report.MergeContainerReports(creports)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if err := os.MkdirAll(outputLocation, 0777); err != nil {
+		fail(err)
+		return
+	}
+
+	//the merged container report is the input for the profile generators
+	reportData, err := json.MarshalIndent(merged, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(outputLocation, report.DefaultContainerReportFileName), reportData, 0644)
+	}
+
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	cmdReport.OutputLocation = outputLocation
+	cmdReport.AppArmorProfileName = fmt.Sprintf(mergedAppArmorProfileNamePat, profileName)
+	cmdReport.SeccompProfileName = fmt.Sprintf(mergedSeccompProfileNamePat, profileName)
+
+	logger.Info("generating merged AppArmor profile...")
+	if err := apparmor.GenProfile(outputLocation, cmdReport.AppArmorProfileName, appArmorOptions); err != nil {
+		fail(err)
+		return
+	}
+
+	logger.Info("generating merged seccomp profile...")
+	if err := seccomp.GenProfile(outputLocation, cmdReport.SeccompProfileName, seccompBaseline, seccompOptions); err != nil {
+		fail(err)
+		return
+	}
+
+	printer.State(status.IDCompleted, "completed", "")
+	cmdReport.State = report.CmdStateCompleted
+
+	for _, container := range cmdReport.Containers {
+		printer.Info(status.IDResultsContainer, "results", "container.artifacts='%v' seccomp=%v apparmor=%v",
+			container.ArtifactLocation,
+			container.SeccompProfileName,
+			container.AppArmorProfileName)
+	}
+
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.location='%v'", cmdReport.OutputLocation)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.seccomp=%v", cmdReport.SeccompProfileName)
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.apparmor=%v", cmdReport.AppArmorProfileName)
+
+	printer.State(status.IDDone, "done", "")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+}
@@ -0,0 +1,271 @@
+package commands
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the monitor cache is a snapshot (a tar archive) of the artifact directory taken right after
+//  the container artifacts are processed (before the builder passes change the artifact files)
+//* the cache key includes the image ID, the docker-slim version and all options that change
+//  what the instrumented container does or what the sensor collects (the image build options are not included)
+//* the archive keeps the file modes, owners and symlinks (the minified image files are built from it)
+
+// monitorCacheDirName is the image state subdirectory for the cached container monitoring results
+const monitorCacheDirName = "monitor-cache"
+
+// monitorCacheKey is the data for the monitor cache key
+type monitorCacheKey struct {
+	Version          string                        `json:"version"`
+	ImageID          string                        `json:"image_id"`
+	TargetContainer  string                        `json:"target_container,omitempty"`
+	Overrides        *config.ContainerOverrides    `json:"overrides,omitempty"`
+	Links            []string                      `json:"links,omitempty"`
+	EtcHostsMaps     []string                      `json:"etc_hosts_maps,omitempty"`
+	DNSServers       []string                      `json:"dns_servers,omitempty"`
+	DNSSearchDomains []string                      `json:"dns_search_domains,omitempty"`
+	IsolatedNetwork  bool                          `json:"isolated_network"`
+	VolumeMounts     map[string]config.VolumeMount `json:"volume_mounts,omitempty"`
+	ExcludePaths     map[string]bool               `json:"exclude_paths,omitempty"`
+	IncludePaths     map[string]bool               `json:"include_paths,omitempty"`
+	IncludePathMaps  map[string]string             `json:"include_path_maps,omitempty"`
+	IncludeBins      map[string]bool               `json:"include_bins,omitempty"`
+	IncludeExes      map[string]bool               `json:"include_exes,omitempty"`
+	IncludeShell     bool                          `json:"include_shell"`
+	IncludeZoneinfo  bool                          `json:"include_zoneinfo"`
+	IncludeLocales   []string                      `json:"include_locales,omitempty"`
+	DetectSecrets    bool                          `json:"detect_secrets"`
+	ExcludeSecrets   bool                          `json:"exclude_secrets"`
+	SeccompBaseline  *config.SeccompBaseline       `json:"seccomp_baseline,omitempty"`
+	SeccompOptions   *config.SeccompOptions        `json:"seccomp_options,omitempty"`
+	AppArmorOptions  *config.AppArmorOptions       `json:"apparmor_options,omitempty"`
+	HTTPProbe        bool                          `json:"http_probe"`
+	HTTPProbeCmds    []config.HTTPProbeCmd         `json:"http_probe_cmds,omitempty"`
+	HTTPProbePorts   []uint16                      `json:"http_probe_ports,omitempty"`
+	HTTPProbeFull    bool                          `json:"http_probe_full"`
+	ContinueAfter    string                        `json:"continue_after"`
+	ContinueTimeout  time.Duration                 `json:"continue_timeout,omitempty"`
+	HealthyChecks    int                           `json:"healthy_checks,omitempty"`
+}
+
+// hash returns the monitor cache key value (the key data hash)
+func (k *monitorCacheKey) hash() (string, error) {
+	k.Version = v.Current()
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func monitorCachePath(localVolumePath, key string) string {
+	return filepath.Join(localVolumePath, monitorCacheDirName, key+".tar")
+}
+
+// saveMonitorCache saves the artifact directory snapshot (without the effective config file)
+func saveMonitorCache(artifactLocation, cachePath string) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0777); err != nil {
+		return err
+	}
+
+	//the archive is renamed when it's complete, so an interrupted build doesn't leave a broken cache record
+	tmpFile, err := ioutil.TempFile(filepath.Dir(cachePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	err = writeMonitorCache(tmpFile, artifactLocation)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), cachePath)
+}
+
+func writeMonitorCache(out io.Writer, dir string) error {
+	tw := tar.NewWriter(out)
+	err := filepath.Walk(dir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(fullPath, dir), string(filepath.Separator))
+		if name == "" || name == EffectiveConfigFileName {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fullPath); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// restoreMonitorCache extracts the cached artifact directory snapshot to the artifact directory
+// (it returns false if there's no cache record for the key)
+func restoreMonitorCache(cachePath, artifactLocation string) (bool, error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+	defer file.Close()
+
+	type dirInfo struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}
+
+	//the directory modes and times are set last
+	//(the extracted files change the times and the read-only directories can't get new files)
+	var dirs []dirInfo
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		target := filepath.Join(artifactLocation, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return false, err
+		}
+
+		mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return false, err
+			}
+
+			dirs = append(dirs, dirInfo{path: target, mode: mode, modTime: hdr.ModTime})
+		case tar.TypeReg, tar.TypeRegA:
+			os.Remove(target)
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				return false, err
+			}
+
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return false, err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return false, err
+			}
+		case tar.TypeLink:
+			linkName := path.Clean("/" + hdr.Linkname)
+			os.Remove(target)
+			if err := os.Link(filepath.Join(artifactLocation, filepath.FromSlash(linkName)), target); err != nil {
+				return false, err
+			}
+
+			continue
+		default:
+			log.Debugf("restoreMonitorCache: skipping unsupported entry type (%v) => %v", hdr.Typeflag, hdr.Name)
+			continue
+		}
+
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			log.Debugf("restoreMonitorCache: error setting the file owner (%v) => %v", target, err)
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		if err := os.Chmod(target, mode); err != nil {
+			return false, err
+		}
+
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			log.Debugf("restoreMonitorCache: error setting the file times (%v) => %v", target, err)
+		}
+	}
+
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		if err := os.Chmod(dirs[idx].path, dirs[idx].mode); err != nil {
+			return false, err
+		}
+
+		if err := os.Chtimes(dirs[idx].path, dirs[idx].modTime, dirs[idx].modTime); err != nil {
+			log.Debugf("restoreMonitorCache: error setting the directory times (%v) => %v", dirs[idx].path, err)
+		}
+	}
+
+	return true, nil
+}
@@ -11,6 +11,9 @@ import (
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/http"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/progress"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
@@ -26,30 +29,44 @@ func OnProfile(
 	doCheckVersion bool,
 	cmdReportLocation string,
 	doDebug bool,
+	doDryRun bool,
 	statePath string,
+	stateDirNaming string,
 	clientConfig *config.DockerClient,
+	registryAccess *config.RegistryAccess,
 	imageRef string,
 	doHTTPProbe bool,
 	httpProbeCmds []config.HTTPProbeCmd,
 	httpProbeRetryCount int,
-	httpProbeRetryWait int,
+	httpProbeRetryWait time.Duration,
 	httpProbePorts []uint16,
 	doHTTPProbeFull bool,
 	copyMetaArtifactsLocation string,
+	archiveStateLocation string,
 	doShowContainerLogs bool,
 	overrides *config.ContainerOverrides,
 	links []string,
 	etcHostsMaps []string,
 	dnsServers []string,
 	dnsSearchDomains []string,
+	doIsolatedNetwork bool,
 	volumeMounts map[string]config.VolumeMount,
 	excludePaths map[string]bool,
 	includePaths map[string]bool,
+	includePathMaps map[string]string,
 	includeBins map[string]bool,
 	includeExes map[string]bool,
 	doIncludeShell bool,
-	continueAfter *config.ContinueAfter) {
+	doIncludeZoneinfo bool,
+	includeLocales []string,
+	sensorMount *config.SensorMount,
+	seccompBaseline *config.SeccompBaseline,
+	seccompOptions *config.SeccompOptions,
+	appArmorOptions *config.AppArmorOptions,
+	continueAfter *config.ContinueAfter,
+	execTimeout time.Duration) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "profile"})
+	printer := status.New("profile")
 
 	viChan := version.CheckAsync(doCheckVersion)
 
@@ -57,41 +74,142 @@ func OnProfile(
 	cmdReport.State = report.CmdStateStarted
 	cmdReport.OriginalImage = imageRef
 
-	fmt.Println("docker-slim[profile]: state=started")
-	fmt.Printf("docker-slim[profile]: info=params target=%v\n", imageRef)
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "target=%v", imageRef)
+
+	cmdReport.SecurityWarnings = container.SecurityWarnings(overrides)
+	for _, warning := range cmdReport.SecurityWarnings {
+		printer.Info(status.IDContainerSecurityWarning, "container.security.warning", "message='WARNING: %s'", warning)
+	}
 	doRmFileArtifacts := false
 
-	client := dockerclient.New(clientConfig)
+	dockerClient := dockerclient.New(clientConfig)
+	err := dockerclient.CheckConnection(dockerClient, clientConfig)
+	if err == nil {
+		dockerClient, err = dockerclient.NegotiateAPIVersion(dockerClient, clientConfig)
+	}
+
+	if err != nil {
+		printer.Info(status.IDDockerConnectError, "docker.connect.error", "message='%v'", err)
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	//the transient Docker API errors (e.g., from the flaky CI daemons) are retried
+	//and the containers and networks docker-slim creates are tracked (they are removed if the command is interrupted)
+	resources := dockerclient.NewResourceTracker(dockerclient.WithRetries(dockerclient.NewAPIClient(dockerClient, clientConfig.APIVersion), clientConfig.Retries, clientConfig.RetryBackoff))
+	var client dockerclient.API = resources
+
+	printDockerEndpoint(printer, clientConfig)
+
+	//the sensor and the minified image builder work only with the Linux containers
+	if dockerclient.IsWindowsDaemon(client) {
+		printer.Info(status.IDDockerWindowsContainers, "docker.windows.containers",
+			"message='the profile command needs a Docker daemon with Linux containers (switch Docker Desktop to Linux containers), use the info command to inspect Windows container images'")
+		printer.Exited()
+		os.Exit(-1)
+	}
+
+	requireAPIFeatures(printer, clientConfig, overrides)
+	warnRootlessPodman(printer, client, clientConfig)
+
+	effConfig := &effectiveConfig{
+		Command:             "profile",
+		Target:              imageRef,
+		Debug:               doDebug,
+		DryRun:              doDryRun,
+		StatePath:           statePath,
+		StateDirNaming:      stateDirNaming,
+		DockerClient:        clientConfig,
+		HTTPProbe:           doHTTPProbe,
+		HTTPProbeRetryCount: httpProbeRetryCount,
+		HTTPProbeRetryWait:  httpProbeRetryWait.String(),
+		HTTPProbePorts:      httpProbePorts,
+		HTTPProbeFull:       doHTTPProbeFull,
+		CopyMetaArtifacts:   copyMetaArtifactsLocation,
+		ArchiveState:        archiveStateLocation,
+		ShowContainerLogs:   doShowContainerLogs,
+		Links:               links,
+		EtcHostsMaps:        etcHostsMaps,
+		DNSServers:          dnsServers,
+		DNSSearchDomains:    dnsSearchDomains,
+		IsolatedNetwork:     doIsolatedNetwork,
+		VolumeMounts:        volumeMounts,
+		ExcludePaths:        excludePaths,
+		IncludePaths:        includePaths,
+		IncludePathMaps:     includePathMaps,
+		IncludeBins:         includeBins,
+		IncludeExes:         includeExes,
+		IncludeShell:        doIncludeShell,
+		IncludeZoneinfo:     doIncludeZoneinfo,
+		IncludeLocales:      includeLocales,
+		SensorMount:         sensorMount,
+		SeccompBaseline:     seccompBaseline,
+		SeccompOptions:      seccompOptions,
+		AppArmorOptions:     appArmorOptions,
+	}
+	effConfig.setContainerOverrides(overrides)
+	effConfig.setHTTPProbeCmds(httpProbeCmds)
+	effConfig.setContinueAfter(continueAfter)
+	if execTimeout > 0 {
+		effConfig.ExecTimeout = execTimeout.String()
+	}
+
+	execTimer := newExecTimeout(execTimeout, func() {
+		printer.Info(status.IDExecTimeout, "exec.timeout", "timeout=%v message='command execution timeout, stopping'", execTimeout)
+		resources.RemoveAll()
+		cmdReport.State = report.CmdStateTimeout
+		cmdReport.Error = "execution timeout"
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(ExecTimeoutExitCode)
+	})
+	execTimer.handleInterrupts(func(sig os.Signal) {
+		printer.Info(status.IDInterrupted, "interrupted", "signal=%v message='command interrupted, removing the temporary containers, networks and images'", sig)
+		resources.RemoveAll()
+		cmdReport.State = report.CmdStateInterrupted
+		cmdReport.Error = fmt.Sprintf("interrupted (%v)", sig)
+		cmdReport.Save()
+		printer.Exited()
+		os.Exit(InterruptExitCode)
+	})
+	defer execTimer.stop()
 
 	if doDebug {
 		version.Print(client, false)
 	}
 
 	if !confirmNetwork(logger, client, overrides.Network) {
-		fmt.Printf("docker-slim[profile]: info=param.error status=unknown.network value=%s\n", overrides.Network)
-		fmt.Printf("docker-slim[profile]: state=exited version=%s\n", v.Current())
+		printer.Info(status.IDParamError, "param.error", "status=unknown.network value=%s", overrides.Network)
+		printer.Info(status.IDParamHint, "param.hint", "message='use one of the existing Docker networks (see docker network ls) or --network host|bridge|none'")
+		printer.Exited()
 		os.Exit(-111)
 	}
 
 	imageInspector, err := image.NewInspector(client, imageRef)
 	errutil.FailOn(err)
 
-	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[profile]: target image not found -", imageRef)
-		fmt.Println("docker-slim[profile]: state=exited")
+	if imageInspector.NoImage() &&
+		!pullTargetImage(printer, client, imageRef, registryAccess, doDebug) {
+		printer.Info(status.IDImageNotFound, "image.error", "status=not.found target=%v message='target image not found'", imageRef)
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[profile]: state=image.inspection.start")
+	printer.State(status.IDImageInspectionStart, "image.inspection.start", "")
 
 	logger.Info("inspecting 'fat' image metadata...")
 	err = imageInspector.Inspect()
 	errutil.FailOn(err)
 
-	localVolumePath, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageInspector.ImageInfo.ID)
+	localVolumePath, artifactLocation, statePath := fsutil.PrepareImageStateDirs(statePath, imageStateKey(stateDirNaming, imageInspector))
 	imageInspector.ArtifactLocation = artifactLocation
 
-	fmt.Printf("docker-slim[profile]: info=image id=%v size.bytes=%v size.human=%v\n",
+	if err := effConfig.save(artifactLocation); err != nil {
+		logger.Infof("could not save the effective configuration - %v", err)
+	}
+
+	printer.Info(status.IDImageInfo, "image", "id=%v size.bytes=%v size.human=%v",
 		imageInspector.ImageInfo.ID,
 		imageInspector.ImageInfo.VirtualSize,
 		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
@@ -100,35 +218,75 @@ func OnProfile(
 	err = imageInspector.ProcessCollectedData()
 	errutil.FailOn(err)
 
-	fmt.Println("docker-slim[profile]: state=image.inspection.done")
-	fmt.Println("docker-slim[profile]: state=container.inspection.start")
+	printer.State(status.IDImageInspectionDone, "image.inspection.done", "")
+	printer.State(status.IDContainerInspectionStart, "container.inspection.start", "")
 
 	containerInspector, err := container.NewInspector(client,
 		statePath,
 		imageInspector,
 		localVolumePath,
+		"",
 		overrides,
 		links,
 		etcHostsMaps,
 		dnsServers,
 		dnsSearchDomains,
+		doIsolatedNetwork,
 		doShowContainerLogs,
 		volumeMounts,
 		excludePaths,
 		includePaths,
+		includePathMaps,
 		includeBins,
 		includeExes,
 		doIncludeShell,
+		doIncludeZoneinfo,
+		includeLocales,
+		false,
+		false,
+		sensorMount,
+		seccompBaseline,
+		seccompOptions,
+		appArmorOptions,
 		doDebug,
 		true,
-		"docker-slim[profile]:")
+		printer)
 	errutil.FailOn(err)
 
+	containerInspector.CrashHandler = func(err *container.ContainerExitError) {
+		cmdReport.State = report.CmdStateCrashed
+		cmdReport.Error = err.Error()
+		cmdReport.ContainerExit = &report.ContainerExit{
+			ContainerID: err.ContainerID,
+			ExitCode:    err.ExitCode,
+			OOMKilled:   err.OOMKilled,
+			Restarted:   err.Restarted,
+			Stdout:      err.Stdout,
+			Stderr:      err.Stderr,
+		}
+		cmdReport.Save()
+	}
+
+	if doDryRun {
+		err = containerInspector.ShowContainerPlan()
+		errutil.FailOn(err)
+
+		printer.Info(status.IDDryRun, "dry.run", "message='the instrumented container is not created in the dry-run mode'")
+		printer.Exited()
+		cmdReport.State = report.CmdStateExited
+		cmdReport.Save()
+		return
+	}
+
 	logger.Info("starting instrumented 'fat' container...")
 	err = containerInspector.RunContainer()
 	errutil.FailOn(err)
 
-	fmt.Printf("docker-slim[build]: info=container name=%v id=%v target.port.list=[%v] target.port.info=[%v] message='YOU CAN USE THESE PORTS TO INTERACT WITH THE CONTAINER'\n",
+	execTimer.setCleanup(func() {
+		_ = containerInspector.TerminateContainer()
+	})
+
+	printer.Info(status.IDContainerInfo, "container", "name=%v id=%v target.port.list=[%v] target.port.info=[%v] message='YOU CAN USE THESE PORTS TO INTERACT WITH THE CONTAINER'",
 		containerInspector.ContainerName,
 		containerInspector.ContainerID,
 		containerInspector.ContainerPortList,
@@ -140,18 +298,44 @@ func OnProfile(
 		doHTTPProbe = true
 	}
 
+	if "healthcheck" == continueAfter.Mode {
+		printer.Info(status.IDPromptHealthcheck, "prompt", "message='waiting for the target container HEALTHCHECK to report healthy'")
+		pi := progress.Start(printer.Prefix(), "container.health")
+		err := containerInspector.WaitForHealthChecks(1, healthcheckTimeout(continueAfter, execTimeout))
+		pi.Stop()
+		if err != nil {
+			printer.State(status.IDHealthcheckError, "container.health.error", "error='%v' message='add a HEALTHCHECK instruction to your image or use a different continue-after mode'", err)
+			logger.Info("shutting down 'fat' container...")
+			execTimer.setCleanup(func() {
+				_ = containerInspector.ShutdownContainer()
+			})
+			containerInspector.FinishMonitoring()
+			_ = containerInspector.ShutdownContainer()
+			execTimer.setCleanup(nil)
+
+			printer.Exited()
+			return
+		}
+
+		printer.Info(status.IDHealthcheckDone, "event", "message='target container is healthy'")
+	}
+
 	if doHTTPProbe {
 		probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds,
 			httpProbeRetryCount, httpProbeRetryWait, httpProbePorts, doHTTPProbeFull,
-			true, "docker-slim[profile]:")
+			true, printer)
 		errutil.FailOn(err)
 		if len(probe.Ports) == 0 {
-			fmt.Println("docker-slim[profile]: state=http.probe.error error='no exposed ports' message='expose your service port with --expose or disable HTTP probing with --http-probe=false if your containerized application doesnt expose any network services")
+			printer.State(status.IDProbeError, "http.probe.error", "error='no exposed ports' message='expose your service port with --expose or disable HTTP probing with --http-probe=false if your containerized application doesnt expose any network services'")
 			logger.Info("shutting down 'fat' container...")
+			execTimer.setCleanup(func() {
+				_ = containerInspector.ShutdownContainer()
+			})
 			containerInspector.FinishMonitoring()
 			_ = containerInspector.ShutdownContainer()
+			execTimer.setCleanup(nil)
 
-			fmt.Println("docker-slim[profile]: state=exited")
+			printer.Exited()
 			return
 		}
 
@@ -161,61 +345,117 @@ func OnProfile(
 
 	switch continueAfter.Mode {
 	case "enter":
-		fmt.Println("docker-slim[profile]: info=prompt message='USER INPUT REQUIRED, PRESS <ENTER> WHEN YOU ARE DONE USING THE CONTAINER'")
+		if overrides.Interactive {
+			printer.Info(status.IDPromptInteractive, "prompt", "message='ATTACHING TO THE TARGET CONTAINER, PRESS <CTRL-P> <CTRL-Q> WHEN YOU ARE DONE USING IT'")
+			if err := containerInspector.AttachTerminal(); err != nil {
+				printer.Info(status.IDPromptInteractive, "prompt", "error='%v' message='interactive session failed, falling back to the <ENTER> prompt'", err)
+			} else {
+				printer.Info(status.IDInteractiveDone, "event", "message='detached from the target container'")
+				break
+			}
+		}
+
+		printer.Info(status.IDPromptEnter, "prompt", "message='USER INPUT REQUIRED, PRESS <ENTER> WHEN YOU ARE DONE USING THE CONTAINER'")
 		creader := bufio.NewReader(os.Stdin)
 		_, _, _ = creader.ReadLine()
 	case "signal":
-		fmt.Println("docker-slim[profile]: info=prompt message='send SIGUSR1 when you are done using the container'")
+		printer.Info(status.IDPromptSignal, "prompt", "message='send SIGUSR1 when you are done using the container'")
+		pi := progress.Start(printer.Prefix(), "container.monitoring")
 		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[profile]: info=event message='got SIGUSR1'")
+		pi.Stop()
+		printer.Info(status.IDSignalReceived, "event", "message='got SIGUSR1'")
 	case "timeout":
-		fmt.Printf("docker-slim[profile]: info=prompt message='waiting for the target container (%v seconds)'\n", int(continueAfter.Timeout))
-		<-time.After(time.Second * continueAfter.Timeout)
-		fmt.Printf("docker-slim[profile]: info=event message='done waiting for the target container'")
+		printer.Info(status.IDPromptTimeout, "prompt", "message='waiting for the target container (%v)'", continueAfter.Timeout)
+		pi := progress.Start(printer.Prefix(), "container.monitoring")
+		<-time.After(continueAfter.Timeout)
+		pi.Stop()
+		printer.Info(status.IDTimeoutDone, "event", "message='done waiting for the target container'")
 	case "probe":
-		fmt.Println("docker-slim[profile]: info=prompt message='waiting for the HTTP probe to finish'")
+		printer.Info(status.IDPromptProbe, "prompt", "message='waiting for the HTTP probe to finish'")
 		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[profile]: info=event message='HTTP probe is done'")
+		printer.Info(status.IDProbeDoneReceived, "event", "message='HTTP probe is done'")
+	case "healthcheck":
+		if doHTTPProbe {
+			printer.Info(status.IDPromptProbe, "prompt", "message='waiting for the HTTP probe to finish'")
+			<-continueAfter.ContinueChan
+			printer.Info(status.IDProbeDoneReceived, "event", "message='HTTP probe is done'")
+		}
+
+		if continueAfter.HealthyChecks > 1 {
+			printer.Info(status.IDPromptHealthcheck, "prompt", "message='waiting for %v healthy checks'", continueAfter.HealthyChecks)
+			pi := progress.Start(printer.Prefix(), "container.monitoring")
+			err := containerInspector.WaitForHealthChecks(continueAfter.HealthyChecks, healthcheckTimeout(continueAfter, execTimeout))
+			pi.Stop()
+			if err != nil {
+				//the collected data is still good, so the inspection continues
+				printer.Info(status.IDHealthcheckError, "container.health.error", "error='%v'", err)
+			} else {
+				printer.Info(status.IDHealthcheckDone, "event", "message='done waiting for the healthy checks'")
+			}
+		}
 	default:
 		errutil.Fail("unknown continue-after mode")
 	}
 
-	fmt.Println("docker-slim[profile]: state=container.inspection.finishing")
+	printer.State(status.IDContainerInspectionFinishing, "container.inspection.finishing", "")
+
+	execTimer.setCleanup(func() {
+		_ = containerInspector.ShutdownContainer()
+	})
 
+	pi := progress.Start(printer.Prefix(), "container.inspection.finishing")
 	containerInspector.FinishMonitoring()
+	pi.Stop()
 
 	logger.Info("shutting down 'fat' container...")
 	err = containerInspector.ShutdownContainer()
 	errutil.WarnOn(err)
+	execTimer.setCleanup(nil)
 
-	fmt.Println("docker-slim[profile]: state=container.inspection.artifact.processing")
+	printer.State(status.IDContainerArtifactProcessing, "container.inspection.artifact.processing", "")
 
 	if !containerInspector.HasCollectedData() {
 		imageInspector.ShowFatImageDockerInstructions()
-		fmt.Printf("docker-slim[profile]: info=results status='no data collected (no minified image generated). (version: %v)'\n",
+		printer.Info(status.IDResultsNoData, "results", "status='no data collected (no minified image generated). (version: %v)'",
 			v.Current())
-		fmt.Println("docker-slim[profile]: state=exited")
+		printer.Exited()
 		return
 	}
 
 	logger.Info("processing instrumented 'fat' container info...")
+	pi = progress.Start(printer.Prefix(), "container.artifact.processing")
 	err = containerInspector.ProcessCollectedData()
+	pi.Stop()
 	errutil.FailOn(err)
 
-	fmt.Println("docker-slim[profile]: state=container.inspection.done")
-	fmt.Println("docker-slim[profile]: state=completed")
+	printer.State(status.IDContainerInspectionDone, "container.inspection.done", "")
+	printer.State(status.IDCompleted, "completed", "")
 	cmdReport.State = report.CmdStateCompleted
 
 	if copyMetaArtifactsLocation != "" {
 		toCopy := []string{
 			report.DefaultContainerReportFileName,
+			EffectiveConfigFileName,
 			imageInspector.SeccompProfileName,
 			imageInspector.AppArmorProfileName,
 		}
+		if appArmorOptions != nil && appArmorOptions.Complain {
+			toCopy = append(toCopy, apparmor.ComplainProfileName(imageInspector.AppArmorProfileName))
+		}
+
 		if !copyMetaArtifacts(logger,
 			toCopy,
 			imageInspector.ArtifactLocation, copyMetaArtifactsLocation) {
-			fmt.Println("docker-slim[profile]: info=artifacts message='could not copy meta artifacts'")
+			printer.Info(status.IDMetaArtifactsError, "artifacts", "message='could not copy meta artifacts'")
+		}
+	}
+
+	if archiveStateLocation != "" {
+		logger.Infof("archiving state directory: %v => %v", localVolumePath, archiveStateLocation)
+		if err := fsutil.ArchiveDir(localVolumePath, archiveStateLocation); err == nil {
+			printer.Info(status.IDResultsStateArchive, "results", "state.archive='%v'", archiveStateLocation)
+		} else {
+			printer.Info(status.IDStateArchiveError, "state.archive", "status=error message='%v'", err)
 		}
 	}
 
@@ -225,7 +465,7 @@ func OnProfile(
 		errutil.WarnOn(err)
 	}
 
-	fmt.Println("docker-slim[profile]: state=done")
+	printer.State(status.IDDone, "done", "")
 
 	vinfo := <-viChan
 	version.PrintCheckVersion(vinfo)
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/http"
+	"github.com/docker-slim/docker-slim/internal/app/master/progress"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how long the profiles check container runs when there are no HTTP probes
+const profilesCheckWait = 15 * time.Second
+
+// runProfilesCheck runs the minified image with the generated seccomp and AppArmor profiles
+// (and the HTTP probes if they are enabled) and reports the denials
+func runProfilesCheck(logger *log.Entry,
+	printer *status.Printer,
+	execTimer *execTimeout,
+	containerInspector *container.Inspector,
+	imageName string,
+	doHTTPProbe bool,
+	httpProbeCmds []config.HTTPProbeCmd,
+	httpProbeRetryCount int,
+	httpProbeRetryWait time.Duration,
+	httpProbePorts []uint16,
+	doHTTPProbeFull bool) *report.ProfilesCheck {
+	printer.State(status.IDProfilesCheck, "profiles.check", "message='running the minified image with the generated security profiles'")
+
+	logger.Info("starting the profiles check container...")
+	if err := containerInspector.RunProfilesCheck(imageName); err != nil {
+		printer.Info(status.IDProfilesCheckDone, "profiles.check", "status=error message='%v'", err)
+		return &report.ProfilesCheck{Denials: []string{err.Error()}}
+	}
+
+	execTimer.setCleanup(func() {
+		_ = containerInspector.FinishProfilesCheck()
+	})
+
+	waitForCheck := func() {
+		pi := progress.Start(printer.Prefix(), "profiles.check")
+		<-time.After(profilesCheckWait)
+		pi.Stop()
+	}
+
+	if doHTTPProbe {
+		probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds,
+			httpProbeRetryCount, httpProbeRetryWait, httpProbePorts, doHTTPProbeFull,
+			true, printer)
+		if err == nil && len(probe.Ports) > 0 {
+			probe.Start()
+			<-probe.DoneChan()
+		} else {
+			waitForCheck()
+		}
+	} else {
+		waitForCheck()
+	}
+
+	result := containerInspector.FinishProfilesCheck()
+	execTimer.setCleanup(nil)
+
+	checkReport := &report.ProfilesCheck{
+		Passed:          result.Passed(),
+		ExitCode:        result.ExitCode,
+		AppArmorApplied: result.AppArmorApplied,
+		AuditChecked:    !result.AuditUnavailable,
+	}
+
+	checkReport.Denials = append(checkReport.Denials, result.LogDenials...)
+	checkReport.Denials = append(checkReport.Denials, result.AuditDenials...)
+	for _, denial := range checkReport.Denials {
+		printer.Info(status.IDProfilesCheckDenial, "profiles.check.denial", "message='%s'", strings.Replace(denial, "'", "\"", -1))
+	}
+
+	if !result.Running && result.ExitCode != 0 {
+		printer.Info(status.IDProfilesCheckDenial, "profiles.check.denial",
+			"message='the minified container exited with the generated profiles (exit code %d)'", result.ExitCode)
+	}
+
+	if result.AuditUnavailable {
+		printer.Info(status.IDProfilesCheck, "profiles.check",
+			"audit=skipped message='the kernel audit logs are not available (only the container logs were checked)'")
+	}
+
+	printer.Info(status.IDProfilesCheckDone, "profiles.check", "status=done passed=%v denials=%v apparmor=%v",
+		checkReport.Passed, len(checkReport.Denials), checkReport.AppArmorApplied)
+
+	return checkReport
+}
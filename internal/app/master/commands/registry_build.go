@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/builder"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/util/errutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dustin/go-humanize"
+)
+
+//NOTES:
+//* the direct registry build doesn't need a Docker daemon: the target image is fetched from its registry,
+//  extracted in the image state directory and minified with the static file selection
+//  (the image is not running, so the files the application opens at runtime need the include options)
+//* the minified image is a single layer image in the OCI image layout (and it's pushed from the layout)
+
+// rootfsDirName is the image state subdirectory for the extracted image filesystem
+const rootfsDirName = "rootfs"
+
+// OnRegistryDirectBuild implements the 'build' docker-slim command with the direct registry access
+func OnRegistryDirectBuild(
+	doCheckVersion bool,
+	cmdReportLocation string,
+	doDebug bool,
+	statePath string,
+	stateDirNaming string,
+	registryAccess *config.RegistryAccess,
+	imageRef string,
+	customImageTag string,
+	includePaths map[string]bool,
+	includeBins map[string]bool,
+	includeExes map[string]bool,
+	doIncludeShell bool,
+	ociLayout string) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "build"})
+	printer := status.New("build")
+
+	viChan := version.CheckAsync(doCheckVersion)
+
+	cmdReport := report.NewBuildCommand(cmdReportLocation)
+	cmdReport.State = report.CmdStateStarted
+	cmdReport.ImageReference = imageRef
+
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "target=%v registry.direct=true", imageRef)
+
+	remoteImage, localVolumePath, artifactLocation, layoutPath := saveRemoteImage(logger, printer, statePath, stateDirNaming,
+		registryAccess, imageRef, true, true)
+
+	rootDir := filepath.Join(localVolumePath, rootfsDirName)
+	err := os.RemoveAll(rootDir)
+	errutil.FailOn(err)
+	defer os.RemoveAll(rootDir)
+
+	logger.Info("extracting 'fat' image filesystem...")
+	headers, err := registry.ExtractImage(layoutPath, remoteImage, rootDir)
+	errutil.FailOn(err)
+
+	files := builder.StaticFiles(rootDir, remoteImage.Config.Config, includePaths, includeBins, includeExes, doIncludeShell)
+	logger.Debugf("selected %v image files", len(files))
+
+	ref := registry.ParseReference(imageRef)
+	minifiedRef := customImageTag
+	if minifiedRef == "" {
+		//the images fetched by digest get the default tag
+		tag := ref.Tag
+		if tag == "" {
+			tag = registry.DefaultTag
+		}
+
+		minifiedRef = ref.Name() + ".slim:" + tag
+	}
+
+	if ociLayout == "" {
+		ociLayout = layoutPath
+	}
+
+	printer.Info(status.IDMinifiedImageBuilding, "minified.image", "status=building image=%v oci.layout='%v'", minifiedRef, ociLayout)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(builder.WriteStaticLayer(writer, rootDir, files, headers))
+	}()
+
+	layer, diffID, err := registry.AddLayoutLayer(ociLayout, reader, registryAccess)
+	reader.CloseWithError(err)
+	errutil.FailOn(err)
+
+	configData, err := registry.NewLayerConfig(remoteImage.ConfigData, diffID, time.Now(),
+		"docker-slim build --registry-direct "+imageRef)
+	errutil.FailOn(err)
+
+	cmdReport.OCIManifestDigest, err = registry.WriteLayout(ociLayout, minifiedRef, configData,
+		[]registry.LayerBlob{*layer}, registryAccess.Annotations)
+	errutil.FailOn(err)
+
+	printer.State(status.IDCompleted, "completed", "")
+	cmdReport.State = report.CmdStateCompleted
+
+	cmdReport.SourceImage = report.ImageMetadata{
+		AllNames:     []string{ref.String()},
+		Name:         ref.String(),
+		ID:           remoteImage.ID(),
+		Size:         remoteImage.Size(),
+		SizeHuman:    humanize.Bytes(uint64(remoteImage.Size())),
+		CreateTime:   remoteImage.Config.Created.UTC().Format(time.RFC3339),
+		Architecture: remoteImage.Config.Architecture,
+	}
+
+	if remoteImage.Config.Config != nil {
+		cmdReport.SourceImage.User = remoteImage.Config.Config.User
+	}
+
+	//the sizes are the compressed layer sizes (the images are not unpacked in a Docker daemon)
+	cmdReport.MinifiedImage = minifiedRef
+	cmdReport.MinifiedImageSize = layer.Size
+	cmdReport.MinifiedImageSizeHuman = humanize.Bytes(uint64(layer.Size))
+	cmdReport.MinifiedImageHasData = true
+	if layer.Size > 0 {
+		cmdReport.MinifiedBy = float64(cmdReport.SourceImage.Size) / float64(layer.Size)
+	}
+
+	cmdReport.OCILayout = ociLayout
+	cmdReport.ArtifactLocation = artifactLocation
+
+	printer.Info(status.IDResultsMinified, "results", "status='MINIFIED BY %.2fX [%v (%v) => %v (%v)]'",
+		cmdReport.MinifiedBy,
+		cmdReport.SourceImage.Size,
+		cmdReport.SourceImage.SizeHuman,
+		cmdReport.MinifiedImageSize,
+		cmdReport.MinifiedImageSizeHuman)
+
+	printer.Info(status.IDResultsImage, "results", "image.name=%v image.size='%v' data=%v",
+		cmdReport.MinifiedImage,
+		cmdReport.MinifiedImageSizeHuman,
+		cmdReport.MinifiedImageHasData)
+
+	printer.Info(status.IDResultsOCILayout, "results", "oci.layout='%v' manifest.digest=%v",
+		cmdReport.OCILayout, cmdReport.OCIManifestDigest)
+
+	if registryAccess.Push {
+		pushOutput := ioutil.Discard
+		if doDebug {
+			pushOutput = os.Stdout
+		}
+
+		if err := registry.PushLayout(ociLayout, minifiedRef, registryAccess, pushOutput); err == nil {
+			printer.Info(status.IDResultsImagePush, "results", "image.pushed=%v layers=%v",
+				minifiedRef, registry.LayerFormat(registryAccess))
+		} else {
+			printer.Info(status.IDImagePushError, "image.push", "status=error image=%v message='%v'", minifiedRef, err)
+		}
+	}
+
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.location='%v'", cmdReport.ArtifactLocation)
+
+	printer.State(status.IDDone, "done", "")
+
+	version.PrintCheckVersion(<-viChan)
+
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"os"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/builder"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dustin/go-humanize"
+)
+
+// OnSharedLayer implements the 'shared-layer' docker-slim command
+// (it creates the shared layer with the files kept in several minified images
+// using the build context manifests saved by the 'build' command)
+func OnSharedLayer(
+	cmdReportLocation string,
+	artifactLocations []string,
+	outputLocation string,
+	minImages int) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "shared-layer"})
+	printer := status.New("shared-layer")
+
+	cmdReport := report.NewSharedLayerCommand(cmdReportLocation)
+	cmdReport.State = report.CmdStateStarted
+	cmdReport.ArtifactLocations = artifactLocations
+
+	printer.State(status.IDStarted, "started", "")
+	printer.Info(status.IDParams, "params", "artifacts=[%v] output='%v' min.images=%v",
+		strings.Join(artifactLocations, ","), outputLocation, minImages)
+
+	fail := func(err error) {
+		printer.Info(status.IDSharedLayerError, "shared.layer.error", "message='%v'", err)
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = err.Error()
+		cmdReport.Save()
+		printer.Exited()
+	}
+
+	if err := os.MkdirAll(outputLocation, 0777); err != nil {
+		fail(err)
+		return
+	}
+
+	logger.Info("creating the shared layer...")
+	manifest, err := builder.CreateSharedLayer(artifactLocations, outputLocation, minImages)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	printer.State(status.IDCompleted, "completed", "")
+	cmdReport.State = report.CmdStateCompleted
+	cmdReport.OutputLocation = outputLocation
+	cmdReport.DiffID = manifest.DiffID
+	cmdReport.Files = len(manifest.Files)
+	cmdReport.Size = manifest.Size
+
+	printer.Info(status.IDResultsArtifacts, "results", "artifacts.location='%v'", cmdReport.OutputLocation)
+	printer.Info(status.IDResultsArtifacts, "results", "shared.layer.diff_id=%v", cmdReport.DiffID)
+	printer.Info(status.IDResultsArtifacts, "results", "shared.layer.files=%v", cmdReport.Files)
+	printer.Info(status.IDResultsArtifacts, "results", "shared.layer.size=%v", humanize.Bytes(uint64(cmdReport.Size)))
+	printer.Info(status.IDResultsArtifacts, "results", "shared.layer.image=%v", manifest.ImageName())
+
+	printer.State(status.IDDone, "done", "")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/codegangsta/cli"
+)
+
+const noneImageTag = "<none>:<none>"
+
+// completeImageCommand provides the shell completion candidates for the image commands
+// (image names and tags from the Docker daemon for the target and network names for the --network flag)
+func completeImageCommand(ctx *cli.Context) {
+	clientConfig := getDockerClientConfig(ctx)
+	client := dockerclient.NewAPIClient(dockerclient.New(clientConfig), clientConfig.APIVersion)
+
+	flagName := completionFlag(os.Args)
+	switch {
+	case flagName == FlagNetwork:
+		completeNetworks(client)
+	case flagName == "" || isBoolFlag(ctx.Command.Flags, flagName):
+		if ctx.NArg() == 0 {
+			completeImages(client)
+		}
+	}
+}
+
+func isBoolFlag(flags []cli.Flag, name string) bool {
+	for _, flag := range flags {
+		switch flag.(type) {
+		case cli.BoolFlag, cli.BoolTFlag:
+			if flag.GetName() == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// completionFlag returns the name of the flag being completed
+// (the last argument before the completion flag if it's a flag without a value)
+func completionFlag(args []string) string {
+	if len(args) < 2 || args[len(args)-1] != "--"+cli.BashCompletionFlag.Name {
+		return ""
+	}
+
+	prev := args[len(args)-2]
+	if !strings.HasPrefix(prev, "-") || strings.Contains(prev, "=") {
+		return ""
+	}
+
+	return strings.TrimLeft(prev, "-")
+}
+
+func completeImages(client dockerclient.API) {
+	images, err := client.ListImages(docker.ListImagesOptions{})
+	if err != nil {
+		log.Debugf("completeImages: error listing images - %v", err)
+		return
+	}
+
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if tag == noneImageTag {
+				continue
+			}
+
+			fmt.Println(tag)
+		}
+	}
+}
+
+func completeNetworks(client dockerclient.API) {
+	networks, err := client.ListNetworks()
+	if err != nil {
+		log.Debugf("completeNetworks: error listing networks - %v", err)
+		return
+	}
+
+	for _, network := range networks {
+		fmt.Println(network.Name)
+	}
+}
@@ -6,6 +6,30 @@ import (
 	"github.com/cloudimmunity/go-dockerclientx"
 )
 
+// State directory naming modes
+const (
+	StateDirNameByID           = "id"
+	StateDirNameByTag          = "tag"
+	StateDirNameByTimestamp    = "timestamp"
+	StateDirNameByTagTimestamp = "tag-timestamp"
+)
+
+// ENTRYPOINT and CMD forms (like the Dockerfile instruction forms)
+const (
+	CommandFormExec  = "exec"
+	CommandFormShell = "shell"
+)
+
+// DeviceRequest is a request for the devices from a device driver (e.g., the GPUs)
+// (it's the Docker API device request the container is created with)
+type DeviceRequest struct {
+	Driver       string            `json:"Driver,omitempty" yaml:"Driver,omitempty"`
+	Count        int               `json:"Count,omitempty" yaml:"Count,omitempty"`
+	DeviceIDs    []string          `json:"DeviceIDs,omitempty" yaml:"DeviceIDs,omitempty"`
+	Capabilities [][]string        `json:"Capabilities,omitempty" yaml:"Capabilities,omitempty"`
+	Options      map[string]string `json:"Options,omitempty" yaml:"Options,omitempty"`
+}
+
 // ContainerOverrides provides a set of container field overrides
 // It can also be used to update the image instructions when
 // the "image-overrides" flag is provided
@@ -17,8 +41,68 @@ type ContainerOverrides struct {
 	Workdir         string
 	Env             []string
 	Hostname        string
+	Domainname      string
 	Network         string
-	ExposedPorts    map[docker.Port]struct{}
+	//the resolver options for the container (e.g., 'ndots:2' or 'timeout:3')
+	DNSOptions []string
+	//the labels for the docker-slim containers (not for the minified image)
+	Labels map[string]string
+	//the static addresses and the aliases for the container in the user-defined network
+	NetworkIPv4    string
+	NetworkIPv6    string
+	NetworkAliases []string
+	//the IPC and PID namespace modes (e.g., 'host' or 'container:<name|id>')
+	IpcMode      string
+	PidMode      string
+	ExposedPorts map[docker.Port]struct{}
+	//PortBindings are the container ports published on the specific host ports
+	//(the other exposed ports are published on the random host ports)
+	PortBindings map[docker.Port][]docker.PortBinding
+	//User is the user the application runs as (the sensor always runs as root)
+	User string
+	//the capabilities added to and dropped from the container
+	//(the container is not privileged when they are set)
+	CapAdd  []string
+	CapDrop []string
+	//the host devices and the GPUs (device requests) for the container
+	Devices        []docker.Device
+	DeviceRequests []DeviceRequest
+	//the resource limits for the container (0 means no limit)
+	Memory     int64
+	MemorySwap int64
+	CPUShares  int64
+	CPUs       float64
+	PidsLimit  int64
+	//the /dev/shm size (0 means the Docker default, 64MB) and the ulimits for the container
+	ShmSize int64
+	Ulimits []docker.ULimit
+	//the tmpfs mounts for the container (the mount paths with their mount options)
+	Tmpfs map[string]string
+	//the namespaced kernel parameters for the container (e.g., 'net.core.somaxconn')
+	Sysctls map[string]string
+	//Privileged keeps the container privileged (even with the capability overrides)
+	//and SecurityOpts are passed to the container as is
+	Privileged   bool
+	SecurityOpts []string
+	//ReadOnlyRootfs runs the container with a read-only root filesystem
+	//(with the writable tmpfs mounts for the temporary data directories)
+	ReadOnlyRootfs bool
+	//VolumesFrom are the containers with the volumes for the container ('<container>[:ro|rw]')
+	VolumesFrom []string
+	//Interactive runs the container with a TTY and an open stdin (same as 'docker run -it'),
+	//so docker-slim can attach the terminal to it
+	Interactive bool
+	//the signal and the grace period (seconds) for stopping the application
+	//(the image STOPSIGNAL and the default timeout are used if they are not set)
+	StopSignal  string
+	StopTimeout int
+	//StartRetries is the number of the container start retries when the startup fails with the transient errors
+	//(the host ports or the names are taken or the network is not ready)
+	StartRetries int
+	//the secrets for the monitored container only (the secret files are mounted read-only
+	//and never saved in the minified image, the secret env vars are never added to the image)
+	SecretFiles []VolumeMount
+	SecretEnv   []string
 }
 
 // ImageNewInstructions provides a set new image instructions
@@ -30,13 +114,29 @@ type ImageNewInstructions struct {
 	Workdir         string
 	Env             []string
 	ExposedPorts    map[docker.Port]struct{}
+	Labels          map[string]string
+	User            string
+	StopSignal      string
+	Shell           []string
+	OnBuild         []string
+	//KeepOnBuild keeps the source image ONBUILD triggers
+	//(they are removed by default, because they usually need the build tools)
+	KeepOnBuild bool
+	//Author, Comment and Created are the new image config metadata
+	//(the default author is 'docker-slim <version>' and the zero Created time is the build time)
+	Author  string
+	Comment string
+	Created time.Time
 }
 
 // VolumeMount provides the volume mount configuration information
+// (the source is a host path or a named Docker volume)
 type VolumeMount struct {
 	Source      string
 	Destination string
 	Options     string
+	//IsVolume is true if the source is a named Docker volume
+	IsVolume bool
 }
 
 // HTTPProbeCmd provides the HTTP probe parameters
@@ -58,11 +158,152 @@ type HTTPProbeCmds struct {
 
 // DockerClient provides Docker client parameters
 type DockerClient struct {
-	UseTLS      bool
-	VerifyTLS   bool
-	TLSCertPath string
-	Host        string
-	Env         map[string]string
+	UseTLS          bool
+	VerifyTLS       bool
+	TLSCertPath     string
+	TLSCACert       string
+	TLSCert         string
+	TLSKey          string
+	TLSServerName   string
+	SSHIdentityFile string
+	Host            string
+	//HostSource is where the Docker host address comes from (flag, context, env, default or discovered)
+	HostSource string
+	Context    string
+	//APIVersion is the requested Docker API version (DOCKER_API_VERSION)
+	//or the negotiated Docker API version after the client connects
+	APIVersion string
+	Env        map[string]string
+	//Retries is the number of the retries for the transient Docker API errors
+	//and RetryBackoff is the first retry delay (it's doubled for each retry)
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// RegistryAccess provides the registry settings for the image pulls and pushes
+type RegistryAccess struct {
+	Mirrors            []string
+	InsecureRegistries []string
+	Pull               bool
+	Push               bool
+	//Direct enables the direct registry access (without a Docker daemon)
+	Direct bool
+	//LayerCompression is the layer compression for the pushed images ('gzip' or 'zstd')
+	//and EStargz enables the eStargz (lazy pulling) gzip layers
+	LayerCompression string
+	EStargz          bool
+	//Annotations are the new manifest annotations for the pushed images
+	//(the images with the annotations are pushed directly to the registry)
+	Annotations map[string]string
+}
+
+// Artifact transfer modes
+const (
+	ArtifactsTransferAuto  = "auto"
+	ArtifactsTransferMount = "mount"
+	ArtifactsTransferCopy  = "copy"
+)
+
+// SensorMount provides the sensor and artifact volume mount parameters
+type SensorMount struct {
+	Location   string
+	Options    string
+	SensorPath string
+	Transfer   string
+}
+
+// Seccomp profile baseline and merge modes
+const (
+	SeccompBaselineDockerDefault = "docker-default"
+	SeccompMergeUnion            = "union"
+	SeccompMergeIntersection     = "intersection"
+)
+
+// SeccompBaseline provides the baseline seccomp profile the generated profile is merged with
+type SeccompBaseline struct {
+	//Profile is 'docker-default' (the Docker default profile) or a seccomp profile file path
+	Profile string
+	Mode    string
+}
+
+// Seccomp profile actions
+const (
+	SeccompActionAllow = "allow"
+	SeccompActionErrno = "errno"
+	SeccompActionKill  = "kill"
+	SeccompActionLog   = "log"
+	SeccompActionTrap  = "trap"
+)
+
+// SeccompOptions provides the seccomp profile generation parameters
+type SeccompOptions struct {
+	//Arches are the architectures the profile is generated for (the monitored container architecture by default)
+	Arches []string
+	//DefaultAction is the action for the syscalls the profile doesn't allow ('errno' by default)
+	DefaultAction string
+	//ErrnoRet is the error the 'errno' action returns (0 is the runtime default, EPERM)
+	ErrnoRet uint
+	//Actions are the per-syscall action overrides
+	Actions map[string]string
+}
+
+// AppArmor profile network rule modes
+const (
+	AppArmorNetworkAll      = "all"
+	AppArmorNetworkObserved = "observed"
+	AppArmorNetworkNone     = "none"
+)
+
+// AppArmorOptions provides the AppArmor profile generation parameters
+type AppArmorOptions struct {
+	Network      string
+	Capabilities bool
+	OwnerFiles   bool
+	Complain     bool
+}
+
+// Security profile embedding modes
+const (
+	EmbedProfilesNone   = "none"
+	EmbedProfilesDigest = "digest"
+	EmbedProfilesFull   = "full"
+)
+
+// EmbedProfiles provides the parameters for the security profile labels in the minified image
+type EmbedProfiles struct {
+	Mode string
+	//URL is the base URL for the profile retrieval labels (optional)
+	URL string
+}
+
+// Dynamic loader check modes
+const (
+	LoaderCheckOff     = "off"
+	LoaderCheckWarn    = "warn"
+	LoaderCheckFail    = "fail"
+	LoaderCheckInclude = "include"
+)
+
+// Minified image layer strategies
+const (
+	LayerStrategySingle = "single"
+	LayerStrategySplit  = "split"
+	//LayerStrategyReuseBase is the 'split' strategy on top of the target image base image layers
+	//(if the base image is already minimal)
+	LayerStrategyReuseBase = "reuse-base"
+)
+
+// LayerRule puts the minified image files matching the path pattern into a separate image layer
+type LayerRule struct {
+	Layer   string `json:"layer"`
+	Pattern string `json:"pattern"`
+}
+
+// LayerStrategy provides the minified image layer parameters
+type LayerStrategy struct {
+	Mode string `json:"mode"`
+	//Rules are the custom layer rules (they are matched before the default rules)
+	Rules []LayerRule `json:"rules,omitempty"`
 }
 
 // ContinueAfter provides the command execution mode parameters
@@ -70,4 +311,13 @@ type ContinueAfter struct {
 	Mode         string
 	Timeout      time.Duration
 	ContinueChan <-chan struct{}
+	//HealthyChecks is the number of the successful HEALTHCHECK checks to wait for in the 'healthcheck' mode
+	HealthyChecks int
+}
+
+// BatchTarget is a target image minified by the 'batch' command
+type BatchTarget struct {
+	Image string `json:"image"`
+	//BuildFlags are the 'build' command flags for the target (after the common batch build flags)
+	BuildFlags []string `json:"build_flags,omitempty"`
 }
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var systemLibPaths = []string{
+	"/lib",
+	"/lib64",
+	"/usr/lib",
+	"/usr/lib64",
+	"/usr/local/lib",
+}
+
+func getRiskyConfigWarnings(doHTTPProbe bool,
+	continueAfter *config.ContinueAfter,
+	excludePaths map[string]bool,
+	clearEntrypoint bool) []string {
+	var warnings []string
+
+	if !doHTTPProbe && continueAfter != nil && continueAfter.Mode == "timeout" {
+		warnings = append(warnings,
+			"no HTTP probes with the 'timeout' continue-after mode (nothing will exercise the target app unless it runs on its own)")
+	}
+
+	for epath := range excludePaths {
+		epath = filepath.Clean(epath)
+		for _, libPath := range systemLibPaths {
+			if libPath == epath || strings.HasPrefix(libPath, epath+"/") || epath == "/" {
+				warnings = append(warnings,
+					fmt.Sprintf("excluding '%s' removes system libraries ('%s') the target app is likely to need", epath, libPath))
+				break
+			}
+		}
+	}
+
+	if clearEntrypoint {
+		warnings = append(warnings,
+			"the ENTRYPOINT instruction is cleared (make sure the CMD instruction can start the app on its own)")
+	}
+
+	return warnings
+}
+
+func confirmRiskyConfig(cmdName string,
+	doHTTPProbe bool,
+	continueAfter *config.ContinueAfter,
+	excludePaths map[string]bool,
+	clearEntrypoint bool) bool {
+	warnings := getRiskyConfigWarnings(doHTTPProbe, continueAfter, excludePaths, clearEntrypoint)
+	if len(warnings) == 0 {
+		return true
+	}
+
+	printer := status.New(cmdName)
+	for _, warning := range warnings {
+		printer.Info(status.IDConfigWarning, "config.warning", "message='%s'", warning)
+	}
+
+	if !log.IsTerminal(os.Stdin) {
+		printer.Info(status.IDConfigWarning, "config.warning", "message='non-interactive mode, continuing (use --%s to skip this check)'", FlagYes)
+		return true
+	}
+
+	printer.Info(status.IDConfigPrompt, "prompt", "message='THE CONFIGURATION MIGHT PRODUCE A BROKEN IMAGE, CONTINUE? [y/N]'")
+	creader := bufio.NewReader(os.Stdin)
+	answer, _ := creader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
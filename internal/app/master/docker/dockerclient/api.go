@@ -0,0 +1,59 @@
+package dockerclient
+
+import (
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// API is the Docker Engine API docker-slim uses.
+// The commands, the inspectors and the image builders depend on this interface
+// instead of the Docker client library, so the client implementation can be replaced
+// (e.g., with the official Docker SDK client through an adapter) without changing them.
+// The request and response types are the go-dockerclientx types
+// (or the dockerclient types for the calls that need the newer API fields).
+type API interface {
+	//daemon info
+	Ping() error
+	Version() (*docker.Env, error)
+	Info() (*DockerInfo, error)
+
+	//images
+	ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error)
+	InspectImage(name string) (*Image, error)
+	ImageHistory(name string) ([]docker.ImageHistory, error)
+	BuildImage(opts docker.BuildImageOptions) error
+	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
+	PushImage(opts docker.PushImageOptions, auth docker.AuthConfiguration) error
+	TagImage(name string, opts docker.TagImageOptions) error
+	LoadImage(opts docker.LoadImageOptions) error
+	ExportImage(opts docker.ExportImageOptions) error
+	RemoveImage(name string) error
+
+	//networks
+	ListNetworks() ([]docker.Network, error)
+	CreateNetwork(opts CreateNetworkOptions) (*docker.Network, error)
+	RemoveNetwork(id string) error
+	ConnectNetwork(id string, opts NetworkConnectionOptions) error
+	DisconnectNetwork(id string, opts NetworkConnectionOptions) error
+
+	//containers
+	CreateContainer(opts CreateContainerOptions) (*Container, error)
+	StartContainer(id string, hostConfig *docker.HostConfig) error
+	StopContainer(id string, timeout uint) error
+	RemoveContainer(opts docker.RemoveContainerOptions) error
+	InspectContainer(id string) (*Container, error)
+	Logs(opts docker.LogsOptions) error
+	UploadToContainer(id string, opts docker.UploadToContainerOptions) error
+	DownloadFromContainer(id string, opts docker.DownloadFromContainerOptions) error
+	CreateExec(opts CreateExecOptions) (*docker.Exec, error)
+	StartExec(id string, opts docker.StartExecOptions) error
+	AttachToContainer(opts docker.AttachToContainerOptions) error
+	ResizeContainerTTY(id string, height, width int) error
+
+	//volumes
+	InspectVolume(name string) (*docker.Volume, error)
+
+	//events
+	AddEventListener(listener chan<- *docker.APIEvents) error
+}
+
+var _ API = (*Client)(nil)
@@ -0,0 +1,141 @@
+package dockerclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// MaxAPIVersion is the newest Docker API version docker-slim requests
+// (the newer daemons still support it, so their API changes don't affect the requests)
+const MaxAPIVersion = "1.41"
+
+// DeviceRequestsAPIVersion is the oldest Docker API version with the container device requests (--gpus)
+const DeviceRequestsAPIVersion = "1.40"
+
+// NegotiateAPIVersion selects the Docker API version for the daemon connection
+// (the daemon API version capped at MaxAPIVersion or the DOCKER_API_VERSION env var value)
+// and returns a client that uses the selected API version in all requests.
+// The selected API version is saved in the client config.
+func NegotiateAPIVersion(client *docker.Client, clientConfig *config.DockerClient) (*docker.Client, error) {
+	host := clientConfig.Host
+	if host == "" {
+		host = clientConfig.Env["DOCKER_HOST"]
+	}
+
+	ver, err := client.Version()
+	if err != nil {
+		return nil, connectionError(host, err)
+	}
+
+	minVersion, _ := docker.NewAPIVersion(MinAPIVersion)
+	maxVersion, _ := docker.NewAPIVersion(MaxAPIVersion)
+
+	daemonVersionStr := ver.Get("ApiVersion")
+	daemonVersion, err := docker.NewAPIVersion(daemonVersionStr)
+	if err != nil {
+		//can't negotiate without the daemon API version (use the daemon default)
+		log.Debugf("dockerclient.NegotiateAPIVersion: unknown daemon API version (%q) => %v", daemonVersionStr, err)
+		return client, nil
+	}
+
+	if daemonVersion.LessThan(minVersion) {
+		return nil, fmt.Errorf("the Docker daemon at %s is too old (API version %s, docker-slim needs API version %s or newer) - upgrade Docker on the Docker host",
+			host, daemonVersionStr, MinAPIVersion)
+	}
+
+	selectedVersion := daemonVersion
+	if maxVersion.LessThan(daemonVersion) {
+		selectedVersion = maxVersion
+	}
+
+	if clientConfig.APIVersion != "" {
+		requestedVersion, err := docker.NewAPIVersion(clientConfig.APIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Docker API version '%s' (DOCKER_API_VERSION)", clientConfig.APIVersion)
+		}
+
+		if requestedVersion.LessThan(minVersion) {
+			return nil, fmt.Errorf("the requested Docker API version %s is too old (docker-slim needs API version %s or newer) - unset DOCKER_API_VERSION",
+				clientConfig.APIVersion, MinAPIVersion)
+		}
+
+		if daemonVersion.LessThan(requestedVersion) {
+			return nil, fmt.Errorf("the Docker daemon at %s does not support the requested Docker API version %s (the daemon API version is %s) - unset DOCKER_API_VERSION",
+				host, clientConfig.APIVersion, daemonVersionStr)
+		}
+
+		selectedVersion = requestedVersion
+	}
+
+	//the newer daemons drop the support for the old API versions
+	if daemonMinVersionStr := ver.Get("MinAPIVersion"); daemonMinVersionStr != "" {
+		if daemonMinVersion, err := docker.NewAPIVersion(daemonMinVersionStr); err == nil &&
+			selectedVersion.LessThan(daemonMinVersion) {
+			return nil, fmt.Errorf("the Docker daemon at %s does not support the Docker API version %s anymore (the daemon needs API version %s or newer) - upgrade docker-slim",
+				host, selectedVersion, daemonMinVersionStr)
+		}
+	}
+
+	versionedClient, err := newVersionedClient(client, selectedVersion.String())
+	if err != nil {
+		return nil, err
+	}
+
+	clientConfig.APIVersion = selectedVersion.String()
+	log.Debugf("dockerclient.NegotiateAPIVersion: daemon API version %s => using API version %s", daemonVersionStr, clientConfig.APIVersion)
+	return versionedClient, nil
+}
+
+// RequireAPIVersion returns an error if the negotiated Docker API version
+// is too old for the feature docker-slim needs to use
+func RequireAPIVersion(clientConfig *config.DockerClient, version string, feature string) error {
+	if clientConfig.APIVersion == "" {
+		//the API version is not known (the daemon will report the unsupported requests)
+		return nil
+	}
+
+	current, err := docker.NewAPIVersion(clientConfig.APIVersion)
+	if err != nil {
+		return nil
+	}
+
+	required, err := docker.NewAPIVersion(version)
+	if err != nil {
+		return err
+	}
+
+	if current.LessThan(required) {
+		return fmt.Errorf("%s needs Docker API version %s or newer (the Docker daemon API version is %s) - upgrade Docker on the Docker host",
+			feature, version, clientConfig.APIVersion)
+	}
+
+	return nil
+}
+
+// newVersionedClient creates a copy of the client that uses the selected API version
+// (the transport settings are reused, so it works with all endpoint types)
+func newVersionedClient(client *docker.Client, apiVersion string) (*docker.Client, error) {
+	endpoint := client.Endpoint()
+	//the TLS clients use the 'https' endpoints
+	if client.TLSConfig != nil && strings.HasPrefix(endpoint, "tcp://") {
+		endpoint = "https://" + strings.TrimPrefix(endpoint, "tcp://")
+	}
+
+	versionedClient, err := docker.NewVersionedClient(endpoint, apiVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	versionedClient.HTTPClient = client.HTTPClient
+	versionedClient.TLSConfig = client.TLSConfig
+	versionedClient.Dialer = client.Dialer
+	//the API version is already negotiated
+	versionedClient.SkipServerVersionCheck = true
+
+	return versionedClient, nil
+}
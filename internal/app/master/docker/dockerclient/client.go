@@ -1,9 +1,9 @@
 package dockerclient
 
 import (
-	"io/ioutil"
+	"errors"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/cloudimmunity/go-dockerclientx"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
@@ -12,64 +12,110 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
+const (
+	namedPipePrefix = "npipe://"
+	unixPrefix      = "unix://"
+)
+
+var errInvalidNamedPipe = errors.New("invalid named pipe endpoint (use 'npipe:////./pipe/<name>')")
+
+// defaultHost returns the default Docker Engine endpoint
+// (or the first discovered Docker Engine or Podman socket if the default socket doesn't exist)
+// and the source of the endpoint address
+func defaultHost() (string, string) {
+	if !strings.HasPrefix(DefaultHost, unixPrefix) {
+		return DefaultHost, HostSourceDefault
+	}
+
+	if _, err := os.Stat(strings.TrimPrefix(DefaultHost, unixPrefix)); err == nil {
+		return DefaultHost, HostSourceDefault
+	}
+
+	if host := discoverHost(); host != "" {
+		log.Debugf("docker-slim: no default Docker Engine socket, using the discovered socket - %s", host)
+		return host, HostSourceDiscovered
+	}
+
+	return DefaultHost, HostSourceDefault
+}
+
 // New creates a new Docker client instance
 func New(config *config.DockerClient) *docker.Client {
 	var client *docker.Client
 	var err error
 
-	newTLSClient := func(host string, certPath string, verify bool) (*docker.Client, error) {
-		var ca []byte
+	setMachineEnv(config)
 
-		cert, err := ioutil.ReadFile(filepath.Join(certPath, "cert.pem"))
-		if err != nil {
-			return nil, err
+	if config.Host != "" {
+		errutil.FailOn(validateHost(config.Host))
+		if config.HostSource == "" {
+			config.HostSource = HostSourceFlag
 		}
+	} else if config.Env["DOCKER_HOST"] != "" {
+		errutil.FailOn(validateHost(config.Env["DOCKER_HOST"]))
+		config.HostSource = HostSourceEnv
+	}
 
-		key, err := ioutil.ReadFile(filepath.Join(certPath, "key.pem"))
-		if err != nil {
-			return nil, err
-		}
+	switch {
+	case strings.HasPrefix(config.Host, namedPipePrefix):
+		client, err = newNamedPipeClient(config.Host)
+		errutil.FailOn(err)
+		log.Debug("docker-slim: new Docker client (named pipe) [0]")
 
-		if verify {
-			var err error
-			ca, err = ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
-			if err != nil {
-				return nil, err
-			}
-		}
+	case config.Host == "" &&
+		strings.HasPrefix(config.Env["DOCKER_HOST"], namedPipePrefix):
+		client, err = newNamedPipeClient(config.Env["DOCKER_HOST"])
+		errutil.FailOn(err)
+		log.Debug("docker-slim: new Docker client (env,named pipe) [0]")
 
-		return docker.NewVersionedTLSClientFromBytes(host, cert, key, ca, "")
-	}
+	case strings.HasPrefix(config.Host, sshPrefix):
+		client, err = newSSHClient(config.Host, config.SSHIdentityFile)
+		errutil.FailOn(err)
+		log.Debug("docker-slim: new Docker client (ssh) [0]")
+
+	case config.Host == "" &&
+		strings.HasPrefix(config.Env["DOCKER_HOST"], sshPrefix):
+		client, err = newSSHClient(config.Env["DOCKER_HOST"], config.SSHIdentityFile)
+		errutil.FailOn(err)
+		log.Debug("docker-slim: new Docker client (env,ssh) [0]")
 
-	switch {
 	case config.Host != "" &&
 		config.UseTLS &&
 		config.VerifyTLS &&
-		config.TLSCertPath != "":
-		client, err = newTLSClient(config.Host, config.TLSCertPath, true)
+		hasTLSFiles(config):
+		client, err = newTLSClient(config.Host, getTLSFiles(config.TLSCertPath, config), true, config.TLSServerName)
 		errutil.FailOn(err)
 		log.Debug("docker-slim: new Docker client (TLS,verify) [1]")
 
 	case config.Host != "" &&
 		config.UseTLS &&
 		!config.VerifyTLS &&
-		config.TLSCertPath != "":
-		client, err = newTLSClient(config.Host, config.TLSCertPath, false)
+		hasTLSFiles(config):
+		client, err = newTLSClient(config.Host, getTLSFiles(config.TLSCertPath, config), false, config.TLSServerName)
 		errutil.FailOn(err)
 		log.Debug("docker-slim: new Docker client (TLS,no verify) [2]")
 
 	case config.Host != "" &&
-		!config.UseTLS:
+		config.UseTLS &&
+		isTCPHost(config.Host) &&
+		config.Env["DOCKER_CERT_PATH"] != "":
+		//TLS is enabled automatically when the Docker cert env var is set
+		client, err = newTLSClient(config.Host, getTLSFiles(config.Env["DOCKER_CERT_PATH"], config), config.VerifyTLS, config.TLSServerName)
+		errutil.FailOn(err)
+		log.Debug("docker-slim: new Docker client (TLS,env cert path) [2]")
+
+	case config.Host != "":
+		//TLS needs the TLS files (and it's not used for the local endpoints)
 		client, err = docker.NewClient(config.Host)
 		errutil.FailOn(err)
 		log.Debug("docker-slim: new Docker client [3]")
 
-	case config.Host == "" &&
-		!config.VerifyTLS &&
-		config.Env["DOCKER_TLS_VERIFY"] == "1" &&
-		config.Env["DOCKER_CERT_PATH"] != "" &&
-		config.Env["DOCKER_HOST"] != "":
-		client, err = newTLSClient(config.Env["DOCKER_HOST"], config.Env["DOCKER_CERT_PATH"], false)
+	case config.Env["DOCKER_CERT_PATH"] != "" &&
+		isTCPHost(config.Env["DOCKER_HOST"]) &&
+		(!config.VerifyTLS || config.Env["DOCKER_TLS_VERIFY"] != "1"):
+		//TLS without the daemon certificate verification
+		//(the verification is disabled or DOCKER_TLS_VERIFY is not set, but the Docker cert env var is)
+		client, err = newTLSClient(config.Env["DOCKER_HOST"], getTLSFiles(config.Env["DOCKER_CERT_PATH"], config), false, config.TLSServerName)
 		errutil.FailOn(err)
 		log.Debug("docker-slim: new Docker client (TLS,no verify) [4]")
 
@@ -79,8 +125,24 @@ func New(config *config.DockerClient) *docker.Client {
 		log.Debug("docker-slim: new Docker client (env) [5]")
 
 	case config.Host == "" && config.Env["DOCKER_HOST"] == "":
-		config.Host = "unix:///var/run/docker.sock"
-		client, err = docker.NewClient(config.Host)
+		config.Host, config.HostSource = defaultHost()
+		if config.HostSource == HostSourceDefault && strings.HasPrefix(config.Host, unixPrefix) && discoverHost() == "" {
+			//no Docker sockets, but minikube can have a Docker daemon in its VM
+			if host, certPath := minikubeHost(); host != "" {
+				log.Debugf("docker-slim: no Docker Engine socket, using the minikube VM Docker daemon - %s", host)
+				config.Host, config.HostSource = host, HostSourceDiscovered
+				client, err = newTLSClient(host, getTLSFiles(certPath, config), config.VerifyTLS, config.TLSServerName)
+				errutil.FailOn(err)
+				log.Debug("docker-slim: new Docker client (minikube) [6]")
+				break
+			}
+		}
+
+		if strings.HasPrefix(config.Host, namedPipePrefix) {
+			client, err = newNamedPipeClient(config.Host)
+		} else {
+			client, err = docker.NewClient(config.Host)
+		}
 		errutil.FailOn(err)
 		log.Debug("docker-slim: new Docker client (default) [6]")
 
@@ -88,7 +150,13 @@ func New(config *config.DockerClient) *docker.Client {
 		errutil.Fail("no config for Docker client")
 	}
 
-	if config.Env["DOCKER_HOST"] == "" {
+	if client.TLSConfig != nil && config.TLSServerName != "" {
+		client.TLSConfig.ServerName = config.TLSServerName
+	}
+
+	//the explicitly selected Docker host takes precedence over the DOCKER_HOST env var
+	//(the env var is used to find the Docker host IP later)
+	if config.Host != "" {
 		if err := os.Setenv("DOCKER_HOST", config.Host); err != nil {
 			errutil.WarnOn(err)
 		}
@@ -0,0 +1,102 @@
+package dockerclient
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+// MinAPIVersion is the oldest Docker API version docker-slim works with (Docker 1.12)
+const MinAPIVersion = "1.24"
+
+// validateHost checks the Docker host address format
+func validateHost(host string) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("invalid Docker host address '%s': %v", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return fmt.Errorf("invalid Docker host address '%s' (use 'unix:///path/to/docker.sock')", host)
+		}
+	case "tcp", "http", "https":
+		if u.Hostname() == "" {
+			return fmt.Errorf("invalid Docker host address '%s' (use 'tcp://host:port')", host)
+		}
+	case "npipe", "ssh":
+		//validated when the client is created
+	case "":
+		return fmt.Errorf("invalid Docker host address '%s' (no scheme, use 'unix://', 'tcp://', 'npipe://' or 'ssh://')", host)
+	default:
+		return fmt.Errorf("unsupported Docker host address scheme '%s' in '%s' (use 'unix://', 'tcp://', 'npipe://' or 'ssh://')", u.Scheme, host)
+	}
+
+	return nil
+}
+
+func isTCPHost(host string) bool {
+	return strings.HasPrefix(host, "tcp://") ||
+		strings.HasPrefix(host, "http://") ||
+		strings.HasPrefix(host, "https://")
+}
+
+// CheckConnection connects to the Docker daemon to report the connection problems
+// (with the information about how to fix them) before the command starts
+func CheckConnection(client *docker.Client, clientConfig *config.DockerClient) error {
+	host := clientConfig.Host
+	if host == "" {
+		host = clientConfig.Env["DOCKER_HOST"]
+	}
+
+	if err := client.Ping(); err != nil {
+		err = connectionError(host, err)
+		if clientConfig.HostSource == HostSourceDefault && discoverHost() == "" {
+			//nothing was found at the known socket locations
+			return fmt.Errorf("%v (no Docker Engine socket found in %s)", err, strings.Join(socketCandidates(), ", "))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Endpoint returns the selected Docker host address and its source
+func Endpoint(clientConfig *config.DockerClient) (string, string) {
+	if clientConfig.Host != "" {
+		return clientConfig.Host, clientConfig.HostSource
+	}
+
+	return clientConfig.Env["DOCKER_HOST"], HostSourceEnv
+}
+
+func connectionError(host string, err error) error {
+	msg := err.Error()
+	switch {
+	case isTLSError(err):
+		return fmt.Errorf("TLS handshake with the Docker daemon at %s failed (%v) - check the --tls-ca-cert, --tls-cert, --tls-key and --tls-server-name options (or use --tls-verify=false to skip the daemon certificate verification)",
+			host, err)
+	case os.IsPermission(err) || strings.Contains(msg, "permission denied"):
+		return fmt.Errorf("permission denied connecting to the Docker daemon at %s - add your user to the docker group (or run docker-slim with sudo)", host)
+	case err == docker.ErrConnectionRefused ||
+		strings.Contains(msg, "no such file or directory") ||
+		strings.Contains(msg, "connection refused"):
+		return fmt.Errorf("cannot connect to the Docker daemon at %s - make sure the Docker daemon is running and check the --host option (or the DOCKER_HOST env var)", host)
+	case strings.Contains(msg, "no such host") ||
+		strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "no route to host") ||
+		strings.Contains(msg, "network is unreachable"):
+		return fmt.Errorf("the Docker host %s is unreachable (%v) - check the Docker host address and your network connection", host, err)
+	case strings.Contains(msg, "client version") ||
+		strings.Contains(msg, "API version"):
+		return fmt.Errorf("the Docker daemon at %s does not support the Docker API version docker-slim uses (%v) - upgrade Docker on the Docker host", host, err)
+	default:
+		return fmt.Errorf("error connecting to the Docker daemon at %s: %v", host, err)
+	}
+}
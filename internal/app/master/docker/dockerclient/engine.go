@@ -0,0 +1,272 @@
+package dockerclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const engineUserAgent = "docker-slim"
+
+// Client is the Docker Engine API client docker-slim uses.
+// It's the vendored go-dockerclientx client with the calls that need the newer API fields
+// (the container create and inspect calls, the image inspect call, the daemon info call,
+// the exec create call and the network calls) made with the dockerclient types.
+type Client struct {
+	*docker.Client
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewAPIClient creates the Docker Engine API client for the vendored client
+// (the requests use the same endpoint, transport and API version)
+func NewAPIClient(client *docker.Client, apiVersion string) *Client {
+	apiClient := &Client{
+		Client:     client,
+		httpClient: client.HTTPClient,
+	}
+
+	if endpoint, err := url.Parse(client.Endpoint()); err == nil {
+		switch endpoint.Scheme {
+		case "unix":
+			socketPath := endpoint.Path
+			dialer := client.Dialer
+			if dialer == nil {
+				dialer = &net.Dialer{}
+			}
+
+			apiClient.httpClient = &http.Client{
+				Transport: &http.Transport{
+					Dial: func(network, addr string) (net.Conn, error) {
+						return dialer.Dial("unix", socketPath)
+					},
+				},
+			}
+			//the host is not used (the transport dials the socket)
+			endpoint = &url.URL{Scheme: "http", Host: "unix.sock"}
+		case "tcp":
+			endpoint.Scheme = "http"
+			if client.TLSConfig != nil || endpoint.Port() == "2376" {
+				endpoint.Scheme = "https"
+			}
+		}
+
+		apiClient.baseURL = strings.TrimRight(endpoint.String(), "/")
+	}
+
+	if apiVersion != "" {
+		apiClient.baseURL = fmt.Sprintf("%s/v%s", apiClient.baseURL, apiVersion)
+	}
+
+	if apiClient.httpClient == nil {
+		apiClient.httpClient = http.DefaultClient
+	}
+
+	return apiClient
+}
+
+// do sends the request with the JSON encoded data (if it's not nil)
+// and decodes the JSON response into the result (if it's not nil)
+func (c *Client) do(method, path string, data interface{}, result interface{}) error {
+	var body io.Reader
+	if data != nil {
+		buf, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewBuffer(buf)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", engineUserAgent)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return docker.ErrConnectionRefused
+		}
+
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		msg, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			msg = []byte(fmt.Sprintf("cannot read body, err: %v", err))
+		}
+
+		return &docker.Error{Status: resp.StatusCode, Message: string(msg)}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func errorStatus(err error) int {
+	if e, ok := err.(*docker.Error); ok {
+		return e.Status
+	}
+
+	return 0
+}
+
+// Info returns the daemon info
+func (c *Client) Info() (*DockerInfo, error) {
+	var info DockerInfo
+	if err := c.do("GET", "/info", nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// InspectImage returns the image info
+func (c *Client) InspectImage(name string) (*Image, error) {
+	var image Image
+	if err := c.do("GET", "/images/"+name+"/json", nil, &image); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return nil, docker.ErrNoSuchImage
+		}
+
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// CreateContainer creates a new container (it returns the container ID)
+func (c *Client) CreateContainer(opts CreateContainerOptions) (*Container, error) {
+	path := "/containers/create"
+	if opts.Name != "" {
+		path = fmt.Sprintf("%s?name=%s", path, url.QueryEscape(opts.Name))
+	}
+
+	data := struct {
+		*Config
+		HostConfig       *HostConfig       `json:"HostConfig,omitempty"`
+		NetworkingConfig *NetworkingConfig `json:"NetworkingConfig,omitempty"`
+	}{
+		Config:           opts.Config,
+		HostConfig:       opts.HostConfig,
+		NetworkingConfig: opts.NetworkingConfig,
+	}
+
+	var container Container
+	if err := c.do("POST", path, data, &container); err != nil {
+		switch errorStatus(err) {
+		case http.StatusNotFound:
+			return nil, docker.ErrNoSuchImage
+		case http.StatusConflict:
+			return nil, docker.ErrContainerAlreadyExists
+		}
+
+		return nil, err
+	}
+
+	container.Name = opts.Name
+	return &container, nil
+}
+
+// InspectContainer returns the container info
+func (c *Client) InspectContainer(id string) (*Container, error) {
+	var container Container
+	if err := c.do("GET", "/containers/"+id+"/json", nil, &container); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return nil, &docker.NoSuchContainer{ID: id}
+		}
+
+		return nil, err
+	}
+
+	return &container, nil
+}
+
+// CreateExec creates an exec instance in the running container
+func (c *Client) CreateExec(opts CreateExecOptions) (*docker.Exec, error) {
+	var exec docker.Exec
+	if err := c.do("POST", "/containers/"+opts.Container+"/exec", opts, &exec); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return nil, &docker.NoSuchContainer{ID: opts.Container}
+		}
+
+		return nil, err
+	}
+
+	return &exec, nil
+}
+
+// CreateNetwork creates a new network
+func (c *Client) CreateNetwork(opts CreateNetworkOptions) (*docker.Network, error) {
+	var created struct {
+		ID string
+	}
+
+	if err := c.do("POST", "/networks/create", opts, &created); err != nil {
+		if errorStatus(err) == http.StatusConflict {
+			return nil, docker.ErrNetworkAlreadyExists
+		}
+
+		return nil, err
+	}
+
+	return &docker.Network{
+		ID:   created.ID,
+		Name: opts.Name,
+		Type: opts.Driver,
+	}, nil
+}
+
+// RemoveNetwork removes the network
+func (c *Client) RemoveNetwork(id string) error {
+	if err := c.do("DELETE", "/networks/"+id, nil, nil); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return &docker.NoSuchNetwork{ID: id}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// ConnectNetwork connects the container to the network
+func (c *Client) ConnectNetwork(id string, opts NetworkConnectionOptions) error {
+	return c.connectNetwork(id, "connect", opts)
+}
+
+// DisconnectNetwork disconnects the container from the network
+func (c *Client) DisconnectNetwork(id string, opts NetworkConnectionOptions) error {
+	return c.connectNetwork(id, "disconnect", opts)
+}
+
+func (c *Client) connectNetwork(id, action string, opts NetworkConnectionOptions) error {
+	if err := c.do("POST", "/networks/"+id+"/"+action, opts, nil); err != nil {
+		if errorStatus(err) == http.StatusNotFound {
+			return &NoSuchNetworkOrContainer{NetworkID: id, ContainerID: opts.Container}
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package dockerclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Docker VM environment names (the Docker daemons running in a local VM managed by a docker-machine-style tool)
+const (
+	MachineColima   = "colima"
+	MachineLima     = "lima"
+	MachineMinikube = "minikube"
+)
+
+// Docker VM environment locations
+const (
+	colimaDir             = ".colima"
+	colimaDefaultProfile  = "default"
+	limaDir               = ".lima"
+	limaDockerInstance    = "docker"
+	limaSocketPath        = "sock/docker.sock"
+	minikubeDir           = ".minikube"
+	minikubeCertsDir      = "certs"
+	minikubeProfilesDir   = "profiles"
+	minikubeConfigFile    = "config.json"
+	minikubeDefaultName   = "minikube"
+	minikubeDockerPort    = "2376"
+	dockerMachineCertsDir = ".docker/machine/machines"
+)
+
+// the minikube drivers that run the Docker daemon in a container (their daemons are not reachable on the node IP)
+var minikubeContainerDrivers = map[string]bool{
+	"docker": true,
+	"podman": true,
+	"none":   true,
+	"ssh":    true,
+}
+
+func homeDir() string {
+	return os.Getenv("HOME")
+}
+
+func envDir(envVar, homeSubdir string) string {
+	if dir := os.Getenv(envVar); dir != "" {
+		return dir
+	}
+
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, homeSubdir)
+	}
+
+	return ""
+}
+
+func colimaHome() string {
+	return envDir("COLIMA_HOME", colimaDir)
+}
+
+func limaHome() string {
+	return envDir("LIMA_HOME", limaDir)
+}
+
+func minikubeHome() string {
+	if dir := os.Getenv("MINIKUBE_HOME"); dir != "" {
+		//MINIKUBE_HOME can point to the '.minikube' directory or to its parent directory
+		if filepath.Base(dir) != minikubeDir {
+			dir = filepath.Join(dir, minikubeDir)
+		}
+
+		return dir
+	}
+
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, minikubeDir)
+	}
+
+	return ""
+}
+
+// machineSockets returns the Docker socket paths of the Colima and Lima VMs
+// (the active Colima profile first)
+func machineSockets() []string {
+	var sockets []string
+	if home := colimaHome(); home != "" {
+		profile := os.Getenv("COLIMA_PROFILE")
+		if profile == "" {
+			profile = colimaDefaultProfile
+		}
+
+		sockets = append(sockets,
+			filepath.Join(home, profile, dockerSocketName),
+			//the older Colima versions keep the socket in the Colima home directory
+			filepath.Join(home, dockerSocketName))
+	}
+
+	if home := limaHome(); home != "" {
+		instance := os.Getenv("LIMA_INSTANCE")
+		if instance == "" {
+			instance = limaDockerInstance
+		}
+
+		sockets = append(sockets, filepath.Join(home, instance, limaSocketPath))
+	}
+
+	return sockets
+}
+
+// machineCertPath returns the TLS cert directory for the Docker host configured by
+// 'minikube docker-env' or 'docker-machine env' when DOCKER_CERT_PATH is not set
+func machineCertPath(env map[string]string) string {
+	if env["DOCKER_CERT_PATH"] != "" || !isTCPHost(env["DOCKER_HOST"]) {
+		return ""
+	}
+
+	if os.Getenv("MINIKUBE_ACTIVE_DOCKERD") != "" {
+		if home := minikubeHome(); home != "" {
+			return filepath.Join(home, minikubeCertsDir)
+		}
+	}
+
+	if name := os.Getenv("DOCKER_MACHINE_NAME"); name != "" {
+		if home := homeDir(); home != "" {
+			return filepath.Join(home, dockerMachineCertsDir, name)
+		}
+	}
+
+	return ""
+}
+
+// setMachineEnv fills in the Docker cert path for the docker-machine-style environments
+// (the process env var is updated too, so it works with the env based clients)
+func setMachineEnv(clientConfig *config.DockerClient) {
+	certPath := machineCertPath(clientConfig.Env)
+	if certPath == "" {
+		return
+	}
+
+	if _, err := os.Stat(certPath); err != nil {
+		log.Debugf("dockerclient.setMachineEnv: no cert directory (%s) => %v", certPath, err)
+		return
+	}
+
+	log.Debugf("dockerclient.setMachineEnv: using the machine cert path - %s", certPath)
+	clientConfig.Env["DOCKER_CERT_PATH"] = certPath
+	if err := os.Setenv("DOCKER_CERT_PATH", certPath); err != nil {
+		log.Debugf("dockerclient.setMachineEnv: error setting DOCKER_CERT_PATH => %v", err)
+	}
+}
+
+// minikubeHost returns the Docker host address and the cert directory
+// of the minikube VM (when minikube uses a VM driver)
+func minikubeHost() (string, string) {
+	home := minikubeHome()
+	if home == "" {
+		return "", ""
+	}
+
+	profile := os.Getenv("MINIKUBE_PROFILE")
+	if profile == "" {
+		profile = minikubeDefaultName
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(home, minikubeProfilesDir, profile, minikubeConfigFile))
+	if err != nil {
+		return "", ""
+	}
+
+	var profileConfig struct {
+		Driver string
+		Nodes  []struct {
+			IP           string
+			ControlPlane bool
+		}
+	}
+
+	if err := json.Unmarshal(data, &profileConfig); err != nil {
+		log.Debugf("dockerclient.minikubeHost: invalid minikube profile config => %v", err)
+		return "", ""
+	}
+
+	if minikubeContainerDrivers[profileConfig.Driver] {
+		return "", ""
+	}
+
+	for _, node := range profileConfig.Nodes {
+		if node.ControlPlane && node.IP != "" {
+			return "tcp://" + node.IP + ":" + minikubeDockerPort, filepath.Join(home, minikubeCertsDir)
+		}
+	}
+
+	return "", ""
+}
+
+// DetectMachine returns the name of the docker-machine-style VM environment
+// running the Docker daemon (or an empty string if it's not one of the known VM environments)
+func DetectMachine(client API) string {
+	host := os.Getenv("DOCKER_HOST")
+	switch {
+	case strings.Contains(host, "/"+colimaDir+"/") || (colimaHome() != "" && strings.HasPrefix(host, unixPrefix+colimaHome())):
+		return MachineColima
+	case strings.Contains(host, "/"+limaDir+"/") || (limaHome() != "" && strings.HasPrefix(host, unixPrefix+limaHome())):
+		return MachineLima
+	case os.Getenv("MINIKUBE_ACTIVE_DOCKERD") != "":
+		return MachineMinikube
+	}
+
+	info, err := client.Info()
+	if err != nil {
+		log.Debugf("dockerclient.DetectMachine: error getting the daemon info => %v", err)
+		return ""
+	}
+
+	//the VM host names
+	switch {
+	case info.Name == MachineColima || strings.HasPrefix(info.Name, MachineColima+"-"):
+		return MachineColima
+	case strings.HasPrefix(info.Name, MachineLima+"-"):
+		return MachineLima
+	case info.Name == minikubeDefaultName:
+		return MachineMinikube
+	}
+
+	return ""
+}
+
+// MachineFileShares returns the host directories the VM environment shares with its VM
+// (writable and at the same paths, the default Colima and Lima mounts).
+// There are no known shares for the other VM environments
+// (they depend on the VM driver and the container drivers don't share any host directories).
+func MachineFileShares(machine string) []string {
+	switch machine {
+	case MachineColima:
+		shares := []string{"/tmp/colima"}
+		if home := homeDir(); home != "" {
+			shares = append(shares, home)
+		}
+
+		return shares
+	case MachineLima:
+		//the home directory is shared read-only
+		return []string{"/tmp/lima"}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package dockerclient
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// DefaultHost is the Docker Engine endpoint used when no host is configured
+const DefaultHost = "unix:///var/run/docker.sock"
+
+func newNamedPipeClient(host string) (*docker.Client, error) {
+	return nil, fmt.Errorf("named pipe Docker endpoints are not supported on %s (use a unix socket or tcp endpoint): %s",
+		runtime.GOOS, host)
+}
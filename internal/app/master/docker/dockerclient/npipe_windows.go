@@ -0,0 +1,221 @@
+package dockerclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	// DefaultHost is the Docker Engine endpoint used when no host is configured
+	DefaultHost = "npipe:////./pipe/docker_engine"
+
+	// the vendored client doesn't know the 'npipe' scheme,
+	// so the requests go to a placeholder http endpoint and the transport dials the pipe
+	namedPipeClientHost = "tcp://docker.npipe:2375"
+
+	namedPipeBusyTimeout = 10 * time.Second
+	namedPipeBusyWait    = 100 * time.Millisecond
+
+	errorPipeBusy syscall.Errno = 231
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateEvent         = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+)
+
+var errNamedPipeClosed = errors.New("named pipe is closed")
+
+func newNamedPipeClient(host string) (*docker.Client, error) {
+	pipePath, err := namedPipePath(host)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := docker.NewClient(namedPipeClientHost)
+	if err != nil {
+		return nil, err
+	}
+
+	client.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return dialNamedPipe(pipePath)
+			},
+		},
+	}
+
+	return client, nil
+}
+
+func dialNamedPipe(pipePath string) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(pipePath)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(namedPipeBusyTimeout)
+	for {
+		handle, err := syscall.CreateFile(name,
+			syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+			0,
+			nil,
+			syscall.OPEN_EXISTING,
+			syscall.FILE_FLAG_OVERLAPPED,
+			0)
+		if err == nil {
+			return &namedPipeConn{handle: handle, path: pipePath}, nil
+		}
+
+		//all pipe instances are busy (the Docker Engine opens more of them as needed)
+		if err == errorPipeBusy && time.Now().Before(deadline) {
+			time.Sleep(namedPipeBusyWait)
+			continue
+		}
+
+		return nil, &net.OpError{Op: "dial", Net: "npipe", Addr: namedPipeAddr(pipePath), Err: err}
+	}
+}
+
+type namedPipeAddr string
+
+func (a namedPipeAddr) Network() string { return "npipe" }
+func (a namedPipeAddr) String() string  { return string(a) }
+
+// namedPipeConn is a net.Conn on top of an overlapped named pipe handle
+// (overlapped I/O lets the HTTP transport read and write at the same time)
+type namedPipeConn struct {
+	handle syscall.Handle
+	path   string
+
+	closeOnce sync.Once
+	closed    int32
+	mu        sync.RWMutex
+}
+
+func (c *namedPipeConn) Read(b []byte) (int, error) {
+	n, err := c.do(b, false)
+	if err == nil && n == 0 && len(b) > 0 {
+		return 0, io.EOF
+	}
+
+	return n, err
+}
+
+func (c *namedPipeConn) Write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		n, err := c.do(b[written:], true)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+func (c *namedPipeConn) do(b []byte, isWrite bool) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return 0, errNamedPipeClosed
+	}
+
+	//manual reset event (not signaled)
+	r, _, callErr := procCreateEvent.Call(0, 1, 0, 0)
+	if r == 0 {
+		return 0, callErr
+	}
+
+	event := syscall.Handle(r)
+	defer syscall.CloseHandle(event)
+
+	var err error
+	var done uint32
+	overlapped := &syscall.Overlapped{HEvent: event}
+	if isWrite {
+		err = syscall.WriteFile(c.handle, b, &done, overlapped)
+	} else {
+		err = syscall.ReadFile(c.handle, b, &done, overlapped)
+	}
+
+	switch err {
+	case nil:
+	case syscall.ERROR_IO_PENDING:
+		r, _, callErr = procGetOverlappedResult.Call(uintptr(c.handle),
+			uintptr(unsafe.Pointer(overlapped)),
+			uintptr(unsafe.Pointer(&done)),
+			1)
+		if r == 0 {
+			return int(done), c.ioError(callErr, isWrite)
+		}
+	default:
+		return int(done), c.ioError(err, isWrite)
+	}
+
+	return int(done), nil
+}
+
+func (c *namedPipeConn) ioError(err error, isWrite bool) error {
+	if err == syscall.ERROR_BROKEN_PIPE || err == syscall.ERROR_HANDLE_EOF {
+		return io.EOF
+	}
+
+	op := "read"
+	if isWrite {
+		op = "write"
+	}
+
+	return &net.OpError{Op: op, Net: "npipe", Addr: namedPipeAddr(c.path), Err: err}
+}
+
+func (c *namedPipeConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		//reject the new I/O and unblock the pending I/O before waiting for it to finish
+		atomic.StoreInt32(&c.closed, 1)
+		syscall.CancelIoEx(c.handle, nil)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		err = syscall.CloseHandle(c.handle)
+	})
+
+	return err
+}
+
+func (c *namedPipeConn) LocalAddr() net.Addr  { return namedPipeAddr(c.path) }
+func (c *namedPipeConn) RemoteAddr() net.Addr { return namedPipeAddr(c.path) }
+
+// the deadlines are not supported (the Docker client uses them only for the hijacked connections)
+func (c *namedPipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *namedPipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *namedPipeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func namedPipePath(host string) (string, error) {
+	if !strings.HasPrefix(host, namedPipePrefix) {
+		return "", errInvalidNamedPipe
+	}
+
+	pipePath := strings.TrimPrefix(host, namedPipePrefix)
+	if !strings.HasPrefix(pipePath, "//") {
+		return "", errInvalidNamedPipe
+	}
+
+	//npipe:////./pipe/docker_engine -> \\.\pipe\docker_engine
+	return strings.Replace(pipePath, "/", `\`, -1), nil
+}
@@ -0,0 +1,19 @@
+package dockerclient
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// OSTypeWindows is the Docker daemon OS type for the Windows container daemons
+const OSTypeWindows = "windows"
+
+// IsWindowsDaemon returns true if the Docker daemon runs Windows containers
+func IsWindowsDaemon(client API) bool {
+	info, err := client.Info()
+	if err != nil {
+		log.Debugf("dockerclient.IsWindowsDaemon: error getting the daemon info => %v", err)
+		return false
+	}
+
+	return info.OSType == OSTypeWindows
+}
@@ -0,0 +1,44 @@
+package dockerclient
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Podman Docker-compatible API socket locations
+const (
+	PodmanRootfulSocket  = "/run/podman/podman.sock"
+	podmanRootlessSocket = "podman/podman.sock"
+	podmanEngineName     = "Podman Engine"
+)
+
+// podmanSockets returns the Podman socket paths (the rootless socket first)
+func podmanSockets() []string {
+	var sockets []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append(sockets, filepath.Join(runtimeDir, podmanRootlessSocket))
+	}
+
+	return append(sockets, PodmanRootfulSocket)
+}
+
+// IsPodman returns true if the Docker API is provided by Podman
+func IsPodman(client API) bool {
+	ver, err := client.Version()
+	if err != nil {
+		log.Debugf("dockerclient.IsPodman: error getting the version info => %v", err)
+		return false
+	}
+
+	return strings.Contains(ver.Get("Components"), podmanEngineName)
+}
+
+// IsRootlessPodmanHost returns true if the Docker host address is a rootless Podman socket
+func IsRootlessPodmanHost(host string) bool {
+	return strings.HasPrefix(host, unixPrefix) &&
+		strings.HasSuffix(host, podmanRootlessSocket) &&
+		!strings.HasSuffix(host, PodmanRootfulSocket)
+}
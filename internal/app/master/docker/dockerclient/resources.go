@@ -0,0 +1,127 @@
+package dockerclient
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the tracker records the containers and the networks docker-slim creates (the instrumented containers,
+//  the profile check containers and the image file containers), so an interrupted command can remove
+//  the ones that are still there (the deferred removals don't run when the command exits)
+//* the temporary images are recorded explicitly (the image builds don't return the image IDs)
+
+// ResourceTracker is the client that records the containers and the networks it creates
+type ResourceTracker struct {
+	API
+	mu         sync.Mutex
+	containers []string
+	networks   []string
+	images     []string
+}
+
+// NewResourceTracker creates a new resource tracking client
+func NewResourceTracker(client API) *ResourceTracker {
+	return &ResourceTracker{API: client}
+}
+
+func (t *ResourceTracker) CreateContainer(opts CreateContainerOptions) (*Container, error) {
+	container, err := t.API.CreateContainer(opts)
+	if err == nil && container != nil {
+		t.mu.Lock()
+		t.containers = append(t.containers, container.ID)
+		t.mu.Unlock()
+	}
+
+	return container, err
+}
+
+func (t *ResourceTracker) RemoveContainer(opts docker.RemoveContainerOptions) error {
+	err := t.API.RemoveContainer(opts)
+	if _, ok := err.(*docker.NoSuchContainer); err == nil || ok {
+		t.mu.Lock()
+		t.containers = removeValue(t.containers, opts.ID)
+		t.mu.Unlock()
+	}
+
+	return err
+}
+
+func (t *ResourceTracker) CreateNetwork(opts CreateNetworkOptions) (*docker.Network, error) {
+	network, err := t.API.CreateNetwork(opts)
+	if err == nil && network != nil {
+		t.mu.Lock()
+		t.networks = append(t.networks, network.ID)
+		t.mu.Unlock()
+	}
+
+	return network, err
+}
+
+func (t *ResourceTracker) RemoveNetwork(id string) error {
+	err := t.API.RemoveNetwork(id)
+	if _, ok := err.(*docker.NoSuchNetwork); err == nil || ok {
+		t.mu.Lock()
+		t.networks = removeValue(t.networks, id)
+		t.mu.Unlock()
+	}
+
+	return err
+}
+
+// TrackImage records the temporary image
+func (t *ResourceTracker) TrackImage(name string) {
+	t.mu.Lock()
+	t.images = append(t.images, name)
+	t.mu.Unlock()
+}
+
+// RemoveAll removes the recorded containers, networks and images
+// (the errors are logged, so it removes as much as it can)
+func (t *ResourceTracker) RemoveAll() {
+	t.mu.Lock()
+	containers, networks, images := t.containers, t.networks, t.images
+	t.containers, t.networks, t.images = nil, nil, nil
+	t.mu.Unlock()
+
+	//the containers are removed first (the networks with the connected containers can't be removed)
+	for _, id := range containers {
+		log.Debugf("ResourceTracker.RemoveAll: removing container %v", id)
+		err := t.API.RemoveContainer(docker.RemoveContainerOptions{
+			ID:            id,
+			RemoveVolumes: true,
+			Force:         true,
+		})
+
+		if _, ok := err.(*docker.NoSuchContainer); err != nil && !ok {
+			log.Infof("ResourceTracker.RemoveAll: error removing container %v => %v", id, err)
+		}
+	}
+
+	for _, id := range networks {
+		log.Debugf("ResourceTracker.RemoveAll: removing network %v", id)
+		err := t.API.RemoveNetwork(id)
+		if _, ok := err.(*docker.NoSuchNetwork); err != nil && !ok {
+			log.Infof("ResourceTracker.RemoveAll: error removing network %v => %v", id, err)
+		}
+	}
+
+	for _, name := range images {
+		log.Debugf("ResourceTracker.RemoveAll: removing image %v", name)
+		if err := t.API.RemoveImage(name); err != nil && err != docker.ErrNoSuchImage {
+			log.Infof("ResourceTracker.RemoveAll: error removing image %v => %v", name, err)
+		}
+	}
+}
+
+func removeValue(values []string, value string) []string {
+	for idx, v := range values {
+		if v == value {
+			return append(values[:idx], values[idx+1:]...)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,293 @@
+package dockerclient
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* only the idempotent calls (or the calls that can be made idempotent) are retried:
+//  the inspect and list calls, the container create (only for the named containers), start, stop and remove calls
+//  and the image builds
+//* a retried call can find the result of the failed attempt (the daemon can fail after it did the work),
+//  so the 'already exists', 'already running', 'not running' and 'no such container' retry errors are not errors
+//* the streamed calls (uploads, downloads, pulls, pushes, logs, attaches and execs) are not retried
+//  (their streams can't be replayed); the builds with the streamed context are retried by the image builder (see Retry)
+
+// Retry settings
+const (
+	DefaultRetries      = 3
+	DefaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// retryClient retries the Docker API calls that fail with the transient errors
+type retryClient struct {
+	API
+	retries int
+	backoff time.Duration
+}
+
+// WithRetries returns the client that retries the transient Docker API errors with exponential backoff
+// (the backoff is the first retry delay and it's doubled for each retry)
+func WithRetries(client API, retries int, backoff time.Duration) API {
+	if retries <= 0 {
+		return client
+	}
+
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return &retryClient{
+		API:     client,
+		retries: retries,
+		backoff: backoff,
+	}
+}
+
+// Retry runs the call with the client retry settings
+// (it's for the calls with the streams the client can't replay, so the call recreates them)
+func Retry(client API, name string, call func() error) error {
+	for {
+		switch c := client.(type) {
+		case *retryClient:
+			return c.retry(name, call)
+		case *ResourceTracker:
+			client = c.API
+		default:
+			return call()
+		}
+	}
+}
+
+// IsTransientError returns true if the Docker API error is a connection error,
+// a timeout or a daemon server error
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	if operr, ok := err.(*net.OpError); ok {
+		err = operr.Err
+		if serr, ok := err.(*os.SyscallError); ok {
+			err = serr.Err
+		}
+	}
+
+	switch e := err.(type) {
+	case *docker.Error:
+		switch e.Status {
+		case http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	case net.Error:
+		if e.Timeout() {
+			return true
+		}
+	}
+
+	switch err {
+	case io.EOF,
+		io.ErrUnexpectedEOF,
+		docker.ErrConnectionRefused,
+		syscall.ECONNRESET,
+		syscall.ECONNREFUSED,
+		syscall.EPIPE:
+		return true
+	}
+
+	//the wrapped errors (e.g., from the ssh and named pipe connections) are matched by their messages
+	msg := err.Error()
+	return strings.HasSuffix(msg, io.EOF.Error()) ||
+		strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "broken pipe")
+}
+
+func (c *retryClient) retry(name string, call func() error) error {
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt > c.retries || !IsTransientError(err) {
+			return err
+		}
+
+		log.Infof("dockerclient: %s failed (attempt %v/%v, retrying in %v) => %v", name, attempt, c.retries+1, delay, err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxRetryBackoff {
+			delay = maxRetryBackoff
+		}
+	}
+}
+
+func (c *retryClient) Version() (*docker.Env, error) {
+	var result *docker.Env
+	err := c.retry("Version", func() (err error) {
+		result, err = c.API.Version()
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) Info() (*DockerInfo, error) {
+	var result *DockerInfo
+	err := c.retry("Info", func() (err error) {
+		result, err = c.API.Info()
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error) {
+	var result []docker.APIImages
+	err := c.retry("ListImages", func() (err error) {
+		result, err = c.API.ListImages(opts)
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) InspectImage(name string) (*Image, error) {
+	var result *Image
+	err := c.retry("InspectImage", func() (err error) {
+		result, err = c.API.InspectImage(name)
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) ImageHistory(name string) ([]docker.ImageHistory, error) {
+	var result []docker.ImageHistory
+	err := c.retry("ImageHistory", func() (err error) {
+		result, err = c.API.ImageHistory(name)
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) BuildImage(opts docker.BuildImageOptions) error {
+	if opts.InputStream != nil {
+		return c.API.BuildImage(opts)
+	}
+
+	return c.retry("BuildImage", func() error {
+		return c.API.BuildImage(opts)
+	})
+}
+
+func (c *retryClient) ListNetworks() ([]docker.Network, error) {
+	var result []docker.Network
+	err := c.retry("ListNetworks", func() (err error) {
+		result, err = c.API.ListNetworks()
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) CreateContainer(opts CreateContainerOptions) (*Container, error) {
+	if opts.Name == "" {
+		//the container created by a failed attempt can't be found by its name,
+		//so the retried call would leave it behind
+		return c.API.CreateContainer(opts)
+	}
+
+	var result *Container
+	retried := false
+	err := c.retry("CreateContainer", func() (err error) {
+		result, err = c.API.CreateContainer(opts)
+		if err == docker.ErrContainerAlreadyExists && retried {
+			//the failed attempt created the container
+			result, err = c.API.InspectContainer(opts.Name)
+		}
+
+		retried = true
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) StartContainer(id string, hostConfig *docker.HostConfig) error {
+	retried := false
+	return c.retry("StartContainer", func() error {
+		err := c.API.StartContainer(id, hostConfig)
+		if _, ok := err.(*docker.ContainerAlreadyRunning); ok && retried {
+			return nil
+		}
+
+		retried = true
+		return err
+	})
+}
+
+func (c *retryClient) StopContainer(id string, timeout uint) error {
+	retried := false
+	return c.retry("StopContainer", func() error {
+		err := c.API.StopContainer(id, timeout)
+		if _, ok := err.(*docker.ContainerNotRunning); ok && retried {
+			return nil
+		}
+
+		retried = true
+		return err
+	})
+}
+
+func (c *retryClient) RemoveContainer(opts docker.RemoveContainerOptions) error {
+	retried := false
+	return c.retry("RemoveContainer", func() error {
+		err := c.API.RemoveContainer(opts)
+		if _, ok := err.(*docker.NoSuchContainer); ok && retried {
+			return nil
+		}
+
+		retried = true
+		return err
+	})
+}
+
+func (c *retryClient) InspectContainer(id string) (*Container, error) {
+	var result *Container
+	err := c.retry("InspectContainer", func() (err error) {
+		result, err = c.API.InspectContainer(id)
+		return err
+	})
+
+	return result, err
+}
+
+func (c *retryClient) InspectVolume(name string) (*docker.Volume, error) {
+	var result *docker.Volume
+	err := c.retry("InspectVolume", func() (err error) {
+		result, err = c.API.InspectVolume(name)
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,79 @@
+package dockerclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Docker host address sources (reported with the selected Docker endpoint)
+const (
+	HostSourceFlag       = "flag"
+	HostSourceContext    = "context"
+	HostSourceEnv        = "env"
+	HostSourceDefault    = "default"
+	HostSourceDiscovered = "discovered"
+)
+
+// Docker Engine socket locations checked when the default socket doesn't exist
+const (
+	dockerSocketName         = "docker.sock"
+	rootlessRuntimeDirPat    = "/run/user/%d"
+	dockerDesktopSocket      = ".docker/run/docker.sock"
+	dockerDesktopLinuxSocket = ".docker/desktop/docker.sock"
+)
+
+// socketCandidates returns the Docker Engine socket paths docker-slim looks for
+// when there's no configured Docker host (the default socket first, the Podman sockets last)
+func socketCandidates() []string {
+	candidates := []string{strings.TrimPrefix(DefaultHost, unixPrefix)}
+
+	//rootless Docker
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, dockerSocketName))
+	}
+
+	uidRuntimeDir := fmt.Sprintf(rootlessRuntimeDirPat, os.Getuid())
+	candidates = append(candidates, filepath.Join(uidRuntimeDir, dockerSocketName))
+
+	//Docker Desktop (the per-user sockets)
+	if homeDir := os.Getenv("HOME"); homeDir != "" {
+		candidates = append(candidates,
+			filepath.Join(homeDir, dockerDesktopSocket),
+			filepath.Join(homeDir, dockerDesktopLinuxSocket))
+	}
+
+	//Colima and Lima VMs
+	candidates = append(candidates, machineSockets()...)
+
+	candidates = append(candidates, podmanSockets()...)
+
+	//the same path can be listed more than once (e.g., XDG_RUNTIME_DIR is /run/user/<uid>)
+	var result []string
+	known := map[string]bool{}
+	for _, candidate := range candidates {
+		if !known[candidate] {
+			known[candidate] = true
+			result = append(result, candidate)
+		}
+	}
+
+	return result
+}
+
+// discoverHost returns the Docker host address for the first available Docker Engine socket
+func discoverHost() string {
+	for _, socketPath := range socketCandidates() {
+		if isSocket(socketPath) {
+			return unixPrefix + socketPath
+		}
+	}
+
+	return ""
+}
+
+func isSocket(socketPath string) bool {
+	info, err := os.Stat(socketPath)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
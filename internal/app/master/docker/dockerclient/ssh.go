@@ -0,0 +1,210 @@
+package dockerclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	sshPrefix = "ssh://"
+
+	// the vendored client doesn't know the 'ssh' scheme,
+	// so the requests go to a placeholder http endpoint and the transport dials the ssh tunnel
+	sshClientHost = "tcp://docker.ssh:2375"
+
+	sshCmdName = "ssh"
+)
+
+var errInvalidSSHHost = errors.New("invalid ssh endpoint (use 'ssh://[user@]host[:port]')")
+
+// newSSHClient creates a Docker client that talks to a remote Docker daemon over ssh
+// (the ssh command line tool handles the connection and the authentication,
+// so the ssh agent, the ssh config and the selected key file work the usual way)
+func newSSHClient(host string, identityFile string) (*docker.Client, error) {
+	sshArgs, err := sshCommandArgs(host, identityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	sshPath, err := exec.LookPath(sshCmdName)
+	if err != nil {
+		return nil, fmt.Errorf("ssh Docker endpoints need the ssh command line tool: %v", err)
+	}
+
+	client, err := docker.NewClient(sshClientHost)
+	if err != nil {
+		return nil, err
+	}
+
+	client.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return dialSSH(sshPath, sshArgs)
+			},
+		},
+	}
+
+	return client, nil
+}
+
+// sshCommandArgs creates the ssh command arguments to proxy the Docker API
+// with 'docker system dial-stdio' on the remote host
+func sshCommandArgs(host string, identityFile string) ([]string, error) {
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, errInvalidSSHHost
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("ssh endpoint paths are not supported: %s", host)
+	}
+
+	//the tunnel uses the ssh stdin/stdout, so it's not possible to answer any prompts
+	args := []string{"-o", "BatchMode=yes"}
+
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return nil, fmt.Errorf("ssh endpoint passwords are not supported (use the ssh agent or a key file): %s", u.Hostname())
+		}
+
+		args = append(args, "-l", u.User.Username())
+	}
+
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+
+	if identityFile != "" {
+		args = append(args, "-i", identityFile, "-o", "IdentitiesOnly=yes")
+	}
+
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+	return args, nil
+}
+
+func dialSSH(sshPath string, args []string) (net.Conn, error) {
+	cmd := exec.Command(sshPath, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &sshConn{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+	}
+
+	cmd.Stderr = &conn.stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// sshConn is a net.Conn backed by the stdin/stdout of the ssh process
+type sshConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr syncBuffer
+	once   sync.Once
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if err == io.EOF {
+		if msg := c.stderr.String(); msg != "" {
+			return n, fmt.Errorf("ssh connection to the Docker host failed: %s", msg)
+		}
+	}
+
+	return n, err
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *sshConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+
+		c.cmd.Wait()
+	})
+
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr {
+	return sshAddr{}
+}
+
+func (c *sshConn) RemoteAddr() net.Addr {
+	return sshAddr{}
+}
+
+//the pipes don't support deadlines (the ssh process is killed when the connection is closed)
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type sshAddr struct{}
+
+func (sshAddr) Network() string {
+	return "ssh"
+}
+
+func (sshAddr) String() string {
+	return "ssh"
+}
+
+// syncBuffer collects the ssh error output
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
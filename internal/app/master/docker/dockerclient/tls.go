@@ -0,0 +1,137 @@
+package dockerclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+)
+
+// Default TLS file names in the TLS cert directory
+const (
+	tlsCACertFileName = "ca.pem"
+	tlsCertFileName   = "cert.pem"
+	tlsKeyFileName    = "key.pem"
+)
+
+var errTLSClientCertPair = errors.New("both the TLS client certificate and key are required (--tls-cert and --tls-key)")
+
+// tlsFiles provides the TLS file locations for the Docker client
+type tlsFiles struct {
+	CACert string
+	Cert   string
+	Key    string
+}
+
+// hasTLSFiles returns true if the TLS cert directory or any of the TLS files are configured
+func hasTLSFiles(config *config.DockerClient) bool {
+	return config.TLSCertPath != "" ||
+		config.TLSCACert != "" ||
+		config.TLSCert != "" ||
+		config.TLSKey != ""
+}
+
+// getTLSFiles selects the TLS files from the cert directory
+// (the explicitly configured files take precedence)
+func getTLSFiles(certPath string, config *config.DockerClient) tlsFiles {
+	files := tlsFiles{
+		CACert: config.TLSCACert,
+		Cert:   config.TLSCert,
+		Key:    config.TLSKey,
+	}
+
+	fromCertPath := func(name string) string {
+		if certPath == "" {
+			return ""
+		}
+
+		filePath := filepath.Join(certPath, name)
+		if !fsutil.Exists(filePath) {
+			return ""
+		}
+
+		return filePath
+	}
+
+	if files.CACert == "" {
+		files.CACert = fromCertPath(tlsCACertFileName)
+	}
+
+	if files.Cert == "" && files.Key == "" {
+		files.Cert = fromCertPath(tlsCertFileName)
+		files.Key = fromCertPath(tlsKeyFileName)
+	}
+
+	return files
+}
+
+func newTLSClient(host string, files tlsFiles, verify bool, serverName string) (*docker.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: !verify,
+	}
+
+	if files.Cert != "" || files.Key != "" {
+		if files.Cert == "" || files.Key == "" {
+			return nil, errTLSClientCertPair
+		}
+
+		cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the TLS client certificate (%s, %s): %v", files.Cert, files.Key, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	//without a custom CA the system root CAs are used to verify the daemon certificate
+	if verify && files.CACert != "" {
+		caData, err := ioutil.ReadFile(files.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the TLS CA certificate (%s): %v", files.CACert, err)
+		}
+
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("invalid TLS CA certificate (%s)", files.CACert)
+		}
+
+		tlsConfig.RootCAs = caPool
+	}
+
+	//the vendored client uses TLS for the 'https' endpoints
+	endpoint := host
+	if strings.HasPrefix(endpoint, "tcp://") {
+		endpoint = "https://" + strings.TrimPrefix(endpoint, "tcp://")
+	}
+
+	client, err := docker.NewClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	client.TLSConfig = tlsConfig
+	client.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return client, nil
+}
+
+func isTLSError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "x509:") ||
+		strings.Contains(msg, "tls:") ||
+		strings.Contains(msg, "certificate")
+}
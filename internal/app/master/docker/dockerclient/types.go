@@ -0,0 +1,155 @@
+package dockerclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+//NOTES:
+//* the vendored go-dockerclientx types don't have the newer Docker Engine API fields docker-slim uses,
+//  so the types here embed the vendored types and add the missing fields
+//  (the fields with the same JSON names shadow the embedded fields, so the added fields are decoded too)
+//* the vendored package is not modified (update it by re-vendoring a new fork revision)
+
+// Config is the container config with the fields the vendored client doesn't have
+type Config struct {
+	docker.Config
+	StopSignal string   `json:"StopSignal,omitempty" yaml:"StopSignal,omitempty"`
+	Shell      []string `json:"Shell,omitempty" yaml:"Shell,omitempty"`
+}
+
+// HostConfig is the container host config with the fields the vendored client doesn't have
+type HostConfig struct {
+	docker.HostConfig
+	DNSOptions     []string               `json:"DnsOptions,omitempty" yaml:"DnsOptions,omitempty"`
+	DeviceRequests []config.DeviceRequest `json:"DeviceRequests,omitempty" yaml:"DeviceRequests,omitempty"`
+	PidsLimit      int64                  `json:"PidsLimit,omitempty" yaml:"PidsLimit,omitempty"`
+	ShmSize        int64                  `json:"ShmSize,omitempty" yaml:"ShmSize,omitempty"`
+	Tmpfs          map[string]string      `json:"Tmpfs,omitempty" yaml:"Tmpfs,omitempty"`
+	Sysctls        map[string]string      `json:"Sysctls,omitempty" yaml:"Sysctls,omitempty"`
+}
+
+// EndpointIPAMConfig represents the IPAM configuration for a network endpoint
+type EndpointIPAMConfig struct {
+	IPv4Address string `json:"IPv4Address,omitempty" yaml:"IPv4Address,omitempty"`
+	IPv6Address string `json:"IPv6Address,omitempty" yaml:"IPv6Address,omitempty"`
+}
+
+// EndpointConfig stores the network endpoint configuration (the static addresses and the aliases)
+type EndpointConfig struct {
+	IPAMConfig *EndpointIPAMConfig `json:"IPAMConfig,omitempty" yaml:"IPAMConfig,omitempty"`
+	Aliases    []string            `json:"Aliases,omitempty" yaml:"Aliases,omitempty"`
+}
+
+// NetworkingConfig represents the container networking configuration for each of its networks
+type NetworkingConfig struct {
+	EndpointsConfig map[string]*EndpointConfig `json:"EndpointsConfig,omitempty" yaml:"EndpointsConfig,omitempty"`
+}
+
+// CreateContainerOptions specify the parameters for the CreateContainer call
+type CreateContainerOptions struct {
+	Name             string
+	Config           *Config
+	HostConfig       *HostConfig
+	NetworkingConfig *NetworkingConfig
+}
+
+// HealthCheck represents one container health check
+type HealthCheck struct {
+	Start    time.Time `json:"Start,omitempty" yaml:"Start,omitempty"`
+	End      time.Time `json:"End,omitempty" yaml:"End,omitempty"`
+	ExitCode int       `json:"ExitCode,omitempty" yaml:"ExitCode,omitempty"`
+	Output   string    `json:"Output,omitempty" yaml:"Output,omitempty"`
+}
+
+// Health represents the container health
+type Health struct {
+	Status        string        `json:"Status,omitempty" yaml:"Status,omitempty"`
+	FailingStreak int           `json:"FailingStreak,omitempty" yaml:"FailingStreak,omitempty"`
+	Log           []HealthCheck `json:"Log,omitempty" yaml:"Log,omitempty"`
+}
+
+// State is the container state with the container health
+type State struct {
+	docker.State
+	Health Health `json:"Health,omitempty" yaml:"Health,omitempty"`
+}
+
+// ContainerNetwork represents the container networking settings for one network
+type ContainerNetwork struct {
+	MacAddress          string `json:"MacAddress,omitempty" yaml:"MacAddress,omitempty"`
+	GlobalIPv6PrefixLen int    `json:"GlobalIPv6PrefixLen,omitempty" yaml:"GlobalIPv6PrefixLen,omitempty"`
+	GlobalIPv6Address   string `json:"GlobalIPv6Address,omitempty" yaml:"GlobalIPv6Address,omitempty"`
+	IPv6Gateway         string `json:"IPv6Gateway,omitempty" yaml:"IPv6Gateway,omitempty"`
+	IPPrefixLen         int    `json:"IPPrefixLen,omitempty" yaml:"IPPrefixLen,omitempty"`
+	IPAddress           string `json:"IPAddress,omitempty" yaml:"IPAddress,omitempty"`
+	Gateway             string `json:"Gateway,omitempty" yaml:"Gateway,omitempty"`
+	EndpointID          string `json:"EndpointID,omitempty" yaml:"EndpointID,omitempty"`
+	NetworkID           string `json:"NetworkID,omitempty" yaml:"NetworkID,omitempty"`
+}
+
+// NetworkSettings are the container network settings with the per network settings
+type NetworkSettings struct {
+	docker.NetworkSettings
+	Networks map[string]ContainerNetwork `json:"Networks,omitempty" yaml:"Networks,omitempty"`
+}
+
+// Container is the container info with the fields the vendored client doesn't have
+type Container struct {
+	docker.Container
+	Config          *Config          `json:"Config,omitempty" yaml:"Config,omitempty"`
+	State           State            `json:"State,omitempty" yaml:"State,omitempty"`
+	NetworkSettings *NetworkSettings `json:"NetworkSettings,omitempty" yaml:"NetworkSettings,omitempty"`
+}
+
+// Image is the image info with the fields the vendored client doesn't have
+type Image struct {
+	docker.Image
+	Config    *Config `json:"Config,omitempty" yaml:"Config,omitempty"`
+	Variant   string  `json:"Variant,omitempty" yaml:"Variant,omitempty"`
+	OS        string  `json:"Os,omitempty" yaml:"Os,omitempty"`
+	OSVersion string  `json:"OsVersion,omitempty" yaml:"OsVersion,omitempty"`
+}
+
+// DockerInfo is the daemon info with the fields the vendored client doesn't have
+type DockerInfo struct {
+	docker.DockerInfo
+	SecurityOptions []string
+}
+
+// CreateExecOptions specify the parameters for the CreateExec call
+type CreateExecOptions struct {
+	docker.CreateExecOptions
+	Privileged bool `json:"Privileged,omitempty" yaml:"Privileged,omitempty"`
+}
+
+// CreateNetworkOptions specify the parameters for the CreateNetwork call
+type CreateNetworkOptions struct {
+	Name           string            `json:"Name"`
+	CheckDuplicate bool              `json:"CheckDuplicate,omitempty"`
+	Driver         string            `json:"Driver,omitempty"`
+	Internal       bool              `json:"Internal,omitempty"`
+	Options        map[string]string `json:"Options,omitempty"`
+	Labels         map[string]string `json:"Labels,omitempty"`
+}
+
+// NetworkConnectionOptions specify the parameters for the ConnectNetwork and DisconnectNetwork calls
+type NetworkConnectionOptions struct {
+	Container string
+
+	// Force is only used by the DisconnectNetwork call
+	Force bool
+}
+
+// NoSuchNetworkOrContainer is the error returned when the network or the container doesn't exist
+type NoSuchNetworkOrContainer struct {
+	NetworkID   string
+	ContainerID string
+}
+
+func (err *NoSuchNetworkOrContainer) Error() string {
+	return fmt.Sprintf("No such network (%s) or container (%s)", err.NetworkID, err.ContainerID)
+}
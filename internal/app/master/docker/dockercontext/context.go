@@ -0,0 +1,152 @@
+package dockercontext
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+)
+
+// DefaultName is the name of the built-in Docker CLI context
+// (it uses the DOCKER_* environment variables or the default endpoint)
+const DefaultName = "default"
+
+const (
+	contextsDirName   = "contexts"
+	metaDirName       = "meta"
+	tlsDirName        = "tls"
+	metaFileName      = "meta.json"
+	configFileName    = "config.json"
+	dockerEndpointKey = "docker"
+)
+
+// Info provides the Docker daemon connection settings from a Docker CLI context
+type Info struct {
+	Name          string
+	Host          string
+	SkipTLSVerify bool
+	//TLSPath is the directory with the context TLS files (ca.pem, cert.pem, key.pem)
+	TLSPath string
+}
+
+// HasTLS returns true if the context has TLS files
+func (i *Info) HasTLS() bool {
+	return i.TLSPath != ""
+}
+
+type contextMeta struct {
+	Name      string                  `json:"Name"`
+	Endpoints map[string]endpointMeta `json:"Endpoints"`
+}
+
+type endpointMeta struct {
+	Host          string `json:"Host"`
+	SkipTLSVerify bool   `json:"SkipTLSVerify"`
+}
+
+// ConfigDir returns the Docker CLI configuration directory
+// (DOCKER_CONFIG or ~/.docker)
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		currentUser, err := user.Current()
+		if err != nil || currentUser.HomeDir == "" {
+			return "", fmt.Errorf("can't resolve the home directory for the Docker CLI configuration")
+		}
+
+		homeDir = currentUser.HomeDir
+	}
+
+	return filepath.Join(homeDir, ".docker"), nil
+}
+
+// Current returns the name of the current Docker CLI context
+// (the 'currentContext' value in the Docker CLI configuration, empty if it's not set)
+func Current() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir, configFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	var cliConfig struct {
+		CurrentContext string `json:"currentContext"`
+	}
+
+	if err := json.Unmarshal(data, &cliConfig); err != nil {
+		return "", fmt.Errorf("invalid Docker CLI configuration (%s): %v", configFileName, err)
+	}
+
+	return cliConfig.CurrentContext, nil
+}
+
+// Load reads the Docker daemon connection settings for the named Docker CLI context
+// (nil is returned for the 'default' context, which doesn't have any stored settings)
+func Load(name string) (*Info, error) {
+	if name == "" || name == DefaultName {
+		return nil, nil
+	}
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	id := contextID(name)
+	metaPath := filepath.Join(configDir, contextsDirName, metaDirName, id, metaFileName)
+	data, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("docker context not found: %s", name)
+		}
+
+		return nil, err
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid docker context metadata (%s): %v", metaPath, err)
+	}
+
+	endpoint, ok := meta.Endpoints[dockerEndpointKey]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("docker context has no docker endpoint: %s", name)
+	}
+
+	info := &Info{
+		Name:          name,
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+
+	tlsPath := filepath.Join(configDir, contextsDirName, tlsDirName, id, dockerEndpointKey)
+	if fsutil.DirExists(tlsPath) {
+		info.TLSPath = tlsPath
+	}
+
+	return info, nil
+}
+
+// the Docker CLI stores the context data in directories named with the SHA256 digest of the context name
+func contextID(name string) string {
+	digest := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(digest[:])
+}
@@ -2,9 +2,11 @@ package dockerfile
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/cloudimmunity/go-dockerclientx"
 	"github.com/dustin/go-humanize"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	v "github.com/docker-slim/docker-slim/pkg/version"
 )
 
@@ -56,14 +59,57 @@ type InstructionInfo struct {
 	RawTags             []string `json:"raw_tags,omitempty"`
 }
 
+const nopMarker = "#(nop) "
+
+// shellPrefixes are the default shells that run the RUN instructions
+// (Linux images and Windows images)
+var shellPrefixes = []string{
+	"/bin/sh -c ",
+	"cmd /S /C ",
+	"powershell -Command ",
+}
+
+// windowsBaseLayerPrefixes identify the Windows base image layers
+// (they are not created from a Dockerfile, so they have no instructions)
+var windowsBaseLayerPrefixes = []string{
+	"Apply image ",
+	"Install update ",
+}
+
+func shellPrefix(rawLine string) string {
+	for _, prefix := range shellPrefixes {
+		if strings.HasPrefix(rawLine, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+func isWindowsBaseLayer(rawLine string) bool {
+	for _, prefix := range windowsBaseLayerPrefixes {
+		if strings.HasPrefix(rawLine, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ReverseDockerfileFromHistory recreates Dockerfile information from container image history
-func ReverseDockerfileFromHistory(apiClient *docker.Client, imageID string) (*Info, error) {
+func ReverseDockerfileFromHistory(apiClient dockerclient.API, imageID string) (*Info, error) {
 	//NOTE: comment field is missing (TODO: enhance the lib...)
 	imageHistory, err := apiClient.ImageHistory(imageID)
 	if err != nil {
 		return nil, err
 	}
 
+	return ReverseDockerfile(imageHistory)
+}
+
+// ReverseDockerfile recreates Dockerfile information from the image history records
+// (the records are ordered like the Docker image history, the newest record first)
+func ReverseDockerfile(imageHistory []docker.ImageHistory) (*Info, error) {
 	var out Info
 
 	log.Debugf("\n\nIMAGE HISTORY =>\n%#v\n\n", imageHistory)
@@ -79,8 +125,6 @@ func ReverseDockerfileFromHistory(apiClient *docker.Client, imageID string) (*In
 		for idx := imageLayerStart; idx >= 0; idx-- {
 			isNop := false
 
-			nopPrefix := "/bin/sh -c #(nop) "
-			execPrefix := "/bin/sh -c "
 			rawLine := imageHistory[idx].CreatedBy
 			var inst string
 
@@ -88,12 +132,17 @@ func ReverseDockerfileFromHistory(apiClient *docker.Client, imageID string) (*In
 				isNop = true
 			}
 
+			execPrefix := shellPrefix(rawLine)
+
 			switch {
 			case len(rawLine) == 0:
 				inst = "FROM scratch"
-			case strings.HasPrefix(rawLine, nopPrefix):
-				inst = strings.TrimPrefix(rawLine, nopPrefix)
-			case strings.HasPrefix(rawLine, execPrefix):
+			case isWindowsBaseLayer(rawLine):
+				//the Windows base layers are not created with Dockerfile instructions
+				inst = "# Windows base layer: " + rawLine
+			case isNop && strings.Contains(rawLine, nopMarker):
+				inst = strings.TrimSpace(rawLine[strings.Index(rawLine, nopMarker)+len(nopMarker):])
+			case execPrefix != "":
 				runData := strings.TrimPrefix(rawLine, execPrefix)
 				if strings.Contains(runData, "&&") {
 					parts := strings.Split(runData, "&&")
@@ -306,28 +355,58 @@ func SaveDockerfileData(fatImageDockerfileLocation string, fatImageDockerfileLin
 
 // GenerateFromInfo builds and saves a Dockerfile file object
 func GenerateFromInfo(location string,
+	baseImage string,
+	author string,
 	volumes map[string]struct{},
 	workingDir string,
 	env []string,
 	user string,
+	labels map[string]string,
 	exposedPorts map[docker.Port]struct{},
 	entrypoint []string,
 	cmd []string,
-	hasData bool) error {
+	stopSignal string,
+	shell []string,
+	onBuild []string,
+	hasData bool,
+	layerDirs []string,
+	appDataOwner string) error {
 
 	dockerfileLocation := filepath.Join(location, "Dockerfile")
 
 	var dfData bytes.Buffer
-	dfData.WriteString("FROM scratch\n")
+	if baseImage != "" {
+		dfData.WriteString(fmt.Sprintf("FROM %s\n", baseImage))
+	} else {
+		dfData.WriteString("FROM scratch\n")
+	}
+
+	if author != "" {
+		dfData.WriteString(fmt.Sprintf("MAINTAINER %s\n", author))
+	}
 
 	dsInfoLabel := fmt.Sprintf("LABEL docker-slim.version=\"%s\"\n", v.Current())
 	dfData.WriteString(dsInfoLabel)
 
+	if len(labels) > 0 {
+		labelNames := make([]string, 0, len(labels))
+		for name := range labels {
+			labelNames = append(labelNames, name)
+		}
+		sort.Strings(labelNames)
+
+		for _, name := range labelNames {
+			labelInst := fmt.Sprintf("LABEL %s=%s\n", strconv.Quote(name), strconv.Quote(labels[name]))
+			dfData.WriteString(labelInst)
+		}
+	}
+
 	if len(volumes) > 0 {
 		var volumeList []string
 		for volumeName := range volumes {
 			volumeList = append(volumeList, strconv.Quote(volumeName))
 		}
+		sort.Strings(volumeList)
 
 		volumeInst := fmt.Sprintf("VOLUME [%s]", strings.Join(volumeList, ","))
 		dfData.WriteString(volumeInst)
@@ -338,6 +417,16 @@ func GenerateFromInfo(location string,
 		dfData.WriteString("COPY files /\n")
 	}
 
+	for _, layerDir := range layerDirs {
+		//the separate minified image layers (the base layer is the 'files' directory)
+		dfData.WriteString(fmt.Sprintf("COPY %s /\n", layerDir))
+	}
+
+	if appDataOwner != "" {
+		//the application files owned by the image user
+		dfData.WriteString(fmt.Sprintf("COPY --chown=%s files-app /\n", appDataOwner))
+	}
+
 	if workingDir != "" {
 		dfData.WriteString("WORKDIR ")
 		dfData.WriteString(workingDir)
@@ -362,41 +451,76 @@ func GenerateFromInfo(location string,
 	}
 
 	if len(exposedPorts) > 0 {
+		//the ports are sorted, so the same image info always generates the same Dockerfile
+		portList := make([]string, 0, len(exposedPorts))
 		for portInfo := range exposedPorts {
+			portList = append(portList, string(portInfo))
+		}
+		sort.Strings(portList)
+
+		for _, portInfo := range portList {
 			dfData.WriteString("EXPOSE ")
-			dfData.WriteString(string(portInfo))
+			dfData.WriteString(portInfo)
 			dfData.WriteByte('\n')
 		}
 	}
 
-	if len(entrypoint) > 0 {
-		//TODO: need to make sure the generated ENTRYPOINT is compatible with the original behavior
-		var quotedEntryPoint []string
-		for idx := range entrypoint {
-			quotedEntryPoint = append(quotedEntryPoint, strconv.Quote(entrypoint[idx]))
-		}
+	if stopSignal != "" {
+		dfData.WriteString("STOPSIGNAL ")
+		dfData.WriteString(stopSignal)
+		dfData.WriteByte('\n')
+	}
+
+	if len(shell) > 0 {
+		dfData.WriteString("SHELL ")
+		dfData.WriteString(execForm(shell))
+		dfData.WriteByte('\n')
+	}
 
-		dfData.WriteString("ENTRYPOINT [")
-		dfData.WriteString(strings.Join(quotedEntryPoint, ","))
-		dfData.WriteByte(']')
+	for _, trigger := range onBuild {
+		//the triggers run when the minified image is used as a base image
+		dfData.WriteString("ONBUILD ")
+		dfData.WriteString(trigger)
+		dfData.WriteByte('\n')
+	}
+
+	if len(entrypoint) == 0 && baseImage != "" {
+		//the base image entrypoint would run the original command as its arguments
+		dfData.WriteString("ENTRYPOINT []\n")
+	}
+
+	//the shell form commands are already wrapped with the shell (e.g., '["/bin/sh","-c","<command>"]'),
+	//so ENTRYPOINT and CMD are always generated in the exec form (the image config gets the same values)
+	if len(entrypoint) > 0 {
+		dfData.WriteString("ENTRYPOINT ")
+		dfData.WriteString(execForm(entrypoint))
 		dfData.WriteByte('\n')
 	}
 
 	if len(cmd) > 0 {
-		//TODO: need to make sure the generated CMD is compatible with the original behavior
-		var quotedCmd []string
-		for idx := range cmd {
-			quotedCmd = append(quotedCmd, strconv.Quote(cmd[idx]))
-		}
-		dfData.WriteString("CMD [")
-		dfData.WriteString(strings.Join(quotedCmd, ","))
-		dfData.WriteByte(']')
+		dfData.WriteString("CMD ")
+		dfData.WriteString(execForm(cmd))
 		dfData.WriteByte('\n')
 	}
 
 	return ioutil.WriteFile(dockerfileLocation, dfData.Bytes(), 0644)
 }
 
+// execForm returns the JSON array for the exec form instructions
+// (Docker runs the instructions with the invalid JSON arrays in the shell form,
+// so the values are JSON encoded instead of Go quoted: the Go escapes like '\x00' are not valid JSON)
+func execForm(values []string) string {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(values); err != nil {
+		//the string slices are always encoded
+		return "[]"
+	}
+
+	return strings.TrimSpace(data.String())
+}
+
 //
 // https://docs.docker.com/engine/reference/builder/
 //
@@ -4,12 +4,18 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 )
 
 const (
 	localHostIP = "127.0.0.1"
 )
 
+var windowsDrivePat = regexp.MustCompile(`^([a-zA-Z]):(?:[\\/]|$)`)
+
 // GetIP returns the Docker host IP address
 func GetIP() string {
 	dockerHost := os.Getenv("DOCKER_HOST")
@@ -23,8 +29,10 @@ func GetIP() string {
 	}
 
 	switch u.Scheme {
-	case "unix":
+	case "unix", "npipe":
 		return localHostIP
+	case "ssh":
+		return u.Hostname()
 	default:
 		host, _, err := net.SplitHostPort(u.Host)
 		if err != nil {
@@ -34,3 +42,42 @@ func GetIP() string {
 		return host
 	}
 }
+
+// IsSSH returns true if the Docker host is accessed over ssh
+// (the Docker host doesn't share the filesystem with the local host)
+func IsSSH() bool {
+	return strings.HasPrefix(os.Getenv("DOCKER_HOST"), "ssh://")
+}
+
+// IsLocal returns true if the Docker daemon runs on the local Linux host
+// (it shares the kernel with the local host, so the kernel audit records are local too)
+func IsLocal() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+
+	dockerHost := os.Getenv("DOCKER_HOST")
+	return dockerHost == "" || strings.HasPrefix(dockerHost, "unix://")
+}
+
+// IsWindowsPath returns true if the path starts with a Windows drive letter (e.g., 'C:\data' or 'c:/data')
+func IsWindowsPath(hostPath string) bool {
+	return windowsDrivePat.MatchString(hostPath)
+}
+
+// MountSource translates a Windows host path to the path format Docker Desktop (and Docker Toolbox)
+// expects in the volume binds for Linux containers (e.g., 'C:\Users\me\data' -> '/c/Users/me/data').
+// The other paths are returned as-is.
+func MountSource(hostPath string) string {
+	if runtime.GOOS != "windows" || !IsWindowsPath(hostPath) {
+		return hostPath
+	}
+
+	drive := strings.ToLower(hostPath[:1])
+	rest := filepath.ToSlash(hostPath[2:])
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+
+	return "/" + drive + strings.TrimSuffix(rest, "/")
+}
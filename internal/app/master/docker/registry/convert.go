@@ -0,0 +1,371 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/klauspost/compress/zstd"
+)
+
+//NOTES:
+//* the standard library has only the gzip (and flate) compression, there's no zstd encoder or decoder there,
+//  so the zstd layers use the vendored github.com/klauspost/compress/zstd package
+//  (only the zstd package and the packages it imports are vendored)
+
+// Layer compression formats for the pushed images
+const (
+	LayerCompressionGzip = "gzip"
+	LayerCompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// archiveManifest is the 'manifest.json' record in the 'docker save' image archives
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ociAnnotationPrefix is the prefix of the pre-defined OCI annotation keys
+// (the image config labels with this prefix are also added to the manifest annotations)
+const ociAnnotationPrefix = "org.opencontainers.image."
+
+// IsConvertedPush returns true if the pushed image layers need to be converted
+// (the Docker daemon pushes only the regular gzip layers and it doesn't add the manifest annotations)
+func IsConvertedPush(access *config.RegistryAccess) bool {
+	return access.LayerCompression == LayerCompressionZstd || access.EStargz || len(access.Annotations) > 0
+}
+
+// LayerFormat returns the layer format of the pushed images ('gzip', 'zstd' or 'estargz')
+func LayerFormat(access *config.RegistryAccess) string {
+	switch {
+	case access.EStargz:
+		return "estargz"
+	case access.LayerCompression == LayerCompressionZstd:
+		return LayerCompressionZstd
+	default:
+		return LayerCompressionGzip
+	}
+}
+
+// pushConverted exports the image from the Docker daemon, converts its layers
+// (gzip, zstd or eStargz) and pushes the converted image directly to the registry
+func pushConverted(client dockerclient.API, imageRef string, access *config.RegistryAccess, output io.Writer) error {
+	workDir, err := ioutil.TempDir("", "docker-slim-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	archiveDir := filepath.Join(workDir, "image")
+	manifest, err := saveImage(client, imageRef, archiveDir)
+	if err != nil {
+		return err
+	}
+
+	configData, err := ioutil.ReadFile(filepath.Join(archiveDir, filepath.FromSlash(manifest.Config)))
+	if err != nil {
+		return err
+	}
+
+	var layers []LayerBlob
+	var diffIDs []string
+	for idx, layerPath := range manifest.Layers {
+		blobPath := filepath.Join(workDir, fmt.Sprintf("layer-%d", idx))
+		layer, diffID, err := convertLayer(filepath.Join(archiveDir, filepath.FromSlash(layerPath)), blobPath, access)
+		if err != nil {
+			return fmt.Errorf("layer %s conversion failed: %v", layerPath, err)
+		}
+
+		fmt.Fprintf(output, "%s: converted layer %d/%d (%s, %d bytes)\n",
+			layer.Digest, idx+1, len(manifest.Layers), layer.MediaType, layer.Size)
+		layers = append(layers, *layer)
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	//the eStargz layers have more tar entries (the TOC and the landmark),
+	//so the image config gets the new layer diff IDs
+	configData, err = setDiffIDs(configData, diffIDs)
+	if err != nil {
+		return err
+	}
+
+	annotations, err := manifestAnnotations(configData, access.Annotations)
+	if err != nil {
+		return err
+	}
+
+	remote := NewRemoteClient(access)
+	digest, err := remote.PushImage(imageRef, configData, layers, annotations)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "%s: digest: %s\n", imageRef, digest)
+	return nil
+}
+
+// saveImage exports the image archive from the Docker daemon and extracts it
+func saveImage(client dockerclient.API, imageRef, archiveDir string) (*archiveManifest, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(client.ExportImage(docker.ExportImageOptions{
+			Name:         imageRef,
+			OutputStream: writer,
+		}))
+	}()
+
+	err := extractArchive(reader, archiveDir)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	manifestData, err := ioutil.ReadFile(filepath.Join(archiveDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []archiveManifest
+	if err := json.Unmarshal(manifestData, &manifests); err != nil {
+		return nil, fmt.Errorf("invalid image archive manifest: %v", err)
+	}
+
+	if len(manifests) != 1 {
+		return nil, fmt.Errorf("unexpected number of images in the image archive: %d", len(manifests))
+	}
+
+	return &manifests[0], nil
+}
+
+func extractArchive(in io.Reader, dir string) error {
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid image archive entry: %s", hdr.Name)
+		}
+
+		fullPath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fullPath, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(fullPath, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			//the same layers are linked in the legacy archive format
+			target := filepath.Join(filepath.Dir(name), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || strings.HasPrefix(target, "..") {
+				return fmt.Errorf("invalid image archive link: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+
+			if err := os.Symlink(hdr.Linkname, fullPath); err != nil {
+				return err
+			}
+		default:
+			log.Debugf("registry.extractArchive: skipping %s (type: %v)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func writeArchiveFile(fullPath string, data io.Reader) error {
+	file, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// openLayer returns the uncompressed layer tar reader
+// (the daemons with the containerd image store export the compressed layers)
+func openLayer(layerFile io.Reader) (io.Reader, func(), error) {
+	in := bufio.NewReader(layerFile)
+	magic, _ := in.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzReader, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return gzReader, func() { gzReader.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdReader, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return zstdReader, zstdReader.Close, nil
+	default:
+		return in, func() {}, nil
+	}
+}
+
+// convertLayer compresses the layer (gzip, zstd or eStargz) and returns its descriptor and diff ID
+func convertLayer(layerPath, blobPath string, access *config.RegistryAccess) (*LayerBlob, string, error) {
+	layerFile, err := os.Open(layerPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer layerFile.Close()
+
+	return convertLayerData(layerFile, blobPath, access)
+}
+
+// convertLayerData compresses the layer data stream (the layer data is read once)
+func convertLayerData(layerData io.Reader, blobPath string, access *config.RegistryAccess) (*LayerBlob, string, error) {
+	in, closeLayer, err := openLayer(layerData)
+	if err != nil {
+		return nil, "", err
+	}
+	defer closeLayer()
+
+	blobFile, err := os.Create(blobPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer blobFile.Close()
+
+	blobHash := sha256.New()
+	blobOut := &countWriter{w: io.MultiWriter(blobFile, blobHash)}
+	layer := &LayerBlob{Path: blobPath}
+
+	var diffID string
+	if access.EStargz {
+		var uncompressedSize int64
+		var tocDigest string
+		diffID, uncompressedSize, tocDigest, err = convertToEStargz(in, blobOut)
+		if err != nil {
+			return nil, "", err
+		}
+
+		layer.MediaType = MediaTypeOCILayerGzip
+		layer.Annotations = map[string]string{
+			AnnotationEStargzTOCDigest:        tocDigest,
+			AnnotationEStargzUncompressedSize: strconv.FormatInt(uncompressedSize, 10),
+		}
+	} else {
+		var compressor io.WriteCloser
+		if access.LayerCompression == LayerCompressionZstd {
+			compressor, err = zstd.NewWriter(blobOut)
+			if err != nil {
+				return nil, "", err
+			}
+
+			layer.MediaType = MediaTypeOCILayerZstd
+		} else {
+			compressor = gzip.NewWriter(blobOut)
+			layer.MediaType = MediaTypeOCILayerGzip
+		}
+
+		diffHash := sha256.New()
+		if _, err := io.Copy(compressor, io.TeeReader(in, diffHash)); err != nil {
+			compressor.Close()
+			return nil, "", err
+		}
+
+		if err := compressor.Close(); err != nil {
+			return nil, "", err
+		}
+
+		diffID = "sha256:" + hex.EncodeToString(diffHash.Sum(nil))
+	}
+
+	layer.Digest = "sha256:" + hex.EncodeToString(blobHash.Sum(nil))
+	layer.Size = blobOut.n
+	return layer, diffID, nil
+}
+
+// setDiffIDs updates the layer diff IDs in the image config (the other config fields are not changed)
+func setDiffIDs(configData []byte, diffIDs []string) ([]byte, error) {
+	var imageConfig map[string]json.RawMessage
+	if err := json.Unmarshal(configData, &imageConfig); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	rootFS, err := json.Marshal(map[string]interface{}{
+		"type":     "layers",
+		"diff_ids": diffIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	imageConfig["rootfs"] = rootFS
+	return json.Marshal(imageConfig)
+}
+
+// manifestAnnotations returns the image manifest annotations: the OCI image labels from the image config
+// and the new annotations (the new annotations override the labels with the same keys)
+func manifestAnnotations(configData []byte, newAnnotations map[string]string) (map[string]string, error) {
+	var imageConfig struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+
+	if err := json.Unmarshal(configData, &imageConfig); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	annotations := map[string]string{}
+	for k, v := range imageConfig.Config.Labels {
+		if strings.HasPrefix(k, ociAnnotationPrefix) {
+			annotations[k] = v
+		}
+	}
+
+	for k, v := range newAnnotations {
+		annotations[k] = v
+	}
+
+	if len(annotations) == 0 {
+		return nil, nil
+	}
+
+	return annotations, nil
+}
@@ -0,0 +1,343 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+//NOTES:
+//* eStargz (https://github.com/containerd/stargz-snapshotter/blob/main/docs/estargz.md) is a gzip layer
+//  where every tar entry (and every chunk of the large files) is compressed as a separate gzip stream,
+//  so the lazy pulling snapshotters can fetch the files from the registry without pulling the whole layer
+//* the TOC ('stargz.index.json') lists the entries with their compressed offsets
+//  and the footer (an empty gzip stream) has the TOC offset in its 'extra' header field
+//* the layer is still a regular gzip tar layer for the runtimes without the lazy pulling support
+
+// eStargz layer annotations
+const (
+	AnnotationEStargzTOCDigest        = "containerd.io/snapshot/stargz/toc.digest"
+	AnnotationEStargzUncompressedSize = "io.containers.estargz.uncompressed-size"
+)
+
+const (
+	estargzTOCName          = "stargz.index.json"
+	estargzNoPrefetchName   = ".no.prefetch.landmark"
+	estargzLandmarkContents = 0xf
+	estargzChunkSize        = 4 << 20
+	estargzFooterSize       = 51
+	paxXattrPrefix          = "SCHILY.xattr."
+)
+
+type estargzTOC struct {
+	Version int             `json:"version"`
+	Entries []*estargzEntry `json:"entries"`
+}
+
+type estargzEntry struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Size        int64             `json:"size,omitempty"`
+	ModTime     string            `json:"modtime,omitempty"`
+	LinkName    string            `json:"linkName,omitempty"`
+	Mode        int64             `json:"mode,omitempty"`
+	UID         int               `json:"uid,omitempty"`
+	GID         int               `json:"gid,omitempty"`
+	Uname       string            `json:"userName,omitempty"`
+	Gname       string            `json:"groupName,omitempty"`
+	Offset      int64             `json:"offset,omitempty"`
+	DevMajor    int               `json:"devMajor,omitempty"`
+	DevMinor    int               `json:"devMinor,omitempty"`
+	Xattrs      map[string][]byte `json:"xattrs,omitempty"`
+	Digest      string            `json:"digest,omitempty"`
+	ChunkOffset int64             `json:"chunkOffset,omitempty"`
+	ChunkSize   int64             `json:"chunkSize,omitempty"`
+	ChunkDigest string            `json:"chunkDigest,omitempty"`
+}
+
+// countWriter counts the bytes written to the underlying writer
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// estargzWriter converts a tar layer to an eStargz layer
+type estargzWriter struct {
+	out  *countWriter
+	diff hash.Hash
+	//uncompressed size
+	size int64
+	gz   *gzip.Writer
+	toc  estargzTOC
+}
+
+// Write writes the uncompressed data to the current gzip stream
+// (a new stream is started if the previous one is closed)
+func (w *estargzWriter) Write(p []byte) (int, error) {
+	if w.gz == nil {
+		gz, err := gzip.NewWriterLevel(w.out, gzip.BestCompression)
+		if err != nil {
+			return 0, err
+		}
+
+		w.gz = gz
+	}
+
+	n, err := w.gz.Write(p)
+	w.diff.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *estargzWriter) closeGz() error {
+	if w.gz == nil {
+		return nil
+	}
+
+	err := w.gz.Close()
+	w.gz = nil
+	return err
+}
+
+// convertToEStargz writes the eStargz version of the tar layer
+// and returns the layer diff ID, the uncompressed layer size and the TOC digest
+func convertToEStargz(in io.Reader, out io.Writer) (string, int64, string, error) {
+	w := &estargzWriter{
+		out:  &countWriter{w: out},
+		diff: sha256.New(),
+		toc: estargzTOC{
+			Version: 1,
+		},
+	}
+
+	tw := tar.NewWriter(w)
+
+	//the layer doesn't have the prioritized files (the landmark disables the prefetch)
+	landmark := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     estargzNoPrefetchName,
+		Mode:     0644,
+		Size:     1,
+	}
+
+	if err := w.appendEntry(tw, landmark, bytes.NewReader([]byte{estargzLandmarkContents})); err != nil {
+		return "", 0, "", err
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", 0, "", err
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		if err := w.appendEntry(tw, hdr, tr); err != nil {
+			return "", 0, "", err
+		}
+	}
+
+	tocDigest, err := w.writeTOC()
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(w.diff.Sum(nil)), w.size, tocDigest, nil
+}
+
+func (w *estargzWriter) appendEntry(tw *tar.Writer, hdr *tar.Header, data io.Reader) error {
+	entry := &estargzEntry{
+		Name:  hdr.Name,
+		Mode:  hdr.Mode,
+		UID:   hdr.Uid,
+		GID:   hdr.Gid,
+		Uname: hdr.Uname,
+		Gname: hdr.Gname,
+	}
+
+	if !hdr.ModTime.IsZero() {
+		entry.ModTime = hdr.ModTime.UTC().Format(time.RFC3339)
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if strings.HasPrefix(key, paxXattrPrefix) {
+			if entry.Xattrs == nil {
+				entry.Xattrs = map[string][]byte{}
+			}
+
+			entry.Xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = []byte(value)
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeLink:
+		entry.Type = "hardlink"
+		entry.LinkName = hdr.Linkname
+	case tar.TypeSymlink:
+		entry.Type = "symlink"
+		entry.LinkName = hdr.Linkname
+	case tar.TypeDir:
+		entry.Type = "dir"
+	case tar.TypeReg:
+		entry.Type = "reg"
+		entry.Size = hdr.Size
+	case tar.TypeChar:
+		entry.Type = "char"
+		entry.DevMajor = int(hdr.Devmajor)
+		entry.DevMinor = int(hdr.Devminor)
+	case tar.TypeBlock:
+		entry.Type = "block"
+		entry.DevMajor = int(hdr.Devmajor)
+		entry.DevMinor = int(hdr.Devminor)
+	case tar.TypeFifo:
+		entry.Type = "fifo"
+	default:
+		return fmt.Errorf("unsupported layer tar entry type (%v): %s", hdr.Typeflag, hdr.Name)
+	}
+
+	//the headers without the file data are grouped in the same gzip stream
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if entry.Type != "reg" {
+		w.toc.Entries = append(w.toc.Entries, entry)
+		return tw.Flush()
+	}
+
+	fileEntry := entry
+	fileDigest := sha256.New()
+	data = io.TeeReader(data, fileDigest)
+
+	//each chunk starts a new gzip stream (the chunk offset is the stream offset)
+	var written int64
+	for written < hdr.Size {
+		if err := w.closeGz(); err != nil {
+			return err
+		}
+
+		chunkSize := int64(estargzChunkSize)
+		if remaining := hdr.Size - written; remaining < chunkSize {
+			chunkSize = remaining
+		} else {
+			entry.ChunkSize = chunkSize
+		}
+
+		entry.Offset = w.out.n
+		entry.ChunkOffset = written
+
+		chunkDigest := sha256.New()
+		if _, err := io.CopyN(tw, io.TeeReader(data, chunkDigest), chunkSize); err != nil {
+			return err
+		}
+
+		entry.ChunkDigest = "sha256:" + hex.EncodeToString(chunkDigest.Sum(nil))
+		w.toc.Entries = append(w.toc.Entries, entry)
+		written += chunkSize
+
+		entry = &estargzEntry{
+			Name: hdr.Name,
+			Type: "chunk",
+		}
+	}
+
+	if hdr.Size == 0 {
+		w.toc.Entries = append(w.toc.Entries, entry)
+	}
+
+	fileEntry.Digest = "sha256:" + hex.EncodeToString(fileDigest.Sum(nil))
+	return tw.Flush()
+}
+
+// writeTOC writes the TOC entry (in its own gzip stream) and the footer
+func (w *estargzWriter) writeTOC() (string, error) {
+	if err := w.closeGz(); err != nil {
+		return "", err
+	}
+
+	tocData, err := json.MarshalIndent(&w.toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+
+	tocOffset := w.out.n
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     estargzTOCName,
+		Size:     int64(len(tocData)),
+	}); err != nil {
+		return "", err
+	}
+
+	if _, err := tw.Write(tocData); err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := w.closeGz(); err != nil {
+		return "", err
+	}
+
+	footer, err := estargzFooter(tocOffset)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := w.out.Write(footer); err != nil {
+		return "", err
+	}
+
+	return sha256Digest(tocData), nil
+}
+
+// estargzFooter creates the footer: an empty gzip stream with the TOC offset
+// in the 'SG' extra header subfield (https://tools.ietf.org/html/rfc1952#section-2.3.1.1).
+// The footer bytes are created directly, so they don't depend on the deflate implementation
+// (the empty stream is a final stored block).
+func estargzFooter(tocOffset int64) ([]byte, error) {
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOffset)
+
+	var buf bytes.Buffer
+	//ID1, ID2, CM (deflate), FLG (FEXTRA), MTIME (4 bytes), XFL, OS (unknown)
+	buf.Write([]byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff})
+	binary.Write(&buf, binary.LittleEndian, uint16(4+len(subfield)))
+	buf.Write([]byte{'S', 'G'})
+	binary.Write(&buf, binary.LittleEndian, uint16(len(subfield)))
+	buf.WriteString(subfield)
+	//empty final stored block
+	buf.Write([]byte{1, 0, 0, 0xff, 0xff})
+	//CRC32 and ISIZE (empty data)
+	buf.Write(make([]byte, 8))
+
+	if buf.Len() != estargzFooterSize {
+		return nil, fmt.Errorf("unexpected eStargz footer size: %d", buf.Len())
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// UpdateImageConfig exports the image from the Docker daemon, changes its image config
+// with the update function and loads the image archive with the new config back (with the same tags).
+// The image layers are not changed. It returns the updated image ID.
+func UpdateImageConfig(client dockerclient.API,
+	imageRef string,
+	update func(imageConfig map[string]json.RawMessage) error) (string, error) {
+	workDir, err := ioutil.TempDir("", "docker-slim-image-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	manifest, err := saveImage(client, imageRef, workDir)
+	if err != nil {
+		return "", err
+	}
+
+	configData, err := ioutil.ReadFile(filepath.Join(workDir, filepath.FromSlash(manifest.Config)))
+	if err != nil {
+		return "", err
+	}
+
+	var imageConfig map[string]json.RawMessage
+	if err := json.Unmarshal(configData, &imageConfig); err != nil {
+		return "", fmt.Errorf("invalid image config: %v", err)
+	}
+
+	if err := update(imageConfig); err != nil {
+		return "", err
+	}
+
+	if configData, err = json.Marshal(imageConfig); err != nil {
+		return "", err
+	}
+
+	configDigest := sha256.Sum256(configData)
+	manifest.Config = hex.EncodeToString(configDigest[:]) + ".json"
+	if err := ioutil.WriteFile(filepath.Join(workDir, manifest.Config), configData, 0644); err != nil {
+		return "", err
+	}
+
+	manifestData, err := json.Marshal([]archiveManifest{*manifest})
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(workDir, "manifest.json"), manifestData, 0644); err != nil {
+		return "", err
+	}
+
+	//the OCI index in the newer image archives references the old image config,
+	//so the image is loaded with the 'manifest.json' records
+	for _, name := range []string{"index.json", "oci-layout"} {
+		if err := os.Remove(filepath.Join(workDir, name)); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeArchive(writer, workDir))
+	}()
+
+	err = client.LoadImage(docker.LoadImageOptions{InputStream: reader})
+	reader.Close()
+	if err != nil {
+		return "", err
+	}
+
+	imageInfo, err := client.InspectImage(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	return imageInfo.ID, nil
+}
+
+// writeArchive writes the extracted image archive directory as a tar archive
+func writeArchive(out io.Writer, dir string) error {
+	tw := tar.NewWriter(out)
+	err := filepath.Walk(dir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(fullPath, dir), string(filepath.Separator))
+		if name == "" {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fullPath); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,339 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+// OCI image layout files
+const (
+	ociLayoutFileName = "oci-layout"
+	ociIndexFileName  = "index.json"
+	ociBlobsDirName   = "blobs"
+	ociLayoutVersion  = "1.0.0"
+	ociRefNameKey     = "org.opencontainers.image.ref.name"
+)
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+type ociIndexManifest struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Manifests     []ociIndexManifest `json:"manifests"`
+}
+
+// SaveLayout saves the image in the OCI image layout format
+// (the layers are downloaded only if withLayers is true)
+func (c *RemoteClient) SaveLayout(image *RemoteImage, layoutPath string, withLayers bool) error {
+	if err := initLayout(layoutPath); err != nil {
+		return err
+	}
+
+	if err := writeBlob(layoutPath, image.ManifestDigest, image.ManifestData); err != nil {
+		return err
+	}
+
+	if err := writeBlob(layoutPath, image.Manifest.Config.Digest, image.ConfigData); err != nil {
+		return err
+	}
+
+	if withLayers {
+		endpoint := c.endpoint(image.source.Registry, image.insecure)
+		for _, layer := range image.Manifest.Layers {
+			if err := c.saveLayer(endpoint, image, layer, layoutPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		Manifests: []ociIndexManifest{
+			{
+				MediaType:   image.Manifest.MediaType,
+				Digest:      image.ManifestDigest,
+				Size:        int64(len(image.ManifestData)),
+				Annotations: map[string]string{ociRefNameKey: image.Ref.suffix()[1:]},
+			},
+		},
+	}
+
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(layoutPath, ociIndexFileName), indexData, 0644)
+}
+
+// AddLayoutLayer compresses the layer tar stream (gzip, zstd or eStargz, like the pushed image layers)
+// into the OCI image layout blobs and returns the layer blob and its diff ID
+func AddLayoutLayer(layoutPath string, layerData io.Reader, access *config.RegistryAccess) (*LayerBlob, string, error) {
+	blobDir := filepath.Join(layoutPath, ociBlobsDirName, "sha256")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		return nil, "", err
+	}
+
+	tmpFile, err := ioutil.TempFile(blobDir, ".layer.")
+	if err != nil {
+		return nil, "", err
+	}
+	tmpFile.Close()
+
+	layer, diffID, err := convertLayerData(layerData, tmpFile.Name(), access)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return nil, "", err
+	}
+
+	layer.Path, err = blobPath(layoutPath, layer.Digest)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return nil, "", err
+	}
+
+	if err := os.Rename(tmpFile.Name(), layer.Path); err != nil {
+		os.Remove(tmpFile.Name())
+		return nil, "", err
+	}
+
+	return layer, diffID, nil
+}
+
+// WriteLayout adds the image (the image config and the layer blobs added with AddLayoutLayer)
+// to the OCI image layout and returns the image manifest digest.
+// The manifest gets the OCI image labels and the new annotations (like the converted pushed images).
+// The layout index references the image by its tag (the images with the other tags are kept).
+func WriteLayout(layoutPath, imageRef string, configData []byte, layers []LayerBlob, newAnnotations map[string]string) (string, error) {
+	ref := ParseReference(imageRef)
+	if ref.Digest != "" {
+		return "", fmt.Errorf("cannot save an image by digest: %s", imageRef)
+	}
+
+	if err := initLayout(layoutPath); err != nil {
+		return "", err
+	}
+
+	annotations, err := manifestAnnotations(configData, newAnnotations)
+	if err != nil {
+		return "", err
+	}
+
+	manifestData, err := json.Marshal(newImageManifest(configData, layers, annotations))
+	if err != nil {
+		return "", err
+	}
+
+	manifestDigest := sha256Digest(manifestData)
+	if err := writeBlob(layoutPath, sha256Digest(configData), configData); err != nil {
+		return "", err
+	}
+
+	if err := writeBlob(layoutPath, manifestDigest, manifestData); err != nil {
+		return "", err
+	}
+
+	index, err := readLayoutIndex(layoutPath)
+	if err != nil {
+		return "", err
+	}
+
+	var manifests []ociIndexManifest
+	for _, info := range index.Manifests {
+		if info.Annotations[ociRefNameKey] != ref.Tag {
+			manifests = append(manifests, info)
+		}
+	}
+
+	index.Manifests = append(manifests, ociIndexManifest{
+		MediaType:   MediaTypeOCIManifest,
+		Digest:      manifestDigest,
+		Size:        int64(len(manifestData)),
+		Annotations: map[string]string{ociRefNameKey: ref.Tag},
+	})
+
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(layoutPath, ociIndexFileName), indexData, 0644); err != nil {
+		return "", err
+	}
+
+	return manifestDigest, nil
+}
+
+// PushLayout pushes the image with the same tag from the OCI image layout directly to the registry
+func PushLayout(layoutPath, imageRef string, access *config.RegistryAccess, output io.Writer) error {
+	ref := ParseReference(imageRef)
+	index, err := readLayoutIndex(layoutPath)
+	if err != nil {
+		return err
+	}
+
+	var manifestDigest string
+	for _, info := range index.Manifests {
+		if info.Annotations[ociRefNameKey] == ref.Tag {
+			manifestDigest = info.Digest
+		}
+	}
+
+	if manifestDigest == "" {
+		return fmt.Errorf("no image with the '%s' tag in the OCI image layout: %s", ref.Tag, layoutPath)
+	}
+
+	manifestData, err := readBlob(layoutPath, manifestDigest)
+	if err != nil {
+		return err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return fmt.Errorf("invalid image manifest: %v", err)
+	}
+
+	configData, err := readBlob(layoutPath, manifest.Config.Digest)
+	if err != nil {
+		return err
+	}
+
+	var layers []LayerBlob
+	for _, layer := range manifest.Layers {
+		layerPath, err := blobPath(layoutPath, layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		layers = append(layers, LayerBlob{Descriptor: layer, Path: layerPath})
+	}
+
+	digest, err := NewRemoteClient(access).PushImage(imageRef, configData, layers, manifest.Annotations)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "%s: digest: %s\n", imageRef, digest)
+	return nil
+}
+
+func initLayout(layoutPath string) error {
+	if err := os.MkdirAll(layoutPath, 0755); err != nil {
+		return err
+	}
+
+	layoutData, _ := json.Marshal(ociLayout{ImageLayoutVersion: ociLayoutVersion})
+	return ioutil.WriteFile(filepath.Join(layoutPath, ociLayoutFileName), layoutData, 0644)
+}
+
+// readLayoutIndex reads the OCI image layout index (a new layout has an empty index)
+func readLayoutIndex(layoutPath string) (*ociIndex, error) {
+	index := &ociIndex{SchemaVersion: 2}
+	indexData, err := ioutil.ReadFile(filepath.Join(layoutPath, ociIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(indexData, index); err != nil {
+		return nil, fmt.Errorf("invalid OCI image layout index: %v", err)
+	}
+
+	return index, nil
+}
+
+func (c *RemoteClient) saveLayer(endpoint string, image *RemoteImage, layer Descriptor, layoutPath string) error {
+	blobPath, err := blobPath(layoutPath, layer.Digest)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(blobPath); err == nil && info.Size() == layer.Size {
+		return nil
+	}
+
+	//the layers can be large (no timeout for the whole download)
+	reader, err := c.openBlob(endpoint, image.source, layer, image.insecure, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmpPath := blobPath + ".tmp"
+	blobFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(blobFile, hasher), reader)
+	blobFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if "sha256:"+hex.EncodeToString(hasher.Sum(nil)) != layer.Digest {
+		os.Remove(tmpPath)
+		return fmt.Errorf("layer digest mismatch: %s", layer.Digest)
+	}
+
+	return os.Rename(tmpPath, blobPath)
+}
+
+func writeBlob(layoutPath, digest string, data []byte) error {
+	blobPath, err := blobPath(layoutPath, digest)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(blobPath, data, 0644)
+}
+
+func readBlob(layoutPath, digest string) ([]byte, error) {
+	blobPath, err := blobPath(layoutPath, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(blobPath)
+}
+
+func blobPath(layoutPath, digest string) (string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] != "sha256" || strings.ContainsAny(parts[1], `/\.`) {
+		return "", fmt.Errorf("unsupported blob digest: %s", digest)
+	}
+
+	blobDir := filepath.Join(layoutPath, ociBlobsDirName, parts[0])
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(blobDir, parts[1]), nil
+}
+
+func sha256Digest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the layer uploads can take much longer than the other registry requests
+const blobUploadTimeout = 30 * time.Minute
+
+// LayerBlob is an image layer blob file for the direct image push
+type LayerBlob struct {
+	Descriptor
+	Path string
+}
+
+// PushImage pushes the image layers, the image config and the OCI image manifest
+// (with the manifest annotations) directly to the registry and returns the manifest digest
+// (the blobs the registry already has are not uploaded again)
+func (c *RemoteClient) PushImage(imageRef string, configData []byte, layers []LayerBlob, annotations map[string]string) (string, error) {
+	ref := ParseReference(imageRef)
+	if ref.Digest != "" {
+		return "", fmt.Errorf("cannot push an image by digest: %s", imageRef)
+	}
+
+	insecure := IsInsecure(ref.Registry, c.access)
+	endpoint := c.endpoint(ref.Registry, insecure)
+	client := c.httpClient(insecure, blobUploadTimeout)
+
+	manifest := newImageManifest(configData, layers, annotations)
+	for _, layer := range layers {
+		layerFile, err := os.Open(layer.Path)
+		if err != nil {
+			return "", err
+		}
+
+		err = c.pushBlob(client, endpoint, ref, layer.Digest, layerFile)
+		layerFile.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.pushBlob(client, endpoint, ref, manifest.Config.Digest, bytes.NewReader(configData)); err != nil {
+		return "", err
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", endpoint, ref.Repository, ref.Tag)
+	header := http.Header{}
+	header.Set("Content-Type", MediaTypeOCIManifest)
+	resp, err := c.do(client, "PUT", manifestURL, ref.Registry, pushScope(ref), header, bytes.NewReader(manifestData))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("image manifest push failed (%s): %s", resp.Status, manifestURL)
+	}
+
+	return sha256Digest(manifestData), nil
+}
+
+// newImageManifest creates the OCI image manifest for the image config and the layer blobs
+func newImageManifest(configData []byte, layers []LayerBlob, annotations map[string]string) *Manifest {
+	manifest := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config: Descriptor{
+			MediaType: MediaTypeOCIConfig,
+			Digest:    sha256Digest(configData),
+			Size:      int64(len(configData)),
+		},
+		Annotations: annotations,
+	}
+
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, layer.Descriptor)
+	}
+
+	return manifest
+}
+
+func pushScope(ref Reference) string {
+	return fmt.Sprintf("repository:%s:pull,push", ref.Repository)
+}
+
+// pushBlob uploads the blob (in a single request) if the registry doesn't have it
+func (c *RemoteClient) pushBlob(client *http.Client, endpoint string, ref Reference, digest string, data io.ReadSeeker) error {
+	scope := pushScope(ref)
+	blobURL := fmt.Sprintf("%s/v2/%s/blobs/%s", endpoint, ref.Repository, digest)
+	resp, err := c.do(client, "HEAD", blobURL, ref.Registry, scope, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		log.Debugf("registry.pushBlob: blob exists - %s", digest)
+		return nil
+	}
+
+	uploadsURL := fmt.Sprintf("%s/v2/%s/blobs/uploads/", endpoint, ref.Repository)
+	resp, err = c.do(client, "POST", uploadsURL, ref.Registry, scope, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("blob upload failed (%s): %s", resp.Status, uploadsURL)
+	}
+
+	//the upload location can be relative and it can have its own query parameters
+	baseURL, err := url.Parse(uploadsURL)
+	if err != nil {
+		return err
+	}
+
+	uploadURL, err := baseURL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid blob upload location: %v", err)
+	}
+
+	query := uploadURL.Query()
+	query.Set("digest", digest)
+	uploadURL.RawQuery = query.Encode()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err = c.do(client, "PUT", uploadURL.String(), ref.Registry, scope, header, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("blob upload failed (%s): %s", resp.Status, digest)
+	}
+
+	return nil
+}
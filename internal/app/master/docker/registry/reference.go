@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Docker Hub reference defaults
+const (
+	DefaultRegistry  = "docker.io"
+	DefaultTag       = "latest"
+	officialRepoPath = "library/"
+	legacyRegistry   = "index.docker.io"
+)
+
+// the image IDs have the 'sha256:' prefix or the full ID length
+// (the short hex strings are valid repository names too, e.g., 'deadbeefcafe')
+var imageIDPattern = regexp.MustCompile(`^(sha256:[a-f0-9]{12,64}|[a-f0-9]{64})$`)
+
+// Reference is a parsed image reference
+type Reference struct {
+	//Registry is the registry host (with the port if it's not the default one)
+	Registry string
+	//Repository is the repository path in the registry (e.g., 'library/nginx' for 'nginx')
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// IsImageID returns true if the image reference is an image ID (it can't be pulled)
+func IsImageID(ref string) bool {
+	return imageIDPattern.MatchString(ref)
+}
+
+// ParseReference parses the image reference
+// (the references without a registry are Docker Hub references)
+func ParseReference(ref string) Reference {
+	var result Reference
+
+	name := ref
+	if idx := strings.Index(name, "@"); idx != -1 {
+		result.Digest = name[idx+1:]
+		name = name[:idx]
+	}
+
+	if idx := strings.LastIndex(name, ":"); idx != -1 && !strings.Contains(name[idx+1:], "/") {
+		result.Tag = name[idx+1:]
+		name = name[:idx]
+	}
+
+	if result.Tag == "" && result.Digest == "" {
+		result.Tag = DefaultTag
+	}
+
+	if idx := strings.Index(name, "/"); idx != -1 {
+		host := name[:idx]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			result.Registry = host
+			name = name[idx+1:]
+		}
+	}
+
+	if result.Registry == "" || result.Registry == legacyRegistry {
+		result.Registry = DefaultRegistry
+	}
+
+	if result.Registry == DefaultRegistry && !strings.Contains(name, "/") {
+		name = officialRepoPath + name
+	}
+
+	result.Repository = name
+	return result
+}
+
+// IsDockerHub returns true if the image is a Docker Hub image
+func (r Reference) IsDockerHub() bool {
+	return r.Registry == DefaultRegistry
+}
+
+// Name returns the image name (the registry host and the repository path)
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the full image reference
+func (r Reference) String() string {
+	return r.Name() + r.suffix()
+}
+
+// WithRegistry returns the image reference for the same repository in a different registry
+// (e.g., a registry mirror)
+func (r Reference) WithRegistry(registry string) Reference {
+	r.Registry = HostName(registry)
+	return r
+}
+
+func (r Reference) suffix() string {
+	if r.Digest != "" {
+		return "@" + r.Digest
+	}
+
+	return ":" + r.Tag
+}
+
+// HostName returns the registry host name from a registry address
+// (the registry addresses may include the URL scheme, e.g., 'http://mirror:5000/')
+func HostName(registry string) string {
+	host := registry
+	if idx := strings.Index(host, "://"); idx != -1 {
+		host = host[idx+3:]
+	}
+
+	return strings.TrimRight(host, "/")
+}
@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+	httpScheme       = "http://"
+)
+
+// Pull pulls the image from its registry (the Docker Hub images are pulled
+// through the configured registry mirrors first, falling back to Docker Hub)
+func Pull(client dockerclient.API, imageRef string, access *config.RegistryAccess, output io.Writer) error {
+	ref := ParseReference(imageRef)
+
+	//the digest references can't be retagged, so the mirrors are used only for the tag references
+	if ref.IsDockerHub() && ref.Digest == "" {
+		for _, mirror := range access.Mirrors {
+			mirrorRef := ref.WithRegistry(mirror)
+			if err := checkAccess(client, mirror, access); err != nil {
+				log.Warnf("registry.Pull: skipping registry mirror %s => %v", mirror, err)
+				continue
+			}
+
+			if err := pullImage(client, mirrorRef, output); err != nil {
+				log.Warnf("registry.Pull: error pulling %s from registry mirror => %v", mirrorRef, err)
+				continue
+			}
+
+			//the rest of the command uses the original image reference
+			return client.TagImage(mirrorRef.String(), docker.TagImageOptions{
+				Repo:  ref.Name(),
+				Tag:   ref.Tag,
+				Force: true,
+			})
+		}
+	}
+
+	if err := checkAccess(client, ref.Registry, access); err != nil {
+		return err
+	}
+
+	return pullImage(client, ref, output)
+}
+
+// Push pushes the image to its registry
+// (the images with the zstd or eStargz layers or the manifest annotations are pushed directly to the registry)
+func Push(client dockerclient.API, imageRef string, access *config.RegistryAccess, output io.Writer) error {
+	ref := ParseReference(imageRef)
+	if ref.Digest != "" {
+		return fmt.Errorf("cannot push an image by digest: %s", imageRef)
+	}
+
+	if IsConvertedPush(access) {
+		//the converted image is pushed by docker-slim, so the daemon registry access is not used
+		return pushConverted(client, imageRef, access, output)
+	}
+
+	if err := checkAccess(client, ref.Registry, access); err != nil {
+		return err
+	}
+
+	return client.PushImage(docker.PushImageOptions{
+		Name:         ref.Name(),
+		Tag:          ref.Tag,
+		OutputStream: output,
+	}, authConfig(ref.Registry))
+}
+
+func pullImage(client dockerclient.API, ref Reference, output io.Writer) error {
+	tag := ref.Tag
+	if ref.Digest != "" {
+		tag = ref.Digest
+	}
+
+	log.Debugf("registry.pullImage: %s", ref)
+	return client.PullImage(docker.PullImageOptions{
+		Repository:   ref.Name(),
+		Tag:          tag,
+		OutputStream: output,
+	}, authConfig(ref.Registry))
+}
+
+// IsInsecure returns true if the registry is configured as an insecure registry
+// (the registry mirrors with the 'http' URLs are insecure too)
+func IsInsecure(registry string, access *config.RegistryAccess) bool {
+	if strings.HasPrefix(registry, httpScheme) {
+		return true
+	}
+
+	host := HostName(registry)
+	for _, insecure := range access.InsecureRegistries {
+		if HostName(insecure) == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkAccess(client dockerclient.API, registry string, access *config.RegistryAccess) error {
+	if !IsInsecure(registry, access) {
+		return nil
+	}
+
+	return CheckInsecure(client, HostName(registry))
+}
+
+// CheckInsecure checks that the Docker daemon allows the plain HTTP
+// (or the unverified HTTPS) access to the registry
+// (the daemon pulls and pushes the images, so only the daemon configuration makes it possible)
+func CheckInsecure(client dockerclient.API, registry string) error {
+	info, err := client.Info()
+	if err != nil {
+		return err
+	}
+
+	if info.RegistryConfig == nil {
+		//the daemon doesn't report its registry configuration
+		return nil
+	}
+
+	if index, ok := info.RegistryConfig.IndexConfigs[registry]; ok && !index.Secure {
+		return nil
+	}
+
+	host := registry
+	if hostName, _, err := net.SplitHostPort(registry); err == nil {
+		host = hostName
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else if hostIPs, err := net.LookupIP(host); err == nil {
+		ips = hostIPs
+	}
+
+	for _, ip := range ips {
+		for _, cidr := range info.RegistryConfig.InsecureRegistryCIDRs {
+			if cidr != nil && (*net.IPNet)(cidr).Contains(ip) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("the Docker daemon does not allow insecure access to the registry %s - add it to the insecure-registries list in the daemon configuration (daemon.json) and restart the daemon", registry)
+}
+
+// authConfig returns the registry credentials from the Docker CLI configuration
+// (the anonymous access is used if there are no credentials for the registry)
+func authConfig(registry string) docker.AuthConfiguration {
+	auths, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		log.Debugf("registry.authConfig: no Docker CLI credentials => %v", err)
+		return docker.AuthConfiguration{}
+	}
+
+	keys := []string{registry, "https://" + registry, httpScheme + registry}
+	if registry == DefaultRegistry {
+		keys = append([]string{dockerHubAuthKey}, keys...)
+	}
+
+	for _, key := range keys {
+		if auth, ok := auths.Configs[key]; ok {
+			return auth
+		}
+	}
+
+	return docker.AuthConfiguration{}
+}
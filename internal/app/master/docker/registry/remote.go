@@ -0,0 +1,543 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Image manifest media types
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIConfig          = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd       = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+const (
+	dockerHubEndpoint = "registry-1.docker.io"
+	defaultPlatformOS = "linux"
+	requestTimeout    = 60 * time.Second
+	maxManifestSize   = 4 << 20
+	//the connection timeouts for the requests without a request timeout (the layer downloads)
+	dialTimeout           = 30 * time.Second
+	responseHeaderTimeout = 60 * time.Second
+)
+
+var (
+	errManifestTooLarge = errors.New("image manifest is too large")
+	errNoPlatform       = fmt.Errorf("no image for the %s/%s platform", defaultPlatformOS, runtime.GOARCH)
+)
+
+// Descriptor describes the manifest, config and layer blobs
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Platform is the image index platform info
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest is the image manifest (Docker v2 schema 2 or OCI)
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type manifestIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// HistoryRecord is an image config history record
+type HistoryRecord struct {
+	Created    time.Time `json:"created"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	EmptyLayer bool      `json:"empty_layer,omitempty"`
+}
+
+// ImageConfig is the image config blob
+type ImageConfig struct {
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Created      time.Time       `json:"created"`
+	Author       string          `json:"author,omitempty"`
+	Config       *docker.Config  `json:"config,omitempty"`
+	History      []HistoryRecord `json:"history,omitempty"`
+}
+
+// RemoteImage is an image fetched directly from a registry
+type RemoteImage struct {
+	Ref            Reference
+	Manifest       *Manifest
+	ManifestData   []byte
+	ManifestDigest string
+	Config         *ImageConfig
+	ConfigData     []byte
+	//where the image was fetched from (the original registry or a mirror)
+	source   Reference
+	insecure bool
+}
+
+// ID returns the image ID (the config digest)
+func (i *RemoteImage) ID() string {
+	return i.Manifest.Config.Digest
+}
+
+// Size returns the compressed image size
+func (i *RemoteImage) Size() int64 {
+	var size int64
+	for _, layer := range i.Manifest.Layers {
+		size += layer.Size
+	}
+
+	return size
+}
+
+// History returns the image history records in the Docker image history format
+// (the newest record first, the layer sizes are the compressed sizes)
+func (i *RemoteImage) History() []docker.ImageHistory {
+	var records []docker.ImageHistory
+	layerIdx := 0
+	for _, record := range i.Config.History {
+		hrecord := docker.ImageHistory{
+			ID:        "<missing>",
+			Created:   record.Created.Unix(),
+			CreatedBy: record.CreatedBy,
+			Comment:   record.Comment,
+		}
+
+		if !record.EmptyLayer && layerIdx < len(i.Manifest.Layers) {
+			hrecord.Size = i.Manifest.Layers[layerIdx].Size
+			layerIdx++
+		}
+
+		records = append([]docker.ImageHistory{hrecord}, records...)
+	}
+
+	if len(records) > 0 {
+		records[0].ID = i.ID()
+		records[0].Tags = []string{i.Ref.String()}
+	}
+
+	return records
+}
+
+// RemoteClient fetches the images directly from the registries (without a Docker daemon)
+type RemoteClient struct {
+	access *config.RegistryAccess
+	tokens map[string]string
+}
+
+// NewRemoteClient creates a new direct registry client
+func NewRemoteClient(access *config.RegistryAccess) *RemoteClient {
+	return &RemoteClient{
+		access: access,
+		tokens: map[string]string{},
+	}
+}
+
+// FetchImage fetches the image manifest and config from the registry
+// (the Docker Hub images are fetched through the registry mirrors first)
+func (c *RemoteClient) FetchImage(imageRef string) (*RemoteImage, error) {
+	ref := ParseReference(imageRef)
+
+	if ref.IsDockerHub() {
+		for _, mirror := range c.access.Mirrors {
+			image, err := c.fetchImage(ref, ref.WithRegistry(mirror), IsInsecure(mirror, c.access))
+			if err == nil {
+				return image, nil
+			}
+
+			log.Warnf("registry.FetchImage: error fetching %s from registry mirror %s => %v", imageRef, mirror, err)
+		}
+	}
+
+	return c.fetchImage(ref, ref, IsInsecure(ref.Registry, c.access))
+}
+
+func (c *RemoteClient) fetchImage(ref, source Reference, insecure bool) (*RemoteImage, error) {
+	endpoint := c.endpoint(source.Registry, insecure)
+
+	manifestRef := source.Tag
+	if source.Digest != "" {
+		manifestRef = source.Digest
+	}
+
+	data, mediaType, digest, err := c.fetchManifest(endpoint, source, manifestRef, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex {
+		var index manifestIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("invalid image index: %v", err)
+		}
+
+		platformManifest := selectPlatform(index.Manifests)
+		if platformManifest == nil {
+			return nil, errNoPlatform
+		}
+
+		data, mediaType, digest, err = c.fetchManifest(endpoint, source, platformManifest.Digest, insecure)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mediaType != MediaTypeDockerManifest && mediaType != MediaTypeOCIManifest {
+		return nil, fmt.Errorf("unsupported image manifest type: %s", mediaType)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid image manifest: %v", err)
+	}
+
+	if manifest.MediaType == "" {
+		manifest.MediaType = mediaType
+	}
+
+	configData, err := c.fetchBlobData(endpoint, source, manifest.Config, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageConfig ImageConfig
+	if err := json.Unmarshal(configData, &imageConfig); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	return &RemoteImage{
+		Ref:            ref,
+		Manifest:       &manifest,
+		ManifestData:   data,
+		ManifestDigest: digest,
+		Config:         &imageConfig,
+		ConfigData:     configData,
+		source:         source,
+		insecure:       insecure,
+	}, nil
+}
+
+func selectPlatform(manifests []Descriptor) *Descriptor {
+	for idx := range manifests {
+		platform := manifests[idx].Platform
+		if platform != nil &&
+			platform.OS == defaultPlatformOS &&
+			platform.Architecture == runtime.GOARCH {
+			return &manifests[idx]
+		}
+	}
+
+	return nil
+}
+
+func (c *RemoteClient) endpoint(registry string, insecure bool) string {
+	host := HostName(registry)
+	if host == DefaultRegistry {
+		host = dockerHubEndpoint
+	}
+
+	if insecure && !strings.HasPrefix(registry, "https://") {
+		return httpScheme + host
+	}
+
+	return "https://" + host
+}
+
+func (c *RemoteClient) fetchManifest(endpoint string, ref Reference, manifestRef string, insecure bool) ([]byte, string, string, error) {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", endpoint, ref.Repository, manifestRef)
+	accept := strings.Join([]string{
+		MediaTypeDockerManifest,
+		MediaTypeDockerManifestList,
+		MediaTypeOCIManifest,
+		MediaTypeOCIIndex,
+	}, ",")
+
+	resp, err := c.get(manifestURL, ref, accept, insecure, requestTimeout)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if len(data) > maxManifestSize {
+		return nil, "", "", errManifestTooLarge
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = sha256Digest(data)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if idx := strings.Index(mediaType, ";"); idx != -1 {
+		mediaType = mediaType[:idx]
+	}
+
+	return data, strings.TrimSpace(mediaType), digest, nil
+}
+
+func (c *RemoteClient) fetchBlobData(endpoint string, ref Reference, blob Descriptor, insecure bool) ([]byte, error) {
+	reader, err := c.openBlob(endpoint, ref, blob, insecure, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if sha256Digest(data) != blob.Digest {
+		return nil, fmt.Errorf("blob digest mismatch: %s", blob.Digest)
+	}
+
+	return data, nil
+}
+
+// openBlob opens the blob download stream
+// (the timeout is for the whole download, the large layer blobs are downloaded without a timeout)
+func (c *RemoteClient) openBlob(endpoint string, ref Reference, blob Descriptor, insecure bool, timeout time.Duration) (io.ReadCloser, error) {
+	blobURL := fmt.Sprintf("%s/v2/%s/blobs/%s", endpoint, ref.Repository, blob.Digest)
+	resp, err := c.get(blobURL, ref, "", insecure, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// httpClient returns the registry HTTP client with the timeout for the whole request
+// (no timeout if it's 0; the connection and response header timeouts are always set,
+// so the stalled registries still fail)
+func (c *RemoteClient) httpClient(insecure bool, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout: dialTimeout,
+		}).Dial,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// get makes a registry GET request (the response status must be 'OK')
+func (c *RemoteClient) get(requestURL string, ref Reference, accept string, insecure bool, timeout time.Duration) (*http.Response, error) {
+	header := http.Header{}
+	if accept != "" {
+		header.Set("Accept", accept)
+	}
+
+	scope := fmt.Sprintf("repository:%s:pull", ref.Repository)
+	resp, err := c.do(c.httpClient(insecure, timeout), "GET", requestURL, ref.Registry, scope, header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("not found in the registry: %s", requestURL)
+		}
+
+		return nil, fmt.Errorf("unexpected registry response status (%s): %s", resp.Status, requestURL)
+	}
+
+	return resp, nil
+}
+
+// do makes a registry request (with the registry token authentication if the registry needs it)
+// (the request body is sent again after the authentication, so it needs to be seekable)
+func (c *RemoteClient) do(client *http.Client,
+	method string,
+	requestURL string,
+	registry string,
+	scope string,
+	header http.Header,
+	body io.ReadSeeker) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var bodyReader io.Reader
+		var bodySize int64
+		if body != nil {
+			size, err := body.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+
+			//the client closes the request body, but the body can be sent again
+			bodyReader = ioutil.NopCloser(body)
+			bodySize = size
+		}
+
+		req, err := http.NewRequest(method, requestURL, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+
+		req.ContentLength = bodySize
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		if token, ok := c.tokens[registry+"|"+scope]; ok {
+			req.Header.Set("Authorization", token)
+		}
+
+		return client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := c.authenticate(client, challenge, registry, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tokens[registry+"|"+scope] = token
+		return send()
+	}
+
+	return resp, nil
+}
+
+// authenticate returns the Authorization header value for the registry authentication challenge
+func (c *RemoteClient) authenticate(client *http.Client, challenge, registry, scope string) (string, error) {
+	auth := authConfig(registry)
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if auth.Username == "" {
+			return "", fmt.Errorf("registry credentials are required for %s (use docker login)", registry)
+		}
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(auth.Username, auth.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", fmt.Errorf("invalid registry authentication challenge: %s", challenge)
+		}
+
+		qs := url.Values{}
+		if service := params["service"]; service != "" {
+			qs.Set("service", service)
+		}
+		qs.Set("scope", scope)
+
+		req, err := http.NewRequest("GET", realm+"?"+qs.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		if auth.Username != "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("registry authentication failed (%s)", resp.Status)
+		}
+
+		var tokenInfo struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&tokenInfo); err != nil {
+			return "", fmt.Errorf("invalid registry token response: %v", err)
+		}
+
+		token := tokenInfo.Token
+		if token == "" {
+			token = tokenInfo.AccessToken
+		}
+
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("unsupported registry authentication challenge: %s", challenge)
+	}
+}
+
+// parseChallenge parses the WWW-Authenticate header value
+// (e.g., 'Bearer realm="https://auth.docker.io/token",service="registry.docker.io"')
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return parts[0], params
+}
@@ -0,0 +1,258 @@
+package registry
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the image filesystem is extracted without the root privileges, so the file owners
+//  are not set and the directories are always writable (the original tar headers
+//  are returned for the minified image layer)
+//* the entry paths are resolved in the root directory (like in a chroot),
+//  so the layer entries can't be written outside of it
+
+// OCI layer whiteout file names
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// ExtractImage extracts the image layers saved in the OCI image layout (with SaveLayout)
+// into the root directory (the layer whiteouts are applied) and returns the tar headers
+// of the image files (by their image paths)
+func ExtractImage(layoutPath string, image *RemoteImage, rootDir string) (map[string]*tar.Header, error) {
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]*tar.Header{}
+	for _, layer := range image.Manifest.Layers {
+		layerPath, err := blobPath(layoutPath, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := extractLayer(layerPath, rootDir, headers); err != nil {
+			return nil, fmt.Errorf("layer %s: %v", layer.Digest, err)
+		}
+	}
+
+	return headers, nil
+}
+
+func extractLayer(layerPath, rootDir string, headers map[string]*tar.Header) error {
+	layerFile, err := os.Open(layerPath)
+	if err != nil {
+		return err
+	}
+	defer layerFile.Close()
+
+	in, closeLayer, err := openLayer(layerFile)
+	if err != nil {
+		return err
+	}
+	defer closeLayer()
+
+	//the opaque directory whiteouts remove only the files from the lower layers
+	layerFiles := map[string]bool{}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		baseName := path.Base(name)
+		if strings.HasPrefix(baseName, whiteoutPrefix) {
+			dirPath := path.Dir(name)
+			if baseName == whiteoutOpaque {
+				removeImageFiles(rootDir, dirPath, headers, layerFiles, false)
+			} else {
+				removeImageFiles(rootDir, path.Join(dirPath, strings.TrimPrefix(baseName, whiteoutPrefix)), headers, layerFiles, true)
+			}
+
+			continue
+		}
+
+		target, err := layerTarget(rootDir, name)
+		if err != nil {
+			return err
+		}
+
+		//the headers are saved by the resolved image paths (the parent directories can be symlinks)
+		name = rootImagePath(rootDir, target)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err != nil || !info.IsDir() {
+				os.RemoveAll(target)
+				if err := os.Mkdir(target, 0755); err != nil {
+					return err
+				}
+			}
+
+		case tar.TypeReg, tar.TypeRegA:
+			//the existing file (or symlink) is replaced, so the write doesn't follow a symlink
+			os.RemoveAll(target)
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+
+			if err := os.Chmod(target, hdr.FileInfo().Mode()); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			os.RemoveAll(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			linkTarget, err := layerTarget(rootDir, path.Clean("/"+hdr.Linkname))
+			if err != nil {
+				return err
+			}
+
+			os.RemoveAll(target)
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+
+			//the hard links are the same files in the minified image layer
+			if linkHdr, ok := headers[rootImagePath(rootDir, linkTarget)]; ok {
+				linked := *linkHdr
+				linked.Name = hdr.Name
+				hdr = &linked
+			}
+
+		default:
+			log.Debugf("registry.extractLayer: skipping unsupported entry type (%v) => %v", hdr.Typeflag, hdr.Name)
+			continue
+		}
+
+		headers[name] = hdr
+		for filePath := name; filePath != "/"; filePath = path.Dir(filePath) {
+			layerFiles[filePath] = true
+		}
+	}
+}
+
+// removeImageFiles removes the image file (or only the directory files if withDir is false;
+// the files from the current layer are kept)
+func removeImageFiles(rootDir, imagePath string, headers map[string]*tar.Header, layerFiles map[string]bool, withDir bool) {
+	resolved, err := fsutil.ResolveRootPath(rootDir, path.Dir(imagePath), false)
+	if err != nil {
+		return
+	}
+
+	imagePath = path.Join(resolved, path.Base(imagePath))
+	fullPath := filepath.Join(rootDir, filepath.FromSlash(imagePath))
+	if withDir {
+		os.RemoveAll(fullPath)
+		delete(headers, imagePath)
+	} else if names, err := readDirNames(fullPath); err == nil {
+		for _, name := range names {
+			if !layerFiles[path.Join(imagePath, name)] {
+				os.RemoveAll(filepath.Join(fullPath, name))
+			}
+		}
+	}
+
+	prefix := strings.TrimSuffix(imagePath, "/") + "/"
+	for name := range headers {
+		if strings.HasPrefix(name, prefix) && !layerFiles[name] {
+			delete(headers, name)
+		}
+	}
+}
+
+func readDirNames(dirPath string) ([]string, error) {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	return dir.Readdirnames(-1)
+}
+
+// layerTarget returns the host path for the layer entry (its parent directories
+// are resolved and created in the root directory, the last path component is not resolved)
+func layerTarget(rootDir, name string) (string, error) {
+	parent, err := fsutil.ResolveRootPath(rootDir, path.Dir(name), true)
+	if err != nil {
+		return "", err
+	}
+
+	parentPath := filepath.Join(rootDir, filepath.FromSlash(parent))
+	if err := os.MkdirAll(parentPath, 0755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parentPath, path.Base(name)), nil
+}
+
+// rootImagePath returns the image path for the host path in the root directory
+func rootImagePath(rootDir, fullPath string) string {
+	return "/" + strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(fullPath, rootDir)), "/")
+}
+
+// NewLayerConfig returns the image config for the single layer image with the same config
+// (the layer diff ID replaces the image layers and the history record replaces the image history)
+func NewLayerConfig(configData []byte, diffID string, created time.Time, createdBy string) ([]byte, error) {
+	data, err := setDiffIDs(configData, []string{diffID})
+	if err != nil {
+		return nil, err
+	}
+
+	var imageConfig map[string]json.RawMessage
+	if err := json.Unmarshal(data, &imageConfig); err != nil {
+		return nil, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	if imageConfig["created"], err = json.Marshal(created.UTC()); err != nil {
+		return nil, err
+	}
+
+	history := []HistoryRecord{
+		{
+			Created:   created.UTC(),
+			CreatedBy: createdBy,
+		},
+	}
+
+	if imageConfig["history"], err = json.Marshal(history); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(imageConfig)
+}
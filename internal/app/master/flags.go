@@ -0,0 +1,80 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+)
+
+type flagAlias struct {
+	Name       string
+	Deprecated bool
+}
+
+// Flag aliases (the deprecated aliases still work, but they show a message with the new flag name)
+var flagAliases = map[string][]flagAlias{
+	FlagShowContainerLogs: {{Name: "show-clogs", Deprecated: true}},
+	FlagShowBuildLogs:     {{Name: "show-blogs", Deprecated: true}},
+}
+
+// flagName returns the flag name with its aliases (using the 'name, alias' format for the cli flag names)
+func flagName(name string) string {
+	aliases := flagAliases[name]
+	if len(aliases) == 0 {
+		return name
+	}
+
+	names := []string{name}
+	for _, alias := range aliases {
+		names = append(names, alias.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+type deprecatedFlagInfo struct {
+	Alias string
+	Name  string
+}
+
+// getDeprecatedFlags returns the deprecated flag aliases used in the command line arguments
+func getDeprecatedFlags(args []string) []deprecatedFlagInfo {
+	deprecated := map[string]string{}
+	for name, aliases := range flagAliases {
+		for _, alias := range aliases {
+			if alias.Deprecated {
+				deprecated[alias.Name] = name
+			}
+		}
+	}
+
+	var flags []deprecatedFlagInfo
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		alias := strings.TrimLeft(arg, "-")
+		if idx := strings.Index(alias, "="); idx != -1 {
+			alias = alias[:idx]
+		}
+
+		if name, ok := deprecated[alias]; ok {
+			flags = append(flags, deprecatedFlagInfo{Alias: alias, Name: name})
+		}
+	}
+
+	return flags
+}
+
+func showDeprecatedFlags(args []string) {
+	printer := status.New("")
+	for _, info := range getDeprecatedFlags(args) {
+		printer.Info(status.IDFlagDeprecated, "flag.deprecated", "flag=%s replacement=%s message='use --%s instead (--%s will be removed in a future version)'",
+			info.Alias, info.Name, info.Name, info.Alias)
+	}
+}
@@ -0,0 +1,407 @@
+package container
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	dockerDesktopOS           = "Docker Desktop"
+	dockerDesktopSettingsFile = "Library/Group Containers/group.com.docker/settings.json"
+)
+
+// the directories Docker Desktop for Mac shares with its VM by default
+var dockerDesktopDefaultShares = []string{
+	"/Users",
+	"/Volumes",
+	"/private",
+	"/tmp",
+	"/var/folders",
+}
+
+// isDockerDesktop returns true if the Docker daemon runs in the Docker Desktop VM
+func isDockerDesktop(client dockerclient.API) bool {
+	info, err := client.Info()
+	if err != nil {
+		log.Debugf("isDockerDesktop: error getting the Docker info => %v", err)
+		return false
+	}
+
+	return info.OperatingSystem == dockerDesktopOS
+}
+
+// dockerDesktopFileShares returns the host directories Docker Desktop makes visible to its VM
+func dockerDesktopFileShares() []string {
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		return dockerDesktopDefaultShares
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(homeDir, dockerDesktopSettingsFile))
+	if err != nil {
+		return dockerDesktopDefaultShares
+	}
+
+	var settings struct {
+		FileSharingDirectories []string `json:"filesharingDirectories"`
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil || len(settings.FileSharingDirectories) == 0 {
+		log.Debugf("dockerDesktopFileShares: no file sharing directories in the Docker Desktop settings (%v)", err)
+		return dockerDesktopDefaultShares
+	}
+
+	return settings.FileSharingDirectories
+}
+
+func isSharedPath(hostPath string, shares []string) bool {
+	if fullPath, err := filepath.EvalSymlinks(hostPath); err == nil {
+		hostPath = fullPath
+	}
+
+	for _, share := range shares {
+		if fullShare, err := filepath.EvalSymlinks(share); err == nil {
+			share = fullShare
+		}
+
+		if hostPath == share || strings.HasPrefix(hostPath, strings.TrimSuffix(share, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectArtifactsTransfer picks the mount or copy mode for the sensor and the artifacts
+// (the host paths need to be shared with the Docker Desktop, Colima or Lima VM to be mounted
+// and they can't be mounted at all on the ssh Docker hosts and in the minikube VM)
+func (i *Inspector) selectArtifactsTransfer() {
+	mode := config.ArtifactsTransferAuto
+	if i.SensorMount != nil && i.SensorMount.Transfer != "" {
+		mode = i.SensorMount.Transfer
+	}
+
+	if mode == config.ArtifactsTransferCopy {
+		i.CopyArtifacts = true
+		return
+	}
+
+	if i.TargetContainer != "" {
+		//new volumes can't be mounted in the running container
+		i.CopyArtifacts = true
+		if i.PrintState {
+			i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer", "mode=copy message='running target container'")
+		}
+
+		return
+	}
+
+	if dockerhost.IsSSH() {
+		//the remote Docker host can't mount the local paths
+		if mode == config.ArtifactsTransferMount {
+			if i.PrintState {
+				i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer",
+					"mode=mount message='the ssh Docker host does not share the local paths (use --artifacts-transfer copy)'")
+			}
+
+			return
+		}
+
+		i.CopyArtifacts = true
+		if i.PrintState {
+			i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer", "mode=copy message='ssh Docker host'")
+		}
+
+		return
+	}
+
+	if machine := dockerclient.DetectMachine(i.APIClient); machine != "" {
+		i.selectMachineArtifactsTransfer(mode, machine)
+		return
+	}
+
+	if runtime.GOOS != "darwin" || !isDockerDesktop(i.APIClient) {
+		return
+	}
+
+	unshared := i.unsharedPaths(dockerDesktopFileShares())
+	if len(unshared) == 0 {
+		return
+	}
+
+	if mode == config.ArtifactsTransferMount {
+		if i.PrintState {
+			i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer",
+				"mode=mount message='paths not shared with Docker Desktop (add them in Preferences -> Resources -> File Sharing or use --artifacts-transfer copy): %s'",
+				strings.Join(unshared, ","))
+		}
+
+		return
+	}
+
+	i.CopyArtifacts = true
+	if i.PrintState {
+		i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer",
+			"mode=copy message='paths not shared with Docker Desktop: %s'", strings.Join(unshared, ","))
+	}
+}
+
+// selectMachineArtifactsTransfer picks the artifacts transfer mode for the Docker daemons
+// running in the Colima, Lima or minikube VMs (the state volume needs a writable VM file share)
+func (i *Inspector) selectMachineArtifactsTransfer(mode, machine string) {
+	unshared := i.unsharedPaths(dockerclient.MachineFileShares(machine))
+	if len(unshared) == 0 {
+		return
+	}
+
+	if mode == config.ArtifactsTransferMount {
+		if i.PrintState {
+			i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer",
+				"mode=mount machine=%v message='paths not shared (writable) with the VM (add them to the VM mounts or use --artifacts-transfer copy): %s'",
+				machine, strings.Join(unshared, ","))
+		}
+
+		return
+	}
+
+	i.CopyArtifacts = true
+	if i.PrintState {
+		i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer",
+			"mode=copy machine=%v message='paths not shared (writable) with the VM: %s'", machine, strings.Join(unshared, ","))
+	}
+}
+
+// unsharedPaths returns the state volume and sensor paths that are not in the shared directories
+func (i *Inspector) unsharedPaths(shares []string) []string {
+	var unshared []string
+	for _, hostPath := range []string{i.LocalVolumePath, i.sensorHostPath()} {
+		if !isSharedPath(hostPath, shares) {
+			unshared = append(unshared, hostPath)
+		}
+	}
+
+	return unshared
+}
+
+// uploadSensor copies the sensor binary and an empty artifacts directory to the created (not started) container
+func (i *Inspector) uploadSensor(containerSensorPath, containerArtifactsPath string) error {
+	sensorPath := i.sensorHostPath()
+	sensorInfo, err := os.Stat(sensorPath)
+	if err != nil {
+		return err
+	}
+
+	sensorFile, err := os.Open(sensorPath)
+	if err != nil {
+		return err
+	}
+	defer sensorFile.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     strings.TrimPrefix(containerArtifactsPath, "/") + "/",
+			Mode:     0777,
+			ModTime:  sensorInfo.ModTime(),
+		})
+
+		if err == nil {
+			err = tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     strings.TrimPrefix(containerSensorPath, "/"),
+				Mode:     0755,
+				Size:     sensorInfo.Size(),
+				ModTime:  sensorInfo.ModTime(),
+			})
+		}
+
+		if err == nil {
+			_, err = io.Copy(tw, sensorFile)
+		}
+
+		if err == nil {
+			err = tw.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return i.APIClient.UploadToContainer(i.ContainerID, dockerapi.UploadToContainerOptions{
+		InputStream: pr,
+		Path:        "/",
+	})
+}
+
+// downloadArtifacts copies the sensor artifacts from the container to the local artifacts directory
+func (i *Inspector) downloadArtifacts() error {
+	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
+	containerArtifactsPath := path.Join(i.mountLocation(), ArtifactsDir)
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := i.APIClient.DownloadFromContainer(i.ContainerID, dockerapi.DownloadFromContainerOptions{
+			OutputStream: pw,
+			Path:         containerArtifactsPath + "/.",
+		})
+
+		pw.CloseWithError(err)
+	}()
+
+	err := extractTar(pr, artifactsPath)
+	//drain the stream, so the download goroutine can finish
+	io.Copy(ioutil.Discard, pr)
+	if err != nil {
+		return err
+	}
+
+	if i.PrintState {
+		i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer", "status=downloaded location='%s'", artifactsPath)
+	}
+
+	return nil
+}
+
+// extractTar extracts the archive from the container to the target directory.
+// The entry paths are resolved in the target directory (the symlinks from the archive point
+// to the target directory, like in the container), so the entries can't be written outside of it.
+func extractTar(input io.Reader, targetDir string) error {
+	tr := tar.NewReader(input)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		target, err := extractTarget(targetDir, name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err == nil && info.IsDir() {
+				continue
+			}
+
+			os.Remove(target)
+			if err := os.Mkdir(target, os.FileMode(hdr.Mode)|0700); err != nil {
+				return err
+			}
+
+		case tar.TypeReg, tar.TypeRegA:
+			//the existing file (or symlink) is replaced, so the write doesn't follow a symlink
+			os.Remove(target)
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(hdr.Mode)|0600)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				log.Debugf("extractTar: error setting the file times (%v) => %v", target, err)
+			}
+
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			linkTarget, err := extractTarget(targetDir, path.Clean("/"+hdr.Linkname))
+			if err != nil {
+				return err
+			}
+
+			os.Remove(target)
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+
+		default:
+			log.Debugf("extractTar: skipping unsupported entry type (%v) => %v", hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+// extractTarget returns the host path for the archive entry (its parent directories
+// are resolved and created in the target directory, the last path component is not resolved)
+func extractTarget(targetDir, name string) (string, error) {
+	parent, err := fsutil.ResolveRootPath(targetDir, path.Dir(name), true)
+	if err != nil {
+		return "", err
+	}
+
+	parentPath := filepath.Join(targetDir, filepath.FromSlash(parent))
+	if err := os.MkdirAll(parentPath, 0777); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parentPath, path.Base(name)), nil
+}
+
+// sensorHostPath returns the location of the sensor binary on the Docker host
+func (i *Inspector) sensorHostPath() string {
+	if i.SensorMount != nil && i.SensorMount.SensorPath != "" {
+		return i.SensorMount.SensorPath
+	}
+
+	sensorPath := filepath.Join(fsutil.ExeDir(), SensorBinLocal)
+	if runtime.GOOS == "darwin" {
+		stateSensorPath := filepath.Join(i.StatePath, SensorBinLocal)
+		if fsutil.Exists(stateSensorPath) {
+			sensorPath = stateSensorPath
+		}
+	}
+
+	return sensorPath
+}
+
+func (i *Inspector) mountLocation() string {
+	if i.SensorMount != nil && i.SensorMount.Location != "" {
+		return i.SensorMount.Location
+	}
+
+	return SensorMountLocation
+}
+
+func (i *Inspector) containerSensorPath() string {
+	if i.SensorMount != nil && i.SensorMount.Location != "" {
+		return path.Join(i.SensorMount.Location, SensorBinDir)
+	}
+
+	return SensorBinPath
+}
@@ -3,26 +3,29 @@ package container
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	goerr "errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/ipc"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
 	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
 	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/pkg/ipc/command"
 	"github.com/docker-slim/docker-slim/pkg/ipc/event"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
 	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
-	v "github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 	dockerapi "github.com/cloudimmunity/go-dockerclientx"
@@ -33,26 +36,70 @@ const IpcErrRecvTimeoutStr = "receive time out"
 
 // Container inspector constants
 const (
-	SensorBinPath     = "/opt/dockerslim/bin/sensor"
-	ContainerNamePat  = "dockerslimk_%v_%v"
-	ArtifactsDir      = "artifacts"
-	SensorBinLocal    = "docker-slim-sensor"
-	ArtifactsMountPat = "%s:/opt/dockerslim/artifacts"
-	SensorMountPat    = "%s:/opt/dockerslim/bin/sensor:ro"
-	CmdPortDefault    = "65501/tcp"
-	EvtPortDefault    = "65502/tcp"
-	LabelName         = "dockerslim"
+	SensorMountLocation = "/opt/dockerslim"
+	SensorBinPath       = "/opt/dockerslim/bin/sensor"
+	ContainerNamePat    = "dockerslimk_%v_%v"
+	NetworkNamePat      = "dockerslimk_net_%v_%v"
+	NetworkDriver       = "bridge"
+	ArtifactsDir        = "artifacts"
+	SensorBinLocal      = "docker-slim-sensor"
+	SensorBinDir        = "bin/sensor"
+	ArtifactsMountPat   = "%s:%s"
+	SensorMountPat      = "%s:%s:ro"
+	CmdPortDefault      = "65501/tcp"
+	EvtPortDefault      = "65502/tcp"
+	LabelName           = "dockerslim"
 )
 
 var ErrStartMonitorTimeout = goerr.New("start monitor timeout")
 
+// Docker container events the inspector reacts to
+const (
+	dockerEventDie     = "die"
+	dockerEventOOM     = "oom"
+	dockerEventRestart = "restart"
+)
+
+// ContainerCrashExitCode is the exit code used when the target container exits or restarts during the monitoring
+const ContainerCrashExitCode = -123
+
+// containerStatePollInterval is how often the target container state is checked
+// (it catches the container exits and restarts when the Docker events are missed)
+const containerStatePollInterval = 2 * time.Second
+
+// maxCrashLogSize is the size of the container log tails saved with the crash information
+const maxCrashLogSize = 16 * 1024
+
+// ContainerExitError describes the unexpected target container exit
+type ContainerExitError struct {
+	ContainerID string
+	ExitCode    int
+	OOMKilled   bool
+	Restarted   bool
+	Stdout      string
+	Stderr      string
+}
+
+func (e *ContainerExitError) Error() string {
+	if e.Restarted {
+		return fmt.Sprintf("target container %s restarted unexpectedly (exit code %d)", e.ContainerID, e.ExitCode)
+	}
+
+	if e.OOMKilled {
+		return fmt.Sprintf("target container %s was killed (out of memory, exit code %d)", e.ContainerID, e.ExitCode)
+	}
+
+	return fmt.Sprintf("target container %s exited unexpectedly (exit code %d)", e.ContainerID, e.ExitCode)
+}
+
 // Inspector is a container execution inspector
 type Inspector struct {
-	ContainerInfo      *dockerapi.Container
+	ContainerInfo      *dockerclient.Container
 	ContainerPortsInfo string
 	ContainerPortList  string
 	ContainerID        string
 	ContainerName      string
+	TargetContainer    string
 	FatContainerCmd    []string
 	LocalVolumePath    string
 	StatePath          string
@@ -60,24 +107,48 @@ type Inspector struct {
 	EvtPort            dockerapi.Port
 	DockerHostIP       string
 	ImageInspector     *image.Inspector
-	APIClient          *dockerapi.Client
+	APIClient          dockerclient.API
 	Overrides          *config.ContainerOverrides
 	Links              []string
 	EtcHostsMaps       []string
 	DNSServers         []string
 	DNSSearchDomains   []string
+	DoIsolatedNetwork  bool
+	NetworkName        string
+	NetworkID          string
 	ShowContainerLogs  bool
 	VolumeMounts       map[string]config.VolumeMount
 	ExcludePaths       map[string]bool
 	IncludePaths       map[string]bool
+	IncludePathMaps    map[string]string
 	IncludeBins        map[string]bool
 	IncludeExes        map[string]bool
 	DoIncludeShell     bool
+	DoIncludeZoneinfo  bool
+	IncludeLocales     []string
+	DoDetectSecrets    bool
+	DoExcludeSecrets   bool
+	SensorMount        *config.SensorMount
+	SeccompBaseline    *config.SeccompBaseline
+	SeccompOptions     *config.SeccompOptions
+	AppArmorOptions    *config.AppArmorOptions
+	CopyArtifacts      bool
 	DoDebug            bool
 	PrintState         bool
-	PrintPrefix        string
-	dockerEventCh      chan *dockerapi.APIEvents
-	dockerEventStopCh  chan struct{}
+	Printer            *status.Printer
+	IsPodman           bool
+	//CrashHandler is called when the target container exits unexpectedly (before docker-slim exits)
+	CrashHandler func(err *ContainerExitError)
+	//ArtifactsProgress is called with the sensor artifact processing progress (when the monitoring is finishing)
+	ArtifactsProgress   func(files, totalFiles, bytes, totalBytes int64)
+	dockerEventCh       chan *dockerapi.APIEvents
+	dockerEventStopCh   chan struct{}
+	crashOnce           sync.Once
+	connectedContainers []string
+	profilesCheckStart  time.Time
+	appArmorLoaded      bool
+	healthyChecks       int
+	lastHealthCheck     time.Time
 }
 
 func pathMapKeys(m map[string]bool) []string {
@@ -94,29 +165,41 @@ func pathMapKeys(m map[string]bool) []string {
 }
 
 // NewInspector creates a new container execution inspector
-func NewInspector(client *dockerapi.Client,
+func NewInspector(client dockerclient.API,
 	statePath string,
 	imageInspector *image.Inspector,
 	localVolumePath string,
+	targetContainer string,
 	overrides *config.ContainerOverrides,
 	links []string,
 	etcHostsMaps []string,
 	dnsServers []string,
 	dnsSearchDomains []string,
+	doIsolatedNetwork bool,
 	showContainerLogs bool,
 	volumeMounts map[string]config.VolumeMount,
 	excludePaths map[string]bool,
 	includePaths map[string]bool,
+	includePathMaps map[string]string,
 	includeBins map[string]bool,
 	includeExes map[string]bool,
 	doIncludeShell bool,
+	doIncludeZoneinfo bool,
+	includeLocales []string,
+	doDetectSecrets bool,
+	doExcludeSecrets bool,
+	sensorMount *config.SensorMount,
+	seccompBaseline *config.SeccompBaseline,
+	seccompOptions *config.SeccompOptions,
+	appArmorOptions *config.AppArmorOptions,
 	doDebug bool,
 	printState bool,
-	printPrefix string) (*Inspector, error) {
+	printer *status.Printer) (*Inspector, error) {
 
 	inspector := &Inspector{
 		StatePath:         statePath,
 		LocalVolumePath:   localVolumePath,
+		TargetContainer:   targetContainer,
 		CmdPort:           CmdPortDefault,
 		EvtPort:           EvtPortDefault,
 		ImageInspector:    imageInspector,
@@ -126,16 +209,27 @@ func NewInspector(client *dockerapi.Client,
 		EtcHostsMaps:      etcHostsMaps,
 		DNSServers:        dnsServers,
 		DNSSearchDomains:  dnsSearchDomains,
+		DoIsolatedNetwork: doIsolatedNetwork,
 		ShowContainerLogs: showContainerLogs,
 		VolumeMounts:      volumeMounts,
 		ExcludePaths:      excludePaths,
 		IncludePaths:      includePaths,
+		IncludePathMaps:   includePathMaps,
 		IncludeBins:       includeBins,
 		IncludeExes:       includeExes,
 		DoIncludeShell:    doIncludeShell,
+		DoIncludeZoneinfo: doIncludeZoneinfo,
+		IncludeLocales:    includeLocales,
+		DoDetectSecrets:   doDetectSecrets,
+		DoExcludeSecrets:  doExcludeSecrets,
+		SensorMount:       sensorMount,
+		SeccompBaseline:   seccompBaseline,
+		SeccompOptions:    seccompOptions,
+		AppArmorOptions:   appArmorOptions,
 		DoDebug:           doDebug,
 		PrintState:        printState,
-		PrintPrefix:       printPrefix,
+		Printer:           printer,
+		IsPodman:          dockerclient.IsPodman(client),
 	}
 
 	if overrides != nil && ((len(overrides.Entrypoint) > 0) || overrides.ClearEntrypoint) {
@@ -163,64 +257,108 @@ func NewInspector(client *dockerapi.Client,
 	inspector.dockerEventCh = make(chan *dockerapi.APIEvents)
 	inspector.dockerEventStopCh = make(chan struct{})
 
+	inspector.selectArtifactsTransfer()
+
 	return inspector, nil
 }
 
-// RunContainer starts the container inspector instance execution
-func (i *Inspector) RunContainer() error {
+func (i *Inspector) createContainerOptions() (*dockerclient.CreateContainerOptions, map[dockerapi.Port]struct{}) {
 	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
-	sensorPath := filepath.Join(fsutil.ExeDir(), SensorBinLocal)
+	sensorPath := i.sensorHostPath()
 
-	if runtime.GOOS == "darwin" {
-		stateSensorPath := filepath.Join(i.StatePath, SensorBinLocal)
-		if fsutil.Exists(stateSensorPath) {
-			sensorPath = stateSensorPath
-		}
-	}
-
-	artifactsMountInfo := fmt.Sprintf(ArtifactsMountPat, artifactsPath)
-	sensorMountInfo := fmt.Sprintf(SensorMountPat, sensorPath)
+	//the container paths are always Linux paths (even on Windows hosts)
+	mountLocation := i.mountLocation()
+	containerSensorPath := i.containerSensorPath()
+	containerArtifactsPath := path.Join(mountLocation, ArtifactsDir)
 
 	var volumeBinds []string
 	for _, volumeMount := range i.VolumeMounts {
-		mountInfo := fmt.Sprintf("%s:%s:%s", volumeMount.Source, volumeMount.Destination, volumeMount.Options)
+		mountInfo := fmt.Sprintf("%s:%s:%s",
+			dockerhost.MountSource(volumeMount.Source), volumeMount.Destination, volumeMount.Options)
 		volumeBinds = append(volumeBinds, mountInfo)
 	}
 
-	volumeBinds = append(volumeBinds, artifactsMountInfo)
-	volumeBinds = append(volumeBinds, sensorMountInfo)
+	volumeBinds = append(volumeBinds, secretBinds(i.Overrides)...)
+
+	//in the copy mode the sensor is uploaded to the container and the artifacts are downloaded from it
+	if !i.CopyArtifacts {
+		artifactsMountInfo := fmt.Sprintf(ArtifactsMountPat, dockerhost.MountSource(artifactsPath), containerArtifactsPath)
+		sensorMountInfo := fmt.Sprintf(SensorMountPat, dockerhost.MountSource(sensorPath), containerSensorPath)
+		if i.SensorMount != nil && i.SensorMount.Options != "" {
+			artifactsMountInfo = fmt.Sprintf("%s:%s", artifactsMountInfo, i.SensorMount.Options)
+			sensorMountInfo = fmt.Sprintf("%s,%s", sensorMountInfo, i.SensorMount.Options)
+		}
+
+		log.Debugf("RunContainer: sensor mount => %v / artifacts mount => %v", sensorMountInfo, artifactsMountInfo)
+
+		volumeBinds = append(volumeBinds, artifactsMountInfo)
+		volumeBinds = append(volumeBinds, sensorMountInfo)
+	}
 
 	var containerCmd []string
 	if i.DoDebug {
 		containerCmd = append(containerCmd, "-d")
 	}
 
+	if mountLocation != SensorMountLocation {
+		containerCmd = append(containerCmd, "-a", containerArtifactsPath)
+	}
+
 	i.ContainerName = fmt.Sprintf(ContainerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	if i.DoIsolatedNetwork {
+		i.NetworkName = fmt.Sprintf(NetworkNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	}
 
-	containerOptions := dockerapi.CreateContainerOptions{
+	containerOptions := &dockerclient.CreateContainerOptions{
 		Name: i.ContainerName,
-		Config: &dockerapi.Config{
-			Image: i.ImageInspector.ImageRef,
-			//ExposedPorts: map[dockerapi.Port]struct{}{
-			//	i.CmdPort: {},
-			//	i.EvtPort: {},
-			//},
-			Entrypoint: []string{SensorBinPath},
-			Cmd:        containerCmd,
-			Env:        i.Overrides.Env,
-			Labels:     map[string]string{"type": LabelName},
-			Hostname:   i.Overrides.Hostname,
+		Config: &dockerclient.Config{
+			Config: dockerapi.Config{
+				Image: i.ImageInspector.ImageRef,
+				//ExposedPorts: map[dockerapi.Port]struct{}{
+				//	i.CmdPort: {},
+				//	i.EvtPort: {},
+				//},
+				Entrypoint: []string{containerSensorPath},
+				Cmd:        containerCmd,
+				Env:        containerEnv(i.Overrides),
+				Labels:     containerLabels(i.Overrides),
+				Hostname:   i.Overrides.Hostname,
+				Domainname: i.Overrides.Domainname,
+			},
 		},
-		HostConfig: &dockerapi.HostConfig{
-			Binds:           volumeBinds,
-			PublishAllPorts: true,
-			CapAdd:          []string{"SYS_ADMIN"},
-			Privileged:      true,
+		HostConfig: &dockerclient.HostConfig{
+			HostConfig: dockerapi.HostConfig{
+				Binds:           volumeBinds,
+				VolumesFrom:     i.Overrides.VolumesFrom,
+				ReadonlyRootfs:  i.Overrides.ReadOnlyRootfs,
+				PublishAllPorts: true,
+				CapAdd:          []string{"SYS_ADMIN"},
+				Privileged:      true,
+			},
+			Tmpfs:   containerTmpfs(i.Overrides),
+			Sysctls: i.Overrides.Sysctls,
 		},
 	}
 
-	runAsUser := i.ImageInspector.ImageInfo.Config.User
 	containerOptions.Config.User = "0:0"
+	if i.Overrides.Interactive {
+		containerOptions.Config.Tty = true
+		containerOptions.Config.OpenStdin = true
+		containerOptions.Config.AttachStdin = true
+		containerOptions.Config.AttachStdout = true
+		containerOptions.Config.AttachStderr = true
+	}
+
+	//in the copy mode the sensor is uploaded to a volume
+	//(the files can't be copied to a read-only root filesystem)
+	if i.Overrides.ReadOnlyRootfs && i.CopyArtifacts {
+		containerOptions.Config.Volumes = map[string]struct{}{mountLocation: {}}
+	}
+
+	setCapabilities(containerOptions.HostConfig, i.Overrides)
+	setSecurityOverrides(containerOptions.HostConfig, i.Overrides)
+	setDevices(containerOptions.HostConfig, i.Overrides)
+	setResourceLimits(containerOptions.HostConfig, i.Overrides)
 
 	commsExposedPorts := map[dockerapi.Port]struct{}{
 		i.CmdPort: {},
@@ -242,11 +380,19 @@ func (i *Inspector) RunContainer() error {
 		log.Debugf("RunContainer: default exposed ports => %#v", containerOptions.Config.ExposedPorts)
 	}
 
+	publishPorts(containerOptions, i.Overrides)
+
 	if i.Overrides.Network != "" {
 		containerOptions.HostConfig.NetworkMode = i.Overrides.Network
+		containerOptions.NetworkingConfig = networkingConfig(i.Overrides)
 		log.Debugf("RunContainer: HostConfig.NetworkMode => %v", i.Overrides.Network)
 	}
 
+	if i.NetworkName != "" {
+		containerOptions.HostConfig.NetworkMode = i.NetworkName
+		log.Debugf("RunContainer: HostConfig.NetworkMode (isolated network) => %v", i.NetworkName)
+	}
+
 	// adding this separately for better visibility...
 	if len(i.Links) > 0 {
 		containerOptions.HostConfig.Links = i.Links
@@ -269,19 +415,172 @@ func (i *Inspector) RunContainer() error {
 		log.Debugf("RunContainer: HostConfig.DNSSearch => %v", i.DNSSearchDomains)
 	}
 
-	containerInfo, err := i.APIClient.CreateContainer(containerOptions)
+	if len(i.Overrides.DNSOptions) > 0 {
+		containerOptions.HostConfig.DNSOptions = i.Overrides.DNSOptions
+		log.Debugf("RunContainer: HostConfig.DNSOptions => %v", i.Overrides.DNSOptions)
+	}
+
+	return containerOptions, commsExposedPorts
+}
+
+// ShowContainerPlan prints the container creation request the inspector will use
+func (i *Inspector) ShowContainerPlan() error {
+	containerOptions, _ := i.createContainerOptions()
+	return i.showContainerPlan(containerOptions)
+}
+
+func (i *Inspector) showContainerPlan(containerOptions *dockerclient.CreateContainerOptions) error {
+	//the secret env var values are never shown
+	if len(i.Overrides.SecretEnv) > 0 {
+		planOptions := *containerOptions
+		planConfig := *containerOptions.Config
+		planConfig.Env = append([]string{}, i.Overrides.Env...)
+		for _, envVar := range i.Overrides.SecretEnv {
+			planConfig.Env = append(planConfig.Env, strings.SplitN(envVar, "=", 2)[0]+"=<secret>")
+		}
+
+		planOptions.Config = &planConfig
+		containerOptions = &planOptions
+	}
+
+	planData, err := json.MarshalIndent(containerOptions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	i.Printer.Info(status.IDContainerPlan, "container.plan", "name=%v image=%v\n%s",
+		containerOptions.Name, containerOptions.Config.Image, string(planData))
+	return nil
+}
+
+// RunContainer starts the container inspector instance execution
+// (the container startup is retried when it fails with the transient errors)
+func (i *Inspector) RunContainer() error {
+	i.monitorContainerEvents()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = i.startContainer(attempt)
+		if err == nil || attempt > i.Overrides.StartRetries || !isTransientStartError(err) {
+			break
+		}
+
+		if i.PrintState {
+			i.Printer.Info(status.IDContainerStartRetry, "container", "status=start.retry attempt=%v/%v error='%v'",
+				attempt, i.Overrides.StartRetries+1, err)
+		}
+
+		i.cleanupFailedStart()
+		time.Sleep(startRetryDelay)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	i.monitorContainerState(i.ContainerInfo.RestartCount)
+
+	if err = i.initContainerChannels(); err != nil {
+		return err
+	}
+
+	return i.startMonitor()
+}
+
+// startContainer creates and starts the container (with the new container and network names for the retries)
+func (i *Inspector) startContainer(attempt int) error {
+	containerOptions, commsExposedPorts := i.createContainerOptions()
+	if attempt > 1 {
+		i.setRetryNames(containerOptions, attempt)
+	}
+
+	if i.DoDebug {
+		if err := i.showContainerPlan(containerOptions); err != nil {
+			log.Warnf("RunContainer: error showing the container plan => %v", err)
+		}
+	}
+
+	if i.IsPodman {
+		i.createMountSourceDirs()
+	}
+
+	i.checkNamedVolumes()
+
+	if i.NetworkName != "" {
+		if err := i.createNetwork(); err != nil {
+			return err
+		}
+	}
+
+	containerInfo, err := i.APIClient.CreateContainer(*containerOptions)
 	if err != nil {
+		i.removeNetwork()
 		return err
 	}
 
 	i.ContainerID = containerInfo.ID
 
 	if i.PrintState {
-		fmt.Printf("%s info=container status=created id=%v\n", i.PrintPrefix, i.ContainerID)
+		i.Printer.Info(status.IDContainerCreated, "container", "status=created id=%v", i.ContainerID)
+	}
+
+	if i.CopyArtifacts {
+		containerArtifactsPath := path.Join(i.mountLocation(), ArtifactsDir)
+		if err := i.uploadSensor(i.containerSensorPath(), containerArtifactsPath); err != nil {
+			return err
+		}
+
+		if i.PrintState {
+			i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer", "status=sensor.uploaded id=%v", i.ContainerID)
+		}
+	}
+
+	if err := i.APIClient.StartContainer(i.ContainerID, nil); err != nil {
+		return err
+	}
+
+	if i.ContainerInfo, err = i.APIClient.InspectContainer(i.ContainerID); err != nil {
+		return err
+	}
+
+	errutil.FailWhen(i.ContainerInfo.NetworkSettings == nil, "docker-slim: error => no network info")
+	errutil.FailWhen(len(i.ContainerInfo.NetworkSettings.Ports) < len(commsExposedPorts), "docker-slim: error => missing comms ports")
+	log.Debugf("RunContainer: container NetworkSettings.Ports => %#v", i.ContainerInfo.NetworkSettings.Ports)
+
+	i.processContainerPorts()
+	return nil
+}
+
+// checkNamedVolumes warns about the missing named volumes
+// (Docker creates them, but they are empty, so the application doesn't see its data)
+func (i *Inspector) checkNamedVolumes() {
+	for _, volumeMount := range i.VolumeMounts {
+		if !volumeMount.IsVolume {
+			continue
+		}
+
+		_, err := i.APIClient.InspectVolume(volumeMount.Source)
+		switch {
+		case err == dockerapi.ErrNoSuchVolume:
+			if i.PrintState {
+				i.Printer.Info(status.IDContainerVolumeWarning, "container.volume.warning",
+					"volume=%v message='the named volume is missing (Docker will create an empty volume)'", volumeMount.Source)
+			}
+		case err != nil:
+			log.Debugf("checkNamedVolumes: error inspecting volume %v => %v", volumeMount.Source, err)
+		}
+	}
+}
+
+// monitorContainerEvents watches the Docker events to detect the target container crashes
+// (the command is stopped right away, so the probes don't keep calling the dead container)
+func (i *Inspector) monitorContainerEvents() {
+	if err := i.APIClient.AddEventListener(i.dockerEventCh); err != nil {
+		log.Warnf("monitorContainerEvents: error adding Docker event listener => %v", err)
 	}
 
-	i.APIClient.AddEventListener(i.dockerEventCh)
 	go func() {
+		oomKilled := false
 		for {
 			select {
 			case devent := <-i.dockerEventCh:
@@ -289,72 +588,425 @@ func (i *Inspector) RunContainer() error {
 					break
 				}
 
-				if devent.ID == i.ContainerID {
-					if devent.Status == "die" {
-						//TODO: update the docker client library to get the exit status to know if it really crashed
-						if i.PrintState {
-							fmt.Printf("%s info=container status=crashed id=%v\n", i.PrintPrefix, i.ContainerID)
-						}
-
-						i.showContainerLogs()
+				if devent.ID != i.ContainerID {
+					break
+				}
 
-						if i.PrintState {
-							fmt.Printf("%s state=exited version=%s\n", i.PrintPrefix, v.Current())
-						}
-						os.Exit(-123)
-					}
+				switch devent.Status {
+				case dockerEventOOM:
+					log.Debugf("monitorContainerEvents: target container OOM event => %v", i.ContainerID)
+					oomKilled = true
+				case dockerEventDie:
+					i.onContainerExit(oomKilled, false)
+				case dockerEventRestart:
+					i.onContainerExit(oomKilled, true)
 				}
 
 			case <-i.dockerEventStopCh:
-				log.Debug("RunContainer: Docker event monitor stopped")
+				log.Debug("monitorContainerEvents: Docker event monitor stopped")
 				return
 			}
 		}
 	}()
+}
 
-	if err := i.APIClient.StartContainer(i.ContainerID, nil); err != nil {
-		return err
-	}
+// monitorContainerState polls the target container state to detect the container exits and restarts
+// (the Docker event listener can miss events or fail to connect)
+func (i *Inspector) monitorContainerState(restartCount int) {
+	stopCh := i.dockerEventStopCh
+	go func() {
+		ticker := time.NewTicker(containerStatePollInterval)
+		defer ticker.Stop()
 
-	if i.ContainerInfo, err = i.APIClient.InspectContainer(i.ContainerID); err != nil {
-		return err
-	}
+		for {
+			select {
+			case <-ticker.C:
+				containerInfo, err := i.APIClient.InspectContainer(i.ContainerID)
+				if err != nil {
+					log.Debugf("monitorContainerState: error inspecting container => %v", err)
+					continue
+				}
 
-	errutil.FailWhen(i.ContainerInfo.NetworkSettings == nil, "docker-slim: error => no network info")
-	errutil.FailWhen(len(i.ContainerInfo.NetworkSettings.Ports) < len(commsExposedPorts), "docker-slim: error => missing comms ports")
-	log.Debugf("RunContainer: container NetworkSettings.Ports => %#v", i.ContainerInfo.NetworkSettings.Ports)
+				select {
+				case <-stopCh:
+					//the container is stopped by docker-slim
+					return
+				default:
+				}
 
-	if len(i.ContainerInfo.NetworkSettings.Ports) > 2 {
-		portKeys := make([]string, 0, len(i.ContainerInfo.NetworkSettings.Ports)-2)
-		portList := make([]string, 0, len(i.ContainerInfo.NetworkSettings.Ports)-2)
-		for pk, pbinding := range i.ContainerInfo.NetworkSettings.Ports {
-			if pk != i.CmdPort && pk != i.EvtPort {
-				var portInfo string
-				if len(pbinding) > 0 {
-					portInfo = fmt.Sprintf("%v => %v:%v", pk, pbinding[0].HostIP, pbinding[0].HostPort)
-					portList = append(portList, string(pbinding[0].HostPort))
-				} else {
-					portInfo = string(pk)
+				switch {
+				case containerInfo.RestartCount > restartCount || containerInfo.State.Restarting:
+					i.onContainerExit(false, true)
+				case !containerInfo.State.Running:
+					i.onContainerExit(false, false)
 				}
 
-				portKeys = append(portKeys, portInfo)
+			case <-stopCh:
+				log.Debug("monitorContainerState: container state monitor stopped")
+				return
 			}
 		}
+	}()
+}
+
+// onContainerExit reports the unexpected target container exit (or restart) and terminates docker-slim
+// (it runs once, even if the exit is detected by both container monitors)
+func (i *Inspector) onContainerExit(oomKilled, restarted bool) {
+	i.crashOnce.Do(func() {
+		i.handleContainerExit(oomKilled, restarted)
+	})
+}
 
-		i.ContainerPortList = strings.Join(portList, ",")
-		i.ContainerPortsInfo = strings.Join(portKeys, ",")
+func (i *Inspector) handleContainerExit(oomKilled, restarted bool) {
+	exitErr := &ContainerExitError{
+		ContainerID: i.ContainerID,
+		OOMKilled:   oomKilled,
+		Restarted:   restarted,
 	}
 
-	if err = i.initContainerChannels(); err != nil {
-		return err
+	if containerInfo, err := i.APIClient.InspectContainer(i.ContainerID); err == nil {
+		exitErr.ExitCode = containerInfo.State.ExitCode
+		exitErr.OOMKilled = exitErr.OOMKilled || containerInfo.State.OOMKilled
+	} else {
+		log.Debugf("onContainerExit: error inspecting container => %v", err)
 	}
 
-	cmd := &command.StartMonitor{
-		AppName: i.FatContainerCmd[0],
+	if i.PrintState {
+		i.Printer.Info(status.IDContainerCrashed, "container", "status=crashed id=%v exit.code=%v oom.killed=%v restarted=%v",
+			i.ContainerID, exitErr.ExitCode, exitErr.OOMKilled, exitErr.Restarted)
+		if exitErr.OOMKilled {
+			i.Printer.Info(status.IDContainerCrashHint, "container.crash.hint",
+				"message='the target container ran out of memory (check the memory limits of the container and of the Docker host)'")
+		}
+	}
+
+	if stdout, stderr, err := i.containerLogs(); err == nil {
+		printContainerLogs(stdout, stderr)
+		exitErr.Stdout = logTail(stdout)
+		exitErr.Stderr = logTail(stderr)
+	} else {
+		log.Infof("error getting container logs => %v - %v", i.ContainerID, err)
 	}
 
-	if len(i.FatContainerCmd) > 1 {
-		cmd.AppArgs = i.FatContainerCmd[1:]
+	if i.NetworkID != "" {
+		//the crashed container is not removed, so it needs to be disconnected from the network
+		i.connectedContainers = append(i.connectedContainers, i.ContainerID)
+		i.removeNetwork()
+	}
+
+	if i.CrashHandler != nil {
+		i.CrashHandler(exitErr)
+	}
+
+	if i.PrintState {
+		i.Printer.Exited()
+	}
+
+	os.Exit(ContainerCrashExitCode)
+}
+
+// processContainerPorts collects the target container port information (without the sensor comms ports)
+func (i *Inspector) processContainerPorts() {
+	var portKeys []string
+	var portList []string
+	for pk, pbinding := range i.ContainerInfo.NetworkSettings.Ports {
+		if pk == i.CmdPort || pk == i.EvtPort {
+			continue
+		}
+
+		var portInfo string
+		if len(pbinding) > 0 {
+			portInfo = fmt.Sprintf("%v => %v:%v", pk, pbinding[0].HostIP, pbinding[0].HostPort)
+			portList = append(portList, string(pbinding[0].HostPort))
+		} else {
+			portInfo = string(pk)
+		}
+
+		portKeys = append(portKeys, portInfo)
+	}
+
+	i.ContainerPortList = strings.Join(portList, ",")
+	i.ContainerPortsInfo = strings.Join(portKeys, ",")
+}
+
+// the capabilities the sensor needs when the container is not privileged
+// (fanotify needs SYS_ADMIN, ptrace needs SYS_PTRACE and the process event connector needs NET_ADMIN)
+var sensorCapabilities = []string{"SYS_ADMIN", "SYS_PTRACE", "NET_ADMIN"}
+
+// setCapabilities applies the capability overrides
+// (the container is privileged if there are no capability overrides).
+// The sensor capabilities are always added (the sensor drops the ones
+// that are not in the capability overrides before it starts the target app).
+func setCapabilities(hostConfig *dockerclient.HostConfig, overrides *config.ContainerOverrides) {
+	if overrides == nil || (len(overrides.CapAdd) == 0 && len(overrides.CapDrop) == 0) {
+		return
+	}
+
+	isSensorCap := map[string]bool{}
+	for _, name := range sensorCapabilities {
+		isSensorCap[name] = true
+	}
+
+	hostConfig.Privileged = false
+	hostConfig.CapAdd = append([]string{}, sensorCapabilities...)
+	for _, name := range overrides.CapAdd {
+		if !isSensorCap[name] {
+			hostConfig.CapAdd = append(hostConfig.CapAdd, name)
+		}
+	}
+
+	hostConfig.CapDrop = nil
+	for _, name := range overrides.CapDrop {
+		if isSensorCap[name] {
+			log.Warnf("setCapabilities: keeping %v (the sensor needs it)", name)
+			continue
+		}
+
+		hostConfig.CapDrop = append(hostConfig.CapDrop, name)
+	}
+
+	//the default seccomp and AppArmor profiles block the sensor syscalls
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp=unconfined", "apparmor=unconfined")
+	log.Debugf("setCapabilities: cap.add=%v cap.drop=%v", hostConfig.CapAdd, hostConfig.CapDrop)
+}
+
+// appDropCapabilities returns the sensor capabilities the target app doesn't get
+// (the sensor capabilities that are added only for the sensor with the capability overrides)
+func appDropCapabilities(overrides *config.ContainerOverrides) []string {
+	if overrides == nil || overrides.Privileged || (len(overrides.CapAdd) == 0 && len(overrides.CapDrop) == 0) {
+		return nil
+	}
+
+	isAppCap := map[string]bool{}
+	for _, name := range overrides.CapAdd {
+		isAppCap[name] = true
+	}
+
+	var dropCaps []string
+	for _, name := range sensorCapabilities {
+		if !isAppCap[name] && !isAppCap["ALL"] {
+			dropCaps = append(dropCaps, name)
+		}
+	}
+
+	return dropCaps
+}
+
+// networkingConfig returns the endpoint configuration for the user-defined network
+// (the static addresses and the network aliases) or nil if there's nothing to configure
+func networkingConfig(overrides *config.ContainerOverrides) *dockerclient.NetworkingConfig {
+	if overrides.NetworkIPv4 == "" && overrides.NetworkIPv6 == "" && len(overrides.NetworkAliases) == 0 {
+		return nil
+	}
+
+	endpoint := &dockerclient.EndpointConfig{
+		Aliases: overrides.NetworkAliases,
+	}
+
+	if overrides.NetworkIPv4 != "" || overrides.NetworkIPv6 != "" {
+		endpoint.IPAMConfig = &dockerclient.EndpointIPAMConfig{
+			IPv4Address: overrides.NetworkIPv4,
+			IPv6Address: overrides.NetworkIPv6,
+		}
+	}
+
+	return &dockerclient.NetworkingConfig{
+		EndpointsConfig: map[string]*dockerclient.EndpointConfig{
+			overrides.Network: endpoint,
+		},
+	}
+}
+
+// publishPorts publishes the container ports on the specific host ports
+// (the published ports are also exposed, the other exposed ports still get the random host ports)
+func publishPorts(containerOptions *dockerclient.CreateContainerOptions, overrides *config.ContainerOverrides) {
+	if overrides == nil || len(overrides.PortBindings) == 0 {
+		return
+	}
+
+	//a new map (the exposed ports may be the override map)
+	exposedPorts := map[dockerapi.Port]struct{}{}
+	for port := range containerOptions.Config.ExposedPorts {
+		exposedPorts[port] = struct{}{}
+	}
+
+	for port := range overrides.PortBindings {
+		exposedPorts[port] = struct{}{}
+	}
+
+	containerOptions.Config.ExposedPorts = exposedPorts
+	containerOptions.HostConfig.PortBindings = overrides.PortBindings
+
+	log.Debugf("publishPorts: port bindings => %+v", overrides.PortBindings)
+}
+
+// setSecurityOverrides applies the privileged mode, namespace mode and security option passthrough overrides
+// (they are not used for the profiles check container, they'd disable the checked profiles)
+func setSecurityOverrides(hostConfig *dockerclient.HostConfig, overrides *config.ContainerOverrides) {
+	if overrides == nil {
+		return
+	}
+
+	if overrides.Privileged {
+		hostConfig.Privileged = true
+	}
+
+	hostConfig.IpcMode = overrides.IpcMode
+	hostConfig.PidMode = overrides.PidMode
+
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, overrides.SecurityOpts...)
+}
+
+// SecurityWarnings returns the warnings for the container overrides
+// that make the container analyzing image less isolated than the containers in production
+func SecurityWarnings(overrides *config.ContainerOverrides) []string {
+	if overrides == nil {
+		return nil
+	}
+
+	var warnings []string
+	if overrides.Privileged {
+		message := "the container runs in the privileged mode (it has all capabilities and it can access all host devices)"
+		if len(overrides.CapAdd) > 0 || len(overrides.CapDrop) > 0 {
+			message += ", the cap-add and cap-drop overrides have no effect"
+		}
+
+		warnings = append(warnings, message)
+	}
+
+	if overrides.IpcMode == "host" {
+		warnings = append(warnings, "the container uses the host IPC namespace")
+	}
+
+	if overrides.PidMode == "host" {
+		warnings = append(warnings, "the container uses the host PID namespace (it can see all host processes)")
+	}
+
+	for _, opt := range overrides.SecurityOpts {
+		warnings = append(warnings, fmt.Sprintf("the container uses the '%s' security option", opt))
+	}
+
+	return warnings
+}
+
+// setDevices adds the host devices and the GPUs to the container
+// (the GPU and hardware accelerated applications fail to start without them)
+func setDevices(hostConfig *dockerclient.HostConfig, overrides *config.ContainerOverrides) {
+	if overrides == nil {
+		return
+	}
+
+	hostConfig.Devices = overrides.Devices
+	hostConfig.DeviceRequests = overrides.DeviceRequests
+	if len(hostConfig.Devices) > 0 || len(hostConfig.DeviceRequests) > 0 {
+		log.Debugf("setDevices: devices=%+v device.requests=%+v", hostConfig.Devices, hostConfig.DeviceRequests)
+	}
+}
+
+// the writable temporary data directories for the read-only root filesystem
+var readOnlyRootfsTmpfs = map[string]string{
+	"/tmp":     "rw,exec,mode=1777",
+	"/var/tmp": "rw,exec,mode=1777",
+	"/run":     "rw,mode=755",
+}
+
+// containerTmpfs returns the tmpfs mounts for the container
+// (the temporary data directories are added for the read-only root filesystem unless they are already there)
+func containerTmpfs(overrides *config.ContainerOverrides) map[string]string {
+	if !overrides.ReadOnlyRootfs {
+		return overrides.Tmpfs
+	}
+
+	mounts := map[string]string{}
+	for mountPath, options := range readOnlyRootfsTmpfs {
+		mounts[mountPath] = options
+	}
+
+	for mountPath, options := range overrides.Tmpfs {
+		mounts[mountPath] = options
+	}
+
+	return mounts
+}
+
+// containerLabels returns the labels for the docker-slim containers
+// (the docker-slim container type label can't be overridden)
+func containerLabels(overrides *config.ContainerOverrides) map[string]string {
+	labels := map[string]string{}
+	for k, v := range overrides.Labels {
+		labels[k] = v
+	}
+
+	labels["type"] = LabelName
+	return labels
+}
+
+// secretBinds returns the read-only volume binds for the secret files
+func secretBinds(overrides *config.ContainerOverrides) []string {
+	var binds []string
+	for _, secretFile := range overrides.SecretFiles {
+		binds = append(binds, fmt.Sprintf("%s:%s:ro", dockerhost.MountSource(secretFile.Source), secretFile.Destination))
+	}
+
+	return binds
+}
+
+// containerEnv returns the container env vars (with the secret env vars)
+func containerEnv(overrides *config.ContainerOverrides) []string {
+	if len(overrides.SecretEnv) == 0 {
+		return overrides.Env
+	}
+
+	return append(append([]string{}, overrides.Env...), overrides.SecretEnv...)
+}
+
+// hasEnvVar returns true if the env var is set in the 'NAME=value' list
+func hasEnvVar(name string, env []string) bool {
+	for _, envVar := range env {
+		if strings.SplitN(envVar, "=", 2)[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the CPU quota period for the '--cpus' limit (the Docker default period)
+const cpuPeriod = 100000
+
+// setResourceLimits sets the container resource limits (memory, CPU, pids, shm size and ulimits)
+func setResourceLimits(hostConfig *dockerclient.HostConfig, overrides *config.ContainerOverrides) {
+	if overrides == nil {
+		return
+	}
+
+	hostConfig.Memory = overrides.Memory
+	hostConfig.MemorySwap = overrides.MemorySwap
+	hostConfig.CPUShares = overrides.CPUShares
+	hostConfig.PidsLimit = overrides.PidsLimit
+	hostConfig.ShmSize = overrides.ShmSize
+	hostConfig.Ulimits = overrides.Ulimits
+	if overrides.CPUs > 0 {
+		hostConfig.CPUPeriod = cpuPeriod
+		hostConfig.CPUQuota = int64(overrides.CPUs * cpuPeriod)
+	}
+
+	log.Debugf("setResourceLimits: memory=%v memory.swap=%v cpu.shares=%v cpus=%v pids=%v shm=%v ulimits=%+v",
+		overrides.Memory, overrides.MemorySwap, overrides.CPUShares, overrides.CPUs, overrides.PidsLimit,
+		overrides.ShmSize, overrides.Ulimits)
+}
+
+// startMonitor sends the 'start monitor' command to the sensor and waits for the sensor to start monitoring
+func (i *Inspector) startMonitor() error {
+	cmd := &command.StartMonitor{}
+	if i.TargetContainer != "" {
+		//the main process of the running container
+		cmd.AttachPid = targetContainerPid
+	} else {
+		cmd.AppName = i.FatContainerCmd[0]
+		if len(i.FatContainerCmd) > 1 {
+			cmd.AppArgs = i.FatContainerCmd[1:]
+		}
 	}
 
 	if len(i.ExcludePaths) > 0 {
@@ -365,6 +1017,10 @@ func (i *Inspector) RunContainer() error {
 		cmd.Includes = pathMapKeys(i.IncludePaths)
 	}
 
+	if len(i.IncludePathMaps) > 0 {
+		cmd.IncludeMaps = i.IncludePathMaps
+	}
+
 	if len(i.IncludeBins) > 0 {
 		cmd.IncludeBins = pathMapKeys(i.IncludeBins)
 	}
@@ -374,18 +1030,43 @@ func (i *Inspector) RunContainer() error {
 	}
 
 	cmd.IncludeShell = i.DoIncludeShell
+	cmd.IncludeZoneinfo = i.DoIncludeZoneinfo
+	cmd.IncludeLocales = i.IncludeLocales
+	cmd.DetectSecrets = i.DoDetectSecrets
+	cmd.ExcludeSecrets = i.DoExcludeSecrets
+	for _, secretFile := range i.Overrides.SecretFiles {
+		cmd.SecretPaths = append(cmd.SecretPaths, secretFile.Destination)
+	}
+
+	//the GPU runtime hooks mount the host driver files (they must not be in the minified image)
+	cmd.ExcludeDeviceMounts = len(i.Overrides.DeviceRequests) > 0
 
-	if runAsUser != "" {
+	if runAsUser := i.ImageInspector.ImageInfo.Config.User; runAsUser != "" {
 		cmd.AppUser = runAsUser
 	}
 
-	_, err = ipc.SendContainerCmd(cmd)
+	//only the explicit user override changes the user the app runs as (the sensor starts it as root otherwise)
+	if i.Overrides.User != "" {
+		cmd.AppUser = i.Overrides.User
+		cmd.RunAsUser = true
+		cmd.KeepHome = hasEnvVar("HOME", i.ImageInspector.ImageInfo.Config.Env) || hasEnvVar("HOME", containerEnv(i.Overrides))
+	}
+
+	cmd.AppStopSignal = i.ImageInspector.ImageInfo.Config.StopSignal
+	if i.Overrides.StopSignal != "" {
+		cmd.AppStopSignal = i.Overrides.StopSignal
+	}
+
+	cmd.AppStopTimeout = i.Overrides.StopTimeout
+	cmd.AppDropCaps = appDropCapabilities(i.Overrides)
+
+	_, err := ipc.SendContainerCmd(cmd)
 	if err != nil {
 		return err
 	}
 
 	if i.PrintState {
-		fmt.Printf("%s info=cmd.startmonitor status=sent\n", i.PrintPrefix)
+		i.Printer.Info(status.IDStartMonitorSent, "cmd.startmonitor", "status=sent")
 	}
 
 	for idx := 0; idx < 3; idx++ {
@@ -395,7 +1076,7 @@ func (i *Inspector) RunContainer() error {
 		if err != nil {
 			if err.Error() == IpcErrRecvTimeoutStr {
 				if i.PrintState {
-					fmt.Printf("%s info=event.startmonitor.done status=receive.timeout\n", i.PrintPrefix)
+					i.Printer.Info(status.IDStartMonitorDone, "event.startmonitor.done", "status=receive.timeout")
 				}
 
 				log.Debug("timeout waiting for the docker-slim container to start...")
@@ -412,15 +1093,16 @@ func (i *Inspector) RunContainer() error {
 
 		if evt.Name == event.StartMonitorDone {
 			if i.PrintState {
-				fmt.Printf("%s info=event.startmonitor.done status=received\n", i.PrintPrefix)
+				i.Printer.Info(status.IDStartMonitorDone, "event.startmonitor.done", "status=received")
 			}
 			return nil
 		}
 
 		if evt.Name == event.Error {
 			if i.PrintState {
-				fmt.Printf("%s info=event.error status=received data=%s\n", i.PrintPrefix, evt.Data)
-				fmt.Printf("%s state=exited version=%s\n", i.PrintPrefix, v.Current())
+				i.Printer.Info(status.IDSensorError, "event.error", "status=received data=%s", evt.Data)
+				i.showPodmanSensorErrorHint(fmt.Sprintf("%v", evt.Data))
+				i.Printer.Exited()
 			}
 
 			os.Exit(-124)
@@ -428,7 +1110,7 @@ func (i *Inspector) RunContainer() error {
 
 		if evt.Name != event.StartMonitorDone {
 			if i.PrintState {
-				fmt.Printf("%s info=event.startmonitor.done status=received.unexpected data=%+v\n", i.PrintPrefix, evt)
+				i.Printer.Info(status.IDStartMonitorDone, "event.startmonitor.done", "status=received.unexpected data=%+v", evt)
 			}
 			return event.ErrUnexpectedEvent
 		}
@@ -438,6 +1120,17 @@ func (i *Inspector) RunContainer() error {
 }
 
 func (i *Inspector) showContainerLogs() {
+	stdout, stderr, err := i.containerLogs()
+	if err != nil {
+		log.Infof("error getting container logs => %v - %v", i.ContainerID, err)
+		return
+	}
+
+	printContainerLogs(stdout, stderr)
+}
+
+// containerLogs returns the container stdout and stderr logs
+func (i *Inspector) containerLogs() (string, string, error) {
 	var outData bytes.Buffer
 	outw := bufio.NewWriter(&outData)
 	var errData bytes.Buffer
@@ -452,18 +1145,30 @@ func (i *Inspector) showContainerLogs() {
 		Stderr:       true,
 	}
 
-	err := i.APIClient.Logs(logsOptions)
-	if err != nil {
-		log.Infof("error getting container logs => %v - %v", i.ContainerID, err)
-	} else {
-		outw.Flush()
-		errw.Flush()
-		fmt.Println("docker-slim: container stdout:")
-		outData.WriteTo(os.Stdout)
-		fmt.Println("docker-slim: container stderr:")
-		errData.WriteTo(os.Stdout)
-		fmt.Println("docker-slim: end of container logs =============")
+	if err := i.APIClient.Logs(logsOptions); err != nil {
+		return "", "", err
+	}
+
+	outw.Flush()
+	errw.Flush()
+	return outData.String(), errData.String(), nil
+}
+
+func printContainerLogs(stdout, stderr string) {
+	fmt.Println("docker-slim: container stdout:")
+	fmt.Print(stdout)
+	fmt.Println("docker-slim: container stderr:")
+	fmt.Print(stderr)
+	fmt.Println("docker-slim: end of container logs =============")
+}
+
+// logTail returns the end of the log (the last lines usually explain why the container exited)
+func logTail(data string) string {
+	if len(data) <= maxCrashLogSize {
+		return data
 	}
+
+	return data[len(data)-maxCrashLogSize:]
 }
 
 // ShutdownContainer terminates the container inspector instance execution
@@ -474,7 +1179,14 @@ func (i *Inspector) ShutdownContainer() error {
 		i.showContainerLogs()
 	}
 
-	err := i.APIClient.StopContainer(i.ContainerID, 9)
+	if i.TargetContainer != "" {
+		//the running target container is not managed by docker-slim (only the uploaded sensor files are removed)
+		log.Debugf("ShutdownContainer: keeping the target container running => %v", i.ContainerID)
+		i.removeSensorFiles()
+		return nil
+	}
+
+	err := i.APIClient.StopContainer(i.ContainerID, i.stopTimeout())
 
 	if _, ok := err.(*dockerapi.ContainerNotRunning); ok {
 		log.Info("can't stop the docker-slim container (container is not running)...")
@@ -492,14 +1204,114 @@ func (i *Inspector) ShutdownContainer() error {
 		log.Info("error removing container =>", err)
 	}
 
+	i.removeNetwork()
 	return nil
 }
 
+// the default 'docker stop' timeout (seconds) for the docker-slim containers
+const defaultStopTimeout = 9
+
+// stopTimeout returns the 'docker stop' timeout for the container
+// (the app stop timeout, so the app has the same time to exit)
+func (i *Inspector) stopTimeout() uint {
+	if i.Overrides.StopTimeout > defaultStopTimeout {
+		return uint(i.Overrides.StopTimeout)
+	}
+
+	return defaultStopTimeout
+}
+
+// createNetwork creates the isolated bridge network for the target container
+// and connects the linked containers to it (the links work only with the containers on the same network)
+func (i *Inspector) createNetwork() error {
+	network, err := i.APIClient.CreateNetwork(dockerclient.CreateNetworkOptions{
+		Name:           i.NetworkName,
+		Driver:         NetworkDriver,
+		CheckDuplicate: true,
+		Labels:         map[string]string{"type": LabelName},
+	})
+	if err != nil {
+		return err
+	}
+
+	i.NetworkID = network.ID
+	log.Debugf("RunContainer: created network %v (id=%v)", i.NetworkName, i.NetworkID)
+
+	if i.PrintState {
+		i.Printer.Info(status.IDNetworkCreated, "network", "status=created name=%v id=%v", i.NetworkName, i.NetworkID)
+	}
+
+	for _, link := range i.Links {
+		linkedContainer := strings.SplitN(link, ":", 2)[0]
+		err := i.APIClient.ConnectNetwork(i.NetworkID, dockerclient.NetworkConnectionOptions{
+			Container: linkedContainer,
+		})
+		if err != nil {
+			i.removeNetwork()
+			return fmt.Errorf("error connecting linked container %s to network %s - %v", linkedContainer, i.NetworkName, err)
+		}
+
+		i.connectedContainers = append(i.connectedContainers, linkedContainer)
+	}
+
+	return nil
+}
+
+// removeNetwork disconnects the linked containers from the isolated network and removes it
+func (i *Inspector) removeNetwork() {
+	if i.NetworkID == "" {
+		return
+	}
+
+	for _, linkedContainer := range i.connectedContainers {
+		err := i.APIClient.DisconnectNetwork(i.NetworkID, dockerclient.NetworkConnectionOptions{
+			Container: linkedContainer,
+			Force:     true,
+		})
+		if err != nil {
+			log.Infof("error disconnecting linked container %v from network %v => %v", linkedContainer, i.NetworkName, err)
+		}
+	}
+
+	i.connectedContainers = nil
+
+	if err := i.APIClient.RemoveNetwork(i.NetworkID); err != nil {
+		log.Infof("error removing network %v => %v", i.NetworkName, err)
+		return
+	}
+
+	log.Debugf("removed network %v (id=%v)", i.NetworkName, i.NetworkID)
+	i.NetworkID = ""
+}
+
+// TerminateContainer stops the container monitoring without waiting for the sensor and removes the container
+func (i *Inspector) TerminateContainer() error {
+	if i.dockerEventStopCh != nil {
+		close(i.dockerEventStopCh)
+		i.dockerEventStopCh = nil
+	}
+
+	if i.TargetContainer != "" {
+		//stop the sensor, so it detaches from the target app
+		if _, err := ipc.SendContainerCmd(&command.ShutdownSensor{}); err != nil {
+			log.Debugf("TerminateContainer: error sending 'shutdown' => '%v'", err)
+		}
+	}
+
+	return i.ShutdownContainer()
+}
+
 // FinishMonitoring ends the target container monitoring activities
 func (i *Inspector) FinishMonitoring() {
 	close(i.dockerEventStopCh)
 	i.dockerEventStopCh = nil
 
+	if i.CopyArtifacts {
+		defer func() {
+			errutil.WarnOn(i.downloadArtifacts())
+		}()
+	}
+
 	cmdResponse, err := ipc.SendContainerCmd(&command.StopMonitor{})
 	errutil.WarnOn(err)
 	//_ = cmdResponse
@@ -507,10 +1319,18 @@ func (i *Inspector) FinishMonitoring() {
 
 	log.Info("waiting for the container to finish its work...")
 
-	//for now there's only one event ("done")
+	//the sensor publishes the artifact progress events before the "done" event
 	//getEvt() should timeout in two minutes (todo: pick a good timeout)
 	evt, err := ipc.GetContainerEvt()
 	log.Debugf("sensor event => '%v'", evt)
+	for err == nil && evt != nil && evt.Name == event.ArtifactsProgress {
+		if data, ok := evt.Data.(*event.ArtifactsProgressData); ok && i.ArtifactsProgress != nil {
+			i.ArtifactsProgress(data.Files, data.TotalFiles, data.Bytes, 0)
+		}
+
+		evt, err = ipc.GetContainerEvt()
+		log.Debugf("sensor event => '%v'", evt)
+	}
 
 	//don't want to expose mangos here... mangos.ErrRecvTimeout = errors.New("receive time out")
 	if err != nil && err.Error() == IpcErrRecvTimeoutStr {
@@ -556,6 +1376,23 @@ func (i *Inspector) shutdownContainerChannels() {
 	ipc.ShutdownContainerChannels()
 }
 
+// removeSecretFiles makes sure the runtime secret files are not in the collected data
+// (the sensor never saves them, this is a safety net)
+func (i *Inspector) removeSecretFiles() {
+	dataDir := filepath.Join(i.ImageInspector.ArtifactLocation, "files")
+	for _, secretFile := range i.Overrides.SecretFiles {
+		filePath := filepath.Join(dataDir, filepath.FromSlash(secretFile.Destination))
+		if !fsutil.Exists(filePath) {
+			continue
+		}
+
+		log.Warnf("removeSecretFiles: removing secret file from the collected data - %v", secretFile.Destination)
+		if err := os.RemoveAll(filePath); err != nil {
+			log.Errorf("removeSecretFiles: error removing %v - %v", filePath, err)
+		}
+	}
+}
+
 // HasCollectedData returns true if any data was produced monitoring the target container
 func (i *Inspector) HasCollectedData() bool {
 	return fsutil.Exists(filepath.Join(i.ImageInspector.ArtifactLocation, report.DefaultContainerReportFileName))
@@ -563,11 +1400,13 @@ func (i *Inspector) HasCollectedData() bool {
 
 // ProcessCollectedData performs post-processing on the collected container data
 func (i *Inspector) ProcessCollectedData() error {
+	i.removeSecretFiles()
+
 	log.Info("generating AppArmor profile...")
-	err := apparmor.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName)
+	err := apparmor.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName, i.AppArmorOptions)
 	if err != nil {
 		return err
 	}
 
-	return seccomp.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.SeccompProfileName)
+	return seccomp.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.SeccompProfileName, i.SeccompBaseline, i.SeccompOptions)
 }
@@ -0,0 +1,65 @@
+package container
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Container health status values (reported by Docker for the containers with a HEALTHCHECK)
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+const healthPollInterval = time.Second
+
+// WaitForHealthChecks polls the target container HEALTHCHECK status until the container
+// is 'healthy' and it has at least 'count' successful health checks (counted from the first check,
+// so the next calls continue counting). It fails if the image doesn't have a HEALTHCHECK,
+// if the container becomes 'unhealthy' or if it doesn't get the healthy checks before the timeout.
+func (i *Inspector) WaitForHealthChecks(count int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		containerInfo, err := i.APIClient.InspectContainer(i.ContainerID)
+		if err != nil {
+			return err
+		}
+
+		health := containerInfo.State.Health
+		if health.Status == "" {
+			return fmt.Errorf("target container doesn't have a HEALTHCHECK")
+		}
+
+		//Docker keeps only the last few checks, so the checks are counted as they show up
+		for _, check := range health.Log {
+			if !check.Start.After(i.lastHealthCheck) {
+				continue
+			}
+
+			i.lastHealthCheck = check.Start
+			if check.ExitCode == 0 {
+				i.healthyChecks++
+			}
+		}
+
+		log.Debugf("WaitForHealthChecks: status=%v healthy.checks=%v/%v", health.Status, i.healthyChecks, count)
+		switch health.Status {
+		case HealthUnhealthy:
+			return fmt.Errorf("target container is unhealthy (failing streak: %v)", health.FailingStreak)
+		case HealthHealthy:
+			if i.healthyChecks >= count {
+				return nil
+			}
+		}
+
+		if timeout > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("target container has %v of %v healthy checks after %v (health status: %v)",
+				i.healthyChecks, count, timeout, health.Status)
+		}
+
+		time.Sleep(healthPollInterval)
+	}
+}
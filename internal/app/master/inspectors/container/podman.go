@@ -0,0 +1,47 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// createMountSourceDirs creates the missing host directories for the volume binds
+// (Docker creates them automatically, but Podman fails to create the container)
+func (i *Inspector) createMountSourceDirs() {
+	if dockerhost.IsSSH() {
+		return
+	}
+
+	for _, volumeMount := range i.VolumeMounts {
+		//named volumes are managed by Podman
+		if volumeMount.IsVolume || !filepath.IsAbs(volumeMount.Source) {
+			continue
+		}
+
+		if _, err := os.Stat(volumeMount.Source); os.IsNotExist(err) {
+			log.Debugf("createMountSourceDirs: creating the mount source directory => %v", volumeMount.Source)
+			if err := os.MkdirAll(volumeMount.Source, 0755); err != nil {
+				log.Warnf("createMountSourceDirs: error creating the mount source directory %v => %v", volumeMount.Source, err)
+			}
+		}
+	}
+}
+
+// showPodmanSensorErrorHint explains the sensor errors that are caused by the rootless Podman limitations
+// (the sensor needs fanotify, which is not available in the rootless containers)
+func (i *Inspector) showPodmanSensorErrorHint(errorData string) {
+	if !i.IsPodman || !strings.Contains(errorData, "fanotify") {
+		return
+	}
+
+	i.Printer.Info(status.IDSensorErrorHint, "event.error.hint",
+		"message='the sensor can not monitor the file activity in the rootless Podman containers (use the rootful Podman socket: --host unix://%s)'",
+		dockerclient.PodmanRootfulSocket)
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 
 	log "github.com/Sirupsen/logrus"
 	dockerapi "github.com/cloudimmunity/go-dockerclientx"
@@ -24,11 +25,11 @@ const (
 // CustomProbe is a custom HTTP probe
 type CustomProbe struct {
 	PrintState         bool
-	PrintPrefix        string
+	Printer            *status.Printer
 	Ports              []string
 	Cmds               []config.HTTPProbeCmd
 	RetryCount         int
-	RetryWait          int
+	RetryWait          time.Duration
 	TargetPorts        []uint16
 	ProbeFull          bool
 	ContainerInspector *container.Inspector
@@ -39,16 +40,16 @@ type CustomProbe struct {
 func NewCustomProbe(inspector *container.Inspector,
 	cmds []config.HTTPProbeCmd,
 	retryCount int,
-	retryWait int,
+	retryWait time.Duration,
 	targetPorts []uint16,
 	probeFull bool,
 	printState bool,
-	printPrefix string) (*CustomProbe, error) {
+	printer *status.Printer) (*CustomProbe, error) {
 	//note: the default probe should already be there if the user asked for it
 
 	probe := &CustomProbe{
 		PrintState:         printState,
-		PrintPrefix:        printPrefix,
+		Printer:            printer,
 		Cmds:               cmds,
 		RetryCount:         retryCount,
 		RetryWait:          retryWait,
@@ -117,7 +118,7 @@ func NewCustomProbe(inspector *container.Inspector,
 // Start starts the HTTP probe instance execution
 func (p *CustomProbe) Start() {
 	if p.PrintState {
-		fmt.Printf("%s state=http.probe.starting message='WAIT FOR HTTP PROBE TO FINISH'\n", p.PrintPrefix)
+		p.Printer.State(status.IDProbeStarting, "http.probe.starting", "message='WAIT FOR HTTP PROBE TO FINISH'")
 	}
 
 	go func() {
@@ -125,7 +126,7 @@ func (p *CustomProbe) Start() {
 		time.Sleep(9 * time.Second)
 
 		if p.PrintState {
-			fmt.Printf("%s state=http.probe.running\n", p.PrintPrefix)
+			p.Printer.State(status.IDProbeRunning, "http.probe.running", "")
 		}
 
 		httpClient := &http.Client{
@@ -167,13 +168,13 @@ func (p *CustomProbe) Start() {
 						maxRetryCount = p.RetryCount
 					}
 
-					notReadyErrorWait := time.Duration(16)
-					webErrorWait := time.Duration(8)
-					otherErrorWait := time.Duration(4)
+					notReadyErrorWait := 16 * time.Second
+					webErrorWait := 8 * time.Second
+					otherErrorWait := 4 * time.Second
 					if p.RetryWait > 0 {
-						webErrorWait = time.Duration(p.RetryWait)
-						notReadyErrorWait = time.Duration(p.RetryWait * 2)
-						otherErrorWait = time.Duration(p.RetryWait / 2)
+						webErrorWait = p.RetryWait
+						notReadyErrorWait = p.RetryWait * 2
+						otherErrorWait = p.RetryWait / 2
 					}
 
 					for i := 0; i < maxRetryCount; i++ {
@@ -215,8 +216,7 @@ func (p *CustomProbe) Start() {
 						}
 
 						if p.PrintState {
-							fmt.Printf("%s info=http.probe.call status=%v method=%v target=%v attempt=%v %v time=%v\n",
-								p.PrintPrefix,
+							p.Printer.Info(status.IDProbeCall, "http.probe.call", "status=%v method=%v target=%v attempt=%v %v time=%v",
 								statusCode,
 								cmd.Method,
 								addr,
@@ -234,15 +234,15 @@ func (p *CustomProbe) Start() {
 							if urlErr, ok := err.(*url.Error); ok {
 								if urlErr.Err == io.EOF {
 									log.Debugf("HTTP probe - target not ready yet (retry again later)...")
-									time.Sleep(notReadyErrorWait * time.Second)
+									time.Sleep(notReadyErrorWait)
 								} else {
 									log.Debugf("HTTP probe - web error... retry again later...")
-									time.Sleep(webErrorWait * time.Second)
+									time.Sleep(webErrorWait)
 
 								}
 							} else {
 								log.Debugf("HTTP probe - other error... retry again later...")
-								time.Sleep(otherErrorWait * time.Second)
+								time.Sleep(otherErrorWait)
 							}
 						}
 
@@ -254,18 +254,17 @@ func (p *CustomProbe) Start() {
 		log.Info("HTTP probe done.")
 
 		if p.PrintState {
-			fmt.Printf("%s info=http.probe.summary total=%v failures=%v successful=%v\n",
-				p.PrintPrefix, callCount, errCount, okCount)
+			p.Printer.Info(status.IDProbeSummary, "http.probe.summary", "total=%v failures=%v successful=%v",
+				callCount, errCount, okCount)
 
-			warning := ""
 			switch {
 			case callCount == 0:
-				warning = "warning=no.calls"
+				p.Printer.State(status.IDProbeDone, "http.probe.done", "warning=no.calls")
 			case okCount == 0:
-				warning = "warning=no.successful.calls"
+				p.Printer.State(status.IDProbeDone, "http.probe.done", "warning=no.successful.calls")
+			default:
+				p.Printer.State(status.IDProbeDone, "http.probe.done", "")
 			}
-
-			fmt.Printf("%s state=http.probe.done %s\n", p.PrintPrefix, warning)
 		}
 
 		close(p.doneChan)
@@ -0,0 +1,368 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/util/errutil"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Profiles check constants
+const (
+	ProfilesCheckNamePat = "dockerslimk_check_%v_%v"
+	appArmorParser       = "apparmor_parser"
+	appArmorSecurityOpt  = "apparmor"
+	//the exit code of the processes killed with SIGSYS (the seccomp 'kill' and 'trap' actions)
+	exitCodeSIGSYS = 128 + 31
+)
+
+// the kernel audit record locations on the local Docker host
+var auditLogFiles = []string{
+	"/var/log/audit/audit.log",
+	"/var/log/kern.log",
+	"/var/log/syslog",
+	"/var/log/messages",
+}
+
+// the container log messages that usually mean a syscall or a file access was denied
+var denialLogPatterns = []string{
+	"Operation not permitted",
+	"Permission denied",
+	"Bad system call",
+	"Function not implemented",
+}
+
+var auditTimePat = regexp.MustCompile(`audit\((\d+)\.\d+:\d+\)`)
+
+// ProfilesCheckResult describes the profile denials found running the minified image
+type ProfilesCheckResult struct {
+	ContainerID      string
+	Running          bool
+	ExitCode         int
+	AppArmorApplied  bool
+	LogDenials       []string
+	AuditDenials     []string
+	AuditUnavailable bool
+}
+
+// Passed returns true if no denials were found and the container didn't crash
+func (r *ProfilesCheckResult) Passed() bool {
+	return (r.Running || r.ExitCode == 0) &&
+		len(r.LogDenials) == 0 &&
+		len(r.AuditDenials) == 0
+}
+
+// RunProfilesCheck starts the minified image with the generated seccomp and AppArmor profiles
+// (the container uses the same run parameters as the instrumented container, but it runs without the sensor).
+// The probes can use the inspector to reach the new container.
+func (i *Inspector) RunProfilesCheck(imageName string) error {
+	artifactLocation := i.ImageInspector.ArtifactLocation
+	seccompData, err := ioutil.ReadFile(filepath.Join(artifactLocation, i.ImageInspector.SeccompProfileName))
+	if err != nil {
+		return err
+	}
+
+	//the Docker API expects the profile content (not the profile file path)
+	var seccompProfile bytes.Buffer
+	if err := json.Compact(&seccompProfile, seccompData); err != nil {
+		return fmt.Errorf("invalid seccomp profile (%s): %v", i.ImageInspector.SeccompProfileName, err)
+	}
+
+	securityOpts := []string{fmt.Sprintf("seccomp=%s", seccompProfile.String())}
+	if i.loadAppArmorProfile() {
+		securityOpts = append(securityOpts, fmt.Sprintf("%s=%s", appArmorSecurityOpt, i.ImageInspector.AppArmorProfileName))
+	}
+
+	var volumeBinds []string
+	for _, volumeMount := range i.VolumeMounts {
+		volumeBinds = append(volumeBinds, fmt.Sprintf("%s:%s:%s",
+			dockerhost.MountSource(volumeMount.Source), volumeMount.Destination, volumeMount.Options))
+	}
+
+	volumeBinds = append(volumeBinds, secretBinds(i.Overrides)...)
+
+	i.ContainerName = fmt.Sprintf(ProfilesCheckNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	containerOptions := dockerclient.CreateContainerOptions{
+		Name: i.ContainerName,
+		Config: &dockerclient.Config{
+			Config: dockerapi.Config{
+				Image:        imageName,
+				Env:          containerEnv(i.Overrides),
+				Labels:       containerLabels(i.Overrides),
+				Hostname:     i.Overrides.Hostname,
+				Domainname:   i.Overrides.Domainname,
+				WorkingDir:   i.Overrides.Workdir,
+				ExposedPorts: i.Overrides.ExposedPorts,
+			},
+			StopSignal: i.Overrides.StopSignal,
+		},
+		HostConfig: &dockerclient.HostConfig{
+			HostConfig: dockerapi.HostConfig{
+				Binds:           volumeBinds,
+				VolumesFrom:     i.Overrides.VolumesFrom,
+				ReadonlyRootfs:  i.Overrides.ReadOnlyRootfs,
+				PublishAllPorts: true,
+				SecurityOpt:     securityOpts,
+				NetworkMode:     i.Overrides.Network,
+				IpcMode:         i.Overrides.IpcMode,
+				PidMode:         i.Overrides.PidMode,
+				Links:           i.Links,
+				ExtraHosts:      i.EtcHostsMaps,
+				DNS:             i.DNSServers,
+				DNSSearch:       i.DNSSearchDomains,
+			},
+			Tmpfs:      containerTmpfs(i.Overrides),
+			Sysctls:    i.Overrides.Sysctls,
+			DNSOptions: i.Overrides.DNSOptions,
+		},
+	}
+
+	setDevices(containerOptions.HostConfig, i.Overrides)
+	publishPorts(&containerOptions, i.Overrides)
+	if i.Overrides.Network != "" {
+		containerOptions.NetworkingConfig = networkingConfig(i.Overrides)
+	}
+	setResourceLimits(containerOptions.HostConfig, i.Overrides)
+
+	//the same command the instrumented container ran
+	if len(i.FatContainerCmd) > 0 {
+		containerOptions.Config.Entrypoint = i.FatContainerCmd
+		containerOptions.Config.Cmd = nil
+	}
+
+	if i.DoIsolatedNetwork {
+		i.NetworkName = fmt.Sprintf(NetworkNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+		if err := i.createNetwork(); err != nil {
+			return err
+		}
+
+		containerOptions.HostConfig.NetworkMode = i.NetworkName
+	}
+
+	i.profilesCheckStart = time.Now()
+	containerInfo, err := i.APIClient.CreateContainer(containerOptions)
+	if err != nil {
+		i.removeNetwork()
+		return err
+	}
+
+	i.ContainerID = containerInfo.ID
+	if i.PrintState {
+		i.Printer.Info(status.IDProfilesCheck, "profiles.check", "status=created id=%v apparmor=%v", i.ContainerID, i.appArmorLoaded)
+	}
+
+	if err := i.APIClient.StartContainer(i.ContainerID, nil); err != nil {
+		return err
+	}
+
+	if i.ContainerInfo, err = i.APIClient.InspectContainer(i.ContainerID); err != nil {
+		return err
+	}
+
+	if i.ContainerInfo.NetworkSettings != nil {
+		i.processContainerPorts()
+	}
+
+	return nil
+}
+
+// FinishProfilesCheck collects the profile denials and removes the profiles check container
+func (i *Inspector) FinishProfilesCheck() *ProfilesCheckResult {
+	result := &ProfilesCheckResult{
+		ContainerID:     i.ContainerID,
+		AppArmorApplied: i.appArmorLoaded,
+	}
+
+	if containerInfo, err := i.APIClient.InspectContainer(i.ContainerID); err == nil {
+		result.Running = containerInfo.State.Running
+		result.ExitCode = containerInfo.State.ExitCode
+	} else {
+		log.Debugf("FinishProfilesCheck: error inspecting container => %v", err)
+	}
+
+	result.LogDenials = i.containerLogDenials()
+	if result.ExitCode == exitCodeSIGSYS {
+		result.LogDenials = append(result.LogDenials, "the container was killed with SIGSYS (Bad system call)")
+	}
+
+	if dockerhost.IsLocal() && dockerclient.DetectMachine(i.APIClient) == "" {
+		result.AuditDenials, result.AuditUnavailable = i.auditDenials()
+	} else {
+		result.AuditUnavailable = true
+	}
+
+	if i.ShowContainerLogs {
+		i.showContainerLogs()
+	}
+
+	err := i.APIClient.StopContainer(i.ContainerID, i.stopTimeout())
+	if _, ok := err.(*dockerapi.ContainerNotRunning); !ok {
+		errutil.WarnOn(err)
+	}
+
+	removeOption := dockerapi.RemoveContainerOptions{
+		ID:            i.ContainerID,
+		RemoveVolumes: true,
+		Force:         true,
+	}
+
+	if err := i.APIClient.RemoveContainer(removeOption); err != nil {
+		log.Info("error removing profiles check container =>", err)
+	}
+
+	i.removeNetwork()
+	i.unloadAppArmorProfile()
+	return result
+}
+
+// loadAppArmorProfile loads the generated AppArmor profile into the kernel of the local Docker host
+// (it's possible only if the Docker daemon uses AppArmor and docker-slim can run apparmor_parser)
+func (i *Inspector) loadAppArmorProfile() bool {
+	skip := func(reason string) bool {
+		if i.PrintState {
+			i.Printer.Info(status.IDProfilesCheck, "profiles.check", "apparmor=skipped message='%s'", reason)
+		}
+
+		return false
+	}
+
+	info, err := i.APIClient.Info()
+	if err != nil {
+		return skip("no Docker daemon info")
+	}
+
+	hasAppArmor := false
+	for _, opt := range info.SecurityOptions {
+		if opt == appArmorSecurityOpt || strings.Contains(opt, "name="+appArmorSecurityOpt) {
+			hasAppArmor = true
+			break
+		}
+	}
+
+	if !hasAppArmor {
+		return skip("the Docker daemon does not use AppArmor")
+	}
+
+	if !dockerhost.IsLocal() || dockerclient.DetectMachine(i.APIClient) != "" {
+		return skip("the AppArmor profile can be loaded only on the local Docker host")
+	}
+
+	profilePath := filepath.Join(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName)
+	output, err := exec.Command(appArmorParser, "-r", "-W", profilePath).CombinedOutput()
+	if err != nil {
+		log.Debugf("loadAppArmorProfile: %s error => %v (%s)", appArmorParser, err, strings.TrimSpace(string(output)))
+		return skip(fmt.Sprintf("%s failed (it needs root privileges)", appArmorParser))
+	}
+
+	i.appArmorLoaded = true
+	return true
+}
+
+func (i *Inspector) unloadAppArmorProfile() {
+	if !i.appArmorLoaded {
+		return
+	}
+
+	profilePath := filepath.Join(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName)
+	if output, err := exec.Command(appArmorParser, "-R", profilePath).CombinedOutput(); err != nil {
+		log.Debugf("unloadAppArmorProfile: %s error => %v (%s)", appArmorParser, err, strings.TrimSpace(string(output)))
+	}
+
+	i.appArmorLoaded = false
+}
+
+// containerLogDenials returns the container log lines that look like denied syscalls or file accesses
+func (i *Inspector) containerLogDenials() []string {
+	var logData bytes.Buffer
+	logsOptions := dockerapi.LogsOptions{
+		Container:    i.ContainerID,
+		OutputStream: &logData,
+		ErrorStream:  &logData,
+		Stdout:       true,
+		Stderr:       true,
+	}
+
+	if err := i.APIClient.Logs(logsOptions); err != nil {
+		log.Debugf("containerLogDenials: error getting container logs => %v", err)
+		return nil
+	}
+
+	var denials []string
+	scanner := bufio.NewScanner(&logData)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for _, pattern := range denialLogPatterns {
+			if strings.Contains(line, pattern) {
+				denials = append(denials, line)
+				break
+			}
+		}
+	}
+
+	return denials
+}
+
+// auditDenials returns the kernel audit records for the seccomp and AppArmor denials
+// logged after the profiles check container started
+// (it also returns true if none of the audit logs could be read)
+func (i *Inspector) auditDenials() ([]string, bool) {
+	appArmorProfile := fmt.Sprintf(`profile="%s"`, i.ImageInspector.AppArmorProfileName)
+	startTime := i.profilesCheckStart.Unix()
+
+	var denials []string
+	//the same record can be in more than one log
+	known := map[string]bool{}
+	unavailable := true
+	for _, logFile := range auditLogFiles {
+		file, err := os.Open(logFile)
+		if err != nil {
+			continue
+		}
+
+		unavailable = false
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			isSeccomp := strings.Contains(line, "type=SECCOMP") || strings.Contains(line, "type=1326")
+			isAppArmor := strings.Contains(line, `apparmor="DENIED"`) && strings.Contains(line, appArmorProfile)
+			if !isSeccomp && !isAppArmor {
+				continue
+			}
+
+			match := auditTimePat.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			if recordTime, err := strconv.ParseInt(match[1], 10, 64); err != nil || recordTime < startTime {
+				continue
+			}
+
+			line = strings.TrimSpace(line)
+			if !known[line] {
+				known[line] = true
+				denials = append(denials, line)
+			}
+		}
+
+		file.Close()
+	}
+
+	return denials, unavailable
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+//NOTES:
+//* the container startup fails when the published host ports are taken (a port allocation race
+//  or a container from an earlier run), when the container or network names are taken
+//  (the names use the process ID, which is the same for the docker-slim runs in containers)
+//  or when the network is not ready yet
+//* the failed attempt container and network are removed and the next attempt uses the new names
+//  (the comms ports and the exposed ports are published to the new random host ports)
+
+// startRetryDelay is the delay before the next container start attempt
+const startRetryDelay = 2 * time.Second
+
+// isTransientStartError returns true if the container startup error can go away when it's retried
+func isTransientStartError(err error) bool {
+	switch err.(type) {
+	case *dockerapi.NoSuchNetwork, *dockerclient.NoSuchNetworkOrContainer:
+		return true
+	}
+
+	if err == dockerapi.ErrContainerAlreadyExists || err == dockerapi.ErrNetworkAlreadyExists {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range []string{
+		"port is already allocated",
+		"address already in use",
+		"is already in use by container",
+		"no such network",
+	} {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+
+	return strings.Contains(msg, "network") && strings.Contains(msg, "not found")
+}
+
+// setRetryNames makes the container and network names for the next start attempt
+func (i *Inspector) setRetryNames(containerOptions *dockerclient.CreateContainerOptions, attempt int) {
+	suffix := fmt.Sprintf("_%d", attempt)
+	i.ContainerName += suffix
+	containerOptions.Name = i.ContainerName
+
+	if i.DoIsolatedNetwork {
+		i.NetworkName += suffix
+		containerOptions.HostConfig.NetworkMode = i.NetworkName
+	}
+}
+
+// cleanupFailedStart removes the container and the network of the failed start attempt
+func (i *Inspector) cleanupFailedStart() {
+	if i.ContainerID != "" {
+		containerID := i.ContainerID
+		//the Docker events for the removed container are ignored
+		i.ContainerID = ""
+		i.ContainerInfo = nil
+
+		err := i.APIClient.RemoveContainer(dockerapi.RemoveContainerOptions{
+			ID:            containerID,
+			RemoveVolumes: true,
+			Force:         true,
+		})
+
+		if _, ok := err.(*dockerapi.NoSuchContainer); err != nil && !ok {
+			log.Infof("cleanupFailedStart: error removing container %v => %v", containerID, err)
+		}
+	}
+
+	i.removeNetwork()
+	//a network that can't be removed is left behind (the next attempt creates a new one)
+	i.NetworkID = ""
+}
@@ -0,0 +1,177 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/ipc"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	//the sensor attaches to the main process of the running container (PID 1 in its PID namespace)
+	targetContainerPid = 1
+	//the sensor needs some time to start listening after 'docker exec'
+	sensorConnectRetries   = 10
+	sensorConnectRetryWait = time.Second
+)
+
+// AttachContainer starts the monitoring of the already running target container
+// (the sensor is uploaded to the container and started with 'docker exec')
+func (i *Inspector) AttachContainer() error {
+	containerInfo, err := i.APIClient.InspectContainer(i.TargetContainer)
+	if err != nil {
+		return err
+	}
+
+	if !containerInfo.State.Running {
+		return fmt.Errorf("target container %s is not running", i.TargetContainer)
+	}
+
+	i.ContainerInfo = containerInfo
+	i.ContainerID = containerInfo.ID
+	i.ContainerName = strings.TrimPrefix(containerInfo.Name, "/")
+
+	//the running container can't publish the sensor ports, so the sensor is reached on the container IP address
+	//(it's reachable only from the Docker host or from the containers on the same network)
+	if !dockerhost.IsLocal() || isDockerDesktop(i.APIClient) {
+		return fmt.Errorf("target container %s can't be monitored with a remote or a VM based Docker daemon (the sensor is reached on the container IP address) - run docker-slim on the Docker host", i.TargetContainer)
+	}
+
+	containerIP := i.containerIP()
+	if containerIP == "" {
+		return fmt.Errorf("target container %s has no IP address (the sensor is reached on the container network)", i.TargetContainer)
+	}
+
+	containerArtifactsPath := path.Join(i.mountLocation(), ArtifactsDir)
+	if err := i.uploadSensor(i.containerSensorPath(), containerArtifactsPath); err != nil {
+		return err
+	}
+
+	if i.PrintState {
+		i.Printer.Info(status.IDArtifactsTransfer, "artifacts.transfer", "status=sensor.uploaded id=%v", i.ContainerID)
+	}
+
+	if err := i.startTargetSensor(containerIP, containerArtifactsPath); err != nil {
+		i.removeSensorFiles()
+		return err
+	}
+
+	return i.startMonitor()
+}
+
+// startTargetSensor starts the sensor in the target container and connects to it
+func (i *Inspector) startTargetSensor(containerIP, containerArtifactsPath string) error {
+	i.monitorContainerEvents()
+
+	sensorCmd := []string{i.containerSensorPath()}
+	if i.DoDebug {
+		sensorCmd = append(sensorCmd, "-d")
+	}
+
+	sensorCmd = append(sensorCmd, "-a", containerArtifactsPath)
+
+	//the sensor needs the extra privileges to use fanotify and ptrace
+	sensorExec, err := i.APIClient.CreateExec(dockerclient.CreateExecOptions{
+		CreateExecOptions: dockerapi.CreateExecOptions{
+			Container: i.ContainerID,
+			Cmd:       sensorCmd,
+			User:      "0:0",
+		},
+		Privileged: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := i.APIClient.StartExec(sensorExec.ID, dockerapi.StartExecOptions{Detach: true}); err != nil {
+		return err
+	}
+
+	log.Debugf("AttachContainer: started sensor (exec id=%v) => %v", sensorExec.ID, sensorCmd)
+
+	if i.ContainerInfo.NetworkSettings != nil {
+		i.processContainerPorts()
+	}
+
+	//the HTTP probes use the ports the running container publishes
+	i.DockerHostIP = dockerhost.GetIP()
+
+	cmdPort := strconv.Itoa(channel.CmdPort)
+	evtPort := strconv.Itoa(channel.EvtPort)
+	for idx := 0; ; idx++ {
+		err = ipc.InitContainerChannels(containerIP, cmdPort, evtPort)
+		if err == nil {
+			return nil
+		}
+
+		ipc.ShutdownContainerChannels()
+		if idx >= sensorConnectRetries {
+			return fmt.Errorf("can't connect to the sensor in target container %s at %s (the container IP address must be reachable from docker-slim) - %v",
+				i.TargetContainer, containerIP, err)
+		}
+
+		log.Debugf("AttachContainer: waiting for the sensor (%v)...", err)
+		time.Sleep(sensorConnectRetryWait)
+	}
+}
+
+// removeSensorFiles removes the uploaded sensor and its artifacts directory from the target container
+// (the sensor removes them itself, so the target container doesn't need any tools)
+func (i *Inspector) removeSensorFiles() {
+	containerArtifactsPath := path.Join(i.mountLocation(), ArtifactsDir)
+	cleanupExec, err := i.APIClient.CreateExec(dockerclient.CreateExecOptions{
+		CreateExecOptions: dockerapi.CreateExecOptions{
+			Container:    i.ContainerID,
+			Cmd:          []string{i.containerSensorPath(), "-c", "-a", containerArtifactsPath},
+			User:         "0:0",
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+	})
+	if err != nil {
+		log.Infof("AttachContainer: error removing the sensor files from the target container => %v", err)
+		return
+	}
+
+	var output bytes.Buffer
+	if err := i.APIClient.StartExec(cleanupExec.ID, dockerapi.StartExecOptions{
+		OutputStream: &output,
+		ErrorStream:  &output,
+	}); err != nil {
+		log.Infof("AttachContainer: error removing the sensor files from the target container => %v", err)
+		return
+	}
+
+	log.Debugf("AttachContainer: removed the sensor files from the target container => %s", output.String())
+}
+
+// containerIP returns the target container IP address (on the default bridge or on one of its networks)
+func (i *Inspector) containerIP() string {
+	settings := i.ContainerInfo.NetworkSettings
+	if settings == nil {
+		return ""
+	}
+
+	if settings.IPAddress != "" {
+		return settings.IPAddress
+	}
+
+	for _, network := range settings.Networks {
+		if network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/docker-slim/docker-slim/pkg/util/termutil"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// AttachTerminal connects the docker-slim terminal to the interactive target container
+// (same as 'docker attach') and returns when the user detaches with ctrl-p ctrl-q
+func (i *Inspector) AttachTerminal() error {
+	fd := int(os.Stdin.Fd())
+	if !termutil.IsTerminal(fd) {
+		return fmt.Errorf("stdin is not a terminal")
+	}
+
+	if width, height, err := termutil.Size(fd); err == nil {
+		if err := i.APIClient.ResizeContainerTTY(i.ContainerID, height, width); err != nil {
+			log.Debugf("AttachTerminal: error resizing container TTY => %v", err)
+		}
+	}
+
+	state, err := termutil.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer termutil.Restore(fd, state)
+
+	//the Docker client closes the input stream when the session ends,
+	//so the input is piped to keep stdin open for docker-slim
+	//(the terminal reader is closed when the session ends, so the copy doesn't take the next input)
+	input, err := termutil.NewReader(fd)
+	if err != nil {
+		return err
+	}
+
+	inReader, inWriter := io.Pipe()
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, _ = io.Copy(inWriter, input)
+	}()
+
+	defer func() {
+		input.Close()
+		inReader.Close()
+		<-copyDone
+	}()
+
+	//the container output before the session starts is shown too (e.g., the application prompt)
+	return i.APIClient.AttachToContainer(dockerapi.AttachToContainerOptions{
+		Container:    i.ContainerID,
+		InputStream:  inReader,
+		OutputStream: os.Stdout,
+		ErrorStream:  os.Stderr,
+		Logs:         true,
+		Stream:       true,
+		Stdin:        true,
+		Stdout:       true,
+		Stderr:       true,
+		RawTerminal:  true,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
 
@@ -12,13 +13,25 @@ import (
 	"github.com/cloudimmunity/go-dockerclientx"
 )
 
+// FatDockerfileName is the name of the reverse engineered Dockerfile for the target image
+const FatDockerfileName = "Dockerfile.fat"
+
 const (
 	slimImageRepo          = "slim"
 	appArmorProfileName    = "apparmor-profile"
 	seccompProfileName     = "seccomp-profile"
-	fatDockerfileName      = "Dockerfile.fat"
 	appArmorProfileNamePat = "%s-apparmor-profile"
 	seccompProfileNamePat  = "%s-seccomp.json"
+	regoPolicyName         = "policy.rego"
+	regoPolicyNamePat      = "%s-policy.rego"
+	constraintTemplateName = "constraint-template.yaml"
+	constraintTemplatePat  = "%s-constraint-template.yaml"
+	podSpecName            = "k8s-pod.yaml"
+	podSpecNamePat         = "%s-k8s-pod.yaml"
+	dockerRunName          = "docker-run.sh"
+	dockerRunNamePat       = "%s-docker-run.sh"
+	composeName            = "compose.yaml"
+	composeNamePat         = "%s-compose.yaml"
 )
 
 // Inspector is a container image inspector
@@ -28,20 +41,30 @@ type Inspector struct {
 	SlimImageRepo       string
 	AppArmorProfileName string
 	SeccompProfileName  string
-	ImageInfo           *docker.Image
+	RegoPolicyName      string
+	ConstraintTemplate  string
+	PodSpecName         string
+	DockerRunName       string
+	ComposeName         string
+	ImageInfo           *dockerclient.Image
 	ImageRecordInfo     docker.APIImages
-	APIClient           *docker.Client
+	APIClient           dockerclient.API
 	//fatImageDockerInstructions []string
 	DockerfileInfo *dockerfile.Info
 }
 
 // NewInspector creates a new container image inspector
-func NewInspector(client *docker.Client, imageRef string /*, artifactLocation string*/) (*Inspector, error) {
+func NewInspector(client dockerclient.API, imageRef string /*, artifactLocation string*/) (*Inspector, error) {
 	inspector := &Inspector{
 		ImageRef:            imageRef,
 		SlimImageRepo:       slimImageRepo,
 		AppArmorProfileName: appArmorProfileName,
 		SeccompProfileName:  seccompProfileName,
+		RegoPolicyName:      regoPolicyName,
+		ConstraintTemplate:  constraintTemplateName,
+		PodSpecName:         podSpecName,
+		DockerRunName:       dockerRunName,
+		ComposeName:         composeName,
 		//ArtifactLocation:    artifactLocation,
 		APIClient: client,
 	}
@@ -96,15 +119,17 @@ func (i *Inspector) processImageName() {
 	if len(i.ImageRecordInfo.RepoTags) > 0 {
 		if rtInfo := strings.Split(i.ImageRecordInfo.RepoTags[0], ":"); len(rtInfo) > 1 {
 			i.SlimImageRepo = fmt.Sprintf("%s.slim", rtInfo[0])
+			baseName := rtInfo[0]
 			if nameParts := strings.Split(rtInfo[0], "/"); len(nameParts) > 1 {
-				i.AppArmorProfileName = strings.Join(nameParts, "-")
-				i.SeccompProfileName = strings.Join(nameParts, "-")
-			} else {
-				i.AppArmorProfileName = rtInfo[0]
-				i.SeccompProfileName = rtInfo[0]
+				baseName = strings.Join(nameParts, "-")
 			}
-			i.AppArmorProfileName = fmt.Sprintf(appArmorProfileNamePat, i.AppArmorProfileName)
-			i.SeccompProfileName = fmt.Sprintf(seccompProfileNamePat, i.SeccompProfileName)
+			i.AppArmorProfileName = fmt.Sprintf(appArmorProfileNamePat, baseName)
+			i.SeccompProfileName = fmt.Sprintf(seccompProfileNamePat, baseName)
+			i.RegoPolicyName = fmt.Sprintf(regoPolicyNamePat, baseName)
+			i.ConstraintTemplate = fmt.Sprintf(constraintTemplatePat, baseName)
+			i.PodSpecName = fmt.Sprintf(podSpecNamePat, baseName)
+			i.DockerRunName = fmt.Sprintf(dockerRunNamePat, baseName)
+			i.ComposeName = fmt.Sprintf(composeNamePat, baseName)
 		}
 	}
 }
@@ -118,7 +143,7 @@ func (i *Inspector) ProcessCollectedData() error {
 	if err != nil {
 		return err
 	}
-	fatImageDockerfileLocation := filepath.Join(i.ArtifactLocation, fatDockerfileName)
+	fatImageDockerfileLocation := filepath.Join(i.ArtifactLocation, FatDockerfileName)
 	err = dockerfile.SaveDockerfileData(fatImageDockerfileLocation, i.DockerfileInfo.Lines)
 	errutil.FailOn(err)
 
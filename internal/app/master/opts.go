@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -15,7 +19,9 @@ import (
 	"github.com/docker/go-connections/nat"
 	"github.com/google/shlex"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/builder"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
 )
 
 //based on expose opt parsing in Docker
@@ -45,6 +51,37 @@ func parseDockerExposeOpt(values []string) (map[docker.Port]struct{}, error) {
 	return exposedPorts, nil
 }
 
+//based on publish opt parsing in Docker ('[<host ip>:]<host port>:<container port>[/<protocol>]')
+func parsePublishOpt(values []string) (map[docker.Port][]docker.PortBinding, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	portBindings := map[docker.Port][]docker.PortBinding{}
+	for _, raw := range values {
+		//the host port is required (the container ports are always published on the random host ports)
+		if strings.Count(strings.SplitN(raw, "/", 2)[0], ":") < 1 {
+			return nil, fmt.Errorf("missing host port: %s", raw)
+		}
+
+		_, bindings, err := nat.ParsePortSpecs([]string{raw})
+		if err != nil {
+			return nil, fmt.Errorf("invalid publish format: %s / error: %s", raw, err)
+		}
+
+		for port, hostBindings := range bindings {
+			for _, binding := range hostBindings {
+				portBindings[docker.Port(port)] = append(portBindings[docker.Port(port)], docker.PortBinding{
+					HostIP:   binding.HostIP,
+					HostPort: binding.HostPort,
+				})
+			}
+		}
+	}
+
+	return portBindings, nil
+}
+
 func isOneSpace(value string) bool {
 	if len(value) > 0 && utf8.RuneCountInString(value) == 1 {
 		r, _ := utf8.DecodeRuneInString(value)
@@ -100,6 +137,205 @@ func parseExec(value string) ([]string, error) {
 	return parts, nil
 }
 
+// defaultCommandShell runs the shell form commands (like the Docker default SHELL)
+var defaultCommandShell = []string{"/bin/sh", "-c"}
+
+// shellOperators are not interpreted in the exec form (they are passed to the executable as its arguments)
+var shellOperators = map[string]bool{
+	"&&":   true,
+	"||":   true,
+	"|":    true,
+	";":    true,
+	"&":    true,
+	">":    true,
+	">>":   true,
+	"<":    true,
+	"2>&1": true,
+}
+
+//the exec form values are JSON arrays or space separated arguments
+//and the shell form values are command strings run with the shell (like 'sh -c "<command>"')
+func parseCommand(value string, form string, shell []string) ([]string, error) {
+	if value == "" || isOneSpace(value) {
+		return []string{}, nil
+	}
+
+	switch form {
+	case "", config.CommandFormExec:
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "[") {
+			//Docker quietly runs the invalid JSON arrays in the shell form, so they are rejected
+			var parts []string
+			if err := json.Unmarshal([]byte(trimmed), &parts); err != nil {
+				return nil, fmt.Errorf("invalid exec form (use a JSON array with double-quoted strings, e.g., '[\"node\",\"app.js\"]'): %v", err)
+			}
+
+			if len(parts) > 0 && parts[0] == "" {
+				return nil, fmt.Errorf("invalid exec form (no executable): %s", value)
+			}
+
+			return parts, nil
+		}
+
+		parts, err := parseExec(value)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range parts {
+			if shellOperators[part] {
+				return nil, fmt.Errorf("shell operator '%s' in the exec form (use the shell form): %s", part, value)
+			}
+		}
+
+		return parts, nil
+	case config.CommandFormShell:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			return nil, fmt.Errorf("JSON array in the shell form (use a command string or the exec form): %s", value)
+		}
+
+		if len(shell) == 0 {
+			shell = defaultCommandShell
+		}
+
+		return append(append([]string{}, shell...), value), nil
+	default:
+		return nil, fmt.Errorf("unknown command form: %s (use 'exec' or 'shell')", form)
+	}
+}
+
+//the ONBUILD triggers can't chain other triggers or change the base image (like in Docker)
+func parseOnBuild(values []string) ([]string, error) {
+	var triggers []string
+	for _, value := range values {
+		trigger := strings.TrimSpace(value)
+		fields := strings.Fields(trigger)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid onbuild instruction: %s", value)
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "ONBUILD", "FROM", "MAINTAINER":
+			return nil, fmt.Errorf("unsupported onbuild instruction: %s", value)
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, nil
+}
+
+//the image creation time is an RFC 3339 timestamp or a number of seconds since the Unix epoch
+//(like SOURCE_DATE_EPOCH)
+func parseCreated(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return time.Time{}, fmt.Errorf("negative timestamp: %s", value)
+		}
+
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	created, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+	}
+
+	return created.UTC(), nil
+}
+
+func parseLabels(values []string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, raw := range values {
+		parts := strings.SplitN(raw, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid label format: %s", raw)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			return nil, fmt.Errorf("invalid label format (empty key): %s", raw)
+		}
+
+		labels[key] = parts[1]
+	}
+
+	return labels, nil
+}
+
+//the layer rules are '<layer>:<path pattern>' (the 'path.Match' pattern syntax)
+func parseLayerRules(values []string) ([]config.LayerRule, error) {
+	var rules []config.LayerRule
+	for _, raw := range values {
+		parts := strings.SplitN(raw, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid layer rule format: %s", raw)
+		}
+
+		rule := config.LayerRule{
+			Layer:   strings.TrimSpace(parts[0]),
+			Pattern: strings.TrimSpace(parts[1]),
+		}
+
+		if !builder.IsValidLayerName(rule.Layer) {
+			return nil, fmt.Errorf("invalid layer name: %s", raw)
+		}
+
+		if !builder.IsValidLayerPattern(rule.Pattern) {
+			return nil, fmt.Errorf("invalid layer path pattern: %s", raw)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// expandPath expands the '~' prefix and the environment variables ('$NAME' or '${NAME}') in a host path
+func expandPath(value string) (string, error) {
+	var undefined []string
+	expanded := os.Expand(value, func(name string) string {
+		if envValue, ok := os.LookupEnv(name); ok {
+			return envValue
+		}
+
+		undefined = append(undefined, name)
+		return ""
+	})
+
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined environment variable(s) in path '%s': %s", value, strings.Join(undefined, ", "))
+	}
+
+	if !strings.HasPrefix(expanded, "~") {
+		return expanded, nil
+	}
+
+	if expanded != "~" &&
+		!strings.HasPrefix(expanded, "~/") &&
+		!strings.HasPrefix(expanded, "~"+string(os.PathSeparator)) {
+		return "", fmt.Errorf("unsupported home directory reference in path '%s' (only '~/' is supported)", value)
+	}
+
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" {
+		currentUser, err := user.Current()
+		if err != nil || currentUser.HomeDir == "" {
+			return "", fmt.Errorf("can't resolve the home directory in path '%s'", value)
+		}
+
+		homeDir = currentUser.HomeDir
+	}
+
+	return filepath.Join(homeDir, expanded[1:]), nil
+}
+
 func parseVolumeMounts(values []string) (map[string]config.VolumeMount, error) {
 	volumeMounts := map[string]config.VolumeMount{}
 
@@ -108,8 +344,18 @@ func parseVolumeMounts(values []string) (map[string]config.VolumeMount, error) {
 			return nil, fmt.Errorf("invalid volume mount format: %s", raw)
 		}
 
-		parts := strings.Split(raw, ":")
-		if (len(parts) > 3) ||
+		//keep the drive letter with the Windows host paths (e.g., 'C:\data:/data')
+		var drive string
+		spec := raw
+		if dockerhost.IsWindowsPath(spec) {
+			drive = spec[:2]
+			spec = spec[2:]
+		}
+
+		parts := strings.Split(spec, ":")
+		parts[0] = drive + parts[0]
+		if (len(parts) < 2) ||
+			(len(parts) > 3) ||
 			(len(parts[0]) < 1) ||
 			(len(parts[1]) < 1) ||
 			((len(parts) == 3) && (len(parts[2]) < 1)) {
@@ -120,17 +366,91 @@ func parseVolumeMounts(values []string) (map[string]config.VolumeMount, error) {
 			Source:      parts[0],
 			Destination: parts[1],
 			Options:     "rw",
+			IsVolume:    isVolumeName(parts[0]),
+		}
+
+		if !mount.IsVolume {
+			source, err := expandPath(parts[0])
+			if err != nil {
+				return nil, err
+			}
+
+			//same as Docker, the relative host paths are relative to the current directory
+			if !filepath.IsAbs(source) && !dockerhost.IsWindowsPath(source) {
+				if source, err = filepath.Abs(source); err != nil {
+					return nil, err
+				}
+			}
+
+			mount.Source = source
 		}
 
 		if len(parts) == 3 {
 			mount.Options = parts[2]
 		}
 
-		volumeMounts[mount.Source] = mount
+		//same as Docker, there's only one mount for each container path
+		if _, ok := volumeMounts[mount.Destination]; ok {
+			return nil, fmt.Errorf("duplicate volume mount point: %s", mount.Destination)
+		}
+
+		volumeMounts[mount.Destination] = mount
 	}
 	return volumeMounts, nil
 }
 
+//based on the add-host opt validation in Docker ('<host>:<ip>' or '<host>=<ip>';
+//the IPv6 addresses can be in brackets and 'host-gateway' is the host IP address)
+func parseEtcHostsMaps(values []string) ([]string, error) {
+	var hostsMaps []string
+	for _, value := range values {
+		sep := strings.IndexAny(value, ":=")
+		if sep < 1 {
+			return nil, fmt.Errorf("invalid etc hosts map: %s", value)
+		}
+
+		host := value[:sep]
+		ip := strings.TrimSuffix(strings.TrimPrefix(value[sep+1:], "["), "]")
+		if strings.ContainsAny(host, " \t") {
+			return nil, fmt.Errorf("invalid etc hosts map host name: %s", value)
+		}
+
+		if ip != "host-gateway" && net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid etc hosts map IP address: %s", value)
+		}
+
+		hostsMaps = append(hostsMaps, fmt.Sprintf("%s:%s", host, ip))
+	}
+
+	return hostsMaps, nil
+}
+
+//the named volume names in Docker (the other mount sources are host paths)
+var volumeNamePat = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func isVolumeName(source string) bool {
+	return volumeNamePat.MatchString(source)
+}
+
+//based on the volumes-from opt in Docker ('<container>[:ro|rw]')
+func parseVolumesFrom(values []string) ([]string, error) {
+	var containers []string
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) > 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid volumes-from value: %s", value)
+		}
+
+		if len(parts) == 2 && parts[1] != "ro" && parts[1] != "rw" {
+			return nil, fmt.Errorf("invalid volumes-from mode (use 'ro' or 'rw'): %s", value)
+		}
+
+		containers = append(containers, value)
+	}
+
+	return containers, nil
+}
+
 func parsePaths(values []string) map[string]bool {
 	paths := map[string]bool{}
 
@@ -141,6 +461,68 @@ func parsePaths(values []string) map[string]bool {
 	return paths
 }
 
+//locale names: 'language[_territory][.codeset][@modifier]' (or 'C' and 'POSIX')
+var localeNamePat = regexp.MustCompile(`^(?:[a-zA-Z]{2,3}(?:_[a-zA-Z]{2}|_[0-9]{3})?|C|POSIX)(?:\.[a-zA-Z0-9_-]+)?(?:@[a-zA-Z0-9]+)?$`)
+
+func parseLocales(value string) ([]string, error) {
+	var locales []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+
+		if !localeNamePat.MatchString(name) {
+			return nil, fmt.Errorf("invalid locale name: %s", name)
+		}
+
+		seen[name] = true
+		locales = append(locales, name)
+	}
+
+	return locales, nil
+}
+
+func parsePathMap(value string) (string, string, error) {
+	//include paths can be remapped: "<fat image path>:<slim image path>"
+	if !strings.Contains(value, ":") {
+		return value, "", nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 ||
+		len(parts[0]) < 1 ||
+		len(parts[1]) < 1 {
+		return "", "", fmt.Errorf("invalid path map format: %s", value)
+	}
+
+	if !filepath.IsAbs(parts[1]) {
+		return "", "", fmt.Errorf("invalid path map target (must be an absolute path): %s", value)
+	}
+
+	return parts[0], filepath.Clean(parts[1]), nil
+}
+
+func parseIncludePaths(values []string) (map[string]bool, map[string]string, error) {
+	paths := map[string]bool{}
+	pathMaps := map[string]string{}
+
+	for _, value := range values {
+		src, dst, err := parsePathMap(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		paths[src] = true
+		if dst != "" && dst != src {
+			pathMaps[src] = dst
+		}
+	}
+
+	return paths, pathMaps, nil
+}
+
 func parsePathsFile(filePath string) (map[string]bool, error) {
 	paths := map[string]bool{}
 
@@ -314,6 +696,34 @@ func isPortNum(value int) bool {
 	return false
 }
 
+// parseWaitTime parses a wait time value (a number of seconds or a Go duration like '90s', '5m' or '1h')
+func parseWaitTime(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty wait time")
+	}
+
+	//zero is a valid wait time (e.g., the default HTTP probe retry waits or no exec timeout)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("wait time can't be negative: %s", value)
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	waitTime, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("malformed wait time: %s", value)
+	}
+
+	if waitTime < 0 {
+		return 0, fmt.Errorf("wait time can't be negative: %s", value)
+	}
+
+	return waitTime, nil
+}
+
 func parseHTTPProbesPorts(portList string) ([]uint16, error) {
 	var ports []uint16
 
@@ -333,3 +743,401 @@ func parseHTTPProbesPorts(portList string) ([]uint16, error) {
 
 	return ports, nil
 }
+
+//based on the device opt parsing in Docker ('host path[:container path][:permissions]')
+func parseDevices(values []string) ([]docker.Device, error) {
+	var devices []docker.Device
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		device := docker.Device{
+			PathOnHost:        parts[0],
+			PathInContainer:   parts[0],
+			CgroupPermissions: "rwm",
+		}
+
+		switch len(parts) {
+		case 1:
+		case 2:
+			if isDevicePermissions(parts[1]) {
+				device.CgroupPermissions = parts[1]
+			} else {
+				device.PathInContainer = parts[1]
+			}
+		case 3:
+			if !isDevicePermissions(parts[2]) {
+				return nil, fmt.Errorf("invalid device permissions: %s", value)
+			}
+
+			device.PathInContainer = parts[1]
+			device.CgroupPermissions = parts[2]
+		default:
+			return nil, fmt.Errorf("invalid device format: %s", value)
+		}
+
+		if !filepath.IsAbs(device.PathOnHost) || !filepath.IsAbs(device.PathInContainer) {
+			return nil, fmt.Errorf("invalid device path (must be an absolute path): %s", value)
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+func isDevicePermissions(value string) bool {
+	if value == "" || len(value) > 3 {
+		return false
+	}
+
+	for _, c := range value {
+		if c != 'r' && c != 'w' && c != 'm' {
+			return false
+		}
+	}
+
+	return true
+}
+
+//based on the gpus opt parsing in Docker
+//('all', a GPU count or 'count=<n>,device=<id>[,<id>],capabilities=<cap>[,<cap>],driver=<name>')
+func parseGPUs(value string) (*config.DeviceRequest, error) {
+	request := &config.DeviceRequest{}
+	if value == "all" {
+		request.Count = -1
+	} else if count, err := strconv.Atoi(value); err == nil {
+		if count < 1 {
+			return nil, fmt.Errorf("invalid GPU count: %s", value)
+		}
+
+		request.Count = count
+	} else {
+		var capabilities []string
+		var lastKey string
+		for _, field := range strings.Split(value, ",") {
+			field = strings.Trim(field, `"`)
+			key, val := lastKey, field
+			if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+				key, val = strings.TrimSpace(kv[0]), kv[1]
+			}
+
+			val = strings.TrimSpace(val)
+			switch key {
+			case "count":
+				if val == "all" {
+					request.Count = -1
+				} else if count, err := strconv.Atoi(val); err == nil && count > 0 {
+					request.Count = count
+				} else {
+					return nil, fmt.Errorf("invalid GPU count: %s", val)
+				}
+			case "device":
+				request.DeviceIDs = append(request.DeviceIDs, val)
+			case "capabilities":
+				capabilities = append(capabilities, val)
+			case "driver":
+				request.Driver = val
+			default:
+				return nil, fmt.Errorf("unexpected GPU option: %s", field)
+			}
+
+			lastKey = key
+		}
+
+		if request.Count != 0 && len(request.DeviceIDs) > 0 {
+			return nil, fmt.Errorf("cannot set both GPU count and device ids: %s", value)
+		}
+
+		if len(capabilities) > 0 {
+			//the 'gpu' capability selects the GPU device driver
+			hasGPU := false
+			for _, name := range capabilities {
+				hasGPU = hasGPU || name == "gpu"
+			}
+
+			if !hasGPU {
+				capabilities = append(capabilities, "gpu")
+			}
+
+			request.Capabilities = [][]string{capabilities}
+		}
+	}
+
+	if len(request.Capabilities) == 0 {
+		request.Capabilities = [][]string{{"gpu"}}
+	}
+
+	return request, nil
+}
+
+// the ulimit names Docker supports
+var ulimitNames = map[string]bool{
+	"core":       true,
+	"cpu":        true,
+	"data":       true,
+	"fsize":      true,
+	"locks":      true,
+	"memlock":    true,
+	"msgqueue":   true,
+	"nice":       true,
+	"nofile":     true,
+	"nproc":      true,
+	"rss":        true,
+	"rtprio":     true,
+	"rttime":     true,
+	"sigpending": true,
+	"stack":      true,
+}
+
+//based on the ulimit opt parsing in Docker ('<name>=<soft limit>[:<hard limit>]', '-1' is unlimited)
+func parseUlimits(values []string) ([]docker.ULimit, error) {
+	var ulimits []docker.ULimit
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || !ulimitNames[parts[0]] {
+			return nil, fmt.Errorf("invalid ulimit: %s", value)
+		}
+
+		limits := strings.Split(parts[1], ":")
+		if len(limits) > 2 {
+			return nil, fmt.Errorf("invalid ulimit: %s", value)
+		}
+
+		soft, err := strconv.ParseInt(limits[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ulimit soft limit: %s", value)
+		}
+
+		hard := soft
+		if len(limits) == 2 {
+			if hard, err = strconv.ParseInt(limits[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid ulimit hard limit: %s", value)
+			}
+		}
+
+		if hard != -1 && (soft == -1 || soft > hard) {
+			return nil, fmt.Errorf("ulimit soft limit is greater than the hard limit: %s", value)
+		}
+
+		ulimits = append(ulimits, docker.ULimit{
+			Name: parts[0],
+			Soft: soft,
+			Hard: hard,
+		})
+	}
+
+	return ulimits, nil
+}
+
+//based on the tmpfs opt parsing in Docker ('<path>[:<mount options>]')
+func parseTmpfs(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	mounts := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if !filepath.IsAbs(parts[0]) || filepath.Clean(parts[0]) == "/" {
+			return nil, fmt.Errorf("invalid tmpfs mount path: %s", value)
+		}
+
+		var options string
+		if len(parts) == 2 {
+			options = parts[1]
+		}
+
+		mounts[filepath.Clean(parts[0])] = options
+	}
+
+	return mounts, nil
+}
+
+//the IPC kernel parameters Docker allows in the container IPC namespace
+//(the 'fs.mqueue.' and 'net.' parameters are allowed too)
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+//based on the sysctl opt validation in Docker ('<name>=<value>', only the namespaced parameters)
+func parseSysctls(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	sysctls := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid sysctl: %s", value)
+		}
+
+		name := parts[0]
+		if !ipcSysctls[name] && !strings.HasPrefix(name, "fs.mqueue.") && !strings.HasPrefix(name, "net.") {
+			return nil, fmt.Errorf("sysctl is not namespaced (not allowed in containers): %s", name)
+		}
+
+		sysctls[name] = parts[1]
+	}
+
+	return sysctls, nil
+}
+
+//the secret files are always mounted read-only ('<host path>:<container path>')
+func parseSecretFiles(values []string) ([]config.VolumeMount, error) {
+	var mounts []config.VolumeMount
+	for _, value := range values {
+		src, dst, err := parsePathMap(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if dst == "" {
+			return nil, fmt.Errorf("missing secret file container path: %s", value)
+		}
+
+		source, err := expandPath(src)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(source); err != nil {
+			return nil, fmt.Errorf("secret file not found: %s", src)
+		}
+
+		mounts = append(mounts, config.VolumeMount{
+			Source:      source,
+			Destination: dst,
+			Options:     "ro",
+		})
+	}
+
+	return mounts, nil
+}
+
+//the secret env vars without a value ('<name>') get it from the docker-slim environment
+//(so the secret values don't need to be on the command line)
+func parseSecretEnv(values []string) ([]string, error) {
+	var env []string
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("missing secret env var name")
+		}
+
+		if len(parts) == 1 {
+			envValue, ok := os.LookupEnv(parts[0])
+			if !ok {
+				return nil, fmt.Errorf("secret env var is not set: %s", parts[0])
+			}
+
+			value = fmt.Sprintf("%s=%s", parts[0], envValue)
+		}
+
+		env = append(env, value)
+	}
+
+	return env, nil
+}
+
+//the host and domain names are dot separated RFC 1123 labels
+func isValidHostname(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) < 1 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+//the namespace mode is empty (the default mode), one of the mode names or 'container:<name|id>'
+func isValidNamespaceMode(mode string, names ...string) bool {
+	if mode == "" {
+		return true
+	}
+
+	if strings.HasPrefix(mode, "container:") {
+		return len(mode) > len("container:")
+	}
+
+	for _, name := range names {
+		if mode == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseIPAddress(value string, isIPv6 bool) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil || (ip.To4() == nil) != isIPv6 {
+		return "", fmt.Errorf("malformed address: %s", value)
+	}
+
+	return ip.String(), nil
+}
+
+// parseBatchTargetFile reads the 'batch' command targets
+// (the lines are '[<build flags>] <target image>', the empty lines and the '#' comments are skipped)
+func parseBatchTargetFile(filePath string) ([]config.BatchTarget, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []config.BatchTarget
+	for idx, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, err := shlex.Split(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", idx+1, err)
+		}
+
+		image := fields[len(fields)-1]
+		if strings.HasPrefix(image, "-") {
+			return nil, fmt.Errorf("line %d: no target image", idx+1)
+		}
+
+		targets = append(targets, config.BatchTarget{
+			Image:      image,
+			BuildFlags: fields[:len(fields)-1],
+		})
+	}
+
+	return targets, nil
+}
+
+// parseBatchBuildFlags splits the 'build' command flags for the 'batch' command targets
+func parseBatchBuildFlags(value string) ([]string, error) {
+	return shlex.Split(value)
+}
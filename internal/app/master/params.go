@@ -0,0 +1,284 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Parameter format hints (shown when a flag value can't be used)
+const (
+	paramHintHTTPProbeCmd    = "use '[[protocol:]method:]resource' (e.g., '/health', 'post:/api/login' or 'https:get:/'), the resource must start with '/'"
+	paramHintHTTPProbeFile   = "use a JSON file with a 'commands' list (e.g., {\"commands\":[{\"protocol\":\"http\",\"method\":\"GET\",\"resource\":\"/\"}]})"
+	paramHintHTTPProbePorts  = "use a comma separated list of port numbers (e.g., '8080,3000')"
+	paramHintExpose          = "use 'port[/protocol]' or 'startPort-endPort[/protocol]' (e.g., '8080', '53/udp' or '9000-9010')"
+	paramHintExec            = "use a shell form string (e.g., 'node app.js') or a JSON array (e.g., '[\"node\",\"app.js\"]')"
+	paramHintLabel           = "use 'key=value' (e.g., 'version=1.0' or 'maintainer=me@example.com')"
+	paramHintCreated         = "use an RFC 3339 timestamp or a number of seconds since the Unix epoch (e.g., '2021-06-01T12:00:00Z' or '1622548800')"
+	paramHintEtcHostsMap     = "use '<host>:<ip>' with an IPv4 or IPv6 address (e.g., 'db:10.0.0.10' or 'db:fd00::10')"
+	paramHintMount           = "use 'source:destination[:options]' with a host path or a volume name (e.g., '/data:/data:ro' or 'seed-data:/data')"
+	paramHintIncludePath     = "use '<path>' or '<fat image path>:<slim image path>' (the target path must be absolute)"
+	paramHintIncludeLocale   = "use a comma separated list of locale names (e.g., 'en_US.UTF-8,de_DE.UTF-8', 'C.UTF-8' or 'fr' for all French locales)"
+	paramHintContinueAfter   = "use 'enter', 'signal', 'probe', 'timeout', 'healthcheck', 'healthcheck:<number of healthy checks>', a number of seconds (e.g., '120') or a duration (e.g., '90s', '5m' or '1h')"
+	paramHintWaitTime        = "use a number of seconds (e.g., '10') or a duration (e.g., '500ms', '10s' or '1m')"
+	paramHintImageTag        = "use '[registry/]name[:tag]' with a lowercase name (e.g., 'my/app.slim' or 'my/app.slim:v1')"
+	paramHintPathExpand      = "define the referenced environment variables or use '~/' for the home directory (e.g., '~/data' or '$HOME/data')"
+	paramHintPathConflict    = "remove the path from one of the lists"
+	paramHintProbeConflict   = "enable the HTTP probes or use a different continue-after mode"
+	paramHintPortConflict    = "add the port to the --expose list or remove it from the --http-probe-ports list"
+	paramHintPublishConflict = "publish the container ports on different host ports (or on different host IPs)"
+	paramHintInteractive     = "use --interactive with the 'enter' continue-after mode"
+	paramHintNetworkConflict = "use --network or --isolated-network, not both"
+	paramHintSysctlConflict  = "remove the 'net.' sysctls with the host network and the IPC sysctls with the host IPC namespace"
+	paramHintNetworkAddress  = "use --network with a user-defined network (not 'bridge', 'host', 'none' or 'container:<name|id>')"
+	paramHintTargetContainer = "use --target-container without a target image, --from-dockerfile, --isolated-network, --interactive and --use-cache"
+	paramHintSensorMount     = "use an absolute container path for the mount location and comma separated bind options (e.g., 'z' or 'Z,rshared')"
+	paramHintSeccompOptions  = "use 386, amd64, armhf or arm64 for the architectures, errno, kill, log or trap for the default action, eperm, enosys or an errno number for the errno value and <syscall>=<allow|errno|kill|log|trap> for the syscall actions"
+	paramHintSeccompBaseline = "use 'docker-default' or a seccomp profile file and the 'union' or 'intersection' merge mode"
+	paramHintAppArmorNetwork = "use 'all', 'observed' or 'none'"
+	paramHintMergeArtifacts  = "use the artifact directories with the container reports ('creport.json') from the 'build' or 'profile' commands (and a different output directory)"
+	paramHintEmbedProfiles   = "use 'none', 'digest' or 'full' and an http(s) base URL for the profile URL labels"
+	paramHintLayerRule       = "use 'single', 'split' or 'reuse-base' for the layer strategy and '<layer>:<absolute path pattern>' with a lowercase layer name for the rules (e.g., 'models:/app/models' or 'base:/usr/lib/python3*/test')"
+	paramHintSlimBase        = "use --slim-base without --reproducible and --oci-layout"
+	paramHintReuseBase       = "use the 'reuse-base' layer strategy without --slim-base, --shared-layer, --reproducible and --oci-layout"
+	paramHintStripBinaries   = "install binutils on the host and use --strip-exclude with --strip-binaries and the absolute path patterns (e.g., '/usr/lib/debug' or '/app/bin/*')"
+	paramHintArtifactHook    = "use the executable script files (e.g., 'chmod +x script.sh')"
+	paramHintIncludeNew      = "use '<host path>:<absolute image path>' with an existing host file or directory (e.g., './healthcheck:/usr/local/bin/healthcheck')"
+	paramHintLoaderCheck     = "use 'off', 'warn', 'fail' or 'include'"
+	paramHintSharedLayer     = "use a directory created with the 'shared-layer' command (without --slim-base)"
+	paramHintSharedArtifacts = "use the artifact directories with the build context manifests ('build-context.json') from the 'build' command (and a different output directory)"
+	paramHintLayerFormat     = "use 'gzip' or 'zstd' (or --estargz with the gzip compression) with --push or --oci-layout"
+	paramHintAnnotation      = "use 'key=value' annotations with --push or --oci-layout"
+	paramHintOCILayout       = "use a new or an existing OCI image layout directory (without --test-profiles)"
+	paramHintBatch           = "use --parallel with a positive number and a target file with '[<build flags>] <target image>' lines (quote the flag values with spaces)"
+	paramHintRegistryDirect  = "use --registry-direct with a target image and without the --include-path path remapping, --from-dockerfile, --target-container, --slim-base, --shared-layer, --test-profiles and --use-cache"
+)
+
+type paramError struct {
+	Name    string
+	Message string
+	Hint    string
+}
+
+type paramErrors []paramError
+
+func (e *paramErrors) add(name string, err error, hint string) {
+	*e = append(*e, paramError{
+		Name:    name,
+		Message: err.Error(),
+		Hint:    hint,
+	})
+}
+
+func (e *paramErrors) addf(name string, hint string, format string, args ...interface{}) {
+	*e = append(*e, paramError{
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+		Hint:    hint,
+	})
+}
+
+// failOnErrors shows all collected parameter problems and terminates the application if there are any
+func (e paramErrors) failOnErrors(cmdName string) {
+	if len(e) == 0 {
+		return
+	}
+
+	printer := status.New(cmdName)
+	for _, perr := range e {
+		printer.Info(status.IDParamError, "param.error", "param=%s error='%s'", perr.Name, perr.Message)
+		if perr.Hint != "" {
+			printer.Info(status.IDParamHint, "param.hint", "param=%s message='%s'", perr.Name, perr.Hint)
+		}
+	}
+
+	printer.Info(status.IDParamErrors, "param.errors", "count=%d message='fix the parameters and try again (run docker-slim help %s to see all options)'",
+		len(e), cmdName)
+	printer.Exited()
+	os.Exit(-1)
+}
+
+// addConflicts records the parameter combinations that contradict each other
+func (e *paramErrors) addConflicts(doHTTPProbe bool,
+	continueAfter *config.ContinueAfter,
+	httpProbePorts []uint16,
+	overrides *config.ContainerOverrides,
+	doIsolatedNetwork bool,
+	includePaths map[string]bool,
+	excludePaths map[string]bool) {
+	for ipath := range includePaths {
+		if excludePaths[ipath] {
+			e.addf(FlagIncludePath, paramHintPathConflict,
+				"path is included and excluded at the same time: %s", ipath)
+		}
+	}
+
+	if !doHTTPProbe && continueAfter != nil && continueAfter.Mode == "probe" {
+		e.addf(FlagContinueAfter, paramHintProbeConflict,
+			"the 'probe' continue-after mode requires HTTP probes, but they are disabled")
+	}
+
+	if overrides != nil && overrides.Interactive && continueAfter != nil && continueAfter.Mode != "enter" {
+		e.addf(FlagInteractive, paramHintInteractive,
+			"the interactive session ends the container monitoring, but the continue-after mode is '%s'", continueAfter.Mode)
+	}
+
+	if doIsolatedNetwork && overrides != nil && overrides.Network != "" {
+		e.addf(FlagIsolatedNetwork, paramHintNetworkConflict,
+			"the isolated network replaces the target container network, but --network is set too (%s)", overrides.Network)
+	}
+
+	if overrides != nil && (overrides.NetworkIPv4 != "" || overrides.NetworkIPv6 != "" || len(overrides.NetworkAliases) > 0) &&
+		!isUserDefinedNetwork(overrides.Network) {
+		e.addf(FlagNetwork, paramHintNetworkAddress,
+			"the static addresses and the network aliases require a user-defined network (network='%s')", overrides.Network)
+	}
+
+	//the host namespaces can't be changed from the container
+	if overrides != nil {
+		for name := range overrides.Sysctls {
+			if overrides.Network == "host" && strings.HasPrefix(name, "net.") {
+				e.addf(FlagSysctl, paramHintSysctlConflict,
+					"sysctl can't be set in the host network namespace: %s", name)
+			}
+
+			if overrides.IpcMode == "host" && !strings.HasPrefix(name, "net.") {
+				e.addf(FlagSysctl, paramHintSysctlConflict,
+					"sysctl can't be set in the host IPC namespace: %s", name)
+			}
+		}
+	}
+
+	//the host port is bound once for each host IP and protocol
+	//(one container port can be published on several host ports)
+	if overrides != nil && len(overrides.PortBindings) > 0 {
+		type hostPort struct {
+			ip    string
+			port  string
+			proto string
+		}
+
+		bound := map[hostPort]docker.Port{}
+		for _, port := range sortedPorts(overrides.PortBindings) {
+			for _, binding := range overrides.PortBindings[port] {
+				key := hostPort{ip: binding.HostIP, port: binding.HostPort, proto: port.Proto()}
+				if key.ip == "" {
+					key.ip = "0.0.0.0"
+				}
+
+				conflicts := []hostPort{key}
+				if key.ip == "0.0.0.0" {
+					//all interfaces conflict with the specific host IPs
+					for other := range bound {
+						if other.port == key.port && other.proto == key.proto {
+							conflicts = append(conflicts, other)
+						}
+					}
+				} else {
+					conflicts = append(conflicts, hostPort{ip: "0.0.0.0", port: key.port, proto: key.proto})
+				}
+
+				for _, other := range conflicts {
+					if otherPort, found := bound[other]; found && otherPort != port {
+						e.addf(FlagPublish, paramHintPublishConflict,
+							"host port %s:%s/%s is published for two container ports: %s and %s",
+							key.ip, key.port, key.proto, otherPort, port)
+						break
+					}
+				}
+
+				bound[key] = port
+			}
+		}
+	}
+
+	//the exposed ports in 'overrides' replace the ports exposed by the image
+	//(the published ports are exposed too)
+	if doHTTPProbe && overrides != nil && len(overrides.ExposedPorts) > 0 {
+		exposed := map[string]bool{}
+		for port := range overrides.ExposedPorts {
+			if port.Proto() == "tcp" {
+				exposed[port.Port()] = true
+			}
+		}
+
+		for port := range overrides.PortBindings {
+			if port.Proto() == "tcp" {
+				exposed[port.Port()] = true
+			}
+		}
+
+		for _, port := range httpProbePorts {
+			if !exposed[strconv.Itoa(int(port))] {
+				e.addf(FlagHTTPProbePorts, paramHintPortConflict,
+					"HTTP probe port is not among the exposed (tcp) ports: %d", port)
+			}
+		}
+	}
+}
+
+// sortedPorts returns the published container ports in a stable order (for the error messages)
+func sortedPorts(bindings map[docker.Port][]docker.PortBinding) []docker.Port {
+	var ports []docker.Port
+	for port := range bindings {
+		ports = append(ports, port)
+	}
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// isUserDefinedNetwork returns true if the network is not one of the default Docker networks (or network modes)
+func isUserDefinedNetwork(network string) bool {
+	switch network {
+	case "", "default", "bridge", "host", "none":
+		return false
+	}
+
+	return !strings.HasPrefix(network, "container:")
+}
+
+var (
+	imageNameComponentPat = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	imageTagPat           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageRegistryPat      = regexp.MustCompile(`^[a-zA-Z0-9.-]+(?::[0-9]+)?$`)
+)
+
+func validateImageTag(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	name := value
+	if idx := strings.LastIndex(value, ":"); idx > strings.LastIndex(value, "/") {
+		name = value[:idx]
+		if tag := value[idx+1:]; !imageTagPat.MatchString(tag) {
+			return fmt.Errorf("malformed tag (%s) in image name: %s", tag, value)
+		}
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if !imageRegistryPat.MatchString(parts[0]) {
+			return fmt.Errorf("malformed registry (%s) in image name: %s", parts[0], value)
+		}
+
+		parts = parts[1:]
+	}
+
+	for _, part := range parts {
+		if !imageNameComponentPat.MatchString(part) {
+			return fmt.Errorf("malformed name component (%s) in image name: %s", part, value)
+		}
+	}
+
+	return nil
+}
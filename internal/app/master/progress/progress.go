@@ -0,0 +1,206 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dustin/go-humanize"
+)
+
+// Progress output settings
+const (
+	SpinnerInterval = 150 * time.Millisecond
+	StatusInterval  = 15 * time.Second
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+const (
+	colorStart = "\x1b[36m"
+	colorEnd   = "\x1b[0m"
+	clearLine  = "\r\x1b[K"
+)
+
+var (
+	isPlain = !log.IsTerminal(os.Stdout)
+	noColor = false
+)
+
+// Configure selects the progress output mode
+// (plain mode prints periodic status lines instead of the spinner)
+func Configure(plain bool, disableColor bool) {
+	if plain {
+		isPlain = true
+	}
+
+	noColor = disableColor
+}
+
+// IsPlain returns true if the progress output is in the plain mode
+func IsPlain() bool {
+	return isPlain
+}
+
+// Indicator shows the activity status for a long running phase
+// (and the phase progress if the phase reports it with Update)
+type Indicator struct {
+	prefix   string
+	phase    string
+	start    time.Time
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	mu         sync.Mutex
+	hasCounts  bool
+	files      int64
+	totalFiles int64
+	bytes      int64
+	totalBytes int64
+}
+
+// Start creates and starts a new progress indicator
+func Start(prefix, phase string) *Indicator {
+	ind := &Indicator{
+		prefix: prefix,
+		phase:  phase,
+		start:  time.Now(),
+		doneCh: make(chan struct{}),
+	}
+
+	ind.wg.Add(1)
+	if isPlain {
+		go ind.runStatus(ind.doneCh)
+	} else {
+		go ind.runSpinner(ind.doneCh)
+	}
+
+	return ind
+}
+
+// Stop ends the progress indicator activity (it can be called more than once)
+func (ind *Indicator) Stop() {
+	if ind == nil {
+		return
+	}
+
+	ind.stopOnce.Do(func() {
+		close(ind.doneCh)
+	})
+
+	ind.wg.Wait()
+}
+
+// Update sets the processed files and bytes for the phase
+// (the zero totals mean the totals are not known)
+func (ind *Indicator) Update(files, totalFiles, bytes, totalBytes int64) {
+	if ind == nil {
+		return
+	}
+
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+
+	ind.hasCounts = true
+	ind.files = files
+	ind.totalFiles = totalFiles
+	ind.bytes = bytes
+	ind.totalBytes = totalBytes
+}
+
+func (ind *Indicator) elapsed() time.Duration {
+	return time.Since(ind.start) / time.Second * time.Second
+}
+
+// eta returns the estimated remaining time (from the processed bytes or files)
+func (ind *Indicator) eta() (time.Duration, bool) {
+	done, total := ind.bytes, ind.totalBytes
+	if total <= 0 {
+		done, total = ind.files, ind.totalFiles
+	}
+
+	if done <= 0 || total <= 0 || done > total {
+		return 0, false
+	}
+
+	elapsed := time.Since(ind.start)
+	remaining := time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+	return remaining / time.Second * time.Second, true
+}
+
+// counts returns the progress fields for the status lines (empty if the phase doesn't report its progress)
+func (ind *Indicator) counts(human bool) string {
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+
+	if !ind.hasCounts {
+		return ""
+	}
+
+	files := fmt.Sprintf("%v", ind.files)
+	if ind.totalFiles > 0 {
+		files = fmt.Sprintf("%v/%v", ind.files, ind.totalFiles)
+	}
+
+	var data string
+	if human {
+		data = humanize.Bytes(uint64(ind.bytes))
+		if ind.totalBytes > 0 {
+			data = fmt.Sprintf("%s/%s", data, humanize.Bytes(uint64(ind.totalBytes)))
+		}
+	} else {
+		data = fmt.Sprintf("%v", ind.bytes)
+		if ind.totalBytes > 0 {
+			data = fmt.Sprintf("%v/%v", ind.bytes, ind.totalBytes)
+		}
+	}
+
+	info := fmt.Sprintf(" files=%s bytes=%s", files, data)
+	if eta, ok := ind.eta(); ok {
+		info += fmt.Sprintf(" eta=%v", eta)
+	}
+
+	return info
+}
+
+func (ind *Indicator) runStatus(doneCh <-chan struct{}) {
+	defer ind.wg.Done()
+	ticker := time.NewTicker(StatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneCh:
+			return
+		case <-ticker.C:
+			fmt.Printf("%s info=progress event.id=%s phase=%s elapsed=%v%s\n",
+				ind.prefix, status.IDProgress, ind.phase, ind.elapsed(), ind.counts(false))
+		}
+	}
+}
+
+func (ind *Indicator) runSpinner(doneCh <-chan struct{}) {
+	defer ind.wg.Done()
+	ticker := time.NewTicker(SpinnerInterval)
+	defer ticker.Stop()
+
+	for idx := 0; ; idx++ {
+		select {
+		case <-doneCh:
+			fmt.Print(clearLine)
+			return
+		case <-ticker.C:
+			frame := spinnerFrames[idx%len(spinnerFrames)]
+			if !noColor {
+				frame = colorStart + frame + colorEnd
+			}
+
+			fmt.Printf("%s%s %s %s (%v)%s", clearLine, ind.prefix, frame, ind.phase, ind.elapsed(), ind.counts(true))
+		}
+	}
+}
@@ -6,33 +6,153 @@ import (
 	"path/filepath"
 	"text/template"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
 	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 const appArmorTemplate = `
-profile {{.ProfileName}} flags=(attach_disconnected,mediate_deleted) {
-
-  network,
+profile {{.ProfileName}} flags=({{.Flags}}) {
 
+{{range $value := .NetworkRules}}  {{$value}},
+{{end}}
+{{range $value := .CapabilityRules}}  capability {{$value}},
+{{end}}
 {{range $value := .ExeFileRules}}  {{$value.FilePath}} {{$value.PermSet}},
 {{end}}
-{{range $value := .WriteFileRules}}  {{$value.FilePath}} {{$value.PermSet}},
+{{range $value := .WriteFileRules}}  {{if $value.Owner}}owner {{end}}{{$value.FilePath}} {{$value.PermSet}},
 {{end}}
 {{range $value := .ReadFileRules}}  {{$value.FilePath}} {{$value.PermSet}},
 {{end}}
 }
 `
 
+const (
+	profileFlags          = "attach_disconnected,mediate_deleted"
+	complainFlag          = "complain"
+	complainProfileSuffix = "-complain"
+)
+
 type appArmorFileRule struct {
 	FilePath string
 	PermSet  string
+	Owner    bool
 }
 
 type appArmorProfileData struct {
-	ProfileName    string
-	ExeFileRules   []appArmorFileRule
-	WriteFileRules []appArmorFileRule
-	ReadFileRules  []appArmorFileRule
+	ProfileName     string
+	Flags           string
+	NetworkRules    []string
+	CapabilityRules []string
+	ExeFileRules    []appArmorFileRule
+	WriteFileRules  []appArmorFileRule
+	ReadFileRules   []appArmorFileRule
+}
+
+// the syscalls that create or use sockets
+var socketCalls = map[string]bool{
+	"socket":     true,
+	"socketcall": true,
+	"socketpair": true,
+	"connect":    true,
+	"bind":       true,
+	"listen":     true,
+	"accept":     true,
+	"accept4":    true,
+	"sendto":     true,
+	"recvfrom":   true,
+	"sendmsg":    true,
+	"recvmsg":    true,
+	"sendmmsg":   true,
+	"recvmmsg":   true,
+}
+
+// the socket syscalls used only with the connection based sockets
+var streamCalls = map[string]bool{
+	"listen":  true,
+	"accept":  true,
+	"accept4": true,
+}
+
+// the socket syscalls usually used with the datagram sockets
+var datagramCalls = map[string]bool{
+	"sendto":   true,
+	"recvfrom": true,
+	"sendmmsg": true,
+	"recvmmsg": true,
+}
+
+// ComplainProfileName returns the name of the complain mode variant of the profile
+func ComplainProfileName(profileName string) string {
+	return profileName + complainProfileSuffix
+}
+
+// networkRules returns the network rules for the selected mode
+// (in the 'observed' mode the rules are based on the socket syscalls the container made)
+func networkRules(mode string, calls map[string]bool) []string {
+	switch mode {
+	case config.AppArmorNetworkNone:
+		return nil
+	case config.AppArmorNetworkObserved:
+		if len(calls) == 0 {
+			log.Warn("docker-slim: no syscall data for the AppArmor network rules (allowing all network access)")
+			return []string{"network"}
+		}
+	default:
+		return []string{"network"}
+	}
+
+	usesSockets := false
+	hasStream := false
+	hasDatagram := false
+	for name := range calls {
+		if !socketCalls[name] {
+			continue
+		}
+
+		usesSockets = true
+		if streamCalls[name] {
+			hasStream = true
+		}
+
+		if datagramCalls[name] {
+			hasDatagram = true
+		}
+	}
+
+	if !usesSockets {
+		return nil
+	}
+
+	rules := []string{"network unix"}
+	//the client sockets are connected without listen/accept, so they are allowed when there are no datagram calls too
+	if hasStream || !hasDatagram {
+		rules = append(rules, "network inet stream", "network inet6 stream")
+	}
+
+	if hasDatagram {
+		rules = append(rules, "network inet dgram", "network inet6 dgram")
+	}
+
+	return rules
+}
+
+func writeProfile(profilePath string, profileData *appArmorProfileData) error {
+	profileFile, err := os.OpenFile(profilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer profileFile.Close()
+
+	t, err := template.New("profile").Parse(appArmorTemplate)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(profileFile, profileData)
 }
 
 //TODO:
@@ -41,7 +161,12 @@ type appArmorProfileData struct {
 //2. w/r operation info (so we can add useful write rules)
 
 // GenProfile creates an AppArmor profile
-func GenProfile(artifactLocation string, profileName string) error {
+// (and its complain mode variant if it's enabled in the options)
+func GenProfile(artifactLocation string, profileName string, options *config.AppArmorOptions) error {
+	if options == nil {
+		options = &config.AppArmorOptions{}
+	}
+
 	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
 
 	if _, err := os.Stat(containerReportFilePath); err != nil {
@@ -58,16 +183,16 @@ func GenProfile(artifactLocation string, profileName string) error {
 		return err
 	}
 
-	profilePath := filepath.Join(artifactLocation, profileName)
-
-	profileFile, err := os.OpenFile(profilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return err
+	calls := capabilities.ObservedCalls(&creport)
+	profileData := appArmorProfileData{
+		ProfileName:  profileName,
+		Flags:        profileFlags,
+		NetworkRules: networkRules(options.Network, calls),
 	}
 
-	defer profileFile.Close()
-
-	profileData := appArmorProfileData{ProfileName: profileName}
+	if options.Capabilities {
+		profileData.CapabilityRules = capabilities.FromSyscalls(calls)
+	}
 
 	for _, aprops := range creport.Image.Files {
 		if aprops == nil {
@@ -93,6 +218,7 @@ func GenProfile(artifactLocation string, profileName string) error {
 					appArmorFileRule{
 						FilePath: aprops.FilePath,
 						PermSet:  report.PermSetFromFlags(aprops.Flags),
+						Owner:    options.OwnerFiles,
 					})
 			case aprops.Flags["R"]:
 				profileData.ReadFileRules = append(profileData.ReadFileRules,
@@ -107,13 +233,16 @@ func GenProfile(artifactLocation string, profileName string) error {
 		}
 	}
 
-	t, err := template.New("profile").Parse(appArmorTemplate)
-	if err != nil {
+	if err := writeProfile(filepath.Join(artifactLocation, profileName), &profileData); err != nil {
 		return err
 	}
 
-	if err := t.Execute(profileFile, profileData); err != nil {
-		return err
+	if options.Complain {
+		profileData.ProfileName = ComplainProfileName(profileName)
+		profileData.Flags = profileFlags + "," + complainFlag
+		if err := writeProfile(filepath.Join(artifactLocation, profileData.ProfileName), &profileData); err != nil {
+			return err
+		}
 	}
 
 	return nil
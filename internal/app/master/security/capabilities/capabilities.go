@@ -0,0 +1,189 @@
+package capabilities
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// the capabilities the observed syscalls may need (when the container runs as root)
+var syscallCapabilities = map[string]string{
+	"chown":              "chown",
+	"chown32":            "chown",
+	"fchown":             "chown",
+	"fchown32":           "chown",
+	"fchownat":           "chown",
+	"lchown":             "chown",
+	"lchown32":           "chown",
+	"chmod":              "fowner",
+	"fchmod":             "fowner",
+	"fchmodat":           "fowner",
+	"utimensat":          "fowner",
+	"setuid":             "setuid",
+	"setuid32":           "setuid",
+	"setreuid":           "setuid",
+	"setreuid32":         "setuid",
+	"setresuid":          "setuid",
+	"setresuid32":        "setuid",
+	"setfsuid":           "setuid",
+	"setfsuid32":         "setuid",
+	"setgid":             "setgid",
+	"setgid32":           "setgid",
+	"setregid":           "setgid",
+	"setregid32":         "setgid",
+	"setresgid":          "setgid",
+	"setresgid32":        "setgid",
+	"setfsgid":           "setgid",
+	"setfsgid32":         "setgid",
+	"setgroups":          "setgid",
+	"setgroups32":        "setgid",
+	"kill":               "kill",
+	"tkill":              "kill",
+	"tgkill":             "kill",
+	"bind":               "net_bind_service",
+	"chroot":             "sys_chroot",
+	"mknod":              "mknod",
+	"mknodat":            "mknod",
+	"ptrace":             "sys_ptrace",
+	"setpriority":        "sys_nice",
+	"sched_setscheduler": "sys_nice",
+	"sched_setparam":     "sys_nice",
+	"sched_setattr":      "sys_nice",
+	"setrlimit":          "sys_resource",
+	"prlimit64":          "sys_resource",
+	"mount":              "sys_admin",
+	"umount2":            "sys_admin",
+	"pivot_root":         "sys_admin",
+	"sethostname":        "sys_admin",
+	"setns":              "sys_admin",
+	"unshare":            "sys_admin",
+}
+
+// the Linux capability names (uppercase names without the 'CAP_' prefix)
+var knownCapabilities = map[string]bool{
+	"AUDIT_CONTROL":      true,
+	"AUDIT_READ":         true,
+	"AUDIT_WRITE":        true,
+	"BLOCK_SUSPEND":      true,
+	"BPF":                true,
+	"CHECKPOINT_RESTORE": true,
+	"CHOWN":              true,
+	"DAC_OVERRIDE":       true,
+	"DAC_READ_SEARCH":    true,
+	"FOWNER":             true,
+	"FSETID":             true,
+	"IPC_LOCK":           true,
+	"IPC_OWNER":          true,
+	"KILL":               true,
+	"LEASE":              true,
+	"LINUX_IMMUTABLE":    true,
+	"MAC_ADMIN":          true,
+	"MAC_OVERRIDE":       true,
+	"MKNOD":              true,
+	"NET_ADMIN":          true,
+	"NET_BIND_SERVICE":   true,
+	"NET_BROADCAST":      true,
+	"NET_RAW":            true,
+	"PERFMON":            true,
+	"SETFCAP":            true,
+	"SETGID":             true,
+	"SETPCAP":            true,
+	"SETUID":             true,
+	"SYSLOG":             true,
+	"SYS_ADMIN":          true,
+	"SYS_BOOT":           true,
+	"SYS_CHROOT":         true,
+	"SYS_MODULE":         true,
+	"SYS_NICE":           true,
+	"SYS_PACCT":          true,
+	"SYS_PTRACE":         true,
+	"SYS_RAWIO":          true,
+	"SYS_RESOURCE":       true,
+	"SYS_TIME":           true,
+	"SYS_TTY_CONFIG":     true,
+	"WAKE_ALARM":         true,
+}
+
+// Normalize returns the capability name in the Docker format
+// (uppercase without the 'CAP_' prefix, e.g., 'cap_net_admin' => 'NET_ADMIN').
+// It returns false if the capability is unknown ('ALL' is accepted).
+func Normalize(name string) (string, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "CAP_")
+	return name, name == "ALL" || knownCapabilities[name]
+}
+
+// ObservedCalls returns the names of the syscalls in the container report
+func ObservedCalls(creport *report.ContainerReport) map[string]bool {
+	if creport.Monitors.Pt == nil {
+		return nil
+	}
+
+	calls := map[string]bool{}
+	for _, scInfo := range creport.Monitors.Pt.SyscallStats {
+		calls[scInfo.Name] = true
+	}
+
+	return calls
+}
+
+// FromSyscalls returns the capabilities (lowercase names without the 'cap_' prefix)
+// the syscalls may need
+func FromSyscalls(calls map[string]bool) []string {
+	known := map[string]bool{}
+	var names []string
+	for name := range calls {
+		if capName, ok := syscallCapabilities[name]; ok && !known[capName] {
+			known[capName] = true
+			names = append(names, capName)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// IsRootUser returns true if the container user is root
+// (an empty user means the default user, root)
+func IsRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
+
+// Recommend returns the minimal capability set for the container
+// (the non-root containers don't need any capabilities, their processes don't get the container capabilities)
+func Recommend(calls map[string]bool, user string) *report.CapabilitySet {
+	recommendation := &report.CapabilitySet{
+		Drop: []string{"ALL"},
+		Add:  []string{},
+	}
+
+	if IsRootUser(user) {
+		for _, name := range FromSyscalls(calls) {
+			recommendation.Add = append(recommendation.Add, strings.ToUpper(name))
+		}
+	}
+
+	var runArgs bytes.Buffer
+	runArgs.WriteString("--cap-drop ALL")
+	for _, name := range recommendation.Add {
+		fmt.Fprintf(&runArgs, " --cap-add %s", name)
+	}
+
+	recommendation.DockerRunArgs = runArgs.String()
+
+	var compose bytes.Buffer
+	compose.WriteString("cap_drop:\n  - ALL\n")
+	if len(recommendation.Add) > 0 {
+		compose.WriteString("cap_add:\n")
+		for _, name := range recommendation.Add {
+			fmt.Fprintf(&compose, "  - %s\n", name)
+		}
+	}
+
+	recommendation.ComposeSnippet = compose.String()
+	return recommendation
+}
@@ -0,0 +1,140 @@
+package gvisor
+
+import (
+	"sort"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// gVisor syscall support levels
+const (
+	SupportNone    = "unsupported"
+	SupportPartial = "partial"
+)
+
+// Compatibility verdicts
+const (
+	VerdictCompatible = "compatible"
+	VerdictLikely     = "likely"
+	VerdictUnlikely   = "unlikely"
+)
+
+type callSupport struct {
+	level string
+	note  string
+}
+
+// the syscalls gVisor doesn't implement or implements only partially
+// (based on the gVisor syscall compatibility reference for linux/amd64;
+// the syscalls that are not here are implemented, the list changes with the gVisor releases)
+var callSupportMap = map[string]callSupport{
+	"_sysctl":           {SupportNone, "not implemented"},
+	"acct":              {SupportNone, "not implemented"},
+	"add_key":           {SupportNone, "not implemented (no kernel keyring)"},
+	"request_key":       {SupportNone, "not implemented (no kernel keyring)"},
+	"keyctl":            {SupportPartial, "only the session keyring operations are implemented"},
+	"afs_syscall":       {SupportNone, "not implemented"},
+	"bpf":               {SupportNone, "not implemented (no eBPF)"},
+	"clock_adjtime":     {SupportNone, "the sandbox can't change the host clock"},
+	"clock_settime":     {SupportNone, "the sandbox can't change the host clock"},
+	"settimeofday":      {SupportNone, "the sandbox can't change the host clock"},
+	"adjtimex":          {SupportPartial, "only the read-only mode is implemented"},
+	"create_module":     {SupportNone, "not implemented (no kernel modules)"},
+	"init_module":       {SupportNone, "not implemented (no kernel modules)"},
+	"finit_module":      {SupportNone, "not implemented (no kernel modules)"},
+	"delete_module":     {SupportNone, "not implemented (no kernel modules)"},
+	"get_kernel_syms":   {SupportNone, "not implemented (no kernel modules)"},
+	"query_module":      {SupportNone, "not implemented (no kernel modules)"},
+	"kexec_load":        {SupportNone, "not implemented"},
+	"kexec_file_load":   {SupportNone, "not implemented"},
+	"fanotify_init":     {SupportNone, "not implemented (use inotify)"},
+	"fanotify_mark":     {SupportNone, "not implemented (use inotify)"},
+	"ioperm":            {SupportNone, "not implemented (no direct I/O port access)"},
+	"iopl":              {SupportNone, "not implemented (no direct I/O port access)"},
+	"io_uring_setup":    {SupportPartial, "disabled by default (needs the runsc --iouring flag)"},
+	"io_uring_enter":    {SupportPartial, "disabled by default (needs the runsc --iouring flag)"},
+	"io_uring_register": {SupportPartial, "disabled by default (needs the runsc --iouring flag)"},
+	"kcmp":              {SupportNone, "not implemented"},
+	"lookup_dcookie":    {SupportNone, "not implemented"},
+	"migrate_pages":     {SupportNone, "not implemented"},
+	"move_pages":        {SupportNone, "not implemented"},
+	"mbind":             {SupportPartial, "the memory policy is stored, but not enforced"},
+	"get_mempolicy":     {SupportPartial, "the memory policy is stored, but not enforced"},
+	"set_mempolicy":     {SupportPartial, "the memory policy is stored, but not enforced"},
+	"modify_ldt":        {SupportNone, "not implemented"},
+	"mount":             {SupportPartial, "only some filesystem types (e.g., tmpfs, proc, sysfs, overlay) can be mounted"},
+	"umount2":           {SupportPartial, "only the sandbox mounts can be unmounted"},
+	"name_to_handle_at": {SupportNone, "not implemented"},
+	"open_by_handle_at": {SupportNone, "not implemented"},
+	"nfsservctl":        {SupportNone, "not implemented"},
+	"perf_event_open":   {SupportNone, "not implemented (no performance counters)"},
+	"personality":       {SupportPartial, "only the default Linux personality is supported"},
+	"pkey_alloc":        {SupportNone, "not implemented (no memory protection keys)"},
+	"pkey_free":         {SupportNone, "not implemented (no memory protection keys)"},
+	"pkey_mprotect":     {SupportNone, "not implemented (no memory protection keys)"},
+	"ptrace":            {SupportPartial, "some requests are not implemented (debuggers and tracers may not work)"},
+	"quotactl":          {SupportNone, "not implemented"},
+	"reboot":            {SupportPartial, "only the sandbox can be shut down"},
+	"remap_file_pages":  {SupportNone, "not implemented"},
+	"security":          {SupportNone, "not implemented"},
+	"swapon":            {SupportNone, "not implemented"},
+	"swapoff":           {SupportNone, "not implemented"},
+	"sysfs":             {SupportNone, "not implemented"},
+	"syslog":            {SupportPartial, "only the sandbox log is available"},
+	"tuxcall":           {SupportNone, "not implemented"},
+	"uselib":            {SupportNone, "not implemented"},
+	"userfaultfd":       {SupportNone, "not implemented"},
+	"ustat":             {SupportNone, "not implemented"},
+	"vhangup":           {SupportNone, "not implemented"},
+	"vserver":           {SupportNone, "not implemented"},
+	"getpmsg":           {SupportNone, "not implemented"},
+	"putpmsg":           {SupportNone, "not implemented"},
+	"sched_setattr":     {SupportNone, "not implemented"},
+	"sched_getattr":     {SupportNone, "not implemented"},
+	"seccomp":           {SupportPartial, "only the filter mode without the user notifications is implemented"},
+	"setns":             {SupportPartial, "only some namespace types are supported"},
+	"unshare":           {SupportPartial, "only some namespace types are supported"},
+}
+
+// Check compares the observed syscalls with the syscalls gVisor supports
+// and returns the gVisor (runsc) compatibility verdict for the container
+func Check(calls map[string]bool) *report.GVisorCompatibility {
+	compat := &report.GVisorCompatibility{
+		Verdict: VerdictCompatible,
+	}
+
+	var names []string
+	for name := range calls {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		support, ok := callSupportMap[name]
+		if !ok {
+			continue
+		}
+
+		compat.Syscalls = append(compat.Syscalls, report.GVisorSyscall{
+			Name:    name,
+			Support: support.level,
+			Note:    support.note,
+		})
+
+		switch support.level {
+		case SupportNone:
+			compat.Unsupported = append(compat.Unsupported, name)
+		case SupportPartial:
+			compat.Partial = append(compat.Partial, name)
+		}
+	}
+
+	switch {
+	case len(compat.Unsupported) > 0:
+		compat.Verdict = VerdictUnlikely
+	case len(compat.Partial) > 0:
+		compat.Verdict = VerdictLikely
+	}
+
+	return compat
+}
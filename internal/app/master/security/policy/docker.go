@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+)
+
+const dockerRunTemplate = `#!/bin/sh
+# runs the minified image ({{.ImageName}}) with the generated security profiles
+# (load the AppArmor profile first: apparmor_parser -r -W {{.AppArmorProfilePath}})
+{{.RunCommand}}
+`
+
+const composeTemplate = `# the compose service for the minified image ({{.ImageName}})
+# (load the AppArmor profile first: apparmor_parser -r -W {{.AppArmorProfilePath}})
+services:
+  {{.Name}}:
+    image: {{.ImageName}}
+{{- if .Ports}}
+    ports:
+{{- range $port := .Ports}}
+      - "{{$port}}"
+{{- end}}
+{{- end}}
+    security_opt:
+{{- range $opt := .SecurityOpts}}
+      - {{$opt}}
+{{- end}}
+    cap_drop:
+      - ALL
+{{- if .AddCapabilities}}
+    cap_add:
+{{- range $name := .AddCapabilities}}
+      - {{$name}}
+{{- end}}
+{{- end}}
+{{- if .ReadOnly}}
+    read_only: true
+{{- if .TmpfsDirs}}
+    tmpfs:
+{{- range $dir := .TmpfsDirs}}
+      - {{$dir}}
+{{- end}}
+{{- end}}
+{{- end}}
+`
+
+type dockerRunData struct {
+	Name                string
+	ImageName           string
+	AppArmorProfilePath string
+	Ports               []string
+	SecurityOpts        []string
+	AddCapabilities     []string
+	ReadOnly            bool
+	TmpfsDirs           []string
+	RunCommand          string
+}
+
+func (d *dockerRunData) runCommand(multiline bool) string {
+	separator := " "
+	if multiline {
+		separator = " \\\n  "
+	}
+
+	args := []string{"docker run -d"}
+	for _, port := range d.Ports {
+		args = append(args, fmt.Sprintf("-p %s", port))
+	}
+
+	for _, opt := range d.SecurityOpts {
+		args = append(args, fmt.Sprintf("--security-opt %s", opt))
+	}
+
+	args = append(args, "--cap-drop ALL")
+	for _, name := range d.AddCapabilities {
+		args = append(args, fmt.Sprintf("--cap-add %s", name))
+	}
+
+	if d.ReadOnly {
+		args = append(args, "--read-only")
+		for _, dir := range d.TmpfsDirs {
+			args = append(args, fmt.Sprintf("--tmpfs %s", dir))
+		}
+	}
+
+	args = append(args, d.ImageName)
+	return strings.Join(args, separator)
+}
+
+func executeTemplate(text string, data interface{}) ([]byte, error) {
+	t, err := template.New("snippet").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	if err := t.Execute(&output, data); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+// GenDockerRun creates the 'docker run' script and the compose service for the minified image
+// (with the generated seccomp and AppArmor profiles, the recommended capabilities and the exposed ports).
+// It returns the 'docker run' command.
+func GenDockerRun(artifactLocation string,
+	runName string,
+	composeName string,
+	props *ImageProperties,
+	seccompProfileName string,
+	appArmorProfileName string) (string, error) {
+	creport, err := loadContainerReport(artifactLocation)
+	if err != nil {
+		return "", err
+	}
+
+	data := &dockerRunData{
+		Name:                k8sName(props.ImageName),
+		ImageName:           props.ImageName,
+		AppArmorProfilePath: filepath.Join(artifactLocation, appArmorProfileName),
+		SecurityOpts: []string{
+			fmt.Sprintf("seccomp=%s", filepath.Join(artifactLocation, seccompProfileName)),
+			fmt.Sprintf("apparmor=%s", appArmorProfileName),
+			"no-new-privileges:true",
+		},
+	}
+
+	exposedPorts := append([]string{}, props.ExposedPorts...)
+	sort.Strings(exposedPorts)
+	for _, portSpec := range exposedPorts {
+		port := strings.SplitN(portSpec, "/", 2)[0]
+		data.Ports = append(data.Ports, fmt.Sprintf("%s:%s", port, portSpec))
+	}
+
+	if calls := capabilities.ObservedCalls(creport); len(calls) > 0 {
+		data.AddCapabilities = capabilities.Recommend(calls, props.User).Add
+	}
+
+	var otherDirs []string
+	data.TmpfsDirs, otherDirs = writableDirs(creport)
+	data.ReadOnly = len(otherDirs) == 0
+
+	data.RunCommand = data.runCommand(true)
+	runScript, err := executeTemplate(dockerRunTemplate, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(artifactLocation, runName), runScript, 0755); err != nil {
+		return "", err
+	}
+
+	composeData, err := executeTemplate(composeTemplate, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(artifactLocation, composeName), composeData, 0644); err != nil {
+		return "", err
+	}
+
+	return data.runCommand(false), nil
+}
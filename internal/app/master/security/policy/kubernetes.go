@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// the kubelet seccomp profile directory subdirectory for the localhost profiles
+const seccompLocalhostDir = "profiles"
+
+// the directories that can be replaced with emptyDir volumes
+// (the applications use them for temporary data, so they don't need the image content)
+var scratchDirs = []string{
+	"/tmp",
+	"/var/tmp",
+	"/run",
+	"/var/run",
+	"/var/cache",
+}
+
+const podSpecTemplate = `# the Kubernetes pod security settings for the minified image ({{.ImageName}})
+# copy {{.SeccompProfileName}} to the kubelet seccomp directory on the nodes (/var/lib/kubelet/seccomp/{{.SeccompProfilePath}})
+# and load {{.AppArmorProfileName}} on the nodes (apparmor_parser -r -W {{.AppArmorProfileName}})
+apiVersion: v1
+kind: Pod
+metadata:
+  name: {{.Name}}
+  annotations:
+    container.apparmor.security.beta.kubernetes.io/{{.Name}}: localhost/{{.AppArmorProfileName}}
+spec:
+  securityContext:
+{{- if .RunAsRoot}}
+    # the minified image runs as root (set runAsNonRoot to true and runAsUser after you change the image user)
+    runAsNonRoot: false
+{{- else}}
+    runAsNonRoot: true
+{{- if .RunAsUser}}
+    runAsUser: {{.RunAsUser}}
+{{- else}}
+    # the image user is a user name ({{.User}}), set runAsUser to its numeric ID
+{{- end}}
+{{- if .RunAsGroup}}
+    runAsGroup: {{.RunAsGroup}}
+{{- end}}
+{{- end}}
+    seccompProfile:
+      type: Localhost
+      localhostProfile: {{.SeccompProfilePath}}
+  containers:
+    - name: {{.Name}}
+      image: {{.ImageName}}
+{{- if .Ports}}
+      ports:
+{{- range $port := .Ports}}
+        - containerPort: {{$port.Port}}
+          protocol: {{$port.Protocol}}
+{{- end}}
+{{- end}}
+      securityContext:
+        allowPrivilegeEscalation: false
+        readOnlyRootFilesystem: {{.ReadOnlyRootFS}}
+{{- range $dir := .WritableDirs}}
+        # the container writes to {{$dir}}
+{{- end}}
+        capabilities:
+          drop: ["ALL"]
+{{- if .AddCapabilities}}
+          add: [{{range $i, $name := .AddCapabilities}}{{if $i}}, {{end}}"{{$name}}"{{end}}]
+{{- end}}
+{{- if .ScratchDirs}}
+      volumeMounts:
+{{- range $i, $dir := .ScratchDirs}}
+        - name: scratch-{{$i}}
+          mountPath: {{$dir}}
+{{- end}}
+  volumes:
+{{- range $i, $dir := .ScratchDirs}}
+    - name: scratch-{{$i}}
+      emptyDir: {}
+{{- end}}
+{{- end}}
+`
+
+type podPort struct {
+	Port     string
+	Protocol string
+}
+
+type podSpecData struct {
+	Name                string
+	ImageName           string
+	User                string
+	RunAsRoot           bool
+	RunAsUser           string
+	RunAsGroup          string
+	Ports               []podPort
+	ReadOnlyRootFS      bool
+	WritableDirs        []string
+	ScratchDirs         []string
+	AddCapabilities     []string
+	SeccompProfileName  string
+	SeccompProfilePath  string
+	AppArmorProfileName string
+}
+
+func loadContainerReport(artifactLocation string) (*report.ContainerReport, error) {
+	reportFile, err := os.Open(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer reportFile.Close()
+
+	var creport report.ContainerReport
+	if err = json.NewDecoder(reportFile).Decode(&creport); err != nil {
+		return nil, err
+	}
+
+	return &creport, nil
+}
+
+func numericID(value string) string {
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return ""
+	}
+
+	return value
+}
+
+func scratchDir(filePath string) string {
+	for _, dir := range scratchDirs {
+		if filePath == dir || strings.HasPrefix(filePath, dir+"/") {
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// writableDirs returns the scratch directories and the other directories the container wrote to
+func writableDirs(creport *report.ContainerReport) ([]string, []string) {
+	scratch := map[string]bool{}
+	other := map[string]bool{}
+	for _, props := range creport.Image.Files {
+		if props == nil || !props.Flags["W"] {
+			continue
+		}
+
+		if dir := scratchDir(props.FilePath); dir != "" {
+			scratch[dir] = true
+		} else {
+			other[path.Dir(props.FilePath)] = true
+		}
+	}
+
+	toList := func(dirs map[string]bool) []string {
+		var list []string
+		for dir := range dirs {
+			list = append(list, dir)
+		}
+
+		sort.Strings(list)
+		return list
+	}
+
+	return toList(scratch), toList(other)
+}
+
+// GenPodSpec creates the Kubernetes pod spec snippet with the security settings for the minified image
+// (the user, the capabilities, the generated seccomp and AppArmor profiles
+// and the read-only root filesystem if the container writes only to the scratch directories)
+func GenPodSpec(artifactLocation string,
+	specName string,
+	props *ImageProperties,
+	seccompProfileName string,
+	appArmorProfileName string) error {
+	creport, err := loadContainerReport(artifactLocation)
+	if err != nil {
+		return err
+	}
+
+	data := &podSpecData{
+		Name:                k8sName(props.ImageName),
+		ImageName:           props.ImageName,
+		User:                props.User,
+		RunAsRoot:           capabilities.IsRootUser(props.User),
+		SeccompProfileName:  seccompProfileName,
+		SeccompProfilePath:  path.Join(seccompLocalhostDir, seccompProfileName),
+		AppArmorProfileName: appArmorProfileName,
+	}
+
+	userParts := strings.SplitN(props.User, ":", 2)
+	data.RunAsUser = numericID(userParts[0])
+	if len(userParts) > 1 {
+		data.RunAsGroup = numericID(userParts[1])
+	}
+
+	exposedPorts := append([]string{}, props.ExposedPorts...)
+	sort.Strings(exposedPorts)
+	for _, portSpec := range exposedPorts {
+		parts := strings.SplitN(portSpec, "/", 2)
+		port := podPort{Port: parts[0], Protocol: "TCP"}
+		if len(parts) > 1 {
+			port.Protocol = strings.ToUpper(parts[1])
+		}
+
+		data.Ports = append(data.Ports, port)
+	}
+
+	if calls := capabilities.ObservedCalls(creport); len(calls) > 0 {
+		data.AddCapabilities = capabilities.Recommend(calls, props.User).Add
+	}
+
+	data.ScratchDirs, data.WritableDirs = writableDirs(creport)
+	data.ReadOnlyRootFS = len(data.WritableDirs) == 0
+	if !data.ReadOnlyRootFS {
+		data.ScratchDirs = nil
+	}
+
+	t, err := template.New("podspec").Parse(podSpecTemplate)
+	if err != nil {
+		return err
+	}
+
+	specFile, err := os.OpenFile(filepath.Join(artifactLocation, specName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer specFile.Close()
+
+	return t.Execute(specFile, data)
+}
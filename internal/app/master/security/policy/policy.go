@@ -0,0 +1,215 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+)
+
+// the headroom for the image size ceiling (over the minified image size)
+const sizeCeilingMargin = 0.1
+
+// the policy for the 'docker image inspect' output (it works with conftest and opa eval)
+const regoPolicyTemplate = `# the expected properties of the minified image ({{.ImageName}})
+# usage: docker image inspect {{.ImageName}} --format '{{"{{"}}json .{{"}}"}}' | conftest test --namespace dockerslim.image --policy {{.PolicyName}} -
+package dockerslim.image
+
+# the minified image runs as {{if .RequireNonRoot}}a non-root user{{else}}root (set it to true after you change the image user){{end}}
+require_non_root := {{.RequireNonRoot}}
+
+allowed_ports := { {{- range $i, $port := .ExposedPorts}}{{if $i}}, {{end}}"{{$port}}"{{end -}} }
+
+max_size := {{.MaxSize}}
+
+image_user := object.get(input.Config, "User", "")
+
+non_root_user {
+	name := split(image_user, ":")[0]
+	name != ""
+	name != "root"
+	name != "0"
+}
+
+deny[msg] {
+	require_non_root
+	not non_root_user
+	msg := sprintf("the image must run as a non-root user (user: '%v')", [image_user])
+}
+
+deny[msg] {
+	input.Config.ExposedPorts[port]
+	not allowed_ports[port]
+	msg := sprintf("the image exposes a port the minified image doesn't expose: %v", [port])
+}
+
+deny[msg] {
+	input.Size > max_size
+	msg := sprintf("the image is larger than the size ceiling (%v > %v)", [input.Size, max_size])
+}
+`
+
+// the Gatekeeper constraint template and the example constraint for the minified image
+// (the image size can't be checked at admission time, so it's not in the constraint)
+const constraintTemplateTemplate = `apiVersion: templates.gatekeeper.sh/v1beta1
+kind: ConstraintTemplate
+metadata:
+  name: dockerslimimage
+spec:
+  crd:
+    spec:
+      names:
+        kind: DockerSlimImage
+      validation:
+        openAPIV3Schema:
+          properties:
+            image:
+              type: string
+            requireNonRoot:
+              type: boolean
+            allowedPorts:
+              type: array
+              items:
+                type: string
+  targets:
+    - target: admission.k8s.gatekeeper.sh
+      rego: |
+        package dockerslimimage
+
+        input_containers[c] {
+          c := input.review.object.spec.containers[_]
+        }
+
+        input_containers[c] {
+          c := input.review.object.spec.initContainers[_]
+        }
+
+        slim_image(image) {
+          image == input.parameters.image
+        }
+
+        slim_image(image) {
+          startswith(image, concat("", [input.parameters.image, ":"]))
+        }
+
+        slim_image(image) {
+          startswith(image, concat("", [input.parameters.image, "@"]))
+        }
+
+        run_as_non_root(c) {
+          c.securityContext.runAsNonRoot
+        }
+
+        run_as_non_root(c) {
+          c.securityContext.runAsUser > 0
+        }
+
+        run_as_non_root(c) {
+          not c.securityContext.runAsNonRoot == false
+          input.review.object.spec.securityContext.runAsNonRoot
+        }
+
+        allowed_port(port) {
+          protocol := lower(object.get(port, "protocol", "TCP"))
+          spec := sprintf("%v/%v", [port.containerPort, protocol])
+          spec == input.parameters.allowedPorts[_]
+        }
+
+        violation[{"msg": msg}] {
+          c := input_containers[_]
+          slim_image(c.image)
+          input.parameters.requireNonRoot
+          not run_as_non_root(c)
+          msg := sprintf("container %v (%v) must run as a non-root user", [c.name, c.image])
+        }
+
+        violation[{"msg": msg}] {
+          c := input_containers[_]
+          slim_image(c.image)
+          port := c.ports[_]
+          not allowed_port(port)
+          msg := sprintf("container %v (%v) uses a port the minified image doesn't expose: %v", [c.name, c.image, port.containerPort])
+        }
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: DockerSlimImage
+metadata:
+  name: {{.ConstraintName}}
+spec:
+  match:
+    kinds:
+      - apiGroups: [""]
+        kinds: ["Pod"]
+  parameters:
+    image: "{{.ImageName}}"
+    requireNonRoot: {{.RequireNonRoot}}
+    allowedPorts: [ {{- range $i, $port := .ExposedPorts}}{{if $i}}, {{end}}"{{$port}}"{{end -}} ]
+`
+
+// ImageProperties are the minified image properties the policies assert
+type ImageProperties struct {
+	ImageName    string
+	User         string
+	ExposedPorts []string
+	Size         int64
+}
+
+type policyData struct {
+	ImageName      string
+	PolicyName     string
+	ConstraintName string
+	RequireNonRoot bool
+	ExposedPorts   []string
+	MaxSize        int64
+}
+
+func newPolicyData(policyName string, props *ImageProperties) *policyData {
+	data := &policyData{
+		ImageName:      props.ImageName,
+		PolicyName:     policyName,
+		ConstraintName: k8sName(props.ImageName),
+		RequireNonRoot: !capabilities.IsRootUser(props.User),
+		ExposedPorts:   append([]string{}, props.ExposedPorts...),
+		MaxSize:        props.Size + int64(float64(props.Size)*sizeCeilingMargin),
+	}
+
+	sort.Strings(data.ExposedPorts)
+	return data
+}
+
+// k8sName returns a Kubernetes object name for the image name
+func k8sName(imageName string) string {
+	name := strings.ToLower(imageName)
+	name = strings.NewReplacer("/", "-", ".", "-", "_", "-", ":", "-").Replace(name)
+	return strings.Trim(name, "-")
+}
+
+func writeTemplate(filePath string, text string, data *policyData) error {
+	t, err := template.New("policy").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	policyFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer policyFile.Close()
+
+	return t.Execute(policyFile, data)
+}
+
+// GenPolicies creates the Rego policy for the minified image
+// and the Gatekeeper constraint template (with an example constraint) for the Kubernetes admission checks
+func GenPolicies(artifactLocation string, policyName string, templateName string, props *ImageProperties) error {
+	data := newPolicyData(policyName, props)
+	if err := writeTemplate(filepath.Join(artifactLocation, policyName), regoPolicyTemplate, data); err != nil {
+		return err
+	}
+
+	return writeTemplate(filepath.Join(artifactLocation, templateName), constraintTemplateTemplate, data)
+}
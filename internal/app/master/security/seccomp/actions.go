@@ -0,0 +1,111 @@
+package seccomp
+
+import (
+	"sort"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+)
+
+// the actions Docker supports, but the runtime spec doesn't have
+const (
+	actLog         specs.Action = "SCMP_ACT_LOG"
+	actKillProcess specs.Action = "SCMP_ACT_KILL_PROCESS"
+)
+
+const overrideCallsLabel = "docker-slim: syscall action override"
+
+var actionMap = map[string]specs.Action{
+	config.SeccompActionAllow: specs.ActAllow,
+	config.SeccompActionErrno: specs.ActErrno,
+	config.SeccompActionKill:  actKillProcess,
+	config.SeccompActionLog:   actLog,
+	config.SeccompActionTrap:  specs.ActTrap,
+}
+
+// IsKnownAction returns true if the action can be used in the generated profile
+func IsKnownAction(name string) bool {
+	_, ok := actionMap[name]
+	return ok
+}
+
+// applyActions sets the default action and the per-syscall action overrides
+// (the overridden syscalls are removed from the other rules, so each of them has only one action)
+func applyActions(profile *specs.Seccomp, options *config.SeccompOptions) *specs.Seccomp {
+	var errnoRet *uint
+	if options.ErrnoRet != 0 {
+		value := options.ErrnoRet
+		errnoRet = &value
+	}
+
+	if action, ok := actionMap[options.DefaultAction]; ok {
+		profile.DefaultAction = action
+	}
+
+	switch {
+	case profile.DefaultAction != specs.ActErrno:
+		profile.DefaultErrnoRet = nil
+	case errnoRet != nil:
+		profile.DefaultErrnoRet = errnoRet
+	}
+
+	if len(options.Actions) == 0 {
+		return profile
+	}
+
+	var rules []*specs.Syscall
+	for _, rule := range profile.Syscalls {
+		var names []string
+		for _, name := range ruleNames(rule) {
+			if _, ok := options.Actions[name]; !ok {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+
+		filtered := *rule
+		filtered.Name = ""
+		filtered.Names = names
+		rules = append(rules, &filtered)
+	}
+
+	overrides := map[specs.Action][]string{}
+	for name, actionName := range options.Actions {
+		action := actionMap[actionName]
+		//the runtime doesn't accept the rules with the default action
+		if action == profile.DefaultAction {
+			continue
+		}
+
+		overrides[action] = append(overrides[action], name)
+	}
+
+	var actions []string
+	for action := range overrides {
+		actions = append(actions, string(action))
+	}
+
+	sort.Strings(actions)
+	for _, action := range actions {
+		names := overrides[specs.Action(action)]
+		sort.Strings(names)
+
+		rule := &specs.Syscall{
+			Names:   names,
+			Action:  specs.Action(action),
+			Comment: overrideCallsLabel,
+		}
+
+		if rule.Action == specs.ActErrno {
+			rule.ErrnoRet = errnoRet
+		}
+
+		rules = append(rules, rule)
+	}
+
+	profile.Syscalls = rules
+	return profile
+}
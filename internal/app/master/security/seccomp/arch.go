@@ -0,0 +1,188 @@
+package seccomp
+
+import (
+	"sort"
+
+	"github.com/docker-slim/docker-slim/pkg/system"
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+)
+
+var archMap = map[system.ArchName]specs.Arch{
+	system.ArchName386:   specs.ArchX86,
+	system.ArchNameAmd64: specs.ArchX86_64,
+	system.ArchNameArm32: specs.ArchARM,
+	system.ArchNameArm64: specs.ArchAARCH64,
+}
+
+// IsKnownArch returns true if the seccomp profile can be generated for the architecture
+func IsKnownArch(name string) bool {
+	_, ok := archMap[system.ArchName(name)]
+	return ok
+}
+
+// the syscalls replacing the legacy syscalls (or the syscall variants) on the other architectures
+// (e.g., arm64 doesn't have 'open', so the applications use 'openat' there;
+// the 32bit architectures use 'stat64' and 'mmap2'). The mapping works in both directions.
+var callReplacements = map[string][]string{
+	"open":         {"openat"},
+	"stat":         {"newfstatat", "fstatat64", "stat64"},
+	"lstat":        {"newfstatat", "fstatat64", "lstat64"},
+	"fstat":        {"fstat64"},
+	"newfstatat":   {"fstatat64"},
+	"access":       {"faccessat"},
+	"mkdir":        {"mkdirat"},
+	"mknod":        {"mknodat"},
+	"rmdir":        {"unlinkat"},
+	"unlink":       {"unlinkat"},
+	"rename":       {"renameat", "renameat2"},
+	"link":         {"linkat"},
+	"symlink":      {"symlinkat"},
+	"readlink":     {"readlinkat"},
+	"chmod":        {"fchmodat"},
+	"chown":        {"fchownat", "chown32"},
+	"lchown":       {"fchownat", "lchown32"},
+	"fchown":       {"fchown32"},
+	"utime":        {"utimensat"},
+	"utimes":       {"utimensat"},
+	"futimesat":    {"utimensat"},
+	"pipe":         {"pipe2"},
+	"dup2":         {"dup3"},
+	"epoll_create": {"epoll_create1"},
+	"epoll_wait":   {"epoll_pwait"},
+	"inotify_init": {"inotify_init1"},
+	"eventfd":      {"eventfd2"},
+	"signalfd":     {"signalfd4"},
+	"poll":         {"ppoll"},
+	"select":       {"pselect6", "_newselect"},
+	"fork":         {"clone"},
+	"vfork":        {"clone"},
+	"getdents":     {"getdents64"},
+	"getpgrp":      {"getpgid"},
+	"alarm":        {"setitimer"},
+	"pause":        {"rt_sigsuspend"},
+	"time":         {"clock_gettime"},
+	"mmap":         {"mmap2"},
+	"lseek":        {"_llseek"},
+	"fcntl":        {"fcntl64"},
+	"getrlimit":    {"ugetrlimit", "prlimit64"},
+	"statfs":       {"statfs64"},
+	"fstatfs":      {"fstatfs64"},
+	"truncate":     {"truncate64"},
+	"ftruncate":    {"ftruncate64"},
+	"sendfile":     {"sendfile64"},
+	"getuid":       {"getuid32"},
+	"geteuid":      {"geteuid32"},
+	"getgid":       {"getgid32"},
+	"getegid":      {"getegid32"},
+	"setuid":       {"setuid32"},
+	"setgid":       {"setgid32"},
+	"setreuid":     {"setreuid32"},
+	"setregid":     {"setregid32"},
+	"setresuid":    {"setresuid32"},
+	"setresgid":    {"setresgid32"},
+	"getresuid":    {"getresuid32"},
+	"getresgid":    {"getresgid32"},
+	"setfsuid":     {"setfsuid32"},
+	"setfsgid":     {"setfsgid32"},
+	"getgroups":    {"getgroups32"},
+	"setgroups":    {"setgroups32"},
+}
+
+var callEquivalents map[string][]string
+
+func init() {
+	callEquivalents = map[string][]string{}
+	for name, replacements := range callReplacements {
+		for _, replacement := range replacements {
+			callEquivalents[name] = append(callEquivalents[name], replacement)
+			callEquivalents[replacement] = append(callEquivalents[replacement], name)
+		}
+	}
+}
+
+// targetArchs returns the architectures the profile is generated for
+// (the architecture of the monitored container if there are no target architectures)
+func targetArchs(sourceArch string, arches []string) []system.ArchName {
+	if len(arches) == 0 {
+		arches = []string{sourceArch}
+	}
+
+	var targets []system.ArchName
+	known := map[system.ArchName]bool{}
+	for _, name := range arches {
+		arch := system.ArchName(name)
+		if _, ok := archMap[arch]; !ok || known[arch] {
+			continue
+		}
+
+		known[arch] = true
+		targets = append(targets, arch)
+	}
+
+	return targets
+}
+
+// seccompArchs returns the seccomp architecture list for the target architectures
+func seccompArchs(targets []system.ArchName) []specs.Arch {
+	var arches []specs.Arch
+	for _, arch := range targets {
+		arches = append(arches, archMap[arch])
+	}
+
+	return arches
+}
+
+// archCallNames translates the syscalls observed on the source architecture
+// to the syscalls available on the target architectures.
+// The syscalls that exist on the target architecture are kept and the equivalent syscalls are added
+// (on the source architecture itself only the observed syscalls are used).
+// The observed syscalls not available on any target architecture are returned separately.
+func archCallNames(observed []string, sourceArch string, targets []system.ArchName) ([]string, []string) {
+	names := map[string]bool{}
+	missing := map[string]bool{}
+	for _, name := range observed {
+		missing[name] = true
+	}
+
+	for _, target := range targets {
+		resolver := system.CallNameResolver(target)
+		if resolver == nil {
+			for _, name := range observed {
+				names[name] = true
+				delete(missing, name)
+			}
+
+			continue
+		}
+
+		for _, name := range observed {
+			if _, ok := resolver(name); ok {
+				names[name] = true
+				delete(missing, name)
+			}
+
+			if string(target) == sourceArch {
+				continue
+			}
+
+			for _, equivalent := range callEquivalents[name] {
+				if _, ok := resolver(equivalent); ok {
+					names[equivalent] = true
+					delete(missing, name)
+				}
+			}
+		}
+	}
+
+	toList := func(set map[string]bool) []string {
+		var list []string
+		for name := range set {
+			list = append(list, name)
+		}
+
+		sort.Strings(list)
+		return list
+	}
+
+	return toList(names), toList(missing)
+}
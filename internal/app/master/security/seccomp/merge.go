@@ -0,0 +1,177 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+)
+
+const observedCallsLabel = "docker-slim: observed syscalls"
+
+// loadBaseline loads the baseline seccomp profile
+// (the Docker default profile or a profile file)
+func loadBaseline(baseline *config.SeccompBaseline, arches []specs.Arch) (*specs.Seccomp, error) {
+	if baseline.Profile == config.SeccompBaselineDockerDefault {
+		return DockerDefaultProfile(arches), nil
+	}
+
+	data, err := ioutil.ReadFile(baseline.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile specs.Seccomp
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("invalid baseline seccomp profile (%s): %v", baseline.Profile, err)
+	}
+
+	//merging with a deny list doesn't produce an allowlist
+	if profile.DefaultAction == specs.ActAllow || profile.DefaultAction == actLog {
+		return nil, fmt.Errorf("the baseline seccomp profile (%s) is not an allowlist (default action: %s)",
+			baseline.Profile, profile.DefaultAction)
+	}
+
+	return &profile, nil
+}
+
+func ruleNames(rule *specs.Syscall) []string {
+	if rule.Name != "" {
+		return append([]string{rule.Name}, rule.Names...)
+	}
+
+	return rule.Names
+}
+
+func isUnconditional(rule *specs.Syscall) bool {
+	return len(rule.Args) == 0 &&
+		len(rule.Includes.Caps) == 0 &&
+		len(rule.Includes.Arches) == 0 &&
+		rule.Includes.MinKernel == "" &&
+		len(rule.Excludes.Caps) == 0 &&
+		len(rule.Excludes.Arches) == 0 &&
+		rule.Excludes.MinKernel == ""
+}
+
+// mergeProfiles merges the generated profile (one allow rule with the observed syscalls)
+// with the baseline profile. In the union mode the baseline rules are kept
+// and the observed syscalls the baseline doesn't allow are added
+// (the baseline rules denying the observed syscalls are dropped).
+// In the intersection mode only the baseline rules for the observed syscalls are kept.
+// It also returns the observed syscalls the merged profile doesn't allow.
+func mergeProfiles(generated, baseline *specs.Seccomp, mode string) (*specs.Seccomp, []string) {
+	observed := map[string]bool{}
+	for _, rule := range generated.Syscalls {
+		for _, name := range ruleNames(rule) {
+			observed[name] = true
+		}
+	}
+
+	merged := &specs.Seccomp{
+		DefaultAction:   baseline.DefaultAction,
+		DefaultErrnoRet: baseline.DefaultErrnoRet,
+		Architectures:   baseline.Architectures,
+		ArchMap:         baseline.ArchMap,
+	}
+
+	//the baseline profile can use an architecture map instead of the architecture list
+	if len(merged.ArchMap) == 0 {
+		known := map[specs.Arch]bool{}
+		for _, arch := range merged.Architectures {
+			known[arch] = true
+		}
+
+		for _, arch := range generated.Architectures {
+			if !known[arch] {
+				merged.Architectures = append(merged.Architectures, arch)
+			}
+		}
+	}
+
+	allowed := map[string]bool{}
+	switch mode {
+	case config.SeccompMergeIntersection:
+		for _, rule := range baseline.Syscalls {
+			var names []string
+			for _, name := range ruleNames(rule) {
+				if observed[name] {
+					names = append(names, name)
+				}
+			}
+
+			if len(names) == 0 {
+				continue
+			}
+
+			filtered := *rule
+			filtered.Name = ""
+			filtered.Names = names
+			merged.Syscalls = append(merged.Syscalls, &filtered)
+
+			if rule.Action == specs.ActAllow {
+				for _, name := range names {
+					allowed[name] = true
+				}
+			}
+		}
+
+		var dropped []string
+		for name := range observed {
+			if !allowed[name] {
+				dropped = append(dropped, name)
+			}
+		}
+
+		sort.Strings(dropped)
+		return merged, dropped
+	default:
+		for _, rule := range baseline.Syscalls {
+			if rule.Action != specs.ActAllow {
+				//the observed syscalls are allowed even if the baseline denies them
+				var names []string
+				for _, name := range ruleNames(rule) {
+					if !observed[name] {
+						names = append(names, name)
+					}
+				}
+
+				if len(names) > 0 {
+					filtered := *rule
+					filtered.Name = ""
+					filtered.Names = names
+					merged.Syscalls = append(merged.Syscalls, &filtered)
+				}
+
+				continue
+			}
+
+			merged.Syscalls = append(merged.Syscalls, rule)
+			if isUnconditional(rule) {
+				for _, name := range ruleNames(rule) {
+					allowed[name] = true
+				}
+			}
+		}
+
+		var extra []string
+		for name := range observed {
+			if !allowed[name] {
+				extra = append(extra, name)
+			}
+		}
+
+		if len(extra) > 0 {
+			sort.Strings(extra)
+			merged.Syscalls = append(merged.Syscalls, &specs.Syscall{
+				Names:   extra,
+				Action:  specs.ActAllow,
+				Comment: observedCallsLabel,
+			})
+		}
+
+		return merged, nil
+	}
+}
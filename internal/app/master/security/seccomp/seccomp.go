@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/system"
 	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
@@ -14,19 +16,6 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
-var archMap = map[system.ArchName]specs.Arch{
-	system.ArchName386:   specs.ArchX86,
-	system.ArchNameAmd64: specs.ArchX86_64,
-	system.ArchNameArm32: specs.ArchARM,
-}
-
-func archNameToSeccompArch(name string) specs.Arch {
-	if arch, ok := archMap[system.ArchName(name)]; ok {
-		return arch
-	}
-	return "unknown"
-}
-
 var extraCalls = []string{
 	"openat",
 	"getdents64",
@@ -61,7 +50,17 @@ var extraCalls = []string{
 }
 
 // GenProfile creates a SecComp profile
-func GenProfile(artifactLocation string, profileName string) error {
+// (merged with the baseline profile if there's one)
+// for the target architectures (the monitored container architecture by default)
+// with the configured default action and the per-syscall action overrides
+func GenProfile(artifactLocation string,
+	profileName string,
+	baseline *config.SeccompBaseline,
+	options *config.SeccompOptions) error {
+	if options == nil {
+		options = &config.SeccompOptions{}
+	}
+
 	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
 
 	if _, err := os.Stat(containerReportFilePath); err != nil {
@@ -81,14 +80,14 @@ func GenProfile(artifactLocation string, profileName string) error {
 	profilePath := filepath.Join(artifactLocation, profileName)
 	log.Debug("docker-slim: saving seccomp profile to ", profilePath)
 
+	sourceArch := creport.Monitors.Pt.ArchName
+	targets := targetArchs(sourceArch, options.Arches)
 	profile := &specs.Seccomp{
 		DefaultAction: specs.ActErrno,
-		Architectures: []specs.Arch{
-			archNameToSeccompArch(creport.Monitors.Pt.ArchName),
-		},
+		Architectures: seccompArchs(targets),
 	}
 
-	nameResolver := system.CallNameResolver(system.ArchName(creport.Monitors.Pt.ArchName))
+	nameResolver := system.CallNameResolver(system.ArchName(sourceArch))
 	if nameResolver != nil {
 		for _, xcall := range extraCalls {
 			if cnum, ok := nameResolver(xcall); ok {
@@ -104,12 +103,42 @@ func GenProfile(artifactLocation string, profileName string) error {
 		Action: specs.ActAllow,
 	}
 
+	var observed []string
 	for _, scInfo := range creport.Monitors.Pt.SyscallStats {
-		scSpec.Names = append(scSpec.Names, scInfo.Name)
+		observed = append(observed, scInfo.Name)
+	}
+
+	if len(targets) > 0 {
+		var missing []string
+		scSpec.Names, missing = archCallNames(observed, sourceArch, targets)
+		if len(missing) > 0 {
+			log.Warnf("docker-slim: these observed syscalls are not available on the target architectures (%v): %s",
+				targets, strings.Join(missing, ","))
+		}
+	} else {
+		log.Warnf("docker-slim: unknown seccomp profile architecture (%s)", sourceArch)
+		scSpec.Names = observed
 	}
 
 	profile.Syscalls = append(profile.Syscalls, &scSpec)
 
+	if baseline != nil && baseline.Profile != "" {
+		baselineProfile, err := loadBaseline(baseline, profile.Architectures)
+		if err != nil {
+			return err
+		}
+
+		var dropped []string
+		profile, dropped = mergeProfiles(profile, baselineProfile, baseline.Mode)
+		log.Debugf("docker-slim: merged seccomp profile with baseline %s (%s)", baseline.Profile, baseline.Mode)
+		if len(dropped) > 0 {
+			log.Warnf("docker-slim: the baseline seccomp profile does not allow these observed syscalls (they are not in the merged profile): %s",
+				strings.Join(dropped, ","))
+		}
+	}
+
+	profile = applyActions(profile, options)
+
 	profileData, err := json.MarshalIndent(profile, "", "  ")
 	if err != nil {
 		return err
@@ -3,7 +3,6 @@ package app
 import (
 	"os"
 	"os/signal"
-	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -11,11 +10,19 @@ import (
 var appContinueChan = make(chan struct{})
 var appDoneChan = make(chan struct{})
 
-var signals = []os.Signal{
-	syscall.SIGUSR1,
+var signals = []os.Signal{}
+
+func init() {
+	if continueSignal != nil {
+		signals = append(signals, continueSignal)
+	}
 }
 
 func initSignalHandlers() {
+	if len(signals) == 0 {
+		return
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, signals...)
 	log.Debugf("docker-slim: listening for signals - %+v", signals)
@@ -26,7 +33,7 @@ func initSignalHandlers() {
 				return
 			case sig := <-sigChan:
 				switch sig {
-				case syscall.SIGUSR1:
+				case continueSignal:
 					log.Debug("docker-slim: continue signal")
 					appContinueChan <- struct{}{}
 				default:
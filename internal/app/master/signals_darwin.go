@@ -0,0 +1,8 @@
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+var continueSignal os.Signal = syscall.SIGUSR1
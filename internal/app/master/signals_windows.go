@@ -0,0 +1,8 @@
+package app
+
+import (
+	"os"
+)
+
+// there's no SIGUSR1 on Windows (the 'signal' continue-after mode is not available)
+var continueSignal os.Signal
@@ -0,0 +1,209 @@
+package status
+
+import (
+	"fmt"
+
+	v "github.com/docker-slim/docker-slim/pkg/version"
+)
+
+// ID is a stable status message identifier
+// (use it instead of the message text to track the command execution)
+type ID string
+
+// Command lifecycle messages
+const (
+	IDStarted     ID = "1000"
+	IDParams      ID = "1001"
+	IDCompleted   ID = "1002"
+	IDDone        ID = "1003"
+	IDExited      ID = "1004"
+	IDExecTimeout ID = "1005"
+	IDDryRun      ID = "1006"
+	IDResume      ID = "1007"
+	IDProgress    ID = "1008"
+	IDInterrupted ID = "1009"
+)
+
+// Parameter and configuration messages
+const (
+	IDParamError     ID = "2000"
+	IDParamHint      ID = "2001"
+	IDParamErrors    ID = "2002"
+	IDConfigWarning  ID = "2003"
+	IDConfigPrompt   ID = "2004"
+	IDFlagDeprecated ID = "2005"
+)
+
+// Image messages
+const (
+	IDImageNotFound         ID = "3000"
+	IDImageInspectionStart  ID = "3001"
+	IDImageInspectionDone   ID = "3002"
+	IDImageInfo             ID = "3003"
+	IDImageUsers            ID = "3004"
+	IDImageStack            ID = "3005"
+	IDImageExposedPorts     ID = "3006"
+	IDBasicImageName        ID = "3007"
+	IDBasicImageBuilding    ID = "3008"
+	IDBasicImageBuilt       ID = "3009"
+	IDMinifiedImageBuilding ID = "3010"
+	IDMinifiedImageNotFound ID = "3011"
+	IDImagePull             ID = "3012"
+	IDImagePullError        ID = "3013"
+	IDImageLoaderIssue      ID = "3014"
+	IDImageBaseIssue        ID = "3015"
+)
+
+// Container messages
+const (
+	IDContainerInspectionStart     ID = "4000"
+	IDContainerInfo                ID = "4001"
+	IDContainerCreated             ID = "4002"
+	IDContainerCrashed             ID = "4003"
+	IDContainerPlan                ID = "4004"
+	IDStartMonitorSent             ID = "4005"
+	IDStartMonitorDone             ID = "4006"
+	IDSensorError                  ID = "4007"
+	IDContainerInspectionFinishing ID = "4008"
+	IDContainerArtifactProcessing  ID = "4009"
+	IDContainerInspectionDone      ID = "4010"
+	IDPromptEnter                  ID = "4011"
+	IDPromptSignal                 ID = "4012"
+	IDSignalReceived               ID = "4013"
+	IDPromptTimeout                ID = "4014"
+	IDTimeoutDone                  ID = "4015"
+	IDPromptProbe                  ID = "4016"
+	IDProbeDoneReceived            ID = "4017"
+	IDArtifactsTransfer            ID = "4018"
+	IDSensorErrorHint              ID = "4019"
+	IDNetworkCreated               ID = "4020"
+	IDTargetContainer              ID = "4021"
+	IDTargetContainerError         ID = "4022"
+	IDContainerCrashHint           ID = "4023"
+	IDProfilesCheck                ID = "4024"
+	IDProfilesCheckDenial          ID = "4025"
+	IDProfilesCheckDone            ID = "4026"
+	IDContainerSecurityWarning     ID = "4027"
+	IDPromptHealthcheck            ID = "4028"
+	IDHealthcheckDone              ID = "4029"
+	IDHealthcheckError             ID = "4030"
+	IDPromptInteractive            ID = "4031"
+	IDInteractiveDone              ID = "4032"
+	IDContainerVolumeWarning       ID = "4033"
+	IDMonitorCache                 ID = "4034"
+	IDContainerStartRetry          ID = "4035"
+)
+
+// HTTP probe messages
+const (
+	IDProbeError    ID = "5000"
+	IDProbeStarting ID = "5001"
+	IDProbeRunning  ID = "5002"
+	IDProbeCall     ID = "5003"
+	IDProbeSummary  ID = "5004"
+	IDProbeDone     ID = "5005"
+	IDProbeDefault  ID = "5006"
+)
+
+// Result messages
+const (
+	IDResultsNoData       ID = "6000"
+	IDResultsMinified     ID = "6001"
+	IDResultsImage        ID = "6002"
+	IDResultsArtifacts    ID = "6003"
+	IDResultsStateArchive ID = "6004"
+	IDStateArchiveError   ID = "6005"
+	IDMetaArtifactsError  ID = "6006"
+	IDResultsImagePush    ID = "6007"
+	IDImagePushError      ID = "6008"
+	IDResultsCapabilities ID = "6009"
+	IDResultsRunCommand   ID = "6010"
+	IDProfilesMergeError  ID = "6011"
+	IDResultsContainer    ID = "6012"
+	IDResultsGVisor       ID = "6013"
+	IDResultsGVisorCall   ID = "6014"
+	IDResultsSecret       ID = "6015"
+	IDResultsFileChange   ID = "6016"
+	IDSharedLayerError    ID = "6017"
+	IDResultsStripped     ID = "6018"
+	IDResultsArtifactHook ID = "6019"
+	IDResultsOCILayout    ID = "6020"
+	IDResultsBaseReuse    ID = "6021"
+	IDResultsFileMonitor  ID = "6022"
+	IDResultsSharedLayer  ID = "6023"
+	IDResultsBatchTarget  ID = "6024"
+	IDBatchTargetError    ID = "6025"
+)
+
+// Update and version check messages
+const (
+	IDVersionCheckFailed    ID = "7000"
+	IDVersionCurrent        ID = "7001"
+	IDVersionInfo           ID = "7002"
+	IDUpdateDownloaded      ID = "7003"
+	IDUpdateDownloadStarted ID = "7004"
+	IDUpdateSourceError     ID = "7005"
+	IDUpdateDownloadError   ID = "7006"
+	IDUpdateDownloadDone    ID = "7007"
+	IDUpdateUnpackError     ID = "7008"
+	IDUpdateUnpacked        ID = "7009"
+	IDUpdateInstallError    ID = "7010"
+	IDUpdateInstalled       ID = "7011"
+	IDVersionOutdated       ID = "7012"
+	IDVersionOutdatedHint   ID = "7013"
+)
+
+// Docker connection messages
+const (
+	IDDockerConnectError      ID = "8000"
+	IDDockerWindowsContainers ID = "8001"
+	IDDockerEndpoint          ID = "8002"
+	IDDockerAPIVersionError   ID = "8003"
+	IDDockerRootlessPodman    ID = "8004"
+)
+
+// Printer emits the status messages for a docker-slim command
+type Printer struct {
+	prefix string
+}
+
+// New creates a new status message printer for a command
+// (an empty command name is used for the messages that are not specific to a command)
+func New(cmdName string) *Printer {
+	if cmdName == "" {
+		return &Printer{prefix: "docker-slim:"}
+	}
+
+	return &Printer{
+		prefix: fmt.Sprintf("docker-slim[%s]:", cmdName),
+	}
+}
+
+// Prefix returns the command prefix for the status messages
+func (p *Printer) Prefix() string {
+	return p.prefix
+}
+
+// State prints a 'state' message (the optional 'format' provides the extra message fields)
+func (p *Printer) State(id ID, state string, format string, args ...interface{}) {
+	p.print("state", id, state, format, args...)
+}
+
+// Info prints an 'info' message (the optional 'format' provides the extra message fields)
+func (p *Printer) Info(id ID, info string, format string, args ...interface{}) {
+	p.print("info", id, info, format, args...)
+}
+
+// Exited prints the 'exited' state message
+func (p *Printer) Exited() {
+	p.State(IDExited, "exited", "version=%s", v.Current())
+}
+
+func (p *Printer) print(kind string, id ID, value string, format string, args ...interface{}) {
+	if format == "" {
+		fmt.Printf("%s %s=%s event.id=%s\n", p.prefix, kind, value, id)
+		return
+	}
+
+	fmt.Printf("%s %s=%s event.id=%s %s\n", p.prefix, kind, value, id, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package update
+
+import (
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/docker-slim/uiprogress"
+)
+
+func newProgressReader(size int, rc io.ReadCloser) io.ReadCloser {
+	pr := progressReader{
+		rc:       rc,
+		size:     size,
+		progress: uiprogress.New(),
+	}
+
+	if pr.progress != nil {
+		pr.progress.SetRefreshInterval(time.Millisecond * 100)
+		pr.progress.Start()
+
+		pr.bar = pr.progress.AddBar(pr.size).AppendCompleted().PrependElapsed()
+		pr.bar.Width = 50
+	}
+
+	return &pr
+}
+
+type progressReader struct {
+	rc       io.ReadCloser
+	size     int
+	current  int
+	progress *uiprogress.Progress
+	bar      *uiprogress.Bar
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	count, err := pr.rc.Read(b)
+	if err == nil {
+		pr.current += count
+		if pr.bar != nil {
+			pr.bar.Set(pr.current)
+		}
+	}
+
+	return count, err
+}
+
+func (pr *progressReader) Close() error {
+	if pr.progress != nil {
+		pr.progress.Stop()
+	}
+	io.Copy(ioutil.Discard, pr.rc)
+	return pr.rc.Close()
+}
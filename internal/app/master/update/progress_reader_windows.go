@@ -0,0 +1,10 @@
+package update
+
+import (
+	"io"
+)
+
+// the terminal progress bars are not supported on Windows
+func newProgressReader(size int, rc io.ReadCloser) io.ReadCloser {
+	return newPassThroughReader(size, rc)
+}
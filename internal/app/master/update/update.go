@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	vchecker "github.com/docker-slim/docker-slim/internal/app/master/version"
 	"github.com/docker-slim/docker-slim/pkg/util/errutil"
 	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
@@ -20,7 +21,6 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/c4milo/unpackit"
 	"github.com/docker-slim/go-update"
-	"github.com/docker-slim/uiprogress"
 )
 
 const (
@@ -40,6 +40,7 @@ var (
 // Run checks the current version and updates it if it doesn't match the latest available version
 func Run(doDebug bool, statePath string, doShowProgress bool) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "update"})
+	printer := status.New("update")
 
 	appPath, err := os.Executable()
 	errutil.FailOn(err)
@@ -49,18 +50,18 @@ func Run(doDebug bool, statePath string, doShowProgress bool) {
 	logger.Debugf("Version Status => %+v", vstatus)
 
 	if vstatus == nil || vstatus.Status != "success" {
-		fmt.Printf("docker-slim[update]: info=status message='version check was not successful'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDVersionCheckFailed, "status", "message='version check was not successful'")
+		printer.Exited()
 		return
 	}
 
 	if !vstatus.Outdated {
-		fmt.Printf("docker-slim[update]: info=status message='already using the current version'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDVersionCurrent, "status", "message='already using the current version'")
+		printer.Exited()
 		return
 	}
 
-	fmt.Printf("docker-slim[update]: info=version local=%s current=%s\n", vinfo.Tag(), vstatus.Current)
+	printer.Info(status.IDVersionInfo, "version", "local=%s current=%s", vinfo.Tag(), vstatus.Current)
 
 	blobNameBase, blobNameExt := getReleaseBlobInfo()
 	errutil.FailWhen(blobNameBase == "", "could not discover platform-specific release package name")
@@ -74,19 +75,19 @@ func Run(doDebug bool, statePath string, doShowProgress bool) {
 
 	if fsutil.Exists(blobPath) {
 		//feature: not removing/replacing the existing release package blob if it's already there
-		fmt.Printf("docker-slim[update]: info=status message='release package already downloaded'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDUpdateDownloaded, "status", "message='release package already downloaded'")
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[update]: state=update.download.started")
+	printer.State(status.IDUpdateDownloadStarted, "update.download.started", "")
 
 	releaseDownloadPath := fmt.Sprintf("%s/%s/%s", downloadEndpoint, vstatus.Current, blobName)
 	logger.Debugf("release download path: %v", releaseDownloadPath)
 
 	if !isGoodDownloadSource(logger, releaseDownloadPath) {
-		fmt.Printf("docker-slim[update]: info=status message='release package download location is not accessible'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDUpdateSourceError, "status", "message='release package download location is not accessible'")
+		printer.Exited()
 		return
 	}
 
@@ -99,31 +100,31 @@ func Run(doDebug bool, statePath string, doShowProgress bool) {
 	err = downloadRelease(logger, blobPath, releaseDownloadPath, brConstructor)
 	if err != nil {
 		logger.Debugf("error downloading release: %v", err)
-		fmt.Printf("docker-slim[update]: info=status message='error downloading release package'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDUpdateDownloadError, "status", "message='error downloading release package'")
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[update]: state=update.download.completed")
+	printer.State(status.IDUpdateDownloadDone, "update.download.completed", "")
 
 	if err := unpackRelease(logger, blobPath, releaseDirPath, blobNameBase); err != nil {
 		logger.Debugf("error unpacking release package: %v", err)
-		fmt.Printf("docker-slim[update]: info=status message='error unpacking release package'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDUpdateUnpackError, "status", "message='error unpacking release package'")
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[update]: state=update.unpacked")
+	printer.State(status.IDUpdateUnpacked, "update.unpacked", "")
 
 	if err := installRelease(logger, appDirPath, statePath, releaseDirPath); err != nil {
 		logger.Debugf("error installing release: %v", err)
-		fmt.Printf("docker-slim[update]: info=status message='error installing release'\n")
-		fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+		printer.Info(status.IDUpdateInstallError, "status", "message='error installing release'")
+		printer.Exited()
 		return
 	}
 
-	fmt.Println("docker-slim[update]: state=update.installed")
-	fmt.Printf("docker-slim[update]: state=exited version=%s\n", vinfo.Current())
+	printer.State(status.IDUpdateInstalled, "update.installed", "")
+	printer.Exited()
 }
 
 func getReleaseBlobInfo() (base string, ext string) {
@@ -340,49 +341,3 @@ type BlobReaderConstructor func(size int, rc io.ReadCloser) io.ReadCloser
 func newPassThroughReader(size int, rc io.ReadCloser) io.ReadCloser {
 	return rc
 }
-
-func newProgressReader(size int, rc io.ReadCloser) io.ReadCloser {
-	pr := progressReader{
-		rc:       rc,
-		size:     size,
-		progress: uiprogress.New(),
-	}
-
-	if pr.progress != nil {
-		pr.progress.SetRefreshInterval(time.Millisecond * 100)
-		pr.progress.Start()
-
-		pr.bar = pr.progress.AddBar(pr.size).AppendCompleted().PrependElapsed()
-		pr.bar.Width = 50
-	}
-
-	return &pr
-}
-
-type progressReader struct {
-	rc       io.ReadCloser
-	size     int
-	current  int
-	progress *uiprogress.Progress
-	bar      *uiprogress.Bar
-}
-
-func (pr *progressReader) Read(b []byte) (int, error) {
-	count, err := pr.rc.Read(b)
-	if err == nil {
-		pr.current += count
-		if pr.bar != nil {
-			pr.bar.Set(pr.current)
-		}
-	}
-
-	return count, err
-}
-
-func (pr *progressReader) Close() error {
-	if pr.progress != nil {
-		pr.progress.Stop()
-	}
-	io.Copy(ioutil.Discard, pr.rc)
-	return pr.rc.Close()
-}
@@ -9,7 +9,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/status"
 	"github.com/docker-slim/docker-slim/pkg/system"
 	v "github.com/docker-slim/docker-slim/pkg/version"
 
@@ -35,8 +36,9 @@ type CheckVersionInfo struct {
 // PrintCheckVersion shows if the current version is outdated
 func PrintCheckVersion(info *CheckVersionInfo) {
 	if info != nil && info.Status == "success" && info.Outdated {
-		fmt.Printf("docker-slim[version]: info=version status=OUTDATED local=%s current=%s\n", v.Tag(), info.Current)
-		fmt.Printf("docker-slim[version]: info=message message='Your version of DockerSlim is out of date! Use the \"update\" command or download the new version from https://dockersl.im/downloads.html'\n")
+		printer := status.New("version")
+		printer.Info(status.IDVersionOutdated, "version", "status=OUTDATED local=%s current=%s", v.Tag(), info.Current)
+		printer.Info(status.IDVersionOutdatedHint, "message", "message='Your version of DockerSlim is out of date! Use the \"update\" command or download the new version from https://dockersl.im/downloads.html'")
 	}
 }
 
@@ -54,7 +56,7 @@ func GetCheckVersionVerdict(info *CheckVersionInfo) string {
 }
 
 // Print shows the master app version information
-func Print(client *docker.Client, checkVersion bool) {
+func Print(client dockerclient.API, checkVersion bool) {
 	fmt.Printf("docker-slim[version]: %s\n", v.Current())
 	if checkVersion {
 		fmt.Printf("Version Status: %v\n", GetCheckVersionVerdict(Check()))
@@ -3,6 +3,7 @@ package app
 import (
 	"flag"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/sensor/ipc"
@@ -34,6 +35,8 @@ func startMonitor(errorCh chan error,
 	mountPoint := "/"
 
 	stopMonitor := make(chan struct{})
+	//the target app is stopped first, so the other monitors see what it does when it's shutting down
+	stopPtMonitor := make(chan struct{})
 
 	var peReportChan <-chan *report.PeMonitorReport
 	var peReport *report.PeMonitorReport
@@ -52,7 +55,24 @@ func startMonitor(errorCh chan error,
 		return false
 	}
 
-	ptReportChan := ptrace.Run(errorCh, startAckChan, ptmonStartChan, stopMonitor, cmd.AppName, cmd.AppArgs, dirName)
+	appStopSignal := syscall.SIGTERM
+	if cmd.AppStopSignal != "" {
+		if signum, ok := system.SignalNumber(cmd.AppStopSignal); ok {
+			appStopSignal = syscall.Signal(signum)
+		} else {
+			log.Warnf("sensor: startMonitor - unknown app stop signal (using SIGTERM) => %v", cmd.AppStopSignal)
+		}
+	}
+
+	appStopTimeout := time.Duration(cmd.AppStopTimeout) * time.Second
+	//the app user from the image is not used (the app runs as root like the sensor without the user override)
+	var appUser string
+	if cmd.RunAsUser {
+		appUser = cmd.AppUser
+	}
+
+	ptReportChan := ptrace.Run(errorCh, startAckChan, ptmonStartChan, stopPtMonitor,
+		cmd.AppName, cmd.AppArgs, dirName, appUser, cmd.KeepHome, cmd.AppDropCaps, appStopSignal, appStopTimeout, cmd.AttachPid)
 	if ptReportChan == nil {
 		log.Info("sensor: startMonitor - PTAN failed to start running...")
 		close(stopMonitor)
@@ -64,12 +84,18 @@ func startMonitor(errorCh chan error,
 		<-stopWork
 		log.Debug("sensor: monitor.worker - stop message...")
 
+		close(stopPtMonitor)
+		ptReport := <-ptReportChan
 		close(stopMonitor)
 
 		log.Debug("sensor: monitor.worker - processing data...")
 
 		fanReport := <-fanReportChan
-		ptReport := <-ptReportChan
+
+		if cmd.AttachPid > 0 {
+			//the attached app opened its files before the monitor started
+			fanotify.AddRunningProcesses(fanReport)
+		}
 
 		if peReportChan != nil {
 			peReport = <-peReportChan
@@ -86,9 +112,13 @@ func startMonitor(errorCh chan error,
 /////////
 
 var enableDebug bool
+var artifactsDirName string
+var doRemoveFiles bool
 
 func init() {
 	flag.BoolVar(&enableDebug, "d", false, "enable debug logging")
+	flag.StringVar(&artifactsDirName, "a", defaultArtifactDirName, "artifacts directory")
+	flag.BoolVar(&doRemoveFiles, "c", false, "remove the sensor and the artifacts directory (and stop the running sensor)")
 }
 
 /////////
@@ -101,6 +131,12 @@ func Run() {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	if doRemoveFiles {
+		log.Infof("sensor: removing the sensor files (artifacts=%v)", artifactsDirName)
+		removeSensorFiles(artifactsDirName)
+		return
+	}
+
 	log.Debugf("sensor: uid=%v euid=%v", os.Getuid(), os.Geteuid())
 	log.Debugf("sensor: sysinfo => %#v", system.GetSystemInfo())
 	log.Debugf("sensor: kernel flags => %#v", system.DefaultKernelFeatures.Raw)
@@ -161,7 +197,7 @@ doneRunning:
 				}
 
 				log.Debugf("sensor: 'start' monitor command (%#v)", data)
-				if data.AppUser != "" {
+				if data.RunAsUser {
 					log.Debugf("sensor: 'start' monitor command - run app as user='%s'", data.AppUser)
 				}
 
@@ -175,7 +211,11 @@ doneRunning:
 
 				//target app started by ptmon... (long story :-))
 				//TODO: need to get the target app pid to pemon, so it can filter process events
-				log.Debugf("sensor: starting target app => %v %#v", data.AppName, data.AppArgs)
+				if data.AttachPid > 0 {
+					log.Debugf("sensor: attaching to target app => pid=%v", data.AttachPid)
+				} else {
+					log.Debugf("sensor: starting target app => %v %#v", data.AppName, data.AppArgs)
+				}
 				time.Sleep(3 * time.Second)
 
 				log.Info("sensor: waiting for monitor to complete startup...")
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/sensor/ipc"
+	"github.com/docker-slim/docker-slim/pkg/ipc/event"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dustin/go-humanize"
+)
+
+//NOTES:
+//* the artifact files are hashed and copied by a bounded worker pool (the file operations are mostly I/O bound,
+//  so there are more workers than CPUs, but not so many that the small container disk I/O limits are thrashed)
+//* the workers only change their own file data (the artifact props and the saved file),
+//  the shared artifact store maps are updated before and after the parallel passes
+//* the progress is also published to the master as the artifact progress events
+//  (the master shows it while it's waiting for the sensor to finish)
+
+const (
+	minArtifactWorkers       = 2
+	maxArtifactWorkers       = 16
+	artifactProgressInterval = 5 * time.Second
+)
+
+// artifactWorkerCount returns the number of the artifact file workers for the number of files
+func artifactWorkerCount(fileCount int) int {
+	workers := runtime.NumCPU() * 2
+	if workers < minArtifactWorkers {
+		workers = minArtifactWorkers
+	}
+
+	if workers > maxArtifactWorkers {
+		workers = maxArtifactWorkers
+	}
+
+	if workers > fileCount {
+		workers = fileCount
+	}
+
+	return workers
+}
+
+// processArtifactFiles runs the file function for each file with a bounded worker pool
+// and logs the throughput progress (the file function returns the number of the processed bytes)
+func processArtifactFiles(name, phase string, files []string, fileFn func(filePath string) int64) {
+	if len(files) == 0 {
+		return
+	}
+
+	workers := artifactWorkerCount(len(files))
+	log.Debugf("processArtifactFiles(%s) - files: %v workers: %v", name, len(files), workers)
+
+	var doneFiles, doneBytes int64
+	start := time.Now()
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ticker := time.NewTicker(artifactProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logArtifactProgress(name, phase, atomic.LoadInt64(&doneFiles), len(files), atomic.LoadInt64(&doneBytes), start)
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range queue {
+				size := fileFn(filePath)
+				atomic.AddInt64(&doneBytes, size)
+				atomic.AddInt64(&doneFiles, 1)
+			}
+		}()
+	}
+
+	for _, filePath := range files {
+		queue <- filePath
+	}
+
+	close(queue)
+	wg.Wait()
+	close(stopProgress)
+	<-progressDone
+
+	logArtifactProgress(name, phase, doneFiles, len(files), doneBytes, start)
+}
+
+func logArtifactProgress(name, phase string, doneFiles int64, totalFiles int, doneBytes int64, start time.Time) {
+	elapsed := time.Since(start)
+	var rate uint64
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		rate = uint64(float64(doneBytes) / seconds)
+	}
+
+	log.Infof("%s - files: %v/%v data: %v (%v/s) time: %v",
+		name, doneFiles, totalFiles, humanize.Bytes(uint64(doneBytes)), humanize.Bytes(rate), elapsed.Round(time.Millisecond))
+
+	ipc.TryPublishEvt(1, &event.Message{
+		Name: event.ArtifactsProgress,
+		Data: &event.ArtifactsProgressData{
+			Phase:      phase,
+			Files:      doneFiles,
+			TotalFiles: int64(totalFiles),
+			Bytes:      doneBytes,
+		},
+	})
+}
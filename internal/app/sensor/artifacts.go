@@ -6,8 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-
-	//"io"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -18,6 +17,7 @@ import (
 
 	//"syscall"
 
+	"github.com/docker-slim/docker-slim/internal/app/sensor/inspectors/secrets"
 	"github.com/docker-slim/docker-slim/internal/app/sensor/inspectors/sodeps"
 	"github.com/docker-slim/docker-slim/pkg/ipc/command"
 	"github.com/docker-slim/docker-slim/pkg/report"
@@ -72,7 +72,7 @@ func saveResults(fanMonReport *report.FanMonitorReport,
 	cmd *command.StartMonitor) {
 	log.Debugf("saveResults(%v,...)", len(fileNames))
 
-	artifactDirName := defaultArtifactDirName
+	artifactDirName := artifactsDirName
 
 	artifactStore := newArtifactStore(artifactDirName, fanMonReport, fileNames, ptMonReport, peReport, cmd)
 	artifactStore.prepareArtifacts()
@@ -90,6 +90,8 @@ type artifactStore struct {
 	resolve       map[string]struct{}
 	linkMap       map[string]*report.ArtifactProps
 	fileMap       map[string]*report.ArtifactProps
+	secrets       []*report.SecretFinding
+	deviceMounts  []string
 	cmd           *command.StartMonitor
 }
 
@@ -161,13 +163,8 @@ func (p *artifactStore) prepareArtifact(artifactFileName string) {
 	log.Debugf("prepareArtifact - file mode:%v", srcLinkFileInfo.Mode())
 	switch {
 	case srcLinkFileInfo.Mode().IsRegular():
+		//the file hash and the data type are collected in parallel (see prepareArtifacts)
 		props.FileType = report.FileArtifactType
-		props.Sha1Hash, _ = getFileHash(artifactFileName)
-
-		if fileTypeCmd != "" {
-			props.DataType, _ = getDataType(artifactFileName)
-		}
-
 		p.fileMap[artifactFileName] = props
 		p.rawNames[artifactFileName] = props
 	case (srcLinkFileInfo.Mode() & os.ModeSymlink) != 0:
@@ -208,6 +205,21 @@ func (p *artifactStore) prepareArtifacts() {
 		p.prepareArtifact(artifactFileName)
 	}
 
+	files := make([]string, 0, len(p.fileMap))
+	for fileName := range p.fileMap {
+		files = append(files, fileName)
+	}
+
+	processArtifactFiles("prepareArtifacts - hashing files", "hashing", files, func(fileName string) int64 {
+		props := p.fileMap[fileName]
+		props.Sha1Hash, _ = getFileHash(fileName)
+		if fileTypeCmd != "" {
+			props.DataType, _ = getDataType(fileName)
+		}
+
+		return props.FileSize
+	})
+
 	p.resolveLinks()
 }
 
@@ -252,17 +264,63 @@ func (p *artifactStore) saveArtifacts() {
 	includePaths = preparePaths(p.cmd.Includes)
 	log.Debugf("saveArtifacts - includePaths: %+v", includePaths)
 
+	var secretFiles map[string]struct{}
+	if p.cmd.DetectSecrets || p.cmd.ExcludeSecrets {
+		secretFiles = p.detectSecrets(includePaths)
+	}
+
+	//the runtime secret files are never saved
+	if len(p.cmd.SecretPaths) > 0 {
+		if secretFiles == nil {
+			secretFiles = map[string]struct{}{}
+		}
+
+		for _, secretPath := range p.cmd.SecretPaths {
+			secretFiles[secretPath] = struct{}{}
+		}
+	}
+
+	//the host device driver files the runtime hooks mount in the container are never saved
+	if p.cmd.ExcludeDeviceMounts {
+		p.deviceMounts = deviceMounts(filepath.Dir(p.storeLocation))
+		log.Debugf("saveArtifacts - device mounts: %+v", p.deviceMounts)
+	}
+
 	//TODO: use exludePaths to filter discovered files
 	log.Debugf("saveArtifacts - copy files (%v)", len(p.fileMap))
+	copyFiles := make([]string, 0, len(p.fileMap))
+	var deviceFileCount int
 	for srcFileName := range p.fileMap {
+		if _, ok := secretFiles[srcFileName]; ok || p.isRunSecret(srcFileName) {
+			log.Debug("saveArtifacts - excluding secret file => ", srcFileName)
+			continue
+		}
+
+		if p.isDeviceMountFile(srcFileName) {
+			log.Debug("saveArtifacts - excluding device mount file => ", srcFileName)
+			deviceFileCount++
+			continue
+		}
+
+		copyFiles = append(copyFiles, srcFileName)
+	}
+
+	if deviceFileCount > 0 {
+		log.Warnf("saveArtifacts - excluded %v host device driver file(s) mounted by the container runtime hooks", deviceFileCount)
+	}
+
+	processArtifactFiles("saveArtifacts - copying files", "copying", copyFiles, func(srcFileName string) int64 {
 		dstFilePath := fmt.Sprintf("%s/files%s", p.storeLocation, srcFileName)
 		log.Debug("saveArtifacts - saving file data => ", dstFilePath)
 		//err := cpFile(fileName, filePath)
 		err := fsutil.CopyRegularFile(true, srcFileName, dstFilePath, true)
 		if err != nil {
 			log.Warn("saveArtifacts - error saving file => ", err)
+			return 0
 		}
-	}
+
+		return p.fileMap[srcFileName].FileSize
+	})
 
 	//TODO: use exludePaths to filter discovered links
 	log.Debugf("saveArtifacts - copy links (%v)", len(p.linkMap))
@@ -325,8 +383,18 @@ func (p *artifactStore) saveArtifacts() {
 	//TODO: use exludePaths to filter included paths
 	for inPath, isDir := range includePaths {
 		dstPath := fmt.Sprintf("%s/files%s", p.storeLocation, inPath)
+		if targetPath, ok := p.cmd.IncludeMaps[inPath]; ok {
+			log.Debugf("saveArtifacts - remapping included path: %v => %v", inPath, targetPath)
+			dstPath = fmt.Sprintf("%s/files%s", p.storeLocation, targetPath)
+		}
+
+		if p.isRunSecret(inPath) {
+			log.Debug("saveArtifacts - excluding included secret path => ", inPath)
+			continue
+		}
+
 		if isDir {
-			err, errs := fsutil.CopyDir(true, inPath, dstPath, true, true, nil, nil, nil)
+			err, errs := fsutil.CopyDir(true, inPath, dstPath, true, true, secretFiles, nil, nil)
 			if err != nil {
 				log.Warnf("CopyDir(%v,%v) error: %v", inPath, dstPath, err)
 			}
@@ -335,6 +403,11 @@ func (p *artifactStore) saveArtifacts() {
 				log.Warnf("CopyDir(%v,%v) copy errors: %+v", inPath, dstPath, errs)
 			}
 		} else {
+			if _, ok := secretFiles[inPath]; ok {
+				log.Debug("saveArtifacts - excluding included secret file => ", inPath)
+				continue
+			}
+
 			if err := fsutil.CopyFile(true, inPath, dstPath, true); err != nil {
 				log.Warnf("CopyFile(%v,%v) error: %v", inPath, dstPath, err)
 			}
@@ -394,6 +467,79 @@ func (p *artifactStore) saveArtifacts() {
 		}
 
 	}
+
+	if p.cmd.IncludeZoneinfo {
+		log.Debug("saveArtifacts - include zoneinfo")
+		p.saveZoneinfo()
+	}
+
+	if len(p.cmd.IncludeLocales) > 0 {
+		log.Debugf("saveArtifacts - include locales: %v", p.cmd.IncludeLocales)
+		p.saveLocales(p.cmd.IncludeLocales)
+	}
+}
+
+// detectSecrets scans the container filesystem for the likely secrets
+// and returns the secret files to exclude from the minified image (if the secret exclusion is enabled)
+func (p *artifactStore) detectSecrets(includePaths map[string]bool) map[string]struct{} {
+	var ignoreDirs []string
+	if p.storeLocation != "/" {
+		ignoreDirs = append(ignoreDirs, p.storeLocation)
+	}
+
+	if sensorPath, err := os.Executable(); err == nil {
+		if sensorDir := filepath.Dir(sensorPath); sensorDir != "/" {
+			ignoreDirs = append(ignoreDirs, sensorDir)
+		}
+	}
+
+	isIncluded := func(filePath string) bool {
+		for inPath, isDir := range includePaths {
+			if filePath == inPath || (isDir && strings.HasPrefix(filePath, inPath+"/")) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	p.secrets = secrets.Scan("/", ignoreDirs)
+	excluded := map[string]struct{}{}
+	for _, finding := range p.secrets {
+		_, inFileMap := p.fileMap[finding.FilePath]
+		finding.Minified = inFileMap || isIncluded(finding.FilePath)
+		if p.cmd.ExcludeSecrets {
+			finding.Excluded = finding.Minified
+			excluded[finding.FilePath] = struct{}{}
+		}
+	}
+
+	log.Debugf("detectSecrets - findings: %v (excluded files: %v)", len(p.secrets), len(excluded))
+	return excluded
+}
+
+// isRunSecret returns true if the file is a runtime secret file
+// (or it's in a runtime secret directory)
+func (p *artifactStore) isRunSecret(filePath string) bool {
+	for _, secretPath := range p.cmd.SecretPaths {
+		if filePath == secretPath || strings.HasPrefix(filePath, strings.TrimSuffix(secretPath, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDeviceMountFile returns true if the file is a host device driver file
+// mounted by the container runtime hooks (or it's in a mounted directory)
+func (p *artifactStore) isDeviceMountFile(filePath string) bool {
+	for _, mountPath := range p.deviceMounts {
+		if filePath == mountPath || strings.HasPrefix(filePath, mountPath+"/") {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (p *artifactStore) saveReport() {
@@ -404,6 +550,7 @@ func (p *artifactStore) saveReport() {
 			Pt:  p.ptMonReport,
 			Fan: p.fanMonReport,
 		},
+		Secrets: p.secrets,
 	}
 
 	sinfo := system.GetSystemInfo()
@@ -417,7 +564,7 @@ func (p *artifactStore) saveReport() {
 		creport.Image.Files = append(creport.Image.Files, p.rawNames[fname])
 	}
 
-	artifactDirName := defaultArtifactDirName
+	artifactDirName := artifactsDirName
 	reportName := defaultReportName
 
 	_, err := os.Stat(artifactDirName)
@@ -437,14 +584,21 @@ func (p *artifactStore) saveReport() {
 	errutil.FailOn(err)
 }
 
+// getFileHash returns the file data hash
+// (the data is streamed, so the large files are not loaded in memory by the parallel hashing workers)
 func getFileHash(artifactFileName string) (string, error) {
-	fileData, err := ioutil.ReadFile(artifactFileName)
+	file, err := os.Open(artifactFileName)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
 
-	hash := sha1.Sum(fileData)
-	return hex.EncodeToString(hash[:]), nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func getDataType(artifactFileName string) (string, error) {
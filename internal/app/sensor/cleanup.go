@@ -1,7 +1,13 @@
 package app
 
 import (
-	//"os"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/sensor/ipc"
 
@@ -34,3 +40,73 @@ func cleanupOnShutdown() {
 
 	ipc.ShutdownChannels()
 }
+
+// the time the running sensor has to exit before its files are removed
+const sensorStopWait = 3 * time.Second
+
+// removeSensorFiles removes the sensor binary and the artifacts directory from the container
+// the sensor was copied to (the running container docker-slim attached to).
+// The running sensor (started earlier in the same container) is stopped first
+// and the empty sensor directories are removed too (up to the sensor mount location).
+func removeSensorFiles(artifactsDir string) {
+	sensorPath, err := os.Executable()
+	if err != nil {
+		log.Warnf("sensor: cleanup - can't find the sensor binary => %v", err)
+		return
+	}
+
+	stopSensorProcesses(sensorPath)
+
+	if err := os.RemoveAll(artifactsDir); err != nil {
+		log.Warnf("sensor: cleanup - error removing the artifacts directory (%v) => %v", artifactsDir, err)
+	}
+
+	if err := os.Remove(sensorPath); err != nil {
+		log.Warnf("sensor: cleanup - error removing the sensor binary (%v) => %v", sensorPath, err)
+	}
+
+	//the artifacts directory is in the sensor mount location
+	mountLocation := filepath.Dir(artifactsDir)
+	for dir := filepath.Dir(sensorPath); dir == mountLocation || strings.HasPrefix(dir, mountLocation+"/"); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+}
+
+// stopSensorProcesses signals the other processes running the sensor binary to exit
+// (and waits for them to exit, so they don't write to the removed artifacts directory)
+func stopSensorProcesses(sensorPath string) {
+	procDirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		log.Debugf("sensor: cleanup - can't read /proc => %v", err)
+		return
+	}
+
+	var pids []int
+	for _, info := range procDirs {
+		pid, err := strconv.Atoi(info.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		if exePath, err := os.Readlink(filepath.Join("/proc", info.Name(), "exe")); err == nil && exePath == sensorPath {
+			log.Debugf("sensor: cleanup - stopping the running sensor (pid=%v)", pid)
+			if err := syscall.Kill(pid, syscall.SIGTERM); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	for deadline := time.Now().Add(sensorStopWait); len(pids) > 0 && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		var running []int
+		for _, pid := range pids {
+			if syscall.Kill(pid, 0) == nil {
+				running = append(running, pid)
+			}
+		}
+
+		pids = running
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the container runtime hooks for the devices (e.g., the NVIDIA container runtime hook for the GPUs)
+//  bind mount the host driver files (libraries, binaries and firmware) into the container;
+//  they are host specific, so they are not saved in the minified image
+//* the hook mounts are the read-only bind mounts of the host files and directories
+//  (the Docker managed files and the sensor mounts are not hook mounts)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// the container files Docker bind mounts (they are not device hook mounts)
+var dockerManagedFiles = map[string]bool{
+	"/etc/hosts":       true,
+	"/etc/hostname":    true,
+	"/etc/resolv.conf": true,
+}
+
+// the filesystem types that are never device hook mounts
+var virtualFSTypes = map[string]bool{
+	"proc":     true,
+	"sysfs":    true,
+	"tmpfs":    true,
+	"devtmpfs": true,
+	"devpts":   true,
+	"mqueue":   true,
+	"cgroup":   true,
+	"cgroup2":  true,
+	"overlay":  true,
+}
+
+// deviceMounts returns the read-only host bind mounts in the container
+// (skipping the mounts with the sensor files in the skipDir directory)
+func deviceMounts(skipDir string) []string {
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		log.Warnf("deviceMounts: error reading %v - %v", mountInfoPath, err)
+		return nil
+	}
+	defer file.Close()
+
+	var mounts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		//<id> <parent id> <major:minor> <root> <mount point> <mount options> [optional fields] - <fs type> <source> <super options>
+		fields := strings.Fields(scanner.Text())
+		sepIdx := -1
+		for idx := 6; idx < len(fields); idx++ {
+			if fields[idx] == "-" {
+				sepIdx = idx
+				break
+			}
+		}
+
+		if sepIdx < 0 || sepIdx+1 >= len(fields) {
+			continue
+		}
+
+		root := unescapeMountPath(fields[3])
+		mountPoint := unescapeMountPath(fields[4])
+		if root == "/" ||
+			mountPoint == "/" ||
+			virtualFSTypes[fields[sepIdx+1]] ||
+			dockerManagedFiles[mountPoint] ||
+			!hasMountOption(fields[5], "ro") {
+			continue
+		}
+
+		if skipDir != "" &&
+			(mountPoint == skipDir ||
+				strings.HasPrefix(mountPoint, skipDir+"/") ||
+				strings.HasPrefix(skipDir, mountPoint+"/")) {
+			continue
+		}
+
+		mounts = append(mounts, mountPoint)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Warnf("deviceMounts: error reading %v - %v", mountInfoPath, err)
+	}
+
+	return mounts
+}
+
+func hasMountOption(options, name string) bool {
+	for _, option := range strings.Split(options, ",") {
+		if option == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescapeMountPath decodes the octal escapes in the mountinfo paths (e.g., '\040' is a space)
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var decoded strings.Builder
+	for idx := 0; idx < len(path); idx++ {
+		if path[idx] == '\\' && idx+3 < len(path) {
+			if code, err := strconv.ParseUint(path[idx+1:idx+4], 8, 8); err == nil {
+				decoded.WriteByte(byte(code))
+				idx += 3
+				continue
+			}
+		}
+
+		decoded.WriteByte(path[idx])
+	}
+
+	return decoded.String()
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Secret types
+const (
+	TypeAWSAccessKey   = "aws.access.key"
+	TypeAWSSecretKey   = "aws.secret.key"
+	TypeAWSCredentials = "aws.credentials"
+	TypePrivateKey     = "private.key"
+	TypeNpmToken       = "npm.token"
+	TypeGitHubToken    = "github.token"
+	TypeGitCredentials = "git.credentials"
+	TypeDockerAuth     = "docker.auth"
+	TypeEnvFile        = "env.file"
+)
+
+// the files larger than this are not scanned for the secret patterns
+// (the secrets are in the small text files)
+const maxScanFileSize = 1024 * 1024
+
+// the directories that are never scanned
+var skipDirs = map[string]bool{
+	"/proc": true,
+	"/sys":  true,
+	"/dev":  true,
+}
+
+// the file name patterns for the files with the credentials
+var fileNamePatterns = []struct {
+	secretType string
+	match      func(filePath string) bool
+}{
+	{TypeEnvFile, func(filePath string) bool {
+		name := filepath.Base(filePath)
+		return name == ".env" || strings.HasPrefix(name, ".env.")
+	}},
+	{TypeAWSCredentials, func(filePath string) bool {
+		return strings.HasSuffix(filePath, "/.aws/credentials")
+	}},
+	{TypeGitCredentials, func(filePath string) bool {
+		return filepath.Base(filePath) == ".git-credentials"
+	}},
+	{TypeDockerAuth, func(filePath string) bool {
+		return strings.HasSuffix(filePath, "/.docker/config.json")
+	}},
+}
+
+// the content patterns for the secrets
+var contentPatterns = []struct {
+	secretType string
+	pattern    *regexp.Regexp
+}{
+	{TypeAWSAccessKey, regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{TypeAWSSecretKey, regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{TypePrivateKey, regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED) )?PRIVATE KEY-----`)},
+	{TypeNpmToken, regexp.MustCompile(`_authToken\s*=\s*\S+`)},
+	{TypeGitHubToken, regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{TypeDockerAuth, regexp.MustCompile(`"auth"\s*:\s*"[A-Za-z0-9+/=]{8,}"`)},
+}
+
+// ScanFile returns the secret findings for the file
+// (the findings have the file path, the secret type and the line number, but never the secret itself)
+func ScanFile(filePath string) []*report.SecretFinding {
+	var findings []*report.SecretFinding
+	for _, fp := range fileNamePatterns {
+		if fp.match(filePath) {
+			findings = append(findings, &report.SecretFinding{
+				FilePath: filePath,
+				Type:     fp.secretType,
+			})
+		}
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxScanFileSize {
+		return findings
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		log.Debugf("secrets.ScanFile(%v): open error - %v", filePath, err)
+		return findings
+	}
+	defer file.Close()
+
+	found := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxScanFileSize)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		for _, cp := range contentPatterns {
+			if found[cp.secretType] || !cp.pattern.Match(line) {
+				continue
+			}
+
+			found[cp.secretType] = true
+			findings = append(findings, &report.SecretFinding{
+				FilePath: filePath,
+				Type:     cp.secretType,
+				Line:     lineNum,
+			})
+		}
+	}
+
+	return findings
+}
+
+// Scan walks the container filesystem and returns the secret findings
+// (the ignored directories are the sensor and artifact directories)
+func Scan(root string, ignoreDirs []string) []*report.SecretFinding {
+	ignored := map[string]bool{}
+	for dir := range skipDirs {
+		ignored[dir] = true
+	}
+
+	for _, dir := range ignoreDirs {
+		ignored[dir] = true
+	}
+
+	var findings []*report.SecretFinding
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Debugf("secrets.Scan: skipping %v - %v", filePath, err)
+			return nil
+		}
+
+		if info.IsDir() {
+			if ignored[filePath] {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if info.Mode().IsRegular() {
+			findings = append(findings, ScanFile(filePath)...)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Warnf("secrets.Scan(%v): error - %v", root, err)
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].FilePath != findings[j].FilePath {
+			return findings[i].FilePath < findings[j].FilePath
+		}
+
+		return findings[i].Type < findings[j].Type
+	})
+
+	return findings
+}
@@ -179,6 +179,10 @@ func publishEvt(channel mangos.Socket, msg *event.Message) error {
 // TryPublishEvt attempts to publish an event to the master
 func TryPublishEvt(ptry uint, msg *event.Message) {
 	log.Debugf("TryPublishEvt(%v,%+v)", ptry, msg)
+	if evtChannel == nil {
+		log.Debug("sensor: no event channel (not publishing)")
+		return
+	}
 
 	for ptry := 0; ptry < 3; ptry++ {
 		log.Debugf("sensor: trying to publish '%+v' event (attempt %v)", msg, ptry+1)
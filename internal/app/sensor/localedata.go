@@ -0,0 +1,218 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/util/fsutil"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//NOTES:
+//* the timezone database is in the same location with glibc and musl ('tzdata' package),
+//  so only the leap second variants ('right/') are skipped
+//* glibc loads the compiled locales from the locale directories ('/usr/lib/locale/<name>')
+//  or from the locale archive (the archive is kept as is if one of the locales is not in a directory)
+//* musl has the built-in C.UTF-8 locale and it loads the message catalogs for the other locales
+//  from MUSL_LOCPATH ('musl-locales' package)
+
+// timezone and locale data locations
+const (
+	zoneinfoDir        = "/usr/share/zoneinfo"
+	localtimeFile      = "/etc/localtime"
+	timezoneFile       = "/etc/timezone"
+	glibcLocaleDir     = "/usr/lib/locale"
+	glibcLocaleArchive = "/usr/lib/locale/locale-archive"
+	glibcLocaleAlias   = "/usr/share/locale/locale.alias"
+	muslLocaleDir      = "/usr/share/i18n/locales/musl"
+	muslLoaderPattern  = "/lib/ld-musl-*.so.1"
+)
+
+var zoneinfoIgnoreDirs = map[string]struct{}{
+	"right": {},
+}
+
+// saveZoneinfo saves the timezone database and the local timezone configuration
+func (p *artifactStore) saveZoneinfo() {
+	if _, err := os.Stat(zoneinfoDir); err != nil {
+		log.Warnf("saveZoneinfo - no timezone database (install the 'tzdata' package) => %v", err)
+		return
+	}
+
+	p.saveDataPath(zoneinfoDir, zoneinfoIgnoreDirs)
+	for _, filePath := range []string{localtimeFile, timezoneFile} {
+		if _, err := os.Lstat(filePath); err == nil {
+			p.saveDataPath(filePath, nil)
+		}
+	}
+}
+
+// saveLocales saves the locale data for the selected locales (for the image libc)
+func (p *artifactStore) saveLocales(names []string) {
+	if isMuslLibc() {
+		p.saveMatchingLocales(muslLocaleDir, names, "musl")
+		return
+	}
+
+	missing := p.saveMatchingLocales(glibcLocaleDir, names, "glibc")
+	if len(missing) > 0 {
+		if _, err := os.Stat(glibcLocaleArchive); err == nil {
+			log.Debugf("saveLocales - saving the locale archive for the locales: %v", missing)
+			p.saveDataPath(glibcLocaleArchive, nil)
+		} else {
+			log.Warnf("saveLocales - locales not found (generate them with 'locale-gen' or 'localedef'): %v", missing)
+		}
+	}
+
+	if _, err := os.Stat(glibcLocaleAlias); err == nil {
+		p.saveDataPath(glibcLocaleAlias, nil)
+	}
+}
+
+// saveMatchingLocales saves the locale data matching the selected locale names
+// from the locale directory and returns the names without the locale data
+func (p *artifactStore) saveMatchingLocales(localeDir string, names []string, libc string) []string {
+	files, err := ioutil.ReadDir(localeDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("saveLocales - error reading the %s locale directory => %v", libc, err)
+	}
+
+	var missing []string
+	for _, name := range names {
+		found := false
+		for _, file := range files {
+			if localeMatches(name, file.Name()) {
+				p.saveDataPath(filepath.Join(localeDir, file.Name()), nil)
+				found = true
+			}
+		}
+
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 && libc == "musl" {
+		log.Warnf("saveLocales - locales not found (install the 'musl-locales' package): %v", missing)
+	}
+
+	return missing
+}
+
+// saveDataPath saves the file, the symlink or the directory (and the symlink target directory)
+func (p *artifactStore) saveDataPath(srcPath string, ignoreDirNames map[string]struct{}) {
+	info, err := os.Lstat(srcPath)
+	if err != nil {
+		log.Warnf("saveDataPath(%v) error: %v", srcPath, err)
+		return
+	}
+
+	dstPath := fmt.Sprintf("%s/files%s", p.storeLocation, srcPath)
+	if info.Mode()&os.ModeSymlink != 0 {
+		if err := fsutil.CopyFile(true, srcPath, dstPath, true); err != nil {
+			log.Warnf("CopyFile(%v,%v) error: %v", srcPath, dstPath, err)
+		}
+
+		targetPath, err := filepath.EvalSymlinks(srcPath)
+		if err != nil {
+			log.Warnf("saveDataPath(%v) - broken symlink: %v", srcPath, err)
+			return
+		}
+
+		if targetInfo, err := os.Stat(targetPath); err != nil || !targetInfo.IsDir() {
+			//the file symlink targets are in the saved data directories
+			//(e.g., '/etc/localtime' => '/usr/share/zoneinfo/UTC')
+			if err == nil && !strings.HasPrefix(targetPath, zoneinfoDir+"/") {
+				p.saveDataPath(targetPath, nil)
+			}
+
+			return
+		}
+
+		srcPath = targetPath
+		dstPath = fmt.Sprintf("%s/files%s", p.storeLocation, targetPath)
+		info, err = os.Stat(srcPath)
+		if err != nil {
+			return
+		}
+	}
+
+	if !info.IsDir() {
+		if err := fsutil.CopyFile(true, srcPath, dstPath, true); err != nil {
+			log.Warnf("CopyFile(%v,%v) error: %v", srcPath, dstPath, err)
+		}
+
+		return
+	}
+
+	err, errs := fsutil.CopyDir(true, srcPath, dstPath, true, true, nil, ignoreDirNames, nil)
+	if err != nil {
+		log.Warnf("CopyDir(%v,%v) error: %v", srcPath, dstPath, err)
+	}
+
+	if len(errs) > 0 {
+		log.Debugf("CopyDir(%v,%v) copy errors: %+v", srcPath, dstPath, errs)
+	}
+}
+
+// isMuslLibc returns true if the image has the musl dynamic loader (e.g., Alpine)
+func isMuslLibc() bool {
+	matches, _ := filepath.Glob(muslLoaderPattern)
+	return len(matches) > 0
+}
+
+// localeMatches returns true if the locale file name matches the selected locale name
+// ('language[_territory][.codeset][@modifier]', the missing parts match all values
+// and the codesets are compared like glibc compares them: 'en_US.UTF-8' matches 'en_US.utf8')
+func localeMatches(selected, name string) bool {
+	selLang, selCodeset, selModifier := splitLocaleName(selected)
+	lang, codeset, modifier := splitLocaleName(name)
+	if selLang != lang && (strings.Contains(selLang, "_") || !strings.HasPrefix(lang, selLang+"_")) {
+		return false
+	}
+
+	if selCodeset != "" && normalizeCodeset(selCodeset) != normalizeCodeset(codeset) {
+		return false
+	}
+
+	return selModifier == "" || selModifier == modifier
+}
+
+func splitLocaleName(name string) (string, string, string) {
+	var codeset, modifier string
+	if idx := strings.Index(name, "@"); idx != -1 {
+		name, modifier = name[:idx], name[idx+1:]
+	}
+
+	if idx := strings.Index(name, "."); idx != -1 {
+		name, codeset = name[:idx], name[idx+1:]
+	}
+
+	return name, codeset, modifier
+}
+
+// normalizeCodeset returns the glibc normalized codeset name
+// (lowercase letters and digits only, the numeric codesets get the 'iso' prefix)
+func normalizeCodeset(codeset string) string {
+	var out []rune
+	onlyDigits := true
+	for _, r := range strings.ToLower(codeset) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			onlyDigits = false
+			out = append(out, r)
+		case r >= '0' && r <= '9':
+			out = append(out, r)
+		}
+	}
+
+	if onlyDigits && len(out) > 0 {
+		return "iso" + string(out)
+	}
+
+	return string(out)
+}
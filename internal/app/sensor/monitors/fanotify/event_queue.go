@@ -0,0 +1,110 @@
+package fanotify
+
+import (
+	"sync"
+)
+
+//NOTES:
+//* the kernel event queue drops the events when it overflows, so the collector hands the events over
+//  to the processor in a bounded queue and goes back to reading the kernel events
+//* the queued events for the same process file are merged (the busy apps access the same files over and over),
+//  so the processor gets the event batches with the event counts instead of the individual events
+//  and the queue size is the number of the distinct process files in the batch
+//* the collector waits for the processor only when the queue is full (backpressure)
+
+type eventKey struct {
+	pid  int32
+	file string
+}
+
+// eventQueue is the bounded event queue between the event collector and the event processor
+type eventQueue struct {
+	mu        sync.Mutex
+	events    []Event
+	index     map[eventKey]int
+	maxSize   int
+	merged    uint64
+	waits     uint64
+	overflows uint64
+	ready     chan struct{}
+	space     chan struct{}
+}
+
+func newEventQueue(maxSize int) *eventQueue {
+	return &eventQueue{
+		index:   map[eventKey]int{},
+		maxSize: maxSize,
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+	}
+}
+
+// push queues the event (it waits for the processor if the queue is full)
+// and it returns false if the monitor is stopped while it's waiting
+func (q *eventQueue) push(e Event, stopChan <-chan struct{}) bool {
+	key := eventKey{pid: e.Pid, file: e.File}
+	for {
+		q.mu.Lock()
+		if idx, found := q.index[key]; found {
+			queued := &q.events[idx]
+			queued.Count += e.Count
+			queued.ReadCount += e.ReadCount
+			queued.WriteCount += e.WriteCount
+			q.merged++
+			q.mu.Unlock()
+			return true
+		}
+
+		if len(q.events) < q.maxSize {
+			q.index[key] = len(q.events)
+			q.events = append(q.events, e)
+			q.mu.Unlock()
+			notify(q.ready)
+			return true
+		}
+
+		q.waits++
+		q.mu.Unlock()
+
+		select {
+		case <-q.space:
+		case <-stopChan:
+			return false
+		}
+	}
+}
+
+// take returns the queued events (the next event batch for the processor)
+func (q *eventQueue) take() []Event {
+	q.mu.Lock()
+	events := q.events
+	q.events = nil
+	q.index = map[eventKey]int{}
+	q.mu.Unlock()
+
+	notify(q.space)
+	return events
+}
+
+// overflow records the kernel event queue overflow
+func (q *eventQueue) overflow() {
+	q.mu.Lock()
+	q.overflows++
+	q.mu.Unlock()
+}
+
+// stats returns the number of the kernel event queue overflows, the merged events
+// and the collector waits for the processor
+func (q *eventQueue) stats() (overflows, merged, waits uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.overflows, q.merged, q.waits
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/docker-slim/docker-slim/pkg/errors"
 	"github.com/docker-slim/docker-slim/pkg/report"
@@ -16,18 +17,22 @@ import (
 )
 
 // Event is file operation event
+// (the merged events have the ID of the first event and the counts for all merged events)
 type Event struct {
-	ID      uint32
-	Pid     int32
-	File    string
-	IsRead  bool
-	IsWrite bool
+	ID         uint32
+	Pid        int32
+	File       string
+	Count      uint32
+	ReadCount  uint32
+	WriteCount uint32
 }
 
 const (
-	eventBufSize   = 1000
+	eventQueueSize = 10000
 	procFsFdInfo   = "/proc/self/fd/%d"
 	procFsFilePath = "/proc/%v/%v"
+	procFsDir      = "/proc"
+	deletedSuffix  = " (deleted)"
 )
 
 // Run starts the FANOTIFY monitor
@@ -63,7 +68,7 @@ func Run(errorCh chan error, mountPoint string, stopChan chan struct{}) <-chan *
 			ProcessFiles:     make(map[string]map[string]*report.FileInfo),
 		}
 
-		eventChan := make(chan Event, eventBufSize)
+		queue := newEventQueue(eventQueueSize)
 		go func() {
 			log.Debug("fanmon: collector - starting...")
 			var eventID uint32
@@ -76,12 +81,12 @@ func Run(errorCh chan error, mountPoint string, stopChan chan struct{}) <-chan *
 
 				if (data.Mask & fanapi.FAN_Q_OVERFLOW) == fanapi.FAN_Q_OVERFLOW {
 					log.Debug("fanmon: collector - overflow event")
+					queue.overflow()
 					continue
 				}
 
 				doNotify := false
-				isRead := false
-				isWrite := false
+				var readCount, writeCount uint32
 
 				if (data.Mask & fanapi.FAN_OPEN) == fanapi.FAN_OPEN {
 					log.Debug("fanmon: collector - file open")
@@ -90,13 +95,13 @@ func Run(errorCh chan error, mountPoint string, stopChan chan struct{}) <-chan *
 
 				if (data.Mask & fanapi.FAN_ACCESS) == fanapi.FAN_ACCESS {
 					log.Debug("fanmon: collector - file read")
-					isRead = true
+					readCount = 1
 					doNotify = true
 				}
 
 				if (data.Mask & fanapi.FAN_MODIFY) == fanapi.FAN_MODIFY {
 					log.Debug("fanmon: collector - file write")
-					isWrite = true
+					writeCount = 1
 					doNotify = true
 				}
 
@@ -108,11 +113,16 @@ func Run(errorCh chan error, mountPoint string, stopChan chan struct{}) <-chan *
 				data.File.Close()
 				if doNotify {
 					eventID++
-					e := Event{ID: eventID, Pid: data.Pid, File: path, IsRead: isRead, IsWrite: isWrite}
+					e := Event{
+						ID:         eventID,
+						Pid:        data.Pid,
+						File:       path,
+						Count:      1,
+						ReadCount:  readCount,
+						WriteCount: writeCount,
+					}
 
-					select {
-					case eventChan <- e:
-					case <-stopChan:
+					if !queue.push(e, stopChan) {
 						log.Info("fanmon: collector - stopping....")
 						return
 					}
@@ -120,73 +130,71 @@ func Run(errorCh chan error, mountPoint string, stopChan chan struct{}) <-chan *
 			}
 		}()
 
-	done:
-		for {
-			select {
-			case <-stopChan:
-				log.Info("fanmon: processor - stopping...")
-				break done
-			case e := <-eventChan:
-				fanReport.EventCount++
-				log.Debugf("fanmon: processor - [%v] handling event %v", fanReport.EventCount, e)
-
-				if e.ID == 1 {
-					//first event represents the main process
+		processEvent := func(e Event) {
+			fanReport.EventCount += e.Count
+			log.Debugf("fanmon: processor - [%v] handling event %v", fanReport.EventCount, e)
+
+			pid := strconv.Itoa(int(e.Pid))
+			if e.ID == 1 {
+				//first event represents the main process
+				if pinfo, err := getProcessInfo(e.Pid); (err == nil) && (pinfo != nil) {
+					fanReport.MainProcess = pinfo
+					fanReport.Processes = make(map[string]*report.ProcessInfo)
+					fanReport.Processes[pid] = pinfo
+				}
+			} else {
+				if _, ok := fanReport.Processes[pid]; !ok {
 					if pinfo, err := getProcessInfo(e.Pid); (err == nil) && (pinfo != nil) {
-						fanReport.MainProcess = pinfo
-						fanReport.Processes = make(map[string]*report.ProcessInfo)
-						fanReport.Processes[strconv.Itoa(int(e.Pid))] = pinfo
-					}
-				} else {
-					if _, ok := fanReport.Processes[strconv.Itoa(int(e.Pid))]; !ok {
-						if pinfo, err := getProcessInfo(e.Pid); (err == nil) && (pinfo != nil) {
-							fanReport.Processes[strconv.Itoa(int(e.Pid))] = pinfo
-						}
+						fanReport.Processes[pid] = pinfo
 					}
 				}
+			}
 
-				if _, ok := fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))]; !ok {
-					fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))] = make(map[string]*report.FileInfo)
-				}
-
-				if existingFi, ok := fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))][e.File]; !ok {
-					fi := &report.FileInfo{
-						EventCount:   1,
-						Name:         e.File,
-						FirstEventID: e.ID,
-					}
-
-					if e.IsRead {
-						fi.ReadCount = 1
-					}
-
-					if e.IsWrite {
-						fi.WriteCount = 1
-					}
+			if _, ok := fanReport.ProcessFiles[pid]; !ok {
+				fanReport.ProcessFiles[pid] = make(map[string]*report.FileInfo)
+			}
 
-					if pi, ok := fanReport.Processes[strconv.Itoa(int(e.Pid))]; ok && (e.File == pi.Path) {
-						fi.ExeCount = 1
-					}
+			fi, ok := fanReport.ProcessFiles[pid][e.File]
+			if !ok {
+				fi = &report.FileInfo{
+					Name:         e.File,
+					FirstEventID: e.ID,
+				}
 
-					fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))][e.File] = fi
-				} else {
-					existingFi.EventCount++
+				fanReport.ProcessFiles[pid][e.File] = fi
+			}
 
-					if e.IsRead {
-						existingFi.ReadCount++
-					}
+			fi.EventCount += e.Count
+			fi.ReadCount += e.ReadCount
+			fi.WriteCount += e.WriteCount
+			if pi, ok := fanReport.Processes[pid]; ok && (e.File == pi.Path) {
+				fi.ExeCount += e.Count
+			}
+		}
 
-					if e.IsWrite {
-						existingFi.WriteCount++
-					}
+	done:
+		for {
+			select {
+			case <-stopChan:
+				log.Info("fanmon: processor - stopping...")
+				//the queued events are still processed (they are collected before the monitor is stopped)
+				for _, e := range queue.take() {
+					processEvent(e)
+				}
 
-					if pi, ok := fanReport.Processes[strconv.Itoa(int(e.Pid))]; ok && (e.File == pi.Path) {
-						existingFi.ExeCount++
-					}
+				break done
+			case <-queue.ready:
+				for _, e := range queue.take() {
+					processEvent(e)
 				}
 			}
 		}
 
+		fanReport.QueueOverflows, fanReport.MergedEvents, fanReport.BackpressureWaits = queue.stats()
+		if fanReport.QueueOverflows > 0 {
+			log.Warnf("fanmon: processor - the kernel event queue overflowed %v time(s) (some file events are lost)", fanReport.QueueOverflows)
+		}
+
 		log.Debugf("fanmon: processor - sending report (processed %v events)...", fanReport.EventCount)
 		resultChan <- fanReport
 	}()
@@ -256,3 +264,91 @@ func getProcessInfo(pid int32) (*report.ProcessInfo, error) {
 
 	return info, nil
 }
+
+// AddRunningProcesses adds the running processes (except the sensor) to the report
+// with their executables and the files they have mapped
+// (used when the monitor is attached to an already running app,
+// so the files the app opened before the monitor started are not lost)
+func AddRunningProcesses(fanReport *report.FanMonitorReport) {
+	entries, err := ioutil.ReadDir(procFsDir)
+	if err != nil {
+		log.Warnf("fanmon: AddRunningProcesses - error reading %v: %v", procFsDir, err)
+		return
+	}
+
+	if fanReport.Processes == nil {
+		fanReport.Processes = make(map[string]*report.ProcessInfo)
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() || pid == os.Getpid() {
+			continue
+		}
+
+		pinfo, err := getProcessInfo(int32(pid))
+		if err != nil || pinfo == nil {
+			log.Debugf("fanmon: AddRunningProcesses - no process info for %d: %v", pid, err)
+			continue
+		}
+
+		pidKey := strconv.Itoa(pid)
+		if _, ok := fanReport.Processes[pidKey]; !ok {
+			fanReport.Processes[pidKey] = pinfo
+		}
+
+		if fanReport.MainProcess == nil && pid == 1 {
+			fanReport.MainProcess = pinfo
+		}
+
+		if _, ok := fanReport.ProcessFiles[pidKey]; !ok {
+			fanReport.ProcessFiles[pidKey] = make(map[string]*report.FileInfo)
+		}
+
+		files := append([]string{pinfo.Path}, getMappedFiles(pid)...)
+		for _, file := range files {
+			if _, ok := fanReport.ProcessFiles[pidKey][file]; ok {
+				continue
+			}
+
+			fi := &report.FileInfo{
+				EventCount: 1,
+				Name:       file,
+				ReadCount:  1,
+			}
+
+			if file == pinfo.Path {
+				fi.ExeCount = 1
+			}
+
+			fanReport.ProcessFiles[pidKey][file] = fi
+		}
+	}
+}
+
+func getMappedFiles(pid int) []string {
+	maps, err := ioutil.ReadFile(procFilePath(pid, "maps"))
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	known := map[string]bool{}
+	for _, line := range strings.Split(string(maps), "\n") {
+		//address perms offset dev inode path
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+
+		file := strings.Join(fields[5:], " ")
+		if strings.HasSuffix(file, deletedSuffix) || known[file] {
+			continue
+		}
+
+		known[file] = true
+		files = append(files, file)
+	}
+
+	return files
+}
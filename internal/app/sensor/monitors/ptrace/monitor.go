@@ -46,7 +46,13 @@ func Run(
 	stopChan chan struct{},
 	appName string,
 	appArgs []string,
-	dirName string) <-chan *report.PtMonitorReport {
+	dirName string,
+	appUser string,
+	appKeepHome bool,
+	appDropCaps []string,
+	appStopSignal syscall.Signal,
+	appStopTimeout time.Duration,
+	attachPid int) <-chan *report.PtMonitorReport {
 	log.Info("ptmon: Run")
 
 	sysInfo := system.GetSystemInfo()
@@ -66,6 +72,9 @@ func Run(
 		syscallStats := map[uint32]uint64{}
 		eventChan := make(chan syscallEvent, eventBufSize)
 		collectorDoneChan := make(chan int, 1)
+		//the collector keeps collecting until the processor is done
+		//(the app is still running while it's shutting down)
+		collectorStopChan := make(chan struct{})
 
 		var app *exec.Cmd
 
@@ -75,7 +84,20 @@ func Run(
 			runtime.LockOSThread()
 
 			var err error
-			app, err = target.Start(appName, appArgs, dirName, true)
+			var targetPid int
+			callName := "sensor.ptrace.Run/target.Start"
+			if attachPid > 0 {
+				//the target app is already running (it's not a child process of the sensor)
+				callName = "sensor.ptrace.Run/syscall.PtraceAttach"
+				err = syscall.PtraceAttach(attachPid)
+				targetPid = attachPid
+			} else {
+				app, err = target.Start(appName, appArgs, dirName, appUser, appKeepHome, appDropCaps, true)
+				if err == nil {
+					targetPid = app.Process.Pid
+				}
+			}
+
 			started := true
 			if err != nil {
 				started = false
@@ -83,14 +105,12 @@ func Run(
 			ackChan <- started
 
 			if err != nil {
-				sensorErr := errors.SE("sensor.ptrace.Run/target.Start", "call.error", err)
+				sensorErr := errors.SE(callName, "call.error", err)
 				errorCh <- sensorErr
 				time.Sleep(3 * time.Second)
 			}
 			errutil.FailOn(err)
 
-			targetPid := app.Process.Pid
-
 			//pgid, err := syscall.Getpgid(targetPid)
 			//if err != nil {
 			//	log.Warnf("ptmon: collector - getpgid error %d: %v", targetPid, err)
@@ -137,6 +157,21 @@ func Run(
 			var callNum uint64
 			var retVal uint64
 			for wstat.Stopped() {
+				//the signals are delivered to the app (they are not syscall stops)
+				if stopSignal := wstat.StopSignal(); stopSignal != syscall.SIGTRAP {
+					if err := syscall.PtraceSyscall(targetPid, int(stopSignal)); err != nil {
+						log.Warnf("ptmon: collector - PtraceSyscall(%v) error: %v", stopSignal, err)
+						break
+					}
+
+					if pid, err = syscall.Wait4(targetPid, &wstat, 0, nil); err != nil {
+						log.Warnf("ptmon: collector - error waiting 4 %d: %v", targetPid, err)
+						break
+					}
+
+					continue
+				}
+
 				var regs syscall.PtraceRegs
 
 				switch syscallReturn {
@@ -185,8 +220,14 @@ func Run(
 						callNum: uint32(callNum),
 						retVal:  retVal,
 					}:
-					case <-stopChan:
+					case <-collectorStopChan:
 						log.Info("ptmon: collector - stopping...")
+						if attachPid > 0 {
+							//the attached app keeps running after the monitoring
+							if err := syscall.PtraceDetach(targetPid); err != nil {
+								log.Warnf("ptmon: collector - error detaching from %d: %v", targetPid, err)
+							}
+						}
 						return
 					}
 				}
@@ -196,6 +237,17 @@ func Run(
 			collectorDoneChan <- 0
 		}()
 
+		countEvent := func(e syscallEvent) {
+			ptReport.SyscallCount++
+			log.Debugf("ptmon: syscall ==> %d", e.callNum)
+
+			if _, ok := syscallStats[e.callNum]; ok {
+				syscallStats[e.callNum]++
+			} else {
+				syscallStats[e.callNum] = 1
+			}
+		}
+
 	done:
 		for {
 			select {
@@ -204,26 +256,48 @@ func Run(
 				break done
 			case <-stopChan:
 				log.Info("ptmon: processor - stopping...")
-				//NOTE: need a better way to stop the target app...
-				if err := app.Process.Signal(syscall.SIGTERM); err != nil {
+				if attachPid > 0 {
+					//the collector detaches from the attached app (it's not stopped)
+					break done
+				}
+
+				if err := app.Process.Signal(appStopSignal); err != nil {
 					log.Warnln("ptmon: processor - error stopping target app =>", err)
 					if err := app.Process.Kill(); err != nil {
 						log.Warnln("ptmon: processor - error killing target app =>", err)
 					}
+					break done
 				}
-				break done
-			case e := <-eventChan:
-				ptReport.SyscallCount++
-				log.Debugf("ptmon: syscall ==> %d", e.callNum)
 
-				if _, ok := syscallStats[e.callNum]; ok {
-					syscallStats[e.callNum]++
-				} else {
-					syscallStats[e.callNum] = 1
+				if appStopTimeout <= 0 {
+					break done
 				}
+
+				//the syscalls the app makes while it's shutting down are collected too
+				log.Debugf("ptmon: processor - waiting for target app to exit (signal=%v timeout=%v)...", appStopSignal, appStopTimeout)
+				stopTimeout := time.After(appStopTimeout)
+				for {
+					select {
+					case rc := <-collectorDoneChan:
+						log.Info("ptmon: processor - target app exited =>", rc)
+						break done
+					case e := <-eventChan:
+						countEvent(e)
+					case <-stopTimeout:
+						log.Warn("ptmon: processor - target app didn't exit in time (killing it)")
+						if err := app.Process.Kill(); err != nil {
+							log.Warnln("ptmon: processor - error killing target app =>", err)
+						}
+						break done
+					}
+				}
+			case e := <-eventChan:
+				countEvent(e)
 			}
 		}
 
+		close(collectorStopChan)
+
 		log.Debugf("ptmon: processor - executed syscall count = %d", ptReport.SyscallCount)
 		log.Debugf("ptmon: processor - number of syscalls: %v", len(syscallStats))
 		for scNum, scCount := range syscallStats {
@@ -0,0 +1,75 @@
+package target
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+//NOTES:
+//* the capabilities are per thread and the app process is forked from the thread that starts it,
+//  so the capabilities are dropped on the (locked) thread that starts the app
+//* the thread is never unlocked (the runtime terminates the locked thread when its goroutine exits),
+//  so it's not reused by the other sensor goroutines
+//* the sensor keeps its effective and permitted capabilities (the bounding set limits only
+//  the capabilities the executed programs get), so it can still monitor the app
+
+const (
+	linuxCapabilityVersion3 = 0x20080522
+	prCapBsetDrop           = 24
+	prCapAmbient            = 47
+	prCapAmbientLower       = 3
+)
+
+// the capability numbers (from linux/capability.h) for the capabilities the sensor needs
+var capabilityNumbers = map[string]uint{
+	"NET_ADMIN":  12,
+	"SYS_PTRACE": 19,
+	"SYS_ADMIN":  21,
+}
+
+type capUserHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capUserData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// dropCapabilities removes the capabilities from the bounding, inheritable and ambient sets
+// of the calling thread, so the programs it executes don't get them
+func dropCapabilities(names []string) error {
+	header := capUserHeader{version: linuxCapabilityVersion3}
+	var data [2]capUserData
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET,
+		uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("capget: %v", errno)
+	}
+
+	for _, name := range names {
+		capNum, ok := capabilityNumbers[strings.TrimPrefix(strings.ToUpper(name), "CAP_")]
+		if !ok {
+			return fmt.Errorf("unknown capability: %s", name)
+		}
+
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapBsetDrop, uintptr(capNum), 0, 0, 0, 0); errno != 0 {
+			return fmt.Errorf("prctl(PR_CAPBSET_DROP,%s): %v", name, errno)
+		}
+
+		//the ambient capabilities are not supported by the older kernels (nothing to lower there)
+		syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientLower, uintptr(capNum), 0, 0, 0)
+
+		data[capNum/32].inheritable &^= 1 << (capNum % 32)
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("capset: %v", errno)
+	}
+
+	return nil
+}
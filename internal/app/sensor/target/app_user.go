@@ -0,0 +1,79 @@
+package target
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// the home directory for the users that don't exist in the container (same as Docker)
+const defaultHomeDir = "/"
+
+// appCredential returns the credential and the home directory for the target application user
+// ('user', 'uid', 'user:group' or 'uid:gid'; the numeric ids don't need to exist in the container).
+// Same as Docker, the primary group is root when the user doesn't exist in the container
+// and the users that exist in the container also get their supplementary groups.
+func appCredential(appUser string) (*syscall.Credential, string, error) {
+	parts := strings.SplitN(appUser, ":", 2)
+	userPart := parts[0]
+
+	var info *user.User
+	var uid, gid uint64
+	var err error
+	if uid, err = strconv.ParseUint(userPart, 10, 32); err != nil {
+		var lookupErr error
+		if info, lookupErr = user.Lookup(userPart); lookupErr != nil {
+			return nil, "", fmt.Errorf("unknown user '%s': %v", userPart, lookupErr)
+		}
+
+		if uid, err = strconv.ParseUint(info.Uid, 10, 32); err != nil {
+			return nil, "", err
+		}
+
+		if gid, err = strconv.ParseUint(info.Gid, 10, 32); err != nil {
+			return nil, "", err
+		}
+	} else if info, err = user.LookupId(userPart); err == nil {
+		if gid, err = strconv.ParseUint(info.Gid, 10, 32); err != nil {
+			gid = 0
+		}
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		groupPart := parts[1]
+		if gid, err = strconv.ParseUint(groupPart, 10, 32); err != nil {
+			groupInfo, lookupErr := user.LookupGroup(groupPart)
+			if lookupErr != nil {
+				return nil, "", fmt.Errorf("unknown group '%s': %v", groupPart, lookupErr)
+			}
+
+			if gid, err = strconv.ParseUint(groupInfo.Gid, 10, 32); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	credential := &syscall.Credential{
+		Uid: uint32(uid),
+		Gid: uint32(gid),
+	}
+
+	homeDir := defaultHomeDir
+	if info != nil {
+		if info.HomeDir != "" {
+			homeDir = info.HomeDir
+		}
+
+		if groupIDs, err := info.GroupIds(); err == nil {
+			for _, groupID := range groupIDs {
+				if id, err := strconv.ParseUint(groupID, 10, 32); err == nil && id != gid {
+					credential.Groups = append(credential.Groups, uint32(id))
+				}
+			}
+		}
+	}
+
+	return credential, homeDir, nil
+}
@@ -3,16 +3,35 @@ package target
 import (
 	"os"
 	"os/exec"
+	"runtime"
+	"strings"
 	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 )
 
 // Start starts the target application in the container
-func Start(appName string, appArgs []string, appDir string, doPtrace bool) (*exec.Cmd, error) {
-	log.Debugf("sensor.startTargetApp(%v,%v,%v)", appName, appArgs, appDir)
+// (as the app user if it's not empty; the sensor itself keeps running as root).
+// Same as the container runtime, the app user gets its supplementary groups
+// and its home directory in the HOME env var (unless keepHome is set).
+// The dropCaps capabilities (the capabilities only the sensor needs) are not passed to the app
+// (they are dropped on the calling thread, so the thread stays locked to the calling goroutine
+// and the runtime discards it when the goroutine exits).
+func Start(appName string, appArgs []string, appDir string, appUser string, keepHome bool, dropCaps []string, doPtrace bool) (*exec.Cmd, error) {
+	log.Debugf("sensor.startTargetApp(%v,%v,%v,%v,%v,%v)", appName, appArgs, appDir, appUser, keepHome, dropCaps)
 	app := exec.Command(appName, appArgs...)
 
+	if len(dropCaps) > 0 {
+		//the app is forked from this thread (it has to keep the dropped capabilities dropped);
+		//the thread is not unlocked, so the other goroutines never run on it without the capabilities
+		runtime.LockOSThread()
+
+		if err := dropCapabilities(dropCaps); err != nil {
+			log.Warnf("sensor.startTargetApp: error dropping the sensor capabilities: %v", err)
+			return nil, err
+		}
+	}
+
 	if doPtrace {
 		app.SysProcAttr = &syscall.SysProcAttr{
 			Ptrace:    true,
@@ -20,6 +39,24 @@ func Start(appName string, appArgs []string, appDir string, doPtrace bool) (*exe
 		}
 	}
 
+	if appUser != "" {
+		credential, homeDir, err := appCredential(appUser)
+		if err != nil {
+			log.Warnf("sensor.startTargetApp: app user error: %v", err)
+			return nil, err
+		}
+
+		if app.SysProcAttr == nil {
+			app.SysProcAttr = &syscall.SysProcAttr{}
+		}
+
+		app.SysProcAttr.Credential = credential
+
+		if !keepHome {
+			app.Env = append(envWithout(os.Environ(), "HOME"), "HOME="+homeDir)
+		}
+	}
+
 	app.Dir = appDir
 	app.Stdout = os.Stdout
 	app.Stderr = os.Stderr
@@ -34,3 +71,14 @@ func Start(appName string, appArgs []string, appDir string, doPtrace bool) (*exe
 	log.Debugf("sensor.startTargetApp: started target app --> PID=%d", app.Process.Pid)
 	return app, nil
 }
+
+func envWithout(env []string, name string) []string {
+	var result []string
+	for _, envVar := range env {
+		if !strings.HasPrefix(envVar, name+"=") {
+			result = append(result, envVar)
+		}
+	}
+
+	return result
+}
@@ -27,14 +27,42 @@ type Message interface {
 
 // StartMonitor contains the start monitor command fields
 type StartMonitor struct {
-	AppName      string   `json:"app_name"`
-	AppArgs      []string `json:"app_args,omitempty"`
-	AppUser      string   `json:"app_user,omitempty"`
-	Excludes     []string `json:"excludes,omitempty"`
-	Includes     []string `json:"includes,omitempty"`
-	IncludeBins  []string `json:"include_bins,omitempty"`
-	IncludeExes  []string `json:"include_exes,omitempty"`
-	IncludeShell bool     `json:"include_shell,omitempty"`
+	AppName      string            `json:"app_name"`
+	AppArgs      []string          `json:"app_args,omitempty"`
+	AppUser      string            `json:"app_user,omitempty"`
+	Excludes     []string          `json:"excludes,omitempty"`
+	Includes     []string          `json:"includes,omitempty"`
+	IncludeMaps  map[string]string `json:"include_maps,omitempty"`
+	IncludeBins  []string          `json:"include_bins,omitempty"`
+	IncludeExes  []string          `json:"include_exes,omitempty"`
+	IncludeShell bool              `json:"include_shell,omitempty"`
+	//IncludeZoneinfo includes the timezone database and IncludeLocales includes the locale data
+	//for the selected locales (for the image libc)
+	IncludeZoneinfo bool     `json:"include_zoneinfo,omitempty"`
+	IncludeLocales  []string `json:"include_locales,omitempty"`
+	//DetectSecrets enables the secret detection in the container filesystem
+	//(ExcludeSecrets also excludes the detected secret files from the minified image)
+	DetectSecrets  bool `json:"detect_secrets,omitempty"`
+	ExcludeSecrets bool `json:"exclude_secrets,omitempty"`
+	//SecretPaths are the runtime secret files mounted in the container (they are never saved)
+	SecretPaths []string `json:"secret_paths,omitempty"`
+	//ExcludeDeviceMounts excludes the host device driver files the container runtime hooks mount
+	//in the container (e.g., the NVIDIA driver libraries for the GPUs)
+	ExcludeDeviceMounts bool `json:"exclude_device_mounts,omitempty"`
+	//AppStopSignal and AppStopTimeout (seconds) are used to stop the target app when the monitoring ends
+	//(the app is killed if it doesn't exit in time; the sensor doesn't wait for it if there's no timeout)
+	AppStopSignal  string `json:"app_stop_signal,omitempty"`
+	AppStopTimeout int    `json:"app_stop_timeout,omitempty"`
+	//RunAsUser starts the app as AppUser (only for the explicit user override; the app runs as root otherwise)
+	//and KeepHome keeps the HOME env var (it's set explicitly, so it's not set to the app user home directory)
+	RunAsUser bool `json:"run_as_user,omitempty"`
+	KeepHome  bool `json:"keep_home,omitempty"`
+	//AppDropCaps are the capabilities the sensor needs, but the app doesn't get
+	//(the container has them only for the sensor)
+	AppDropCaps []string `json:"app_drop_caps,omitempty"`
+	//AttachPid is the PID of the already running target app process
+	//(the sensor monitors it instead of starting the app)
+	AttachPid int `json:"attach_pid,omitempty"`
 }
 
 // GetName returns the command message ID for the start monitor command
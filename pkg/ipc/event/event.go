@@ -22,9 +22,19 @@ const (
 	StartMonitorFailed Type = "event.monitor.start.failed"
 	StopMonitorDone    Type = "event.monitor.stop.done"
 	ShutdownSensorDone Type = "event.sensor.shutdown.done"
+	ArtifactsProgress  Type = "event.artifacts.progress"
 	Error              Type = "event.error"
 )
 
+// ArtifactsProgressData is the sensor artifact processing progress
+// (the processed files and bytes for the artifact processing phase)
+type ArtifactsProgressData struct {
+	Phase      string `json:"phase"`
+	Files      int64  `json:"files"`
+	TotalFiles int64  `json:"total_files"`
+	Bytes      int64  `json:"bytes"`
+}
+
 type Message struct {
 	Name Type        `json:"name"`
 	Data interface{} `json:"data,omitempty"`
@@ -48,6 +58,13 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 			return err
 		}
 
+		m.Data = &data
+	case ArtifactsProgress:
+		var data ArtifactsProgressData
+		if err := json.Unmarshal(tmp.Data, &data); err != nil {
+			return err
+		}
+
 		m.Data = &data
 	default:
 		if len(tmp.Data) > 0 {
@@ -0,0 +1,25 @@
+package pdiscover
+
+// stubs, so the master app builds on Windows (the process events are only used in the sensor)...
+
+func createListener() (eventListener, error) {
+	return nil, nil
+}
+
+func (w *Watcher) unregister(pid int) error {
+	return nil
+}
+
+func (w *Watcher) register(pid int, flags uint32) error {
+	return nil
+}
+
+func (w *Watcher) readEvents() {
+}
+
+func (w *Watcher) readAllEvents() {
+}
+
+func (w *Watcher) isWatching(pid int, event uint32) bool {
+	return false
+}
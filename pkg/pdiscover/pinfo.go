@@ -7,4 +7,5 @@ import (
 var (
 	ErrInvalidProcArgsLen = errors.New("invalid ProcArgs length")
 	ErrInvalidProcInfo    = errors.New("invalid proc info")
+	ErrUnsupported        = errors.New("unsupported operation")
 )
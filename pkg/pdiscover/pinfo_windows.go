@@ -0,0 +1,23 @@
+package pdiscover
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func GetOwnProcPath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(exePath)
+}
+
+func GetProcPath(pid int) (string, error) {
+	if pid == os.Getpid() {
+		return GetOwnProcPath()
+	}
+
+	return "", ErrUnsupported
+}
@@ -0,0 +1,41 @@
+package report
+
+// DefaultBuildContextFileName is the minified image build context manifest file name
+const DefaultBuildContextFileName = "build-context.json"
+
+// Build context file types
+const (
+	ContextFileDir     = "dir"
+	ContextFileRegular = "file"
+	ContextFileSymlink = "symlink"
+	ContextFileOther   = "other"
+)
+
+// BuildContextManifest lists the generated Dockerfile and the files in the minified image build context,
+// so the minified image can be audited or rebuilt without docker-slim
+type BuildContextManifest struct {
+	Dockerfile       string `json:"dockerfile"`
+	DockerfileDigest string `json:"dockerfile_digest"`
+	BaseImage        string `json:"base_image,omitempty"`
+	Reproducible     bool   `json:"reproducible,omitempty"`
+	//Directories are the data directories in the order they are copied to the image
+	Directories []*BuildContextDir `json:"directories"`
+}
+
+// BuildContextDir is a build context data directory
+type BuildContextDir struct {
+	Name string `json:"name"`
+	//Owner is the image owner of the copied files (root if it's not set)
+	Owner string              `json:"owner,omitempty"`
+	Files []*BuildContextFile `json:"files"`
+}
+
+// BuildContextFile is a file in a build context data directory
+type BuildContextFile struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	Size   int64  `json:"size,omitempty"`
+	Digest string `json:"digest,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
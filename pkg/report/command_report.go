@@ -14,12 +14,15 @@ import (
 
 // Command state constants
 const (
-	CmdStateUnknown   = "unknown"
-	CmdStateError     = "error"
-	CmdStateStarted   = "started"
-	CmdStateCompleted = "completed"
-	CmdStateExited    = "exited"
-	CmdStateDone      = "done"
+	CmdStateUnknown     = "unknown"
+	CmdStateError       = "error"
+	CmdStateStarted     = "started"
+	CmdStateCompleted   = "completed"
+	CmdStateExited      = "exited"
+	CmdStateDone        = "done"
+	CmdStateTimeout     = "timeout"
+	CmdStateCrashed     = "crashed"
+	CmdStateInterrupted = "interrupted"
 )
 
 // Command type constants
@@ -27,6 +30,9 @@ const (
 	CmdTypeBuild   CmdType = "build"
 	CmdTypeProfile CmdType = "profile"
 	CmdTypeInfo    CmdType = "info"
+	CmdTypeMerge   CmdType = "merge-profiles"
+	CmdTypeShared  CmdType = "shared-layer"
+	CmdTypeBatch   CmdType = "batch"
 )
 
 // CmdType is the command name data type
@@ -35,9 +41,21 @@ type CmdType string
 // Command is the common command report data
 type Command struct {
 	reportLocation string
-	Type           CmdType `json:"type"`
-	State          string  `json:"state"`
-	Error          string  `json:"error,omitempty"`
+	Type           CmdType        `json:"type"`
+	State          string         `json:"state"`
+	Error          string         `json:"error,omitempty"`
+	ContainerExit  *ContainerExit `json:"container_exit,omitempty"`
+}
+
+// ContainerExit describes the unexpected target container exit (or restart) during the monitoring
+// (the logs are the ends of the container output)
+type ContainerExit struct {
+	ContainerID string `json:"container_id"`
+	ExitCode    int    `json:"exit_code"`
+	OOMKilled   bool   `json:"oom_killed"`
+	Restarted   bool   `json:"restarted"`
+	Stdout      string `json:"stdout,omitempty"`
+	Stderr      string `json:"stderr,omitempty"`
 }
 
 // ImageMetadata provides basic image metadata
@@ -72,29 +90,170 @@ type BuildCommand struct {
 	MinifiedImageSizeHuman string                  `json:"minified_image_size_human"`
 	MinifiedImage          string                  `json:"minified_image"`
 	MinifiedImageHasData   bool                    `json:"minified_image_has_data"`
+	MinifiedImageBase      string                  `json:"minified_image_base,omitempty"`
+	SharedLayer            string                  `json:"shared_layer,omitempty"`
+	SharedLayerExtraFiles  []string                `json:"shared_layer_extra_files,omitempty"`
+	OCILayout              string                  `json:"oci_layout,omitempty"`
+	OCIManifestDigest      string                  `json:"oci_manifest_digest,omitempty"`
 	MinifiedBy             float64                 `json:"minified_by"`
 	ArtifactLocation       string                  `json:"artifact_location"`
 	ContainerReportName    string                  `json:"container_report_name"`
+	BuildContextName       string                  `json:"build_context_name,omitempty"`
 	SeccompProfileName     string                  `json:"seccomp_profile_name"`
 	AppArmorProfileName    string                  `json:"apparmor_profile_name"`
+	AppArmorComplainName   string                  `json:"apparmor_complain_profile_name,omitempty"`
+	PodSpecName            string                  `json:"k8s_pod_spec_name,omitempty"`
+	DockerRunName          string                  `json:"docker_run_name,omitempty"`
+	ComposeName            string                  `json:"compose_name,omitempty"`
+	DockerRunCommand       string                  `json:"docker_run_command,omitempty"`
+	RegoPolicyName         string                  `json:"rego_policy_name,omitempty"`
+	ConstraintTemplateName string                  `json:"constraint_template_name,omitempty"`
+	ProfilesCheck          *ProfilesCheck          `json:"profiles_check,omitempty"`
+	Capabilities           *CapabilitySet          `json:"capabilities,omitempty"`
+	GVisor                 *GVisorCompatibility    `json:"gvisor,omitempty"`
+	Secrets                []*SecretFinding        `json:"secrets,omitempty"`
+	FileHardening          []*FileChange           `json:"file_hardening,omitempty"`
+	StrippedBinaries       []*StrippedBinary       `json:"stripped_binaries,omitempty"`
+	ArtifactHooks          []*ArtifactHookRun      `json:"artifact_hooks,omitempty"`
+	NewFiles               []string                `json:"new_files,omitempty"`
+	LoaderIssues           []*LoaderIssue          `json:"loader_issues,omitempty"`
+	ImageLayers            []*ImageLayer           `json:"image_layers,omitempty"`
+	BaseReuse              *BaseReuse              `json:"base_reuse,omitempty"`
+	BaseImageCheck         *BaseImageCheck         `json:"base_image_check,omitempty"`
+	MonitorCache           *MonitorCache           `json:"monitor_cache,omitempty"`
+	FileMonitor            *FileMonitorStats       `json:"file_monitor,omitempty"`
+	ResumedFrom            string                  `json:"resumed_from,omitempty"`
+	SecurityWarnings       []string                `json:"security_warnings,omitempty"`
 	ImageStack             []*dockerfile.ImageInfo `json:"image_stack"`
 }
 
+// FileMonitorStats is the sensor file event monitor summary
+// (the lost events mean the minified image can miss the files the container used)
+type FileMonitorStats struct {
+	Events            uint32 `json:"events"`
+	QueueOverflows    uint64 `json:"queue_overflows"`
+	MergedEvents      uint64 `json:"merged_events"`
+	BackpressureWaits uint64 `json:"backpressure_waits"`
+	EventsLost        bool   `json:"events_lost"`
+}
+
+// CapabilitySet is the recommended (minimal) Linux capability set for the minified container
+type CapabilitySet struct {
+	Drop           []string `json:"drop"`
+	Add            []string `json:"add"`
+	DockerRunArgs  string   `json:"docker_run_args"`
+	ComposeSnippet string   `json:"compose_snippet"`
+}
+
+// GVisorCompatibility is the compatibility of the observed syscalls with the gVisor (runsc) runtime
+type GVisorCompatibility struct {
+	//Verdict is 'compatible', 'likely' (some syscalls are partially supported) or 'unlikely'
+	Verdict     string          `json:"verdict"`
+	Unsupported []string        `json:"unsupported,omitempty"`
+	Partial     []string        `json:"partial,omitempty"`
+	Syscalls    []GVisorSyscall `json:"syscalls,omitempty"`
+}
+
+// GVisorSyscall is an observed syscall gVisor doesn't fully support
+type GVisorSyscall struct {
+	Name    string `json:"name"`
+	Support string `json:"support"`
+	Note    string `json:"note"`
+}
+
+// FileChange is a minified image file permission or ownership change made by the file hardening
+type FileChange struct {
+	FilePath string `json:"file_path"`
+	Change   string `json:"change"`
+	Before   string `json:"before"`
+	After    string `json:"after"`
+}
+
+// StrippedBinary is a minified image binary without the debug sections (the sizes are in bytes)
+type StrippedBinary struct {
+	FilePath string `json:"file_path"`
+	Before   int64  `json:"before"`
+	After    int64  `json:"after"`
+}
+
+// ArtifactHookRun is an artifact hook script run with the minified image file changes it made
+type ArtifactHookRun struct {
+	Script   string   `json:"script"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// LoaderIssue is a minified image executable with the missing dynamic loader files
+// (the files included from the source image and the files still missing)
+type LoaderIssue struct {
+	FilePath    string   `json:"file_path"`
+	Interpreter string   `json:"interpreter,omitempty"`
+	Libraries   []string `json:"libraries,omitempty"`
+	Included    []string `json:"included,omitempty"`
+}
+
+// BaseImageCheck is the '--slim-base' base image check (the base image and the source image libc
+// and distro, the artifact files the base image already has and the base image files the minified image replaces)
+type BaseImageCheck struct {
+	Image           string   `json:"image"`
+	Libc            string   `json:"libc,omitempty"`
+	SourceLibc      string   `json:"source_libc,omitempty"`
+	Distro          string   `json:"distro,omitempty"`
+	SourceDistro    string   `json:"source_distro,omitempty"`
+	Mismatch        bool     `json:"mismatch"`
+	RemovedFiles    int      `json:"removed_files"`
+	RemovedSize     int64    `json:"removed_size"`
+	OverriddenFiles []string `json:"overridden_files,omitempty"`
+}
+
+// BaseReuse is the target image base image check for the 'reuse-base' layer strategy
+// (the size of the base image file data and the part the minified image doesn't need)
+type BaseReuse struct {
+	Image      string `json:"image"`
+	Reused     bool   `json:"reused"`
+	Size       int64  `json:"size"`
+	UnusedSize int64  `json:"unused_size"`
+}
+
+// MonitorCache is the container monitoring result cache record used by the build (--use-cache)
+type MonitorCache struct {
+	Key string `json:"key"`
+	Hit bool   `json:"hit"`
+}
+
+// ImageLayer is a minified image layer created by the 'split' layer strategy
+type ImageLayer struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// ProfilesCheck is the result of the minified image run with the generated security profiles
+type ProfilesCheck struct {
+	Passed          bool     `json:"passed"`
+	ExitCode        int      `json:"exit_code"`
+	AppArmorApplied bool     `json:"apparmor_applied"`
+	AuditChecked    bool     `json:"audit_checked"`
+	Denials         []string `json:"denials,omitempty"`
+}
+
 // ProfileCommand is the 'profile' command report data
 type ProfileCommand struct {
 	Command
-	OriginalImage          string  `json:"original_image"`
-	OriginalImageSize      int64   `json:"original_image_size"`
-	OriginalImageSizeHuman string  `json:"original_image_size_human"`
-	MinifiedImageSize      int64   `json:"minified_image_size"`
-	MinifiedImageSizeHuman string  `json:"minified_image_size_human"`
-	MinifiedImage          string  `json:"minified_image"`
-	MinifiedImageHasData   bool    `json:"minified_image_has_data"`
-	MinifiedBy             float64 `json:"minified_by"`
-	ArtifactLocation       string  `json:"artifact_location"`
-	ContainerReportName    string  `json:"container_report_name"`
-	SeccompProfileName     string  `json:"seccomp_profile_name"`
-	AppArmorProfileName    string  `json:"apparmor_profile_name"`
+	OriginalImage          string   `json:"original_image"`
+	OriginalImageSize      int64    `json:"original_image_size"`
+	OriginalImageSizeHuman string   `json:"original_image_size_human"`
+	MinifiedImageSize      int64    `json:"minified_image_size"`
+	MinifiedImageSizeHuman string   `json:"minified_image_size_human"`
+	MinifiedImage          string   `json:"minified_image"`
+	MinifiedImageHasData   bool     `json:"minified_image_has_data"`
+	MinifiedBy             float64  `json:"minified_by"`
+	ArtifactLocation       string   `json:"artifact_location"`
+	ContainerReportName    string   `json:"container_report_name"`
+	SeccompProfileName     string   `json:"seccomp_profile_name"`
+	AppArmorProfileName    string   `json:"apparmor_profile_name"`
+	SecurityWarnings       []string `json:"security_warnings,omitempty"`
 }
 
 // InfoCommand is the 'info' command report data
@@ -114,6 +273,51 @@ type InfoCommand struct {
 	AppArmorProfileName    string  `json:"apparmor_profile_name"`
 }
 
+// ContainerProfiles are the security profiles generated for one container
+type ContainerProfiles struct {
+	ArtifactLocation    string `json:"artifact_location"`
+	SeccompProfileName  string `json:"seccomp_profile_name,omitempty"`
+	AppArmorProfileName string `json:"apparmor_profile_name,omitempty"`
+}
+
+// MergeProfilesCommand is the 'merge-profiles' command report data
+type MergeProfilesCommand struct {
+	Command
+	Containers          []ContainerProfiles `json:"containers"`
+	OutputLocation      string              `json:"output_location"`
+	SeccompProfileName  string              `json:"seccomp_profile_name"`
+	AppArmorProfileName string              `json:"apparmor_profile_name"`
+}
+
+// SharedLayerCommand is the 'shared-layer' command report data
+type SharedLayerCommand struct {
+	Command
+	ArtifactLocations []string `json:"artifact_locations"`
+	OutputLocation    string   `json:"output_location"`
+	DiffID            string   `json:"diff_id,omitempty"`
+	Files             int      `json:"files"`
+	Size              int64    `json:"size"`
+}
+
+// BatchCommand is the 'batch' command report data
+type BatchCommand struct {
+	Command
+	Parallel int            `json:"parallel"`
+	Targets  []*BatchTarget `json:"targets"`
+	Failed   int            `json:"failed"`
+}
+
+// BatchTarget is the 'build' command run for one 'batch' command target
+// (the report is the 'build' command report for the target)
+type BatchTarget struct {
+	Image    string        `json:"image"`
+	Args     []string      `json:"args"`
+	ExitCode int           `json:"exit_code"`
+	Duration string        `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Report   *BuildCommand `json:"report,omitempty"`
+}
+
 // NewBuildCommand creates a new 'build' command report
 func NewBuildCommand(reportLocation string) *BuildCommand {
 	return &BuildCommand{
@@ -136,6 +340,39 @@ func NewProfileCommand(reportLocation string) *ProfileCommand {
 	}
 }
 
+// NewMergeProfilesCommand creates a new 'merge-profiles' command report
+func NewMergeProfilesCommand(reportLocation string) *MergeProfilesCommand {
+	return &MergeProfilesCommand{
+		Command: Command{
+			reportLocation: reportLocation,
+			Type:           CmdTypeMerge,
+			State:          CmdStateUnknown,
+		},
+	}
+}
+
+// NewSharedLayerCommand creates a new 'shared-layer' command report
+func NewSharedLayerCommand(reportLocation string) *SharedLayerCommand {
+	return &SharedLayerCommand{
+		Command: Command{
+			reportLocation: reportLocation,
+			Type:           CmdTypeShared,
+			State:          CmdStateUnknown,
+		},
+	}
+}
+
+// NewBatchCommand creates a new 'batch' command report
+func NewBatchCommand(reportLocation string) *BatchCommand {
+	return &BatchCommand{
+		Command: Command{
+			reportLocation: reportLocation,
+			Type:           CmdTypeBatch,
+			State:          CmdStateUnknown,
+		},
+	}
+}
+
 // NewInfoCommand creates a new 'info' command report
 func NewInfoCommand(reportLocation string) *InfoCommand {
 	return &InfoCommand{
@@ -197,3 +434,18 @@ func (p *ProfileCommand) Save() {
 func (p *InfoCommand) Save() {
 	p.saveInfo(p)
 }
+
+// Save saves the Merge Profiles command report data to the configured location
+func (p *MergeProfilesCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the Shared Layer command report data to the configured location
+func (p *SharedLayerCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the Batch command report data to the configured location
+func (p *BatchCommand) Save() {
+	p.saveInfo(p)
+}
@@ -3,6 +3,7 @@ package report
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 )
 
@@ -73,6 +74,12 @@ type FanMonitorReport struct {
 	MainProcess      *ProcessInfo                    `json:"main_process"`
 	Processes        map[string]*ProcessInfo         `json:"processes"`
 	ProcessFiles     map[string]map[string]*FileInfo `json:"process_files"`
+	//QueueOverflows is the number of the kernel event queue overflows (the file events are lost when it overflows),
+	//MergedEvents is the number of the queued events merged with the other events for the same process file
+	//and BackpressureWaits is the number of times the event collector waited for the event processor
+	QueueOverflows    uint64 `json:"queue_overflows,omitempty"`
+	MergedEvents      uint64 `json:"merged_events,omitempty"`
+	BackpressureWaits uint64 `json:"backpressure_waits,omitempty"`
 }
 
 // PeMonitorReport is a processing monitoring report
@@ -161,9 +168,21 @@ type SystemReport struct {
 
 // ContainerReport contains container report fields
 type ContainerReport struct {
-	System   SystemReport   `json:"system"`
-	Monitors MonitorReports `json:"monitors"`
-	Image    ImageReport    `json:"image"`
+	System   SystemReport     `json:"system"`
+	Monitors MonitorReports   `json:"monitors"`
+	Image    ImageReport      `json:"image"`
+	Secrets  []*SecretFinding `json:"secrets,omitempty"`
+}
+
+// SecretFinding is a likely secret (or a credentials file) in the container filesystem
+type SecretFinding struct {
+	FilePath string `json:"file_path"`
+	Type     string `json:"type"`
+	Line     int    `json:"line,omitempty"`
+	//Minified is true if the file is in the minified image file set
+	Minified bool `json:"minified"`
+	//Excluded is true if the file was excluded from the minified image
+	Excluded bool `json:"excluded"`
 }
 
 // PermSetFromFlags maps artifact flags to permissions
@@ -183,3 +202,77 @@ func PermSetFromFlags(flags map[string]bool) string {
 
 	return b.String()
 }
+
+// MergeContainerReports combines the container reports for the containers sharing a security profile
+// (the syscall stats and the file artifacts are merged, the containers need to use the same architecture)
+func MergeContainerReports(creports []*ContainerReport) (*ContainerReport, error) {
+	merged := &ContainerReport{
+		Monitors: MonitorReports{
+			Pt: &PtMonitorReport{
+				SyscallStats: map[string]SyscallStatInfo{},
+			},
+		},
+	}
+
+	files := map[string]*ArtifactProps{}
+	for _, creport := range creports {
+		if merged.System.Type == "" {
+			merged.System = creport.System
+		}
+
+		if pt := creport.Monitors.Pt; pt != nil {
+			if merged.Monitors.Pt.ArchName == "" {
+				merged.Monitors.Pt.ArchName = pt.ArchName
+			} else if pt.ArchName != "" && pt.ArchName != merged.Monitors.Pt.ArchName {
+				return nil, fmt.Errorf("container reports for different architectures: %s and %s",
+					merged.Monitors.Pt.ArchName, pt.ArchName)
+			}
+
+			merged.Monitors.Pt.SyscallCount += pt.SyscallCount
+			for key, stat := range pt.SyscallStats {
+				if mergedStat, ok := merged.Monitors.Pt.SyscallStats[key]; ok {
+					mergedStat.Count += stat.Count
+					merged.Monitors.Pt.SyscallStats[key] = mergedStat
+				} else {
+					merged.Monitors.Pt.SyscallStats[key] = stat
+				}
+			}
+		}
+
+		for _, props := range creport.Image.Files {
+			if props == nil {
+				continue
+			}
+
+			mergedProps, ok := files[props.FilePath]
+			if !ok {
+				propsCopy := *props
+				if props.Flags != nil {
+					propsCopy.Flags = map[string]bool{}
+					for flag, value := range props.Flags {
+						propsCopy.Flags[flag] = value
+					}
+				}
+
+				files[props.FilePath] = &propsCopy
+				merged.Image.Files = append(merged.Image.Files, &propsCopy)
+				continue
+			}
+
+			if props.Flags != nil {
+				if mergedProps.Flags == nil {
+					mergedProps.Flags = map[string]bool{}
+				}
+
+				for flag, value := range props.Flags {
+					if value {
+						mergedProps.Flags[flag] = true
+					}
+				}
+			}
+		}
+	}
+
+	merged.Monitors.Pt.SyscallNum = uint32(len(merged.Monitors.Pt.SyscallStats))
+	return merged, nil
+}
@@ -8,17 +8,19 @@ const (
 	ArchName386         ArchName = "386"
 	ArchNameAmd64       ArchName = "amd64"
 	ArchNameArm32       ArchName = "armhf"
+	ArchNameArm64       ArchName = "arm64"
 )
 
 type MachineName string
 
 const (
-	MachineNameNamei386   MachineName = "i386"
-	MachineNameNamei586   MachineName = "i586"
-	MachineNameNamei686   MachineName = "i686"
-	MachineNameNamex86_64 MachineName = "x86_64"
-	MachineNameNameArm    MachineName = "armv7l"
-	MachineNameNameArm64  MachineName = "arm64"
+	MachineNameNamei386    MachineName = "i386"
+	MachineNameNamei586    MachineName = "i586"
+	MachineNameNamei686    MachineName = "i686"
+	MachineNameNamex86_64  MachineName = "x86_64"
+	MachineNameNameArm     MachineName = "armv7l"
+	MachineNameNameArm64   MachineName = "arm64"
+	MachineNameNameAarch64 MachineName = "aarch64"
 )
 
 type ArchBits uint8
@@ -59,6 +61,12 @@ var ArmFamily32Arch = ArchInfo{
 	Bits:   ArchBits32,
 }
 
+var ArmFamily64Arch = ArchInfo{
+	Name:   ArchNameArm64,
+	Family: ArchFamilyArm,
+	Bits:   ArchBits64,
+}
+
 var unsupportedArch = ArchInfo{
 	Name: ArchNameUnsupported,
 }
@@ -68,12 +76,13 @@ var unknownArch = ArchInfo{
 }
 
 var archMap = map[MachineName]*ArchInfo{
-	MachineNameNamei386:   &x86Family32Arch,
-	MachineNameNamei586:   &x86Family32Arch,
-	MachineNameNamei686:   &x86Family32Arch,
-	MachineNameNamex86_64: &x86Family64Arch,
-	MachineNameNameArm:    &ArmFamily32Arch,
-	MachineNameNameArm64:  &unsupportedArch,
+	MachineNameNamei386:    &x86Family32Arch,
+	MachineNameNamei586:    &x86Family32Arch,
+	MachineNameNamei686:    &x86Family32Arch,
+	MachineNameNamex86_64:  &x86Family64Arch,
+	MachineNameNameArm:     &ArmFamily32Arch,
+	MachineNameNameArm64:   &ArmFamily64Arch,
+	MachineNameNameAarch64: &ArmFamily64Arch,
 }
 
 func MachineToArchName(mtype string) ArchName {
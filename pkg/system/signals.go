@@ -0,0 +1,80 @@
+package system
+
+import (
+	"strconv"
+	"strings"
+)
+
+//NOTES:
+//* the signal numbers are the Linux signal numbers (x86 and arm), so they can be resolved
+//  on any host OS (the containers are always Linux containers)
+//* the names work with or without the "SIG" prefix (same as 'docker run --stop-signal')
+
+const (
+	SignalMinRealtime = 34
+	SignalMaxRealtime = 64
+)
+
+var signalNumbers = map[string]int{
+	"SIGHUP":    1,
+	"SIGINT":    2,
+	"SIGQUIT":   3,
+	"SIGILL":    4,
+	"SIGTRAP":   5,
+	"SIGABRT":   6,
+	"SIGIOT":    6,
+	"SIGBUS":    7,
+	"SIGFPE":    8,
+	"SIGKILL":   9,
+	"SIGUSR1":   10,
+	"SIGSEGV":   11,
+	"SIGUSR2":   12,
+	"SIGPIPE":   13,
+	"SIGALRM":   14,
+	"SIGTERM":   15,
+	"SIGSTKFLT": 16,
+	"SIGCHLD":   17,
+	"SIGCONT":   18,
+	"SIGSTOP":   19,
+	"SIGTSTP":   20,
+	"SIGTTIN":   21,
+	"SIGTTOU":   22,
+	"SIGURG":    23,
+	"SIGXCPU":   24,
+	"SIGXFSZ":   25,
+	"SIGVTALRM": 26,
+	"SIGPROF":   27,
+	"SIGWINCH":  28,
+	"SIGIO":     29,
+	"SIGPOLL":   29,
+	"SIGPWR":    30,
+	"SIGSYS":    31,
+}
+
+// SignalNumber returns the Linux signal number for the signal name
+// ('SIGTERM', 'TERM', 'SIGRTMIN+3' or a signal number like '15')
+func SignalNumber(name string) (int, bool) {
+	if num, err := strconv.Atoi(name); err == nil {
+		return num, num > 0 && num <= SignalMaxRealtime
+	}
+
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	if num, ok := signalNumbers[name]; ok {
+		return num, true
+	}
+
+	if strings.HasPrefix(name, "SIGRTMIN+") {
+		offset, err := strconv.Atoi(strings.TrimPrefix(name, "SIGRTMIN+"))
+		if err != nil || offset < 0 || SignalMinRealtime+offset > SignalMaxRealtime {
+			return 0, false
+		}
+
+		return SignalMinRealtime + offset, true
+	}
+
+	return 0, false
+}
@@ -4,6 +4,7 @@ package system
 //* syscall constants in the "syscall" package are nice, but some syscalls there are missing
 //* future versions will include more than just the syscall name
 //* 32bit (x86/i386) and 64bit (x86_64) syscall numbers are different
+//* arm64 uses the generic syscall table, so it doesn't have the legacy syscalls (e.g., 'open')
 
 const (
 	SyscallX86MinNum      = 0
@@ -22,6 +23,8 @@ func CallNumberResolver(arch ArchName) NumberResolverFunc {
 		return callNameX86Family64
 	case ArchNameArm32:
 		return callNameArmFamily32
+	case ArchNameArm64:
+		return callNameArmFamily64
 	default:
 		return nil
 	}
@@ -35,6 +38,8 @@ func CallNameResolver(arch ArchName) NameResolverFunc {
 		return callNumberX86Family64
 	case ArchNameArm32:
 		return callNumberArmFamily32
+	case ArchNameArm64:
+		return callNumberArmFamily64
 	default:
 		return nil
 	}
@@ -0,0 +1,35 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func newSystemInfo() SystemInfo {
+	var sysInfo SystemInfo
+
+	sysInfo.Sysname = runtime.GOOS
+	sysInfo.Nodename, _ = os.Hostname()
+	sysInfo.Machine = runtime.GOARCH
+	sysInfo.OsName = "Windows"
+
+	//note: the reported version is capped at 6.2 (Windows 8) for apps without a compatibility manifest
+	if version, err := syscall.GetVersion(); err == nil {
+		major := uint8(version)
+		minor := uint8(version >> 8)
+		build := uint16(version >> 16)
+
+		sysInfo.Release = fmt.Sprintf("%d.%d", major, minor)
+		sysInfo.OsBuild = fmt.Sprintf("%d", build)
+	}
+
+	return sysInfo
+}
+
+var defaultSysInfo = newSystemInfo()
+
+func GetSystemInfo() SystemInfo {
+	return defaultSysInfo
+}
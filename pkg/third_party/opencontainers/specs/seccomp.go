@@ -2,10 +2,11 @@ package specs
 
 // Seccomp represents syscall restrictions
 type Seccomp struct {
-	DefaultAction Action         `json:"defaultAction"`
-	Architectures []Arch         `json:"architectures,omitempty"`
-	ArchMap       []Architecture `json:"archMap,omitempty"`
-	Syscalls      []*Syscall     `json:"syscalls,omitempty"`
+	DefaultAction   Action         `json:"defaultAction"`
+	DefaultErrnoRet *uint          `json:"defaultErrnoRet,omitempty"`
+	Architectures   []Arch         `json:"architectures,omitempty"`
+	ArchMap         []Architecture `json:"archMap,omitempty"`
+	Syscalls        []*Syscall     `json:"syscalls,omitempty"`
 }
 
 //ArchMap - in Docker, but not in the Opencontainers spec (yet)
@@ -68,6 +69,7 @@ type Syscall struct {
 	Name     string   `json:"name,omitempty"`
 	Names    []string `json:"names,omitempty"`
 	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
 	Args     []*Arg   `json:"args,omitempty"`
 	Comment  string   `json:"comment,omitempty"`
 	Includes Filter   `json:"includes,omitempty"`
@@ -76,7 +78,7 @@ type Syscall struct {
 
 //Opencontainers spec only includes the 'Names' field
 //Docker also includes the old/original 'Name' field
-//Docker only: Comment, Includes, Excludes
+//Docker only: Comment, Includes, Excludes (and ErrnoRet before it was added to the spec)
 
 // Filter is used to conditionally apply Seccomp rules
 type Filter struct {
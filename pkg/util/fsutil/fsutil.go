@@ -1,9 +1,10 @@
 package fsutil
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"errors"
 	"fmt"
-	"golang.org/x/sys/unix"
 	"io"
 	"os"
 	"path/filepath"
@@ -25,6 +26,7 @@ var (
 	ErrSrcDirNotExist            = errors.New("source directory doesn't exist")
 	ErrSrcNotDir                 = errors.New("source is not a directory")
 	ErrSrcNotRegularFile         = errors.New("source is not a regular file")
+	ErrDstInSrcDir               = errors.New("destination is inside the source directory")
 	ErrUnsupportedFileObjectType = errors.New("unsupported file object type")
 )
 
@@ -172,8 +174,7 @@ func CopySymlinkFile(clone bool, src, dst string, makeDir bool) error {
 			return err
 		}
 
-		if sysStat, ok := srcInfo.Sys().(*syscall.Stat_t); ok {
-			ssi := SysStatInfo(sysStat)
+		if ssi, ok := FileSysStat(srcInfo); ok {
 			if err := UpdateSymlinkTimes(dst, ssi.Atime, ssi.Mtime); err != nil {
 				log.Warnln("CopySymlinkFile(%v,%v) - UpdateSymlinkTimes error", src, dst)
 			}
@@ -263,8 +264,7 @@ func CopyRegularFile(clone bool, src, dst string, makeDir bool) error {
 			log.Warnln("CopyRegularFile(%v,%v) - unable to set mode", src, dst)
 		}
 
-		if sysStat, ok := srcFileInfo.Sys().(*syscall.Stat_t); ok {
-			ssi := SysStatInfo(sysStat)
+		if ssi, ok := FileSysStat(srcFileInfo); ok {
 			if err := UpdateFileTimes(dst, ssi.Atime, ssi.Mtime); err != nil {
 				log.Warnln("CopyRegularFile(%v,%v) - UpdateFileTimes error", src, dst)
 			}
@@ -455,6 +455,158 @@ func CopyDir(clone bool,
 	return nil, errs
 }
 
+// ArchiveDir saves the directory in a gzip compressed tar file
+func ArchiveDir(src, dst string) error {
+	log.Debugf("ArchiveDir(%v,%v)", src, dst)
+
+	if src == "" {
+		return ErrNoSrcDir
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrSrcDirNotExist
+		}
+
+		return err
+	}
+
+	if !srcInfo.IsDir() {
+		return ErrSrcNotDir
+	}
+
+	//the archive can't be saved in the directory it archives
+	//(the walk would archive the archive it's writing)
+	inSrc, err := isInDir(src, dst)
+	if err != nil {
+		return err
+	}
+
+	if inSrc {
+		return ErrDstInSrcDir
+	}
+
+	if dstDir := filepath.Dir(dst); !DirExists(dstDir) {
+		if err := os.MkdirAll(dstDir, 0777); err != nil {
+			return err
+		}
+	}
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	gzw := gzip.NewWriter(dstFile)
+	tw := tar.NewWriter(gzw)
+
+	baseDir := filepath.Dir(src)
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		var linkRef string
+		if (info.Mode() & os.ModeSymlink) == os.ModeSymlink {
+			if linkRef, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, linkRef)
+		if err != nil {
+			return err
+		}
+
+		if header.Name, err = filepath.Rel(baseDir, path); err != nil {
+			return err
+		}
+
+		header.Name = filepath.ToSlash(header.Name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gzw.Close()
+}
+
+// isInDir checks if the path is the directory or if it's inside the directory
+// (the symlinks in the existing parts of the paths are resolved)
+func isInDir(dir, path string) (bool, error) {
+	dir, err := resolveExistingPath(dir)
+	if err != nil {
+		return false, err
+	}
+
+	path, err = resolveExistingPath(path)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false, nil
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
+
+// resolveExistingPath returns the absolute path with the symlinks resolved
+// in its longest existing prefix (the rest of the path doesn't exist yet)
+func resolveExistingPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...), nil
+		}
+
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 // ExeDir returns the directory information for the application
@@ -683,9 +835,3 @@ func UpdateFileTimes(target string, atime, mtime syscall.Timespec) error {
 	ts := []syscall.Timespec{atime, mtime}
 	return syscall.UtimesNano(target, ts)
 }
-
-//UpdateSymlinkTimes updates the atime and mtime timestamps on the target symlink
-func UpdateSymlinkTimes(target string, atime, mtime syscall.Timespec) error {
-	ts := []unix.Timespec{unix.Timespec(atime), unix.Timespec(mtime)}
-	return unix.UtimesNanoAt(unix.AT_FDCWD, target, ts, unix.AT_SYMLINK_NOFOLLOW)
-}
@@ -0,0 +1,146 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MaxLinkHops is the maximum number of the symlinks resolved for one path (like Linux)
+const MaxLinkHops = 40
+
+// ResolveRootPath resolves the symlinks in the path using the files in the root directory
+// (the root directory is an image filesystem: the absolute symlinks point to the root directory,
+// not to the host filesystem, and '..' doesn't go above the root directory, like in a chroot).
+// The last path component is not required to exist, so the resolved path can be used to create it.
+// With mkdirs the missing parent directories are created.
+func ResolveRootPath(root, filePath string, mkdirs bool) (string, error) {
+	return resolveRootPath(root, filePath, mkdirs, nil)
+}
+
+// ResolveLayeredRootPath resolves the symlinks in the path like ResolveRootPath (without creating
+// the missing directories) using the files in the layered root directories (the image filesystem
+// is the union of the root directories and the files in the later, upper, root directories
+// override the files with the same paths in the lower root directories)
+func ResolveLayeredRootPath(roots []string, filePath string) (string, error) {
+	lstat := func(imagePath string) (string, os.FileInfo, error) {
+		for idx := len(roots) - 1; idx >= 0; idx-- {
+			fullPath := filepath.Join(roots[idx], filepath.FromSlash(imagePath))
+			info, err := os.Lstat(fullPath)
+			if err == nil {
+				return fullPath, info, nil
+			}
+
+			if !os.IsNotExist(err) {
+				return "", nil, err
+			}
+		}
+
+		return "", nil, os.ErrNotExist
+	}
+
+	return resolvePath(filePath, lstat, nil, nil)
+}
+
+// RootPathLinks resolves the path like ResolveRootPath (without creating the missing directories)
+// and also returns the image paths of the symlinks it follows (in the order they are followed),
+// so the image filesystem copies can keep the symlinks (e.g., '/lib' => 'usr/lib' in the merged '/usr' images)
+func RootPathLinks(root, filePath string) (string, []string, error) {
+	var links []string
+	resolved, err := resolveRootPath(root, filePath, false, func(linkPath string) {
+		links = append(links, linkPath)
+	})
+
+	return resolved, links, err
+}
+
+func resolveRootPath(root, filePath string, mkdirs bool, onLink func(linkPath string)) (string, error) {
+	lstat := func(imagePath string) (string, os.FileInfo, error) {
+		fullPath := filepath.Join(root, filepath.FromSlash(imagePath))
+		info, err := os.Lstat(fullPath)
+		return fullPath, info, err
+	}
+
+	var mkdir func(imagePath string) error
+	if mkdirs {
+		mkdir = func(imagePath string) error {
+			return os.Mkdir(filepath.Join(root, filepath.FromSlash(imagePath)), 0755)
+		}
+	}
+
+	return resolvePath(filePath, lstat, mkdir, onLink)
+}
+
+// resolvePath resolves the symlinks in the image path
+// (lstat returns the host path and the file info for the image path,
+// and mkdir creates the missing parent directories if it's set)
+func resolvePath(filePath string,
+	lstat func(imagePath string) (string, os.FileInfo, error),
+	mkdir func(imagePath string) error,
+	onLink func(linkPath string)) (string, error) {
+	resolved := "/"
+	parts := strings.Split(strings.Trim(path.Clean("/"+filePath), "/"), "/")
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		fullPath, info, err := lstat(next)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+
+			if len(parts) == 0 {
+				return next, nil
+			}
+
+			if mkdir == nil {
+				return "", err
+			}
+
+			if err := mkdir(next); err != nil {
+				return "", err
+			}
+
+			resolved = next
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > MaxLinkHops {
+			return "", fmt.Errorf("too many symlinks: %s", filePath)
+		}
+
+		if onLink != nil {
+			onLink(next)
+		}
+
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return "", err
+		}
+
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+
+		parts = append(strings.Split(strings.Trim(target, "/"), "/"), parts...)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,13 @@
+package fsutil
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// UpdateSymlinkTimes updates the atime and mtime timestamps on the target symlink
+func UpdateSymlinkTimes(target string, atime, mtime syscall.Timespec) error {
+	ts := []unix.Timespec{unix.Timespec(atime), unix.Timespec(mtime)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
@@ -0,0 +1,10 @@
+package fsutil
+
+import (
+	"syscall"
+)
+
+// UpdateSymlinkTimes is a no-op on Windows (the symlink timestamps are not preserved)
+func UpdateSymlinkTimes(target string, atime, mtime syscall.Timespec) error {
+	return nil
+}
@@ -10,6 +10,10 @@ type SysStat struct {
 	Atime syscall.Timespec
 	Mtime syscall.Timespec
 	Ctime syscall.Timespec
+	//Dev, Ino and Nlink identify the hard links (they are not set on Windows)
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
 }
 
 /*
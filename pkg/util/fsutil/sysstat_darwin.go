@@ -1,6 +1,7 @@
 package fsutil
 
 import (
+	"os"
 	"syscall"
 )
 
@@ -11,5 +12,17 @@ func SysStatInfo(raw *syscall.Stat_t) SysStat {
 		Atime: raw.Atimespec,
 		Mtime: raw.Mtimespec,
 		Ctime: raw.Ctimespec,
+		Dev:   uint64(raw.Dev),
+		Ino:   raw.Ino,
+		Nlink: uint64(raw.Nlink),
 	}
 }
+
+// FileSysStat returns the system specific file information
+func FileSysStat(info os.FileInfo) (SysStat, bool) {
+	if raw, ok := info.Sys().(*syscall.Stat_t); ok {
+		return SysStatInfo(raw), true
+	}
+
+	return SysStat{}, false
+}
@@ -0,0 +1,19 @@
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileSysStat returns the system specific file information (no owner information on Windows)
+func FileSysStat(info os.FileInfo) (SysStat, bool) {
+	if raw, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return SysStat{
+			Atime: syscall.NsecToTimespec(raw.LastAccessTime.Nanoseconds()),
+			Mtime: syscall.NsecToTimespec(raw.LastWriteTime.Nanoseconds()),
+			Ctime: syscall.NsecToTimespec(raw.CreationTime.Nanoseconds()),
+		}, true
+	}
+
+	return SysStat{}, false
+}
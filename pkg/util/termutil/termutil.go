@@ -0,0 +1,7 @@
+package termutil
+
+// State is the terminal state saved by MakeRaw
+// (the terminal is restored to it with Restore)
+type State struct {
+	termios interface{}
+}
@@ -0,0 +1,90 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package termutil
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// IsTerminal returns true if the file descriptor is a terminal
+func IsTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	return err == nil
+}
+
+// MakeRaw puts the terminal in the raw mode (same as 'cfmakeraw')
+// and returns its previous state
+func MakeRaw(fd int) (*State, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	oldState := *termios
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, termios); err != nil {
+		return nil, err
+	}
+
+	return &State{termios: &oldState}, nil
+}
+
+// Restore puts the terminal back in the saved state
+func Restore(fd int, state *State) error {
+	return unix.IoctlSetTermios(fd, ioctlSetTermios, state.termios.(*unix.Termios))
+}
+
+// Size returns the terminal width and height
+func Size(fd int) (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// NewReader returns the terminal input reader that can be closed while it waits for the input
+// (the terminal is in the non-blocking mode until the reader is closed, so its reads use the poller)
+func NewReader(fd int) (io.ReadCloser, error) {
+	readerFd, err := unix.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.SetNonblock(readerFd, true); err != nil {
+		unix.Close(readerFd)
+		return nil, err
+	}
+
+	return &inputReader{
+		File: os.NewFile(uintptr(readerFd), "terminal"),
+		fd:   fd,
+	}, nil
+}
+
+type inputReader struct {
+	*os.File
+	fd int
+}
+
+// Close stops the pending reads and puts the terminal back in the blocking mode
+// (the non-blocking mode is shared by all file descriptors for the terminal)
+func (r *inputReader) Close() error {
+	err := r.File.Close()
+	if nbErr := unix.SetNonblock(r.fd, false); err == nil {
+		err = nbErr
+	}
+
+	return err
+}
@@ -0,0 +1,34 @@
+package termutil
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotSupported is returned when the raw terminal mode is not available
+var ErrNotSupported = errors.New("raw terminal mode is not supported on Windows")
+
+// IsTerminal returns false on Windows (the raw terminal mode is not supported)
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw is not supported on Windows
+func MakeRaw(fd int) (*State, error) {
+	return nil, ErrNotSupported
+}
+
+// Restore is not supported on Windows
+func Restore(fd int, state *State) error {
+	return ErrNotSupported
+}
+
+// Size is not supported on Windows
+func Size(fd int) (int, int, error) {
+	return 0, 0, ErrNotSupported
+}
+
+// NewReader is not supported on Windows
+func NewReader(fd int) (io.ReadCloser, error) {
+	return nil, ErrNotSupported
+}